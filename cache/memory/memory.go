@@ -17,6 +17,7 @@ package memory
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	info "github.com/google/cadvisor/info/v1"
@@ -63,11 +64,34 @@ func newContainerStore(ref info.ContainerReference, maxAge time.Duration) *conta
 	}
 }
 
+// DefaultBatchInterval is the interval of the batches of stats added to a
+// storage.BulkStorageDriver backend, the default housekeeping interval.
+const DefaultBatchInterval = time.Second
+
+// maxBatchSize is the maximum number of stats collected for a
+// storage.BulkStorageDriver backend, the oldest ones being dropped if it
+// takes longer than the batch interval to add a batch.
+const maxBatchSize = 10000
+
 type InMemoryCache struct {
 	lock              sync.RWMutex
 	containerCacheMap map[string]*containerCache
 	maxAge            time.Duration
 	backend           storage.StorageDriver
+
+	// Set if the backend adds batches of stats, the stats being collected
+	// until the next batch.
+	bulkBackend  storage.BulkStorageDriver
+	batchLock    sync.Mutex
+	batch        []storage.ContainerStatsPair
+	maxBatchSize int
+	// Number of stats dropped because the batch was full, and the number
+	// already logged.
+	dropped       uint64
+	loggedDropped uint64
+	stopOnce      sync.Once
+	stop          chan struct{}
+	done          chan struct{}
 }
 
 func (self *InMemoryCache) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
@@ -83,7 +107,15 @@ func (self *InMemoryCache) AddStats(ref info.ContainerReference, stats *info.Con
 		}
 	}()
 
-	if self.backend != nil {
+	if self.bulkBackend != nil {
+		self.batchLock.Lock()
+		self.batch = append(self.batch, storage.ContainerStatsPair{Ref: ref, Stats: stats})
+		if excess := len(self.batch) - self.maxBatchSize; excess > 0 {
+			self.batch = self.batch[excess:]
+			atomic.AddUint64(&self.dropped, uint64(excess))
+		}
+		self.batchLock.Unlock()
+	} else if self.backend != nil {
 		// TODO(monnand): To deal with long delay write operations, we
 		// may want to start a pool of goroutines to do write
 		// operations.
@@ -94,6 +126,47 @@ func (self *InMemoryCache) AddStats(ref info.ContainerReference, stats *info.Con
 	return cstore.AddStats(stats)
 }
 
+// runBatches adds the collected stats to the backend every interval, until
+// stopped.
+func (self *InMemoryCache) runBatches(interval time.Duration) {
+	defer close(self.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			self.flushBatch()
+		case <-self.stop:
+			self.flushBatch()
+			return
+		}
+	}
+}
+
+// flushBatch adds the collected stats to the backend in a single batch.
+func (self *InMemoryCache) flushBatch() {
+	self.batchLock.Lock()
+	batch := self.batch
+	self.batch = nil
+	self.batchLock.Unlock()
+	if dropped := self.Dropped(); dropped > self.loggedDropped {
+		glog.Errorf("backend storage is too slow, dropped the %d oldest stats (%d dropped in total)", dropped-self.loggedDropped, dropped)
+		self.loggedDropped = dropped
+	}
+	if len(batch) == 0 {
+		return
+	}
+	if err := self.bulkBackend.AddStatsBatch(batch); err != nil {
+		glog.Error(err)
+	}
+}
+
+// Dropped returns the number of stats which were dropped instead of being
+// added to a storage.BulkStorageDriver backend because the batch was full.
+func (self *InMemoryCache) Dropped() uint64 {
+	return atomic.LoadUint64(&self.dropped)
+}
+
 func (self *InMemoryCache) RecentStats(name string, start, end time.Time, maxStats int) ([]*info.ContainerStats, error) {
 	var cstore *containerCache
 	var ok bool
@@ -112,7 +185,14 @@ func (self *InMemoryCache) RecentStats(name string, start, end time.Time, maxSta
 	return cstore.RecentStats(start, end, maxStats)
 }
 
+// Close adds the stats collected to the backend, and clears the cache.
 func (self *InMemoryCache) Close() error {
+	if self.bulkBackend != nil {
+		self.stopOnce.Do(func() {
+			close(self.stop)
+			<-self.done
+		})
+	}
 	self.lock.Lock()
 	self.containerCacheMap = make(map[string]*containerCache, 32)
 	self.lock.Unlock()
@@ -129,11 +209,29 @@ func (self *InMemoryCache) RemoveContainer(containerName string) error {
 func New(
 	maxAge time.Duration,
 	backend storage.StorageDriver,
+) *InMemoryCache {
+	return NewWithBatchInterval(maxAge, backend, DefaultBatchInterval)
+}
+
+// NewWithBatchInterval creates a cache whose stats are added to the backend
+// in batches every batchInterval if it is a storage.BulkStorageDriver, and
+// one at a time otherwise.
+func NewWithBatchInterval(
+	maxAge time.Duration,
+	backend storage.StorageDriver,
+	batchInterval time.Duration,
 ) *InMemoryCache {
 	ret := &InMemoryCache{
 		containerCacheMap: make(map[string]*containerCache, 32),
 		maxAge:            maxAge,
 		backend:           backend,
 	}
+	if bulk, ok := backend.(storage.BulkStorageDriver); ok && batchInterval > 0 {
+		ret.bulkBackend = bulk
+		ret.maxBatchSize = maxBatchSize
+		ret.stop = make(chan struct{})
+		ret.done = make(chan struct{})
+		go ret.runBatches(batchInterval)
+	}
 	return ret
 }
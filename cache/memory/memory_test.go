@@ -15,10 +15,13 @@
 package memory
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
 	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -96,3 +99,127 @@ func TestRecentStatsGetAllStats(t *testing.T) {
 
 	assert.Len(t, getRecentStats(t, memoryCache, -1), 10)
 }
+
+// fakeBackend records the stats added one at a time.
+type fakeBackend struct {
+	lock  sync.Mutex
+	stats []*info.ContainerStats
+}
+
+func (self *fakeBackend) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.stats = append(self.stats, stats)
+	return nil
+}
+
+func (self *fakeBackend) Close() error {
+	return nil
+}
+
+// fakeBulkBackend records the batches of stats added, failing them if
+// fail is set.
+type fakeBulkBackend struct {
+	fakeBackend
+	batches [][]storage.ContainerStatsPair
+	fail    bool
+}
+
+func (self *fakeBulkBackend) AddStatsBatch(batch []storage.ContainerStatsPair) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.batches = append(self.batches, batch)
+	if self.fail {
+		return fmt.Errorf("unavailable")
+	}
+	return nil
+}
+
+func (self *fakeBulkBackend) batchSizes() []int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var sizes []int
+	for _, batch := range self.batches {
+		sizes = append(sizes, len(batch))
+	}
+	return sizes
+}
+
+func TestStatsAreAddedToBackend(t *testing.T) {
+	backend := &fakeBackend{}
+	memoryCache := New(60*time.Second, backend)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, memoryCache.AddStats(containerRef, makeStat(i)))
+	}
+	assert.Len(t, backend.stats, 3)
+}
+
+func TestStatsAreAddedToBulkBackendInBatches(t *testing.T) {
+	backend := &fakeBulkBackend{}
+	memoryCache := NewWithBatchInterval(60*time.Second, backend, time.Hour)
+	containerRef2 := info.ContainerReference{Name: "/container2"}
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, memoryCache.AddStats(containerRef, makeStat(i)))
+		assert.Nil(t, memoryCache.AddStats(containerRef2, makeStat(i)))
+	}
+	assert.Len(t, backend.batchSizes(), 0)
+	// The stats are in the cache before they are added to the backend.
+	assert.Len(t, getRecentStats(t, memoryCache, -1), 3)
+
+	assert.Nil(t, memoryCache.Close())
+	assert.Equal(t, []int{6}, backend.batchSizes())
+	assert.Equal(t, containerRef2, backend.batches[0][1].Ref)
+	assert.Len(t, backend.stats, 0)
+	// Closing again does not add the stats again.
+	assert.Nil(t, memoryCache.Close())
+	assert.Equal(t, []int{6}, backend.batchSizes())
+}
+
+func TestBatchesAreAddedEveryInterval(t *testing.T) {
+	backend := &fakeBulkBackend{fail: true}
+	memoryCache := NewWithBatchInterval(60*time.Second, backend, 10*time.Millisecond)
+	defer memoryCache.Close()
+	assert.Nil(t, memoryCache.AddStats(containerRef, makeStat(0)))
+	for start := time.Now(); len(backend.batchSizes()) == 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("timed out")
+		}
+	}
+	// A failing backend does not prevent caching the stats.
+	assert.Nil(t, memoryCache.AddStats(containerRef, makeStat(1)))
+	assert.Len(t, getRecentStats(t, memoryCache, -1), 2)
+}
+
+func TestOldestStatsAreDroppedWhenBatchIsFull(t *testing.T) {
+	backend := &fakeBulkBackend{}
+	memoryCache := NewWithBatchInterval(60*time.Second, backend, time.Hour)
+	memoryCache.maxBatchSize = 2
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, memoryCache.AddStats(containerRef, makeStat(i)))
+	}
+	assert.Equal(t, uint64(3), memoryCache.Dropped())
+	// The stats are cached even if they are dropped from the batch.
+	assert.Len(t, getRecentStats(t, memoryCache, -1), 5)
+
+	assert.Nil(t, memoryCache.Close())
+	require.Equal(t, []int{2}, backend.batchSizes())
+	assert.Equal(t, makeStat(3).Timestamp, backend.batches[0][0].Stats.Timestamp)
+}
+
+func TestCloseAddsPartialBatch(t *testing.T) {
+	backend := &fakeBulkBackend{}
+	// The ticker does not fire before the cache is closed.
+	memoryCache := NewWithBatchInterval(60*time.Second, backend, time.Hour)
+	memoryCache.maxBatchSize = 10
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, memoryCache.AddStats(containerRef, makeStat(i)))
+	}
+	assert.Len(t, backend.batchSizes(), 0)
+
+	assert.Nil(t, memoryCache.Close())
+	require.Equal(t, []int{3}, backend.batchSizes())
+	for i, pair := range backend.batches[0] {
+		assert.Equal(t, makeStat(i).Timestamp, pair.Stats.Timestamp)
+	}
+	assert.Equal(t, uint64(0), memoryCache.Dropped())
+}
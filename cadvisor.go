@@ -26,9 +26,11 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/google/cadvisor/cache/memory"
 	"github.com/google/cadvisor/container"
 	cadvisorhttp "github.com/google/cadvisor/http"
 	"github.com/google/cadvisor/manager"
+	"github.com/google/cadvisor/storage"
 	"github.com/google/cadvisor/utils/sysfs"
 	"github.com/google/cadvisor/version"
 
@@ -117,7 +119,7 @@ func main() {
 
 	setMaxProcs()
 
-	memoryStorage, err := NewMemoryStorage()
+	memoryStorage, backendStorage, err := NewMemoryStorage()
 	if err != nil {
 		glog.Fatalf("Failed to initialize storage driver: %s", err)
 	}
@@ -131,6 +133,15 @@ func main() {
 		glog.Fatalf("Failed to create a Container Manager: %s", err)
 	}
 
+	// Let the backend storage store the machine information and container
+	// specifications too.
+	if consumer, ok := backendStorage.(storage.MachineInfoConsumer); ok {
+		consumer.SetMachineInfoSource(containerManager)
+	}
+	if consumer, ok := backendStorage.(storage.ContainerSpecConsumer); ok {
+		consumer.SetContainerSpecSource(containerManager)
+	}
+
 	mux := http.NewServeMux()
 
 	if *enableProfiling {
@@ -154,7 +165,7 @@ func main() {
 	}
 
 	// Install signal handler.
-	installSignalHandler(containerManager)
+	installSignalHandler(containerManager, memoryStorage, backendStorage)
 
 	glog.Infof("Starting cAdvisor version: %s-%s on port %d", version.Info["version"], version.Info["revision"], *argPort)
 
@@ -180,7 +191,7 @@ func setMaxProcs() {
 	}
 }
 
-func installSignalHandler(containerManager manager.Manager) {
+func installSignalHandler(containerManager manager.Manager, memoryStorage *memory.InMemoryCache, backendStorage storage.StorageDriver) {
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, os.Kill, syscall.SIGTERM)
 
@@ -190,7 +201,22 @@ func installSignalHandler(containerManager manager.Manager) {
 		if err := containerManager.Stop(); err != nil {
 			glog.Errorf("Failed to stop container manager: %v", err)
 		}
+		// Send the stats still buffered to the backend storage: the batch of
+		// the memory storage, then the buffers of the backend itself.
+		var errs []string
+		if err := memoryStorage.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+		if backendStorage != nil {
+			if err := backendStorage.Close(); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		if len(errs) > 0 {
+			glog.Errorf("Failed to close the storage: %s", strings.Join(errs, "; "))
+		}
 		glog.Infof("Exiting given signal: %v", sig)
+		glog.Flush()
 		os.Exit(0)
 	}()
 }
@@ -265,6 +265,8 @@ func ContainerSpecFromV1(specV1 *v1.ContainerSpec, aliases []string, namespace s
 		specV2.Cpu.Limit = specV1.Cpu.Limit
 		specV2.Cpu.MaxLimit = specV1.Cpu.MaxLimit
 		specV2.Cpu.Mask = specV1.Cpu.Mask
+		specV2.Cpu.Quota = specV1.Cpu.Quota
+		specV2.Cpu.Period = specV1.Cpu.Period
 	}
 	if specV1.HasMemory {
 		specV2.Memory.Limit = specV1.Memory.Limit
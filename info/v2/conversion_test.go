@@ -39,6 +39,8 @@ func TestContanierSpecFromV1(t *testing.T) {
 			Limit:    2048,
 			MaxLimit: 4096,
 			Mask:     "cpu_mask",
+			Quota:    50000,
+			Period:   100000,
 		},
 		HasMemory: true,
 		Memory: v1.MemorySpec{
@@ -71,6 +73,8 @@ func TestContanierSpecFromV1(t *testing.T) {
 			Limit:    2048,
 			MaxLimit: 4096,
 			Mask:     "cpu_mask",
+			Quota:    50000,
+			Period:   100000,
 		},
 		HasMemory: true,
 		Memory: MemorySpec{
@@ -108,6 +112,8 @@ func TestContainerStatsFromV1(t *testing.T) {
 			Limit:    2048,
 			MaxLimit: 4096,
 			Mask:     "cpu_mask",
+			Quota:    50000,
+			Period:   100000,
 		},
 		HasMemory: true,
 		Memory: v1.MemorySpec{
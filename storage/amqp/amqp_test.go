@@ -0,0 +1,250 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amqp
+
+import (
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+var (
+	testRef = info.ContainerReference{
+		Name:    "/docker/abc",
+		Id:      "abc",
+		Aliases: []string{"web.1", "abc"},
+		Labels:  map[string]string{"app": "shop"},
+	}
+	testStats = &info.ContainerStats{
+		Timestamp: time.Unix(1451606400, 0).UTC(),
+		Memory:    info.MemoryStats{Usage: 4096},
+	}
+)
+
+func testOptions(broker *fakeBroker) dialOptions {
+	return dialOptions{url: broker.url(), exchange: "cadvisor", exchangeType: "topic", declareExchange: true, confirm: true}
+}
+
+// testConfig returns the configuration of a driver publishing persistent
+// messages to broker.
+func testConfig(broker *fakeBroker) config {
+	return config{
+		machineName:    "host-1",
+		routingKey:     "cadvisor",
+		options:        testOptions(broker),
+		persistent:     true,
+		confirmTimeout: time.Second,
+		maxPending:     10,
+		enqueueTimeout: time.Millisecond,
+		drainTimeout:   time.Second,
+	}
+}
+
+func newTestStorage(t *testing.T, broker *fakeBroker) *amqpStorage {
+	cfg := testConfig(broker)
+	cfg.machineName = "host-1.example.com"
+	cfg.routingKey = "{machine}.{container}"
+	cfg.confirmTimeout = 50 * time.Millisecond
+	cfg.enqueueTimeout = 10 * time.Millisecond
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.backoff = time.Millisecond
+	return driver
+}
+
+func TestRoutingKey(t *testing.T) {
+	for template, expected := range map[string]string{
+		"{machine}.{container}":           "host-1_example_com.web_1",
+		"stats.{label:app}":               "stats.shop",
+		"{label:missing}.{label:app}.x":   ".shop.x",
+		"{machine}.{unknown}.{container}": "host-1_example_com.{unknown}.web_1",
+	} {
+		driver := &amqpStorage{machineName: "host-1.example.com", routingKey: template}
+		if got := driver.routingKeyOf(testRef, "web.1"); got != expected {
+			t.Errorf("routing key of %q: expected %q, got %q", template, expected, got)
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	broker := newFakeBroker(t)
+	defer broker.close()
+	driver := newTestStorage(t, broker)
+
+	if err := driver.AddStats(testRef, testStats); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	messages := broker.published()
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	msg := messages[0]
+	expected := properties{contentType: "application/json", deliveryMode: 2, timestamp: testStats.Timestamp, appId: "cadvisor"}
+	if msg.exchange != "cadvisor" || msg.routingKey != "host-1_example_com.web_1" || msg.props != expected {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	var detail detailSpec
+	if err := json.Unmarshal(msg.body, &detail); err != nil {
+		t.Fatal(err)
+	}
+	if detail.MachineName != "host-1.example.com" || detail.ContainerName != "web.1" || detail.ContainerID != "abc" ||
+		detail.ContainerLabels["app"] != "shop" || !detail.Timestamp.Equal(testStats.Timestamp) || detail.ContainerStats.Memory.Usage != 4096 {
+		t.Errorf("unexpected message %s", msg.body)
+	}
+	if published := atomic.LoadUint64(&driver.published); published != 1 {
+		t.Errorf("expected 1 message published, got %d", published)
+	}
+}
+
+func TestPublishBatch(t *testing.T) {
+	broker := newFakeBroker(t)
+	defer broker.close()
+	driver := newTestStorage(t, broker)
+
+	for i := 0; i < 10; i++ {
+		driver.AddStats(testRef, testStats)
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if published, n := atomic.LoadUint64(&driver.published), len(broker.published()); published != 10 || n != 10 {
+		t.Errorf("expected 10 messages published, got %d, %d received", published, n)
+	}
+}
+
+func TestRepublishRejected(t *testing.T) {
+	broker := newFakeBroker(t, func(s *fakeBroker) { s.nacks = 1 })
+	defer broker.close()
+	driver := newTestStorage(t, broker)
+
+	driver.AddStats(testRef, testStats)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(broker.published()); n != 2 {
+		t.Errorf("expected the rejected message to be published again, got %d messages", n)
+	}
+	if published, failed := atomic.LoadUint64(&driver.published), atomic.LoadUint64(&driver.failed); published != 1 || failed != 0 {
+		t.Errorf("expected 1 message published and none failed, got %d and %d", published, failed)
+	}
+}
+
+func TestReconnectRedeclaresExchange(t *testing.T) {
+	broker := newFakeBroker(t)
+	defer broker.close()
+	driver := newTestStorage(t, broker)
+
+	driver.AddStats(testRef, testStats)
+	waitFor(t, func() bool { return atomic.LoadUint64(&driver.published) == 1 })
+	// As if the broker restarted.
+	broker.dropConnections()
+	driver.AddStats(testRef, testStats)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if published := atomic.LoadUint64(&driver.published); published != 2 {
+		t.Errorf("expected the message to be published after reconnecting, got %d published", published)
+	}
+	if n := len(broker.connected()); n != 2 {
+		t.Errorf("expected 2 connections, got %d", n)
+	}
+	if n := len(broker.declared()); n != 2 {
+		t.Errorf("expected the exchange to be declared again, got %d declarations", n)
+	}
+}
+
+func TestEnqueueTimeout(t *testing.T) {
+	// The queue is not consumed.
+	driver := &amqpStorage{queue: make(chan *message, 2), routingKey: "cadvisor", enqueueTimeout: 10 * time.Millisecond}
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := driver.AddStats(testRef, testStats); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected AddStats to wait at most the enqueue timeout, took %v", elapsed)
+	}
+	if dropped := atomic.LoadUint64(&driver.dropped); dropped != 3 {
+		t.Errorf("expected 3 dropped messages, got %d", dropped)
+	}
+	driver.routingKey = strings.Repeat("x", 256)
+	if err := driver.AddStats(testRef, testStats); err == nil {
+		t.Error("expected an error for a routing key longer than 255 bytes")
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	broker := newFakeBroker(t, func(s *fakeBroker) { s.noAcks = true })
+	defer broker.close()
+	cfg := testConfig(broker)
+	cfg.persistent = false
+	cfg.confirmTimeout = 20 * time.Millisecond
+	cfg.drainTimeout = 30 * time.Millisecond
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		driver.AddStats(testRef, testStats)
+	}
+	start := time.Now()
+	err = driver.Close()
+	if err == nil || !strings.Contains(err.Error(), "not published") {
+		t.Errorf("expected the pending messages to be reported, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected Close to return after the drain timeout, took %v", elapsed)
+	}
+}
+
+func TestNewStorageValidation(t *testing.T) {
+	broker := newFakeBroker(t, func(s *fakeBroker) { s.password = "secret" })
+	defer broker.close()
+	cfg := testConfig(broker)
+	cfg.maxPending = 0
+	if _, err := newStorage(cfg); err == nil {
+		t.Error("expected an error for no pending messages")
+	}
+	cfg = testConfig(broker)
+	cfg.options.exchange = strings.Repeat("x", 256)
+	if _, err := newStorage(cfg); err == nil {
+		t.Error("expected an error for an exchange longer than 255 bytes")
+	}
+	cfg = testConfig(broker)
+	cfg.options.url = strings.Replace(cfg.options.url, "secret", "wrong", 1)
+	if _, err := newStorage(cfg); err == nil {
+		t.Error("expected an error for a wrong password")
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,433 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amqp
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	dialTimeout = 5 * time.Second
+	// Channel the messages are published on.
+	publishChannel = 1
+	// Largest frame the client accepts, if the broker allows it.
+	maxFrameSize = 131072
+	// Maximum number of confirmations received and not yet waited for.
+	maxConfirmations = 1024
+)
+
+// dialOptions are how to connect to the broker, and the exchange the
+// messages are published to.
+type dialOptions struct {
+	url       string
+	tlsConfig *tls.Config
+	heartbeat time.Duration
+	// Exchange of the messages, declared on every connection unless not
+	// declareExchange.
+	exchange        string
+	exchangeType    string
+	declareExchange bool
+	// Whether the broker confirms the messages.
+	confirm bool
+}
+
+// confirmation is a Basic.Ack or a Basic.Nack of the broker, of the
+// message of a delivery tag, or of all the messages up to it if multiple.
+type confirmation struct {
+	tag      uint64
+	multiple bool
+	ack      bool
+}
+
+// conn is a connection of an AMQP 0-9-1 client to a broker, which only
+// publishes, on a single channel.
+type conn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	frameMax  uint32
+	heartbeat time.Duration
+
+	writeLock sync.Mutex
+	// Delivery tag of the last message published.
+	lastTag uint64
+	// Receives the confirmations of the messages.
+	confirms chan confirmation
+
+	lock   sync.Mutex
+	err    error
+	closed chan struct{}
+}
+
+// brokerAddress returns the host and port of the broker, whether to use
+// TLS, the user, the password and the virtual host, of its URL.
+func brokerAddress(rawurl string) (host string, useTLS bool, username, password, vhost string, err error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", false, "", "", "", err
+	}
+	port := "5672"
+	switch u.Scheme {
+	case "amqp":
+	case "amqps":
+		useTLS, port = true, "5671"
+	default:
+		return "", false, "", "", "", fmt.Errorf("invalid AMQP URL %q, the scheme must be amqp or amqps", rawurl)
+	}
+	if u.Hostname() == "" {
+		return "", false, "", "", "", fmt.Errorf("invalid AMQP URL %q, no host", rawurl)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	username, password = "guest", "guest"
+	if u.User != nil {
+		username = u.User.Username()
+		password, _ = u.User.Password()
+	}
+	vhost = strings.TrimPrefix(u.Path, "/")
+	if vhost == "" {
+		vhost = "/"
+	}
+	return net.JoinHostPort(u.Hostname(), port), useTLS, username, password, vhost, nil
+}
+
+// dial connects to the broker, authenticates, opens the channel of the
+// messages, declares their exchange and selects the confirmations.
+func dial(options dialOptions) (*conn, error) {
+	host, useTLS, username, password, vhost, err := brokerAddress(options.url)
+	if err != nil {
+		return nil, err
+	}
+	netConn, err := net.DialTimeout("tcp", host, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if useTLS {
+		tlsConfig := &tls.Config{}
+		if options.tlsConfig != nil {
+			tlsConfig = options.tlsConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName, _, _ = net.SplitHostPort(host)
+		}
+		tlsConn := tls.Client(netConn, tlsConfig)
+		tlsConn.SetDeadline(time.Now().Add(dialTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("TLS handshake with the AMQP broker failed - %v", err)
+		}
+		netConn = tlsConn
+	}
+	c := &conn{
+		conn:     netConn,
+		reader:   bufio.NewReader(netConn),
+		frameMax: maxFrameSize,
+		confirms: make(chan confirmation, maxConfirmations),
+		closed:   make(chan struct{}),
+	}
+	netConn.SetDeadline(time.Now().Add(dialTimeout))
+	if err := c.open(username, password, vhost, options); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	netConn.SetDeadline(time.Time{})
+	go c.readLoop()
+	go c.heartbeatLoop()
+	return c, nil
+}
+
+func (self *conn) open(username, password, vhost string, options dialOptions) error {
+	if _, err := self.conn.Write([]byte("AMQP\x00\x00\x09\x01")); err != nil {
+		return err
+	}
+	args, err := self.expect(0, methodConnectionStart)
+	if err != nil {
+		return err
+	}
+	args.octet()
+	args.octet()
+	args.skipTable()
+	mechanisms := args.longstr()
+	if err := args.err(); err != nil {
+		return err
+	}
+	if !strings.Contains(" "+mechanisms+" ", " PLAIN ") {
+		return fmt.Errorf("AMQP broker does not support the PLAIN authentication, only %q", mechanisms)
+	}
+	clientProperties := map[string]interface{}{
+		"product": "cAdvisor",
+		"capabilities": map[string]interface{}{
+			"publisher_confirms":           true,
+			"connection.blocked":           true,
+			"consumer_cancel_notify":       false,
+			"authentication_failure_close": true,
+		},
+	}
+	startOk := (&encoder{}).table(clientProperties).shortstr("PLAIN").longstr("\x00" + username + "\x00" + password).shortstr("en_US")
+	if err := self.writeMethod(0, methodConnectionStartOk, startOk); err != nil {
+		return err
+	}
+
+	if args, err = self.expect(0, methodConnectionTune); err != nil {
+		return err
+	}
+	channelMax, frameMax, heartbeat := args.short(), args.long(), args.short()
+	if err := args.err(); err != nil {
+		return err
+	}
+	if frameMax != 0 && frameMax < self.frameMax {
+		self.frameMax = frameMax
+	}
+	// The shortest heartbeat of both, unless the client disables them.
+	self.heartbeat = options.heartbeat / time.Second * time.Second
+	if server := time.Duration(heartbeat) * time.Second; server > 0 && server < self.heartbeat {
+		self.heartbeat = server
+	}
+	if channelMax == 0 || channelMax > publishChannel {
+		channelMax = publishChannel
+	}
+	tuneOk := (&encoder{}).short(channelMax).long(self.frameMax).short(uint16(self.heartbeat / time.Second))
+	if err := self.writeMethod(0, methodConnectionTuneOk, tuneOk); err != nil {
+		return err
+	}
+	if err := self.writeMethod(0, methodConnectionOpen, (&encoder{}).shortstr(vhost).shortstr("").octet(0)); err != nil {
+		return err
+	}
+	if _, err := self.expect(0, methodConnectionOpenOk); err != nil {
+		return err
+	}
+
+	if err := self.writeMethod(publishChannel, methodChannelOpen, (&encoder{}).shortstr("")); err != nil {
+		return err
+	}
+	if _, err := self.expect(publishChannel, methodChannelOpenOk); err != nil {
+		return err
+	}
+	if options.declareExchange {
+		// Durable, not auto-deleted, not internal.
+		declare := (&encoder{}).short(0).shortstr(options.exchange).shortstr(options.exchangeType).octet(0x02).table(nil)
+		if err := declare.err(); err != nil {
+			return err
+		}
+		if err := self.writeMethod(publishChannel, methodExchangeDeclare, declare); err != nil {
+			return err
+		}
+		if _, err := self.expect(publishChannel, methodExchangeDeclareOk); err != nil {
+			return fmt.Errorf("failed to declare the exchange %q - %v", options.exchange, err)
+		}
+	}
+	if options.confirm {
+		if err := self.writeMethod(publishChannel, methodConfirmSelect, (&encoder{}).octet(0)); err != nil {
+			return err
+		}
+		if _, err := self.expect(publishChannel, methodConfirmSelectOk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expect reads frames until a method, skipping the heartbeats, and returns
+// its arguments if it is the expected one. The broker closing the
+// connection or the channel instead is returned as an error.
+func (self *conn) expect(channel uint16, expected uint32) (*decoder, error) {
+	for {
+		f, err := readFrame(self.reader, self.frameMax)
+		if err != nil {
+			if err == io.EOF {
+				err = errors.New("connection closed by the AMQP broker")
+			}
+			return nil, err
+		}
+		if f.frameType == frameHeartbeat {
+			continue
+		}
+		method, args, err := f.method()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case method == expected && f.channel == channel:
+			return args, nil
+		case method == methodConnectionClose || method == methodChannelClose:
+			return nil, closeError(args)
+		case method == methodConnectionBlocked || method == methodConnectionUnblocked:
+			continue
+		}
+		return nil, fmt.Errorf("unexpected AMQP method %d.%d instead of %d.%d", method>>16, method&0xffff, expected>>16, expected&0xffff)
+	}
+}
+
+// closeError returns the error of a Connection.Close or a Channel.Close.
+func closeError(args *decoder) error {
+	code, text := args.short(), args.shortstr()
+	if err := args.err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("closed by the AMQP broker: %d %s", code, text)
+}
+
+// readLoop passes on the confirmations, until the connection fails, or the
+// broker closes it or is silent for longer than two heartbeats.
+func (self *conn) readLoop() {
+	err := func() error {
+		for {
+			if self.heartbeat > 0 {
+				self.conn.SetReadDeadline(time.Now().Add(2 * self.heartbeat))
+			}
+			f, err := readFrame(self.reader, self.frameMax)
+			if err != nil {
+				return err
+			}
+			if f.frameType != frameMethod {
+				continue
+			}
+			method, args, err := f.method()
+			if err != nil {
+				return err
+			}
+			switch method {
+			case methodBasicAck, methodBasicNack:
+				c := confirmation{tag: args.longlong(), ack: method == methodBasicAck}
+				c.multiple = args.octet()&0x01 != 0
+				if err := args.err(); err != nil {
+					return err
+				}
+				select {
+				case self.confirms <- c:
+				case <-self.closed:
+					return errClosed
+				}
+			case methodConnectionBlocked:
+				glog.Warningf("AMQP: the broker blocks publishing: %s", args.shortstr())
+			case methodConnectionUnblocked:
+				glog.Infof("AMQP: the broker unblocks publishing")
+			case methodChannelClose:
+				self.writeMethod(f.channel, methodChannelCloseOk, nil)
+				return closeError(args)
+			case methodConnectionClose:
+				self.writeMethod(0, methodConnectionCloseOk, nil)
+				return closeError(args)
+			case methodConnectionCloseOk:
+				return errClosed
+			}
+		}
+	}()
+	self.fail(err)
+}
+
+// heartbeatLoop sends a heartbeat every half of the heartbeat interval, so
+// that the broker does not close the connection.
+func (self *conn) heartbeatLoop() {
+	if self.heartbeat <= 0 {
+		return
+	}
+	ticker := time.NewTicker(self.heartbeat / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := self.write(frame{frameType: frameHeartbeat}); err != nil {
+				self.fail(err)
+				return
+			}
+		case <-self.closed:
+			return
+		}
+	}
+}
+
+func (self *conn) writeMethod(channel uint16, method uint32, args *encoder) error {
+	return self.write(methodFrame(channel, method, args))
+}
+
+func (self *conn) write(frames ...frame) error {
+	var b []byte
+	for _, f := range frames {
+		b = append(b, f.encode()...)
+	}
+	self.writeLock.Lock()
+	defer self.writeLock.Unlock()
+	self.conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+	_, err := self.conn.Write(b)
+	return err
+}
+
+var errClosed = errors.New("connection closed")
+
+// fail closes the connection after an error.
+func (self *conn) fail(err error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.err != nil {
+		return
+	}
+	if err == nil {
+		err = errClosed
+	}
+	self.err = err
+	self.conn.Close()
+	close(self.closed)
+}
+
+func (self *conn) failed() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.err
+}
+
+// publish publishes a message to an exchange, and returns its delivery tag,
+// which its confirmation refers to. It is not safe for concurrent use.
+func (self *conn) publish(exchange, routingKey string, props properties, body []byte) (uint64, error) {
+	if err := self.failed(); err != nil {
+		return 0, err
+	}
+	args := (&encoder{}).short(0).shortstr(exchange).shortstr(routingKey).octet(0)
+	if err := args.err(); err != nil {
+		return 0, err
+	}
+	frames := append([]frame{methodFrame(publishChannel, methodBasicPublish, args)}, contentFrames(publishChannel, props, body, self.frameMax)...)
+	if err := self.write(frames...); err != nil {
+		self.fail(err)
+		return 0, err
+	}
+	self.lastTag++
+	return self.lastTag, nil
+}
+
+// close closes the connection cleanly, waiting for the broker at most
+// timeout.
+func (self *conn) close(timeout time.Duration) {
+	if self.failed() == nil {
+		if err := self.writeMethod(0, methodConnectionClose, (&encoder{}).short(200).shortstr("Goodbye").short(0).short(0)); err == nil {
+			select {
+			case <-self.closed:
+			case <-time.After(timeout):
+			}
+		}
+	}
+	self.fail(errClosed)
+}
@@ -0,0 +1,312 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package amqp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Types of the AMQP 0-9-1 frames.
+const (
+	frameMethod    = 1
+	frameHeader    = 2
+	frameBody      = 3
+	frameHeartbeat = 8
+
+	frameEnd = 0xce
+	// Size of the header and the end of a frame.
+	frameOverhead = 8
+)
+
+// Methods, their class ID in the high 16 bits and their method ID in the
+// low 16 bits.
+const (
+	methodConnectionStart     = 10<<16 | 10
+	methodConnectionStartOk   = 10<<16 | 11
+	methodConnectionTune      = 10<<16 | 30
+	methodConnectionTuneOk    = 10<<16 | 31
+	methodConnectionOpen      = 10<<16 | 40
+	methodConnectionOpenOk    = 10<<16 | 41
+	methodConnectionClose     = 10<<16 | 50
+	methodConnectionCloseOk   = 10<<16 | 51
+	methodConnectionBlocked   = 10<<16 | 60
+	methodConnectionUnblocked = 10<<16 | 61
+	methodChannelOpen         = 20<<16 | 10
+	methodChannelOpenOk       = 20<<16 | 11
+	methodChannelClose        = 20<<16 | 40
+	methodChannelCloseOk      = 20<<16 | 41
+	methodExchangeDeclare     = 40<<16 | 10
+	methodExchangeDeclareOk   = 40<<16 | 11
+	methodBasicPublish        = 60<<16 | 40
+	methodBasicAck            = 60<<16 | 80
+	methodBasicNack           = 60<<16 | 120
+	methodConfirmSelect       = 85<<16 | 10
+	methodConfirmSelectOk     = 85<<16 | 11
+)
+
+const classBasic = 60
+
+// Flags of the properties of a message in its content header.
+const (
+	propertyContentType  = 0x8000
+	propertyDeliveryMode = 0x1000
+	propertyTimestamp    = 0x0040
+	propertyAppId        = 0x0008
+)
+
+type frame struct {
+	frameType byte
+	channel   uint16
+	payload   []byte
+}
+
+func (self frame) encode() []byte {
+	b := make([]byte, 0, len(self.payload)+frameOverhead)
+	b = append(b, self.frameType, byte(self.channel>>8), byte(self.channel))
+	b = binary.BigEndian.AppendUint32(b, uint32(len(self.payload)))
+	b = append(b, self.payload...)
+	return append(b, frameEnd)
+}
+
+// readFrame reads a frame, of at most maxSize bytes if not 0.
+func readFrame(r *bufio.Reader, maxSize uint32) (frame, error) {
+	var header [7]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return frame{}, err
+	}
+	size := binary.BigEndian.Uint32(header[3:])
+	if maxSize != 0 && size+frameOverhead > maxSize {
+		return frame{}, fmt.Errorf("AMQP frame of %d bytes is larger than the maximum of %d", size, maxSize)
+	}
+	payload := make([]byte, size+1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return frame{}, err
+	}
+	if payload[size] != frameEnd {
+		return frame{}, errors.New("malformed AMQP frame end")
+	}
+	return frame{frameType: header[0], channel: binary.BigEndian.Uint16(header[1:]), payload: payload[:size]}, nil
+}
+
+// method returns the method of a method frame, and a decoder of its
+// arguments.
+func (self frame) method() (uint32, *decoder, error) {
+	if self.frameType != frameMethod || len(self.payload) < 4 {
+		return 0, nil, fmt.Errorf("unexpected AMQP frame of type %d", self.frameType)
+	}
+	return binary.BigEndian.Uint32(self.payload), &decoder{b: self.payload[4:]}, nil
+}
+
+// methodFrame returns the frame of a method with its encoded arguments.
+func methodFrame(channel uint16, method uint32, args *encoder) frame {
+	payload := binary.BigEndian.AppendUint32(nil, method)
+	if args != nil {
+		payload = append(payload, args.b...)
+	}
+	return frame{frameType: frameMethod, channel: channel, payload: payload}
+}
+
+// encoder encodes the arguments of a method. The first error is kept, and
+// returned by err.
+type encoder struct {
+	b     []byte
+	error error
+}
+
+func (self *encoder) octet(v byte) *encoder {
+	self.b = append(self.b, v)
+	return self
+}
+
+func (self *encoder) short(v uint16) *encoder {
+	self.b = binary.BigEndian.AppendUint16(self.b, v)
+	return self
+}
+
+func (self *encoder) long(v uint32) *encoder {
+	self.b = binary.BigEndian.AppendUint32(self.b, v)
+	return self
+}
+
+func (self *encoder) longlong(v uint64) *encoder {
+	self.b = binary.BigEndian.AppendUint64(self.b, v)
+	return self
+}
+
+func (self *encoder) shortstr(s string) *encoder {
+	if len(s) > 255 {
+		if self.error == nil {
+			self.error = fmt.Errorf("%q is longer than 255 bytes", s)
+		}
+		s = s[:255]
+	}
+	self.b = append(self.b, byte(len(s)))
+	self.b = append(self.b, s...)
+	return self
+}
+
+func (self *encoder) longstr(s string) *encoder {
+	self.long(uint32(len(s)))
+	self.b = append(self.b, s...)
+	return self
+}
+
+// table encodes a field table of strings, booleans and tables, sorting the
+// fields by name.
+func (self *encoder) table(t map[string]interface{}) *encoder {
+	fields := &encoder{}
+	names := make([]string, 0, len(t))
+	for name := range t {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fields.shortstr(name)
+		switch v := t[name].(type) {
+		case string:
+			fields.octet('S').longstr(v)
+		case bool:
+			b := byte(0)
+			if v {
+				b = 1
+			}
+			fields.octet('t').octet(b)
+		case map[string]interface{}:
+			fields.octet('F').table(v)
+		default:
+			panic(fmt.Sprintf("unsupported AMQP field %q of type %T", name, v))
+		}
+	}
+	if fields.error != nil && self.error == nil {
+		self.error = fields.error
+	}
+	self.long(uint32(len(fields.b)))
+	self.b = append(self.b, fields.b...)
+	return self
+}
+
+func (self *encoder) err() error {
+	return self.error
+}
+
+// decoder decodes the arguments of a method. After an error, it decodes
+// zero values, the error being returned by err.
+type decoder struct {
+	b     []byte
+	error error
+}
+
+func (self *decoder) next(n int) []byte {
+	if self.error != nil {
+		return make([]byte, n)
+	}
+	if len(self.b) < n {
+		self.error = errors.New("truncated AMQP method")
+		return make([]byte, n)
+	}
+	b := self.b[:n]
+	self.b = self.b[n:]
+	return b
+}
+
+func (self *decoder) octet() byte {
+	return self.next(1)[0]
+}
+
+func (self *decoder) short() uint16 {
+	return binary.BigEndian.Uint16(self.next(2))
+}
+
+func (self *decoder) long() uint32 {
+	return binary.BigEndian.Uint32(self.next(4))
+}
+
+func (self *decoder) longlong() uint64 {
+	return binary.BigEndian.Uint64(self.next(8))
+}
+
+func (self *decoder) shortstr() string {
+	return string(self.next(int(self.octet())))
+}
+
+func (self *decoder) longstr() string {
+	n := self.long()
+	if self.error == nil && uint64(n) > uint64(len(self.b)) {
+		self.error = errors.New("truncated AMQP method")
+		return ""
+	}
+	return string(self.next(int(n)))
+}
+
+// skipTable skips a field table, which the client does not need.
+func (self *decoder) skipTable() {
+	self.longstr()
+}
+
+func (self *decoder) err() error {
+	return self.error
+}
+
+// properties are the properties of a message the driver sets.
+type properties struct {
+	contentType  string
+	deliveryMode byte
+	timestamp    time.Time
+	appId        string
+}
+
+// contentFrames returns the content header and body frames of a message,
+// the body being split in frames of at most frameMax bytes.
+func contentFrames(channel uint16, props properties, body []byte, frameMax uint32) []frame {
+	var flags uint16
+	args := &encoder{}
+	if props.contentType != "" {
+		flags |= propertyContentType
+		args.shortstr(props.contentType)
+	}
+	if props.deliveryMode != 0 {
+		flags |= propertyDeliveryMode
+		args.octet(props.deliveryMode)
+	}
+	if !props.timestamp.IsZero() {
+		flags |= propertyTimestamp
+		args.longlong(uint64(props.timestamp.Unix()))
+	}
+	if props.appId != "" {
+		flags |= propertyAppId
+		args.shortstr(props.appId)
+	}
+	header := (&encoder{}).short(classBasic).short(0).longlong(uint64(len(body))).short(flags)
+	frames := []frame{{frameType: frameHeader, channel: channel, payload: append(header.b, args.b...)}}
+	size := len(body)
+	if frameMax > frameOverhead {
+		size = int(frameMax - frameOverhead)
+	}
+	for len(body) > 0 {
+		n := size
+		if n > len(body) {
+			n = len(body)
+		}
+		frames = append(frames, frame{frameType: frameBody, channel: channel, payload: body[:n]})
+		body = body[n:]
+	}
+	return frames
+}
@@ -0,0 +1,180 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azuremonitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// Azure Instance Metadata Service of the virtual machines.
+	imdsURL = "http://169.254.169.254"
+	// Resource the tokens of the custom metrics ingestion are issued for.
+	monitoringResource = "https://monitoring.azure.com/"
+	// Azure Active Directory endpoint of the client secret authentication.
+	loginURL = "https://login.microsoftonline.com/"
+)
+
+// imdsClient queries the Instance Metadata Service of the virtual machine.
+type imdsClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+func newIMDSClient() *imdsClient {
+	return &imdsClient{
+		baseURL: imdsURL,
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (self *imdsClient) get(path string, query url.Values) ([]byte, error) {
+	req, err := http.NewRequest("GET", self.baseURL+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+	resp, err := self.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("instance metadata service returned %s for %s: %s", resp.Status, path, strings.TrimSpace(string(b)))
+	}
+	return b, nil
+}
+
+// instance returns the resource ID and the region of the virtual machine.
+func (self *imdsClient) instance() (resourceID, location string, err error) {
+	b, err := self.get("/metadata/instance/compute", url.Values{"api-version": {"2021-02-01"}})
+	if err != nil {
+		return "", "", err
+	}
+	var compute struct {
+		ResourceID string `json:"resourceId"`
+		Location   string `json:"location"`
+	}
+	if err := json.Unmarshal(b, &compute); err != nil {
+		return "", "", fmt.Errorf("invalid instance metadata - %v", err)
+	}
+	if compute.ResourceID == "" || compute.Location == "" {
+		return "", "", fmt.Errorf("no resource ID or location in the instance metadata")
+	}
+	return compute.ResourceID, compute.Location, nil
+}
+
+// managedIdentity gets the tokens of the managed identity of the virtual
+// machine, the system-assigned one unless the client ID of a user-assigned
+// one is set.
+type managedIdentity struct {
+	imds     *imdsClient
+	clientID string
+}
+
+func (self *managedIdentity) Token() (*oauth2.Token, error) {
+	query := url.Values{"api-version": {"2018-02-01"}, "resource": {monitoringResource}}
+	if self.clientID != "" {
+		query.Set("client_id", self.clientID)
+	}
+	b, err := self.imds.get("/metadata/identity/oauth2/token", query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a token of the managed identity - %v", err)
+	}
+	return parseToken(b)
+}
+
+// clientSecret gets the tokens of a service principal from Azure Active
+// Directory with its client secret.
+type clientSecret struct {
+	tokenURL string
+	clientID string
+	secret   string
+	client   *http.Client
+}
+
+func newClientSecret(tenantID, clientID, secret string) *clientSecret {
+	return &clientSecret{
+		tokenURL: loginURL + url.PathEscape(tenantID) + "/oauth2/token",
+		clientID: clientID,
+		secret:   secret,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (self *clientSecret) Token() (*oauth2.Token, error) {
+	resp, err := self.client.PostForm(self.tokenURL, url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {self.clientID},
+		"client_secret": {self.secret},
+		"resource":      {monitoringResource},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var res struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(b, &res) == nil && res.Error != "" {
+			return nil, fmt.Errorf("failed to get a token of the service principal - %s: %s", res.Error, res.Description)
+		}
+		return nil, fmt.Errorf("failed to get a token of the service principal - %s", resp.Status)
+	}
+	return parseToken(b)
+}
+
+// parseToken parses the tokens of Azure Active Directory and of the
+// Instance Metadata Service, whose expires_in is a string.
+func parseToken(b []byte) (*oauth2.Token, error) {
+	var res struct {
+		AccessToken string      `json:"access_token"`
+		TokenType   string      `json:"token_type"`
+		ExpiresIn   json.Number `json:"expires_in"`
+	}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, fmt.Errorf("invalid token - %v", err)
+	}
+	if res.AccessToken == "" {
+		return nil, fmt.Errorf("no access token")
+	}
+	token := &oauth2.Token{
+		AccessToken: res.AccessToken,
+		TokenType:   res.TokenType,
+	}
+	if expiresIn, err := strconv.ParseInt(res.ExpiresIn.String(), 10, 64); err == nil && expiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	}
+	return token, nil
+}
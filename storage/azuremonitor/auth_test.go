@@ -0,0 +1,104 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azuremonitor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestInstance(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata") != "true" || r.URL.Path != "/metadata/instance/compute" || r.URL.Query().Get("api-version") == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"location": "westeurope", "name": "vm-1", "resourceId": "/subscriptions/s/resourceGroups/g/providers/Microsoft.Compute/virtualMachines/vm-1"}`))
+	}))
+	defer server.Close()
+
+	imds := &imdsClient{baseURL: server.URL, client: http.DefaultClient}
+	resourceID, location, err := imds.instance()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resourceID != "/subscriptions/s/resourceGroups/g/providers/Microsoft.Compute/virtualMachines/vm-1" || location != "westeurope" {
+		t.Errorf("unexpected resource ID %q and location %q", resourceID, location)
+	}
+}
+
+func TestManagedIdentity(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.Header.Get("Metadata") != "true" || r.URL.Path != "/metadata/identity/oauth2/token" ||
+			query.Get("resource") != monitoringResource || query.Get("client_id") != "user-assigned" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"access_token": "token", "expires_in": "3599", "token_type": "Bearer"}`))
+	}))
+	defer server.Close()
+
+	source := &managedIdentity{imds: &imdsClient{baseURL: server.URL, client: http.DefaultClient}, clientID: "user-assigned"}
+	token, err := source.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "token" || token.TokenType != "Bearer" {
+		t.Errorf("unexpected token %+v", token)
+	}
+	if expiry := time.Until(token.Expiry); expiry < 3500*time.Second || expiry > 3600*time.Second {
+		t.Errorf("expected the token to expire in an hour, got %v", expiry)
+	}
+
+	source.clientID = "other"
+	if _, err := source.Token(); err == nil {
+		t.Error("expected an error for an unknown identity")
+	}
+}
+
+func TestClientSecret(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/tenant/oauth2/token" || r.PostFormValue("grant_type") != "client_credentials" ||
+			r.PostFormValue("client_id") != "app" || r.PostFormValue("resource") != monitoringResource {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if r.PostFormValue("client_secret") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error": "invalid_client", "error_description": "AADSTS7000215: Invalid client secret provided."}`))
+			return
+		}
+		w.Write([]byte(`{"access_token": "token", "expires_in": 3599, "token_type": "Bearer"}`))
+	}))
+	defer server.Close()
+
+	source := newClientSecret("tenant", "app", "secret")
+	source.tokenURL = server.URL + "/tenant/oauth2/token"
+	token, err := source.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "token" || token.Expiry.IsZero() {
+		t.Errorf("unexpected token %+v", token)
+	}
+
+	source.secret = "wrong"
+	if _, err := source.Token(); err == nil || err.Error() != "failed to get a token of the service principal - invalid_client: AADSTS7000215: Invalid client secret provided." {
+		t.Errorf("expected the error of Azure Active Directory, got %v", err)
+	}
+}
@@ -0,0 +1,580 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azuremonitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+	"github.com/google/cadvisor/utils/container"
+
+	"github.com/golang/glog"
+	"golang.org/x/oauth2"
+)
+
+func init() {
+	storage.RegisterStorageDriver("azure_monitor", new)
+}
+
+var (
+	argResourceID    = flag.String("storage_driver_azure_monitor_resource_id", "", "Azure resource ID the metrics are sent to, defaults to the virtual machine of the instance metadata")
+	argRegion        = flag.String("storage_driver_azure_monitor_region", "", "Azure region of the resource, defaults to the region of the instance metadata")
+	argEndpoint      = flag.String("storage_driver_azure_monitor_endpoint", "", "custom metrics ingestion endpoint, defaults to https://<region>.monitoring.azure.com")
+	argNamespace     = flag.String("storage_driver_azure_monitor_namespace", "cAdvisor", "namespace of the custom metrics")
+	argMetrics       = flag.String("storage_driver_azure_monitor_metrics", "cpu_usage,memory_usage,memory_working_set,network_rx_bytes,network_tx_bytes", "comma-separated stats sent to Azure Monitor, of "+strings.Join(metricNames(), ", "))
+	argClientID      = flag.String("storage_driver_azure_monitor_client_id", "", "client ID of the user-assigned managed identity, or of the service principal of the client secret")
+	argTenantID      = flag.String("storage_driver_azure_monitor_tenant_id", "", "Azure Active Directory tenant of the service principal of the client secret")
+	argClientSecret  = flag.String("storage_driver_azure_monitor_client_secret", "", "client secret of the service principal, the managed identity of the virtual machine being used if empty")
+	argFlushInterval = flag.Duration("storage_driver_azure_monitor_flush_interval", time.Minute, "interval the samples of the metrics are aggregated for, and sent")
+	argMaxPending    = flag.Int("storage_driver_azure_monitor_max_pending", 10000, "maximum number of series aggregated before they are sent, the samples of further series being dropped")
+)
+
+const (
+	// Documented limit of the size of the custom metrics requests.
+	maxPayloadBytes = 1 << 20
+	// Backoff of the requests throttled without a Retry-After, or failed.
+	minBackoff = 5 * time.Second
+	maxBackoff = 5 * time.Minute
+)
+
+type metricKind int
+
+const (
+	// The value of the stat.
+	gauge metricKind = iota
+	// The increase of a cumulative counter since the previous stats.
+	delta
+	// The CPU time used since the previous stats, as a percentage of a core.
+	utilization
+)
+
+type metric struct {
+	name  string
+	kind  metricKind
+	value func(stats *info.ContainerStats) uint64
+}
+
+// Stats which can be sent, by name in argMetrics.
+var metrics = map[string]*metric{
+	"cpu_usage":          {"CPUUtilization", utilization, func(s *info.ContainerStats) uint64 { return s.Cpu.Usage.Total }},
+	"cpu_user":           {"CPUUtilizationUser", utilization, func(s *info.ContainerStats) uint64 { return s.Cpu.Usage.User }},
+	"cpu_system":         {"CPUUtilizationSystem", utilization, func(s *info.ContainerStats) uint64 { return s.Cpu.Usage.System }},
+	"memory_usage":       {"MemoryUsageBytes", gauge, func(s *info.ContainerStats) uint64 { return s.Memory.Usage }},
+	"memory_working_set": {"MemoryWorkingSetBytes", gauge, func(s *info.ContainerStats) uint64 { return s.Memory.WorkingSet }},
+	"memory_rss":         {"MemoryRSSBytes", gauge, func(s *info.ContainerStats) uint64 { return s.Memory.RSS }},
+	"memory_cache":       {"MemoryCacheBytes", gauge, func(s *info.ContainerStats) uint64 { return s.Memory.Cache }},
+	"network_rx_bytes":   {"NetworkRxBytes", delta, func(s *info.ContainerStats) uint64 { return s.Network.RxBytes }},
+	"network_tx_bytes":   {"NetworkTxBytes", delta, func(s *info.ContainerStats) uint64 { return s.Network.TxBytes }},
+	"network_rx_errors":  {"NetworkRxErrors", delta, func(s *info.ContainerStats) uint64 { return s.Network.RxErrors }},
+	"network_tx_errors":  {"NetworkTxErrors", delta, func(s *info.ContainerStats) uint64 { return s.Network.TxErrors }},
+	"fs_usage": {"FilesystemUsageBytes", gauge, func(s *info.ContainerStats) uint64 {
+		var usage uint64
+		for _, fs := range s.Filesystem {
+			usage += fs.Usage
+		}
+		return usage
+	}},
+	"diskio_read_bytes":  {"DiskReadBytes", delta, func(s *info.ContainerStats) uint64 { return sumDiskIo(s.DiskIo.IoServiceBytes, "Read") }},
+	"diskio_write_bytes": {"DiskWriteBytes", delta, func(s *info.ContainerStats) uint64 { return sumDiskIo(s.DiskIo.IoServiceBytes, "Write") }},
+}
+
+func sumDiskIo(stats []info.PerDiskStats, op string) uint64 {
+	var sum uint64
+	for _, disk := range stats {
+		sum += disk.Stats[op]
+	}
+	return sum
+}
+
+func metricNames() []string {
+	var names []string
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Dimensions of the series of every metric.
+var dimensionNames = []string{"ContainerName", "Image"}
+
+// series are the samples of a metric of a container, aggregated until they
+// are sent.
+type series struct {
+	key       string
+	metric    *metric
+	dimValues []string
+	count     int64
+	sum       float64
+	min       float64
+	max       float64
+}
+
+func (self *series) add(value float64) {
+	if self.count == 0 || value < self.min {
+		self.min = value
+	}
+	if self.count == 0 || value > self.max {
+		self.max = value
+	}
+	self.count++
+	self.sum += value
+}
+
+// merge adds the samples of other, of the same metric and dimensions.
+func (self *series) merge(other *series) {
+	if self.count == 0 || other.min < self.min {
+		self.min = other.min
+	}
+	if self.count == 0 || other.max > self.max {
+		self.max = other.max
+	}
+	self.count += other.count
+	self.sum += other.sum
+}
+
+// Body of the custom metrics requests, of a single metric.
+type payload struct {
+	Time string `json:"time"`
+	Data struct {
+		BaseData baseData `json:"baseData"`
+	} `json:"data"`
+}
+
+type baseData struct {
+	Metric    string       `json:"metric"`
+	Namespace string       `json:"namespace"`
+	DimNames  []string     `json:"dimNames"`
+	Series    []seriesData `json:"series"`
+}
+
+type seriesData struct {
+	DimValues []string `json:"dimValues"`
+	Min       float64  `json:"min"`
+	Max       float64  `json:"max"`
+	Sum       float64  `json:"sum"`
+	Count     int64    `json:"count"`
+}
+
+// requestError is the failure of a request, retried if it was throttled or
+// the service failed.
+type requestError struct {
+	statusCode int
+	retryAfter time.Duration
+	message    string
+}
+
+func (self *requestError) Error() string {
+	return fmt.Sprintf("Azure Monitor returned %d: %s", self.statusCode, self.message)
+}
+
+func (self *requestError) retryable() bool {
+	return self.statusCode == http.StatusTooManyRequests || self.statusCode >= 500
+}
+
+type azureMonitorStorage struct {
+	client    *http.Client
+	url       string
+	namespace string
+	metrics   []*metric
+	// The counters are sent as their increase since the previous stats,
+	// which Azure Monitor sums per minute.
+	counters *storage.CounterTracker
+	images   imageCache
+	// Maximum size of the bodies of the requests.
+	maxPayload int
+
+	lock sync.Mutex
+	// Series aggregated since they were last sent, by metric and dimensions.
+	pending    map[string]*series
+	maxPending int
+	dropped    uint64
+
+	// Used by the sending goroutine only. Requests are not sent before
+	// retryAt after a throttled or failed request.
+	retryAt time.Time
+	backoff time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func new() (storage.StorageDriver, error) {
+	imds := newIMDSClient()
+	resourceID, region := *argResourceID, *argRegion
+	if resourceID == "" || (region == "" && *argEndpoint == "") {
+		instanceResourceID, location, err := imds.instance()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the resource ID and the region of the virtual machine, set -storage_driver_azure_monitor_resource_id and -storage_driver_azure_monitor_region - %v", err)
+		}
+		if resourceID == "" {
+			resourceID = instanceResourceID
+		}
+		if region == "" {
+			region = location
+		}
+	}
+	endpoint := *argEndpoint
+	if endpoint == "" {
+		endpoint = "https://" + region + ".monitoring.azure.com"
+	}
+
+	var source oauth2.TokenSource
+	if *argClientSecret != "" {
+		if *argTenantID == "" || *argClientID == "" {
+			return nil, fmt.Errorf("the tenant ID and the client ID of the Azure Monitor client secret are required")
+		}
+		source = newClientSecret(*argTenantID, *argClientID, *argClientSecret)
+	} else {
+		source = &managedIdentity{imds: imds, clientID: *argClientID}
+	}
+	client := &http.Client{
+		Transport: &oauth2.Transport{Source: oauth2.ReuseTokenSource(nil, source)},
+		Timeout:   30 * time.Second,
+	}
+	return newStorage(config{
+		client:        client,
+		endpoint:      endpoint,
+		resourceID:    resourceID,
+		namespace:     *argNamespace,
+		names:         strings.Split(*argMetrics, ","),
+		flushInterval: *argFlushInterval,
+		maxPending:    *argMaxPending,
+	})
+}
+
+func (self *azureMonitorStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	if stats == nil {
+		return nil
+	}
+	counters := make(map[string]uint64)
+	for _, m := range self.metrics {
+		if m.kind != gauge {
+			counters[m.name] = m.value(stats)
+		}
+	}
+	deltas, elapsed := self.counters.Deltas(ref.Name, stats.Timestamp, counters)
+	image := self.images.image(ref.Name, time.Now())
+	if image == "" {
+		image = "unknown"
+	}
+	dimValues := []string{container.GetPreferredName(ref), image}
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, m := range self.metrics {
+		var value float64
+		switch m.kind {
+		case gauge:
+			value = float64(m.value(stats))
+		case delta, utilization:
+			d, ok := deltas[m.name]
+			if !ok {
+				continue
+			}
+			value = float64(d)
+			if m.kind == utilization {
+				value = value * 100 / float64(elapsed)
+			}
+		}
+		key := m.name + "\x00" + strings.Join(dimValues, "\x00")
+		s, ok := self.pending[key]
+		if !ok {
+			if len(self.pending) >= self.maxPending {
+				self.dropped++
+				continue
+			}
+			s = &series{key: key, metric: m, dimValues: dimValues}
+			self.pending[key] = s
+		}
+		s.add(value)
+	}
+	return nil
+}
+
+// requeue aggregates again series which could not be sent, with the series
+// aggregated since.
+func (self *azureMonitorStorage) requeue(failed []*series) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, s := range failed {
+		if pending, ok := self.pending[s.key]; ok {
+			pending.merge(s)
+		} else if len(self.pending) < self.maxPending {
+			self.pending[s.key] = s
+		} else {
+			self.dropped++
+		}
+	}
+}
+
+// run sends the aggregated series every flush interval, unless the previous
+// requests were throttled, until stopped.
+func (self *azureMonitorStorage) run(flushInterval time.Duration) {
+	defer close(self.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if time.Now().Before(self.retryAt) {
+				continue
+			}
+			if err := self.send(); err != nil {
+				glog.Errorf("Azure Monitor: %v", err)
+			}
+		case <-self.stop:
+			if err := self.send(); err != nil {
+				glog.Errorf("Azure Monitor: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// send sends the aggregated series, a request per metric and at most
+// maxPayload bytes. If a request is throttled or fails on the side of the
+// service, it and the following ones are aggregated again to be retried
+// after a backoff. The series of the requests failing otherwise are dropped.
+func (self *azureMonitorStorage) send() error {
+	now := time.Now()
+	self.images.expire(now)
+	self.lock.Lock()
+	pending := self.pending
+	dropped := self.dropped
+	self.pending = make(map[string]*series)
+	self.dropped = 0
+	self.lock.Unlock()
+	if dropped > 0 {
+		glog.Warningf("Azure Monitor: dropped %d samples of series beyond the maximum of %d", dropped, self.maxPending)
+	}
+
+	keys := make([]string, 0, len(pending))
+	for key := range pending {
+		keys = append(keys, key)
+	}
+	// Sorted by metric, then dimensions.
+	sort.Strings(keys)
+	batches := self.batches(keys, pending, now)
+	var errs []string
+	for i, batch := range batches {
+		err := self.post(batch.body)
+		if err == nil {
+			self.backoff = 0
+			continue
+		}
+		if e, ok := err.(*requestError); ok && !e.retryable() {
+			errs = append(errs, fmt.Sprintf("dropped %d series of %s - %v", len(batch.series), batch.series[0].metric.name, err))
+			continue
+		}
+		var failed []*series
+		for _, b := range batches[i:] {
+			failed = append(failed, b.series...)
+		}
+		self.requeue(failed)
+		self.setBackoff(err, now)
+		errs = append(errs, fmt.Sprintf("failed to send %d series, retrying after %v - %v", len(failed), self.retryAt.Sub(now), err))
+		break
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// setBackoff delays the next requests by the Retry-After of a throttled
+// request, or an exponential backoff.
+func (self *azureMonitorStorage) setBackoff(err error, now time.Time) {
+	if e, ok := err.(*requestError); ok && e.retryAfter > 0 {
+		self.retryAt = now.Add(e.retryAfter)
+		return
+	}
+	if self.backoff == 0 {
+		self.backoff = minBackoff
+	} else if self.backoff *= 2; self.backoff > maxBackoff {
+		self.backoff = maxBackoff
+	}
+	self.retryAt = now.Add(self.backoff)
+}
+
+type batch struct {
+	series []*series
+	body   []byte
+}
+
+// batches returns the requests sending the series of keys, sorted by metric.
+func (self *azureMonitorStorage) batches(keys []string, pending map[string]*series, now time.Time) []batch {
+	var ret []batch
+	var current []*series
+	var size int
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		body, err := self.body(current, now)
+		if err != nil {
+			glog.Errorf("Azure Monitor: dropped %d series of %s - %v", len(current), current[0].metric.name, err)
+		} else {
+			ret = append(ret, batch{current, body})
+		}
+		current, size = nil, 0
+	}
+	for _, key := range keys {
+		s := pending[key]
+		if len(current) > 0 && current[0].metric != s.metric {
+			flush()
+		}
+		// The series of a request share the rest of the body.
+		b, err := json.Marshal(seriesData{DimValues: s.dimValues, Min: s.min, Max: s.max, Sum: s.sum, Count: s.count})
+		if err != nil {
+			glog.Errorf("Azure Monitor: dropped series of %s - %v", s.metric.name, err)
+			continue
+		}
+		if len(current) > 0 && size+len(b)+1 > self.maxPayload-len(self.namespace)-len(s.metric.name)-256 {
+			flush()
+		}
+		current = append(current, s)
+		size += len(b) + 1
+	}
+	flush()
+	return ret
+}
+
+func (self *azureMonitorStorage) body(series []*series, now time.Time) ([]byte, error) {
+	var p payload
+	p.Time = now.UTC().Format(time.RFC3339)
+	p.Data.BaseData = baseData{
+		Metric:    series[0].metric.name,
+		Namespace: self.namespace,
+		DimNames:  dimensionNames,
+	}
+	for _, s := range series {
+		p.Data.BaseData.Series = append(p.Data.BaseData.Series, seriesData{DimValues: s.dimValues, Min: s.min, Max: s.max, Sum: s.sum, Count: s.count})
+	}
+	return json.Marshal(p)
+}
+
+func (self *azureMonitorStorage) post(body []byte) error {
+	req, err := http.NewRequest("POST", self.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := self.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	ret := &requestError{statusCode: resp.StatusCode, message: strings.TrimSpace(string(b))}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		ret.retryAfter = time.Duration(seconds) * time.Second
+	}
+	var res struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(b, &res) == nil && res.Error.Message != "" {
+		ret.message = res.Error.Code + ": " + res.Error.Message
+	}
+	return ret
+}
+
+// Close sends the aggregated series.
+func (self *azureMonitorStorage) Close() error {
+	close(self.stop)
+	<-self.done
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if n := len(self.pending); n > 0 {
+		return fmt.Errorf("Azure Monitor: %d series were not sent", n)
+	}
+	return nil
+}
+
+// config is the configuration of the driver, populated from the flags.
+type config struct {
+	// The HTTP client authenticating the requests.
+	client *http.Client
+	// The custom metrics ingestion endpoint of the region.
+	endpoint string
+	// The ID of the Azure resource the metrics are sent to.
+	resourceID string
+	// The namespace of the custom metrics.
+	namespace string
+	// The names of the stats sent.
+	names []string
+	// The interval the samples are aggregated for.
+	flushInterval time.Duration
+	// The maximum number of series aggregated between requests.
+	maxPending int
+}
+
+// Create a new Azure Monitor storage driver.
+func newStorage(cfg config) (*azureMonitorStorage, error) {
+	if !strings.HasPrefix(cfg.resourceID, "/subscriptions/") {
+		return nil, fmt.Errorf("invalid Azure resource ID %q", cfg.resourceID)
+	}
+	if cfg.namespace == "" {
+		return nil, fmt.Errorf("the Azure Monitor namespace is required")
+	}
+	if cfg.flushInterval <= 0 || cfg.maxPending <= 0 {
+		return nil, fmt.Errorf("the Azure Monitor flush interval and maximum pending series must be positive")
+	}
+	ret := &azureMonitorStorage{
+		client:     cfg.client,
+		url:        strings.TrimSuffix(cfg.endpoint, "/") + cfg.resourceID + "/metrics",
+		namespace:  cfg.namespace,
+		counters:   storage.NewCounterTracker(),
+		maxPayload: maxPayloadBytes,
+		pending:    make(map[string]*series),
+		maxPending: cfg.maxPending,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	seen := make(map[string]bool)
+	for _, name := range cfg.names {
+		m, ok := metrics[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown Azure Monitor metric %q, expected one of %s", name, strings.Join(metricNames(), ", "))
+		}
+		if !seen[name] {
+			seen[name] = true
+			ret.metrics = append(ret.metrics, m)
+		}
+	}
+	if len(ret.metrics) == 0 {
+		return nil, fmt.Errorf("no Azure Monitor metrics to send")
+	}
+	go ret.run(cfg.flushInterval)
+	return ret, nil
+}
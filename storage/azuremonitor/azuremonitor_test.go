@@ -0,0 +1,282 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azuremonitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/info/v2"
+)
+
+const testResourceID = "/subscriptions/s/resourceGroups/g/providers/Microsoft.Compute/virtualMachines/vm-1"
+
+// fakeIngestion records the bodies of the custom metrics requests, and
+// answers with the statuses queued, then 200.
+type fakeIngestion struct {
+	*httptest.Server
+	lock     sync.Mutex
+	bodies   []payload
+	sizes    []int
+	statuses []int
+}
+
+func newFakeIngestion() *fakeIngestion {
+	s := &fakeIngestion{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != testResourceID+"/metrics" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		var p payload
+		if err := json.Unmarshal(b, &p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		s.bodies = append(s.bodies, p)
+		s.sizes = append(s.sizes, len(b))
+		if len(s.statuses) > 0 {
+			status := s.statuses[0]
+			s.statuses = s.statuses[1:]
+			if status == http.StatusTooManyRequests {
+				w.Header().Set("Retry-After", "120")
+			}
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `{"error": {"code": "Error%d", "message": "failed"}}`, status)
+		}
+	}))
+	return s
+}
+
+func (self *fakeIngestion) received() []payload {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return append([]payload(nil), self.bodies...)
+}
+
+// testConfig returns the configuration of a driver sending the given stats
+// to endpoint.
+func testConfig(endpoint string, names ...string) config {
+	return config{
+		client:        http.DefaultClient,
+		endpoint:      endpoint,
+		resourceID:    testResourceID,
+		namespace:     "cAdvisor",
+		names:         names,
+		flushInterval: time.Hour,
+		maxPending:    100,
+	}
+}
+
+func (self *fakeIngestion) storage(t *testing.T, names ...string) *azureMonitorStorage {
+	driver, err := newStorage(testConfig(self.URL+"/", names...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return driver
+}
+
+type fakeSpecSource map[string]v2.ContainerSpec
+
+func (self fakeSpecSource) GetContainerSpec(containerName string, options v2.RequestOptions) (map[string]v2.ContainerSpec, error) {
+	spec, ok := self[containerName]
+	if !ok {
+		return nil, fmt.Errorf("unknown container %q", containerName)
+	}
+	return map[string]v2.ContainerSpec{containerName: spec}, nil
+}
+
+var testRef = info.ContainerReference{Name: "/docker/abc", Aliases: []string{"web.1", "abc"}}
+
+func addStats(t *testing.T, driver *azureMonitorStorage, ref info.ContainerReference, seconds int, cpu, memory, rx uint64) {
+	stats := &info.ContainerStats{Timestamp: time.Unix(1451606400+int64(seconds), 0)}
+	stats.Cpu.Usage.Total = cpu
+	stats.Memory.Usage = memory
+	stats.Network.RxBytes = rx
+	if err := driver.AddStats(ref, stats); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddStats(t *testing.T) {
+	server := newFakeIngestion()
+	defer server.Close()
+	driver := server.storage(t, "cpu_usage", "memory_usage", "network_rx_bytes")
+	driver.SetContainerSpecSource(fakeSpecSource{"/docker/abc": {Image: "nginx:1.11"}})
+
+	// A core used half of the first second, and all of the next one.
+	addStats(t, driver, testRef, 0, 0, 1024, 1000)
+	addStats(t, driver, testRef, 1, 5e8, 2048, 1500)
+	addStats(t, driver, testRef, 2, 15e8, 3072, 2500)
+	// Without an image.
+	addStats(t, driver, info.ContainerReference{Name: "/other"}, 0, 0, 512, 0)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bodies := server.received()
+	if len(bodies) != 3 {
+		t.Fatalf("expected a request per metric, got %d", len(bodies))
+	}
+	expected := map[string][]seriesData{
+		"CPUUtilization":   {{DimValues: []string{"web.1", "nginx:1.11"}, Min: 50, Max: 100, Sum: 150, Count: 2}},
+		"MemoryUsageBytes": {{DimValues: []string{"/other", "unknown"}, Min: 512, Max: 512, Sum: 512, Count: 1}, {DimValues: []string{"web.1", "nginx:1.11"}, Min: 1024, Max: 3072, Sum: 6144, Count: 3}},
+		"NetworkRxBytes":   {{DimValues: []string{"web.1", "nginx:1.11"}, Min: 500, Max: 1000, Sum: 1500, Count: 2}},
+	}
+	for _, body := range bodies {
+		data := body.Data.BaseData
+		if data.Namespace != "cAdvisor" || !reflect.DeepEqual(data.DimNames, []string{"ContainerName", "Image"}) {
+			t.Errorf("unexpected request %+v", body)
+		}
+		if _, err := time.Parse(time.RFC3339, body.Time); err != nil {
+			t.Errorf("invalid time %q - %v", body.Time, err)
+		}
+		if !reflect.DeepEqual(data.Series, expected[data.Metric]) {
+			t.Errorf("%s: expected the series %+v, got %+v", data.Metric, expected[data.Metric], data.Series)
+		}
+	}
+}
+
+func TestPayloadLimit(t *testing.T) {
+	server := newFakeIngestion()
+	defer server.Close()
+	driver := server.storage(t, "memory_usage")
+	driver.maxPayload = 1000
+
+	for i := 0; i < 50; i++ {
+		addStats(t, driver, info.ContainerReference{Name: fmt.Sprintf("/container-%02d", i)}, 0, 0, 1024, 0)
+	}
+	driver.Close()
+	n := 0
+	for _, body := range server.received() {
+		n += len(body.Data.BaseData.Series)
+	}
+	if n != 50 || len(server.sizes) < 2 {
+		t.Errorf("expected 50 series in several requests, got %d in %d", n, len(server.sizes))
+	}
+	for _, size := range server.sizes {
+		if size > 1000 {
+			t.Errorf("expected requests of at most 1000 bytes, got %d", size)
+		}
+	}
+}
+
+func TestThrottled(t *testing.T) {
+	server := newFakeIngestion()
+	defer server.Close()
+	server.statuses = []int{http.StatusTooManyRequests}
+	driver := server.storage(t, "memory_usage")
+
+	addStats(t, driver, testRef, 0, 0, 1024, 0)
+	start := time.Now()
+	if err := driver.send(); err == nil {
+		t.Fatal("expected the request to be throttled")
+	}
+	if retryIn := driver.retryAt.Sub(start); retryIn < 119*time.Second || retryIn > 121*time.Second {
+		t.Errorf("expected to retry after the Retry-After of 120s, got %v", retryIn)
+	}
+	// The series is aggregated with the later samples.
+	addStats(t, driver, testRef, 1, 0, 3072, 0)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bodies := server.received()
+	if len(bodies) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(bodies))
+	}
+	expected := []seriesData{{DimValues: []string{"web.1", "unknown"}, Min: 1024, Max: 3072, Sum: 4096, Count: 2}}
+	if got := bodies[1].Data.BaseData.Series; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected the series %+v, got %+v", expected, got)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	server := newFakeIngestion()
+	defer server.Close()
+	server.statuses = []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusBadRequest}
+	driver := server.storage(t, "memory_usage")
+
+	addStats(t, driver, testRef, 0, 0, 1024, 0)
+	for _, expected := range []time.Duration{minBackoff, 2 * minBackoff} {
+		start := time.Now()
+		driver.send()
+		if retryIn := driver.retryAt.Sub(start); retryIn < expected || retryIn > expected+time.Second {
+			t.Errorf("expected a backoff of %v, got %v", expected, retryIn)
+		}
+	}
+	// Not retried.
+	if err := driver.send(); err == nil {
+		t.Error("expected the request to fail")
+	}
+	if err := driver.Close(); err != nil {
+		t.Error(err)
+	}
+	if n := len(server.received()); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestMaxPending(t *testing.T) {
+	server := newFakeIngestion()
+	defer server.Close()
+	cfg := testConfig(server.URL, "memory_usage")
+	cfg.maxPending = 1
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+
+	for _, name := range []string{"/a", "/b", "/a"} {
+		addStats(t, driver, info.ContainerReference{Name: name}, 0, 0, 1024, 0)
+	}
+	driver.lock.Lock()
+	defer driver.lock.Unlock()
+	if len(driver.pending) != 1 || driver.dropped != 1 {
+		t.Errorf("expected 1 series and 1 dropped sample, got %d and %d", len(driver.pending), driver.dropped)
+	}
+}
+
+func TestNewStorageErrors(t *testing.T) {
+	for _, test := range []struct {
+		resourceID, namespace string
+		metrics               []string
+	}{
+		{"", "cAdvisor", []string{"cpu_usage"}},
+		{"vm-1", "cAdvisor", []string{"cpu_usage"}},
+		{testResourceID, "", []string{"cpu_usage"}},
+		{testResourceID, "cAdvisor", []string{"cpu"}},
+		{testResourceID, "cAdvisor", nil},
+	} {
+		cfg := testConfig("https://westeurope.monitoring.azure.com", test.metrics...)
+		cfg.resourceID = test.resourceID
+		cfg.namespace = test.namespace
+		cfg.flushInterval = time.Minute
+		if _, err := newStorage(cfg); err == nil {
+			t.Errorf("expected an error for %+v", test)
+		}
+	}
+}
@@ -15,8 +15,15 @@
 package bigquery
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"flag"
+	"fmt"
 	"os"
+	"sync"
+	"time"
 
+	"github.com/golang/glog"
 	info "github.com/google/cadvisor/info/v1"
 	"github.com/google/cadvisor/storage"
 	"github.com/google/cadvisor/storage/bigquery/client"
@@ -28,9 +35,28 @@ func init() {
 	storage.RegisterStorageDriver("bigquery", new)
 }
 
+var (
+	argBatchSize           = flag.Int("bq_batch_size", 500, "maximum number of rows inserted into BigQuery in a single request; rows are buffered until there are as many, or until -storage_driver_buffer_duration has elapsed")
+	argPartitionExpiration = flag.Duration("bq_partition_expiration", 0, "time after which the daily partitions of the BigQuery table created by cAdvisor are deleted, e.g. 720h; 0 to keep them forever")
+)
+
+// Number of times the rows rejected by BigQuery with a transient error are
+// inserted, before they are dropped.
+const maxInsertAttempts = 3
+
 type bigqueryStorage struct {
-	client      *client.Client
-	machineName string
+	client         *client.Client
+	machineName    string
+	batchSize      int
+	bufferDuration time.Duration
+	lastWrite      time.Time
+	// Rows buffered since lastWrite.
+	buffer       []client.Row
+	lock         sync.Mutex
+	readyToFlush func() bool
+	// Backoff before the first retry of an insertion, doubled after every
+	// attempt.
+	retryBackoff time.Duration
 }
 
 const (
@@ -83,9 +109,16 @@ func new() (storage.StorageDriver, error) {
 		hostname,
 		*storage.ArgDbTable,
 		*storage.ArgDbName,
+		*argBatchSize,
+		*storage.ArgDbBufferDuration,
+		*argPartitionExpiration,
 	)
 }
 
+func (self *bigqueryStorage) defaultReadyToFlush() bool {
+	return time.Since(self.lastWrite) >= self.bufferDuration
+}
+
 // TODO(jnagal): Infer schema through reflection. (See bigquery/client/example)
 func (self *bigqueryStorage) GetSchema() *bigquery.TableSchema {
 	fields := make([]*bigquery.TableFieldSchema, 19)
@@ -205,11 +238,7 @@ func (self *bigqueryStorage) containerStatsToRows(
 	row[colMachineName] = self.machineName
 
 	// Container name
-	name := ref.Name
-	if len(ref.Aliases) > 0 {
-		name = ref.Aliases[0]
-	}
-	row[colContainerName] = name
+	row[colContainerName] = self.containerName(ref)
 
 	// Cumulative Cpu Usage
 	row[colCpuCumulativeUsage] = stats.Cpu.Usage.Total
@@ -255,6 +284,9 @@ func (self *bigqueryStorage) containerFilesystemStatsToRows(
 ) (rows []map[string]interface{}) {
 	for _, fsStat := range stats.Filesystem {
 		row := make(map[string]interface{}, 0)
+		row[colTimestamp] = stats.Timestamp
+		row[colMachineName] = self.machineName
+		row[colContainerName] = self.containerName(ref)
 		row[colFsDevice] = fsStat.Device
 		row[colFsLimit] = fsStat.Limit
 		row[colFsUsage] = fsStat.Usage
@@ -263,50 +295,161 @@ func (self *bigqueryStorage) containerFilesystemStatsToRows(
 	return rows
 }
 
+func (self *bigqueryStorage) containerName(ref info.ContainerReference) string {
+	if len(ref.Aliases) > 0 {
+		return ref.Aliases[0]
+	}
+	return ref.Name
+}
+
+// insertId returns the ID of the row of a container at a timestamp, and of
+// one of its filesystems if device is not empty. It is the same whenever
+// the row is inserted again, so that BigQuery drops the duplicates.
+func (self *bigqueryStorage) insertId(ref info.ContainerReference, timestamp time.Time, device string) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%d\x00%s", self.machineName, ref.Name, timestamp.UnixNano(), device)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 func (self *bigqueryStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
 	if stats == nil {
 		return nil
 	}
-	rows := make([]map[string]interface{}, 0)
-	rows = append(rows, self.containerStatsToRows(ref, stats))
-	rows = append(rows, self.containerFilesystemStatsToRows(ref, stats)...)
-	for _, row := range rows {
-		err := self.client.InsertRow(row)
-		if err != nil {
-			return err
+	rows := []client.Row{{
+		InsertId: self.insertId(ref, stats.Timestamp, ""),
+		Values:   self.containerStatsToRows(ref, stats),
+	}}
+	for _, values := range self.containerFilesystemStatsToRows(ref, stats) {
+		rows = append(rows, client.Row{
+			InsertId: self.insertId(ref, stats.Timestamp, values[colFsDevice].(string)),
+			Values:   values,
+		})
+	}
+	var rowsToFlush []client.Row
+	func() {
+		// AddStats will be invoked simultaneously from multiple threads and only one of them will perform a write.
+		self.lock.Lock()
+		defer self.lock.Unlock()
+		self.buffer = append(self.buffer, rows...)
+		if len(self.buffer) >= self.batchSize || self.readyToFlush() {
+			rowsToFlush = self.buffer
+			self.buffer = nil
+			self.lastWrite = time.Now()
+		}
+	}()
+	return self.flush(rowsToFlush)
+}
+
+// flush inserts rows in requests of at most batchSize rows.
+func (self *bigqueryStorage) flush(rows []client.Row) error {
+	var lastErr error
+	dropped := 0
+	for start := 0; start < len(rows); start += self.batchSize {
+		end := start + self.batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		if n, err := self.insert(rows[start:end]); n > 0 {
+			dropped += n
+			lastErr = err
 		}
 	}
+	if dropped > 0 {
+		return fmt.Errorf("failed to insert %d of %d rows into BigQuery, dropped them - %s", dropped, len(rows), lastErr)
+	}
 	return nil
 }
 
+// insert inserts rows in a single request, then inserts again the rows
+// rejected with a transient error, at most maxInsertAttempts times. It
+// returns the number of rows dropped and the last error.
+func (self *bigqueryStorage) insert(rows []client.Row) (int, error) {
+	var lastErr error
+	dropped := 0
+	pending := rows
+	backoff := self.retryBackoff
+	for attempt := 0; attempt < maxInsertAttempts && len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		rowErrors, err := self.client.InsertRows(pending)
+		if err != nil {
+			// The whole request failed.
+			lastErr = err
+			continue
+		}
+		var retry []client.Row
+		for _, rowError := range rowErrors {
+			if rowError.Index < 0 || rowError.Index >= len(pending) {
+				continue
+			}
+			lastErr = rowError
+			if rowError.Retryable {
+				retry = append(retry, pending[rowError.Index])
+			} else {
+				dropped++
+			}
+		}
+		pending = retry
+	}
+	return dropped + len(pending), lastErr
+}
+
 func (self *bigqueryStorage) Close() error {
+	self.lock.Lock()
+	rowsToFlush := self.buffer
+	self.buffer = nil
+	self.lock.Unlock()
+	err := self.flush(rowsToFlush)
 	self.client.Close()
 	self.client = nil
-	return nil
+	return err
 }
 
 // Create a new bigquery storage driver.
 // machineName: A unique identifier to identify the host that current cAdvisor
 // instance is running on.
 // tableName: BigQuery table used for storing stats.
-func newStorage(machineName, datasetId, tableName string) (storage.StorageDriver, error) {
+// batchSize: The maximum number of rows inserted in a single request.
+// bufferDuration: The maximum time rows are buffered before being inserted.
+// partitionExpiration: The time after which the partitions of a new table expire, 0 for never.
+func newStorage(machineName, datasetId, tableName string, batchSize int, bufferDuration, partitionExpiration time.Duration) (storage.StorageDriver, error) {
 	bqClient, err := client.NewClient()
 	if err != nil {
 		return nil, err
 	}
-	err = bqClient.CreateDataset(datasetId)
+	return newStorageWithClient(bqClient, machineName, datasetId, tableName, batchSize, bufferDuration, partitionExpiration)
+}
+
+func newStorageWithClient(bqClient *client.Client, machineName, datasetId, tableName string, batchSize int, bufferDuration, partitionExpiration time.Duration) (*bigqueryStorage, error) {
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("invalid BigQuery batch size %d", batchSize)
+	}
+	if partitionExpiration < 0 {
+		return nil, fmt.Errorf("invalid BigQuery partition expiration %s", partitionExpiration)
+	}
+	err := bqClient.CreateDataset(datasetId)
 	if err != nil {
 		return nil, err
 	}
 
 	ret := &bigqueryStorage{
-		client:      bqClient,
-		machineName: machineName,
+		client:         bqClient,
+		machineName:    machineName,
+		batchSize:      batchSize,
+		bufferDuration: bufferDuration,
+		lastWrite:      time.Now(),
+		retryBackoff:   time.Second,
 	}
-	schema := ret.GetSchema()
-	err = bqClient.CreateTable(tableName, schema)
+	ret.readyToFlush = ret.defaultReadyToFlush
+	spec := ret.tableSpec(partitionExpiration)
+	table, err := bqClient.EnsureTable(tableName, spec)
 	if err != nil {
 		return nil, err
 	}
+	for _, suggestion := range tableSuggestions(tableName, table, spec) {
+		glog.Warning(suggestion)
+	}
 	return ret, nil
 }
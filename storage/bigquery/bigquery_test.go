@@ -0,0 +1,284 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bigquery
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage/bigquery/client"
+
+	bigquery "google.golang.org/api/bigquery/v2"
+)
+
+// fakeBigQuery is a BigQuery HTTP endpoint recording the insertions.
+type fakeBigQuery struct {
+	server *httptest.Server
+	lock   sync.Mutex
+	// The rows of every insertion.
+	inserts [][]*bigquery.TableDataInsertAllRequestRows
+	// respond returns the status and the response of an insertion, 200 and
+	// no errors if nil.
+	respond func(rows []*bigquery.TableDataInsertAllRequestRows) (int, *bigquery.TableDataInsertAllResponse)
+	// The tables, by ID.
+	tables map[string]*bigquery.Table
+	// The tables created.
+	created []*bigquery.Table
+	// Whether the tables are created by someone else right before they
+	// are created.
+	conflictOnCreate bool
+}
+
+func newFakeBigQuery() *fakeBigQuery {
+	fake := &fakeBigQuery{
+		tables: map[string]*bigquery.Table{"table": {}},
+	}
+	fake.server = httptest.NewServer(http.HandlerFunc(fake.handle))
+	return fake
+}
+
+func writeAPIError(w http.ResponseWriter, code int, message string) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{"code": code, "message": message},
+	})
+}
+
+func (self *fakeBigQuery) handle(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/insertAll"):
+		self.handleInsertAll(w, r)
+	case strings.HasSuffix(r.URL.Path, "/tables") && r.Method == "POST":
+		var table bigquery.Table
+		if err := json.NewDecoder(r.Body).Decode(&table); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		id := table.TableReference.TableId
+		if self.conflictOnCreate {
+			self.tables[id] = &table
+		}
+		if _, ok := self.tables[id]; ok {
+			writeAPIError(w, http.StatusConflict, "Already Exists: Table "+id)
+			return
+		}
+		self.tables[id] = &table
+		self.created = append(self.created, &table)
+		json.NewEncoder(w).Encode(&table)
+	case strings.Contains(r.URL.Path, "/tables/") && r.Method == "GET":
+		id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+		table, ok := self.tables[id]
+		if !ok {
+			writeAPIError(w, http.StatusNotFound, "Not found: Table "+id)
+			return
+		}
+		json.NewEncoder(w).Encode(table)
+	default:
+		// Datasets exist.
+		w.Write([]byte("{}"))
+	}
+}
+
+func (self *fakeBigQuery) handleInsertAll(w http.ResponseWriter, r *http.Request) {
+	var req bigquery.TableDataInsertAllRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	self.inserts = append(self.inserts, req.Rows)
+	respond := self.respond
+	status, resp := http.StatusOK, &bigquery.TableDataInsertAllResponse{}
+	if respond != nil {
+		status, resp = respond(req.Rows)
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// insertIds returns the insertIds of every insertion.
+func (self *fakeBigQuery) insertIds() [][]string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var ret [][]string
+	for _, rows := range self.inserts {
+		var ids []string
+		for _, row := range rows {
+			ids = append(ids, row.InsertId)
+		}
+		ret = append(ret, ids)
+	}
+	return ret
+}
+
+func newTestClient(t *testing.T, fake *fakeBigQuery) *client.Client {
+	service, err := bigquery.New(http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.BasePath = fake.server.URL + "/"
+	return client.NewClientWithService(service, "project")
+}
+
+func newTestStorage(t *testing.T, fake *fakeBigQuery, batchSize int) *bigqueryStorage {
+	driver, err := newStorageWithClient(newTestClient(t, fake), "host", "dataset", "table", batchSize, time.Hour, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.readyToFlush = func() bool { return false }
+	driver.retryBackoff = time.Millisecond
+	return driver
+}
+
+func testStats(timestamp time.Time) *info.ContainerStats {
+	stats := &info.ContainerStats{Timestamp: timestamp}
+	stats.Cpu.Usage.Total = 42
+	stats.Filesystem = []info.FsStats{{Device: "sda1", Limit: 1000, Usage: 500}}
+	return stats
+}
+
+var testRef = info.ContainerReference{Name: "/docker/abc", Aliases: []string{"web"}}
+
+func TestBatching(t *testing.T) {
+	fake := newFakeBigQuery()
+	defer fake.server.Close()
+	driver := newTestStorage(t, fake, 3)
+
+	start := time.Unix(1464000000, 0)
+	// Every stats are two rows, of the container and of its filesystem.
+	for i := 0; i < 2; i++ {
+		if err := driver.AddStats(testRef, testStats(start.Add(time.Duration(i)*time.Second))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := driver.AddStats(testRef, testStats(start.Add(2*time.Second))); err != nil {
+		t.Fatal(err)
+	}
+	// The remaining rows are inserted on close.
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int
+	for _, ids := range fake.insertIds() {
+		sizes = append(sizes, len(ids))
+	}
+	if expected := []int{3, 1, 2}; !reflect.DeepEqual(sizes, expected) {
+		t.Errorf("expected insertions of %v rows, got %v", expected, sizes)
+	}
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	fsRow := fake.inserts[0][1].Json
+	if fsRow[colFsDevice] != "sda1" || fsRow[colContainerName] != "web" || fsRow[colMachineName] != "host" || fsRow[colTimestamp] == nil {
+		t.Errorf("expected the filesystem row to have the columns of the container, got %v", fsRow)
+	}
+}
+
+func TestInsertIdStability(t *testing.T) {
+	fake := newFakeBigQuery()
+	defer fake.server.Close()
+	driver := newTestStorage(t, fake, 2)
+
+	timestamp := time.Unix(1464000000, 0)
+	driver.AddStats(testRef, testStats(timestamp))
+	// The same stats, e.g. after a restart of cAdvisor, have the same IDs.
+	driver.AddStats(testRef, testStats(timestamp))
+	driver.AddStats(testRef, testStats(timestamp.Add(time.Second)))
+	other := info.ContainerReference{Name: "/docker/def", Aliases: []string{"web"}}
+	driver.AddStats(other, testStats(timestamp))
+
+	ids := fake.insertIds()
+	if len(ids) != 4 || len(ids[0]) != 2 {
+		t.Fatalf("expected 4 insertions of 2 rows, got %v", ids)
+	}
+	if !reflect.DeepEqual(ids[0], ids[1]) {
+		t.Errorf("expected the same IDs for the same stats, got %v and %v", ids[0], ids[1])
+	}
+	seen := make(map[string]bool)
+	for _, i := range []int{0, 2, 3} {
+		for _, id := range ids[i] {
+			if id == "" || seen[id] {
+				t.Errorf("expected unique IDs for different rows, got %v", ids)
+			}
+			seen[id] = true
+		}
+	}
+}
+
+func TestRetryRejectedRows(t *testing.T) {
+	fake := newFakeBigQuery()
+	defer fake.server.Close()
+	driver := newTestStorage(t, fake, 4)
+
+	first := true
+	fake.respond = func(rows []*bigquery.TableDataInsertAllRequestRows) (int, *bigquery.TableDataInsertAllResponse) {
+		if !first {
+			return http.StatusOK, &bigquery.TableDataInsertAllResponse{}
+		}
+		first = false
+		// The row 1 is invalid, the others were stopped because of it.
+		return http.StatusOK, &bigquery.TableDataInsertAllResponse{
+			InsertErrors: []*bigquery.TableDataInsertAllResponseInsertErrors{
+				{Index: 0, Errors: []*bigquery.ErrorProto{{Reason: "stopped"}}},
+				{Index: 1, Errors: []*bigquery.ErrorProto{{Reason: "invalid", Message: "no such field"}}},
+				{Index: 2, Errors: []*bigquery.ErrorProto{{Reason: "stopped"}}},
+				{Index: 3, Errors: []*bigquery.ErrorProto{{Reason: "stopped"}}},
+			},
+		}
+	}
+	start := time.Unix(1464000000, 0)
+	driver.AddStats(testRef, testStats(start))
+	err := driver.AddStats(testRef, testStats(start.Add(time.Second)))
+	if err == nil || !strings.Contains(err.Error(), "1 of 4 rows") {
+		t.Errorf("expected the invalid row to be dropped, got %v", err)
+	}
+	ids := fake.insertIds()
+	if len(ids) != 2 {
+		t.Fatalf("expected 2 insertions, got %v", ids)
+	}
+	if expected := []string{ids[0][0], ids[0][2], ids[0][3]}; !reflect.DeepEqual(ids[1], expected) {
+		t.Errorf("expected only the stopped rows %v to be retried, got %v", expected, ids[1])
+	}
+}
+
+func TestRetryFailedRequest(t *testing.T) {
+	fake := newFakeBigQuery()
+	defer fake.server.Close()
+	driver := newTestStorage(t, fake, 2)
+
+	fake.respond = func(rows []*bigquery.TableDataInsertAllRequestRows) (int, *bigquery.TableDataInsertAllResponse) {
+		return http.StatusServiceUnavailable, &bigquery.TableDataInsertAllResponse{}
+	}
+	if err := driver.AddStats(testRef, testStats(time.Unix(1464000000, 0))); err == nil {
+		t.Errorf("expected the rows to be dropped")
+	}
+	ids := fake.insertIds()
+	if len(ids) != maxInsertAttempts {
+		t.Fatalf("expected %d attempts, got %v", maxInsertAttempts, ids)
+	}
+	for _, attempt := range ids[1:] {
+		if !reflect.DeepEqual(attempt, ids[0]) {
+			t.Errorf("expected the same rows to be retried, got %v", ids)
+		}
+	}
+}
@@ -18,98 +18,144 @@ import (
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"strings"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/jwt"
 	bigquery "google.golang.org/api/bigquery/v2"
+	"google.golang.org/api/googleapi"
 )
 
 var (
 	// TODO(jnagal): Condense all flags to an identity file and a pem key file.
 	clientId       = flag.String("bq_id", "", "Client ID")
 	clientSecret   = flag.String("bq_secret", "notasecret", "Client Secret")
-	projectId      = flag.String("bq_project_id", "", "Bigquery project ID")
+	projectId      = flag.String("bq_project_id", "", "Bigquery project ID, defaults to the project of the Application Default Credentials")
 	serviceAccount = flag.String("bq_account", "", "Service account email")
-	pemFile        = flag.String("bq_credentials_file", "", "Credential Key file (pem)")
+	pemFile        = flag.String("bq_credentials_file", "", "Credential Key file (pem), the Application Default Credentials are used if not specified")
 )
 
 const (
 	errAlreadyExists string = "Error 409: Already Exists"
 )
 
+// Reasons of the row errors of an insertion which can be retried. The
+// rows which were valid but not inserted because of other invalid rows
+// are "stopped".
+var retryableReasons = map[string]bool{
+	"stopped":       true,
+	"backendError":  true,
+	"internalError": true,
+	"timeout":       true,
+}
+
 type Client struct {
 	service   *bigquery.Service
-	token     *oauth2.Token
+	projectId string
 	datasetId string
 	tableId   string
 }
 
-// Helper method to create an authenticated connection.
-func connect() (*oauth2.Token, *bigquery.Service, error) {
-	if *clientId == "" {
-		return nil, nil, fmt.Errorf("no client id specified")
-	}
-	if *serviceAccount == "" {
-		return nil, nil, fmt.Errorf("no service account specified")
-	}
-	if *projectId == "" {
-		return nil, nil, fmt.Errorf("no project id specified")
+// Row is a row to insert. BigQuery drops the rows whose InsertId was
+// already inserted in the last minutes, so that retrying an insertion does
+// not duplicate them.
+type Row struct {
+	InsertId string
+	Values   map[string]interface{}
+}
+
+// RowError is the error of a row which was not inserted.
+type RowError struct {
+	// Index of the row in the insertion.
+	Index int
+	// Whether the insertion of the row can be retried.
+	Retryable bool
+	Errors    []*bigquery.ErrorProto
+}
+
+func (e RowError) Error() string {
+	var messages []string
+	for _, errorproto := range e.Errors {
+		messages = append(messages, fmt.Sprintf("%s: %s", errorproto.Reason, errorproto.Message))
 	}
+	return fmt.Sprintf("error inserting row %d: %s", e.Index, strings.Join(messages, ", "))
+}
+
+// Helper method to create an authenticated connection, with the service
+// account of the flags if specified, and with the Application Default
+// Credentials otherwise.
+func connect() (*bigquery.Service, string, error) {
 	authScope := bigquery.BigqueryScope
+	var tokenSource oauth2.TokenSource
+	project := *projectId
 	if *pemFile == "" {
-		return nil, nil, fmt.Errorf("no credentials specified")
+		ts, defaultProject, err := DefaultCredentials(authScope)
+		if err != nil {
+			return nil, "", err
+		}
+		tokenSource = ts
+		if project == "" {
+			project = defaultProject
+		}
+	} else {
+		if *clientId == "" {
+			return nil, "", fmt.Errorf("no client id specified")
+		}
+		if *serviceAccount == "" {
+			return nil, "", fmt.Errorf("no service account specified")
+		}
+		pemBytes, err := ioutil.ReadFile(*pemFile)
+		if err != nil {
+			return nil, "", fmt.Errorf("could not access credential file %v - %v", *pemFile, err)
+		}
+		jwtConfig := &jwt.Config{
+			Email:      *serviceAccount,
+			Scopes:     []string{authScope},
+			PrivateKey: pemBytes,
+			TokenURL:   googleTokenURL,
+		}
+		tokenSource = jwtConfig.TokenSource(oauth2.NoContext)
 	}
-	pemBytes, err := ioutil.ReadFile(*pemFile)
-	if err != nil {
-		return nil, nil, fmt.Errorf("could not access credential file %v - %v", pemFile, err)
+	if project == "" {
+		return nil, "", fmt.Errorf("no project id specified")
 	}
 
-	jwtConfig := &jwt.Config{
-		Email:      *serviceAccount,
-		Scopes:     []string{authScope},
-		PrivateKey: pemBytes,
-		TokenURL:   "https://accounts.google.com/o/oauth2/token",
-	}
-	token, err := jwtConfig.TokenSource(oauth2.NoContext).Token()
+	// Fail early with invalid credentials. The token is refreshed by the
+	// client once expired.
+	token, err := tokenSource.Token()
 	if err != nil {
-		return nil, nil, err
+		return nil, "", err
 	}
 	if !token.Valid() {
-		return nil, nil, fmt.Errorf("invalid token for BigQuery oauth")
-	}
-
-	config := &oauth2.Config{
-		ClientID:     *clientId,
-		ClientSecret: *clientSecret,
-		Scopes:       []string{authScope},
-		Endpoint: oauth2.Endpoint{
-			AuthURL:  "https://accounts.google.com/o/oauth2/auth",
-			TokenURL: "https://accounts.google.com/o/oauth2/token",
-		},
+		return nil, "", fmt.Errorf("invalid token for BigQuery oauth")
 	}
-	client := config.Client(oauth2.NoContext, token)
 
-	service, err := bigquery.New(client)
+	service, err := bigquery.New(oauth2.NewClient(oauth2.NoContext, oauth2.ReuseTokenSource(token, tokenSource)))
 	if err != nil {
 		fmt.Printf("Failed to create new service: %v\n", err)
-		return nil, nil, err
+		return nil, "", err
 	}
 
-	return token, service, nil
+	return service, project, nil
 }
 
 // Creates a new client instance with an authenticated connection to bigquery.
 func NewClient() (*Client, error) {
-	token, service, err := connect()
+	service, project, err := connect()
 	if err != nil {
 		return nil, err
 	}
-	c := &Client{
-		token:   token,
-		service: service,
+	return NewClientWithService(service, project), nil
+}
+
+// Creates a new client instance using service, e.g. with an HTTP client
+// managing its own credentials, in the project.
+func NewClientWithService(service *bigquery.Service, projectId string) *Client {
+	return &Client{
+		service:   service,
+		projectId: projectId,
 	}
-	return c, nil
 }
 
 func (c *Client) Close() error {
@@ -118,27 +164,15 @@ func (c *Client) Close() error {
 }
 
 // Helper method to return the bigquery service connection.
-// Expired connection is refreshed.
 func (c *Client) getService() (*bigquery.Service, error) {
-	if c.token == nil || c.service == nil {
+	if c.service == nil {
 		return nil, fmt.Errorf("service not initialized")
 	}
-
-	// Refresh expired token.
-	if !c.token.Valid() {
-		token, service, err := connect()
-		if err != nil {
-			return nil, err
-		}
-		c.token = token
-		c.service = service
-		return service, nil
-	}
 	return c.service, nil
 }
 
 func (c *Client) PrintDatasets() error {
-	datasetList, err := c.service.Datasets.List(*projectId).Do()
+	datasetList, err := c.service.Datasets.List(c.projectId).Do()
 	if err != nil {
 		fmt.Printf("Failed to get list of datasets\n")
 		return err
@@ -156,10 +190,10 @@ func (c *Client) CreateDataset(datasetId string) error {
 	if c.service == nil {
 		return fmt.Errorf("no service created")
 	}
-	_, err := c.service.Datasets.Insert(*projectId, &bigquery.Dataset{
+	_, err := c.service.Datasets.Insert(c.projectId, &bigquery.Dataset{
 		DatasetReference: &bigquery.DatasetReference{
 			DatasetId: datasetId,
-			ProjectId: *projectId,
+			ProjectId: c.projectId,
 		},
 	}).Do()
 	// TODO(jnagal): Do a Get() to verify dataset already exists.
@@ -173,61 +207,101 @@ func (c *Client) CreateDataset(datasetId string) error {
 // Create a table with provided table ID and schema.
 // Schema is currently not updated if the table already exists.
 func (c *Client) CreateTable(tableId string, schema *bigquery.TableSchema) error {
+	_, err := c.EnsureTable(tableId, &bigquery.Table{Schema: schema})
+	return err
+}
+
+// Create a table with provided table ID and spec, e.g. its schema and its
+// partitioning, unless it already exists, and return the table. Clients
+// creating the table simultaneously all succeed.
+// The existing table is returned as is, it is up to the caller to compare
+// it with the spec.
+func (c *Client) EnsureTable(tableId string, spec *bigquery.Table) (*bigquery.Table, error) {
 	if c.service == nil || c.datasetId == "" {
-		return fmt.Errorf("no dataset created")
+		return nil, fmt.Errorf("no dataset created")
 	}
-	_, err := c.service.Tables.Get(*projectId, c.datasetId, tableId).Do()
+	table, err := c.service.Tables.Get(c.projectId, c.datasetId, tableId).Do()
 	if err != nil {
+		if !hasCode(err, http.StatusNotFound) {
+			return nil, err
+		}
 		// Create a new table.
-		_, err := c.service.Tables.Insert(*projectId, c.datasetId, &bigquery.Table{
-			Schema: schema,
-			TableReference: &bigquery.TableReference{
-				DatasetId: c.datasetId,
-				ProjectId: *projectId,
-				TableId:   tableId,
-			},
-		}).Do()
+		newTable := *spec
+		newTable.TableReference = &bigquery.TableReference{
+			DatasetId: c.datasetId,
+			ProjectId: c.projectId,
+			TableId:   tableId,
+		}
+		table, err = c.service.Tables.Insert(c.projectId, c.datasetId, &newTable).Do()
+		if err != nil && hasCode(err, http.StatusConflict) {
+			// Created by another client in the meantime.
+			table, err = c.service.Tables.Get(c.projectId, c.datasetId, tableId).Do()
+		}
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 	// TODO(jnagal): Update schema if it has changed. We can only extend existing schema.
 	c.tableId = tableId
-	return nil
+	return table, nil
+}
+
+// hasCode returns whether err is an error of the API with the HTTP status
+// code.
+func hasCode(err error, code int) bool {
+	apiErr, ok := err.(*googleapi.Error)
+	return ok && apiErr.Code == code
 }
 
 // Add a row to the connected table.
 func (c *Client) InsertRow(rowData map[string]interface{}) error {
+	rowErrors, err := c.InsertRows([]Row{{Values: rowData}})
+	if err != nil {
+		return err
+	}
+	if len(rowErrors) > 0 {
+		return rowErrors[0]
+	}
+	return nil
+}
+
+// Add rows to the connected table in a single request. The rows which
+// were not inserted are returned with their errors, if the request
+// succeeded.
+func (c *Client) InsertRows(rows []Row) ([]RowError, error) {
 	service, _ := c.getService()
 	if service == nil || c.datasetId == "" || c.tableId == "" {
-		return fmt.Errorf("table not setup to add rows")
-	}
-	jsonRows := make(map[string]bigquery.JsonValue)
-	for key, value := range rowData {
-		jsonRows[key] = bigquery.JsonValue(value)
+		return nil, fmt.Errorf("table not setup to add rows")
 	}
-	rows := []*bigquery.TableDataInsertAllRequestRows{
-		{
-			Json: jsonRows,
-		},
+	requestRows := make([]*bigquery.TableDataInsertAllRequestRows, 0, len(rows))
+	for _, row := range rows {
+		jsonRow := make(map[string]bigquery.JsonValue, len(row.Values))
+		for key, value := range row.Values {
+			jsonRow[key] = bigquery.JsonValue(value)
+		}
+		requestRows = append(requestRows, &bigquery.TableDataInsertAllRequestRows{
+			InsertId: row.InsertId,
+			Json:     jsonRow,
+		})
 	}
-
-	// TODO(jnagal): Batch insert requests.
-	insertRequest := &bigquery.TableDataInsertAllRequest{Rows: rows}
-
-	result, err := service.Tabledata.InsertAll(*projectId, c.datasetId, c.tableId, insertRequest).Do()
+	insertRequest := &bigquery.TableDataInsertAllRequest{Rows: requestRows}
+	result, err := service.Tabledata.InsertAll(c.projectId, c.datasetId, c.tableId, insertRequest).Do()
 	if err != nil {
-		return fmt.Errorf("error inserting row: %v", err)
+		return nil, fmt.Errorf("error inserting %d rows: %v", len(rows), err)
 	}
-
-	if len(result.InsertErrors) > 0 {
-		errstr := fmt.Sprintf("Insertion for %d rows failed\n", len(result.InsertErrors))
-		for _, errors := range result.InsertErrors {
-			for _, errorproto := range errors.Errors {
-				errstr += fmt.Sprintf("Error inserting row %d: %+v\n", errors.Index, errorproto)
+	var rowErrors []RowError
+	for _, insertErrors := range result.InsertErrors {
+		rowError := RowError{
+			Index:     int(insertErrors.Index),
+			Retryable: true,
+			Errors:    insertErrors.Errors,
+		}
+		for _, errorproto := range insertErrors.Errors {
+			if !retryableReasons[errorproto.Reason] {
+				rowError.Retryable = false
 			}
 		}
-		return fmt.Errorf(errstr)
+		rowErrors = append(rowErrors, rowError)
 	}
-	return nil
+	return rowErrors, nil
 }
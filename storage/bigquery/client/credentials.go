@@ -0,0 +1,183 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+)
+
+const (
+	googleTokenURL = "https://accounts.google.com/o/oauth2/token"
+	googleAuthURL  = "https://accounts.google.com/o/oauth2/auth"
+
+	// Environment variable naming the credentials file.
+	credentialsEnvVar = "GOOGLE_APPLICATION_CREDENTIALS"
+
+	// The metadata server of Google Compute Engine.
+	metadataURL = "http://metadata.google.internal/computeMetadata/v1/"
+)
+
+// The credentials written by `gcloud auth application-default login`,
+// relative to the home directory.
+var wellKnownCredentialsFile = filepath.Join(".config", "gcloud", "application_default_credentials.json")
+
+// credentialsFile is a JSON credentials file, of a service account or of
+// a user.
+type credentialsFile struct {
+	Type string `json:"type"`
+
+	// Service account.
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+	ProjectId   string `json:"project_id"`
+
+	// User.
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// DefaultCredentials returns the token source and the project of the
+// Application Default Credentials: the file named by
+// GOOGLE_APPLICATION_CREDENTIALS, the credentials of gcloud, or the service
+// account of the Compute Engine instance. The project is empty if the
+// credentials do not name one.
+func DefaultCredentials(scope string) (oauth2.TokenSource, string, error) {
+	if path := os.Getenv(credentialsEnvVar); path != "" {
+		ts, project, err := readCredentialsFile(path, scope)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read the credentials of %s %q - %v", credentialsEnvVar, path, err)
+		}
+		return ts, project, nil
+	}
+	if home := os.Getenv("HOME"); home != "" {
+		path := filepath.Join(home, wellKnownCredentialsFile)
+		if _, err := os.Stat(path); err == nil {
+			ts, project, err := readCredentialsFile(path, scope)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to read the credentials of gcloud %q - %v", path, err)
+			}
+			return ts, project, nil
+		}
+	}
+	metadata := &metadataClient{
+		baseURL: metadataURL,
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+	project, err := metadata.get("project/project-id")
+	if err != nil {
+		return nil, "", fmt.Errorf("no Application Default Credentials found: %s is not set, there are no gcloud credentials, and the metadata server is unreachable - %v", credentialsEnvVar, err)
+	}
+	return oauth2.ReuseTokenSource(nil, metadata), project, nil
+}
+
+func readCredentialsFile(path, scope string) (oauth2.TokenSource, string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	var f credentialsFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, "", err
+	}
+	switch f.Type {
+	case "service_account":
+		tokenURL := f.TokenURI
+		if tokenURL == "" {
+			tokenURL = googleTokenURL
+		}
+		config := &jwt.Config{
+			Email:      f.ClientEmail,
+			PrivateKey: []byte(f.PrivateKey),
+			Scopes:     []string{scope},
+			TokenURL:   tokenURL,
+		}
+		return config.TokenSource(oauth2.NoContext), f.ProjectId, nil
+	case "authorized_user":
+		config := &oauth2.Config{
+			ClientID:     f.ClientID,
+			ClientSecret: f.ClientSecret,
+			Scopes:       []string{scope},
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  googleAuthURL,
+				TokenURL: googleTokenURL,
+			},
+		}
+		return config.TokenSource(oauth2.NoContext, &oauth2.Token{RefreshToken: f.RefreshToken}), f.ProjectId, nil
+	}
+	return nil, "", fmt.Errorf("unknown credentials type %q", f.Type)
+}
+
+// metadataClient gets the tokens of the service account of the Compute
+// Engine instance from its metadata server.
+type metadataClient struct {
+	baseURL string
+	client  *http.Client
+}
+
+func (self *metadataClient) get(path string) (string, error) {
+	req, err := http.NewRequest("GET", self.baseURL+path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := self.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata server returned %s for %s", resp.Status, path)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func (self *metadataClient) Token() (*oauth2.Token, error) {
+	body, err := self.get("instance/service-accounts/default/token")
+	if err != nil {
+		return nil, err
+	}
+	var res struct {
+		AccessToken  string `json:"access_token"`
+		ExpiresInSec int    `json:"expires_in"`
+		TokenType    string `json:"token_type"`
+	}
+	if err := json.Unmarshal([]byte(body), &res); err != nil {
+		return nil, fmt.Errorf("invalid token from the metadata server - %v", err)
+	}
+	if res.AccessToken == "" {
+		return nil, fmt.Errorf("no token from the metadata server")
+	}
+	return &oauth2.Token{
+		AccessToken: res.AccessToken,
+		TokenType:   res.TokenType,
+		Expiry:      time.Now().Add(time.Duration(res.ExpiresInSec) * time.Second),
+	}, nil
+}
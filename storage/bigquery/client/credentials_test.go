@@ -0,0 +1,92 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeCredentials(t *testing.T, dir, content string) string {
+	path := filepath.Join(dir, "credentials.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCredentialsFromEnvironment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bigquery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv(credentialsEnvVar, os.Getenv(credentialsEnvVar))
+
+	os.Setenv(credentialsEnvVar, writeCredentials(t, dir, `{"type": "service_account", "client_email": "a@b.iam.gserviceaccount.com", "private_key": "key", "project_id": "awesome_project"}`))
+	ts, project, err := DefaultCredentials("scope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ts == nil || project != "awesome_project" {
+		t.Errorf("expected a token source for awesome_project, got %v and %q", ts, project)
+	}
+
+	os.Setenv(credentialsEnvVar, writeCredentials(t, dir, `{"type": "authorized_user", "client_id": "id", "client_secret": "secret", "refresh_token": "token"}`))
+	if _, project, err = DefaultCredentials("scope"); err != nil || project != "" {
+		t.Errorf("expected user credentials without a project, got %q and %v", project, err)
+	}
+
+	os.Setenv(credentialsEnvVar, writeCredentials(t, dir, `{"type": "external_account"}`))
+	if _, _, err = DefaultCredentials("scope"); err == nil {
+		t.Errorf("expected an error for an unknown credentials type")
+	}
+}
+
+func TestMetadataToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			http.Error(w, "missing Metadata-Flavor", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/instance/service-accounts/default/token":
+			w.Write([]byte(`{"access_token": "token", "expires_in": 3600, "token_type": "Bearer"}`))
+		case "/project/project-id":
+			w.Write([]byte("awesome_project"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	metadata := &metadataClient{baseURL: server.URL + "/", client: http.DefaultClient}
+
+	project, err := metadata.get("project/project-id")
+	if err != nil || project != "awesome_project" {
+		t.Errorf("expected awesome_project, got %q and %v", project, err)
+	}
+	token, err := metadata.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "token" || token.TokenType != "Bearer" || token.Expiry.Before(time.Now().Add(59*time.Minute)) {
+		t.Errorf("unexpected token %+v", token)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bigquery
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	bigquery "google.golang.org/api/bigquery/v2"
+)
+
+// The table is partitioned by day of the timestamp of the stats, so that
+// the queries of a period of time only scan its partitions.
+const partitioningType = "DAY"
+
+// The table is clustered by machine and container, so that the queries of
+// a container only scan its blocks in the partitions.
+var clusteringFields = []string{colMachineName, colContainerName}
+
+// tableSpec returns the spec of the table of the stats, whose partitions
+// expire after partitionExpiration, or never if 0.
+func (self *bigqueryStorage) tableSpec(partitionExpiration time.Duration) *bigquery.Table {
+	return &bigquery.Table{
+		Schema: self.GetSchema(),
+		TimePartitioning: &bigquery.TimePartitioning{
+			Type:         partitioningType,
+			Field:        colTimestamp,
+			ExpirationMs: int64(partitionExpiration / time.Millisecond),
+		},
+		Clustering: &bigquery.Clustering{
+			Fields: clusteringFields,
+		},
+	}
+}
+
+// tableSuggestions returns how an existing table differs from the spec of
+// the table of the stats. The differences are not fatal, the stats are
+// inserted either way, but the queries may scan more than they need.
+func tableSuggestions(tableId string, table, spec *bigquery.Table) []string {
+	var suggestions []string
+	partitioning := table.TimePartitioning
+	if partitioning == nil || partitioning.Field != spec.TimePartitioning.Field {
+		suggestions = append(suggestions, fmt.Sprintf("table %q is not partitioned on %q, queries scan its whole history; consider copying it into a partitioned table, e.g. with CREATE TABLE ... PARTITION BY DATE(%s) CLUSTER BY %s, %s AS SELECT * FROM ..., or letting cAdvisor create a new table", tableId, colTimestamp, colTimestamp, colMachineName, colContainerName))
+	} else if partitioning.ExpirationMs != spec.TimePartitioning.ExpirationMs {
+		suggestions = append(suggestions, fmt.Sprintf("the partitions of table %q expire after %s rather than %s; consider updating it with bq update --time_partitioning_expiration", tableId, expiration(partitioning.ExpirationMs), expiration(spec.TimePartitioning.ExpirationMs)))
+	}
+	if table.Clustering == nil || !reflect.DeepEqual(table.Clustering.Fields, spec.Clustering.Fields) {
+		suggestions = append(suggestions, fmt.Sprintf("table %q is not clustered by %v; consider updating it with bq update --clustering_fields", tableId, spec.Clustering.Fields))
+	}
+	return suggestions
+}
+
+func expiration(ms int64) string {
+	if ms <= 0 {
+		return "never"
+	}
+	return (time.Duration(ms) * time.Millisecond).String()
+}
@@ -0,0 +1,111 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bigquery
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	bigquery "google.golang.org/api/bigquery/v2"
+)
+
+func TestCreatePartitionedTable(t *testing.T) {
+	fake := newFakeBigQuery()
+	defer fake.server.Close()
+	delete(fake.tables, "table")
+
+	if _, err := newStorageWithClient(newTestClient(t, fake), "host", "dataset", "table", 1, time.Hour, 720*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.created) != 1 {
+		t.Fatalf("expected the table to be created, got %v", fake.created)
+	}
+	table := fake.created[0]
+	expected := &bigquery.TimePartitioning{Type: "DAY", Field: colTimestamp, ExpirationMs: 30 * 24 * 3600 * 1000}
+	if !reflect.DeepEqual(table.TimePartitioning, expected) {
+		t.Errorf("expected partitioning %+v, got %+v", expected, table.TimePartitioning)
+	}
+	if table.Clustering == nil || !reflect.DeepEqual(table.Clustering.Fields, []string{colMachineName, colContainerName}) {
+		t.Errorf("expected the table to be clustered by machine and container, got %+v", table.Clustering)
+	}
+	if table.Schema == nil || len(table.Schema.Fields) == 0 {
+		t.Errorf("expected the table to have a schema")
+	}
+
+	// Restarting keeps the table.
+	if _, err := newStorageWithClient(newTestClient(t, fake), "host", "dataset", "table", 1, time.Hour, 720*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.created) != 1 {
+		t.Errorf("expected the table to be created once, got %d creations", len(fake.created))
+	}
+}
+
+func TestConcurrentTableCreation(t *testing.T) {
+	fake := newFakeBigQuery()
+	defer fake.server.Close()
+	delete(fake.tables, "table")
+	// Another cAdvisor creates the table first.
+	fake.conflictOnCreate = true
+
+	driver, err := newStorageWithClient(newTestClient(t, fake), "host", "dataset", "table", 1, time.Hour, 0)
+	if err != nil {
+		t.Fatalf("expected the table created by another cAdvisor to be used, got %v", err)
+	}
+	driver.readyToFlush = func() bool { return false }
+	if err := driver.AddStats(testRef, testStats(time.Unix(1464000000, 0))); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExistingUnpartitionedTable(t *testing.T) {
+	fake := newFakeBigQuery()
+	defer fake.server.Close()
+
+	driver, err := newStorageWithClient(newTestClient(t, fake), "host", "dataset", "table", 1, time.Hour, 0)
+	if err != nil {
+		t.Fatalf("expected an unpartitioned table to be used, got %v", err)
+	}
+	if len(fake.created) != 0 {
+		t.Errorf("expected the existing table to be kept, got %v", fake.created)
+	}
+	driver.readyToFlush = func() bool { return false }
+	if err := driver.AddStats(testRef, testStats(time.Unix(1464000000, 0))); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTableSuggestions(t *testing.T) {
+	driver := &bigqueryStorage{}
+	spec := driver.tableSpec(24 * time.Hour)
+	for _, tc := range []struct {
+		name     string
+		table    *bigquery.Table
+		expected int
+	}{
+		{"partitioned", driver.tableSpec(24 * time.Hour), 0},
+		{"unpartitioned", &bigquery.Table{}, 2},
+		{"other expiration", driver.tableSpec(48 * time.Hour), 1},
+		{"ingestion time", &bigquery.Table{
+			TimePartitioning: &bigquery.TimePartitioning{Type: "DAY"},
+			Clustering:       spec.Clustering,
+		}, 1},
+	} {
+		if actual := tableSuggestions("table", tc.table, spec); len(actual) != tc.expected {
+			t.Errorf("%s: expected %d suggestions, got %v", tc.name, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,437 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clickhouse
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+	"github.com/google/cadvisor/utils/container"
+
+	"github.com/golang/glog"
+)
+
+func init() {
+	storage.RegisterStorageDriver("clickhouse", new)
+}
+
+var (
+	argURL           = flag.String("storage_driver_clickhouse_url", "http://localhost:8123", "URL of the HTTP interface of the ClickHouse server")
+	argUsername      = flag.String("storage_driver_clickhouse_username", "default", "user the rows are inserted as")
+	argPassword      = flag.String("storage_driver_clickhouse_password", "", "password of the user")
+	argDatabase      = flag.String("storage_driver_clickhouse_database", "default", "database of the table")
+	argTable         = flag.String("storage_driver_clickhouse_table", "container_stats", "table the stats are inserted into")
+	argCreateTable   = flag.Bool("storage_driver_clickhouse_create_table", false, "create the table if it does not exist")
+	argTTL           = flag.Duration("storage_driver_clickhouse_ttl", 0, "time the rows are kept for in a table the driver creates, 0 for ever")
+	argFlushInterval = flag.Duration("storage_driver_clickhouse_flush_interval", 10*time.Second, "interval of the inserts of the buffered stats")
+	argBatchSize     = flag.Int("storage_driver_clickhouse_batch_size", 1000, "number of buffered rows inserted as soon as they are buffered, before the flush interval")
+	argMaxPending    = flag.Int("storage_driver_clickhouse_max_pending", 100000, "maximum number of rows buffered while the inserts fail, the oldest being dropped beyond it")
+	argMaxRetries    = flag.Int("storage_driver_clickhouse_max_retries", 3, "number of times a failed insert is retried before its rows are dropped")
+	argTimeout       = flag.Duration("storage_driver_clickhouse_timeout", 30*time.Second, "timeout of the requests")
+)
+
+const (
+	// Backoff before retrying a failed insert, doubled after every retry
+	// up to maxBackoff.
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 10 * time.Second
+	// Minimum time between the logs of the insert errors.
+	errorLogInterval = time.Minute
+)
+
+// column is a column of the stats table, past the key, ID and labels.
+type column struct {
+	name  string
+	value func(stats *info.ContainerStats) uint64
+}
+
+// Columns of the major stat groups, all UInt64.
+var columns = []column{
+	{"cpu_usage_total", func(s *info.ContainerStats) uint64 { return s.Cpu.Usage.Total }},
+	{"cpu_usage_user", func(s *info.ContainerStats) uint64 { return s.Cpu.Usage.User }},
+	{"cpu_usage_system", func(s *info.ContainerStats) uint64 { return s.Cpu.Usage.System }},
+	{"cpu_load_average", func(s *info.ContainerStats) uint64 { return uint64(s.Cpu.LoadAverage) }},
+	{"memory_usage", func(s *info.ContainerStats) uint64 { return s.Memory.Usage }},
+	{"memory_working_set", func(s *info.ContainerStats) uint64 { return s.Memory.WorkingSet }},
+	{"memory_rss", func(s *info.ContainerStats) uint64 { return s.Memory.RSS }},
+	{"memory_cache", func(s *info.ContainerStats) uint64 { return s.Memory.Cache }},
+	{"memory_failcnt", func(s *info.ContainerStats) uint64 { return s.Memory.Failcnt }},
+	{"network_rx_bytes", func(s *info.ContainerStats) uint64 { return s.Network.RxBytes }},
+	{"network_rx_packets", func(s *info.ContainerStats) uint64 { return s.Network.RxPackets }},
+	{"network_rx_errors", func(s *info.ContainerStats) uint64 { return s.Network.RxErrors }},
+	{"network_rx_dropped", func(s *info.ContainerStats) uint64 { return s.Network.RxDropped }},
+	{"network_tx_bytes", func(s *info.ContainerStats) uint64 { return s.Network.TxBytes }},
+	{"network_tx_packets", func(s *info.ContainerStats) uint64 { return s.Network.TxPackets }},
+	{"network_tx_errors", func(s *info.ContainerStats) uint64 { return s.Network.TxErrors }},
+	{"network_tx_dropped", func(s *info.ContainerStats) uint64 { return s.Network.TxDropped }},
+	{"fs_usage", func(s *info.ContainerStats) uint64 {
+		var usage uint64
+		for _, fs := range s.Filesystem {
+			usage += fs.Usage
+		}
+		return usage
+	}},
+	{"fs_limit", func(s *info.ContainerStats) uint64 {
+		var limit uint64
+		for _, fs := range s.Filesystem {
+			limit += fs.Limit
+		}
+		return limit
+	}},
+	{"diskio_read_bytes", func(s *info.ContainerStats) uint64 { return sumDiskIo(s.DiskIo.IoServiceBytes, "Read") }},
+	{"diskio_write_bytes", func(s *info.ContainerStats) uint64 { return sumDiskIo(s.DiskIo.IoServiceBytes, "Write") }},
+}
+
+func sumDiskIo(stats []info.PerDiskStats, op string) uint64 {
+	var sum uint64
+	for _, disk := range stats {
+		sum += disk.Stats[op]
+	}
+	return sum
+}
+
+// Format of the timestamps, a DateTime64(9) in UTC.
+const timestampFormat = "2006-01-02 15:04:05.000000000"
+
+type clickhouseStorage struct {
+	machineName string
+	client      *http.Client
+	// URL of the HTTP interface, and the credentials.
+	url      string
+	username string
+	password string
+	// Quoted name of the table, qualified with its database.
+	table      string
+	batchSize  int
+	maxRetries int
+
+	lock sync.Mutex
+	// JSONEachRow lines of the rows to insert.
+	rows       [][]byte
+	maxPending int
+
+	// Counts of the rows inserted, dropped after failing to be inserted,
+	// and dropped because too many were buffered.
+	inserted uint64
+	failed   uint64
+	dropped  uint64
+	// Counts when the errors were last logged, and the last error.
+	logLock      sync.Mutex
+	lastLog      time.Time
+	lastErr      error
+	loggedFailed uint64
+	loggedDrop   uint64
+
+	flush chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func new() (storage.StorageDriver, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	return newStorage(config{
+		machineName:   hostname,
+		endpoint:      *argURL,
+		username:      *argUsername,
+		password:      *argPassword,
+		database:      *argDatabase,
+		table:         *argTable,
+		createTable:   *argCreateTable,
+		ttl:           *argTTL,
+		flushInterval: *argFlushInterval,
+		batchSize:     *argBatchSize,
+		maxPending:    *argMaxPending,
+		maxRetries:    *argMaxRetries,
+		timeout:       *argTimeout,
+	})
+}
+
+var identifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// quoteIdentifier quotes the name of a database or a table.
+func quoteIdentifier(name string) (string, error) {
+	if !identifierRegexp.MatchString(name) {
+		return "", fmt.Errorf("invalid ClickHouse identifier %q", name)
+	}
+	return "`" + name + "`", nil
+}
+
+// createTableQuery returns the statement creating the table if it does not
+// exist, its rows being deleted after the ttl if it is positive.
+func (self *clickhouseStorage) createTableQuery(ttl time.Duration) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "CREATE TABLE IF NOT EXISTS %s (\n"+
+		"\ttimestamp DateTime64(9, 'UTC'),\n"+
+		"\tmachine LowCardinality(String),\n"+
+		"\tcontainer_name String,\n"+
+		"\tcontainer_id String,\n"+
+		"\tlabels Map(String, String)", self.table)
+	for _, c := range columns {
+		fmt.Fprintf(&b, ",\n\t%s UInt64", c.name)
+	}
+	b.WriteString("\n)\nENGINE = MergeTree\nPARTITION BY toDate(timestamp)\nORDER BY (machine, container_name, timestamp)")
+	if ttl > 0 {
+		fmt.Fprintf(&b, "\nTTL toDateTime(timestamp) + INTERVAL %d SECOND", int64(ttl/time.Second))
+	}
+	return b.String()
+}
+
+// insertQuery returns the statement the rows are sent with.
+func (self *clickhouseStorage) insertQuery() string {
+	return fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", self.table)
+}
+
+// row returns the JSONEachRow line of the row of stats.
+func (self *clickhouseStorage) row(ref info.ContainerReference, stats *info.ContainerStats) ([]byte, error) {
+	labels := ref.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	values := map[string]interface{}{
+		"timestamp":      stats.Timestamp.UTC().Format(timestampFormat),
+		"machine":        self.machineName,
+		"container_name": container.GetPreferredName(ref),
+		"container_id":   ref.Id,
+		"labels":         labels,
+	}
+	for _, c := range columns {
+		values[c.name] = c.value(stats)
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+func (self *clickhouseStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	if stats == nil {
+		return nil
+	}
+	row, err := self.row(ref, stats)
+	if err != nil {
+		return err
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.rows = append(self.rows, row)
+	if extra := len(self.rows) - self.maxPending; extra > 0 {
+		self.rows = append(self.rows[:0:0], self.rows[extra:]...)
+		atomic.AddUint64(&self.dropped, uint64(extra))
+		self.logErrors(false)
+	}
+	if len(self.rows) >= self.batchSize {
+		select {
+		case self.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// run inserts the buffered rows every flush interval, or as soon as a batch
+// is buffered, until stopped.
+func (self *clickhouseStorage) run(flushInterval time.Duration) {
+	defer close(self.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-self.flush:
+		case <-self.stop:
+			self.insertRows()
+			return
+		}
+		self.insertRows()
+	}
+}
+
+// insertRows inserts the buffered rows in batches, retrying every batch
+// with backoff up to the maximum retries before dropping it.
+func (self *clickhouseStorage) insertRows() {
+	self.lock.Lock()
+	rows := self.rows
+	self.rows = nil
+	self.lock.Unlock()
+	for len(rows) > 0 {
+		n := len(rows)
+		if n > self.batchSize {
+			n = self.batchSize
+		}
+		batch := bytes.Join(rows[:n], nil)
+		rows = rows[n:]
+		backoff := minBackoff
+		var err error
+		for retry := 0; ; retry++ {
+			if err = self.query(self.insertQuery(), batch); err == nil || retry >= self.maxRetries {
+				break
+			}
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+		if err == nil {
+			atomic.AddUint64(&self.inserted, uint64(n))
+			continue
+		}
+		atomic.AddUint64(&self.failed, uint64(n))
+		self.logLock.Lock()
+		self.lastErr = err
+		self.logLock.Unlock()
+		self.logErrors(false)
+	}
+}
+
+// query sends a statement to the HTTP interface, with its data if any.
+func (self *clickhouseStorage) query(query string, data []byte) error {
+	req, err := http.NewRequest("POST", self.url+"/?"+url.Values{"query": {query}}.Encode(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-ClickHouse-User", self.username)
+	if self.password != "" {
+		req.Header.Set("X-ClickHouse-Key", self.password)
+	}
+	resp, err := self.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ClickHouse returned %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	return nil
+}
+
+// logErrors logs the counts of the rows failed and dropped since the last
+// log, at most every errorLogInterval unless forced.
+func (self *clickhouseStorage) logErrors(force bool) {
+	self.logLock.Lock()
+	defer self.logLock.Unlock()
+	if !force && time.Since(self.lastLog) < errorLogInterval {
+		return
+	}
+	failed, dropped := atomic.LoadUint64(&self.failed), atomic.LoadUint64(&self.dropped)
+	if failed == self.loggedFailed && dropped == self.loggedDrop {
+		return
+	}
+	glog.Errorf("ClickHouse: %d rows failed to be inserted after %d retries and %d were dropped because %d were buffered, last error: %v",
+		failed-self.loggedFailed, self.maxRetries, dropped-self.loggedDrop, self.maxPending, self.lastErr)
+	self.lastLog = time.Now()
+	self.loggedFailed, self.loggedDrop = failed, dropped
+}
+
+// Close inserts the buffered rows.
+func (self *clickhouseStorage) Close() error {
+	close(self.stop)
+	<-self.done
+	self.logErrors(true)
+	return nil
+}
+
+// config is the configuration of the driver, populated from the flags.
+type config struct {
+	// A unique identifier to identify the host that current cAdvisor
+	// instance is running on.
+	machineName string
+	// The URL of the HTTP interface of the ClickHouse server.
+	endpoint string
+	// The user the rows are inserted as.
+	username string
+	// The password of the user.
+	password string
+	// The database of the table.
+	database string
+	// The table the stats are inserted into.
+	table string
+	// Whether to create the table if it does not exist.
+	createTable bool
+	// The time the rows are kept for in a created table, for ever if 0.
+	ttl time.Duration
+	// The interval of the inserts of the buffered rows.
+	flushInterval time.Duration
+	// The number of buffered rows inserted before the flush interval.
+	batchSize int
+	// The maximum number of rows buffered while the inserts fail.
+	maxPending int
+	// The number of times a failed insert is retried.
+	maxRetries int
+	// The timeout of the requests.
+	timeout time.Duration
+}
+
+// Create a new ClickHouse storage driver.
+func newStorage(cfg config) (*clickhouseStorage, error) {
+	if u, err := url.Parse(cfg.endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid ClickHouse URL %q, must be http or https", cfg.endpoint)
+	}
+	quotedDatabase, err := quoteIdentifier(cfg.database)
+	if err != nil {
+		return nil, err
+	}
+	quotedTable, err := quoteIdentifier(cfg.table)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.flushInterval <= 0 || cfg.batchSize <= 0 || cfg.maxPending <= 0 {
+		return nil, fmt.Errorf("the ClickHouse flush interval, batch size and maximum pending rows must be positive")
+	}
+	if cfg.maxRetries < 0 || cfg.ttl < 0 {
+		return nil, fmt.Errorf("the ClickHouse maximum retries and TTL can not be negative")
+	}
+	ret := &clickhouseStorage{
+		machineName: cfg.machineName,
+		client:      &http.Client{Timeout: cfg.timeout},
+		url:         strings.TrimSuffix(cfg.endpoint, "/"),
+		username:    cfg.username,
+		password:    cfg.password,
+		table:       quotedDatabase + "." + quotedTable,
+		batchSize:   cfg.batchSize,
+		maxRetries:  cfg.maxRetries,
+		maxPending:  cfg.maxPending,
+		flush:       make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if cfg.createTable {
+		if err := ret.query(ret.createTableQuery(cfg.ttl), nil); err != nil {
+			return nil, fmt.Errorf("failed to create the ClickHouse table %s - %v", ret.table, err)
+		}
+	}
+	go ret.run(cfg.flushInterval)
+	return ret, nil
+}
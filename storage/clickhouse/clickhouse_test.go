@@ -0,0 +1,317 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clickhouse
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+var (
+	testRef = info.ContainerReference{
+		Name:    "/docker/abc",
+		Id:      "abc",
+		Aliases: []string{"web.1", "abc"},
+		Labels:  map[string]string{"app": "it's"},
+	}
+	testStats = &info.ContainerStats{
+		Timestamp: time.Date(2016, 1, 1, 0, 0, 0, 123456789, time.UTC),
+		Cpu:       info.CpuStats{Usage: info.CpuUsage{Total: 100, User: 60, System: 40}},
+		Memory:    info.MemoryStats{Usage: 4096, WorkingSet: 2048},
+		Network:   info.NetworkStats{InterfaceStats: info.InterfaceStats{RxBytes: 10, TxBytes: 20}},
+		Filesystem: []info.FsStats{
+			{Device: "/dev/sda1", Usage: 1, Limit: 10},
+			{Device: "/dev/sdb1", Usage: 2, Limit: 20},
+		},
+		DiskIo: info.DiskIoStats{IoServiceBytes: []info.PerDiskStats{
+			{Major: 8, Stats: map[string]uint64{"Read": 5, "Write": 7}},
+			{Major: 8, Minor: 16, Stats: map[string]uint64{"Read": 1}},
+		}},
+	}
+)
+
+// fakeServer is the HTTP interface of a ClickHouse server, which fails the
+// queries with the statuses given, then succeeds.
+type fakeServer struct {
+	lock     sync.Mutex
+	statuses []int
+	queries  []string
+	data     [][]byte
+	headers  []http.Header
+}
+
+func (self *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.headers = append(self.headers, r.Header)
+	if len(self.statuses) > 0 {
+		status := self.statuses[0]
+		self.statuses = self.statuses[1:]
+		if status != http.StatusOK {
+			http.Error(w, "Code: 241. DB::Exception: Memory limit exceeded", status)
+			return
+		}
+	}
+	data, _ := ioutil.ReadAll(r.Body)
+	self.queries = append(self.queries, r.URL.Query().Get("query"))
+	self.data = append(self.data, data)
+}
+
+func (self *fakeServer) received() ([]string, [][]byte) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.queries, self.data
+}
+
+// testConfig returns the configuration of a driver inserting into the
+// server at url.
+func testConfig(url string) config {
+	return config{
+		machineName:   "host-1",
+		endpoint:      url,
+		username:      "cadvisor",
+		password:      "secret",
+		database:      "metrics",
+		table:         "container_stats",
+		flushInterval: time.Hour,
+		batchSize:     10,
+		maxPending:    10,
+		timeout:       5 * time.Second,
+	}
+}
+
+func newTestStorage(t *testing.T, url string, batchSize, maxPending, maxRetries int) *clickhouseStorage {
+	cfg := testConfig(url)
+	cfg.batchSize = batchSize
+	cfg.maxPending = maxPending
+	cfg.maxRetries = maxRetries
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return driver
+}
+
+func TestQuoting(t *testing.T) {
+	if got, err := quoteIdentifier("Container_Stats"); err != nil || got != "`Container_Stats`" {
+		t.Errorf("expected `Container_Stats`, got %s, %v", got, err)
+	}
+	for _, name := range []string{"", "a.b", "stats; DROP TABLE x", "`quoted`", "1stats"} {
+		if _, err := quoteIdentifier(name); err == nil {
+			t.Errorf("expected an error for the identifier %q", name)
+		}
+	}
+}
+
+func TestCreateTableQuery(t *testing.T) {
+	driver := newTestStorage(t, "http://localhost:8123", 10, 10, 0)
+	defer driver.Close()
+	query := driver.createTableQuery(30 * 24 * time.Hour)
+	for _, expected := range []string{
+		"CREATE TABLE IF NOT EXISTS `metrics`.`container_stats` (\n",
+		"\ttimestamp DateTime64(9, 'UTC'),\n",
+		"\tlabels Map(String, String),\n",
+		"\tcpu_usage_total UInt64,\n",
+		"\tdiskio_write_bytes UInt64\n)\n",
+		"ENGINE = MergeTree\n",
+		"ORDER BY (machine, container_name, timestamp)\n",
+		"TTL toDateTime(timestamp) + INTERVAL 2592000 SECOND",
+	} {
+		if !strings.Contains(query, expected) {
+			t.Errorf("expected %q in the statement:\n%s", expected, query)
+		}
+	}
+	if query := driver.createTableQuery(0); strings.Contains(query, "TTL") {
+		t.Errorf("unexpected TTL without a ttl:\n%s", query)
+	}
+	if got := driver.insertQuery(); got != "INSERT INTO `metrics`.`container_stats` FORMAT JSONEachRow" {
+		t.Errorf("unexpected insert statement %s", got)
+	}
+}
+
+func TestRow(t *testing.T) {
+	driver := newTestStorage(t, "http://localhost:8123", 10, 10, 0)
+	defer driver.Close()
+	row, err := driver.row(testRef, testStats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(row, []byte("}\n")) || bytes.Count(row, []byte("\n")) != 1 {
+		t.Errorf("expected a single JSON line, got %q", row)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(row, &got); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]interface{}{
+		"timestamp":          "2016-01-01 00:00:00.123456789",
+		"machine":            "host-1",
+		"container_name":     "web.1",
+		"container_id":       "abc",
+		"labels":             map[string]interface{}{"app": "it's"},
+		"cpu_usage_total":    100.0,
+		"cpu_usage_user":     60.0,
+		"memory_usage":       4096.0,
+		"memory_working_set": 2048.0,
+		"network_rx_bytes":   10.0,
+		"network_tx_bytes":   20.0,
+		"fs_usage":           3.0,
+		"fs_limit":           30.0,
+		"diskio_read_bytes":  6.0,
+		"diskio_write_bytes": 7.0,
+		"memory_rss":         0.0,
+	}
+	for name, value := range expected {
+		gotJSON, _ := json.Marshal(got[name])
+		expectedJSON, _ := json.Marshal(value)
+		if !bytes.Equal(gotJSON, expectedJSON) {
+			t.Errorf("%s: expected %s, got %s", name, expectedJSON, gotJSON)
+		}
+	}
+	if len(got) != 5+len(columns) {
+		t.Errorf("expected %d fields, got %d", 5+len(columns), len(got))
+	}
+
+	// Containers without labels have an empty map, which a Map column
+	// requires.
+	row, err = driver.row(info.ContainerReference{Name: "/"}, testStats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(row, []byte(`"labels":{}`)) || !bytes.Contains(row, []byte(`"container_name":"/"`)) {
+		t.Errorf("unexpected row %s", row)
+	}
+}
+
+func TestCreateTable(t *testing.T) {
+	server := &fakeServer{}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	cfg := testConfig(httpServer.URL)
+	cfg.createTable = true
+	cfg.ttl = time.Hour
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.Close()
+	queries, _ := server.received()
+	if len(queries) != 1 || queries[0] != driver.createTableQuery(time.Hour) {
+		t.Errorf("expected the table to be created, got %q", queries)
+	}
+
+	server.statuses = []int{http.StatusForbidden}
+	cfg.ttl = 0
+	if _, err := newStorage(cfg); err == nil {
+		t.Error("expected an error when the table can not be created")
+	}
+}
+
+func TestInsert(t *testing.T) {
+	server := &fakeServer{}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	driver := newTestStorage(t, httpServer.URL, 2, 10, 0)
+	for i := 0; i < 3; i++ {
+		if err := driver.AddStats(testRef, testStats); err != nil {
+			t.Fatal(err)
+		}
+	}
+	driver.Close()
+	queries, data := server.received()
+	if len(queries) != 2 || queries[0] != driver.insertQuery() {
+		t.Fatalf("expected 2 inserts, got %q", queries)
+	}
+	if lines := bytes.Count(data[0], []byte("\n")); lines != 2 {
+		t.Errorf("expected a batch of 2 rows, got %d", lines)
+	}
+	if lines := bytes.Count(data[1], []byte("\n")); lines != 1 {
+		t.Errorf("expected a batch of 1 row, got %d", lines)
+	}
+	if h := server.headers[0]; h.Get("X-ClickHouse-User") != "cadvisor" || h.Get("X-ClickHouse-Key") != "secret" {
+		t.Errorf("expected the credentials in the headers, got %v", h)
+	}
+	if driver.inserted != 3 {
+		t.Errorf("expected 3 rows inserted, got %d", driver.inserted)
+	}
+}
+
+func TestInsertRetries(t *testing.T) {
+	server := &fakeServer{statuses: []int{
+		http.StatusInternalServerError, http.StatusServiceUnavailable,
+		// The second batch fails for good.
+		http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError,
+	}}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	driver := newTestStorage(t, httpServer.URL, 10, 10, 2)
+	driver.AddStats(testRef, testStats)
+	driver.insertRows()
+	driver.AddStats(testRef, testStats)
+	driver.insertRows()
+	driver.Close()
+	if queries, _ := server.received(); len(queries) != 1 {
+		t.Errorf("expected the first batch to be inserted after 2 retries, got %d inserts", len(queries))
+	}
+	if driver.inserted != 1 || driver.failed != 1 {
+		t.Errorf("expected 1 row inserted and 1 failed, got %d and %d", driver.inserted, driver.failed)
+	}
+}
+
+func TestMaxPending(t *testing.T) {
+	driver := newTestStorage(t, "http://localhost:8123", 100, 2, 0)
+	for i := 0; i < 5; i++ {
+		driver.AddStats(testRef, testStats)
+	}
+	driver.lock.Lock()
+	pending := len(driver.rows)
+	driver.lock.Unlock()
+	if pending != 2 || driver.dropped != 3 {
+		t.Errorf("expected 2 pending rows and 3 dropped, got %d and %d", pending, driver.dropped)
+	}
+}
+
+func TestNewStorageValidation(t *testing.T) {
+	for _, test := range []struct {
+		url, table string
+		batchSize  int
+		maxRetries int
+	}{
+		{"localhost:8123", "container_stats", 10, 0},
+		{"http://localhost:8123", "stats; DROP TABLE x", 10, 0},
+		{"http://localhost:8123", "container_stats", 0, 0},
+		{"http://localhost:8123", "container_stats", 10, -1},
+	} {
+		cfg := testConfig(test.url)
+		cfg.table = test.table
+		cfg.batchSize = test.batchSize
+		cfg.maxRetries = test.maxRetries
+		if _, err := newStorage(cfg); err == nil {
+			t.Errorf("expected an error for %+v", test)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudwatch
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol"
+	"github.com/aws/aws-sdk-go/private/protocol/query"
+)
+
+// The SDK vendored only has the STS service client, the CloudWatch client
+// below is limited to PutMetricData, built on the query protocol of the SDK
+// like the generated clients. Its requests are signed with the credentials
+// of the session, and retried by the SDK when throttled.
+
+const (
+	// Service of the CloudWatch endpoints, e.g. monitoring.us-east-1.amazonaws.com.
+	serviceName = "monitoring"
+	apiVersion  = "2010-08-01"
+
+	// Limits of a PutMetricData request.
+	maxDatumsPerRequest  = 1000
+	maxDimensions        = 20
+	maxDimensionValueLen = 1024
+)
+
+type cloudWatch struct {
+	*client.Client
+}
+
+func newCloudWatch(p client.ConfigProvider, cfgs ...*aws.Config) *cloudWatch {
+	c := p.ClientConfig(serviceName, cfgs...)
+	svc := &cloudWatch{
+		Client: client.New(
+			*c.Config,
+			metadata.ClientInfo{
+				ServiceName:   serviceName,
+				SigningName:   c.SigningName,
+				SigningRegion: c.SigningRegion,
+				Endpoint:      c.Endpoint,
+				APIVersion:    apiVersion,
+			},
+			c.Handlers,
+		),
+	}
+	svc.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	svc.Handlers.Build.PushBackNamed(query.BuildHandler)
+	svc.Handlers.Unmarshal.PushBackNamed(query.UnmarshalHandler)
+	svc.Handlers.UnmarshalMeta.PushBackNamed(query.UnmarshalMetaHandler)
+	svc.Handlers.UnmarshalError.PushBackNamed(query.UnmarshalErrorHandler)
+	return svc
+}
+
+type putMetricDataInput struct {
+	_ struct{} `type:"structure"`
+
+	MetricData []*metricDatum `type:"list" required:"true"`
+	Namespace  *string        `min:"1" type:"string" required:"true"`
+}
+
+type metricDatum struct {
+	_ struct{} `type:"structure"`
+
+	Dimensions      []*dimension  `type:"list"`
+	MetricName      *string       `min:"1" type:"string" required:"true"`
+	StatisticValues *statisticSet `type:"structure"`
+	Timestamp       *time.Time    `type:"timestamp" timestampFormat:"iso8601"`
+	Unit            *string       `type:"string" enum:"StandardUnit"`
+	Value           *float64      `type:"double"`
+}
+
+type dimension struct {
+	_ struct{} `type:"structure"`
+
+	Name  *string `min:"1" type:"string" required:"true"`
+	Value *string `min:"1" type:"string" required:"true"`
+}
+
+type statisticSet struct {
+	_ struct{} `type:"structure"`
+
+	Maximum     *float64 `type:"double" required:"true"`
+	Minimum     *float64 `type:"double" required:"true"`
+	SampleCount *float64 `type:"double" required:"true"`
+	Sum         *float64 `type:"double" required:"true"`
+}
+
+type putMetricDataOutput struct {
+	_ struct{} `type:"structure"`
+}
+
+// putMetricData publishes the datums of input, at most maxDatumsPerRequest.
+func (self *cloudWatch) putMetricData(input *putMetricDataInput) error {
+	op := &request.Operation{
+		Name:       "PutMetricData",
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+	req := self.NewRequest(op, input, &putMetricDataOutput{})
+	// The response has no result.
+	req.Handlers.Unmarshal.Remove(query.UnmarshalHandler)
+	req.Handlers.Unmarshal.PushBackNamed(protocol.UnmarshalDiscardBodyHandler)
+	return req.Send()
+}
@@ -0,0 +1,405 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudwatch
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+	"github.com/google/cadvisor/utils/cloudinfo"
+	"github.com/google/cadvisor/utils/container"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/golang/glog"
+)
+
+func init() {
+	storage.RegisterStorageDriver("cloudwatch", new)
+}
+
+var (
+	argNamespace     = flag.String("storage_driver_cloudwatch_namespace", "cAdvisor", "CloudWatch namespace of the metrics")
+	argRegion        = flag.String("storage_driver_cloudwatch_region", "", "AWS region of CloudWatch, defaults to $AWS_REGION, or the region of the EC2 instance")
+	argEndpoint      = flag.String("storage_driver_cloudwatch_endpoint", "", "CloudWatch endpoint, e.g. of a VPC endpoint, defaults to the endpoint of the region")
+	argMetrics       = flag.String("storage_driver_cloudwatch_metrics", "cpu_usage,memory_usage,memory_working_set,network_rx_bytes,network_tx_bytes", "comma-separated stats published to CloudWatch, of "+strings.Join(metricNames(), ", "))
+	argLabels        = flag.String("storage_driver_cloudwatch_labels", "", "comma-separated container labels added as dimensions of the metrics, besides InstanceId and ContainerName")
+	argFlushInterval = flag.Duration("storage_driver_cloudwatch_flush_interval", time.Minute, "interval the samples of the metrics are aggregated for, and published")
+	argMaxPending    = flag.Int("storage_driver_cloudwatch_max_pending", 10000, "maximum number of metrics aggregated before they are published, the samples of further metrics being dropped")
+)
+
+// metric is a stat published to CloudWatch. The values of the cumulative
+// stats are turned into rates per second, multiplied by scale.
+type metric struct {
+	name       string
+	unit       string
+	cumulative bool
+	scale      float64
+	value      func(stats *info.ContainerStats) uint64
+}
+
+// The CPU usage, in nanoseconds, as a percentage of a core.
+const cpuScale = 100 / float64(time.Second)
+
+// Stats which can be published, by name in argMetrics.
+var metrics = map[string]*metric{
+	"cpu_usage":          {"CPUUtilization", "Percent", true, cpuScale, func(s *info.ContainerStats) uint64 { return s.Cpu.Usage.Total }},
+	"cpu_user":           {"CPUUtilizationUser", "Percent", true, cpuScale, func(s *info.ContainerStats) uint64 { return s.Cpu.Usage.User }},
+	"cpu_system":         {"CPUUtilizationSystem", "Percent", true, cpuScale, func(s *info.ContainerStats) uint64 { return s.Cpu.Usage.System }},
+	"memory_usage":       {"MemoryUsage", "Bytes", false, 1, func(s *info.ContainerStats) uint64 { return s.Memory.Usage }},
+	"memory_working_set": {"MemoryWorkingSet", "Bytes", false, 1, func(s *info.ContainerStats) uint64 { return s.Memory.WorkingSet }},
+	"memory_rss":         {"MemoryRSS", "Bytes", false, 1, func(s *info.ContainerStats) uint64 { return s.Memory.RSS }},
+	"memory_cache":       {"MemoryCache", "Bytes", false, 1, func(s *info.ContainerStats) uint64 { return s.Memory.Cache }},
+	"network_rx_bytes":   {"NetworkRxBytes", "Bytes/Second", true, 1, func(s *info.ContainerStats) uint64 { return s.Network.RxBytes }},
+	"network_tx_bytes":   {"NetworkTxBytes", "Bytes/Second", true, 1, func(s *info.ContainerStats) uint64 { return s.Network.TxBytes }},
+	"network_rx_errors":  {"NetworkRxErrors", "Count/Second", true, 1, func(s *info.ContainerStats) uint64 { return s.Network.RxErrors }},
+	"network_tx_errors":  {"NetworkTxErrors", "Count/Second", true, 1, func(s *info.ContainerStats) uint64 { return s.Network.TxErrors }},
+	"fs_usage": {"FilesystemUsage", "Bytes", false, 1, func(s *info.ContainerStats) uint64 {
+		var usage uint64
+		for _, fs := range s.Filesystem {
+			usage += fs.Usage
+		}
+		return usage
+	}},
+	"diskio_read_bytes":  {"DiskReadBytes", "Bytes/Second", true, 1, func(s *info.ContainerStats) uint64 { return sumDiskIo(s.DiskIo.IoServiceBytes, "Read") }},
+	"diskio_write_bytes": {"DiskWriteBytes", "Bytes/Second", true, 1, func(s *info.ContainerStats) uint64 { return sumDiskIo(s.DiskIo.IoServiceBytes, "Write") }},
+}
+
+func sumDiskIo(stats []info.PerDiskStats, op string) uint64 {
+	var sum uint64
+	for _, disk := range stats {
+		sum += disk.Stats[op]
+	}
+	return sum
+}
+
+func metricNames() []string {
+	var names []string
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// series are the samples of a metric of a container, aggregated until they
+// are published.
+type series struct {
+	metric     *metric
+	dimensions []*dimension
+	timestamp  time.Time
+	count      float64
+	sum        float64
+	min        float64
+	max        float64
+}
+
+func (self *series) add(timestamp time.Time, value float64) {
+	if self.count == 0 || value < self.min {
+		self.min = value
+	}
+	if self.count == 0 || value > self.max {
+		self.max = value
+	}
+	self.count++
+	self.sum += value
+	if timestamp.After(self.timestamp) {
+		self.timestamp = timestamp
+	}
+}
+
+func (self *series) datum() *metricDatum {
+	return &metricDatum{
+		MetricName: aws.String(self.metric.name),
+		Dimensions: self.dimensions,
+		Timestamp:  aws.Time(self.timestamp),
+		Unit:       aws.String(self.metric.unit),
+		StatisticValues: &statisticSet{
+			SampleCount: aws.Float64(self.count),
+			Sum:         aws.Float64(self.sum),
+			Minimum:     aws.Float64(self.min),
+			Maximum:     aws.Float64(self.max),
+		},
+	}
+}
+
+type cloudWatchStorage struct {
+	instanceID string
+	client     *cloudWatch
+	namespace  string
+	metrics    []*metric
+	labels     []string
+	counters   *storage.CounterTracker
+
+	lock sync.Mutex
+	// Series aggregated since the last publication, by metric and dimensions.
+	pending    map[string]*series
+	maxPending int
+	dropped    uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func new() (storage.StorageDriver, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	cloudInfo := cloudinfo.NewRealCloudInfo()
+	// The hostname stands for the instance outside of a cloud.
+	instanceID := string(cloudInfo.GetInstanceID())
+	if instanceID == "" || instanceID == string(info.UnNamedInstance) || instanceID == info.UnknownInstance {
+		instanceID = hostname
+	}
+
+	awsConfig := aws.NewConfig()
+	if *argRegion != "" {
+		awsConfig.WithRegion(*argRegion)
+	}
+	if *argEndpoint != "" {
+		awsConfig.WithEndpoint(*argEndpoint)
+	}
+	// The credentials are looked up in the environment, the shared
+	// credentials file, and then the ECS task role or the EC2 instance role.
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the AWS session - %v", err)
+	}
+	if aws.StringValue(sess.Config.Region) == "" && cloudInfo.GetCloudProvider() == info.AWS {
+		if region, err := ec2metadata.New(sess).Region(); err == nil {
+			sess.Config.Region = aws.String(region)
+		}
+	}
+	if aws.StringValue(sess.Config.Region) == "" {
+		return nil, fmt.Errorf("the AWS region of CloudWatch is required, set -storage_driver_cloudwatch_region or $AWS_REGION")
+	}
+
+	var labels []string
+	if *argLabels != "" {
+		labels = strings.Split(*argLabels, ",")
+	}
+	return newStorage(config{
+		instanceID:    instanceID,
+		client:        newCloudWatch(sess),
+		namespace:     *argNamespace,
+		names:         strings.Split(*argMetrics, ","),
+		labels:        labels,
+		flushInterval: *argFlushInterval,
+		maxPending:    *argMaxPending,
+	})
+}
+
+// dimensions returns the dimensions of the metrics of a container: the
+// instance, the container and the labels it has.
+func (self *cloudWatchStorage) dimensions(ref info.ContainerReference) []*dimension {
+	dimensions := []*dimension{
+		{Name: aws.String("InstanceId"), Value: aws.String(dimensionValue(self.instanceID))},
+		{Name: aws.String("ContainerName"), Value: aws.String(dimensionValue(container.GetPreferredName(ref)))},
+	}
+	for _, label := range self.labels {
+		if value := ref.Labels[label]; value != "" {
+			dimensions = append(dimensions, &dimension{Name: aws.String(label), Value: aws.String(dimensionValue(value))})
+		}
+	}
+	return dimensions
+}
+
+// dimensionValue truncates the values longer than CloudWatch accepts.
+func dimensionValue(value string) string {
+	if len(value) > maxDimensionValueLen {
+		return value[:maxDimensionValueLen]
+	}
+	return value
+}
+
+// seriesKey identifies the series of a metric by its name and dimensions.
+func seriesKey(name string, dimensions []*dimension) string {
+	parts := []string{name}
+	for _, d := range dimensions {
+		parts = append(parts, *d.Name+"="+*d.Value)
+	}
+	return strings.Join(parts, "\x00")
+}
+
+func (self *cloudWatchStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	if stats == nil {
+		return nil
+	}
+	counters := make(map[string]uint64)
+	for _, m := range self.metrics {
+		if m.cumulative {
+			counters[m.name] = m.value(stats)
+		}
+	}
+	rates := counterRates(self.counters, ref.Name, stats.Timestamp, counters)
+	dimensions := self.dimensions(ref)
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, m := range self.metrics {
+		var value float64
+		if m.cumulative {
+			rate, ok := rates[m.name]
+			if !ok {
+				continue
+			}
+			value = rate * m.scale
+		} else {
+			value = float64(m.value(stats))
+		}
+		key := seriesKey(m.name, dimensions)
+		s, ok := self.pending[key]
+		if !ok {
+			if len(self.pending) >= self.maxPending {
+				self.dropped++
+				continue
+			}
+			s = &series{metric: m, dimensions: dimensions}
+			self.pending[key] = s
+		}
+		s.add(stats.Timestamp, value)
+	}
+	return nil
+}
+
+// run publishes the aggregated series every flush interval, until stopped.
+func (self *cloudWatchStorage) run(flushInterval time.Duration) {
+	defer close(self.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			self.publish()
+		case <-self.stop:
+			self.publish()
+			return
+		}
+	}
+}
+
+// publish publishes the aggregated series, in requests of at most
+// maxDatumsPerRequest metrics. The metrics of a failed request are dropped.
+func (self *cloudWatchStorage) publish() {
+	self.lock.Lock()
+	pending := self.pending
+	dropped := self.dropped
+	self.pending = make(map[string]*series)
+	self.dropped = 0
+	self.lock.Unlock()
+	if dropped > 0 {
+		glog.Warningf("CloudWatch: dropped %d samples of metrics beyond the maximum of %d", dropped, self.maxPending)
+	}
+
+	keys := make([]string, 0, len(pending))
+	for key := range pending {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > maxDatumsPerRequest {
+			n = maxDatumsPerRequest
+		}
+		input := &putMetricDataInput{Namespace: aws.String(self.namespace)}
+		for _, key := range keys[:n] {
+			input.MetricData = append(input.MetricData, pending[key].datum())
+		}
+		keys = keys[n:]
+		if err := self.client.putMetricData(input); err != nil {
+			glog.Errorf("CloudWatch: failed to publish %d metrics - %v", n, err)
+		}
+	}
+}
+
+// Close publishes the aggregated series.
+func (self *cloudWatchStorage) Close() error {
+	close(self.stop)
+	<-self.done
+	return nil
+}
+
+// config is the configuration of the driver, populated from the flags.
+type config struct {
+	// The ID of the instance, the InstanceId dimension of the metrics.
+	instanceID string
+	// The CloudWatch client publishing the metrics.
+	client *cloudWatch
+	// The CloudWatch namespace of the metrics.
+	namespace string
+	// The names of the stats published.
+	names []string
+	// The container labels added as dimensions of the metrics.
+	labels []string
+	// The interval the samples are aggregated for.
+	flushInterval time.Duration
+	// The maximum number of series aggregated between publications.
+	maxPending int
+}
+
+// Create a new CloudWatch storage driver.
+func newStorage(cfg config) (*cloudWatchStorage, error) {
+	if cfg.namespace == "" || strings.HasPrefix(cfg.namespace, "AWS/") {
+		return nil, fmt.Errorf("invalid CloudWatch namespace %q", cfg.namespace)
+	}
+	if cfg.flushInterval <= 0 || cfg.maxPending <= 0 {
+		return nil, fmt.Errorf("the CloudWatch flush interval and maximum pending metrics must be positive")
+	}
+	// InstanceId and ContainerName are dimensions of every metric.
+	if len(cfg.labels) > maxDimensions-2 {
+		return nil, fmt.Errorf("too many CloudWatch label dimensions %d, at most %d", len(cfg.labels), maxDimensions-2)
+	}
+	for _, label := range cfg.labels {
+		if label == "" || label == "InstanceId" || label == "ContainerName" || len(label) > 255 {
+			return nil, fmt.Errorf("invalid CloudWatch label dimension %q", label)
+		}
+	}
+	ret := &cloudWatchStorage{
+		instanceID: cfg.instanceID,
+		client:     cfg.client,
+		namespace:  cfg.namespace,
+		labels:     cfg.labels,
+		counters:   storage.NewCounterTracker(),
+		pending:    make(map[string]*series),
+		maxPending: cfg.maxPending,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	seen := make(map[string]bool)
+	for _, name := range cfg.names {
+		m, ok := metrics[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown CloudWatch metric %q, expected one of %s", name, strings.Join(metricNames(), ", "))
+		}
+		if !seen[name] {
+			seen[name] = true
+			ret.metrics = append(ret.metrics, m)
+		}
+	}
+	if len(ret.metrics) == 0 {
+		return nil, fmt.Errorf("no CloudWatch metrics to publish")
+	}
+	go ret.run(cfg.flushInterval)
+	return ret, nil
+}
@@ -0,0 +1,289 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudwatch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// fakeCloudWatch records the parameters of the PutMetricData requests.
+type fakeCloudWatch struct {
+	*httptest.Server
+	lock     sync.Mutex
+	requests []url.Values
+	headers  []http.Header
+	// Error code the requests fail with, if set.
+	errorCode string
+}
+
+func newFakeCloudWatch() *fakeCloudWatch {
+	s := &fakeCloudWatch{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.lock.Lock()
+		s.requests = append(s.requests, r.PostForm)
+		s.headers = append(s.headers, r.Header)
+		errorCode := s.errorCode
+		s.lock.Unlock()
+		w.Header().Set("Content-Type", "text/xml")
+		if errorCode != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "<ErrorResponse><Error><Type>Sender</Type><Code>%s</Code><Message>bad value</Message></Error><RequestId>1</RequestId></ErrorResponse>", errorCode)
+			return
+		}
+		fmt.Fprint(w, "<PutMetricDataResponse><ResponseMetadata><RequestId>1</RequestId></ResponseMetadata></PutMetricDataResponse>")
+	}))
+	return s
+}
+
+func (self *fakeCloudWatch) received() []url.Values {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return append([]url.Values(nil), self.requests...)
+}
+
+func (self *fakeCloudWatch) client() *cloudWatch {
+	return newCloudWatch(session.New(aws.NewConfig().
+		WithRegion("eu-west-1").
+		WithEndpoint(self.URL).
+		WithCredentials(credentials.NewStaticCredentials("AKID", "SECRET", "")).
+		WithMaxRetries(0)))
+}
+
+func TestPutMetricData(t *testing.T) {
+	server := newFakeCloudWatch()
+	defer server.Close()
+
+	err := server.client().putMetricData(&putMetricDataInput{
+		Namespace: aws.String("cAdvisor"),
+		MetricData: []*metricDatum{{
+			MetricName: aws.String("MemoryUsage"),
+			Dimensions: []*dimension{{Name: aws.String("InstanceId"), Value: aws.String("i-1")}},
+			Timestamp:  aws.Time(time.Unix(1451606400, 0)),
+			Unit:       aws.String("Bytes"),
+			StatisticValues: &statisticSet{
+				SampleCount: aws.Float64(2),
+				Sum:         aws.Float64(3072),
+				Minimum:     aws.Float64(1024),
+				Maximum:     aws.Float64(2048),
+			},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := url.Values{
+		"Action":                         {"PutMetricData"},
+		"Version":                        {"2010-08-01"},
+		"Namespace":                      {"cAdvisor"},
+		"MetricData.member.1.MetricName": {"MemoryUsage"},
+		"MetricData.member.1.Dimensions.member.1.Name":    {"InstanceId"},
+		"MetricData.member.1.Dimensions.member.1.Value":   {"i-1"},
+		"MetricData.member.1.Timestamp":                   {"2016-01-01T00:00:00Z"},
+		"MetricData.member.1.Unit":                        {"Bytes"},
+		"MetricData.member.1.StatisticValues.SampleCount": {"2"},
+		"MetricData.member.1.StatisticValues.Sum":         {"3072"},
+		"MetricData.member.1.StatisticValues.Minimum":     {"1024"},
+		"MetricData.member.1.StatisticValues.Maximum":     {"2048"},
+	}
+	requests := server.received()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	if requests[0].Encode() != expected.Encode() {
+		t.Errorf("expected the parameters\n%s\ngot\n%s", expected.Encode(), requests[0].Encode())
+	}
+	if auth := server.headers[0].Get("Authorization"); !strings.Contains(auth, "Credential=AKID/") || !strings.Contains(auth, "/eu-west-1/monitoring/aws4_request") {
+		t.Errorf("expected the request to be signed for CloudWatch, got %q", auth)
+	}
+}
+
+func TestPutMetricDataError(t *testing.T) {
+	server := newFakeCloudWatch()
+	defer server.Close()
+	server.errorCode = "InvalidParameterValue"
+
+	err := server.client().putMetricData(&putMetricDataInput{
+		Namespace:  aws.String("cAdvisor"),
+		MetricData: []*metricDatum{{MetricName: aws.String("MemoryUsage"), Value: aws.Float64(1)}},
+	})
+	if err, ok := err.(awserr.Error); !ok || err.Code() != "InvalidParameterValue" {
+		t.Errorf("expected the error of CloudWatch, got %v", err)
+	}
+}
+
+// testConfig returns the configuration of a driver publishing the given
+// stats with client.
+func testConfig(client *cloudWatch, names ...string) config {
+	return config{
+		instanceID:    "i-1",
+		client:        client,
+		namespace:     "cAdvisor",
+		names:         names,
+		flushInterval: time.Hour,
+		maxPending:    100,
+	}
+}
+
+func TestAddStats(t *testing.T) {
+	server := newFakeCloudWatch()
+	defer server.Close()
+	cfg := testConfig(server.client(), "cpu_usage", "memory_usage")
+	cfg.labels = []string{"app", "team"}
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref := info.ContainerReference{Name: "/docker/abc", Aliases: []string{"web.1", "abc"}, Labels: map[string]string{"app": "shop"}}
+	start := time.Unix(1451606400, 0).UTC()
+	// A core used half of the first second, and all of the next one.
+	for i, cpu := range []uint64{0, 5e8, 15e8} {
+		stats := &info.ContainerStats{Timestamp: start.Add(time.Duration(i) * time.Second)}
+		stats.Cpu.Usage.Total = cpu
+		stats.Memory.Usage = uint64(i+1) * 1024
+		if err := driver.AddStats(ref, stats); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := server.received()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	values := requests[0]
+	// The datums are sorted by metric name.
+	for prefix, expected := range map[string]map[string]string{
+		"MetricData.member.1.": {
+			"MetricName": "CPUUtilization", "Unit": "Percent", "Timestamp": "2016-01-01T00:00:02Z",
+			"StatisticValues.SampleCount": "2", "StatisticValues.Sum": "150", "StatisticValues.Minimum": "50", "StatisticValues.Maximum": "100",
+		},
+		"MetricData.member.2.": {
+			"MetricName": "MemoryUsage", "Unit": "Bytes",
+			"StatisticValues.SampleCount": "3", "StatisticValues.Sum": "6144", "StatisticValues.Minimum": "1024", "StatisticValues.Maximum": "3072",
+		},
+	} {
+		expected["Dimensions.member.1.Name"], expected["Dimensions.member.1.Value"] = "InstanceId", "i-1"
+		expected["Dimensions.member.2.Name"], expected["Dimensions.member.2.Value"] = "ContainerName", "web.1"
+		expected["Dimensions.member.3.Name"], expected["Dimensions.member.3.Value"] = "app", "shop"
+		for name, value := range expected {
+			if got := values.Get(prefix + name); got != value {
+				t.Errorf("expected %s%s %q, got %q", prefix, name, value, got)
+			}
+		}
+		// The container has no team label.
+		if got := values.Get(prefix + "Dimensions.member.4.Name"); got != "" {
+			t.Errorf("expected 3 dimensions, got %q", got)
+		}
+	}
+}
+
+func TestPublishChunks(t *testing.T) {
+	server := newFakeCloudWatch()
+	defer server.Close()
+	cfg := testConfig(server.client(), "memory_usage")
+	cfg.maxPending = 5000
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2500; i++ {
+		ref := info.ContainerReference{Name: fmt.Sprintf("/c%d", i)}
+		if err := driver.AddStats(ref, &info.ContainerStats{Timestamp: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	driver.Close()
+	var sizes []int
+	for _, request := range server.received() {
+		n := 0
+		for n < 2000 && request.Get(fmt.Sprintf("MetricData.member.%d.MetricName", n+1)) != "" {
+			n++
+		}
+		sizes = append(sizes, n)
+	}
+	if fmt.Sprint(sizes) != "[1000 1000 500]" {
+		t.Errorf("expected requests of 1000, 1000 and 500 metrics, got %v", sizes)
+	}
+}
+
+func TestMaxPending(t *testing.T) {
+	server := newFakeCloudWatch()
+	defer server.Close()
+	cfg := testConfig(server.client(), "memory_usage")
+	cfg.maxPending = 1
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+
+	for _, name := range []string{"/a", "/b", "/a"} {
+		driver.AddStats(info.ContainerReference{Name: name}, &info.ContainerStats{Timestamp: time.Now()})
+	}
+	driver.lock.Lock()
+	defer driver.lock.Unlock()
+	if len(driver.pending) != 1 || driver.dropped != 1 {
+		t.Errorf("expected 1 metric and 1 dropped sample, got %d and %d", len(driver.pending), driver.dropped)
+	}
+}
+
+func TestNewStorageErrors(t *testing.T) {
+	tooManyLabels := make([]string, 19)
+	for i := range tooManyLabels {
+		tooManyLabels[i] = fmt.Sprintf("label%d", i)
+	}
+	for _, test := range []struct {
+		namespace string
+		metrics   []string
+		labels    []string
+	}{
+		{"", []string{"cpu_usage"}, nil},
+		{"AWS/EC2", []string{"cpu_usage"}, nil},
+		{"cAdvisor", []string{"cpu"}, nil},
+		{"cAdvisor", nil, nil},
+		{"cAdvisor", []string{"cpu_usage"}, []string{"InstanceId"}},
+		{"cAdvisor", []string{"cpu_usage"}, tooManyLabels},
+	} {
+		cfg := testConfig(nil, test.metrics...)
+		cfg.namespace = test.namespace
+		cfg.labels = test.labels
+		cfg.flushInterval = time.Minute
+		if _, err := newStorage(cfg); err == nil {
+			t.Errorf("expected an error for %+v", test)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudwatch
+
+import (
+	"time"
+
+	"github.com/google/cadvisor/storage"
+)
+
+// counterRates returns the rates per second of the counters of a container
+// since its previous stats, so that CloudWatch graphs them without the
+// metric math of a derivative. The counters without a delta, see
+// storage.CounterTracker, have no rate.
+func counterRates(tracker *storage.CounterTracker, containerName string, timestamp time.Time, counters map[string]uint64) map[string]float64 {
+	deltas, elapsed := tracker.Deltas(containerName, timestamp, counters)
+	if len(deltas) == 0 {
+		return nil
+	}
+	ret := make(map[string]float64, len(deltas))
+	for name, delta := range deltas {
+		ret[name] = float64(delta) / elapsed.Seconds()
+	}
+	return ret
+}
@@ -0,0 +1,48 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cloudwatch
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/storage"
+)
+
+func TestRates(t *testing.T) {
+	tracker := storage.NewCounterTracker()
+	start := time.Unix(1451606400, 0)
+
+	for _, test := range []struct {
+		seconds  int
+		counters map[string]uint64
+		expected map[string]float64
+	}{
+		// No rates on the first stats.
+		{0, map[string]uint64{"rx": 100, "tx": 50}, map[string]float64{}},
+		{2, map[string]uint64{"rx": 300, "tx": 50}, map[string]float64{"rx": 100, "tx": 0}},
+		// Out of order.
+		{1, map[string]uint64{"rx": 200, "tx": 50}, nil},
+		// A reset counter, and a new one.
+		{4, map[string]uint64{"rx": 10, "tx": 150, "errors": 1}, map[string]float64{"tx": 50}},
+		{5, map[string]uint64{"rx": 20, "tx": 150, "errors": 1}, map[string]float64{"rx": 10, "tx": 0, "errors": 0}},
+	} {
+		got := counterRates(tracker, "/c", start.Add(time.Duration(test.seconds)*time.Second), test.counters)
+		if len(got) != len(test.expected) || (len(got) > 0 && !reflect.DeepEqual(got, test.expected)) {
+			t.Errorf("at %ds: expected %v, got %v", test.seconds, test.expected, got)
+		}
+	}
+}
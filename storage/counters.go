@@ -0,0 +1,94 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// The previous counters of a container are forgotten once it has not been
+// seen for counterExpiry, e.g. after it was removed.
+const counterExpiry = 10 * time.Minute
+
+// containerCounters are the previous values of the counters of a container.
+type containerCounters struct {
+	timestamp time.Time
+	values    map[string]uint64
+	seen      time.Time
+}
+
+// CounterTracker tracks the previous values of the cumulative counters of
+// the kernel, e.g. the CPU usage, for the storage drivers which send their
+// increase or their rate instead.
+type CounterTracker struct {
+	lock      sync.Mutex
+	counters  map[string]*containerCounters
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewCounterTracker() *CounterTracker {
+	return &CounterTracker{
+		counters: make(map[string]*containerCounters),
+		now:      time.Now,
+	}
+}
+
+// Deltas returns the increase of the counters of a container since its
+// previous stats, and the time elapsed since. There are no deltas for the
+// first stats of a container, nor for stats older than the previous ones.
+// A counter which decreased was reset, e.g. by a restart of the container,
+// and has no delta until the next stats. The tracker keeps the counters,
+// which must not be changed afterwards.
+func (self *CounterTracker) Deltas(containerName string, timestamp time.Time, counters map[string]uint64) (map[string]uint64, time.Duration) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	now := self.now()
+	self.sweep(now)
+	previous, ok := self.counters[containerName]
+	if !ok {
+		previous = &containerCounters{}
+		self.counters[containerName] = previous
+	}
+	previous.seen = now
+	if !timestamp.After(previous.timestamp) {
+		return nil, 0
+	}
+	elapsed := timestamp.Sub(previous.timestamp)
+	ret := make(map[string]uint64, len(counters))
+	for name, value := range counters {
+		if last, found := previous.values[name]; found && value >= last {
+			ret[name] = value - last
+		}
+	}
+	previous.timestamp = timestamp
+	previous.values = counters
+	return ret, elapsed
+}
+
+// sweep forgets the containers not seen for counterExpiry, at most once
+// every counterExpiry. Lock must be held.
+func (self *CounterTracker) sweep(now time.Time) {
+	if now.Sub(self.lastSweep) < counterExpiry {
+		return
+	}
+	self.lastSweep = now
+	for name, counters := range self.counters {
+		if now.Sub(counters.seen) >= counterExpiry {
+			delete(self.counters, name)
+		}
+	}
+}
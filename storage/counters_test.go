@@ -0,0 +1,79 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCounterDeltas(t *testing.T) {
+	tracker := NewCounterTracker()
+	start := time.Unix(1451606400, 0)
+
+	for _, test := range []struct {
+		seconds  int
+		counters map[string]uint64
+		expected map[string]uint64
+		elapsed  time.Duration
+	}{
+		// No deltas on the first stats.
+		{0, map[string]uint64{"rx": 100, "tx": 50}, map[string]uint64{}, 0},
+		{2, map[string]uint64{"rx": 300, "tx": 50}, map[string]uint64{"rx": 200, "tx": 0}, 2 * time.Second},
+		// Out of order.
+		{1, map[string]uint64{"rx": 200, "tx": 50}, nil, 0},
+		// A reset counter, and a new one.
+		{4, map[string]uint64{"rx": 10, "tx": 150, "errors": 1}, map[string]uint64{"tx": 100}, 2 * time.Second},
+		{5, map[string]uint64{"rx": 20, "tx": 150, "errors": 1}, map[string]uint64{"rx": 10, "tx": 0, "errors": 0}, time.Second},
+	} {
+		got, elapsed := tracker.Deltas("/c", start.Add(time.Duration(test.seconds)*time.Second), test.counters)
+		if len(got) != len(test.expected) || (len(got) > 0 && !reflect.DeepEqual(got, test.expected)) {
+			t.Errorf("at %ds: expected %v, got %v", test.seconds, test.expected, got)
+		}
+		if len(got) > 0 && elapsed != test.elapsed {
+			t.Errorf("at %ds: expected %v elapsed, got %v", test.seconds, test.elapsed, elapsed)
+		}
+	}
+}
+
+func TestCounterDeltasPerContainer(t *testing.T) {
+	tracker := NewCounterTracker()
+	now := time.Unix(1451606400, 0)
+	tracker.Deltas("/a", now, map[string]uint64{"rx": 100})
+	tracker.Deltas("/b", now, map[string]uint64{"rx": 1000})
+	if got, _ := tracker.Deltas("/a", now.Add(time.Second), map[string]uint64{"rx": 110}); got["rx"] != 10 {
+		t.Errorf("expected a delta of 10 for /a, got %v", got)
+	}
+}
+
+func TestCounterExpiry(t *testing.T) {
+	tracker := NewCounterTracker()
+	now := time.Unix(1451606400, 0)
+	tracker.now = func() time.Time { return now }
+
+	tracker.Deltas("/removed", now, map[string]uint64{"rx": 1})
+	tracker.Deltas("/c", now, map[string]uint64{"rx": 1})
+	now = now.Add(counterExpiry - time.Second)
+	tracker.Deltas("/c", now, map[string]uint64{"rx": 2})
+	now = now.Add(2 * time.Second)
+	tracker.Deltas("/c", now, map[string]uint64{"rx": 3})
+	if _, ok := tracker.counters["/removed"]; ok {
+		t.Error("expected the counters of the removed container to be forgotten")
+	}
+	if _, ok := tracker.counters["/c"]; !ok {
+		t.Error("expected the counters of the container to be kept")
+	}
+}
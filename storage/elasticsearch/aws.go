@@ -0,0 +1,76 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+// awsSigningTransport signs the requests sent to Amazon Elasticsearch
+// Service domains with AWS Signature Version 4.
+type awsSigningTransport struct {
+	transport http.RoundTripper
+	signer    *v4.Signer
+	region    string
+	service   string
+}
+
+func newAWSSigningTransport(transport http.RoundTripper, creds *credentials.Credentials, region, service string) *awsSigningTransport {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &awsSigningTransport{
+		transport: transport,
+		signer:    v4.NewSigner(creds),
+		region:    region,
+		service:   service,
+	}
+}
+
+func (self *awsSigningTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The signer reads the body to hash it, keep a copy to send it.
+	var body io.ReadSeeker
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	}
+
+	// A RoundTripper must not modify the request it is given.
+	signed := req.WithContext(req.Context())
+	u := *req.URL
+	signed.URL = &u
+	signed.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		signed.Header[k] = v
+	}
+	// The signature replaces any other authorization.
+	signed.Header.Del("Authorization")
+
+	if _, err := self.signer.Sign(signed, body, self.service, self.region, time.Now()); err != nil {
+		return nil, err
+	}
+	return self.transport.RoundTrip(signed)
+}
@@ -0,0 +1,118 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+)
+
+var testAWSCredentials = credentials.NewStaticCredentials("AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "")
+
+// checkAWSSignature checks that the request received by the server was signed
+// for the given body by signing it again.
+func checkAWSSignature(r *http.Request, body []byte) error {
+	authorization := r.Header.Get("Authorization")
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(authorization, "/us-east-1/es/aws4_request") {
+		return fmt.Errorf("unexpected authorization %q", authorization)
+	}
+	signTime, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+	if err != nil {
+		return err
+	}
+	signedHeaders := authorization[strings.Index(authorization, "SignedHeaders=")+len("SignedHeaders="):]
+	signedHeaders = strings.SplitN(signedHeaders, ",", 2)[0]
+	for _, header := range strings.Split(signedHeaders, ";") {
+		if header != "host" {
+			req.Header[http.CanonicalHeaderKey(header)] = r.Header[http.CanonicalHeaderKey(header)]
+		}
+	}
+	if _, err := v4.NewSigner(testAWSCredentials).Sign(req, bytes.NewReader(body), "es", "us-east-1", signTime); err != nil {
+		return err
+	}
+	if expected := req.Header.Get("Authorization"); authorization != expected {
+		return fmt.Errorf("expected authorization %q, got %q", expected, authorization)
+	}
+	return nil
+}
+
+func TestAWSSignedRequests(t *testing.T) {
+	es := &fakeElasticsearch{}
+	var lock sync.Mutex
+	var signatureErrors []error
+	signed := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		lock.Lock()
+		if err := checkAWSSignature(r, body); err != nil {
+			signatureErrors = append(signatureErrors, fmt.Errorf("%s %s: %v", r.Method, r.URL, err))
+		} else if len(body) > 0 {
+			// A signature for a different body must not match.
+			if checkAWSSignature(r, append(body, ' ')) == nil {
+				signatureErrors = append(signatureErrors, fmt.Errorf("%s %s: signature does not depend on the body", r.Method, r.URL))
+			}
+			signed++
+		}
+		lock.Unlock()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		es.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	// The username is ignored when signing requests.
+	options, err := connectionOptions("cadvisor", "secret", "", "", "", false, testAWSCredentials, "us-east-1", "es", gzip.NoCompression, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver, err := newStorage(testConfig(server.URL), options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestStats(t, driver, 2)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if bulks := es.bulkRequests(); len(bulks) != 1 {
+		t.Errorf("expected 1 bulk request, got %d", len(bulks))
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	for _, err := range signatureErrors {
+		t.Error(err)
+	}
+	if signed == 0 {
+		t.Error("expected a signed request with a body")
+	}
+}
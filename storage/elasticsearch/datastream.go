@@ -0,0 +1,111 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// Priority of the index template of the data stream, above the one of the
+// built-in templates, e.g. metrics-*-*.
+const dataStreamTemplatePriority = 200
+
+// supportsDataStreams returns whether an ElasticSearch version number such as
+// "7.10.2" is at least 7.9, the first version with data streams.
+func supportsDataStreams(number string) bool {
+	parts := strings.SplitN(number, ".", 3)
+	major := majorVersion(number)
+	if major != 7 || len(parts) < 2 {
+		return major > 7
+	}
+	minor, err := strconv.Atoi(parts[1])
+	return err == nil && minor >= 9
+}
+
+// dataStreamTemplate returns a composable index template enabling the data
+// stream and applying the mapping of the documents written by the driver to
+// its backing indices.
+func dataStreamTemplate(dataStream, schema string, esMajorVersion int) map[string]interface{} {
+	return map[string]interface{}{
+		"index_patterns": []string{dataStream},
+		"data_stream":    map[string]interface{}{},
+		"priority":       dataStreamTemplatePriority,
+		"template": map[string]interface{}{
+			"mappings": indexTemplate(dataStream, "", schema, esMajorVersion)["mappings"],
+		},
+	}
+}
+
+// installDataStreamTemplate installs the index template of the data stream.
+// Failing to do so is not fatal since the data stream may be matched by
+// another template.
+func (self *elasticStorage) installDataStreamTemplate() {
+	body := dataStreamTemplate(self.dataStream, self.schema, self.esMajorVersion)
+	_, err := self.client.PerformRequest("PUT", "/_index_template/"+self.dataStream, nil, body)
+	if err == nil {
+		return
+	}
+	if isForbidden(err) {
+		glog.Warningf("not allowed to install the ElasticSearch index template %q, skipping it - %s", self.dataStream, err)
+		return
+	}
+	glog.Warningf("failed to install the ElasticSearch index template %q - %s", self.dataStream, err)
+}
+
+// dataStreamExists returns whether the data stream exists.
+func (self *elasticStorage) dataStreamExists() (bool, error) {
+	res, err := self.client.PerformRequest("GET", "/_data_stream/"+self.dataStream, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	return res.StatusCode == http.StatusOK, nil
+}
+
+// ensureDataStream creates the data stream unless it already exists.
+// ElasticSearch only creates it if an index template enables it.
+func (self *elasticStorage) ensureDataStream() error {
+	exists, err := self.dataStreamExists()
+	if isForbidden(err) {
+		// Writing to the data stream may be allowed even though reading
+		// it is not.
+		glog.Warningf("not allowed to check the ElasticSearch data stream %q, assuming it exists - %s", self.dataStream, err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check the elasticsearch data stream %q - %s", self.dataStream, err)
+	}
+	if exists {
+		return nil
+	}
+
+	_, err = self.client.PerformRequestWithoutRetries("PUT", "/_data_stream/"+self.dataStream, nil, nil)
+	if err == nil {
+		glog.Infof("created ElasticSearch data stream %q", self.dataStream)
+		return nil
+	}
+	// Another cAdvisor may have created the data stream in the meantime.
+	if exists, _ := self.dataStreamExists(); exists {
+		return nil
+	}
+	if isForbidden(err) {
+		return fmt.Errorf("not allowed to create the elasticsearch data stream %q, create it or grant the create_index privilege - %s", self.dataStream, err)
+	}
+	return fmt.Errorf("failed to create the elasticsearch data stream %q, it requires an index template enabling data streams, see -storage_driver_es_install_template - %s", self.dataStream, err)
+}
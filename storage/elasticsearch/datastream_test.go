@@ -0,0 +1,170 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Responses of an ElasticSearch 7.10 cluster recorded for the data stream
+// requests of the driver.
+var (
+	dataStreamFound      = fixtureResponse{http.StatusOK, `{"data_streams":[{"name":"cadvisor","timestamp_field":{"name":"@timestamp"},"indices":[{"index_name":".ds-cadvisor-000001","index_uuid":"aTk0"}],"generation":1,"status":"GREEN","template":"cadvisor"}]}`}
+	dataStreamMissing    = fixtureResponse{http.StatusNotFound, `{"error":{"root_cause":[{"type":"index_not_found_exception","reason":"no such index [cadvisor]"}],"type":"index_not_found_exception","reason":"no such index [cadvisor]"},"status":404}`}
+	dataStreamCreated    = fixtureResponse{http.StatusOK, `{"acknowledged":true}`}
+	noDataStreamTemplate = fixtureResponse{http.StatusBadRequest, `{"error":{"root_cause":[{"type":"illegal_argument_exception","reason":"no matching index template found for data stream [cadvisor]"}],"type":"illegal_argument_exception","reason":"no matching index template found for data stream [cadvisor]"},"status":400}`}
+	forbiddenDataStream  = fixtureResponse{http.StatusForbidden, `{"error":{"root_cause":[{"type":"security_exception","reason":"action [indices:admin/data_stream/create] is unauthorized for user [cadvisor]"}],"type":"security_exception","reason":"action [indices:admin/data_stream/create] is unauthorized for user [cadvisor]"},"status":403}`}
+	dataStreamBulk       = fixtureResponse{http.StatusOK, `{"took":5,"errors":false,"items":[{"create":{"_index":".ds-cadvisor-000001","_id":"1","status":201}},{"create":{"_index":".ds-cadvisor-000001","_id":"2","status":201}}]}`}
+)
+
+func newDataStreamTestStorage(es *fixtureElasticsearch, installTemplate bool) (*elasticStorage, func(), error) {
+	if es.version == "" {
+		es.version = "7.10.2"
+	}
+	server := httptest.NewServer(es)
+	driver, err := newStorage(testConfig(server.URL, func(cfg *config) {
+		cfg.dataStream = "cadvisor"
+		cfg.installTemplate = installTemplate
+	}))
+	if err != nil {
+		server.Close()
+		return nil, nil, err
+	}
+	return driver, server.Close, nil
+}
+
+func TestDataStreamDocumentsAreCreated(t *testing.T) {
+	es := &fixtureElasticsearch{responses: map[string][]fixtureResponse{
+		"GET /_data_stream/cadvisor": {dataStreamFound},
+		"POST /_bulk":                {dataStreamBulk},
+	}}
+	driver, closeServer, err := newDataStreamTestStorage(es, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeServer()
+
+	addTestStats(t, driver, 2)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(es.bodies["POST /_bulk"]), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 2 documents to be sent, got %q", lines)
+	}
+	for i := 0; i < len(lines); i += 2 {
+		if lines[i] != `{"create":{"_index":"cadvisor"}}` {
+			t.Errorf("unexpected bulk action %s", lines[i])
+		}
+		var doc map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[i+1]), &doc); err != nil {
+			t.Fatal(err)
+		}
+		timestamp, ok := doc["@timestamp"].(string)
+		if !ok {
+			t.Errorf("expected the document to have a @timestamp, got %s", lines[i+1])
+		} else if _, err := time.Parse(time.RFC3339, timestamp); err != nil {
+			t.Errorf("expected the @timestamp to be RFC3339: %v", err)
+		}
+		if _, ok := doc["timestamp"]; ok {
+			t.Errorf("expected the timestamp to be renamed, got %s", lines[i+1])
+		}
+	}
+	if driver.Dropped() != 0 {
+		t.Errorf("expected no dropped documents, got %d", driver.Dropped())
+	}
+}
+
+func TestDataStreamIsCreated(t *testing.T) {
+	es := &fixtureElasticsearch{responses: map[string][]fixtureResponse{
+		"PUT /_index_template/cadvisor": {{http.StatusOK, `{"acknowledged":true}`}},
+		"GET /_data_stream/cadvisor":    {dataStreamMissing},
+		"PUT /_data_stream/cadvisor":    {dataStreamCreated},
+	}}
+	driver, closeServer, err := newDataStreamTestStorage(es, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeServer()
+	driver.Close()
+
+	expected := []string{"PUT /_index_template/cadvisor", "GET /_data_stream/cadvisor", "PUT /_data_stream/cadvisor"}
+	if requests := es.recordedRequests(); !reflect.DeepEqual(requests, expected) {
+		t.Errorf("expected requests %v, got %v", expected, requests)
+	}
+	var template map[string]interface{}
+	if err := json.Unmarshal([]byte(es.bodies["PUT /_index_template/cadvisor"]), &template); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := template["data_stream"]; !ok {
+		t.Errorf("expected the template to enable the data stream, got %v", template)
+	}
+	mapping := mappingAt(template["template"].(map[string]interface{})["mappings"].(map[string]interface{}), "@timestamp")
+	if !reflect.DeepEqual(mapping, map[string]interface{}{"type": "date"}) {
+		t.Errorf("expected @timestamp to be mapped as a date, got %v", mapping)
+	}
+}
+
+func TestDataStreamCannotBeCreated(t *testing.T) {
+	for _, tc := range []struct {
+		response fixtureResponse
+		expected string
+	}{
+		{forbiddenDataStream, "not allowed to create"},
+		{noDataStreamTemplate, "requires an index template"},
+	} {
+		es := &fixtureElasticsearch{responses: map[string][]fixtureResponse{
+			"GET /_data_stream/cadvisor": {dataStreamMissing},
+			"PUT /_data_stream/cadvisor": {tc.response},
+		}}
+		_, _, err := newDataStreamTestStorage(es, false)
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("expected an error containing %q, got %v", tc.expected, err)
+		}
+	}
+}
+
+func TestDataStreamsRequireRecentClusters(t *testing.T) {
+	es := &fixtureElasticsearch{version: "7.8.1"}
+	_, _, err := newDataStreamTestStorage(es, false)
+	if err == nil || !strings.Contains(err.Error(), "require version 7.9") {
+		t.Errorf("expected an error about the cluster version, got %v", err)
+	}
+	if requests := es.recordedRequests(); len(requests) != 0 {
+		t.Errorf("expected no data stream request, got %v", requests)
+	}
+}
+
+func TestSupportsDataStreams(t *testing.T) {
+	for number, expected := range map[string]bool{
+		"6.8.0":  false,
+		"7.8.1":  false,
+		"7.9.0":  true,
+		"7.10.2": true,
+		"8.1.0":  true,
+		"7":      false,
+		"":       false,
+	} {
+		if actual := supportsDataStreams(number); actual != expected {
+			t.Errorf("expected data streams support of %q to be %v, got %v", number, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Number of rejected documents waiting to be written to the dead-letter file.
+// More are dropped so that flushes never wait for the file.
+const deadLetterQueueSize = 1000
+
+// isPermanentFailure returns whether a bulk item failed with a status that
+// retrying will not change, e.g. a mapping conflict. Too many requests are
+// retried.
+func isPermanentFailure(status int) bool {
+	return status >= 400 && status <= 499 && status != http.StatusTooManyRequests
+}
+
+// rejectedDoc is a document ElasticSearch refused to index for good.
+type rejectedDoc struct {
+	doc    *pendingDoc
+	status int
+	// Error of the bulk item, a string before ElasticSearch 5.0 and an
+	// object since.
+	reason json.RawMessage
+}
+
+// deadLetter is a line of the dead-letter file.
+type deadLetter struct {
+	Timestamp time.Time       `json:"timestamp"`
+	Index     string          `json:"index"`
+	Id        string          `json:"id,omitempty"`
+	Container string          `json:"container"`
+	Status    int             `json:"status"`
+	Error     json.RawMessage `json:"error,omitempty"`
+	Document  interface{}     `json:"document"`
+}
+
+// deadLetterFile appends the rejected documents to a file as NDJSON, in the
+// background. The file is renamed with a .1 suffix, replacing the previous
+// one, once it reaches maxSize bytes.
+type deadLetterFile struct {
+	path    string
+	maxSize int64
+	file    *os.File
+	size    int64
+	queue   chan rejectedDoc
+	// Number of documents written to the file.
+	written uint64
+	// Number of documents that could not be written to the file.
+	lost uint64
+	wg   sync.WaitGroup
+}
+
+func newDeadLetterFile(path string, maxSize int64) (*deadLetterFile, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("invalid elasticsearch dead-letter file size %d", maxSize)
+	}
+	ret := &deadLetterFile{
+		path:    path,
+		maxSize: maxSize,
+		queue:   make(chan rejectedDoc, deadLetterQueueSize),
+	}
+	if err := ret.open(); err != nil {
+		return nil, fmt.Errorf("failed to open the elasticsearch dead-letter file %q - %s", path, err)
+	}
+	ret.wg.Add(1)
+	go ret.writer()
+	return ret, nil
+}
+
+func (self *deadLetterFile) open() error {
+	file, err := os.OpenFile(self.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	self.file = file
+	self.size = fileInfo.Size()
+	return nil
+}
+
+// add queues a rejected document without waiting for the file. It is lost if
+// the queue is full.
+func (self *deadLetterFile) add(rejected rejectedDoc) {
+	select {
+	case self.queue <- rejected:
+	default:
+		total := atomic.AddUint64(&self.lost, 1)
+		glog.Warningf("dead-letter queue is full, lost the stats of container %q rejected by ElasticSearch (%d lost in total)", rejected.doc.container, total)
+	}
+}
+
+func (self *deadLetterFile) writer() {
+	defer self.wg.Done()
+	for rejected := range self.queue {
+		if err := self.write(rejected); err != nil {
+			total := atomic.AddUint64(&self.lost, 1)
+			glog.Errorf("failed to write the stats of container %q rejected by ElasticSearch to the dead-letter file (%d lost in total) - %s", rejected.doc.container, total, err)
+			continue
+		}
+		atomic.AddUint64(&self.written, 1)
+	}
+	if self.file != nil {
+		self.file.Close()
+	}
+}
+
+func (self *deadLetterFile) write(rejected rejectedDoc) error {
+	line, err := json.Marshal(&deadLetter{
+		Timestamp: time.Now().UTC(),
+		Index:     rejected.doc.index,
+		Id:        rejected.doc.id,
+		Container: rejected.doc.container,
+		Status:    rejected.status,
+		Error:     rejected.reason,
+		Document:  rejected.doc.detail,
+	})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if self.file != nil && self.size > 0 && self.size+int64(len(line)) > self.maxSize {
+		self.file.Close()
+		self.file = nil
+		if err := os.Rename(self.path, self.path+".1"); err != nil {
+			glog.Errorf("failed to rotate the dead-letter file %q - %s", self.path, err)
+		}
+	}
+	if self.file == nil {
+		// Reopened after a rotation or a failed write.
+		if err := self.open(); err != nil {
+			return err
+		}
+	}
+	n, err := self.file.Write(line)
+	self.size += int64(n)
+	if err != nil {
+		self.file.Close()
+		self.file = nil
+		return err
+	}
+	return nil
+}
+
+// close writes the queued documents and closes the file. No document may be
+// added afterwards.
+func (self *deadLetterFile) close() {
+	close(self.queue)
+	self.wg.Wait()
+}
+
+// DeadLettered returns the number of documents rejected by ElasticSearch that
+// were written to the dead-letter file.
+func (self *elasticStorage) DeadLettered() uint64 {
+	if self.deadLetters == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&self.deadLetters.written)
+}
+
+// reject writes the documents rejected by ElasticSearch to the dead-letter
+// file, or drops them if there is none.
+func (self *elasticStorage) reject(rejected []rejectedDoc) {
+	for _, r := range rejected {
+		if self.deadLetters != nil {
+			self.deadLetters.add(r)
+			continue
+		}
+		total := atomic.AddUint64(&self.dropped, 1)
+		glog.Warningf("dropped stats of container %q rejected by ElasticSearch with status %d (%d dropped in total) - %s", r.doc.container, r.status, total, r.reason)
+	}
+}
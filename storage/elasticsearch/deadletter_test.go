@@ -0,0 +1,199 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// A bulk response where the first document is indexed, the second one is
+// rejected because of a mapping conflict and the third one is throttled.
+const partiallyRejectedBulk = `{"took":3,"errors":true,"items":[` +
+	`{"index":{"_index":"cadvisor","_id":"1","status":201}},` +
+	`{"index":{"_index":"cadvisor","_id":"2","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse field [container_stats.memory.usage] of type [long]"}}},` +
+	`{"index":{"_index":"cadvisor","_id":"3","status":429,"error":{"type":"es_rejected_execution_exception","reason":"rejected execution of bulk"}}}]}`
+
+func newDeadLetterTestStorage(t *testing.T, es *fixtureElasticsearch, deadLetters *deadLetterFile) (*elasticStorage, func()) {
+	server := httptest.NewServer(es)
+	driver, err := newStorage(testConfig(server.URL, func(cfg *config) {
+		cfg.deadLetters = deadLetters
+	}))
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return driver, server.Close
+}
+
+func readDeadLetters(t *testing.T, path string) []map[string]interface{} {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var ret []map[string]interface{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("invalid dead-letter line %q: %v", scanner.Text(), err)
+		}
+		ret = append(ret, line)
+	}
+	return ret
+}
+
+func TestRejectedDocumentsAreDeadLettered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cadvisor-es")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rejected.ndjson")
+	deadLetters, err := newDeadLetterFile(path, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	es := &fixtureElasticsearch{responses: map[string][]fixtureResponse{
+		"POST /_bulk": {
+			{http.StatusOK, partiallyRejectedBulk},
+			{http.StatusOK, `{"took":1,"errors":false,"items":[{"index":{"_index":"cadvisor","_id":"3","status":201}}]}`},
+		},
+	}}
+	driver, closeServer := newDeadLetterTestStorage(t, es, deadLetters)
+	defer closeServer()
+
+	addTestStats(t, driver, 3)
+	driver.flush()
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the throttled document is retried.
+	bulks := 0
+	for _, request := range es.requests {
+		if request == "POST /_bulk" {
+			bulks++
+		}
+	}
+	if bulks != 2 {
+		t.Errorf("expected 2 bulk requests, got %d", bulks)
+	}
+	if driver.Dropped() != 0 {
+		t.Errorf("expected no dropped documents, got %d", driver.Dropped())
+	}
+	if driver.DeadLettered() != 1 {
+		t.Errorf("expected 1 dead-lettered document, got %d", driver.DeadLettered())
+	}
+
+	lines := readDeadLetters(t, path)
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 dead letter, got %d", len(lines))
+	}
+	line := lines[0]
+	if line["status"] != float64(http.StatusBadRequest) || line["index"] != "cadvisor" || line["container"] != "/test" {
+		t.Errorf("unexpected dead letter %v", line)
+	}
+	if reason, _ := line["error"].(map[string]interface{}); reason["type"] != "mapper_parsing_exception" {
+		t.Errorf("expected the mapping error, got %v", line["error"])
+	}
+	document, _ := line["document"].(map[string]interface{})
+	if stats, _ := document["container_stats"].(map[string]interface{}); stats["memory"].(map[string]interface{})["usage"] != float64(1) {
+		t.Errorf("expected the rejected document, got %v", line["document"])
+	}
+}
+
+func TestRejectedDocumentsAreDroppedWithoutDeadLetterFile(t *testing.T) {
+	es := &fixtureElasticsearch{responses: map[string][]fixtureResponse{
+		"POST /_bulk": {
+			{http.StatusOK, `{"took":1,"errors":true,"items":[{"index":{"_index":"cadvisor","status":400,"error":"MapperParsingException[failed to parse [container_stats.memory.usage]]"}}]}`},
+		},
+	}}
+	driver, closeServer := newDeadLetterTestStorage(t, es, nil)
+	defer closeServer()
+
+	addTestStats(t, driver, 1)
+	driver.Close()
+	if len(es.requests) != 1 {
+		t.Errorf("expected the rejected document not to be retried, got requests %v", es.requests)
+	}
+	if driver.Dropped() != 1 {
+		t.Errorf("expected 1 dropped document, got %d", driver.Dropped())
+	}
+	if driver.DeadLettered() != 0 {
+		t.Errorf("expected no dead-lettered document, got %d", driver.DeadLettered())
+	}
+}
+
+func TestDeadLetterFileRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cadvisor-es")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rejected.ndjson")
+	deadLetters, err := newDeadLetterFile(path, 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		deadLetters.add(rejectedDoc{
+			doc:    &pendingDoc{index: "cadvisor", container: "/test", detail: map[string]int{"i": i}},
+			status: http.StatusBadRequest,
+			reason: json.RawMessage(`"MapperParsingException[failed to parse]"`),
+		})
+	}
+	deadLetters.close()
+
+	current := readDeadLetters(t, path)
+	previous := readDeadLetters(t, path+".1")
+	if len(current) == 0 || len(previous) == 0 {
+		t.Fatalf("expected dead letters in both files, got %d and %d", len(current), len(previous))
+	}
+	if fileInfo, err := os.Stat(path); err != nil || fileInfo.Size() > 512 {
+		t.Errorf("expected the dead-letter file to be rotated before exceeding 512 bytes, got %v (%v)", fileInfo.Size(), err)
+	}
+	// The latest documents are in the current file.
+	last := current[len(current)-1]["document"].(map[string]interface{})
+	if last["i"] != float64(9) {
+		t.Errorf("expected the last document in the current file, got %v", last)
+	}
+	if written := atomic.LoadUint64(&deadLetters.written); written != 10 {
+		t.Errorf("expected 10 dead letters written, got %d", written)
+	}
+}
+
+func TestDeadLetterFileCannotBeOpened(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cadvisor-es")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := newDeadLetterFile(dir, 1<<20); err == nil {
+		t.Error("expected an error for a directory")
+	}
+	if _, err := newDeadLetterFile(filepath.Join(dir, "rejected.ndjson"), 0); err == nil {
+		t.Error("expected an error for an invalid size")
+	}
+}
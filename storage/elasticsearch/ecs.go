@@ -0,0 +1,193 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// Supported values of -storage_driver_es_schema.
+const (
+	// Stats nested under container_stats, as serialized by cAdvisor.
+	schemaCadvisor = "cadvisor"
+	// Elastic Common Schema fields, the stats without ECS equivalent being
+	// nested under cadvisor.
+	schemaECS = "ecs"
+)
+
+// CPU usage samples older than this are forgotten, e.g. once their container
+// is gone.
+const cpuSampleExpiry = 10 * time.Minute
+
+// cpuSample is the cumulative CPU usage of a container at a point in time.
+type cpuSample struct {
+	total     uint64
+	timestamp time.Time
+}
+
+// ecsDocument returns the ECS document holding the stats of a container. Its
+// field names are dotted paths, which ElasticSearch expands into objects.
+//
+// container.cpu.usage is the fraction of the CPUs used by the container since
+// its previous sample, and is left out of its first document.
+// container.memory.usage is in bytes since the memory limit of the container
+// is not part of its stats.
+func (self *elasticStorage) ecsDocument(ref info.ContainerReference, stats *info.ContainerStats, containerName string) map[string]interface{} {
+	doc := map[string]interface{}{
+		"@timestamp":     stats.Timestamp.UTC(),
+		"event.kind":     "metric",
+		"event.ingested": time.Now().UTC(),
+		"container.name": containerName,
+		"host.name":      self.machineName,
+	}
+	if ref.Id != "" {
+		doc["container.id"] = ref.Id
+	}
+	if self.sharesMachineIndex() {
+		doc["kind"] = kindContainer
+	}
+	if self.enrichment != nil {
+		doc["host.name"] = self.enrichment.hostName
+		if len(self.enrichment.labels) > 0 {
+			doc["labels"] = self.enrichment.labels
+		}
+		setIfNotEmpty(doc, "kubernetes.pod.name", ref.Labels[kubernetesPodNameLabel])
+		setIfNotEmpty(doc, "kubernetes.namespace", ref.Labels[kubernetesNamespaceLabel])
+		setIfNotEmpty(doc, "kubernetes.container.name", ref.Labels[kubernetesContainerNameLabel])
+	}
+
+	indexed := self.metrics.filter(stats)
+	if indexed.Cpu != nil {
+		if usage, ok := self.cpuUsage(ref.Name, stats); ok {
+			doc["container.cpu.usage"] = usage
+		}
+		doc["cadvisor.cpu"] = indexed.Cpu
+	}
+	if indexed.Memory != nil {
+		doc["container.memory.usage"] = indexed.Memory.Usage
+		doc["cadvisor.memory"] = indexed.Memory
+	}
+	if indexed.Network != nil {
+		doc["container.network.ingress.bytes"] = indexed.Network.RxBytes
+		doc["container.network.egress.bytes"] = indexed.Network.TxBytes
+		doc["cadvisor.network"] = indexed.Network
+	}
+	if indexed.DiskIo != nil {
+		read, write := diskIoBytes(indexed.DiskIo)
+		doc["container.disk.read.bytes"] = read
+		doc["container.disk.write.bytes"] = write
+		doc["cadvisor.diskio"] = indexed.DiskIo
+	}
+	if indexed.Filesystem != nil {
+		doc["cadvisor.filesystem"] = indexed.Filesystem
+	}
+	if indexed.TaskStats != nil {
+		doc["cadvisor.task_stats"] = indexed.TaskStats
+	}
+	if indexed.CustomMetrics != nil {
+		doc["cadvisor.custom_metrics"] = indexed.CustomMetrics
+	}
+	return doc
+}
+
+func setIfNotEmpty(doc map[string]interface{}, field, value string) {
+	if value != "" {
+		doc[field] = value
+	}
+}
+
+// cpuUsage returns the fraction of the CPUs used by a container since its
+// previous sample, and whether there is one. Must be called with self.lock
+// held.
+func (self *elasticStorage) cpuUsage(containerName string, stats *info.ContainerStats) (float64, bool) {
+	previous, ok := self.cpuSamples[containerName]
+	self.cpuSamples[containerName] = cpuSample{stats.Cpu.Usage.Total, stats.Timestamp}
+	elapsed := stats.Timestamp.Sub(previous.timestamp)
+	if !ok || elapsed <= 0 || stats.Cpu.Usage.Total < previous.total {
+		return 0, false
+	}
+	cpus := len(stats.Cpu.Usage.PerCpu)
+	if cpus == 0 {
+		cpus = 1
+	}
+	return float64(stats.Cpu.Usage.Total-previous.total) / float64(elapsed.Nanoseconds()) / float64(cpus), true
+}
+
+// expireCpuSamples forgets the CPU usage samples older than cpuSampleExpiry.
+// Must be called with self.lock held.
+func (self *elasticStorage) expireCpuSamples(now time.Time) {
+	for name, sample := range self.cpuSamples {
+		if now.Sub(sample.timestamp) > cpuSampleExpiry {
+			delete(self.cpuSamples, name)
+		}
+	}
+}
+
+// diskIoBytes returns the bytes read and written on all the devices.
+func diskIoBytes(diskIo *info.DiskIoStats) (uint64, uint64) {
+	var read, write uint64
+	for _, device := range diskIo.IoServiceBytes {
+		read += device.Stats["Read"]
+		write += device.Stats["Write"]
+	}
+	return read, write
+}
+
+// ecsMapping returns the mapping of the ECS documents.
+func ecsMapping(esMajorVersion int) map[string]interface{} {
+	date := map[string]interface{}{"type": "date"}
+	long := map[string]interface{}{"type": "long"}
+	keyword := keywordMapping(esMajorVersion)
+	fields := map[string]interface{}{
+		"@timestamp":                      date,
+		"event.kind":                      keyword,
+		"event.ingested":                  date,
+		"container.id":                    keyword,
+		"container.name":                  keyword,
+		"host.name":                       keyword,
+		"kubernetes.pod.name":             keyword,
+		"kubernetes.namespace":            keyword,
+		"kubernetes.container.name":       keyword,
+		"container.cpu.usage":             map[string]interface{}{"type": "scaled_float", "scaling_factor": 1000},
+		"container.memory.usage":          long,
+		"container.network.ingress.bytes": long,
+		"container.network.egress.bytes":  long,
+		"container.disk.read.bytes":       long,
+		"container.disk.write.bytes":      long,
+		"cadvisor":                        typeMapping(reflect.TypeOf(indexedStats{}), esMajorVersion),
+	}
+	// Timestamps of the stats are in @timestamp.
+	delete(fields["cadvisor"].(map[string]interface{})["properties"].(map[string]interface{}), "timestamp")
+
+	properties := make(map[string]interface{})
+	for field, mapping := range fields {
+		path := strings.Split(field, ".")
+		parent := properties
+		for _, name := range path[:len(path)-1] {
+			object, ok := parent[name].(map[string]interface{})
+			if !ok {
+				object = map[string]interface{}{"properties": make(map[string]interface{})}
+				parent[name] = object
+			}
+			parent = object["properties"].(map[string]interface{})
+		}
+		parent[path[len(path)-1]] = mapping
+	}
+	return properties
+}
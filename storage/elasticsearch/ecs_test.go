@@ -0,0 +1,186 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// serializedFields returns the JSON serialization of doc, decoded, along with
+// its top-level fields, sorted.
+func serializedFields(t *testing.T, doc interface{}) (map[string]interface{}, []string) {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ret map[string]interface{}
+	if err := json.Unmarshal(b, &ret); err != nil {
+		t.Fatal(err)
+	}
+	var fields []string
+	for field := range ret {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return ret, fields
+}
+
+func newSchemaTestStorage(schema string) *elasticStorage {
+	return &elasticStorage{
+		machineName: "node-1",
+		schema:      schema,
+		cpuSamples:  make(map[string]cpuSample),
+	}
+}
+
+func TestCadvisorSchemaFields(t *testing.T) {
+	driver := newSchemaTestStorage(schemaCadvisor)
+	ref := info.ContainerReference{Id: "abcd", Name: "/docker/abcd", Aliases: []string{"web"}}
+	doc, fields := serializedFields(t, driver.containerStatsAndDefaultValues(ref, testStats()))
+	if expected := []string{"container_Name", "container_stats", "machine_name", "timestamp"}; !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected the fields %v, got %v", expected, fields)
+	}
+	_, fields = serializedFields(t, doc["container_stats"])
+	if expected := []string{"cpu", "custom_metrics", "diskio", "filesystem", "memory", "network", "task_stats", "timestamp"}; !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected the container_stats fields %v, got %v", expected, fields)
+	}
+}
+
+func TestECSSchemaFields(t *testing.T) {
+	driver := newSchemaTestStorage(schemaECS)
+	ref := info.ContainerReference{Id: "abcd", Name: "/docker/abcd", Aliases: []string{"web"}}
+	previous := testStats()
+	previous.Timestamp = previous.Timestamp.Add(-time.Second)
+	previous.Cpu.Usage.Total = 0
+	driver.ecsDocument(ref, previous, "web")
+
+	stats := testStats()
+	stats.Cpu.Usage.Total = 1000000000
+	stats.DiskIo.IoServiceBytes = []info.PerDiskStats{
+		{Major: 8, Stats: map[string]uint64{"Read": 100, "Write": 10}},
+		{Major: 8, Minor: 16, Stats: map[string]uint64{"Read": 200, "Write": 20}},
+	}
+	stats.Network.TxBytes = 20
+	doc, fields := serializedFields(t, driver.ecsDocument(ref, stats, "web"))
+	expected := []string{
+		"@timestamp",
+		"cadvisor.cpu",
+		"cadvisor.custom_metrics",
+		"cadvisor.diskio",
+		"cadvisor.filesystem",
+		"cadvisor.memory",
+		"cadvisor.network",
+		"cadvisor.task_stats",
+		"container.cpu.usage",
+		"container.disk.read.bytes",
+		"container.disk.write.bytes",
+		"container.id",
+		"container.memory.usage",
+		"container.name",
+		"container.network.egress.bytes",
+		"container.network.ingress.bytes",
+		"event.ingested",
+		"event.kind",
+		"host.name",
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected the fields %v, got %v", expected, fields)
+	}
+
+	values := map[string]interface{}{
+		"@timestamp":     "2016-05-17T12:00:00Z",
+		"container.id":   "abcd",
+		"container.name": "web",
+		"host.name":      "node-1",
+		"event.kind":     "metric",
+		// One second of CPU time on two CPUs in one second.
+		"container.cpu.usage":             0.5,
+		"container.memory.usage":          float64(0),
+		"container.network.ingress.bytes": float64(10),
+		"container.network.egress.bytes":  float64(20),
+		"container.disk.read.bytes":       float64(300),
+		"container.disk.write.bytes":      float64(30),
+	}
+	for field, value := range values {
+		if !reflect.DeepEqual(doc[field], value) {
+			t.Errorf("expected %s to be %v, got %v", field, value, doc[field])
+		}
+	}
+	if _, err := time.Parse(time.RFC3339, doc["event.ingested"].(string)); err != nil {
+		t.Errorf("expected event.ingested to be a timestamp: %v", err)
+	}
+	if _, ok := doc["cadvisor.memory"].(map[string]interface{})["working_set"]; !ok {
+		t.Errorf("expected the memory stats under cadvisor.memory, got %v", doc["cadvisor.memory"])
+	}
+}
+
+func TestECSSchemaSelectedMetrics(t *testing.T) {
+	driver := newSchemaTestStorage(schemaECS)
+	if err := driver.metrics.Set("memory"); err != nil {
+		t.Fatal(err)
+	}
+	driver.enrichment = &enrichment{hostName: "node-2", labels: map[string]string{"cluster": "prod"}}
+	doc, fields := serializedFields(t, driver.ecsDocument(kubernetesRef, testStats(), "web"))
+	expected := []string{
+		"@timestamp",
+		"cadvisor.memory",
+		"container.memory.usage",
+		"container.name",
+		"event.ingested",
+		"event.kind",
+		"host.name",
+		"kubernetes.container.name",
+		"kubernetes.namespace",
+		"kubernetes.pod.name",
+		"labels",
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected the fields %v, got %v", expected, fields)
+	}
+	if doc["host.name"] != "node-2" {
+		t.Errorf("expected the node name as host.name, got %v", doc["host.name"])
+	}
+}
+
+func TestECSMapping(t *testing.T) {
+	template := indexTemplate("cadvisor", "", schemaECS, 7)
+	mapping := template["mappings"].(map[string]interface{})
+	for path, expected := range map[string]string{
+		"@timestamp":                 "date",
+		"event.ingested":             "date",
+		"container.name":             "keyword",
+		"container.cpu.usage":        "scaled_float",
+		"container.memory.usage":     "long",
+		"kubernetes.pod.name":        "keyword",
+		"cadvisor.memory.usage":      "long",
+		"cadvisor.filesystem.device": "keyword",
+	} {
+		if actual := mappingAt(mapping, path); actual["type"] != expected {
+			t.Errorf("expected %s to be mapped as %s, got %v", path, expected, actual)
+		}
+	}
+	if mappingAt(mapping, "cadvisor.timestamp") != nil {
+		t.Error("expected the stats timestamp not to be mapped")
+	}
+	if mappingAt(mapping, "container_stats") != nil {
+		t.Error("expected the cadvisor schema fields not to be mapped")
+	}
+}
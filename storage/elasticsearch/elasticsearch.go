@@ -15,42 +15,178 @@
 package elasticsearch
 
 import (
+	"compress/gzip"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"os"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	info "github.com/google/cadvisor/info/v1"
 	storage "github.com/google/cadvisor/storage"
 
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/defaults"
+	"github.com/golang/glog"
 	"gopkg.in/olivere/elastic.v2"
 )
 
 func init() {
 	storage.RegisterStorageDriver("elasticsearch", new)
+	flag.Var(&argMetrics, "storage_driver_es_metrics", "comma-separated list of the stat groups indexed in ElasticSearch, all of them if empty. Options are 'cpu', 'percpu', 'memory', 'network', 'diskio', 'filesystem', 'tasks' and 'custom'. The per-cpu usage is only indexed along with 'cpu'.")
+	flag.Var(&argStaticLabels, "storage_driver_es_static_labels", "comma-separated list of key=value labels added to every ElasticSearch document, e.g. cluster=prod,zone=eu-west-1a; implies -storage_driver_es_enrich")
 }
 
 type elasticStorage struct {
 	client      *elastic.Client
 	machineName string
 	indexName   string
-	typeName    string
-	lock        sync.Mutex
+	// Empty when the cluster does not support mapping types anymore.
+	typeName string
+	// Major version of the ElasticSearch cluster.
+	esMajorVersion int
+	indexRotation  string
+	// Label of the containers whose value is added to the name of the index
+	// of their stats.
+	indexLabel string
+	// Rollover alias written to instead of the index, and the ILM policy of
+	// the indices behind it.
+	writeAlias string
+	ilmPolicy  string
+	// Ingest pipeline the documents go through.
+	pipeline string
+	// Data stream written to instead of the index.
+	dataStream  string
+	documentIds bool
+	metrics     metricGroups
+	// Metadata added to the documents, nil unless enabled.
+	enrichment *enrichment
+	schema     string
+	// Index of the machine documents, the one of the stats if empty, and
+	// the interval between them, 0 if disabled.
+	machineIndex    string
+	machineInterval time.Duration
+	// Latest CPU usage of the containers, to compute the ECS CPU usage.
+	cpuSamples    map[string]cpuSample
+	bulkSize      int
+	flushInterval time.Duration
+	maxRetries    int
+	// Documents waiting for the next bulk request.
+	pending []*pendingDoc
+	// Maximum number of documents buffered.
+	bufferSize int
+	// Number of documents given up on after maxRetries failed attempts.
+	dropped uint64
+	// Documents rejected by ElasticSearch are written there, nil if
+	// disabled.
+	deadLetters *deadLetterFile
+	// Number of documents evicted because the buffer was full.
+	evicted      uint64
+	closeTimeout time.Duration
+	lock         sync.Mutex
+	// Serializes flushes so that retried documents keep their relative order.
+	flushLock sync.Mutex
+	flushCh   chan struct{}
+	stopCh    chan struct{}
+	wg        sync.WaitGroup
+	// Close only stops the driver once, later calls return the same error.
+	closeOnce sync.Once
+	closeErr  error
+	// Rotated indices known to exist.
+	indices     map[string]bool
+	indicesLock sync.Mutex
 }
 
+// A document queued for indexing along with the number of failed attempts to index it.
+type pendingDoc struct {
+	index string
+	id    string
+	// Name of the container, for logging.
+	container string
+	// The *detailSpec or the ECS document.
+	detail   interface{}
+	attempts int
+}
+
+// Bounds of the delay between attempts to reach ElasticSearch while it is
+// unavailable.
+const (
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = time.Minute
+)
+
+// Supported values of -storage_driver_es_index_rotation.
+const (
+	rotationNone   = ""
+	rotationDaily  = "daily"
+	rotationWeekly = "weekly"
+)
+
 type detailSpec struct {
-	Timestamp      int64                `json:"timestamp"`
-	MachineName    string               `json:"machine_name,omitempty"`
-	ContainerName  string               `json:"container_Name,omitempty"`
-	ContainerStats *info.ContainerStats `json:"container_stats,omitempty"`
+	// Microseconds since the epoch, replaced by @timestamp in data streams.
+	Timestamp           int64         `json:"timestamp,omitempty"`
+	DataStreamTimestamp *time.Time    `json:"@timestamp,omitempty"`
+	MachineName         string        `json:"machine_name,omitempty"`
+	ContainerName       string        `json:"container_Name,omitempty"`
+	ContainerStats      *indexedStats `json:"container_stats,omitempty"`
+	// Set when the machine documents are written to the same index.
+	Kind string `json:"kind,omitempty"`
+	// Metadata added with -storage_driver_es_enrich.
+	HostName                string            `json:"host_name,omitempty"`
+	Labels                  map[string]string `json:"labels,omitempty"`
+	KubernetesPodName       string            `json:"kubernetes_pod_name,omitempty"`
+	KubernetesNamespace     string            `json:"kubernetes_namespace,omitempty"`
+	KubernetesContainerName string            `json:"kubernetes_container_name,omitempty"`
 }
 
 var (
-	argElasticHost   = flag.String("storage_driver_es_host", "http://localhost:9200", "ElasticSearch host:port")
-	argIndexName     = flag.String("storage_driver_es_index", "cadvisor", "ElasticSearch index name")
-	argTypeName      = flag.String("storage_driver_es_type", "stats", "ElasticSearch type name")
-	argEnableSniffer = flag.Bool("storage_driver_es_enable_sniffer", false, "ElasticSearch uses a sniffing process to find all nodes of your cluster by default, automatically")
+	argMetrics            = metricGroups{}
+	argStaticLabels       = staticLabels{}
+	argSchema             = flag.String("storage_driver_es_schema", schemaCadvisor, "schema of the ElasticSearch documents: 'cadvisor' nests the stats under container_stats, 'ecs' follows the Elastic Common Schema and nests the other stats under cadvisor")
+	argEnrich             = flag.Bool("storage_driver_es_enrich", false, "add the node hostname ($NODE_NAME if set), the static labels and the Kubernetes pod name, namespace and container name to the ElasticSearch documents")
+	argElasticHost        = flag.String("storage_driver_es_host", "http://localhost:9200", "ElasticSearch host:port")
+	argIndexName          = flag.String("storage_driver_es_index", "cadvisor", "ElasticSearch index name")
+	argTypeName           = flag.String("storage_driver_es_type", "stats", "ElasticSearch type name")
+	argIndexRotation      = flag.String("storage_driver_es_index_rotation", rotationNone, "ElasticSearch index rotation: empty to write to a single index, daily or weekly to add a date suffix to the index name (e.g. cadvisor-2016.05.17 or cadvisor-2016.w20)")
+	argIndexLabel         = flag.String("storage_driver_es_index_label", "", "ElasticSearch index label: the stats of containers with this label are written to an index named after its value, e.g. cadvisor-<value> or cadvisor-<value>-2016.05.17 with index rotation, and to the default index otherwise")
+	argWriteAlias         = flag.String("storage_driver_es_write_alias", "", "ElasticSearch rollover alias written to instead of the index, e.g. for index lifecycle management; the initial index <alias>-000001 is created with the alias as its write index if the alias does not exist. Requires ElasticSearch 6.4 or later and is exclusive with index rotation")
+	argILMPolicy          = flag.String("storage_driver_es_ilm_policy", "", "ElasticSearch index lifecycle management policy attached to the initial index of the write alias, and to the later ones with -storage_driver_es_install_template")
+	argDataStream         = flag.String("storage_driver_es_data_stream", "", "ElasticSearch data stream written to instead of the index, with the sample time in the @timestamp field. The data stream is created if it does not exist, which requires an index template enabling it, see -storage_driver_es_install_template. Requires ElasticSearch 7.9 or later and is exclusive with index rotation, index label and write alias")
+	argPipeline           = flag.String("storage_driver_es_pipeline", "", "ElasticSearch ingest pipeline the documents go through, it must exist. Requires ElasticSearch 5.0 or later")
+	argMachineInterval    = flag.Duration("storage_driver_es_machine_interval", 0, "ElasticSearch interval between the documents describing the machine (topology, memory capacity, filesystems and versions), 0 to disable them")
+	argMachineIndex       = flag.String("storage_driver_es_machine_index", "", "ElasticSearch index of the machine documents, rotated like the stats index; by default they are written to the stats index and the documents are told apart by their kind field, machine or container")
+	argDeadLetterFile     = flag.String("storage_driver_es_dead_letter_file", "", "file the documents rejected by ElasticSearch for good (4xx errors other than 429, e.g. mapping conflicts) are appended to as NDJSON along with the error, instead of being dropped")
+	argDeadLetterMaxSize  = flag.Int64("storage_driver_es_dead_letter_max_size", 100<<20, "size in bytes after which the ElasticSearch dead-letter file is renamed with a .1 suffix, replacing the previous one")
+	argDocumentIds        = flag.Bool("storage_driver_es_document_ids", false, "ElasticSearch document ids are derived from the machine name, container name and stats timestamp so that retries overwrite documents instead of duplicating them; by default ElasticSearch generates the ids")
+	argEnableSniffer      = flag.Bool("storage_driver_es_enable_sniffer", false, "ElasticSearch uses a sniffing process to find all nodes of your cluster by default, automatically")
+	argBulkSize           = flag.Int("storage_driver_es_bulk_size", 100, "ElasticSearch maximum number of documents sent in a single bulk request; a bulk request is sent as soon as this many documents are buffered")
+	argFlushInterval      = flag.Duration("storage_driver_es_flush_interval", 10*time.Second, "ElasticSearch interval after which buffered documents are sent even if the bulk size has not been reached")
+	argBufferSize         = flag.Int("storage_driver_es_buffer_size", 10000, "ElasticSearch maximum number of documents buffered while the cluster is unavailable; the oldest ones are evicted when it is full")
+	argCloseTimeout       = flag.Duration("storage_driver_es_close_timeout", 10*time.Second, "ElasticSearch maximum time spent sending the buffered documents when cAdvisor exits")
+	argMaxRetries         = flag.Int("storage_driver_es_max_retries", 3, "ElasticSearch number of times a document that failed to be indexed is retried before it is dropped")
+	argUsername           = flag.String("storage_driver_es_username", "", "ElasticSearch username for HTTP basic authentication")
+	argPassword           = flag.String("storage_driver_es_password", "", "ElasticSearch password for HTTP basic authentication")
+	argCaFile             = flag.String("storage_driver_es_ssl_ca", "", "optional certificate authority file used to verify the ElasticSearch server certificate")
+	argCertFile           = flag.String("storage_driver_es_ssl_cert", "", "optional certificate file for ElasticSearch TLS client authentication")
+	argKeyFile            = flag.String("storage_driver_es_ssl_key", "", "optional key file for ElasticSearch TLS client authentication")
+	argInsecureSkipVerify = flag.Bool("storage_driver_es_ssl_insecure_skip_verify", false, "do not verify the ElasticSearch server certificate chain and host name")
+	argAWSSigV4           = flag.Bool("storage_driver_es_aws_sigv4", false, "sign ElasticSearch requests with AWS Signature Version 4 for Amazon Elasticsearch Service domains using IAM authentication; credentials are read from the environment, the shared credentials file or the instance profile")
+	argAWSRegion          = flag.String("storage_driver_es_aws_region", "", "AWS region of the ElasticSearch domain, defaults to $AWS_REGION")
+	argAWSService         = flag.String("storage_driver_es_aws_service", "es", "AWS service name used to sign ElasticSearch requests")
+	argGzip               = flag.Bool("storage_driver_es_gzip", false, "gzip-compress the bodies of ElasticSearch requests")
+	argGzipLevel          = flag.Int("storage_driver_es_gzip_level", gzip.DefaultCompression, "gzip compression level of ElasticSearch requests, from 1 (best speed) to 9 (best compression)")
+	argGzipMinSize        = flag.Int("storage_driver_es_gzip_min_size", 1024, "ElasticSearch request bodies smaller than this many bytes are not compressed")
+	argInstallTemplate    = flag.Bool("storage_driver_es_install_template", false, "Install an ElasticSearch index template mapping the stats fields of the driver indices on startup")
 )
 
 func new() (storage.StorageDriver, error) {
@@ -58,89 +194,730 @@ func new() (storage.StorageDriver, error) {
 	if err != nil {
 		return nil, err
 	}
-	return newStorage(
-		hostname,
-		*argIndexName,
-		*argTypeName,
-		*argElasticHost,
-		*argEnableSniffer,
-	)
+	var enrich *enrichment
+	if *argEnrich || len(argStaticLabels) > 0 {
+		// cAdvisor may run in a pod whose hostname is not the one of the node.
+		nodeName := os.Getenv("NODE_NAME")
+		if nodeName == "" {
+			nodeName = hostname
+		}
+		enrich = &enrichment{
+			hostName: nodeName,
+			labels:   argStaticLabels,
+		}
+	}
+	enableSniffer := *argEnableSniffer
+	var awsCredentials *credentials.Credentials
+	awsRegion := *argAWSRegion
+	if *argAWSSigV4 {
+		awsCredentials = defaults.Get().Config.Credentials
+		if awsRegion == "" {
+			awsRegion = os.Getenv("AWS_REGION")
+		}
+		if awsRegion == "" {
+			return nil, fmt.Errorf("the AWS region is required to sign ElasticSearch requests")
+		}
+		// Amazon Elasticsearch Service domains do not expose their nodes.
+		if enableSniffer {
+			glog.Warningf("disabling the ElasticSearch sniffer, it is not supported with AWS request signing")
+			enableSniffer = false
+		}
+	}
+	gzipLevel := *argGzipLevel
+	if !*argGzip {
+		gzipLevel = gzip.NoCompression
+	}
+	clientOptions, err := connectionOptions(*argUsername, *argPassword, *argCaFile, *argCertFile, *argKeyFile, *argInsecureSkipVerify, awsCredentials, awsRegion, *argAWSService, gzipLevel, *argGzipMinSize)
+	if err != nil {
+		return nil, err
+	}
+	var deadLetters *deadLetterFile
+	if *argDeadLetterFile != "" {
+		deadLetters, err = newDeadLetterFile(*argDeadLetterFile, *argDeadLetterMaxSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	driver, err := newStorage(config{
+		machineName:     hostname,
+		elasticHost:     *argElasticHost,
+		enableSniffer:   enableSniffer,
+		indexName:       *argIndexName,
+		typeName:        *argTypeName,
+		indexRotation:   *argIndexRotation,
+		indexLabel:      *argIndexLabel,
+		writeAlias:      *argWriteAlias,
+		ilmPolicy:       *argILMPolicy,
+		dataStream:      *argDataStream,
+		pipeline:        *argPipeline,
+		documentIds:     *argDocumentIds,
+		metrics:         argMetrics,
+		enrichment:      enrich,
+		deadLetters:     deadLetters,
+		schema:          *argSchema,
+		machineIndex:    *argMachineIndex,
+		machineInterval: *argMachineInterval,
+		bulkSize:        *argBulkSize,
+		flushInterval:   *argFlushInterval,
+		maxRetries:      *argMaxRetries,
+		bufferSize:      *argBufferSize,
+		closeTimeout:    *argCloseTimeout,
+		installTemplate: *argInstallTemplate,
+	}, clientOptions...)
+	if err != nil {
+		if deadLetters != nil {
+			deadLetters.close()
+		}
+		return nil, err
+	}
+	return driver, nil
+}
+
+// connectionOptions returns the elastic client options needed to authenticate
+// with HTTP basic authentication or AWS request signing, to connect over TLS
+// with custom certificates and to compress requests. Requests are signed when
+// awsCredentials is not nil, and compressed unless gzipLevel is
+// gzip.NoCompression. No option is returned when none of them is set.
+func connectionOptions(
+	username,
+	password,
+	caFile,
+	certFile,
+	keyFile string,
+	insecureSkipVerify bool,
+	awsCredentials *credentials.Credentials,
+	awsRegion,
+	awsService string,
+	gzipLevel,
+	gzipMinSize int,
+) ([]elastic.ClientOptionFunc, error) {
+	var options []elastic.ClientOptionFunc
+	tlsConfig, err := generateTLSConfig(caFile, certFile, keyFile, insecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+	var transport http.RoundTripper
+	if tlsConfig != nil {
+		transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		}
+	}
+	if awsCredentials != nil {
+		if username != "" {
+			glog.Warningf("ignoring the ElasticSearch username, requests are signed with AWS credentials")
+		}
+		transport = newAWSSigningTransport(transport, awsCredentials, awsRegion, awsService)
+	} else if username != "" {
+		options = append(options, elastic.SetBasicAuth(username, password))
+	}
+	if gzipLevel != gzip.NoCompression {
+		// Requests are compressed before being signed, the signature covers
+		// the body actually sent.
+		if transport, err = newGzipTransport(transport, gzipLevel, gzipMinSize); err != nil {
+			return nil, err
+		}
+	}
+	if transport != nil {
+		options = append(options, elastic.SetHttpClient(&http.Client{Transport: transport}))
+	}
+	return options, nil
+}
+
+// generateTLSConfig returns the TLS configuration used to connect to
+// ElasticSearch, or nil if the default one is fine.
+func generateTLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	if caFile == "" && certFile == "" && keyFile == "" && !insecureSkipVerify {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+	if caFile != "" {
+		caCert, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificate found in %q", caFile)
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// displayName returns the name of the container shown in the documents.
+func displayName(ref info.ContainerReference) string {
+	if len(ref.Aliases) > 0 {
+		return ref.Aliases[0]
+	}
+	return ref.Name
 }
 
 func (self *elasticStorage) containerStatsAndDefaultValues(
 	ref info.ContainerReference, stats *info.ContainerStats) *detailSpec {
 	timestamp := stats.Timestamp.UnixNano() / 1E3
-	var containerName string
-	if len(ref.Aliases) > 0 {
-		containerName = ref.Aliases[0]
-	} else {
-		containerName = ref.Name
-	}
+	containerName := displayName(ref)
 	detail := &detailSpec{
 		Timestamp:      timestamp,
 		MachineName:    self.machineName,
 		ContainerName:  containerName,
-		ContainerStats: stats,
+		ContainerStats: self.metrics.filter(stats),
+	}
+	if self.enrichment != nil {
+		self.enrichment.apply(detail, ref.Labels)
+	}
+	if self.sharesMachineIndex() {
+		detail.Kind = kindContainer
+	}
+	if self.dataStream != "" {
+		utc := stats.Timestamp.UTC()
+		detail.Timestamp = 0
+		detail.DataStreamTimestamp = &utc
 	}
 	return detail
 }
 
+// AddStats only buffers the stats; they are sent to ElasticSearch in bulk by
+// the background flusher.
 func (self *elasticStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
-	if stats == nil {
-		return nil
+	return self.AddStatsBatch([]storage.ContainerStatsPair{{Ref: ref, Stats: stats}})
+}
+
+// AddStatsBatch buffers the stats of several containers at once, holding the
+// lock of the buffer once for all of them.
+func (self *elasticStorage) AddStatsBatch(batch []storage.ContainerStatsPair) error {
+	// AddStats will be invoked simultaneously from multiple threads.
+	self.lock.Lock()
+	for _, pair := range batch {
+		if pair.Stats == nil {
+			continue
+		}
+		self.pending = append(self.pending, self.newDoc(pair.Ref, pair.Stats))
 	}
-	func() {
-		// AddStats will be invoked simultaneously from multiple threads and only one of them will perform a write.
-		self.lock.Lock()
-		defer self.lock.Unlock()
+	evicted := self.evictOverflow()
+	full := len(self.pending) >= self.bulkSize
+	self.lock.Unlock()
+
+	if full {
+		// Wake up the flusher unless a flush is already requested.
+		select {
+		case self.flushCh <- struct{}{}:
+		default:
+		}
+	}
+	if evicted > 0 {
+		return fmt.Errorf("elasticsearch buffer is full, evicted the %d oldest documents (%d evicted in total)", evicted, self.Evicted())
+	}
+	return nil
+}
+
+// newDoc returns the document of the stats of a container. Lock must be
+// held.
+func (self *elasticStorage) newDoc(ref info.ContainerReference, stats *info.ContainerStats) *pendingDoc {
+	doc := &pendingDoc{
+		index:     self.indexFor(ref.Labels, stats.Timestamp),
+		container: displayName(ref),
+	}
+	if self.schema == schemaECS {
+		doc.detail = self.ecsDocument(ref, stats, doc.container)
+	} else {
 		// Add some default params based on ContainerStats
-		detail := self.containerStatsAndDefaultValues(ref, stats)
-		// Index a cadvisor (using JSON serialization)
-		_, err := self.client.Index().
-			Index(self.indexName).
-			Type(self.typeName).
-			BodyJson(detail).
-			Do()
-		if err != nil {
-			// Handle error
-			fmt.Printf("failed to write stats to ElasticSearch - %s", err)
-			return
+		doc.detail = self.containerStatsAndDefaultValues(ref, stats)
+	}
+	if self.documentIds {
+		doc.id = documentId(self.machineName, ref.Name, stats.Timestamp)
+	}
+	return doc
+}
+
+// documentId returns the id of the document holding the stats of a container
+// sampled at timestamp, so that sending the same stats twice overwrites the
+// first document instead of duplicating it. Stats of containers with the same
+// name sampled at the same nanosecond on the same machine, e.g. by two
+// cAdvisor instances, overwrite each other.
+func documentId(machineName, containerName string, timestamp time.Time) string {
+	hash := sha1.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00%d", machineName, containerName, timestamp.UnixNano())
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// indexFor returns the index the stats of a container with the given labels
+// sampled at timestamp are written to. Rotated indices are named after the
+// UTC date of the sample so that samples taken around midnight end up in the
+// index of their own day.
+func (self *elasticStorage) indexFor(labels map[string]string, timestamp time.Time) string {
+	if self.writeAlias != "" {
+		return self.writeAlias
+	}
+	if self.dataStream != "" {
+		return self.dataStream
+	}
+	index := self.indexName
+	if self.indexLabel != "" {
+		if value := sanitizeIndexName(labels[self.indexLabel]); value != "" {
+			index = fmt.Sprintf("%s-%s", index, value)
 		}
-	}()
+	}
+	return self.rotatedIndex(index, timestamp)
+}
+
+// rotatedIndex returns the name of index with the suffix of the rotation
+// period of timestamp, if indices are rotated.
+func (self *elasticStorage) rotatedIndex(index string, timestamp time.Time) string {
+	timestamp = timestamp.UTC()
+	switch self.indexRotation {
+	case rotationDaily:
+		return fmt.Sprintf("%s-%s", index, timestamp.Format("2006.01.02"))
+	case rotationWeekly:
+		year, week := timestamp.ISOWeek()
+		return fmt.Sprintf("%s-%d.w%02d", index, year, week)
+	}
+	return index
+}
+
+// Longest label value kept in index names, well below the 255 bytes limit
+// of ElasticSearch.
+const maxIndexLabelLength = 100
+
+// sanitizeIndexName returns value usable as part of an index name, or an
+// empty string if nothing is left of it. Index names are lowercase and cannot
+// contain separators such as slashes, spaces or commas.
+func sanitizeIndexName(value string) string {
+	value = strings.Map(func(r rune) rune {
+		switch r {
+		case '\\', '/', '*', '?', '"', '<', '>', '|', ',', '#', ':':
+			return '_'
+		}
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return '_'
+		}
+		return unicode.ToLower(r)
+	}, value)
+	if len(value) > maxIndexLabelLength {
+		value = value[:maxIndexLabelLength]
+		// Do not cut a multi-byte character in half.
+		for !utf8.ValidString(value) {
+			value = value[:len(value)-1]
+		}
+	}
+	return strings.Trim(value, "-_.")
+}
+
+// ensureIndex creates the rotated index on its first use.
+func (self *elasticStorage) ensureIndex(index string) error {
+	if self.indexRotation == rotationNone {
+		// The configured index is created by ElasticSearch on the first write.
+		return nil
+	}
+	self.indicesLock.Lock()
+	defer self.indicesLock.Unlock()
+	if self.indices[index] {
+		return nil
+	}
+	exists, err := self.client.IndexExists(index).Do()
+	if err != nil {
+		return checkAvailable(err)
+	}
+	if !exists {
+		if _, err := self.client.CreateIndex(index).Do(); err != nil {
+			// Another cAdvisor may have created the index in the meantime.
+			if exists, _ = self.client.IndexExists(index).Do(); !exists {
+				if e := checkAvailable(err); isUnavailable(e) {
+					return e
+				}
+				return fmt.Errorf("failed to create index %q - %s", index, err)
+			}
+		}
+	}
+	self.indices[index] = true
 	return nil
 }
 
+// unavailableError is returned when a request did not reach ElasticSearch
+// or was rejected because the cluster is not available.
+type unavailableError struct {
+	err error
+}
+
+func (e unavailableError) Error() string {
+	return e.err.Error()
+}
+
+// checkAvailable wraps err in an unavailableError if it means that
+// ElasticSearch could not handle the request at all.
+func checkAvailable(err error) error {
+	if e, ok := err.(*elastic.Error); ok && e.Status < 500 {
+		return err
+	}
+	return unavailableError{err}
+}
+
+func isUnavailable(err error) bool {
+	_, ok := err.(unavailableError)
+	return ok
+}
+
+// nextBackoff returns the delay before trying to reach ElasticSearch again.
+func nextBackoff(backoff time.Duration) time.Duration {
+	if backoff == 0 {
+		return minBackoff
+	}
+	backoff *= 2
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+// flusher sends the buffered documents every flushInterval or whenever
+// AddStats reports that a full bulk request is available. While
+// ElasticSearch is unavailable it retries with an exponential backoff
+// instead.
+func (self *elasticStorage) flusher() {
+	defer self.wg.Done()
+	ticker := time.NewTicker(self.flushInterval)
+	defer ticker.Stop()
+	var backoff time.Duration
+	for {
+		if backoff > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-self.stopCh:
+				return
+			}
+		} else {
+			select {
+			case <-ticker.C:
+			case <-self.flushCh:
+			case <-self.stopCh:
+				return
+			}
+		}
+		err := self.flush()
+		if isUnavailable(err) {
+			backoff = nextBackoff(backoff)
+			glog.Errorf("failed to reach ElasticSearch, retrying in %v - %s", backoff, err)
+			continue
+		}
+		backoff = 0
+		if err != nil {
+			glog.Errorf("failed to write stats to ElasticSearch - %s", err)
+		}
+	}
+}
+
+// flush sends all the buffered documents in bulk requests of at most
+// bulkSize documents. Documents that could not be indexed are put back in
+// the buffer to be retried on the next flush. If ElasticSearch is
+// unavailable, the documents not sent yet are kept in order and an
+// unavailableError is returned.
+func (self *elasticStorage) flush() error {
+	self.flushLock.Lock()
+	defer self.flushLock.Unlock()
+
+	self.lock.Lock()
+	docs := self.pending
+	self.pending = nil
+	self.expireCpuSamples(time.Now())
+	self.lock.Unlock()
+
+	var failed []*pendingDoc
+	var rejected []rejectedDoc
+	var lastErr error
+	for len(docs) > 0 {
+		n := len(docs)
+		if n > self.bulkSize {
+			n = self.bulkSize
+		}
+		batchFailed, batchRejected, err := self.send(docs[:n])
+		rejected = append(rejected, batchRejected...)
+		if isUnavailable(err) {
+			// Not being able to reach ElasticSearch does not count as
+			// an attempt, the documents are replayed once it is back.
+			self.requeue(docs)
+			self.retry(failed)
+			self.reject(rejected)
+			return err
+		}
+		if err != nil {
+			lastErr = err
+		}
+		failed = append(failed, batchFailed...)
+		docs = docs[n:]
+	}
+	self.retry(failed)
+	self.reject(rejected)
+	return lastErr
+}
+
+// send indexes docs with a single bulk request and returns the documents
+// that failed to be indexed and may be retried, and the ones rejected for
+// good.
+func (self *elasticStorage) send(docs []*pendingDoc) ([]*pendingDoc, []rejectedDoc, error) {
+	bulk := self.client.Bulk().Pipeline(self.pipeline)
+	var sent, failed []*pendingDoc
+	var lastErr error
+	for _, doc := range docs {
+		if err := self.ensureIndex(doc.index); err != nil {
+			if isUnavailable(err) {
+				return docs, nil, err
+			}
+			failed = append(failed, doc)
+			lastErr = err
+			continue
+		}
+		// The type is left out of typeless requests, and the id when
+		// ElasticSearch generates it. Data streams only accept new
+		// documents.
+		request := elastic.NewBulkIndexRequest().
+			Index(doc.index).
+			Type(self.typeName).
+			Id(doc.id).
+			Doc(doc.detail)
+		if self.dataStream != "" {
+			request.OpType("create")
+		}
+		bulk.Add(request)
+		sent = append(sent, doc)
+	}
+	if len(sent) == 0 {
+		return failed, nil, lastErr
+	}
+	resp, err := bulk.Do()
+	if err != nil {
+		if err = checkAvailable(err); isUnavailable(err) {
+			return docs, nil, err
+		}
+		return append(failed, sent...), nil, err
+	}
+
+	// Bulk response items are in the same order as the requests.
+	var rejected []rejectedDoc
+	itemsFailed := 0
+	for i, item := range resp.Items {
+		if i >= len(sent) {
+			break
+		}
+		for _, result := range item {
+			if result.Status >= 200 && result.Status <= 299 {
+				continue
+			}
+			if isPermanentFailure(result.Status) {
+				rejected = append(rejected, rejectedDoc{sent[i], result.Status, result.Error})
+			} else {
+				failed = append(failed, sent[i])
+			}
+			itemsFailed++
+			break
+		}
+	}
+	if itemsFailed > 0 {
+		lastErr = fmt.Errorf("%d of %d documents failed to be indexed", itemsFailed, len(sent))
+	}
+	return failed, rejected, lastErr
+}
+
+// retry puts the failed documents back in front of the buffer, dropping the
+// ones which already used up their attempts.
+func (self *elasticStorage) retry(failed []*pendingDoc) {
+	var requeue []*pendingDoc
+	for _, doc := range failed {
+		doc.attempts++
+		if doc.attempts > self.maxRetries {
+			total := atomic.AddUint64(&self.dropped, 1)
+			glog.Warningf("dropped stats of container %q after %d failed attempts to write them to ElasticSearch (%d dropped in total)", doc.container, doc.attempts, total)
+			continue
+		}
+		requeue = append(requeue, doc)
+	}
+	self.requeue(requeue)
+}
+
+// requeue puts docs back in front of the buffer.
+func (self *elasticStorage) requeue(docs []*pendingDoc) {
+	if len(docs) == 0 {
+		return
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.pending = append(docs, self.pending...)
+	self.evictOverflow()
+}
+
+// evictOverflow evicts the oldest documents when the buffer holds more than
+// bufferSize documents and returns how many were evicted. It must be called
+// with the lock held.
+func (self *elasticStorage) evictOverflow() int {
+	excess := len(self.pending) - self.bufferSize
+	if excess <= 0 {
+		return 0
+	}
+	self.pending = self.pending[excess:]
+	atomic.AddUint64(&self.evicted, uint64(excess))
+	return excess
+}
+
+// Dropped returns the number of documents that were dropped after failing to
+// be indexed maxRetries times.
+func (self *elasticStorage) Dropped() uint64 {
+	return atomic.LoadUint64(&self.dropped)
+}
+
+// Evicted returns the number of documents that were evicted because the
+// buffer was full.
+func (self *elasticStorage) Evicted() uint64 {
+	return atomic.LoadUint64(&self.evicted)
+}
+
+// Close stops the flusher and sends the documents still buffered, retrying
+// the failed ones until they are indexed or dropped. Documents which could
+// not be sent within closeTimeout are lost.
 func (self *elasticStorage) Close() error {
+	self.closeOnce.Do(func() {
+		self.closeErr = self.close()
+	})
+	return self.closeErr
+}
+
+func (self *elasticStorage) close() error {
+	close(self.stopCh)
+	self.wg.Wait()
+
+	deadline := time.Now().Add(self.closeTimeout)
+	var backoff time.Duration
+	var err error
+	for {
+		self.lock.Lock()
+		left := len(self.pending)
+		self.lock.Unlock()
+		if left == 0 {
+			break
+		}
+		if !time.Now().Before(deadline) {
+			err = fmt.Errorf("failed to write %d documents to ElasticSearch before closing - %v", left, err)
+			break
+		}
+		err = self.flush()
+		if isUnavailable(err) {
+			backoff = nextBackoff(backoff)
+			if remaining := deadline.Sub(time.Now()); backoff > remaining {
+				backoff = remaining
+			}
+			time.Sleep(backoff)
+		}
+	}
+	if self.deadLetters != nil {
+		self.deadLetters.close()
+	}
 	self.client = nil
-	return nil
+	return err
+}
+
+// config is the configuration of the driver, populated from the flags.
+type config struct {
+	// A unique identifier to identify the host that current cAdvisor
+	// instance is running on.
+	machineName string
+	// The host which runs ElasticSearch.
+	elasticHost   string
+	enableSniffer bool
+	indexName     string
+	typeName      string
+	indexRotation string
+	indexLabel    string
+	writeAlias    string
+	ilmPolicy     string
+	dataStream    string
+	pipeline      string
+	documentIds   bool
+	metrics       metricGroups
+	// Metadata added to the documents, nil unless enabled.
+	enrichment *enrichment
+	// Documents rejected by ElasticSearch are written there, nil if
+	// disabled.
+	deadLetters     *deadLetterFile
+	schema          string
+	machineIndex    string
+	machineInterval time.Duration
+	bulkSize        int
+	flushInterval   time.Duration
+	maxRetries      int
+	bufferSize      int
+	closeTimeout    time.Duration
+	installTemplate bool
 }
 
-// machineName: A unique identifier to identify the host that current cAdvisor
-// instance is running on.
-// ElasticHost: The host which runs ElasticSearch.
-func newStorage(
-	machineName,
-	indexName,
-	typeName,
-	elasticHost string,
-	enableSniffer bool,
-) (storage.StorageDriver, error) {
+func newStorage(cfg config, clientOptions ...elastic.ClientOptionFunc) (*elasticStorage, error) {
+	if cfg.bulkSize <= 0 {
+		return nil, fmt.Errorf("invalid elasticsearch bulk size %d", cfg.bulkSize)
+	}
+	if cfg.flushInterval <= 0 {
+		return nil, fmt.Errorf("invalid elasticsearch flush interval %v", cfg.flushInterval)
+	}
+	if cfg.bufferSize <= 0 {
+		return nil, fmt.Errorf("invalid elasticsearch buffer size %d", cfg.bufferSize)
+	}
+	switch cfg.schema {
+	case schemaCadvisor, schemaECS:
+	default:
+		return nil, fmt.Errorf("invalid elasticsearch schema %q", cfg.schema)
+	}
+	switch cfg.indexRotation {
+	case rotationNone, rotationDaily, rotationWeekly:
+	default:
+		return nil, fmt.Errorf("invalid elasticsearch index rotation %q", cfg.indexRotation)
+	}
+	if cfg.writeAlias != "" && cfg.indexRotation != rotationNone {
+		// Rollover creates the indices behind the alias.
+		return nil, fmt.Errorf("elasticsearch index rotation cannot be used with a write alias")
+	}
+	if cfg.indexLabel != "" && cfg.writeAlias != "" {
+		return nil, fmt.Errorf("an elasticsearch index label cannot be used with a write alias")
+	}
+	if cfg.dataStream != "" && (cfg.indexRotation != rotationNone || cfg.indexLabel != "" || cfg.writeAlias != "") {
+		// The backing indices of data streams are managed by ElasticSearch.
+		return nil, fmt.Errorf("an elasticsearch data stream cannot be used with index rotation, an index label or a write alias")
+	}
+	if cfg.machineInterval < 0 {
+		return nil, fmt.Errorf("invalid elasticsearch machine interval %v", cfg.machineInterval)
+	}
+	if cfg.ilmPolicy != "" && cfg.writeAlias == "" {
+		return nil, fmt.Errorf("an elasticsearch write alias is required to attach the ILM policy %q", cfg.ilmPolicy)
+	}
+
 	// Obtain a client and connect to the default Elasticsearch installation
 	// on 127.0.0.1:9200. Of course you can configure your client to connect
 	// to other hosts and configure it in various other ways.
-	client, err := elastic.NewClient(
+	options := []elastic.ClientOptionFunc{
+		// Once all the nodes are marked as dead, the next request runs a
+		// health check to mark the ones which are back alive again, so that
+		// the flusher does not wait for the periodic health check.
 		elastic.SetHealthcheck(true),
-		elastic.SetSniff(enableSniffer),
-		elastic.SetHealthcheckInterval(30*time.Second),
-		elastic.SetURL(elasticHost),
-	)
+		elastic.SetSniff(cfg.enableSniffer),
+		elastic.SetHealthcheckInterval(30 * time.Second),
+		elastic.SetURL(cfg.elasticHost),
+	}
+	if strings.HasPrefix(cfg.elasticHost, "https://") {
+		// Let the sniffer find the nodes of the cluster over TLS too.
+		options = append(options, elastic.SetScheme("https"))
+	}
+	client, err := elastic.NewClient(append(options, clientOptions...)...)
 	if err != nil {
 		// Handle error
 		return nil, fmt.Errorf("failed to create the elasticsearch client - %s", err)
 	}
 
 	// Ping the Elasticsearch server to get e.g. the version number
-	info, code, err := client.Ping().URL(elasticHost).Do()
+	info, code, err := client.Ping().URL(cfg.elasticHost).Do()
 	if err != nil {
 		// Handle error
 		return nil, fmt.Errorf("failed to ping the elasticsearch - %s", err)
@@ -148,11 +925,74 @@ func newStorage(
 	}
 	fmt.Printf("Elasticsearch returned with code %d and version %s", code, info.Version.Number)
 
+	esMajorVersion := majorVersion(info.Version.Number)
+	if esMajorVersion >= 7 && cfg.typeName != "" {
+		// Mapping types are deprecated in 7.x and removed in 8.x.
+		glog.Warningf("ignoring ElasticSearch type %q, mapping types are not supported by version %s", cfg.typeName, info.Version.Number)
+		cfg.typeName = ""
+	}
+	if cfg.writeAlias != "" && esMajorVersion < 6 {
+		return nil, fmt.Errorf("elasticsearch write aliases are not supported by version %s", info.Version.Number)
+	}
+	if cfg.pipeline != "" && esMajorVersion < 5 {
+		return nil, fmt.Errorf("elasticsearch ingest pipelines are not supported by version %s", info.Version.Number)
+	}
+	if cfg.dataStream != "" && !supportsDataStreams(info.Version.Number) {
+		return nil, fmt.Errorf("elasticsearch data streams require version 7.9 or later, the cluster runs version %s", info.Version.Number)
+	}
+
 	ret := &elasticStorage{
-		client:      client,
-		machineName: machineName,
-		indexName:   indexName,
-		typeName:    typeName,
+		client:          client,
+		machineName:     cfg.machineName,
+		indexName:       cfg.indexName,
+		typeName:        cfg.typeName,
+		indexRotation:   cfg.indexRotation,
+		indexLabel:      cfg.indexLabel,
+		writeAlias:      cfg.writeAlias,
+		ilmPolicy:       cfg.ilmPolicy,
+		dataStream:      cfg.dataStream,
+		pipeline:        cfg.pipeline,
+		documentIds:     cfg.documentIds,
+		metrics:         cfg.metrics,
+		enrichment:      cfg.enrichment,
+		deadLetters:     cfg.deadLetters,
+		schema:          cfg.schema,
+		machineIndex:    cfg.machineIndex,
+		machineInterval: cfg.machineInterval,
+		cpuSamples:      make(map[string]cpuSample),
+		esMajorVersion:  esMajorVersion,
+		bulkSize:        cfg.bulkSize,
+		flushInterval:   cfg.flushInterval,
+		maxRetries:      cfg.maxRetries,
+		bufferSize:      cfg.bufferSize,
+		closeTimeout:    cfg.closeTimeout,
+		flushCh:         make(chan struct{}, 1),
+		stopCh:          make(chan struct{}),
+		indices:         make(map[string]bool),
+	}
+	if cfg.installTemplate {
+		if cfg.dataStream != "" {
+			ret.installDataStreamTemplate()
+		} else {
+			ret.installIndexTemplate()
+		}
+	}
+	if cfg.dataStream != "" {
+		if err := ret.ensureDataStream(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.pipeline != "" {
+		if err := ret.checkPipeline(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.writeAlias != "" {
+		if err := ret.bootstrapWriteAlias(); err != nil {
+			return nil, err
+		}
 	}
+	ret.wg.Add(1)
+	go ret.flusher()
 	return ret, nil
 }
@@ -0,0 +1,965 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+
+	"gopkg.in/olivere/elastic.v2"
+)
+
+// fakeElasticsearch records the _bulk requests it receives. Its bulk
+// responses report the status returned by itemStatus for every document.
+type fakeElasticsearch struct {
+	lock       sync.Mutex
+	bulks      [][]string
+	itemStatus func(bulk, item int) int
+	// Number of times each index was created.
+	created map[string]int
+	// Index templates installed and the status returned when installing them.
+	templates      map[string]string
+	templateStatus int
+	// Version number reported by the ping, 1.7.3 by default.
+	version string
+	// Paths of the bulk requests.
+	bulkPaths []string
+	// Number of upcoming bulk requests rejected because the cluster is
+	// unavailable, or -1 to reject all of them.
+	unavailable int
+}
+
+func (self *fakeElasticsearch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if strings.HasPrefix(r.URL.Path, "/_template/") {
+		if self.templateStatus != 0 {
+			w.WriteHeader(self.templateStatus)
+			fmt.Fprintf(w, `{"status":%d,"error":"action [indices:admin/template/put] is unauthorized"}`, self.templateStatus)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		self.lock.Lock()
+		defer self.lock.Unlock()
+		if self.templates == nil {
+			self.templates = make(map[string]string)
+		}
+		self.templates[strings.TrimPrefix(r.URL.Path, "/_template/")] = string(body)
+		fmt.Fprint(w, `{"acknowledged":true}`)
+		return
+	}
+	if r.URL.Path != "/" && !strings.HasSuffix(r.URL.Path, "/_bulk") {
+		index := strings.Trim(r.URL.Path, "/")
+		self.lock.Lock()
+		defer self.lock.Unlock()
+		if self.created == nil {
+			self.created = make(map[string]int)
+		}
+		switch r.Method {
+		case "HEAD":
+			if self.created[index] == 0 {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case "PUT":
+			self.created[index]++
+			fmt.Fprint(w, `{"acknowledged":true}`)
+		}
+		return
+	}
+	if !strings.HasSuffix(r.URL.Path, "/_bulk") {
+		// Ping and health checks.
+		version := self.version
+		if version == "" {
+			version = "1.7.3"
+		}
+		fmt.Fprintf(w, `{"status":200,"version":{"number":%q}}`, version)
+		return
+	}
+
+	var reader io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		reader = gz
+	}
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	self.lock.Lock()
+	if self.unavailable != 0 {
+		if self.unavailable > 0 {
+			self.unavailable--
+		}
+		self.lock.Unlock()
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"status":503,"error":"ClusterBlockException[blocked by: [SERVICE_UNAVAILABLE/1/state not recovered / initialized];]"}`)
+		return
+	}
+	bulk := len(self.bulks)
+	self.bulks = append(self.bulks, lines)
+	self.bulkPaths = append(self.bulkPaths, r.URL.Path)
+	self.lock.Unlock()
+
+	// Every document takes an action line and a source line.
+	items := make([]map[string]interface{}, len(lines)/2)
+	errors := false
+	for i := range items {
+		status := http.StatusCreated
+		if self.itemStatus != nil {
+			status = self.itemStatus(bulk, i)
+		}
+		if status > 299 {
+			errors = true
+		}
+		items[i] = map[string]interface{}{
+			"index": map[string]interface{}{"status": status},
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"took":   1,
+		"errors": errors,
+		"items":  items,
+	})
+}
+
+func (self *fakeElasticsearch) bulkRequests() [][]string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.bulks
+}
+
+func (self *fakeElasticsearch) createdIndices() map[string]int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.created
+}
+
+func (self *fakeElasticsearch) setUnavailable(unavailable int) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.unavailable = unavailable
+}
+
+// memoryUsages returns the memory usage of the documents sent, in order.
+func (self *fakeElasticsearch) memoryUsages(t *testing.T) []uint64 {
+	var usages []uint64
+	for _, lines := range self.bulkRequests() {
+		for i := 1; i < len(lines); i += 2 {
+			var detail detailSpec
+			if err := json.Unmarshal([]byte(lines[i]), &detail); err != nil {
+				t.Fatal(err)
+			}
+			usages = append(usages, detail.ContainerStats.Memory.Usage)
+		}
+	}
+	return usages
+}
+
+func (self *fakeElasticsearch) installedTemplates() map[string]string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.templates
+}
+
+// testConfig returns the configuration of a driver writing to elasticHost,
+// changed by the given functions.
+func testConfig(elasticHost string, changes ...func(*config)) config {
+	cfg := config{
+		machineName:   "machine",
+		elasticHost:   elasticHost,
+		indexName:     "cadvisor",
+		typeName:      "stats",
+		indexRotation: rotationNone,
+		schema:        schemaCadvisor,
+		bulkSize:      10,
+		flushInterval: time.Hour,
+		maxRetries:    3,
+		bufferSize:    1000,
+		closeTimeout:  10 * time.Second,
+	}
+	for _, change := range changes {
+		change(&cfg)
+	}
+	return cfg
+}
+
+func newTestStorage(t testing.TB, handler http.Handler, bulkSize, maxRetries int) (*elasticStorage, func()) {
+	return newRotatedTestStorage(t, handler, rotationNone, bulkSize, maxRetries)
+}
+
+func newRotatedTestStorage(t testing.TB, handler http.Handler, indexRotation string, bulkSize, maxRetries int) (*elasticStorage, func()) {
+	server := httptest.NewServer(handler)
+	driver, err := newStorage(testConfig(server.URL, func(cfg *config) {
+		cfg.indexRotation = indexRotation
+		cfg.bulkSize = bulkSize
+		cfg.maxRetries = maxRetries
+	}))
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return driver, server.Close
+}
+
+func addTestStats(t *testing.T, driver *elasticStorage, n int) {
+	ref := info.ContainerReference{Name: "/test"}
+	for i := 0; i < n; i++ {
+		stats := &info.ContainerStats{Timestamp: time.Now()}
+		stats.Memory.Usage = uint64(i)
+		if err := driver.AddStats(ref, stats); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAddStatsIsSentInBulk(t *testing.T) {
+	es := &fakeElasticsearch{}
+	driver, closeServer := newTestStorage(t, es, 3, 3)
+	defer closeServer()
+
+	addTestStats(t, driver, 7)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bulks := es.bulkRequests()
+	if len(bulks) < 3 {
+		t.Fatalf("expected at least 3 bulk requests, got %d", len(bulks))
+	}
+	docs := 0
+	for _, lines := range bulks {
+		if len(lines) > 2*3 {
+			t.Errorf("expected at most 3 documents per bulk request, got %d", len(lines)/2)
+		}
+		for i := 0; i < len(lines); i += 2 {
+			if !strings.Contains(lines[i], `"_index":"cadvisor"`) || !strings.Contains(lines[i], `"_type":"stats"`) {
+				t.Errorf("unexpected bulk action %s", lines[i])
+			}
+			if !strings.Contains(lines[i+1], `"container_Name":"/test"`) {
+				t.Errorf("unexpected bulk document %s", lines[i+1])
+			}
+		}
+		docs += len(lines) / 2
+	}
+	if docs != 7 {
+		t.Errorf("expected 7 documents to be sent, got %d", docs)
+	}
+	if driver.Dropped() != 0 {
+		t.Errorf("expected no dropped documents, got %d", driver.Dropped())
+	}
+}
+
+func TestFailedDocumentsAreRetried(t *testing.T) {
+	es := &fakeElasticsearch{
+		itemStatus: func(bulk, item int) int {
+			// The first document of the first request fails once.
+			if bulk == 0 && item == 0 {
+				return http.StatusServiceUnavailable
+			}
+			return http.StatusCreated
+		},
+	}
+	driver, closeServer := newTestStorage(t, es, 10, 3)
+	defer closeServer()
+
+	addTestStats(t, driver, 2)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	bulks := es.bulkRequests()
+	if len(bulks) != 2 {
+		t.Fatalf("expected 2 bulk requests, got %d", len(bulks))
+	}
+	if len(bulks[1]) != 2 {
+		t.Errorf("expected the retry to contain only the failed document, got %d documents", len(bulks[1])/2)
+	}
+	if driver.Dropped() != 0 {
+		t.Errorf("expected no dropped documents, got %d", driver.Dropped())
+	}
+}
+
+func TestDocumentsAreDroppedAfterMaxRetries(t *testing.T) {
+	es := &fakeElasticsearch{
+		itemStatus: func(bulk, item int) int {
+			return http.StatusServiceUnavailable
+		},
+	}
+	driver, closeServer := newTestStorage(t, es, 10, 2)
+	defer closeServer()
+
+	addTestStats(t, driver, 4)
+	if err := driver.Close(); err == nil {
+		t.Error("expected an error when documents cannot be indexed")
+	}
+
+	// One initial attempt and two retries.
+	if bulks := es.bulkRequests(); len(bulks) != 3 {
+		t.Errorf("expected 3 bulk requests, got %d", len(bulks))
+	}
+	if driver.Dropped() != 4 {
+		t.Errorf("expected 4 dropped documents, got %d", driver.Dropped())
+	}
+}
+
+func TestIndexRotation(t *testing.T) {
+	beforeMidnight := time.Date(2016, time.May, 17, 23, 59, 59, 999000000, time.UTC)
+	afterMidnight := beforeMidnight.Add(time.Millisecond)
+	// 2016-05-17 is a Tuesday of ISO week 20; 2017-01-01 still belongs to week 52 of 2016.
+	newYear := time.Date(2017, time.January, 1, 12, 0, 0, 0, time.UTC)
+	// Index names follow the UTC date regardless of the local time zone.
+	pst := time.FixedZone("PST", -8*60*60)
+
+	testCases := []struct {
+		rotation  string
+		timestamp time.Time
+		expected  string
+	}{
+		{rotationNone, beforeMidnight, "cadvisor"},
+		{rotationDaily, beforeMidnight, "cadvisor-2016.05.17"},
+		{rotationDaily, afterMidnight, "cadvisor-2016.05.18"},
+		{rotationDaily, afterMidnight.In(pst), "cadvisor-2016.05.18"},
+		{rotationWeekly, beforeMidnight, "cadvisor-2016.w20"},
+		{rotationWeekly, newYear, "cadvisor-2016.w52"},
+	}
+	for _, tc := range testCases {
+		driver := &elasticStorage{indexName: "cadvisor", indexRotation: tc.rotation}
+		if index := driver.indexFor(nil, tc.timestamp); index != tc.expected {
+			t.Errorf("expected %s index for %v to be %q, got %q", tc.rotation, tc.timestamp, tc.expected, index)
+		}
+	}
+}
+
+func TestIndexLabel(t *testing.T) {
+	timestamp := time.Date(2016, time.May, 17, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		rotation string
+		labels   map[string]string
+		expected string
+	}{
+		{rotationNone, map[string]string{"team": "payments"}, "cadvisor-payments"},
+		{rotationDaily, map[string]string{"team": "payments"}, "cadvisor-payments-2016.05.17"},
+		// Containers without the label are written to the default index.
+		{rotationNone, nil, "cadvisor"},
+		{rotationDaily, map[string]string{"app": "web"}, "cadvisor-2016.05.17"},
+		{rotationNone, map[string]string{"team": ""}, "cadvisor"},
+		{rotationNone, map[string]string{"team": "/"}, "cadvisor"},
+	}
+	for _, tc := range testCases {
+		driver := &elasticStorage{indexName: "cadvisor", indexRotation: tc.rotation, indexLabel: "team"}
+		if index := driver.indexFor(tc.labels, timestamp); index != tc.expected {
+			t.Errorf("expected %s index for labels %v to be %q, got %q", tc.rotation, tc.labels, tc.expected, index)
+		}
+	}
+}
+
+func TestSanitizeIndexName(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected string
+	}{
+		{"payments", "payments"},
+		{"Payments", "payments"},
+		{"kube-system", "kube-system"},
+		{"team/a b", "team_a_b"},
+		{`a\b*c?d"e<f>g|h,i#j:k`, "a_b_c_d_e_f_g_h_i_j_k"},
+		{"tab\tnewline\n", "tab_newline"},
+		// Index names cannot start with these characters.
+		{"_private", "private"},
+		{"-team", "team"},
+		{"..", ""},
+		{"Équipe", "équipe"},
+		{strings.Repeat("a", 200), strings.Repeat("a", maxIndexLabelLength)},
+		{strings.Repeat("a", maxIndexLabelLength-1) + "é", strings.Repeat("a", maxIndexLabelLength-1)},
+	}
+	for _, tc := range testCases {
+		if actual := sanitizeIndexName(tc.value); actual != tc.expected {
+			t.Errorf("expected %q to be sanitized to %q, got %q", tc.value, tc.expected, actual)
+		}
+	}
+}
+
+func TestAddStatsRoutesByLabel(t *testing.T) {
+	es := &fakeElasticsearch{}
+	driver, closeServer := newTestStorage(t, es, 10, 3)
+	defer closeServer()
+	driver.indexLabel = "io.kubernetes.pod.namespace"
+
+	for _, ref := range []info.ContainerReference{
+		{Name: "/a", Labels: map[string]string{"io.kubernetes.pod.namespace": "Kube-System"}},
+		{Name: "/b"},
+	} {
+		if err := driver.AddStats(ref, &info.ContainerStats{Timestamp: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	lines := es.bulkRequests()[0]
+	if !strings.Contains(lines[0], `"_index":"cadvisor-kube-system"`) {
+		t.Errorf("expected the labeled container to be routed to its index, got %s", lines[0])
+	}
+	if !strings.Contains(lines[2], `"_index":"cadvisor"`) {
+		t.Errorf("expected the unlabeled container to be written to the default index, got %s", lines[2])
+	}
+}
+
+func TestRotatedIndicesAreCreatedOnce(t *testing.T) {
+	es := &fakeElasticsearch{}
+	driver, closeServer := newRotatedTestStorage(t, es, rotationDaily, 2, 3)
+	defer closeServer()
+
+	ref := info.ContainerReference{Name: "/test"}
+	midnight := time.Date(2016, time.May, 18, 0, 0, 0, 0, time.UTC)
+	for i := -2; i < 2; i++ {
+		stats := &info.ContainerStats{Timestamp: midnight.Add(time.Duration(i) * time.Second)}
+		if err := driver.AddStats(ref, stats); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int{
+		"cadvisor-2016.05.17": 1,
+		"cadvisor-2016.05.18": 1,
+	}
+	if created := es.createdIndices(); !reflect.DeepEqual(created, expected) {
+		t.Errorf("expected created indices %v, got %v", expected, created)
+	}
+	docs := map[string]int{}
+	for _, lines := range es.bulkRequests() {
+		for i := 0; i < len(lines); i += 2 {
+			var action map[string]map[string]string
+			if err := json.Unmarshal([]byte(lines[i]), &action); err != nil {
+				t.Fatal(err)
+			}
+			docs[action["index"]["_index"]]++
+		}
+	}
+	expected = map[string]int{
+		"cadvisor-2016.05.17": 2,
+		"cadvisor-2016.05.18": 2,
+	}
+	if !reflect.DeepEqual(docs, expected) {
+		t.Errorf("expected documents per index %v, got %v", expected, docs)
+	}
+}
+
+// mappingAt returns the mapping of the property at the dot separated path.
+func mappingAt(mapping map[string]interface{}, path string) map[string]interface{} {
+	for _, name := range strings.Split(path, ".") {
+		properties, ok := mapping["properties"].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if mapping, ok = properties[name].(map[string]interface{}); !ok {
+			return nil
+		}
+	}
+	return mapping
+}
+
+func TestIndexTemplate(t *testing.T) {
+	keyword := map[string]interface{}{"type": "keyword"}
+	notAnalyzed := map[string]interface{}{"type": "string", "index": "not_analyzed"}
+	long := map[string]interface{}{"type": "long"}
+	testCases := []struct {
+		version  int
+		path     string
+		expected map[string]interface{}
+	}{
+		{5, "timestamp", long},
+		{5, "machine_name", keyword},
+		{5, "container_Name", keyword},
+		{2, "container_Name", notAnalyzed},
+		{5, "container_stats.timestamp", map[string]interface{}{"type": "date"}},
+		{5, "container_stats.cpu.usage.total", long},
+		{5, "container_stats.cpu.usage.per_cpu_usage", long},
+		{5, "container_stats.cpu.load_average", long},
+		{5, "container_stats.memory.working_set", long},
+		// Interface stats are embedded in the network stats.
+		{5, "container_stats.network.rx_bytes", long},
+		{5, "container_stats.network.interfaces.name", keyword},
+		{5, "container_stats.filesystem.device", keyword},
+		{2, "container_stats.filesystem.device", notAnalyzed},
+		{5, "container_stats.filesystem.usage", long},
+		// Maps are mapped dynamically.
+		{5, "container_stats.custom_metrics", nil},
+	}
+	for _, tc := range testCases {
+		template := indexTemplate("cadvisor", "stats", schemaCadvisor, tc.version)
+		if template["template"] != "cadvisor*" {
+			t.Errorf("unexpected template pattern %v", template["template"])
+		}
+		mapping := template["mappings"].(map[string]interface{})["stats"].(map[string]interface{})
+		if actual := mappingAt(mapping, tc.path); !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("expected mapping of %s for version %d to be %v, got %v", tc.path, tc.version, tc.expected, actual)
+		}
+	}
+}
+
+func TestInstallIndexTemplate(t *testing.T) {
+	es := &fakeElasticsearch{}
+	driver, closeServer := newTestStorage(t, es, 10, 3)
+	defer closeServer()
+	defer driver.Close()
+
+	driver.installIndexTemplate()
+	var template map[string]interface{}
+	if err := json.Unmarshal([]byte(es.installedTemplates()["cadvisor"]), &template); err != nil {
+		t.Fatalf("expected the cadvisor template to be installed: %v", err)
+	}
+	if template["template"] != "cadvisor*" {
+		t.Errorf("unexpected template pattern %v", template["template"])
+	}
+
+	// Lacking the privilege to install templates is not fatal.
+	es.templateStatus = http.StatusForbidden
+	driver.installIndexTemplate()
+	addTestStats(t, driver, 1)
+}
+
+func TestNoAuthOptionsByDefault(t *testing.T) {
+	options, err := connectionOptions("", "", "", "", "", false, nil, "", "", gzip.NoCompression, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(options) != 0 {
+		t.Errorf("expected no client options, got %d", len(options))
+	}
+}
+
+func TestBasicAuthOverTLS(t *testing.T) {
+	es := &fakeElasticsearch{}
+	var unauthorized int
+	var lock sync.Mutex
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "cadvisor" || password != "secret" {
+			lock.Lock()
+			unauthorized++
+			lock.Unlock()
+			http.Error(w, `{"status":401,"error":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		es.ServeHTTP(w, r)
+	}))
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	defer server.Close()
+
+	// Trust the self-signed certificate of the test server.
+	caFile, err := ioutil.TempFile("", "es-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(caFile.Name())
+	pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: server.TLS.Certificates[0].Certificate[0]})
+	caFile.Close()
+
+	// The handshake fails without the CA.
+	options, err := connectionOptions("cadvisor", "secret", "", "", "", false, nil, "", "", gzip.NoCompression, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newStorage(testConfig(server.URL), options...); err == nil {
+		t.Error("expected the TLS handshake to fail without the CA")
+	}
+
+	options, err = connectionOptions("cadvisor", "secret", caFile.Name(), "", "", false, nil, "", "", gzip.NoCompression, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver, err := newStorage(testConfig(server.URL), options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestStats(t, driver, 2)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if bulks := es.bulkRequests(); len(bulks) != 1 {
+		t.Errorf("expected 1 bulk request, got %d", len(bulks))
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if unauthorized != 0 {
+		t.Errorf("expected all requests to be authenticated, got %d unauthorized requests", unauthorized)
+	}
+}
+
+func TestTypelessIndexTemplate(t *testing.T) {
+	template := indexTemplate("cadvisor", "", schemaCadvisor, 7)
+	if !reflect.DeepEqual(template["index_patterns"], []string{"cadvisor*"}) {
+		t.Errorf("unexpected template patterns %v", template["index_patterns"])
+	}
+	if _, ok := template["template"]; ok {
+		t.Error("expected no template pattern for version 7")
+	}
+	mapping := template["mappings"].(map[string]interface{})
+	if actual := mappingAt(mapping, "machine_name"); !reflect.DeepEqual(actual, map[string]interface{}{"type": "keyword"}) {
+		t.Errorf("expected the mapping not to be nested under a type, got %v", mapping)
+	}
+}
+
+func TestTypelessRequestsOnNewClusters(t *testing.T) {
+	testCases := []struct {
+		version      string
+		expectedType string
+	}{
+		{"2.4.1", "stats"},
+		{"6.8.0", "stats"},
+		{"7.10.2", ""},
+		{"8.1.0", ""},
+	}
+	for _, tc := range testCases {
+		es := &fakeElasticsearch{version: tc.version}
+		driver, closeServer := newRotatedTestStorage(t, es, rotationDaily, 10, 3)
+		if driver.typeName != tc.expectedType {
+			t.Errorf("expected type %q for version %s, got %q", tc.expectedType, tc.version, driver.typeName)
+		}
+		addTestStats(t, driver, 1)
+		if err := driver.Close(); err != nil {
+			t.Fatal(err)
+		}
+		closeServer()
+
+		es.lock.Lock()
+		if !reflect.DeepEqual(es.bulkPaths, []string{"/_bulk"}) {
+			t.Errorf("unexpected bulk request paths %v for version %s", es.bulkPaths, tc.version)
+		}
+		for index := range es.created {
+			if !strings.HasPrefix(index, "cadvisor-") || strings.Contains(index, "/") {
+				t.Errorf("unexpected index creation path %q for version %s", index, tc.version)
+			}
+		}
+		var action map[string]map[string]string
+		if err := json.Unmarshal([]byte(es.bulks[0][0]), &action); err != nil {
+			t.Fatal(err)
+		}
+		if typ, ok := action["index"]["_type"]; typ != tc.expectedType || ok != (tc.expectedType != "") {
+			t.Errorf("unexpected bulk action %s for version %s", es.bulks[0][0], tc.version)
+		}
+		es.lock.Unlock()
+	}
+}
+
+func TestBufferIsReplayedWhenElasticsearchIsBack(t *testing.T) {
+	es := &fakeElasticsearch{unavailable: 1}
+	driver, closeServer := newTestStorage(t, es, 10, 0)
+	defer closeServer()
+
+	addTestStats(t, driver, 4)
+	if err := driver.flush(); !isUnavailable(err) {
+		t.Fatalf("expected ElasticSearch to be unavailable, got %v", err)
+	}
+	if err := driver.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Being unavailable does not count as a failed attempt.
+	if expected, usages := []uint64{0, 1, 2, 3}, es.memoryUsages(t); !reflect.DeepEqual(usages, expected) {
+		t.Errorf("expected documents %v to be replayed in order, got %v", expected, usages)
+	}
+	if driver.Dropped() != 0 {
+		t.Errorf("expected no dropped documents, got %d", driver.Dropped())
+	}
+}
+
+func TestBufferEvictsOldestDocuments(t *testing.T) {
+	es := &fakeElasticsearch{unavailable: -1}
+	driver, closeServer := newTestStorage(t, es, 10, 0)
+	defer closeServer()
+	driver.lock.Lock()
+	driver.bufferSize = 3
+	driver.lock.Unlock()
+
+	ref := info.ContainerReference{Name: "/test"}
+	for i := 0; i < 5; i++ {
+		stats := &info.ContainerStats{Timestamp: time.Now()}
+		stats.Memory.Usage = uint64(i)
+		err := driver.AddStats(ref, stats)
+		if i < 3 && err != nil {
+			t.Fatal(err)
+		}
+		if i >= 3 && err == nil {
+			t.Errorf("expected an error when evicting documents")
+		}
+	}
+	if err := driver.flush(); !isUnavailable(err) {
+		t.Fatalf("expected ElasticSearch to be unavailable, got %v", err)
+	}
+	if driver.Evicted() != 2 {
+		t.Errorf("expected 2 evicted documents, got %d", driver.Evicted())
+	}
+
+	es.setUnavailable(0)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if expected, usages := []uint64{2, 3, 4}, es.memoryUsages(t); !reflect.DeepEqual(usages, expected) {
+		t.Errorf("expected documents %v to be sent, got %v", expected, usages)
+	}
+}
+
+// downTransport fails the requests while the cluster is down, as if its
+// nodes could not be reached.
+type downTransport struct {
+	lock sync.Mutex
+	down bool
+}
+
+func (self *downTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	self.lock.Lock()
+	down := self.down
+	self.lock.Unlock()
+	if down {
+		return nil, fmt.Errorf("dial tcp %s: connection refused", req.URL.Host)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (self *downTransport) setDown(down bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.down = down
+}
+
+func TestRetryOnceAllNodesAreDead(t *testing.T) {
+	es := &fakeElasticsearch{}
+	server := httptest.NewServer(es)
+	defer server.Close()
+	transport := &downTransport{}
+	driver, err := newStorage(testConfig(server.URL),
+		elastic.SetHttpClient(&http.Client{Transport: transport}),
+		elastic.SetHealthcheckTimeoutStartup(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+
+	addTestStats(t, driver, 2)
+	transport.setDown(true)
+	// The failed request marks the only node as dead.
+	for i := 0; i < 2; i++ {
+		if err := driver.flush(); !isUnavailable(err) {
+			t.Fatalf("expected ElasticSearch to be unavailable, got %v", err)
+		}
+	}
+
+	// The periodic health check would only mark the node alive after 30
+	// seconds.
+	transport.setDown(false)
+	for i := 0; i < 2; i++ {
+		if err = driver.flush(); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("expected the documents to be sent once ElasticSearch is back, got %v", err)
+	}
+	if expected, usages := []uint64{0, 1}, es.memoryUsages(t); !reflect.DeepEqual(usages, expected) {
+		t.Errorf("expected documents %v to be sent, got %v", expected, usages)
+	}
+}
+
+func TestCloseGivesUpAfterTimeout(t *testing.T) {
+	es := &fakeElasticsearch{unavailable: -1}
+	driver, closeServer := newTestStorage(t, es, 10, 0)
+	defer closeServer()
+	driver.closeTimeout = time.Second
+
+	addTestStats(t, driver, 2)
+	start := time.Now()
+	if err := driver.Close(); err == nil {
+		t.Error("expected an error when documents cannot be sent before closing")
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("expected Close to give up after about a second, took %v", elapsed)
+	}
+	if len(es.bulkRequests()) != 0 {
+		t.Errorf("expected no document to be indexed")
+	}
+}
+
+func TestDocumentId(t *testing.T) {
+	timestamp := time.Date(2016, time.May, 17, 12, 0, 0, 0, time.UTC)
+	id := documentId("machine", "/docker/abc", timestamp)
+	if len(id) != 40 {
+		t.Errorf("expected a hex encoded SHA-1, got %q", id)
+	}
+	if other := documentId("machine", "/docker/abc", timestamp.In(time.FixedZone("PST", -8*60*60))); other != id {
+		t.Errorf("expected the id not to depend on the time zone, got %q and %q", id, other)
+	}
+	for _, other := range []string{
+		documentId("other", "/docker/abc", timestamp),
+		documentId("machine", "/docker/def", timestamp),
+		documentId("machine", "/docker/abc", timestamp.Add(time.Nanosecond)),
+		// The separators keep concatenations apart.
+		documentId("machine/docker", "abc", timestamp),
+	} {
+		if other == id {
+			t.Errorf("expected ids to differ, got %q twice", id)
+		}
+	}
+}
+
+func TestDocumentIdsAreStableAcrossRetries(t *testing.T) {
+	es := &fakeElasticsearch{}
+	server := httptest.NewServer(es)
+	defer server.Close()
+	driver, err := newStorage(testConfig(server.URL, func(cfg *config) {
+		cfg.documentIds = true
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same stats sent twice, e.g. after a timeout, and the stats of another container.
+	stats := &info.ContainerStats{Timestamp: time.Now()}
+	for _, name := range []string{"/a", "/a", "/b"} {
+		if err := driver.AddStats(info.ContainerReference{Name: name}, stats); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, lines := range es.bulkRequests() {
+		for i := 0; i < len(lines); i += 2 {
+			var action map[string]map[string]string
+			if err := json.Unmarshal([]byte(lines[i]), &action); err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, action["index"]["_id"])
+		}
+	}
+	if len(ids) != 3 {
+		t.Fatalf("expected 3 documents, got %d", len(ids))
+	}
+	if ids[0] == "" || ids[0] != ids[1] || ids[0] == ids[2] {
+		t.Errorf("expected the same stats to have the same id, got %v", ids)
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	es := &fakeElasticsearch{}
+	driver, closeServer := newTestStorage(t, es, 10, 3)
+	defer closeServer()
+
+	addTestStats(t, driver, 2)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Close(); err != nil {
+		t.Errorf("expected closing again to succeed, got %v", err)
+	}
+	if bulks := es.bulkRequests(); len(bulks) != 1 {
+		t.Errorf("expected a single bulk request, got %d", len(bulks))
+	}
+}
+
+// statsBatch returns a batch of stats of n containers.
+func statsBatch(n int) []storage.ContainerStatsPair {
+	batch := make([]storage.ContainerStatsPair, n)
+	for i := range batch {
+		batch[i] = storage.ContainerStatsPair{
+			Ref:   info.ContainerReference{Name: fmt.Sprintf("/container%d", i)},
+			Stats: &info.ContainerStats{Timestamp: time.Now()},
+		}
+	}
+	return batch
+}
+
+func TestAddStatsBatch(t *testing.T) {
+	es := &fakeElasticsearch{}
+	driver, closeServer := newTestStorage(t, es, 1000, 3)
+	defer closeServer()
+
+	batch := append(statsBatch(5), storage.ContainerStatsPair{Ref: info.ContainerReference{Name: "/nil"}})
+	if err := driver.AddStatsBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	docs := 0
+	for _, lines := range es.bulkRequests() {
+		docs += len(lines) / 2
+	}
+	if docs != 5 {
+		t.Errorf("expected the 5 stats to be indexed, got %d documents", docs)
+	}
+}
+
+func benchmarkAddStats(b *testing.B, batched bool) {
+	driver, closeServer := newTestStorage(b, &fakeElasticsearch{}, 1000, 3)
+	defer closeServer()
+	defer driver.Close()
+	batch := statsBatch(500)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if batched {
+			driver.AddStatsBatch(batch)
+			continue
+		}
+		for _, pair := range batch {
+			driver.AddStats(pair.Ref, pair.Stats)
+		}
+	}
+}
+
+func BenchmarkAddStats500Containers(b *testing.B) {
+	benchmarkAddStats(b, false)
+}
+
+func BenchmarkAddStatsBatch500Containers(b *testing.B) {
+	benchmarkAddStats(b, true)
+}
@@ -0,0 +1,76 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Labels set by the kubelet on the containers of pods.
+const (
+	kubernetesPodNameLabel       = "io.kubernetes.pod.name"
+	kubernetesNamespaceLabel     = "io.kubernetes.pod.namespace"
+	kubernetesContainerNameLabel = "io.kubernetes.container.name"
+)
+
+// staticLabels are the labels added to every document, set with
+// -storage_driver_es_static_labels.
+type staticLabels map[string]string
+
+func (self *staticLabels) String() string {
+	var values []string
+	for k, v := range *self {
+		values = append(values, k+"="+v)
+	}
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+func (self *staticLabels) Set(value string) error {
+	*self = staticLabels{}
+	if value == "" {
+		return nil
+	}
+	for _, label := range strings.Split(value, ",") {
+		kv := strings.SplitN(label, "=", 2)
+		key := strings.TrimSpace(kv[0])
+		if len(kv) != 2 || key == "" {
+			return fmt.Errorf("invalid label %q specified in storage_driver_es_static_labels, expected key=value", label)
+		}
+		(*self)[key] = strings.TrimSpace(kv[1])
+	}
+	return nil
+}
+
+// enrichment holds the metadata added to every document. It is computed
+// once when the driver starts.
+type enrichment struct {
+	hostName string
+	labels   map[string]string
+}
+
+// apply adds the metadata to the document of a container with the given
+// labels.
+func (self *enrichment) apply(detail *detailSpec, containerLabels map[string]string) {
+	detail.HostName = self.hostName
+	if len(self.labels) > 0 {
+		detail.Labels = self.labels
+	}
+	detail.KubernetesPodName = containerLabels[kubernetesPodNameLabel]
+	detail.KubernetesNamespace = containerLabels[kubernetesNamespaceLabel]
+	detail.KubernetesContainerName = containerLabels[kubernetesContainerNameLabel]
+}
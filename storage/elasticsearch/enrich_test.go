@@ -0,0 +1,108 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+var kubernetesRef = info.ContainerReference{
+	Name:    "/kubepods/pod1234/abcd",
+	Aliases: []string{"k8s_web_frontend-1_prod_1234_0"},
+	Labels: map[string]string{
+		"io.kubernetes.pod.name":       "frontend-1",
+		"io.kubernetes.pod.namespace":  "prod",
+		"io.kubernetes.container.name": "web",
+	},
+}
+
+// documentFields returns the top-level fields of the document of the stats
+// of ref, sorted.
+func documentFields(t *testing.T, driver *elasticStorage, ref info.ContainerReference) (map[string]interface{}, []string) {
+	b, err := json.Marshal(driver.containerStatsAndDefaultValues(ref, testStats()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		t.Fatal(err)
+	}
+	var fields []string
+	for field := range doc {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return doc, fields
+}
+
+func TestStaticLabels(t *testing.T) {
+	var labels staticLabels
+	if err := labels.Set("cluster=prod, zone=eu-west-1a"); err != nil {
+		t.Fatal(err)
+	}
+	if expected := (staticLabels{"cluster": "prod", "zone": "eu-west-1a"}); !reflect.DeepEqual(labels, expected) {
+		t.Errorf("expected labels %v, got %v", expected, labels)
+	}
+	if labels.String() != "cluster=prod,zone=eu-west-1a" {
+		t.Errorf("unexpected labels %q", labels.String())
+	}
+	for _, value := range []string{"cluster", "=prod", "cluster=prod,,"} {
+		if err := labels.Set(value); err == nil {
+			t.Errorf("expected an error for labels %q", value)
+		}
+	}
+}
+
+func TestDocumentsAreNotEnrichedByDefault(t *testing.T) {
+	driver := &elasticStorage{machineName: "machine"}
+	_, fields := documentFields(t, driver, kubernetesRef)
+	if expected := []string{"container_Name", "container_stats", "machine_name", "timestamp"}; !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected the document fields %v, got %v", expected, fields)
+	}
+}
+
+func TestEnrichedDocuments(t *testing.T) {
+	driver := &elasticStorage{
+		machineName: "cadvisor-x7k2p",
+		enrichment: &enrichment{
+			hostName: "node-1",
+			labels:   map[string]string{"cluster": "prod"},
+		},
+	}
+	doc, _ := documentFields(t, driver, kubernetesRef)
+	expected := map[string]interface{}{
+		"host_name":                 "node-1",
+		"labels":                    map[string]interface{}{"cluster": "prod"},
+		"kubernetes_pod_name":       "frontend-1",
+		"kubernetes_namespace":      "prod",
+		"kubernetes_container_name": "web",
+	}
+	for field, value := range expected {
+		if !reflect.DeepEqual(doc[field], value) {
+			t.Errorf("expected %s to be %v, got %v", field, value, doc[field])
+		}
+	}
+
+	// Containers outside of pods only get the node metadata.
+	_, fields := documentFields(t, driver, info.ContainerReference{Name: "/system.slice/docker.service"})
+	if expected := []string{"container_Name", "container_stats", "host_name", "labels", "machine_name", "timestamp"}; !reflect.DeepEqual(fields, expected) {
+		t.Errorf("expected the document fields %v, got %v", expected, fields)
+	}
+}
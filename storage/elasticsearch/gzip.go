@@ -0,0 +1,79 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// gzipTransport compresses the bodies of the requests sent to ElasticSearch.
+// Bodies smaller than minSize are sent as is, compressing them is not worth
+// the CPU.
+type gzipTransport struct {
+	transport http.RoundTripper
+	level     int
+	minSize   int
+}
+
+func newGzipTransport(transport http.RoundTripper, level, minSize int) (*gzipTransport, error) {
+	if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+		return nil, fmt.Errorf("invalid elasticsearch gzip compression level %d", level)
+	}
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &gzipTransport{
+		transport: transport,
+		level:     level,
+		minSize:   minSize,
+	}, nil
+}
+
+func (self *gzipTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body == nil || req.Header.Get("Content-Encoding") != "" {
+		return self.transport.RoundTrip(req)
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// A RoundTripper must not modify the request it is given.
+	compressed := req.WithContext(req.Context())
+	compressed.Header = make(http.Header, len(req.Header)+1)
+	for k, v := range req.Header {
+		compressed.Header[k] = v
+	}
+	if len(body) >= self.minSize {
+		var buf bytes.Buffer
+		w, _ := gzip.NewWriterLevel(&buf, self.level)
+		if _, err := w.Write(body); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		body = buf.Bytes()
+		compressed.Header.Set("Content-Encoding", "gzip")
+	}
+	compressed.Body = ioutil.NopCloser(bytes.NewReader(body))
+	compressed.ContentLength = int64(len(body))
+	return self.transport.RoundTrip(compressed)
+}
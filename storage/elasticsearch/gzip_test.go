@@ -0,0 +1,200 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+func TestGzipTransport(t *testing.T) {
+	var encoding string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+	transport, err := newGzipTransport(nil, gzip.BestSpeed, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: transport}
+
+	// Small bodies are sent as is.
+	if _, err := client.Post(server.URL, "application/json", strings.NewReader(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if encoding != "" || string(body) != `{}` {
+		t.Errorf("expected the small body to be sent uncompressed, got %q encoded %q", body, encoding)
+	}
+
+	large := strings.Repeat(`{"index":{"_index":"cadvisor"}}`+"\n", 10)
+	if _, err := client.Post(server.URL, "application/json", strings.NewReader(large)); err != nil {
+		t.Fatal(err)
+	}
+	if encoding != "gzip" {
+		t.Fatalf("expected the large body to be compressed, got encoding %q", encoding)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decompressed, err := ioutil.ReadAll(r); err != nil || string(decompressed) != large {
+		t.Errorf("expected the body to decompress to %q, got %q (%v)", large, decompressed, err)
+	}
+	if len(body) >= len(large) {
+		t.Errorf("expected the compressed body to be smaller than %d bytes, got %d", len(large), len(body))
+	}
+
+	if _, err := newGzipTransport(nil, 10, 0); err == nil {
+		t.Error("expected an error for an invalid compression level")
+	}
+}
+
+func TestGzipSignedBulkRequests(t *testing.T) {
+	es := &fakeElasticsearch{}
+	var lock sync.Mutex
+	var errors []error
+	compressed := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		lock.Lock()
+		// The signature covers the compressed body.
+		if err := checkAWSSignature(r, body); err != nil {
+			errors = append(errors, fmt.Errorf("%s %s: %v", r.Method, r.URL, err))
+		}
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			compressed++
+		}
+		lock.Unlock()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		es.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	options, err := connectionOptions("", "", "", "", "", false, testAWSCredentials, "us-east-1", "es", gzip.DefaultCompression, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver, err := newStorage(testConfig(server.URL), options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestStats(t, driver, 3)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if usages := es.memoryUsages(t); len(usages) != 3 {
+		t.Errorf("expected 3 documents to be indexed, got %d", len(usages))
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	for _, err := range errors {
+		t.Error(err)
+	}
+	if compressed == 0 {
+		t.Error("expected the bulk request to be compressed")
+	}
+}
+
+// BenchmarkFlush reports the bytes sent to ElasticSearch to flush the stats
+// of 200 containers.
+func BenchmarkFlush(b *testing.B) {
+	for _, bc := range []struct {
+		name  string
+		level int
+	}{
+		{"identity", gzip.NoCompression},
+		{"gzip-speed", gzip.BestSpeed},
+		{"gzip-default", gzip.DefaultCompression},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			es := &fakeElasticsearch{}
+			var wireBytes int64
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				if strings.HasSuffix(r.URL.Path, "/_bulk") {
+					atomic.AddInt64(&wireBytes, int64(len(body)))
+				}
+				r.Body = ioutil.NopCloser(bytes.NewReader(body))
+				es.ServeHTTP(w, r)
+			}))
+			defer server.Close()
+			options, err := connectionOptions("", "", "", "", "", false, nil, "", "", bc.level, 1024)
+			if err != nil {
+				b.Fatal(err)
+			}
+			driver, err := newStorage(testConfig(server.URL, func(cfg *config) {
+				cfg.bulkSize = 200
+			}), options...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer driver.Close()
+
+			refs := make([]info.ContainerReference, 200)
+			stats := make([]*info.ContainerStats, len(refs))
+			for c := range refs {
+				refs[c] = info.ContainerReference{Name: fmt.Sprintf("/kubepods/burstable/pod%04d/%064x", c, c)}
+				stats[c] = benchmarkStats(c)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for c := range refs {
+					if err := driver.AddStats(refs[c], stats[c]); err != nil {
+						b.Fatal(err)
+					}
+				}
+				if err := driver.flush(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			b.Logf("%d wire bytes/op", atomic.LoadInt64(&wireBytes)/int64(b.N))
+		})
+	}
+}
+
+// benchmarkStats returns the stats of a typical container, varying with seed.
+func benchmarkStats(seed int) *info.ContainerStats {
+	n := uint64(seed + 1)
+	stats := testStats()
+	stats.Cpu.Usage.Total = 987654321 * n
+	stats.Cpu.Usage.PerCpu = make([]uint64, 8)
+	for i := range stats.Cpu.Usage.PerCpu {
+		stats.Cpu.Usage.PerCpu[i] = 123456789*n + uint64(i)*7919
+	}
+	stats.Memory.Usage = 52428800 + 4099*n
+	stats.Memory.WorkingSet = 41943040 + 3079*n
+	stats.Network.InterfaceStats = info.InterfaceStats{Name: "eth0", RxBytes: 123456 * n, RxPackets: 811 * n, TxBytes: 654321 * n, TxPackets: 997 * n}
+	stats.Network.Interfaces = []info.InterfaceStats{stats.Network.InterfaceStats}
+	stats.Filesystem = []info.FsStats{
+		{Device: "/dev/sda1", Limit: 100 << 30, Usage: 20<<30 + 4096*n},
+		{Device: "/dev/sdb1", Limit: 500 << 30, Usage: 300<<30 + 8192*n},
+	}
+	return stats
+}
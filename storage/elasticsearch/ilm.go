@@ -0,0 +1,98 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/golang/glog"
+	"gopkg.in/olivere/elastic.v2"
+)
+
+// isForbidden returns whether err is ElasticSearch refusing a request for
+// lack of credentials or privileges.
+func isForbidden(err error) bool {
+	e, ok := err.(*elastic.Error)
+	return ok && (e.Status == http.StatusUnauthorized || e.Status == http.StatusForbidden)
+}
+
+// initialIndex returns the name of the first index behind a rollover alias.
+// Rollover increments the numeric suffix of the index names.
+func initialIndex(writeAlias string) string {
+	return writeAlias + "-000001"
+}
+
+// lifecycleSettings returns the index settings attaching the ILM policy to the
+// indices behind the write alias, or nil without a policy.
+func lifecycleSettings(writeAlias, ilmPolicy string) map[string]interface{} {
+	if ilmPolicy == "" {
+		return nil
+	}
+	return map[string]interface{}{
+		"index.lifecycle.name":           ilmPolicy,
+		"index.lifecycle.rollover_alias": writeAlias,
+	}
+}
+
+// aliasExists returns whether the write alias points to an index.
+func (self *elasticStorage) aliasExists() (bool, error) {
+	res, err := self.client.PerformRequest("HEAD", "/_alias/"+self.writeAlias, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	return res.StatusCode == http.StatusOK, nil
+}
+
+// bootstrapWriteAlias creates the initial index behind the write alias unless
+// the alias already exists. Later indices are created by rollover, e.g. by
+// the ILM policy, never by the driver.
+func (self *elasticStorage) bootstrapWriteAlias() error {
+	exists, err := self.aliasExists()
+	if isForbidden(err) {
+		// Writing to the alias may be allowed even though reading it is not.
+		glog.Warningf("not allowed to check the ElasticSearch write alias %q, assuming it exists - %s", self.writeAlias, err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check the elasticsearch write alias %q - %s", self.writeAlias, err)
+	}
+	if exists {
+		return nil
+	}
+
+	index := initialIndex(self.writeAlias)
+	body := map[string]interface{}{
+		"aliases": map[string]interface{}{
+			self.writeAlias: map[string]interface{}{"is_write_index": true},
+		},
+	}
+	if settings := lifecycleSettings(self.writeAlias, self.ilmPolicy); settings != nil {
+		body["settings"] = settings
+	}
+	_, err = self.client.PerformRequestWithoutRetries("PUT", "/"+index, nil, body)
+	if err == nil {
+		glog.Infof("created ElasticSearch index %q with the write alias %q", index, self.writeAlias)
+		return nil
+	}
+	// Another cAdvisor may have bootstrapped the alias in the meantime.
+	if exists, _ := self.aliasExists(); exists {
+		return nil
+	}
+	if isForbidden(err) {
+		return fmt.Errorf("not allowed to create the elasticsearch index %q for the write alias %q, create it with the alias as its write index or grant the create_index privilege - %s", index, self.writeAlias, err)
+	}
+	return fmt.Errorf("failed to create the elasticsearch index %q for the write alias %q - %s", index, self.writeAlias, err)
+}
@@ -0,0 +1,241 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/olivere/elastic.v2"
+)
+
+type fixtureResponse struct {
+	status int
+	body   string
+}
+
+// Responses of an ElasticSearch 7.4 cluster recorded for the requests of the
+// driver.
+var (
+	aliasMissing       = fixtureResponse{http.StatusNotFound, ``}
+	aliasFound         = fixtureResponse{http.StatusOK, ``}
+	indexCreated       = fixtureResponse{http.StatusOK, `{"acknowledged":true,"shards_acknowledged":true,"index":"cadvisor-000001"}`}
+	forbiddenAlias     = fixtureResponse{http.StatusForbidden, ``}
+	forbiddenCreate    = fixtureResponse{http.StatusForbidden, `{"error":{"root_cause":[{"type":"security_exception","reason":"action [indices:admin/create] is unauthorized for user [cadvisor]"}],"type":"security_exception","reason":"action [indices:admin/create] is unauthorized for user [cadvisor]"},"status":403}`}
+	indexAlreadyExists = fixtureResponse{http.StatusBadRequest, `{"error":{"root_cause":[{"type":"resource_already_exists_exception","reason":"index [cadvisor-000001/aTk0] already exists","index":"cadvisor-000001"}],"type":"resource_already_exists_exception","reason":"index [cadvisor-000001/aTk0] already exists","index":"cadvisor-000001"},"status":400}`}
+)
+
+// fixtureElasticsearch replays recorded responses, keyed by method and path,
+// and records the requests other than pings and health checks. Successive
+// requests to the same key get the successive responses, the last one being
+// repeated.
+type fixtureElasticsearch struct {
+	lock      sync.Mutex
+	responses map[string][]fixtureResponse
+	requests  []string
+	bodies    map[string]string
+	// Version number reported by the ping, 7.4.2 by default.
+	version string
+}
+
+func (self *fixtureElasticsearch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Path == "/" {
+		version := self.version
+		if version == "" {
+			version = "7.4.2"
+		}
+		fmt.Fprintf(w, `{"name":"es-0","cluster_name":"docker-cluster","version":{"number":%q},"tagline":"You Know, for Search"}`, version)
+		return
+	}
+	body, _ := ioutil.ReadAll(r.Body)
+	key := r.Method + " " + r.URL.Path
+
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.requests = append(self.requests, key)
+	if self.bodies == nil {
+		self.bodies = make(map[string]string)
+	}
+	self.bodies[key] = string(body)
+	responses := self.responses[key]
+	if len(responses) == 0 {
+		w.WriteHeader(http.StatusNotImplemented)
+		return
+	}
+	res := responses[0]
+	if len(responses) > 1 {
+		self.responses[key] = responses[1:]
+	}
+	w.WriteHeader(res.status)
+	w.Write([]byte(res.body))
+}
+
+func (self *fixtureElasticsearch) recordedRequests() []string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.requests
+}
+
+func newAliasTestStorage(es *fixtureElasticsearch, ilmPolicy string) (*elasticStorage, func(), error) {
+	server := httptest.NewServer(es)
+	driver, err := newStorage(testConfig(server.URL, func(cfg *config) {
+		cfg.writeAlias = "cadvisor"
+		cfg.ilmPolicy = ilmPolicy
+	}))
+	if err != nil {
+		server.Close()
+		return nil, nil, err
+	}
+	return driver, server.Close, nil
+}
+
+func TestWriteAliasIsBootstrapped(t *testing.T) {
+	es := &fixtureElasticsearch{responses: map[string][]fixtureResponse{
+		"HEAD /_alias/cadvisor": {aliasMissing},
+		"PUT /cadvisor-000001":  {indexCreated},
+		"POST /_bulk":           {{http.StatusOK, `{"took":3,"errors":false,"items":[{"index":{"_index":"cadvisor-000001","_id":"1","status":201}}]}`}},
+	}}
+	driver, closeServer, err := newAliasTestStorage(es, "cadvisor-30d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeServer()
+
+	if index := driver.indexFor(nil, time.Now()); index != "cadvisor" {
+		t.Errorf("expected the stats to be written to the alias, got %q", index)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal([]byte(es.bodies["PUT /cadvisor-000001"]), &body); err != nil {
+		t.Fatalf("expected the initial index to be created: %v", err)
+	}
+	expected := map[string]interface{}{
+		"aliases": map[string]interface{}{
+			"cadvisor": map[string]interface{}{"is_write_index": true},
+		},
+		"settings": map[string]interface{}{
+			"index.lifecycle.name":           "cadvisor-30d",
+			"index.lifecycle.rollover_alias": "cadvisor",
+		},
+	}
+	if !reflect.DeepEqual(body, expected) {
+		t.Errorf("expected the initial index to be created with\n%v\ngot\n%v", expected, body)
+	}
+
+	addTestStats(t, driver, 1)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(es.bodies["POST /_bulk"], `"_index":"cadvisor"`) {
+		t.Errorf("expected the document to be indexed through the alias, got %s", es.bodies["POST /_bulk"])
+	}
+}
+
+func TestExistingWriteAliasIsKept(t *testing.T) {
+	es := &fixtureElasticsearch{responses: map[string][]fixtureResponse{
+		"HEAD /_alias/cadvisor": {aliasFound},
+	}}
+	driver, closeServer, err := newAliasTestStorage(es, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeServer()
+	driver.Close()
+
+	if requests := es.recordedRequests(); !reflect.DeepEqual(requests, []string{"HEAD /_alias/cadvisor"}) {
+		t.Errorf("expected only the alias to be checked, got %v", requests)
+	}
+}
+
+func TestConcurrentlyBootstrappedWriteAlias(t *testing.T) {
+	es := &fixtureElasticsearch{responses: map[string][]fixtureResponse{
+		"HEAD /_alias/cadvisor": {aliasMissing, aliasFound},
+		"PUT /cadvisor-000001":  {indexAlreadyExists},
+	}}
+	driver, closeServer, err := newAliasTestStorage(es, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeServer()
+	driver.Close()
+}
+
+func TestWriteAliasPermissionDenied(t *testing.T) {
+	// The alias cannot be checked, the driver writes to it anyway.
+	es := &fixtureElasticsearch{responses: map[string][]fixtureResponse{
+		"HEAD /_alias/cadvisor": {forbiddenAlias},
+	}}
+	driver, closeServer, err := newAliasTestStorage(es, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeServer()
+	driver.Close()
+
+	// The missing alias cannot be bootstrapped.
+	es = &fixtureElasticsearch{responses: map[string][]fixtureResponse{
+		"HEAD /_alias/cadvisor": {aliasMissing},
+		"PUT /cadvisor-000001":  {forbiddenCreate},
+	}}
+	_, _, err = newAliasTestStorage(es, "")
+	if err == nil || !strings.Contains(err.Error(), "not allowed to create") {
+		t.Errorf("expected a permission error, got %v", err)
+	}
+}
+
+func TestWriteAliasValidation(t *testing.T) {
+	if _, err := newStorage(testConfig("http://localhost:9200", func(cfg *config) {
+		cfg.indexRotation = rotationDaily
+		cfg.writeAlias = "cadvisor"
+	})); err == nil {
+		t.Error("expected an error for a write alias with index rotation")
+	}
+	if _, err := newStorage(testConfig("http://localhost:9200", func(cfg *config) {
+		cfg.ilmPolicy = "cadvisor-30d"
+	})); err == nil {
+		t.Error("expected an error for an ILM policy without a write alias")
+	}
+}
+
+func TestWriteAliasTemplate(t *testing.T) {
+	es := &fakeElasticsearch{version: "7.4.2"}
+	server := httptest.NewServer(es)
+	defer server.Close()
+	client, err := elastic.NewClient(elastic.SetURL(server.URL), elastic.SetSniff(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver := &elasticStorage{client: client, indexName: "cadvisor", writeAlias: "metrics", ilmPolicy: "metrics-30d", esMajorVersion: 7}
+
+	driver.installIndexTemplate()
+	var template map[string]interface{}
+	if err := json.Unmarshal([]byte(es.installedTemplates()["metrics"]), &template); err != nil {
+		t.Fatalf("expected the metrics template to be installed: %v", err)
+	}
+	if patterns := template["index_patterns"]; !reflect.DeepEqual(patterns, []interface{}{"metrics-*"}) {
+		t.Errorf("unexpected template patterns %v", patterns)
+	}
+	if settings := template["settings"].(map[string]interface{}); settings["index.lifecycle.name"] != "metrics-30d" || settings["index.lifecycle.rollover_alias"] != "metrics" {
+		t.Errorf("unexpected template settings %v", settings)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	storage "github.com/google/cadvisor/storage"
+
+	"github.com/golang/glog"
+)
+
+// Values of the kind field of the documents when the machine documents are
+// written to the index of the container stats.
+const (
+	kindContainer = "container"
+	kindMachine   = "machine"
+)
+
+// machineSpec is the document holding the information about the machine.
+type machineSpec struct {
+	// Microseconds since the epoch, replaced by @timestamp in data streams
+	// and with the ECS schema.
+	Timestamp           int64               `json:"timestamp,omitempty"`
+	DataStreamTimestamp *time.Time          `json:"@timestamp,omitempty"`
+	Kind                string              `json:"kind,omitempty"`
+	MachineName         string              `json:"machine_name,omitempty"`
+	NumCores            int                 `json:"num_cores"`
+	CpuFrequency        uint64              `json:"cpu_frequency_khz"`
+	MemoryCapacity      uint64              `json:"memory_capacity"`
+	Topology            []info.Node         `json:"topology,omitempty"`
+	Filesystems         []machineFilesystem `json:"filesystems,omitempty"`
+	CadvisorVersion     string              `json:"cadvisor_version,omitempty"`
+	DockerVersion       string              `json:"docker_version,omitempty"`
+	KernelVersion       string              `json:"kernel_version,omitempty"`
+	ContainerOsVersion  string              `json:"container_os_version,omitempty"`
+}
+
+type machineFilesystem struct {
+	Device     string `json:"device"`
+	Mountpoint string `json:"mountpoint,omitempty"`
+	Capacity   uint64 `json:"capacity"`
+	Usage      uint64 `json:"usage"`
+	Available  uint64 `json:"available"`
+}
+
+// sharesMachineIndex returns whether the machine documents are written to
+// the index of the container stats.
+func (self *elasticStorage) sharesMachineIndex() bool {
+	return self.machineInterval > 0 && self.machineIndex == ""
+}
+
+// SetMachineInfoSource starts writing machine documents every machineInterval,
+// unless it is 0.
+func (self *elasticStorage) SetMachineInfoSource(source storage.MachineInfoSource) {
+	if self.machineInterval <= 0 {
+		return
+	}
+	// Closing the driver does not wait for a slow collection to finish.
+	go self.machineReporter(source)
+}
+
+// machineReporter buffers a machine document every machineInterval. The
+// documents are sent along with the container stats; collecting them does
+// not hold up flushes.
+func (self *elasticStorage) machineReporter(source storage.MachineInfoSource) {
+	ticker := time.NewTicker(self.machineInterval)
+	defer ticker.Stop()
+	for {
+		doc, err := self.machineDocument(source, time.Now())
+		if err != nil {
+			glog.Errorf("failed to collect the machine information for ElasticSearch - %s", err)
+		} else {
+			self.addMachineDocument(doc)
+		}
+		select {
+		case <-ticker.C:
+		case <-self.stopCh:
+			return
+		}
+	}
+}
+
+// machineDocument returns the machine document at timestamp. The
+// filesystems are left out if their usage is not available.
+func (self *elasticStorage) machineDocument(source storage.MachineInfoSource, timestamp time.Time) (*pendingDoc, error) {
+	machineInfo, err := source.GetMachineInfo()
+	if err != nil {
+		return nil, err
+	}
+	versionInfo, err := source.GetVersionInfo()
+	if err != nil {
+		return nil, err
+	}
+	spec := &machineSpec{
+		Timestamp:          timestamp.UnixNano() / 1E3,
+		MachineName:        self.machineName,
+		NumCores:           machineInfo.NumCores,
+		CpuFrequency:       machineInfo.CpuFrequency,
+		MemoryCapacity:     machineInfo.MemoryCapacity,
+		Topology:           machineInfo.Topology,
+		CadvisorVersion:    versionInfo.CadvisorVersion,
+		DockerVersion:      versionInfo.DockerVersion,
+		KernelVersion:      versionInfo.KernelVersion,
+		ContainerOsVersion: versionInfo.ContainerOsVersion,
+	}
+	if filesystems, err := source.GetFsInfo(""); err != nil {
+		glog.Warningf("failed to get the filesystems usage for ElasticSearch - %s", err)
+	} else {
+		for _, fs := range filesystems {
+			spec.Filesystems = append(spec.Filesystems, machineFilesystem{
+				Device:     fs.Device,
+				Mountpoint: fs.Mountpoint,
+				Capacity:   fs.Capacity,
+				Usage:      fs.Usage,
+				Available:  fs.Available,
+			})
+		}
+	}
+	if self.dataStream != "" || self.schema == schemaECS {
+		utc := timestamp.UTC()
+		spec.Timestamp = 0
+		spec.DataStreamTimestamp = &utc
+	}
+
+	index := self.machineIndex
+	if index == "" {
+		index = self.indexFor(nil, timestamp)
+		spec.Kind = kindMachine
+	} else {
+		index = self.rotatedIndex(index, timestamp)
+	}
+	doc := &pendingDoc{
+		index:     index,
+		container: "machine",
+		detail:    spec,
+	}
+	if self.documentIds {
+		doc.id = documentId(self.machineName, "", timestamp)
+	}
+	return doc, nil
+}
+
+func (self *elasticStorage) addMachineDocument(doc *pendingDoc) {
+	self.lock.Lock()
+	self.pending = append(self.pending, doc)
+	evicted := self.evictOverflow()
+	self.lock.Unlock()
+	if evicted > 0 {
+		glog.Warningf("elasticsearch buffer is full, evicted the %d oldest documents (%d evicted in total)", evicted, self.Evicted())
+	}
+}
@@ -0,0 +1,208 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/info/v2"
+)
+
+// fakeMachineInfoSource returns fixed machine information, after release is
+// closed if it is set.
+type fakeMachineInfoSource struct {
+	release chan struct{}
+}
+
+func (self *fakeMachineInfoSource) GetMachineInfo() (*info.MachineInfo, error) {
+	if self.release != nil {
+		<-self.release
+	}
+	return &info.MachineInfo{
+		NumCores:       4,
+		CpuFrequency:   2400000,
+		MemoryCapacity: 8 << 30,
+		Topology:       []info.Node{{Id: 0, Memory: 8 << 30, Cores: []info.Core{{Id: 0, Threads: []int{0, 1}}}}},
+	}, nil
+}
+
+func (self *fakeMachineInfoSource) GetVersionInfo() (*info.VersionInfo, error) {
+	return &info.VersionInfo{CadvisorVersion: "0.23.0", DockerVersion: "1.11.1", KernelVersion: "4.4.0"}, nil
+}
+
+func (self *fakeMachineInfoSource) GetFsInfo(label string) ([]v2.FsInfo, error) {
+	return []v2.FsInfo{{Device: "/dev/sda1", Mountpoint: "/", Capacity: 100, Usage: 40, Available: 60}}, nil
+}
+
+// waitForPending waits until the driver buffers n documents.
+func waitForPending(t *testing.T, driver *elasticStorage, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		driver.lock.Lock()
+		pending := len(driver.pending)
+		driver.lock.Unlock()
+		if pending >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d buffered documents, got %d", n, pending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// sentDocuments returns the index and source of the documents sent, in order.
+func sentDocuments(t *testing.T, es *fakeElasticsearch) ([]string, []map[string]interface{}) {
+	var indices []string
+	var docs []map[string]interface{}
+	for _, lines := range es.bulkRequests() {
+		for i := 0; i+1 < len(lines); i += 2 {
+			var action map[string]map[string]interface{}
+			if err := json.Unmarshal([]byte(lines[i]), &action); err != nil {
+				t.Fatal(err)
+			}
+			indices = append(indices, fmt.Sprint(action["index"]["_index"]))
+			var doc map[string]interface{}
+			if err := json.Unmarshal([]byte(lines[i+1]), &doc); err != nil {
+				t.Fatal(err)
+			}
+			docs = append(docs, doc)
+		}
+	}
+	return indices, docs
+}
+
+func TestMachineDocumentsInStatsIndex(t *testing.T) {
+	es := &fakeElasticsearch{}
+	driver, closeServer := newTestStorage(t, es, 10, 3)
+	defer closeServer()
+	driver.machineInterval = time.Hour
+
+	driver.SetMachineInfoSource(&fakeMachineInfoSource{})
+	waitForPending(t, driver, 1)
+	addTestStats(t, driver, 1)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	indices, docs := sentDocuments(t, es)
+	if len(docs) != 2 {
+		t.Fatalf("expected 2 documents, got %d", len(docs))
+	}
+	for i, kind := range []string{kindMachine, kindContainer} {
+		if indices[i] != "cadvisor" {
+			t.Errorf("expected the %s document in the stats index, got %q", kind, indices[i])
+		}
+		if docs[i]["kind"] != kind {
+			t.Errorf("expected a %s document, got kind %v", kind, docs[i]["kind"])
+		}
+	}
+	machine := docs[0]
+	for field, value := range map[string]interface{}{
+		"machine_name":      "machine",
+		"num_cores":         float64(4),
+		"cpu_frequency_khz": float64(2400000),
+		"memory_capacity":   float64(8 << 30),
+		"cadvisor_version":  "0.23.0",
+		"docker_version":    "1.11.1",
+	} {
+		if machine[field] != value {
+			t.Errorf("expected %s to be %v, got %v", field, value, machine[field])
+		}
+	}
+	filesystems, _ := machine["filesystems"].([]interface{})
+	if len(filesystems) != 1 || filesystems[0].(map[string]interface{})["device"] != "/dev/sda1" {
+		t.Errorf("expected the /dev/sda1 filesystem, got %v", machine["filesystems"])
+	}
+	if topology, _ := machine["topology"].([]interface{}); len(topology) != 1 {
+		t.Errorf("expected one NUMA node in the topology, got %v", machine["topology"])
+	}
+}
+
+func TestMachineDocumentsInMachineIndex(t *testing.T) {
+	es := &fakeElasticsearch{}
+	driver, closeServer := newRotatedTestStorage(t, es, rotationDaily, 10, 3)
+	defer closeServer()
+	driver.machineInterval = time.Hour
+	driver.machineIndex = "cadvisor-machines"
+
+	driver.SetMachineInfoSource(&fakeMachineInfoSource{})
+	waitForPending(t, driver, 1)
+	addTestStats(t, driver, 1)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	indices, docs := sentDocuments(t, es)
+	if len(docs) != 2 {
+		t.Fatalf("expected 2 documents, got %d", len(docs))
+	}
+	if !strings.HasPrefix(indices[0], "cadvisor-machines-") {
+		t.Errorf("expected the machine document in the rotated machine index, got %q", indices[0])
+	}
+	if strings.HasPrefix(indices[1], "cadvisor-machines") {
+		t.Errorf("expected the container document in the stats index, got %q", indices[1])
+	}
+	for _, doc := range docs {
+		if _, ok := doc["kind"]; ok {
+			t.Errorf("expected no kind field in separate indices, got %v", doc["kind"])
+		}
+	}
+}
+
+func TestMachineDocumentsDisabled(t *testing.T) {
+	es := &fakeElasticsearch{}
+	driver, closeServer := newTestStorage(t, es, 10, 3)
+	defer closeServer()
+
+	driver.SetMachineInfoSource(&fakeMachineInfoSource{})
+	addTestStats(t, driver, 1)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	_, docs := sentDocuments(t, es)
+	if len(docs) != 1 {
+		t.Fatalf("expected only the container document, got %d documents", len(docs))
+	}
+	if _, ok := docs[0]["kind"]; ok {
+		t.Errorf("expected no kind field without machine documents, got %v", docs[0]["kind"])
+	}
+}
+
+func TestSlowMachineInfoDoesNotBlockFlushes(t *testing.T) {
+	es := &fakeElasticsearch{}
+	driver, closeServer := newTestStorage(t, es, 10, 3)
+	defer closeServer()
+	driver.machineInterval = time.Hour
+
+	source := &fakeMachineInfoSource{release: make(chan struct{})}
+	defer close(source.release)
+	driver.SetMachineInfoSource(source)
+	addTestStats(t, driver, 2)
+	if err := driver.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, docs := sentDocuments(t, es); len(docs) != 2 {
+		t.Errorf("expected the container documents to be sent while the machine information is collected, got %d documents", len(docs))
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// Groups of stats which can be selected with -storage_driver_es_metrics.
+const (
+	metricCpu        = "cpu"
+	metricPerCpu     = "percpu"
+	metricMemory     = "memory"
+	metricNetwork    = "network"
+	metricDiskIo     = "diskio"
+	metricFilesystem = "filesystem"
+	metricTasks      = "tasks"
+	metricCustom     = "custom"
+)
+
+var supportedMetrics = map[string]bool{
+	metricCpu:        true,
+	metricPerCpu:     true,
+	metricMemory:     true,
+	metricNetwork:    true,
+	metricDiskIo:     true,
+	metricFilesystem: true,
+	metricTasks:      true,
+	metricCustom:     true,
+}
+
+// metricGroups is the set of stat groups indexed. An empty set means all of
+// them.
+type metricGroups map[string]bool
+
+func (self *metricGroups) String() string {
+	var values []string
+	for metric := range *self {
+		values = append(values, metric)
+	}
+	sort.Strings(values)
+	return strings.Join(values, ",")
+}
+
+func (self *metricGroups) Set(value string) error {
+	*self = metricGroups{}
+	if value == "" {
+		return nil
+	}
+	for _, metric := range strings.Split(value, ",") {
+		metric = strings.TrimSpace(metric)
+		if !supportedMetrics[metric] {
+			return fmt.Errorf("unsupported metric %q specified in storage_driver_es_metrics", metric)
+		}
+		(*self)[metric] = true
+	}
+	return nil
+}
+
+func (self metricGroups) has(metric string) bool {
+	return len(self) == 0 || self[metric]
+}
+
+// indexedStats holds the groups of info.ContainerStats which are indexed and
+// serializes them the same way. Groups which are not indexed are nil.
+type indexedStats struct {
+	Timestamp     time.Time                   `json:"timestamp"`
+	Cpu           *info.CpuStats              `json:"cpu,omitempty"`
+	DiskIo        *info.DiskIoStats           `json:"diskio,omitempty"`
+	Memory        *info.MemoryStats           `json:"memory,omitempty"`
+	Network       *info.NetworkStats          `json:"network,omitempty"`
+	Filesystem    []info.FsStats              `json:"filesystem,omitempty"`
+	TaskStats     *info.LoadStats             `json:"task_stats,omitempty"`
+	CustomMetrics map[string][]info.MetricVal `json:"custom_metrics,omitempty"`
+}
+
+// filter returns the groups of stats which are indexed. The per-cpu usage is
+// only indexed along with the cpu stats.
+func (self metricGroups) filter(stats *info.ContainerStats) *indexedStats {
+	ret := &indexedStats{
+		Timestamp: stats.Timestamp,
+	}
+	if self.has(metricCpu) {
+		cpu := stats.Cpu
+		if !self.has(metricPerCpu) {
+			cpu.Usage.PerCpu = nil
+		}
+		ret.Cpu = &cpu
+	}
+	if self.has(metricDiskIo) {
+		ret.DiskIo = &stats.DiskIo
+	}
+	if self.has(metricMemory) {
+		ret.Memory = &stats.Memory
+	}
+	if self.has(metricNetwork) {
+		ret.Network = &stats.Network
+	}
+	if self.has(metricFilesystem) {
+		ret.Filesystem = stats.Filesystem
+	}
+	if self.has(metricTasks) {
+		ret.TaskStats = &stats.TaskStats
+	}
+	if self.has(metricCustom) {
+		ret.CustomMetrics = stats.CustomMetrics
+	}
+	return ret
+}
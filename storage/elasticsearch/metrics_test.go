@@ -0,0 +1,107 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+func testStats() *info.ContainerStats {
+	stats := &info.ContainerStats{Timestamp: time.Date(2016, time.May, 17, 12, 0, 0, 0, time.UTC)}
+	stats.Cpu.Usage.Total = 100
+	stats.Cpu.Usage.PerCpu = []uint64{40, 60}
+	stats.Memory.WorkingSet = 1024
+	stats.Network.RxBytes = 10
+	stats.DiskIo.IoServiced = []info.PerDiskStats{{Major: 8, Stats: map[string]uint64{"Read": 1}}}
+	stats.Filesystem = []info.FsStats{{Device: "/dev/sda1", Usage: 20}}
+	stats.TaskStats.NrRunning = 2
+	stats.CustomMetrics = map[string][]info.MetricVal{"requests": {{IntValue: 3}}}
+	return stats
+}
+
+// serialize returns the stats indexed for the given metrics, as decoded JSON.
+func serialize(t *testing.T, metrics string) map[string]interface{} {
+	var groups metricGroups
+	if err := groups.Set(metrics); err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(groups.filter(testStats()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ret map[string]interface{}
+	if err := json.Unmarshal(b, &ret); err != nil {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func TestMetricGroupsValidation(t *testing.T) {
+	var groups metricGroups
+	if err := groups.Set("cpu, memory,network"); err != nil {
+		t.Fatal(err)
+	}
+	if groups.String() != "cpu,memory,network" {
+		t.Errorf("unexpected metric groups %q", groups.String())
+	}
+	if err := groups.Set("cpu,disk"); err == nil {
+		t.Error("expected an error for an unknown metric group")
+	}
+}
+
+func TestAllMetricsAreIndexedByDefault(t *testing.T) {
+	b, err := json.Marshal(testStats())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected map[string]interface{}
+	if err := json.Unmarshal(b, &expected); err != nil {
+		t.Fatal(err)
+	}
+	if actual := serialize(t, ""); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected the stats to be serialized as\n%v\ngot\n%v", expected, actual)
+	}
+}
+
+func TestExcludedMetricsAreOmitted(t *testing.T) {
+	actual := serialize(t, "cpu,memory")
+	for _, key := range []string{"timestamp", "cpu", "memory"} {
+		if _, ok := actual[key]; !ok {
+			t.Errorf("expected %q to be serialized", key)
+		}
+	}
+	for _, key := range []string{"diskio", "network", "filesystem", "task_stats", "custom_metrics"} {
+		if _, ok := actual[key]; ok {
+			t.Errorf("expected %q not to be serialized", key)
+		}
+	}
+	usage := actual["cpu"].(map[string]interface{})["usage"].(map[string]interface{})
+	if _, ok := usage["per_cpu_usage"]; ok {
+		t.Error("expected the per-cpu usage not to be serialized")
+	}
+	if usage["total"] != float64(100) {
+		t.Errorf("expected the total cpu usage to be serialized, got %v", usage)
+	}
+
+	usage = serialize(t, "cpu,percpu")["cpu"].(map[string]interface{})["usage"].(map[string]interface{})
+	if _, ok := usage["per_cpu_usage"]; !ok {
+		t.Error("expected the per-cpu usage to be serialized")
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/golang/glog"
+)
+
+// checkPipeline checks that the ingest pipeline the documents go through
+// exists, since ElasticSearch rejects all of them otherwise.
+func (self *elasticStorage) checkPipeline() error {
+	res, err := self.client.PerformRequest("GET", "/_ingest/pipeline/"+self.pipeline, nil, nil)
+	if isForbidden(err) {
+		glog.Warningf("not allowed to check the ElasticSearch ingest pipeline %q, assuming it exists - %s", self.pipeline, err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check the elasticsearch ingest pipeline %q - %s", self.pipeline, err)
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("the elasticsearch ingest pipeline %q does not exist", self.pipeline)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"gopkg.in/olivere/elastic.v2"
+)
+
+// recordingTransport records the URLs of the requests it sends.
+type recordingTransport struct {
+	lock sync.Mutex
+	urls []*url.URL
+}
+
+func (self *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	self.lock.Lock()
+	self.urls = append(self.urls, req.URL)
+	self.lock.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func (self *recordingTransport) recordedURLs(path string) []*url.URL {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var ret []*url.URL
+	for _, u := range self.urls {
+		if u.Path == path {
+			ret = append(ret, u)
+		}
+	}
+	return ret
+}
+
+func newPipelineTestStorage(es *fixtureElasticsearch, transport http.RoundTripper) (*elasticStorage, func(), error) {
+	server := httptest.NewServer(es)
+	driver, err := newStorage(testConfig(server.URL, func(cfg *config) {
+		cfg.pipeline = "geoip"
+	}), elastic.SetHttpClient(&http.Client{Transport: transport}))
+	if err != nil {
+		server.Close()
+		return nil, nil, err
+	}
+	return driver, server.Close, nil
+}
+
+func TestBulkRequestsGoThroughThePipeline(t *testing.T) {
+	es := &fixtureElasticsearch{responses: map[string][]fixtureResponse{
+		"GET /_ingest/pipeline/geoip": {{http.StatusOK, `{"geoip":{"description":"Add the location of the node","processors":[{"geoip":{"field":"ip"}}]}}`}},
+		"POST /_bulk":                 {{http.StatusOK, `{"took":3,"errors":false,"items":[{"index":{"_index":"cadvisor","_id":"1","status":201}},{"index":{"_index":"cadvisor","_id":"2","status":201}}]}`}},
+	}}
+	transport := &recordingTransport{}
+	driver, closeServer, err := newPipelineTestStorage(es, transport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeServer()
+
+	addTestStats(t, driver, 2)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	bulks := transport.recordedURLs("/_bulk")
+	if len(bulks) != 1 {
+		t.Fatalf("expected 1 bulk request, got %d", len(bulks))
+	}
+	if pipeline := bulks[0].Query().Get("pipeline"); pipeline != "geoip" {
+		t.Errorf("expected the bulk request to go through the geoip pipeline, got %q", bulks[0])
+	}
+}
+
+func TestMissingPipeline(t *testing.T) {
+	es := &fixtureElasticsearch{responses: map[string][]fixtureResponse{
+		"GET /_ingest/pipeline/geoip": {{http.StatusNotFound, `{}`}},
+	}}
+	_, _, err := newPipelineTestStorage(es, &recordingTransport{})
+	if err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("expected an error for the missing pipeline, got %v", err)
+	}
+}
+
+func TestPipelineCheckPermissionDenied(t *testing.T) {
+	es := &fixtureElasticsearch{responses: map[string][]fixtureResponse{
+		"GET /_ingest/pipeline/geoip": {{http.StatusForbidden, `{"error":{"root_cause":[{"type":"security_exception","reason":"action [cluster:admin/ingest/pipeline/get] is unauthorized for user [cadvisor]"}],"type":"security_exception","reason":"action [cluster:admin/ingest/pipeline/get] is unauthorized for user [cadvisor]"},"status":403}`}},
+	}}
+	driver, closeServer, err := newPipelineTestStorage(es, &recordingTransport{})
+	if err != nil {
+		t.Fatalf("expected the driver to start without checking the pipeline, got %v", err)
+	}
+	defer closeServer()
+	driver.Close()
+}
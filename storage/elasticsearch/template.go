@@ -0,0 +1,170 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package elasticsearch
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// majorVersion returns the major version of an ElasticSearch version number
+// such as "2.4.1", or 0 if it cannot be parsed.
+func majorVersion(number string) int {
+	major, err := strconv.Atoi(strings.SplitN(number, ".", 2)[0])
+	if err != nil {
+		return 0
+	}
+	return major
+}
+
+// keywordMapping returns the mapping of strings which are matched exactly
+// rather than analyzed as full text.
+func keywordMapping(esMajorVersion int) map[string]interface{} {
+	if esMajorVersion >= 5 {
+		return map[string]interface{}{"type": "keyword"}
+	}
+	return map[string]interface{}{"type": "string", "index": "not_analyzed"}
+}
+
+// typeMapping returns the mapping of values of type t once serialized to
+// JSON, or nil if the type is left to dynamic mapping.
+func typeMapping(t reflect.Type, esMajorVersion int) map[string]interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "date"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		// Arrays are mapped as their elements.
+		return typeMapping(t.Elem(), esMajorVersion)
+	case reflect.Struct:
+		properties := structProperties(t, esMajorVersion)
+		if len(properties) == 0 {
+			return nil
+		}
+		return map[string]interface{}{"properties": properties}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "long"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "double"}
+	case reflect.String:
+		return keywordMapping(esMajorVersion)
+	}
+	// Maps have arbitrary keys, leave them to the dynamic templates.
+	return nil
+}
+
+// structProperties returns the mapping of the fields of the struct type t,
+// keyed by their JSON names.
+func structProperties(t reflect.Type, esMajorVersion int) map[string]interface{} {
+	properties := make(map[string]interface{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			// Unexported fields are not serialized.
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.SplitN(tag, ",", 2)[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			// Fields of embedded structs are serialized inline.
+			for k, v := range structProperties(field.Type, esMajorVersion) {
+				properties[k] = v
+			}
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if mapping := typeMapping(field.Type, esMajorVersion); mapping != nil {
+			properties[name] = mapping
+		}
+	}
+	return properties
+}
+
+// indexTemplate returns an index template applying the mapping of the
+// documents written by the driver with the given schema to all indices
+// starting with indexName. The mapping is not nested under a type when
+// typeName is empty.
+func indexTemplate(indexName, typeName, schema string, esMajorVersion int) map[string]interface{} {
+	properties := structProperties(reflect.TypeOf(detailSpec{}), esMajorVersion)
+	if schema == schemaECS {
+		properties = ecsMapping(esMajorVersion)
+	}
+	mapping := map[string]interface{}{
+		// Strings which are not part of the stats, e.g. custom metric
+		// names, are matched exactly too.
+		"dynamic_templates": []interface{}{
+			map[string]interface{}{
+				"strings_as_keywords": map[string]interface{}{
+					"match_mapping_type": "string",
+					"mapping":            keywordMapping(esMajorVersion),
+				},
+			},
+		},
+		"properties": properties,
+	}
+	template := map[string]interface{}{
+		"mappings": map[string]interface{}{
+			typeName: mapping,
+		},
+	}
+	if typeName == "" {
+		template["mappings"] = mapping
+	}
+	// The index name pattern was renamed in 6.0.
+	if esMajorVersion >= 6 {
+		template["index_patterns"] = []string{indexName + "*"}
+	} else {
+		template["template"] = indexName + "*"
+	}
+	return template
+}
+
+// installIndexTemplate installs the index template of the driver. Failing to
+// do so is not fatal since ElasticSearch still maps the documents dynamically.
+// With a write alias, the template applies to the indices created by rollover
+// and attaches the ILM policy to them.
+func (self *elasticStorage) installIndexTemplate() {
+	name, pattern := self.indexName, self.indexName
+	if self.writeAlias != "" {
+		name, pattern = self.writeAlias, self.writeAlias+"-"
+	}
+	body := indexTemplate(pattern, self.typeName, self.schema, self.esMajorVersion)
+	if settings := lifecycleSettings(self.writeAlias, self.ilmPolicy); settings != nil {
+		body["settings"] = settings
+	}
+	_, err := self.client.IndexPutTemplate(name).BodyJson(body).Do()
+	if err == nil {
+		return
+	}
+	if isForbidden(err) {
+		glog.Warningf("not allowed to install the ElasticSearch index template %q, skipping it - %s", name, err)
+		return
+	}
+	glog.Warningf("failed to install the ElasticSearch index template %q - %s", name, err)
+}
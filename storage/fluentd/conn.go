@@ -0,0 +1,179 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fluentd
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	dialTimeout      = 5 * time.Second
+	handshakeTimeout = 10 * time.Second
+	writeTimeout     = 10 * time.Second
+)
+
+// dialOptions are how to connect and authenticate to the server.
+type dialOptions struct {
+	// host:port, or unix:// followed by the path of a socket.
+	address string
+	// Shared key of the handshake, no handshake if empty.
+	sharedKey string
+	// Hostname sent in the handshake.
+	hostname string
+	// User authenticated in the handshake, if required by the server.
+	username string
+	password string
+}
+
+// network returns the network and the address to dial.
+func (self dialOptions) network() (string, string) {
+	if strings.HasPrefix(self.address, "unix://") {
+		return "unix", strings.TrimPrefix(self.address, "unix://")
+	}
+	return "tcp", self.address
+}
+
+// conn is a connection to a server of the forward protocol, e.g. Fluentd
+// or Fluent Bit.
+type conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dial connects to the server, and authenticates if a shared key is set.
+func dial(options dialOptions) (*conn, error) {
+	network, address := options.network()
+	c, err := net.DialTimeout(network, address, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	ret := &conn{conn: c, reader: bufio.NewReader(c)}
+	if options.sharedKey != "" {
+		if err := ret.handshake(options); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// digest returns the hex SHA-512 of the concatenated parts.
+func digest(parts ...string) string {
+	hash := sha512.New()
+	for _, p := range parts {
+		hash.Write([]byte(p))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// handshake answers the HELO of the server with a PING, and checks its
+// PONG, which proves that the server knows the shared key too.
+func (self *conn) handshake(options dialOptions) error {
+	self.conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	defer self.conn.SetDeadline(time.Time{})
+	helo, err := self.readMessage("HELO", 2)
+	if err != nil {
+		return err
+	}
+	heloOptions, ok := helo[1].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("invalid HELO options %v", helo[1])
+	}
+	nonce, _ := heloOptions["nonce"].(string)
+	authSalt, _ := heloOptions["auth"].(string)
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	sharedKeySalt := hex.EncodeToString(salt)
+	passwordDigest := ""
+	if authSalt != "" {
+		passwordDigest = digest(authSalt, options.username, options.password)
+	}
+	ping, err := appendValue(nil, []interface{}{
+		"PING",
+		options.hostname,
+		sharedKeySalt,
+		digest(sharedKeySalt, options.hostname, nonce, options.sharedKey),
+		options.username,
+		passwordDigest,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := self.conn.Write(ping); err != nil {
+		return err
+	}
+
+	pong, err := self.readMessage("PONG", 5)
+	if err != nil {
+		return err
+	}
+	if authenticated, _ := pong[1].(bool); !authenticated {
+		return fmt.Errorf("authentication failed: %v", pong[2])
+	}
+	serverHostname, _ := pong[3].(string)
+	if pong[4] != digest(sharedKeySalt, serverHostname, nonce, options.sharedKey) {
+		return fmt.Errorf("the server %q does not know the shared key", serverHostname)
+	}
+	return nil
+}
+
+// readMessage reads a message of the handshake, an array starting with its
+// type and with at least length elements.
+func (self *conn) readMessage(messageType string, length int) ([]interface{}, error) {
+	v, err := decodeValue(self.reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s - %v", messageType, err)
+	}
+	msg, ok := v.([]interface{})
+	if !ok || len(msg) < length || msg[0] != messageType {
+		return nil, fmt.Errorf("expected %s, got %v", messageType, v)
+	}
+	return msg, nil
+}
+
+// send writes a chunk, and waits for its ack until the timeout if it has
+// an ID.
+func (self *conn) send(c *chunk, ackTimeout time.Duration) error {
+	self.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := self.conn.Write(c.data); err != nil {
+		return err
+	}
+	if c.id == "" {
+		return nil
+	}
+	self.conn.SetReadDeadline(time.Now().Add(ackTimeout))
+	v, err := decodeValue(self.reader)
+	if err != nil {
+		return fmt.Errorf("failed to read the ack - %v", err)
+	}
+	if resp, ok := v.(map[string]interface{}); !ok || resp["ack"] != c.id {
+		return fmt.Errorf("expected the ack of chunk %s, got %v", c.id, v)
+	}
+	return nil
+}
+
+func (self *conn) close() error {
+	return self.conn.Close()
+}
@@ -0,0 +1,469 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fluentd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+	"github.com/google/cadvisor/utils/container"
+
+	"github.com/golang/glog"
+)
+
+func init() {
+	storage.RegisterStorageDriver("fluentd", new)
+}
+
+var (
+	argAddress       = flag.String("storage_driver_fluentd_address", "localhost:24224", "host:port of the Fluentd or Fluent Bit forward input, or unix:// followed by the path of its socket")
+	argTag           = flag.String("storage_driver_fluentd_tag", "cadvisor", "tag of the events, where {machine}, {container} and {label:<name>} are replaced with the machine, the container name and the value of a container label, their dots replaced with underscores, e.g. cadvisor.{label:app}")
+	argSharedKey     = flag.String("storage_driver_fluentd_shared_key", "", "shared key of the handshake authenticating to the forward input, no handshake if empty")
+	argHostname      = flag.String("storage_driver_fluentd_hostname", "", "hostname sent in the handshake; default is the hostname")
+	argUsername      = flag.String("storage_driver_fluentd_username", "", "user authenticated in the handshake, if the forward input requires user authentication")
+	argPassword      = flag.String("storage_driver_fluentd_password", "", "password of the user")
+	argRequireAck    = flag.Bool("storage_driver_fluentd_require_ack", false, "wait for the forward input to acknowledge every chunk, sending it again otherwise, for at-least-once delivery")
+	argAckTimeout    = flag.Duration("storage_driver_fluentd_ack_timeout", 30*time.Second, "time to wait for the ack of a chunk")
+	argChunkSize     = flag.Int("storage_driver_fluentd_chunk_size", 1000, "maximum number of events of a tag sent in a chunk, sent as soon as they are buffered")
+	argFlushInterval = flag.Duration("storage_driver_fluentd_flush_interval", 5*time.Second, "interval of the sends of the buffered events")
+	argMaxChunks     = flag.Int("storage_driver_fluentd_max_chunks", 100, "maximum number of chunks kept while the forward input can not be reached, the oldest being dropped beyond")
+)
+
+const (
+	// Backoff before connecting again after an error, doubled after every
+	// consecutive error up to maxBackoff.
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 30 * time.Second
+	// Minimum time between the logs of the send errors.
+	errorLogInterval = time.Minute
+)
+
+// detailSpec is the record of an event, the same as the JSON of the
+// messages of the NATS driver.
+type detailSpec struct {
+	Timestamp       time.Time            `json:"timestamp"`
+	MachineName     string               `json:"machine_name,omitempty"`
+	ContainerName   string               `json:"container_Name,omitempty"`
+	ContainerID     string               `json:"container_Id,omitempty"`
+	ContainerLabels map[string]string    `json:"container_labels,omitempty"`
+	ContainerStats  *info.ContainerStats `json:"container_stats,omitempty"`
+}
+
+// entries are the events of a tag not sent yet, the concatenated
+// MessagePack [time, record] arrays of the PackedForward mode.
+type entries struct {
+	data  []byte
+	count int
+}
+
+// chunk is a PackedForward message, the events of a tag.
+type chunk struct {
+	tag string
+	// ID of the chunk acknowledged by the server, empty if no ack is
+	// required.
+	id     string
+	data   []byte
+	events int
+}
+
+type fluentdStorage struct {
+	machineName   string
+	tag           string
+	options       dialOptions
+	requireAck    bool
+	ackTimeout    time.Duration
+	chunkSize     int
+	maxChunks     int
+	flushInterval time.Duration
+
+	lock sync.Mutex
+	// Events not in a chunk yet, by tag.
+	pending map[string]*entries
+	// Chunks to send, oldest first.
+	chunks []*chunk
+
+	// Used by the sending goroutine only: the connection, the consecutive
+	// errors, and the time before which no chunk is sent.
+	conn      *conn
+	failures  int
+	nextRetry time.Time
+
+	// Counts of the events sent, and dropped in the chunks dropped because
+	// too many were kept.
+	sent    uint64
+	dropped uint64
+	// Counts when the errors were last logged, and the last error.
+	logLock    sync.Mutex
+	lastLog    time.Time
+	lastErr    error
+	loggedDrop uint64
+
+	flush chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func new() (storage.StorageDriver, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	options := dialOptions{
+		address:   *argAddress,
+		sharedKey: *argSharedKey,
+		hostname:  *argHostname,
+		username:  *argUsername,
+		password:  *argPassword,
+	}
+	if options.hostname == "" {
+		options.hostname = hostname
+	}
+	return newStorage(config{
+		machineName:   hostname,
+		tag:           *argTag,
+		options:       options,
+		requireAck:    *argRequireAck,
+		ackTimeout:    *argAckTimeout,
+		chunkSize:     *argChunkSize,
+		flushInterval: *argFlushInterval,
+		maxChunks:     *argMaxChunks,
+	})
+}
+
+// Placeholders of the tag template.
+var placeholderRegexp = regexp.MustCompile(`\{(machine|container|label:[^{}]+)\}`)
+
+// Replaces the dots, which split the parts of a tag matched by the
+// patterns of Fluentd, so that a name is a single part, e.g. web_1 of web.1.
+var partReplacer = strings.NewReplacer(".", "_")
+
+// tagOf returns the tag of the events of a container.
+func (self *fluentdStorage) tagOf(ref info.ContainerReference, containerName string) string {
+	return placeholderRegexp.ReplaceAllStringFunc(self.tag, func(placeholder string) string {
+		name := placeholder[1 : len(placeholder)-1]
+		switch {
+		case name == "machine":
+			return partReplacer.Replace(self.machineName)
+		case name == "container":
+			return partReplacer.Replace(containerName)
+		default:
+			return partReplacer.Replace(ref.Labels[strings.TrimPrefix(name, "label:")])
+		}
+	})
+}
+
+// entry returns the MessagePack [time, record] array of the event of the
+// stats of a container.
+func (self *fluentdStorage) entry(ref info.ContainerReference, containerName string, stats *info.ContainerStats) ([]byte, error) {
+	data, err := json.Marshal(&detailSpec{
+		Timestamp:       stats.Timestamp,
+		MachineName:     self.machineName,
+		ContainerName:   containerName,
+		ContainerID:     ref.Id,
+		ContainerLabels: ref.Labels,
+		ContainerStats:  stats,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// The record is the JSON decoded, so that its fields are the ones of
+	// the other drivers.
+	var record interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&record); err != nil {
+		return nil, err
+	}
+	b := appendArrayHeader(nil, 2)
+	b = appendEventTime(b, stats.Timestamp)
+	return appendValue(b, record)
+}
+
+func (self *fluentdStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	if stats == nil {
+		return nil
+	}
+	containerName := container.GetPreferredName(ref)
+	entry, err := self.entry(ref, containerName, stats)
+	if err != nil {
+		return err
+	}
+	tag := self.tagOf(ref, containerName)
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	e, ok := self.pending[tag]
+	if !ok {
+		e = &entries{}
+		self.pending[tag] = e
+	}
+	e.data = append(e.data, entry...)
+	e.count++
+	if e.count >= self.chunkSize {
+		if err := self.seal(tag); err != nil {
+			return err
+		}
+		select {
+		case self.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// seal moves the pending events of a tag to a chunk, dropping the oldest
+// chunks beyond maxChunks. Lock must be held.
+func (self *fluentdStorage) seal(tag string) error {
+	e := self.pending[tag]
+	delete(self.pending, tag)
+	c := &chunk{tag: tag, events: e.count}
+	option := map[string]interface{}{"size": e.count}
+	if self.requireAck {
+		id := make([]byte, 16)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		c.id = base64.StdEncoding.EncodeToString(id)
+		option["chunk"] = c.id
+	}
+	b := appendArrayHeader(nil, 3)
+	b = appendString(b, tag)
+	b = appendBin(b, e.data)
+	b, err := appendValue(b, option)
+	if err != nil {
+		return err
+	}
+	c.data = b
+	self.chunks = append(self.chunks, c)
+	if extra := len(self.chunks) - self.maxChunks; extra > 0 {
+		for _, dropped := range self.chunks[:extra] {
+			atomic.AddUint64(&self.dropped, uint64(dropped.events))
+		}
+		self.chunks = append(self.chunks[:0:0], self.chunks[extra:]...)
+	}
+	return nil
+}
+
+// sealAll moves all the pending events to chunks.
+func (self *fluentdStorage) sealAll() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for tag := range self.pending {
+		if err := self.seal(tag); err != nil {
+			self.setLastErr(err)
+		}
+	}
+}
+
+// run sends the buffered events every flush interval, or as soon as a
+// chunk is full, until stopped. After an error, they are sent again once
+// the backoff elapsed.
+func (self *fluentdStorage) run() {
+	defer close(self.done)
+	ticker := time.NewTicker(self.flushInterval)
+	defer ticker.Stop()
+	retry := time.NewTimer(self.flushInterval)
+	retry.Stop()
+	defer retry.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			self.sealAll()
+		case <-self.flush:
+		case <-retry.C:
+		case <-self.stop:
+			// Sends once more even if the backoff has not elapsed.
+			self.sealAll()
+			self.nextRetry = time.Time{}
+			self.send()
+			return
+		}
+		if self.send() {
+			retry.Stop()
+			retry = time.NewTimer(time.Until(self.nextRetry))
+		}
+	}
+}
+
+// send sends the chunks in order, connecting if needed, unless backing off
+// after an error. A chunk is kept until it is written, and acknowledged if
+// required. It returns true if the send failed.
+func (self *fluentdStorage) send() bool {
+	if time.Now().Before(self.nextRetry) {
+		return false
+	}
+	for {
+		self.lock.Lock()
+		if len(self.chunks) == 0 {
+			self.lock.Unlock()
+			break
+		}
+		c := self.chunks[0]
+		self.lock.Unlock()
+
+		if err := self.sendChunk(c); err != nil {
+			self.failed(err)
+			return true
+		}
+		self.failures = 0
+		atomic.AddUint64(&self.sent, uint64(c.events))
+		self.lock.Lock()
+		// The chunk may have been dropped meanwhile.
+		if len(self.chunks) > 0 && self.chunks[0] == c {
+			self.chunks = self.chunks[1:]
+		}
+		self.lock.Unlock()
+	}
+	self.logErrors(false)
+	return false
+}
+
+// sendChunk sends a chunk, connecting if needed. The connection is closed
+// after an error, e.g. a missing ack.
+func (self *fluentdStorage) sendChunk(c *chunk) error {
+	if self.conn == nil {
+		conn, err := dial(self.options)
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s - %v", self.options.address, err)
+		}
+		self.conn = conn
+	}
+	if err := self.conn.send(c, self.ackTimeout); err != nil {
+		self.conn.close()
+		self.conn = nil
+		return fmt.Errorf("failed to send a chunk of %d events to %s - %v", c.events, self.options.address, err)
+	}
+	return nil
+}
+
+// failed backs off after an error.
+func (self *fluentdStorage) failed(err error) {
+	backoff := minBackoff << uint(self.failures)
+	if backoff > maxBackoff || backoff <= 0 {
+		backoff = maxBackoff
+	}
+	self.failures++
+	self.nextRetry = time.Now().Add(backoff)
+	self.setLastErr(fmt.Errorf("%v, retrying in %s", err, backoff))
+}
+
+func (self *fluentdStorage) setLastErr(err error) {
+	self.logLock.Lock()
+	self.lastErr = err
+	self.logLock.Unlock()
+	self.logErrors(false)
+}
+
+// logErrors logs the last send error and the count of the events dropped
+// since the last log, at most every errorLogInterval unless forced.
+func (self *fluentdStorage) logErrors(force bool) {
+	self.logLock.Lock()
+	defer self.logLock.Unlock()
+	if !force && time.Since(self.lastLog) < errorLogInterval {
+		return
+	}
+	dropped := atomic.LoadUint64(&self.dropped)
+	if self.lastErr == nil && dropped == self.loggedDrop {
+		return
+	}
+	glog.Errorf("Fluentd: %d events were dropped because %d chunks were kept, last error: %v", dropped-self.loggedDrop, self.maxChunks, self.lastErr)
+	self.lastLog = time.Now()
+	self.lastErr = nil
+	self.loggedDrop = dropped
+}
+
+// Close sends the buffered events, and closes the connection.
+func (self *fluentdStorage) Close() error {
+	close(self.stop)
+	<-self.done
+	self.logErrors(true)
+	if self.conn != nil {
+		self.conn.close()
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	events := 0
+	for _, c := range self.chunks {
+		events += c.events
+	}
+	if events > 0 {
+		return fmt.Errorf("Fluentd: %d events were not sent", events)
+	}
+	return nil
+}
+
+// config is the configuration of the driver, populated from the flags.
+type config struct {
+	// A unique identifier to identify the host that current cAdvisor
+	// instance is running on.
+	machineName string
+	// The template of the tag of the events.
+	tag string
+	// How to connect and authenticate to the forward input.
+	options dialOptions
+	// Whether the chunks must be acknowledged.
+	requireAck bool
+	// The time to wait for the ack of a chunk.
+	ackTimeout time.Duration
+	// The maximum number of events of a chunk.
+	chunkSize int
+	// The interval of the sends of the buffered events.
+	flushInterval time.Duration
+	// The maximum number of chunks kept while the input can not be reached.
+	maxChunks int
+}
+
+// Create a new Fluentd storage driver.
+func newStorage(cfg config) (*fluentdStorage, error) {
+	if cfg.tag == "" || strings.ContainsAny(cfg.tag, " \t\r\n") {
+		return nil, fmt.Errorf("invalid Fluentd tag %q", cfg.tag)
+	}
+	if cfg.options.address == "" || cfg.options.address == "unix://" {
+		return nil, fmt.Errorf("the address of the Fluentd forward input is required, set -storage_driver_fluentd_address")
+	}
+	if (cfg.options.username != "" || cfg.options.password != "") && cfg.options.sharedKey == "" {
+		return nil, fmt.Errorf("the Fluentd user authentication requires a shared key, set -storage_driver_fluentd_shared_key")
+	}
+	if cfg.chunkSize <= 0 || cfg.flushInterval <= 0 || cfg.maxChunks <= 0 || (cfg.requireAck && cfg.ackTimeout <= 0) {
+		return nil, fmt.Errorf("the Fluentd chunk size, flush interval, maximum chunks and ack timeout must be positive")
+	}
+	ret := &fluentdStorage{
+		machineName:   cfg.machineName,
+		tag:           cfg.tag,
+		options:       cfg.options,
+		requireAck:    cfg.requireAck,
+		ackTimeout:    cfg.ackTimeout,
+		chunkSize:     cfg.chunkSize,
+		maxChunks:     cfg.maxChunks,
+		flushInterval: cfg.flushInterval,
+		pending:       make(map[string]*entries),
+		flush:         make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go ret.run()
+	return ret, nil
+}
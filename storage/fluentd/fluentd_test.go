@@ -0,0 +1,401 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fluentd
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+var (
+	testTime = time.Date(2016, 1, 1, 0, 0, 0, 123456789, time.UTC)
+	testRef  = info.ContainerReference{
+		Name:    "/docker/abc",
+		Id:      "abc",
+		Aliases: []string{"web.1", "abc"},
+		Labels:  map[string]string{"app": "shop.front"},
+	}
+	testStats = &info.ContainerStats{
+		Timestamp: testTime,
+		Cpu:       info.CpuStats{Usage: info.CpuUsage{Total: 100, User: 60, System: 40}},
+		Memory:    info.MemoryStats{Usage: 4096, WorkingSet: 2048},
+	}
+)
+
+// forwardMessage is a PackedForward message received by the fake server.
+type forwardMessage struct {
+	tag    string
+	times  []time.Time
+	events []map[string]interface{}
+	option map[string]interface{}
+}
+
+// fakeServer is a forward input, which authenticates the clients with the
+// shared key if set, and acknowledges the chunks but the first skipAcks.
+type fakeServer struct {
+	listener  net.Listener
+	sharedKey string
+
+	lock     sync.Mutex
+	skipAcks int
+	messages []forwardMessage
+	conns    []net.Conn
+	errors   []error
+}
+
+func newFakeServer(t *testing.T, network, address, sharedKey string) *fakeServer {
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := &fakeServer{listener: listener, sharedKey: sharedKey}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			self.lock.Lock()
+			self.conns = append(self.conns, conn)
+			self.lock.Unlock()
+			go func() {
+				if err := self.serve(conn); err != nil && err != io.EOF {
+					self.lock.Lock()
+					self.errors = append(self.errors, err)
+					self.lock.Unlock()
+				}
+			}()
+		}
+	}()
+	return self
+}
+
+func (self *fakeServer) serve(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+	if self.sharedKey != "" {
+		if err := self.handshake(conn, r); err != nil {
+			return err
+		}
+	}
+	for {
+		v, err := decodeValue(r)
+		if err != nil {
+			return err
+		}
+		msg, err := decodeForwardMessage(v)
+		if err != nil {
+			return err
+		}
+		self.lock.Lock()
+		self.messages = append(self.messages, msg)
+		ack := msg.option["chunk"] != nil
+		if ack && self.skipAcks > 0 {
+			self.skipAcks--
+			ack = false
+		}
+		self.lock.Unlock()
+		if ack {
+			b, _ := appendValue(nil, map[string]interface{}{"ack": msg.option["chunk"]})
+			if _, err := conn.Write(b); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (self *fakeServer) handshake(conn net.Conn, r *bufio.Reader) error {
+	nonce := "nonce"
+	helo, _ := appendValue(nil, []interface{}{"HELO", map[string]interface{}{"nonce": []byte(nonce), "auth": "", "keepalive": true}})
+	if _, err := conn.Write(helo); err != nil {
+		return err
+	}
+	v, err := decodeValue(r)
+	if err != nil {
+		return err
+	}
+	ping := v.([]interface{})
+	hostname, salt := ping[1].(string), ping[2].(string)
+	var pong []byte
+	if ping[0] != "PING" || ping[3] != digest(salt, hostname, nonce, self.sharedKey) {
+		pong, _ = appendValue(nil, []interface{}{"PONG", false, "shared key mismatch", "server", ""})
+	} else {
+		pong, _ = appendValue(nil, []interface{}{"PONG", true, "", "server", digest(salt, "server", nonce, self.sharedKey)})
+	}
+	_, err = conn.Write(pong)
+	return err
+}
+
+// decodeForwardMessage decodes a PackedForward message, and its entries.
+func decodeForwardMessage(v interface{}) (forwardMessage, error) {
+	var msg forwardMessage
+	array, ok := v.([]interface{})
+	if !ok || len(array) != 3 {
+		return msg, io.ErrUnexpectedEOF
+	}
+	msg.tag = array[0].(string)
+	msg.option = array[2].(map[string]interface{})
+	r := bufio.NewReader(strings.NewReader(array[1].(string)))
+	for {
+		entry, err := decodeValue(r)
+		if err == io.EOF {
+			return msg, nil
+		}
+		if err != nil {
+			return msg, err
+		}
+		pair := entry.([]interface{})
+		eventTime := pair[0].([]byte)
+		msg.times = append(msg.times, time.Unix(int64(binary.BigEndian.Uint32(eventTime[1:5])), int64(binary.BigEndian.Uint32(eventTime[5:9]))))
+		msg.events = append(msg.events, pair[1].(map[string]interface{}))
+	}
+}
+
+func (self *fakeServer) received() []forwardMessage {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return append([]forwardMessage(nil), self.messages...)
+}
+
+// containers returns the container names of the events received, by
+// message.
+func (self *fakeServer) containers() [][]string {
+	var ret [][]string
+	for _, msg := range self.received() {
+		var names []string
+		for _, e := range msg.events {
+			names = append(names, e["container_Name"].(string))
+		}
+		ret = append(ret, names)
+	}
+	return ret
+}
+
+// close stops listening, and closes the connections.
+func (self *fakeServer) close() {
+	self.listener.Close()
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, conn := range self.conns {
+		conn.Close()
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	for start := time.Now(); !condition(); time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("timed out")
+		}
+	}
+}
+
+func refNamed(name string) info.ContainerReference {
+	return info.ContainerReference{Name: name}
+}
+
+func TestTag(t *testing.T) {
+	driver := &fluentdStorage{machineName: "node.1", tag: "cadvisor.{machine}.{container}.{label:app}.{label:missing}"}
+	if tag := driver.tagOf(testRef, "web.1"); tag != "cadvisor.node_1.web_1.shop_front." {
+		t.Errorf("unexpected tag %q", tag)
+	}
+}
+
+// testConfig returns the configuration of a driver sending chunks of one
+// event to the forward input at address.
+func testConfig(address string) config {
+	return config{
+		machineName:   "host-1",
+		tag:           "cadvisor",
+		options:       dialOptions{address: address},
+		chunkSize:     1,
+		flushInterval: time.Hour,
+		maxChunks:     10,
+	}
+}
+
+func TestSend(t *testing.T) {
+	server := newFakeServer(t, "tcp", "127.0.0.1:0", "")
+	defer server.close()
+	cfg := testConfig(server.listener.Addr().String())
+	cfg.tag = "cadvisor.{label:app}"
+	cfg.chunkSize = 2
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.AddStats(testRef, testStats)
+	for _, name := range []string{"/a", "/b", "/c"} {
+		driver.AddStats(refNamed(name), testStats)
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return len(server.received()) == 3 })
+
+	messages := server.received()
+	if messages[0].tag != "cadvisor." || strings.Join(server.containers()[0], ",") != "/a,/b" || messages[0].option["size"] != int64(2) || messages[0].option["chunk"] != nil {
+		t.Errorf("expected a first chunk of 2 events, got %+v", messages[0])
+	}
+	var web forwardMessage
+	for _, msg := range messages {
+		if msg.tag == "cadvisor.shop_front" {
+			web = msg
+		}
+	}
+	if len(web.events) != 1 || !web.times[0].Equal(testTime) {
+		t.Fatalf("expected an event tagged with the label, got %+v", messages)
+	}
+	record := web.events[0]
+	memory := record["container_stats"].(map[string]interface{})["memory"].(map[string]interface{})
+	if record["container_Name"] != "web.1" || record["container_Id"] != "abc" || record["machine_name"] != "host-1" || memory["usage"] != uint64(4096) {
+		t.Errorf("unexpected record %v", record)
+	}
+	if driver.sent != 4 {
+		t.Errorf("expected 4 events sent, got %d", driver.sent)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	server := newFakeServer(t, "tcp", "127.0.0.1:0", "secret")
+	defer server.close()
+	options := dialOptions{address: server.listener.Addr().String(), sharedKey: "secret", hostname: "host-1"}
+	c, err := dial(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.close()
+
+	options.sharedKey = "wrong"
+	if _, err := dial(options); err == nil || !strings.Contains(err.Error(), "shared key mismatch") {
+		t.Errorf("expected the authentication to fail, got %v", err)
+	}
+}
+
+func TestAckResend(t *testing.T) {
+	server := newFakeServer(t, "tcp", "127.0.0.1:0", "secret")
+	defer server.close()
+	server.skipAcks = 1
+	cfg := testConfig(server.listener.Addr().String())
+	cfg.options.sharedKey = "secret"
+	cfg.options.hostname = "host-1"
+	cfg.requireAck = true
+	cfg.ackTimeout = 50 * time.Millisecond
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.AddStats(refNamed("/a"), testStats)
+	// The chunk is sent again after the backoff, its ack being lost.
+	waitFor(t, func() bool { return len(server.received()) == 2 })
+	driver.AddStats(refNamed("/b"), testStats)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	messages := server.received()
+	if len(messages) != 3 || messages[0].option["chunk"] == nil || messages[0].option["chunk"] != messages[1].option["chunk"] {
+		t.Errorf("expected the first chunk sent twice with the same ID, got %+v", messages)
+	}
+	if containers := server.containers(); containers[2][0] != "/b" {
+		t.Errorf("unexpected events %v", containers)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fluentd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "fluentd.sock")
+	server := newFakeServer(t, "unix", socket, "")
+	cfg := testConfig("unix://" + socket)
+	cfg.requireAck = true
+	cfg.ackTimeout = time.Second
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.AddStats(refNamed("/a"), testStats)
+	waitFor(t, func() bool { return len(server.received()) == 1 })
+
+	// The server restarts, the chunks are kept until it is back.
+	server.close()
+	driver.AddStats(refNamed("/b"), testStats)
+	driver.AddStats(refNamed("/c"), testStats)
+	time.Sleep(50 * time.Millisecond)
+	server = newFakeServer(t, "unix", socket, "")
+	defer server.close()
+	waitFor(t, func() bool { return len(server.received()) == 2 })
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if containers := server.containers(); len(containers) != 2 || containers[0][0] != "/b" || containers[1][0] != "/c" {
+		t.Errorf("expected the chunks sent once reconnected, got %v", containers)
+	}
+}
+
+func TestMaxChunks(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	cfg := testConfig(address)
+	cfg.maxChunks = 2
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"/a", "/b", "/c"} {
+		driver.AddStats(refNamed(name), testStats)
+	}
+	if err := driver.Close(); err == nil || err.Error() != "Fluentd: 2 events were not sent" {
+		t.Errorf("expected the events not sent, got %v", err)
+	}
+	if driver.dropped != 1 {
+		t.Errorf("expected the oldest chunk dropped, got %d dropped", driver.dropped)
+	}
+}
+
+func TestNewStorageValidation(t *testing.T) {
+	for _, c := range []struct {
+		tag     string
+		options dialOptions
+	}{
+		{"", dialOptions{address: "localhost:24224"}},
+		{"cadvisor stats", dialOptions{address: "localhost:24224"}},
+		{"cadvisor", dialOptions{}},
+		{"cadvisor", dialOptions{address: "unix://"}},
+		{"cadvisor", dialOptions{address: "localhost:24224", username: "user"}},
+	} {
+		cfg := testConfig("")
+		cfg.tag = c.tag
+		cfg.options = c.options
+		if _, err := newStorage(cfg); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fluentd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func decodeBytes(t *testing.T, b []byte) interface{} {
+	r := bufio.NewReader(bytes.NewReader(b))
+	v, err := decodeValue(r)
+	if err != nil {
+		t.Fatalf("failed to decode %x - %v", b, err)
+	}
+	if r.Buffered() != 0 {
+		t.Errorf("%d bytes left after decoding %x", r.Buffered(), b)
+	}
+	return v
+}
+
+func TestRoundTrip(t *testing.T) {
+	long := strings.Repeat("a", 70000)
+	for _, c := range []struct {
+		value    interface{}
+		expected interface{}
+	}{
+		{nil, nil},
+		{true, true},
+		{false, false},
+		{0, int64(0)},
+		{127, int64(127)},
+		{-1, int64(-1)},
+		{-32, int64(-32)},
+		{-33, int64(-33)},
+		{int64(math.MinInt8), int64(math.MinInt8)},
+		{int64(math.MinInt16), int64(math.MinInt16)},
+		{int64(math.MinInt32), int64(math.MinInt32)},
+		{int64(math.MinInt64), int64(math.MinInt64)},
+		{200, uint64(200)},
+		{70000, uint64(70000)},
+		{uint64(math.MaxUint64), uint64(math.MaxUint64)},
+		{1.5, 1.5},
+		{json.Number("42"), int64(42)},
+		{json.Number("18446744073709551615"), uint64(math.MaxUint64)},
+		{json.Number("0.25"), 0.25},
+		{"", ""},
+		{"short", "short"},
+		{strings.Repeat("b", 40), strings.Repeat("b", 40)},
+		{long, long},
+		{[]byte("bin"), "bin"},
+		{[]interface{}{1, "a", nil}, []interface{}{int64(1), "a", nil}},
+		{make([]interface{}, 20), make([]interface{}, 20)},
+		{map[string]interface{}{"b": 1, "a": []interface{}{}}, map[string]interface{}{"b": int64(1), "a": []interface{}{}}},
+	} {
+		b, err := appendValue(nil, c.value)
+		if err != nil {
+			t.Errorf("failed to encode %v - %v", c.value, err)
+			continue
+		}
+		if v := decodeBytes(t, b); !reflect.DeepEqual(v, c.expected) {
+			t.Errorf("expected %v (%T) to be decoded as %v, got %v (%T)", c.value, c.value, c.expected, v, v)
+		}
+	}
+}
+
+func TestSortedMapKeys(t *testing.T) {
+	b, err := appendValue(nil, map[string]interface{}{"b": 1, "a": 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []byte{0x82, 0xa1, 'a', 0x02, 0xa1, 'b', 0x01}; !bytes.Equal(b, expected) {
+		t.Errorf("expected %x, got %x", expected, b)
+	}
+}
+
+func TestEventTime(t *testing.T) {
+	b := appendEventTime(nil, time.Date(2016, 1, 1, 0, 0, 0, 123456789, time.UTC))
+	expected := []byte{0xd7, 0x00, 0x56, 0x85, 0xc1, 0x80, 0x07, 0x5b, 0xcd, 0x15}
+	if !bytes.Equal(b, expected) {
+		t.Errorf("expected %x, got %x", expected, b)
+	}
+	if v := decodeBytes(t, b); !bytes.Equal(v.([]byte), expected[1:]) {
+		t.Errorf("expected the extension decoded as its type and data, got %x", v)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	for _, b := range [][]byte{
+		{},
+		{0xc1},
+		{0xa5, 'a'},
+		{0x92, 0x01},
+		{0xdd, 0xff, 0xff, 0xff, 0xff},
+	} {
+		if _, err := decodeValue(bufio.NewReader(bytes.NewReader(b))); err == nil {
+			t.Errorf("expected an error decoding %x", b)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// DefaultMaxPayload is the default size of the writes batching the
+	// lines.
+	DefaultMaxPayload = 16 << 10
+	// DefaultMaxPending is the default size of the lines kept while
+	// Graphite can not be reached.
+	DefaultMaxPending = 8 << 20
+
+	// Backoff before reconnecting after an error, doubled after every
+	// consecutive error up to maxBackoff.
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 30 * time.Second
+
+	dialTimeout  = 5 * time.Second
+	writeTimeout = 10 * time.Second
+)
+
+// Client sends lines of the plaintext protocol to Graphite over TCP. The
+// lines are batched in writes of at most MaxPayload bytes, sent once full
+// or FlushInterval after their first line was written. After an error, the
+// connection is reopened with an exponential backoff, and the lines which
+// could not be sent are kept, up to MaxPending bytes of them, the oldest
+// being dropped beyond.
+type Client struct {
+	HostPort      string
+	MaxPayload    int
+	MaxPending    int
+	FlushInterval time.Duration
+
+	lock    sync.Mutex
+	conn    net.Conn
+	pending []byte
+	timer   *time.Timer
+	// Consecutive errors, and time before which no connection is opened.
+	failures   int
+	nextDial   time.Time
+	minBackoff time.Duration
+	// Lines dropped since the last error logged.
+	dropped int
+}
+
+// New returns a client of Graphite at hostPort. The connection is opened
+// with the first write.
+func New(hostPort string, maxPayload, maxPending int, flushInterval time.Duration) (*Client, error) {
+	if maxPayload <= 0 || maxPending < maxPayload {
+		return nil, fmt.Errorf("invalid Graphite payload size %d and pending size %d, the pending size must be at least the payload size", maxPayload, maxPending)
+	}
+	if flushInterval <= 0 {
+		return nil, fmt.Errorf("invalid Graphite flush interval %s", flushInterval)
+	}
+	return &Client{
+		HostPort:      hostPort,
+		MaxPayload:    maxPayload,
+		MaxPending:    maxPending,
+		FlushInterval: flushInterval,
+		minBackoff:    minBackoff,
+	}, nil
+}
+
+// Write buffers lines, each ending with a newline, and sends the buffered
+// lines if they fill a payload.
+func (self *Client) Write(lines ...string) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, line := range lines {
+		self.pending = append(self.pending, line...)
+	}
+	self.trim()
+	// While backing off, the lines are sent by the scheduled flush.
+	if len(self.pending) >= self.MaxPayload && !(self.conn == nil && time.Now().Before(self.nextDial)) {
+		return self.flush()
+	}
+	self.schedule(self.FlushInterval)
+	return nil
+}
+
+// Flush sends the buffered lines.
+func (self *Client) Flush() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.flush()
+}
+
+// Close sends the buffered lines, and closes the connection.
+func (self *Client) Close() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	// Sends once more even if the backoff has not elapsed.
+	self.nextDial = time.Time{}
+	err := self.flush()
+	if self.timer != nil {
+		self.timer.Stop()
+		self.timer = nil
+	}
+	if self.conn != nil {
+		self.conn.Close()
+		self.conn = nil
+	}
+	return err
+}
+
+// schedule flushes the buffered lines after d, unless already scheduled.
+// Lock must be held.
+func (self *Client) schedule(d time.Duration) {
+	if self.timer == nil {
+		self.timer = time.AfterFunc(d, self.flushAfterInterval)
+	}
+}
+
+func (self *Client) flushAfterInterval() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.timer = nil
+	if err := self.flush(); err != nil {
+		glog.Errorf("%v", err)
+	}
+}
+
+// trim drops the oldest whole lines beyond MaxPending bytes. Lock must be
+// held.
+func (self *Client) trim() {
+	for len(self.pending) > self.MaxPending {
+		end := len(self.pending) - self.MaxPending
+		for end < len(self.pending) && self.pending[end-1] != '\n' {
+			end++
+		}
+		for _, b := range self.pending[:end] {
+			if b == '\n' {
+				self.dropped++
+			}
+		}
+		self.pending = self.pending[end:]
+	}
+}
+
+// flush sends the buffered lines, in writes of at most MaxPayload bytes
+// ending at a line. The lines which could not be sent are kept for the
+// next flush, scheduled once the backoff elapses. Lock must be held.
+func (self *Client) flush() error {
+	if self.timer != nil {
+		self.timer.Stop()
+		self.timer = nil
+	}
+	for len(self.pending) > 0 {
+		if err := self.connect(); err != nil {
+			return self.failed(err)
+		}
+		n := len(self.pending)
+		if n > self.MaxPayload {
+			n = self.MaxPayload
+			// Ends at the last line fitting, or the first line if it
+			// does not fit on its own.
+			for n > 0 && self.pending[n-1] != '\n' {
+				n--
+			}
+			if n == 0 {
+				for n < len(self.pending) && self.pending[n] != '\n' {
+					n++
+				}
+				if n < len(self.pending) {
+					n++
+				}
+			}
+		}
+		self.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := self.conn.Write(self.pending[:n]); err != nil {
+			self.conn.Close()
+			self.conn = nil
+			return self.failed(err)
+		}
+		self.pending = self.pending[n:]
+		self.failures = 0
+	}
+	self.pending = nil
+	return nil
+}
+
+// connect opens the connection if it is not, and the backoff elapsed.
+// Lock must be held.
+func (self *Client) connect() error {
+	if self.conn != nil {
+		return nil
+	}
+	if wait := self.nextDial.Sub(time.Now()); wait > 0 {
+		return fmt.Errorf("not connected, reconnecting in %s", wait)
+	}
+	conn, err := net.DialTimeout("tcp", self.HostPort, dialTimeout)
+	if err != nil {
+		return err
+	}
+	self.conn = conn
+	return nil
+}
+
+// failed backs off after an error, and schedules sending the buffered
+// lines again. Lock must be held.
+func (self *Client) failed(err error) error {
+	if time.Now().After(self.nextDial) {
+		backoff := self.minBackoff << uint(self.failures)
+		if backoff > maxBackoff || backoff <= 0 {
+			backoff = maxBackoff
+		}
+		self.failures++
+		self.nextDial = time.Now().Add(backoff)
+	}
+	self.schedule(self.nextDial.Sub(time.Now()))
+	err = fmt.Errorf("failed to send %d bytes to Graphite at %q, kept for later - %v", len(self.pending), self.HostPort, err)
+	if self.dropped > 0 {
+		err = fmt.Errorf("%v; dropped %d lines beyond %d bytes", err, self.dropped, self.MaxPending)
+		self.dropped = 0
+	}
+	return err
+}
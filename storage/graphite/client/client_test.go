@@ -0,0 +1,242 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lineServer is a Graphite listener, which can be stopped and restarted on
+// the same address.
+type lineServer struct {
+	t        *testing.T
+	addr     string
+	lines    chan string
+	lock     sync.Mutex
+	listener net.Listener
+	conns    []net.Conn
+	accepted int
+}
+
+func newLineServer(t *testing.T) *lineServer {
+	s := &lineServer{t: t, addr: "127.0.0.1:0", lines: make(chan string, 1000)}
+	s.start()
+	s.addr = s.listener.Addr().String()
+	return s
+}
+
+func (self *lineServer) start() {
+	var l net.Listener
+	var err error
+	// The port may not be released yet after a stop.
+	for attempt := 0; attempt < 50; attempt++ {
+		if l, err = net.Listen("tcp", self.addr); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		self.t.Fatal(err)
+	}
+	self.lock.Lock()
+	self.listener = l
+	self.lock.Unlock()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			self.lock.Lock()
+			self.conns = append(self.conns, conn)
+			self.accepted++
+			self.lock.Unlock()
+			go func() {
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					self.lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+}
+
+// stop closes the listener and the connections.
+func (self *lineServer) stop() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.listener.Close()
+	for _, conn := range self.conns {
+		conn.Close()
+	}
+	self.conns = nil
+}
+
+func (self *lineServer) connections() int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.accepted
+}
+
+// expect waits for the lines, in order, skipping any other line.
+func (self *lineServer) expect(lines ...string) {
+	timeout := time.After(5 * time.Second)
+	for _, expected := range lines {
+		for {
+			select {
+			case line := <-self.lines:
+				if line != expected {
+					continue
+				}
+			case <-timeout:
+				self.t.Fatalf("line %q not received", expected)
+			}
+			break
+		}
+	}
+}
+
+func TestBatching(t *testing.T) {
+	server := newLineServer(t)
+	defer server.stop()
+	c, err := New(server.addr, 20, 100, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// Batched until a write is full.
+	if err := c.Write("a.b 1 10\n"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case line := <-server.lines:
+		t.Fatalf("unexpected line %q before the payload is full", line)
+	case <-time.After(50 * time.Millisecond):
+	}
+	// The writes end at lines, a line longer than a payload being written
+	// on its own.
+	if err := c.Write("a.b 2 20\n", "a.very.long.metric.path 3 30\n", "a.b 4 40\n"); err != nil {
+		t.Fatal(err)
+	}
+	server.expect("a.b 1 10", "a.b 2 20", "a.very.long.metric.path 3 30")
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	server.expect("a.b 4 40")
+}
+
+func TestFlushInterval(t *testing.T) {
+	server := newLineServer(t)
+	defer server.stop()
+	c, err := New(server.addr, 1024, 4096, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Write("a.b 1 10\n"); err != nil {
+		t.Fatal(err)
+	}
+	server.expect("a.b 1 10")
+}
+
+func TestReconnect(t *testing.T) {
+	server := newLineServer(t)
+	c, err := New(server.addr, 1024, 4096, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.minBackoff = 10 * time.Millisecond
+	defer c.Close()
+
+	if err := c.Write("up 1 10\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	server.expect("up 1 10")
+
+	// Graphite goes away. The first writes may still succeed, until the
+	// connection is known to be closed; the line of the write failing is
+	// kept.
+	server.stop()
+	var kept string
+	for i := 0; i < 100 && kept == ""; i++ {
+		line := "down 1 " + strings.Repeat("1", i+1) + "\n"
+		c.Write(line)
+		if err := c.Flush(); err != nil {
+			kept = strings.TrimSuffix(line, "\n")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if kept == "" {
+		t.Fatal("writing to the stopped server did not fail")
+	}
+	// Lines written while reconnecting are kept too.
+	if err := c.Write("down 2 20\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once Graphite is back, the kept lines are sent by the scheduled
+	// flush, without further writes.
+	server.start()
+	server.expect(kept, "down 2 20")
+	if n := server.connections(); n != 2 {
+		t.Errorf("expected 2 connections, got %d", n)
+	}
+	server.stop()
+}
+
+func TestMaxPending(t *testing.T) {
+	c, err := New("127.0.0.1:1", 10, 20, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Graphite can not be reached, the lines are kept but the oldest.
+	err = c.Write("a 1 1\n", "b 2 2\n", "c 3 3\n", "d 4 4\n")
+	if err == nil || !strings.Contains(err.Error(), "dropped 1 lines") {
+		t.Errorf("expected the dropped lines to be reported, got %v", err)
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if got := string(c.pending); got != "b 2 2\nc 3 3\nd 4 4\n" {
+		t.Errorf("expected the oldest line to be dropped, got %q", got)
+	}
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+}
+
+func TestNewValidation(t *testing.T) {
+	for _, test := range []struct {
+		maxPayload, maxPending int
+		flushInterval          time.Duration
+	}{
+		{0, 10, time.Second},
+		{10, 5, time.Second},
+		{10, 10, 0},
+	} {
+		if _, err := New("localhost:2003", test.maxPayload, test.maxPending, test.flushInterval); err == nil {
+			t.Errorf("expected an error for %+v", test)
+		}
+	}
+}
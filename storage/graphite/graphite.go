@@ -0,0 +1,166 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphite
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+	client "github.com/google/cadvisor/storage/graphite/client"
+)
+
+func init() {
+	storage.RegisterStorageDriver("graphite", new)
+}
+
+var (
+	argMaxPayload    = flag.Int("storage_driver_graphite_max_payload", client.DefaultMaxPayload, "maximum size in bytes of the writes batching the lines sent to Graphite")
+	argMaxPending    = flag.Int("storage_driver_graphite_max_pending", client.DefaultMaxPending, "maximum size in bytes of the lines kept while Graphite can not be reached, the oldest are dropped beyond")
+	argFlushInterval = flag.Duration("storage_driver_graphite_flush_interval", time.Second, "maximum time the lines are batched before they are sent")
+)
+
+type graphiteStorage struct {
+	client      *client.Client
+	prefix      string
+	machineName string
+}
+
+// Replaces the characters which would split a path segment, or are not
+// allowed in one, with underscores.
+var segmentReplacer = strings.NewReplacer("/", "_", ".", "_", " ", "_", "\t", "_", "\n", "_")
+
+// segment returns a path segment of a name, e.g. docker_abc of /docker/abc.
+func segment(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if name == "" {
+		return "root"
+	}
+	return segmentReplacer.Replace(name)
+}
+
+func new() (storage.StorageDriver, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	return newStorage(config{
+		machineName:   hostname,
+		prefix:        *storage.ArgDbName,
+		hostPort:      *storage.ArgDbHost,
+		maxPayload:    *argMaxPayload,
+		maxPending:    *argMaxPending,
+		flushInterval: *argFlushInterval,
+	})
+}
+
+// lines returns the lines sending the stats of a container, e.g.
+// cadvisor.host.docker_abc.cpu.usage.total 3000 1451606400. The counters
+// are sent as their cumulative values, Graphite derives them.
+func (self *graphiteStorage) lines(ref info.ContainerReference, stats *info.ContainerStats) []string {
+	containerName := ref.Name
+	if len(ref.Aliases) > 0 {
+		containerName = ref.Aliases[0]
+	}
+	path := self.prefix + "." + segment(self.machineName) + "." + segment(containerName) + "."
+	timestamp := stats.Timestamp.Unix()
+	var lines []string
+	add := func(metric string, value uint64) {
+		lines = append(lines, fmt.Sprintf("%s%s %d %d\n", path, metric, value, timestamp))
+	}
+
+	add("cpu.usage.total", stats.Cpu.Usage.Total)
+	add("cpu.usage.user", stats.Cpu.Usage.User)
+	add("cpu.usage.system", stats.Cpu.Usage.System)
+	add("cpu.load_average", uint64(stats.Cpu.LoadAverage))
+
+	add("memory.usage", stats.Memory.Usage)
+	add("memory.working_set", stats.Memory.WorkingSet)
+	add("memory.cache", stats.Memory.Cache)
+	add("memory.rss", stats.Memory.RSS)
+	add("memory.swap", stats.Memory.Swap)
+
+	interfaces := stats.Network.Interfaces
+	if len(interfaces) == 0 && stats.Network.Name != "" {
+		interfaces = []info.InterfaceStats{stats.Network.InterfaceStats}
+	}
+	for _, iface := range interfaces {
+		prefix := "network." + segment(iface.Name) + "."
+		add(prefix+"rx_bytes", iface.RxBytes)
+		add(prefix+"rx_packets", iface.RxPackets)
+		add(prefix+"rx_errors", iface.RxErrors)
+		add(prefix+"rx_dropped", iface.RxDropped)
+		add(prefix+"tx_bytes", iface.TxBytes)
+		add(prefix+"tx_packets", iface.TxPackets)
+		add(prefix+"tx_errors", iface.TxErrors)
+		add(prefix+"tx_dropped", iface.TxDropped)
+	}
+
+	for _, fs := range stats.Filesystem {
+		prefix := "filesystem." + segment(fs.Device) + "."
+		add(prefix+"limit", fs.Limit)
+		add(prefix+"usage", fs.Usage)
+	}
+
+	add("tasks.running", stats.TaskStats.NrRunning)
+	add("tasks.sleeping", stats.TaskStats.NrSleeping)
+	return lines
+}
+
+func (self *graphiteStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	if stats == nil {
+		return nil
+	}
+	return self.client.Write(self.lines(ref, stats)...)
+}
+
+func (self *graphiteStorage) Close() error {
+	// Sends the lines still batched.
+	return self.client.Close()
+}
+
+// config is the configuration of the driver, populated from the flags.
+type config struct {
+	// A unique identifier to identify the host that current cAdvisor
+	// instance is running on.
+	machineName string
+	// The first segment of the metric paths.
+	prefix string
+	// The address of the plaintext port of Graphite.
+	hostPort string
+	// The maximum size of the writes batching the lines.
+	maxPayload int
+	// The maximum size of the lines kept while Graphite can not be reached.
+	maxPending int
+	// The maximum time the lines are batched.
+	flushInterval time.Duration
+}
+
+// Create a new graphite storage driver.
+func newStorage(cfg config) (*graphiteStorage, error) {
+	graphiteClient, err := client.New(cfg.hostPort, cfg.maxPayload, cfg.maxPending, cfg.flushInterval)
+	if err != nil {
+		return nil, err
+	}
+	return &graphiteStorage{
+		client:      graphiteClient,
+		prefix:      cfg.prefix,
+		machineName: cfg.machineName,
+	}, nil
+}
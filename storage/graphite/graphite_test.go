@@ -0,0 +1,141 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package graphite
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+func newTestStorage(t *testing.T) *graphiteStorage {
+	driver, err := newStorage(config{
+		machineName:   "host-1.example.com",
+		prefix:        "cadvisor",
+		hostPort:      "localhost:2003",
+		maxPayload:    1024,
+		maxPending:    4096,
+		flushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return driver
+}
+
+func TestLines(t *testing.T) {
+	driver := newTestStorage(t)
+	ref := info.ContainerReference{
+		Name:    "/docker/abc",
+		Aliases: []string{"web.1", "abc"},
+	}
+	stats := &info.ContainerStats{
+		Timestamp: time.Unix(1451606400, 500000000),
+		Cpu: info.CpuStats{
+			Usage:       info.CpuUsage{Total: 3000, User: 2000, System: 1000},
+			LoadAverage: 2,
+		},
+		Memory: info.MemoryStats{Usage: 4096, WorkingSet: 3072, Cache: 1024, RSS: 2048, Swap: 512},
+		Network: info.NetworkStats{
+			Interfaces: []info.InterfaceStats{{
+				Name:      "eth0",
+				RxBytes:   10,
+				RxPackets: 1,
+				RxErrors:  2,
+				RxDropped: 3,
+				TxBytes:   20,
+				TxPackets: 4,
+				TxErrors:  5,
+				TxDropped: 6,
+			}},
+		},
+		Filesystem: []info.FsStats{{Device: "/dev/sda1", Limit: 1000, Usage: 500}},
+		TaskStats:  info.LoadStats{NrRunning: 1, NrSleeping: 7},
+	}
+	expected := `cadvisor.host-1_example_com.web_1.cpu.usage.total 3000 1451606400
+cadvisor.host-1_example_com.web_1.cpu.usage.user 2000 1451606400
+cadvisor.host-1_example_com.web_1.cpu.usage.system 1000 1451606400
+cadvisor.host-1_example_com.web_1.cpu.load_average 2 1451606400
+cadvisor.host-1_example_com.web_1.memory.usage 4096 1451606400
+cadvisor.host-1_example_com.web_1.memory.working_set 3072 1451606400
+cadvisor.host-1_example_com.web_1.memory.cache 1024 1451606400
+cadvisor.host-1_example_com.web_1.memory.rss 2048 1451606400
+cadvisor.host-1_example_com.web_1.memory.swap 512 1451606400
+cadvisor.host-1_example_com.web_1.network.eth0.rx_bytes 10 1451606400
+cadvisor.host-1_example_com.web_1.network.eth0.rx_packets 1 1451606400
+cadvisor.host-1_example_com.web_1.network.eth0.rx_errors 2 1451606400
+cadvisor.host-1_example_com.web_1.network.eth0.rx_dropped 3 1451606400
+cadvisor.host-1_example_com.web_1.network.eth0.tx_bytes 20 1451606400
+cadvisor.host-1_example_com.web_1.network.eth0.tx_packets 4 1451606400
+cadvisor.host-1_example_com.web_1.network.eth0.tx_errors 5 1451606400
+cadvisor.host-1_example_com.web_1.network.eth0.tx_dropped 6 1451606400
+cadvisor.host-1_example_com.web_1.filesystem.dev_sda1.limit 1000 1451606400
+cadvisor.host-1_example_com.web_1.filesystem.dev_sda1.usage 500 1451606400
+cadvisor.host-1_example_com.web_1.tasks.running 1 1451606400
+cadvisor.host-1_example_com.web_1.tasks.sleeping 7 1451606400
+`
+	if got := strings.Join(driver.lines(ref, stats), ""); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestLinesWithoutAlias(t *testing.T) {
+	driver := newTestStorage(t)
+	stats := &info.ContainerStats{
+		Timestamp: time.Unix(1451606400, 0),
+		Network: info.NetworkStats{
+			InterfaceStats: info.InterfaceStats{Name: "eth0", RxBytes: 10},
+		},
+	}
+	expected := `cadvisor.host-1_example_com.system_slice_docker_service.cpu.usage.total 0 1451606400
+cadvisor.host-1_example_com.system_slice_docker_service.cpu.usage.user 0 1451606400
+cadvisor.host-1_example_com.system_slice_docker_service.cpu.usage.system 0 1451606400
+cadvisor.host-1_example_com.system_slice_docker_service.cpu.load_average 0 1451606400
+cadvisor.host-1_example_com.system_slice_docker_service.memory.usage 0 1451606400
+cadvisor.host-1_example_com.system_slice_docker_service.memory.working_set 0 1451606400
+cadvisor.host-1_example_com.system_slice_docker_service.memory.cache 0 1451606400
+cadvisor.host-1_example_com.system_slice_docker_service.memory.rss 0 1451606400
+cadvisor.host-1_example_com.system_slice_docker_service.memory.swap 0 1451606400
+cadvisor.host-1_example_com.system_slice_docker_service.network.eth0.rx_bytes 10 1451606400
+cadvisor.host-1_example_com.system_slice_docker_service.network.eth0.rx_packets 0 1451606400
+cadvisor.host-1_example_com.system_slice_docker_service.network.eth0.rx_errors 0 1451606400
+cadvisor.host-1_example_com.system_slice_docker_service.network.eth0.rx_dropped 0 1451606400
+cadvisor.host-1_example_com.system_slice_docker_service.network.eth0.tx_bytes 0 1451606400
+cadvisor.host-1_example_com.system_slice_docker_service.network.eth0.tx_packets 0 1451606400
+cadvisor.host-1_example_com.system_slice_docker_service.network.eth0.tx_errors 0 1451606400
+cadvisor.host-1_example_com.system_slice_docker_service.network.eth0.tx_dropped 0 1451606400
+cadvisor.host-1_example_com.system_slice_docker_service.tasks.running 0 1451606400
+cadvisor.host-1_example_com.system_slice_docker_service.tasks.sleeping 0 1451606400
+`
+	if got := strings.Join(driver.lines(info.ContainerReference{Name: "/system.slice/docker.service"}, stats), ""); got != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, got)
+	}
+}
+
+func TestSegment(t *testing.T) {
+	for name, expected := range map[string]string{
+		"/":                            "root",
+		"/docker/abc":                  "docker_abc",
+		"/system.slice/docker.service": "system_slice_docker_service",
+		"my container":                 "my_container",
+		"web":                          "web",
+	} {
+		if got := segment(name); got != expected {
+			t.Errorf("segment(%q): expected %q, got %q", name, expected, got)
+		}
+	}
+}
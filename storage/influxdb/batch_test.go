@@ -0,0 +1,188 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+)
+
+// fakeInfluxDBWrites records the number of points of the write requests it
+// receives.
+type fakeInfluxDBWrites struct {
+	lock   sync.Mutex
+	writes []int
+}
+
+func (self *fakeInfluxDBWrites) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	self.lock.Lock()
+	self.writes = append(self.writes, strings.Count(string(body), "\n"))
+	self.lock.Unlock()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (self *fakeInfluxDBWrites) pointsPerWrite() []int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.writes
+}
+
+func newBatchTestStorage(t testing.TB, influx http.Handler, maxBatchPoints int) (*influxdbStorage, func()) {
+	server := httptest.NewServer(influx)
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver, err := newStorage("machineA", "stats", "cadvisor", "", "root", "root", u.Host, false, nil, time.Hour)
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	driver.maxBatchPoints = maxBatchPoints
+	return driver, server.Close
+}
+
+func TestOversizedBatchesAreSplit(t *testing.T) {
+	influx := &fakeInfluxDBWrites{}
+	driver, closeServer := newBatchTestStorage(t, influx, 1000)
+	defer closeServer()
+	driver.OverrideReadyToFlush(func() bool { return true })
+
+	// Points buffered while the size limit was not enforced, e.g. by a
+	// test override.
+	for i := 0; i < 10000; i++ {
+		driver.points = append(driver.points, makePoint(serMemoryUsage, uint64(i)))
+	}
+	if err := driver.AddStats(info.ContainerReference{Name: "/"}, &info.ContainerStats{Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	writes := influx.pointsPerWrite()
+	if len(writes) < 10 {
+		t.Fatalf("expected at least 10 write requests, got %d", len(writes))
+	}
+	total := 0
+	for _, points := range writes {
+		if points > 1000 {
+			t.Errorf("expected at most 1000 points per request, got %d", points)
+		}
+		total += points
+	}
+	if total != 10010 {
+		t.Errorf("expected 10010 points to be written, got %d", total)
+	}
+}
+
+func TestFlushWhenBatchIsFull(t *testing.T) {
+	influx := &fakeInfluxDBWrites{}
+	driver, closeServer := newBatchTestStorage(t, influx, 25)
+	defer closeServer()
+
+	// Each stats sample is 10 points: the buffer duration is not reached
+	// but the third sample fills the batch.
+	ref := info.ContainerReference{Name: "/"}
+	for i := 0; i < 3; i++ {
+		if err := driver.AddStats(ref, &info.ContainerStats{Timestamp: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writes := influx.pointsPerWrite()
+	if len(writes) != 2 || writes[0] != 25 || writes[1] != 5 {
+		t.Errorf("expected the 30 buffered points to be written by 25, got %v", writes)
+	}
+	if len(driver.points) != 0 {
+		t.Errorf("expected no points left in the buffer, got %d", len(driver.points))
+	}
+}
+
+func TestNoFlushBeforeBufferDuration(t *testing.T) {
+	influx := &fakeInfluxDBWrites{}
+	driver, closeServer := newBatchTestStorage(t, influx, 0)
+	defer closeServer()
+
+	for i := 0; i < 100; i++ {
+		if err := driver.AddStats(info.ContainerReference{Name: "/"}, &info.ContainerStats{Timestamp: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if writes := influx.pointsPerWrite(); len(writes) != 0 {
+		t.Errorf("expected no write without size limit before the buffer duration, got %v", writes)
+	}
+}
+
+// statsBatch returns a batch of stats of n containers.
+func statsBatch(n int) []storage.ContainerStatsPair {
+	batch := make([]storage.ContainerStatsPair, n)
+	for i := range batch {
+		batch[i] = storage.ContainerStatsPair{
+			Ref:   info.ContainerReference{Name: fmt.Sprintf("/container%d", i)},
+			Stats: &info.ContainerStats{Timestamp: time.Now()},
+		}
+	}
+	return batch
+}
+
+func TestAddStatsBatchIsWrittenAtOnce(t *testing.T) {
+	influx := &fakeInfluxDBWrites{}
+	driver, closeServer := newBatchTestStorage(t, influx, 0)
+	defer closeServer()
+	driver.OverrideReadyToFlush(func() bool { return true })
+
+	batch := append(statsBatch(3), storage.ContainerStatsPair{Ref: info.ContainerReference{Name: "/nil"}})
+	if err := driver.AddStatsBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	if writes := influx.pointsPerWrite(); len(writes) != 1 || writes[0] != 30 {
+		t.Errorf("expected the 30 points of the batch to be written at once, got %v", writes)
+	}
+}
+
+func benchmarkAddStats(b *testing.B, batched bool) {
+	// Without size limit, nothing is written before the buffer duration:
+	// only the buffering of the points is measured.
+	driver, closeServer := newBatchTestStorage(b, &fakeInfluxDBWrites{}, 0)
+	defer closeServer()
+	batch := statsBatch(500)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if batched {
+			driver.AddStatsBatch(batch)
+		} else {
+			for _, pair := range batch {
+				driver.AddStats(pair.Ref, pair.Stats)
+			}
+		}
+		driver.points = driver.points[:0]
+	}
+}
+
+func BenchmarkAddStats500Containers(b *testing.B) {
+	benchmarkAddStats(b, false)
+}
+
+func BenchmarkAddStatsBatch500Containers(b *testing.B) {
+	benchmarkAddStats(b, true)
+}
@@ -0,0 +1,106 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"fmt"
+
+	info "github.com/google/cadvisor/info/v1"
+
+	influxdb "github.com/influxdb/influxdb/client"
+)
+
+// Series names of the per-device stats. The aggregate network series keep
+// their names, the per-interface ones are separate series so that queries
+// summing the aggregate ones are not affected.
+const (
+	// Cumulative count of bytes received per interface.
+	serInterfaceRxBytes string = "interface_rx_bytes"
+	// Cumulative count of receive errors encountered per interface.
+	serInterfaceRxErrors string = "interface_rx_errors"
+	// Cumulative count of bytes transmitted per interface.
+	serInterfaceTxBytes string = "interface_tx_bytes"
+	// Cumulative count of transmit errors encountered per interface.
+	serInterfaceTxErrors string = "interface_tx_errors"
+	// Cumulative count of bytes transferred per disk and operation.
+	serDiskIoServiceBytes string = "disk_io_service_bytes"
+	// Cumulative count of I/O operations per disk and operation.
+	serDiskIoServiced string = "disk_io_serviced"
+)
+
+// Tag names of the per-device stats. Filesystem points are tagged with
+// fieldDevice, as are the disk ones.
+const (
+	tagInterface string = "interface"
+	tagOperation string = "operation"
+)
+
+// interfaceStatsToPoints returns one point per network interface and stat.
+func interfaceStatsToPoints(stats *info.ContainerStats) (points []*influxdb.Point) {
+	for _, iface := range stats.Network.Interfaces {
+		tags := map[string]string{tagInterface: iface.Name}
+		for _, p := range []*influxdb.Point{
+			makePoint(serInterfaceRxBytes, iface.RxBytes),
+			makePoint(serInterfaceRxErrors, iface.RxErrors),
+			makePoint(serInterfaceTxBytes, iface.TxBytes),
+			makePoint(serInterfaceTxErrors, iface.TxErrors),
+		} {
+			addTagsToPoint(p, tags)
+			points = append(points, p)
+		}
+	}
+	return points
+}
+
+// diskDevice returns the name of a disk, or its major:minor numbers if the
+// name is not known.
+func diskDevice(disk info.PerDiskStats) string {
+	if disk.Device != "" {
+		return disk.Device
+	}
+	return fmt.Sprintf("%d:%d", disk.Major, disk.Minor)
+}
+
+// diskStatsToPoints returns one point per disk and operation, e.g. Read or
+// Write.
+func diskStatsToPoints(name string, disks []info.PerDiskStats) (points []*influxdb.Point) {
+	for _, disk := range disks {
+		device := diskDevice(disk)
+		for operation, value := range disk.Stats {
+			p := makePoint(name, value)
+			addTagsToPoint(p, map[string]string{
+				fieldDevice:  device,
+				tagOperation: operation,
+			})
+			points = append(points, p)
+		}
+	}
+	return points
+}
+
+// containerDeviceStatsToPoints returns the per-interface and per-disk points
+// of a container.
+func (self *influxdbStorage) containerDeviceStatsToPoints(
+	ref info.ContainerReference,
+	stats *info.ContainerStats,
+) (points []*influxdb.Point) {
+	points = append(points, interfaceStatsToPoints(stats)...)
+	points = append(points, diskStatsToPoints(serDiskIoServiceBytes, stats.DiskIo.IoServiceBytes)...)
+	points = append(points, diskStatsToPoints(serDiskIoServiced, stats.DiskIo.IoServiced)...)
+
+	self.tagPoints(ref, stats, points)
+
+	return points
+}
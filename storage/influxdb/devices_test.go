@@ -0,0 +1,111 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+func multiDeviceStats() *info.ContainerStats {
+	stats := &info.ContainerStats{Timestamp: time.Now()}
+	stats.Network.InterfaceStats = info.InterfaceStats{Name: "eth0", RxBytes: 100, TxBytes: 200}
+	stats.Network.Interfaces = []info.InterfaceStats{
+		{Name: "eth0", RxBytes: 100, TxBytes: 200},
+		{Name: "tun0", RxBytes: 10, RxErrors: 1, TxBytes: 20, TxErrors: 2},
+	}
+	stats.DiskIo.IoServiceBytes = []info.PerDiskStats{
+		{Device: "/dev/sda", Major: 8, Minor: 0, Stats: map[string]uint64{"Read": 4096, "Write": 8192}},
+		{Major: 8, Minor: 16, Stats: map[string]uint64{"Read": 512}},
+	}
+	stats.DiskIo.IoServiced = []info.PerDiskStats{
+		{Device: "/dev/sda", Major: 8, Minor: 0, Stats: map[string]uint64{"Read": 1, "Write": 2}},
+	}
+	stats.Filesystem = []info.FsStats{
+		{Device: "/dev/sda1", Limit: 1000, Usage: 100},
+		{Device: "/dev/sdb1", Limit: 2000, Usage: 200},
+	}
+	return stats
+}
+
+// devicePoints buffers the stats of multiDeviceStats and returns the values
+// of the points of each series, by their device or interface tag.
+func devicePoints(t *testing.T, perDevice bool) map[string]map[string]interface{} {
+	driver, err := newStorage("machineA", "stats", "cadvisor", "", "root", "root", "localhost:8086", false, nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.perDevice = perDevice
+	driver.OverrideReadyToFlush(func() bool { return false })
+	if err := driver.AddStats(info.ContainerReference{Name: "/docker/abcd"}, multiDeviceStats()); err != nil {
+		t.Fatal(err)
+	}
+	ret := make(map[string]map[string]interface{})
+	for _, p := range driver.points {
+		if p.Tags[tagContainerName] != "/docker/abcd" || p.Tags[tagMachineName] != "machineA" {
+			t.Errorf("expected the point %v to identify the container", p)
+		}
+		key := p.Tags[tagInterface] + p.Tags[fieldDevice]
+		if operation, ok := p.Tags[tagOperation]; ok {
+			key += " " + operation
+		}
+		if ret[p.Measurement] == nil {
+			ret[p.Measurement] = make(map[string]interface{})
+		}
+		ret[p.Measurement][key] = p.Fields[fieldValue]
+	}
+	return ret
+}
+
+func TestPerDeviceSeries(t *testing.T) {
+	series := devicePoints(t, true)
+	expected := map[string]map[string]interface{}{
+		// Aggregates keep their series, with no interface tag.
+		serRxBytes:           {"": int64(100)},
+		serTxBytes:           {"": int64(200)},
+		serInterfaceRxBytes:  {"eth0": int64(100), "tun0": int64(10)},
+		serInterfaceRxErrors: {"eth0": int64(0), "tun0": int64(1)},
+		serInterfaceTxBytes:  {"eth0": int64(200), "tun0": int64(20)},
+		serInterfaceTxErrors: {"eth0": int64(0), "tun0": int64(2)},
+		serDiskIoServiceBytes: {
+			"/dev/sda Read":  int64(4096),
+			"/dev/sda Write": int64(8192),
+			"8:16 Read":      int64(512),
+		},
+		serDiskIoServiced: {"/dev/sda Read": int64(1), "/dev/sda Write": int64(2)},
+		serFsUsage:        {"/dev/sda1": int64(100), "/dev/sdb1": int64(200)},
+		serFsLimit:        {"/dev/sda1": int64(1000), "/dev/sdb1": int64(2000)},
+	}
+	for name, values := range expected {
+		if !reflect.DeepEqual(series[name], values) {
+			t.Errorf("expected the %s points %v, got %v", name, values, series[name])
+		}
+	}
+}
+
+func TestPerDeviceSeriesAreOptional(t *testing.T) {
+	series := devicePoints(t, false)
+	for _, name := range []string{serInterfaceRxBytes, serInterfaceRxErrors, serInterfaceTxBytes, serInterfaceTxErrors, serDiskIoServiceBytes, serDiskIoServiced} {
+		if _, ok := series[name]; ok {
+			t.Errorf("expected no %s points by default, got %v", name, series[name])
+		}
+	}
+	if !reflect.DeepEqual(series[serRxBytes], map[string]interface{}{"": int64(100)}) {
+		t.Errorf("expected the aggregate %s point, got %v", serRxBytes, series[serRxBytes])
+	}
+}
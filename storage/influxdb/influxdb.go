@@ -15,10 +15,12 @@
 package influxdb
 
 import (
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"net/url"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -33,18 +35,55 @@ func init() {
 	storage.RegisterStorageDriver("influxdb", new)
 }
 
-var argDbRetentionPolicy = flag.String("storage_driver_influxdb_retention_policy", "", "retention policy")
+var (
+	argDbRetentionPolicy         = flag.String("storage_driver_influxdb_retention_policy", "", "retention policy")
+	argRetentionPolicyDuration   = flag.Duration("storage_driver_influxdb_retention_policy_duration", 0, "create the retention policy with this duration on startup, or update its duration if it exists; 0 to leave retention policies alone")
+	argDownsampleRetentionPolicy = flag.String("storage_driver_influxdb_downsample_retention_policy", "", "retention policy created on startup along with continuous queries downsampling the stats into it (mean of the gauges, max of the counters); empty to disable downsampling")
+	argDownsampleDuration        = flag.Duration("storage_driver_influxdb_downsample_duration", 30*24*time.Hour, "duration of the downsample retention policy")
+	argDownsampleInterval        = flag.Duration("storage_driver_influxdb_downsample_interval", time.Minute, "interval of the downsampled points")
+	argLabelTags                 = flag.Bool("storage_driver_influxdb_label_tags", false, "add the container labels as tags, with their keys prefixed with label_ and sanitized; beware of the series cardinality")
+	argImageTag                  = flag.Bool("storage_driver_influxdb_image_tag", false, "add the container image as a tag; beware of the series cardinality")
+	argLegacyTags                = flag.Bool("storage_driver_influxdb_legacy_tags", false, "add every container label as a tag under its own key, as previous versions did, ignoring -storage_driver_influxdb_label_tags and -storage_driver_influxdb_image_tag")
+	argPerDevice                 = flag.Bool("storage_driver_influxdb_per_device", false, "also write the network stats per interface and the disk I/O stats per disk; beware of the series cardinality")
+	argMaxBatchPoints            = flag.Int("storage_driver_influxdb_max_batch_points", 5000, "maximum number of points written to InfluxDB with a single request; buffered points are written as soon as there are this many, before -storage_driver_buffer_duration; 0 for no limit")
+	argUDPPayloadSize            = flag.Int("storage_driver_influxdb_udp_payload_size", defaultUDPPayloadSize, "maximum size in bytes of the datagrams sent to InfluxDB when -storage_driver_host is a udp://host:port address")
+	argSpillDir                  = flag.String("storage_driver_influxdb_spill_dir", "", "directory the batches which could not be written to InfluxDB are kept in, until they can be written, even across restarts; empty to drop them")
+	argSpillMaxSize              = flag.Int64("storage_driver_influxdb_spill_max_size", 100<<20, "maximum size in bytes of the InfluxDB spill directory, the oldest batches are deleted beyond it")
+	argCaFile                    = flag.String("storage_driver_influxdb_ssl_ca", "", "optional certificate authority file used to verify the InfluxDB server certificate")
+	argCertFile                  = flag.String("storage_driver_influxdb_ssl_cert", "", "optional certificate file for InfluxDB TLS client authentication")
+	argKeyFile                   = flag.String("storage_driver_influxdb_ssl_key", "", "optional key file for InfluxDB TLS client authentication")
+	argInsecureSkipVerify        = flag.Bool("storage_driver_influxdb_ssl_insecure_skip_verify", false, "do not verify the InfluxDB server certificate chain and host name")
+	argV2                        = flag.Bool("storage_driver_influxdb_v2", false, "write to the InfluxDB 2.x write API (InfluxDB 2.x and InfluxDB Cloud) with a token, an organization and a bucket instead of a database")
+	argToken                     = flag.String("storage_driver_influxdb_token", "", "InfluxDB 2.x API token")
+	argOrg                       = flag.String("storage_driver_influxdb_org", "", "InfluxDB 2.x organization")
+	argBucket                    = flag.String("storage_driver_influxdb_bucket", "", "InfluxDB 2.x bucket, defaults to -storage_driver_db")
+)
 
 type influxdbStorage struct {
-	client          *influxdb.Client
+	client *influxdb.Client
+	// Writes to the InfluxDB 2.x write API or to the UDP listener instead
+	// of the client if set.
+	v2  *v2Writer
+	udp *udpWriter
+	// Keeps the batches which could not be written, nil if disabled.
+	spill           *spill
 	machineName     string
 	database        string
 	retentionPolicy string
 	bufferDuration  time.Duration
-	lastWrite       time.Time
-	points          []*influxdb.Point
-	lock            sync.Mutex
-	readyToFlush    func() bool
+	// Maximum number of points written with a single request, 0 for no
+	// limit. Points are flushed as soon as that many are buffered.
+	maxBatchPoints int
+	lastWrite      time.Time
+	points         []*influxdb.Point
+	lock           sync.Mutex
+	readyToFlush   func() bool
+	// Tags identifying the containers and the images they are looked up
+	// in.
+	tagLayout tagLayout
+	images    imageCache
+	// Writes the per-interface and per-disk series.
+	perDevice bool
 }
 
 // Series names
@@ -81,17 +120,93 @@ func new() (storage.StorageDriver, error) {
 	if err != nil {
 		return nil, err
 	}
-	return newStorage(
-		hostname,
-		*storage.ArgDbTable,
-		*storage.ArgDbName,
-		*argDbRetentionPolicy,
-		*storage.ArgDbUsername,
-		*storage.ArgDbPassword,
-		*storage.ArgDbHost,
-		*storage.ArgDbIsSecure,
-		*storage.ArgDbBufferDuration,
-	)
+	setup := &retentionSetup{
+		duration:           *argRetentionPolicyDuration,
+		downsamplePolicy:   *argDownsampleRetentionPolicy,
+		downsampleDuration: *argDownsampleDuration,
+		downsampleInterval: *argDownsampleInterval,
+	}
+	layout := tagLayout{
+		labels: *argLabelTags,
+		image:  *argImageTag,
+		legacy: *argLegacyTags,
+	}
+	udp := strings.HasPrefix(*storage.ArgDbHost, udpScheme)
+	if (*argV2 || udp) && (setup.duration > 0 || setup.downsamplePolicy != "") {
+		return nil, fmt.Errorf("InfluxDB retention policies and continuous queries are not supported by the InfluxDB 2.x write API nor over UDP")
+	}
+	tlsConfig, err := generateTLSConfig(*argCaFile, *argCertFile, *argKeyFile, *argInsecureSkipVerify)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the InfluxDB TLS configuration - %s", err)
+	}
+	if tlsConfig != nil && (udp || !*storage.ArgDbIsSecure) {
+		return nil, fmt.Errorf("the InfluxDB TLS options require -storage_driver_secure and are not supported over UDP")
+	}
+	var driver *influxdbStorage
+	switch {
+	case udp && *argV2:
+		return nil, fmt.Errorf("the InfluxDB 2.x write API is not available over UDP")
+	case udp:
+		driver, err = newUDPStorage(
+			hostname,
+			strings.TrimPrefix(*storage.ArgDbHost, udpScheme),
+			*argUDPPayloadSize,
+			*storage.ArgDbBufferDuration,
+		)
+	case *argV2:
+		bucket := *argBucket
+		if bucket == "" {
+			bucket = *storage.ArgDbName
+		}
+		driver, err = newV2Storage(
+			hostname,
+			*storage.ArgDbHost,
+			*storage.ArgDbIsSecure,
+			tlsConfig,
+			*argToken,
+			*argOrg,
+			bucket,
+			*storage.ArgDbBufferDuration,
+		)
+	default:
+		driver, err = newStorage(
+			hostname,
+			*storage.ArgDbTable,
+			*storage.ArgDbName,
+			*argDbRetentionPolicy,
+			*storage.ArgDbUsername,
+			*storage.ArgDbPassword,
+			*storage.ArgDbHost,
+			*storage.ArgDbIsSecure,
+			tlsConfig,
+			*storage.ArgDbBufferDuration,
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		if err := driver.checkTLS(*storage.ArgDbHost); err != nil {
+			return nil, err
+		}
+	}
+	driver.tagLayout = layout
+	driver.perDevice = *argPerDevice
+	driver.maxBatchPoints = *argMaxBatchPoints
+	if driver.client != nil {
+		if err := driver.setUpRetention(setup); err != nil {
+			return nil, err
+		}
+	}
+	if *argSpillDir != "" {
+		if udp {
+			return nil, fmt.Errorf("InfluxDB writes over UDP cannot be spilled to disk")
+		}
+		if driver.spill, err = newSpill(*argSpillDir, *argSpillMaxSize, driver.writeLines); err != nil {
+			return nil, err
+		}
+	}
+	return driver, nil
 }
 
 // Field names
@@ -105,6 +220,7 @@ const (
 const (
 	tagMachineName   string = "machine"
 	tagContainerName string = "container_name"
+	tagImage         string = "image"
 )
 
 func (self *influxdbStorage) containerFilesystemStatsToPoints(
@@ -159,14 +275,10 @@ func (self *influxdbStorage) tagPoints(ref info.ContainerReference, stats *info.
 		containerName = ref.Name
 	}
 
-	commonTags := map[string]string{
-		tagMachineName:   self.machineName,
-		tagContainerName: containerName,
-	}
+	commonTags := self.containerTags(ref, containerName)
 	for i := 0; i < len(points); i++ {
 		// merge with existing tags if any
 		addTagsToPoint(points[i], commonTags)
-		addTagsToPoint(points[i], ref.Labels)
 		points[i].Time = stats.Timestamp
 	}
 }
@@ -222,7 +334,25 @@ func (self *influxdbStorage) defaultReadyToFlush() bool {
 }
 
 func (self *influxdbStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
-	if stats == nil {
+	return self.AddStatsBatch([]storage.ContainerStatsPair{{Ref: ref, Stats: stats}})
+}
+
+// AddStatsBatch buffers the points of the stats of several containers at
+// once, holding the lock of the buffer once for all of them, and writes the
+// buffer if it is full or the buffer duration elapsed.
+func (self *influxdbStorage) AddStatsBatch(batch []storage.ContainerStatsPair) error {
+	var timestamp time.Time
+	for _, pair := range batch {
+		if pair.Stats == nil {
+			continue
+		}
+		timestamp = pair.Stats.Timestamp
+		if self.tagLayout.image && !self.tagLayout.legacy {
+			// Look up the image of new containers without holding the lock.
+			self.images.image(pair.Ref.Name, time.Now())
+		}
+	}
+	if timestamp.IsZero() {
 		return nil
 	}
 	var pointsToFlush []*influxdb.Point
@@ -231,37 +361,111 @@ func (self *influxdbStorage) AddStats(ref info.ContainerReference, stats *info.C
 		self.lock.Lock()
 		defer self.lock.Unlock()
 
-		self.points = append(self.points, self.containerStatsToPoints(ref, stats)...)
-		self.points = append(self.points, self.containerFilesystemStatsToPoints(ref, stats)...)
-		if self.readyToFlush() {
+		for _, pair := range batch {
+			if pair.Stats == nil {
+				continue
+			}
+			self.points = append(self.points, self.containerStatsToPoints(pair.Ref, pair.Stats)...)
+			self.points = append(self.points, self.containerFilesystemStatsToPoints(pair.Ref, pair.Stats)...)
+			if self.perDevice {
+				self.points = append(self.points, self.containerDeviceStatsToPoints(pair.Ref, pair.Stats)...)
+			}
+		}
+		full := self.maxBatchPoints > 0 && len(self.points) >= self.maxBatchPoints
+		if full || self.readyToFlush() {
 			pointsToFlush = self.points
 			self.points = make([]*influxdb.Point, 0)
 			self.lastWrite = time.Now()
+			self.images.expire(self.lastWrite)
 		}
 	}()
-	if len(pointsToFlush) > 0 {
-		points := make([]influxdb.Point, len(pointsToFlush))
-		for i, p := range pointsToFlush {
-			points[i] = *p
+	// Oversized batches are split into several requests.
+	for len(pointsToFlush) > 0 {
+		n := len(pointsToFlush)
+		if self.maxBatchPoints > 0 && n > self.maxBatchPoints {
+			n = self.maxBatchPoints
+		}
+		if err := self.write(pointsToFlush[:n], timestamp); err != nil {
+			return err
 		}
+		pointsToFlush = pointsToFlush[n:]
+	}
+	return nil
+}
 
-		batchTags := map[string]string{tagMachineName: self.machineName}
-		bp := influxdb.BatchPoints{
-			Points:          points,
-			Database:        self.database,
-			RetentionPolicy: self.retentionPolicy,
-			Tags:            batchTags,
-			Time:            stats.Timestamp,
+// write sends a batch of points with a single request. Batches which could
+// not be written over HTTP are spilled to disk if enabled, and the spilled
+// batches are written once a batch is.
+func (self *influxdbStorage) write(pointsToWrite []*influxdb.Point, timestamp time.Time) error {
+	if self.udp != nil {
+		if err := self.udp.write(pointsToWrite); err != nil {
+			return fmt.Errorf("failed to write stats to influxDb - %s", err)
 		}
-		response, err := self.client.Write(bp)
-		if err != nil || checkResponseForErrors(response) != nil {
+		return nil
+	}
+	err := self.send(pointsToWrite, timestamp)
+	if self.spill == nil {
+		return err
+	}
+	if err != nil {
+		precision := spillPrecision
+		if self.v2 != nil {
+			precision = v2Precision
+		}
+		if spillErr := self.spill.add(lineProtocol(pointsToWrite, precision), precision); spillErr != nil {
+			return fmt.Errorf("%s, and %s", err, spillErr)
+		}
+		return fmt.Errorf("%s, spilled the stats to disk", err)
+	}
+	self.spill.drain()
+	return nil
+}
+
+// writeLines sends points already in line protocol, e.g. spilled ones,
+// with timestamps in the given precision.
+func (self *influxdbStorage) writeLines(data []byte, precision string) error {
+	if self.v2 != nil {
+		return self.v2.writeLines(data, precision)
+	}
+	_, err := self.client.WriteLineProtocol(string(data), self.database, self.retentionPolicy, precision, "")
+	return err
+}
+
+// send writes a batch of points over HTTP.
+func (self *influxdbStorage) send(pointsToWrite []*influxdb.Point, timestamp time.Time) error {
+	if self.v2 != nil {
+		if err := self.v2.write(pointsToWrite); err != nil {
 			return fmt.Errorf("failed to write stats to influxDb - %s", err)
 		}
+		return nil
+	}
+	points := make([]influxdb.Point, len(pointsToWrite))
+	for i, p := range pointsToWrite {
+		points[i] = *p
+	}
+
+	batchTags := map[string]string{tagMachineName: self.machineName}
+	bp := influxdb.BatchPoints{
+		Points:          points,
+		Database:        self.database,
+		RetentionPolicy: self.retentionPolicy,
+		Tags:            batchTags,
+		Time:            timestamp,
+	}
+	response, err := self.client.Write(bp)
+	if err != nil || checkResponseForErrors(response) != nil {
+		return fmt.Errorf("failed to write stats to influxDb - %s", err)
 	}
 	return nil
 }
 
 func (self *influxdbStorage) Close() error {
+	if self.udp != nil {
+		self.udp.close()
+	}
+	if self.spill != nil {
+		self.spill.close()
+	}
 	self.client = nil
 	return nil
 }
@@ -278,6 +482,7 @@ func newStorage(
 	password,
 	influxdbHost string,
 	isSecure bool,
+	tlsConfig *tls.Config,
 	bufferDuration time.Duration,
 ) (*influxdbStorage, error) {
 	url := &url.URL{
@@ -293,6 +498,7 @@ func newStorage(
 		Username:  username,
 		Password:  password,
 		UserAgent: fmt.Sprintf("%v/%v", "cAdvisor", version.Info["version"]),
+		TLS:       tlsConfig,
 	}
 	client, err := influxdb.NewClient(*config)
 	if err != nil {
@@ -119,6 +119,7 @@ func runStorageTest(f func(test.TestStorageDriver, *testing.T), t *testing.T, bu
 		password,
 		hostname,
 		false,
+		nil,
 		time.Duration(bufferCount))
 	if err != nil {
 		t.Fatal(err)
@@ -140,6 +141,7 @@ func runStorageTest(f func(test.TestStorageDriver, *testing.T), t *testing.T, bu
 		password,
 		hostname,
 		false,
+		nil,
 		time.Duration(bufferCount))
 	if err != nil {
 		t.Fatal(err)
@@ -196,7 +198,7 @@ func TestContainerFileSystemStatsToPoints(t *testing.T) {
 		username,
 		password,
 		influxdbHost,
-		false, 2*time.Minute)
+		false, nil, 2*time.Minute)
 	assert.Nil(err)
 
 	ref := info.ContainerReference{
@@ -269,7 +271,7 @@ func createTestStorage() (*influxdbStorage, error) {
 		username,
 		password,
 		influxdbHost,
-		false, 2*time.Minute)
+		false, nil, 2*time.Minute)
 
 	return storage, err
 }
@@ -0,0 +1,184 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	influxdb "github.com/influxdb/influxdb/client"
+)
+
+// Series whose values are sampled as is, downsampled with their mean. The
+// other series are cumulative counters, downsampled with their maximum.
+var gaugeSeries = map[string]bool{
+	serLoadAverage:      true,
+	serMemoryUsage:      true,
+	serMemoryWorkingSet: true,
+	serFsLimit:          true,
+	serFsUsage:          true,
+}
+
+// allSeries lists the series written by the driver.
+var allSeries = []string{
+	serCpuUsageTotal,
+	serCpuUsageSystem,
+	serCpuUsageUser,
+	serCpuUsagePerCpu,
+	serLoadAverage,
+	serMemoryUsage,
+	serMemoryWorkingSet,
+	serRxBytes,
+	serRxErrors,
+	serTxBytes,
+	serTxErrors,
+	serFsLimit,
+	serFsUsage,
+	serInterfaceRxBytes,
+	serInterfaceRxErrors,
+	serInterfaceTxBytes,
+	serInterfaceTxErrors,
+	serDiskIoServiceBytes,
+	serDiskIoServiced,
+}
+
+// retentionSetup describes the retention policies and continuous queries
+// created on startup.
+type retentionSetup struct {
+	// Duration of the retention policy the stats are written to, which
+	// is created unless 0.
+	duration time.Duration
+	// Retention policy the downsampled series are written to, none if
+	// empty, its duration and the interval of the downsampled points.
+	downsamplePolicy   string
+	downsampleDuration time.Duration
+	downsampleInterval time.Duration
+}
+
+// influxDuration returns d as an InfluxQL duration literal in its largest
+// whole unit, e.g. 30d rather than 720h.
+func influxDuration(d time.Duration) string {
+	units := []struct {
+		suffix string
+		unit   time.Duration
+	}{
+		{"w", 7 * 24 * time.Hour},
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	}
+	for _, u := range units {
+		if d%u.unit == 0 {
+			return fmt.Sprintf("%d%s", d/u.unit, u.suffix)
+		}
+	}
+	return fmt.Sprintf("%dms", d/time.Millisecond)
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `\"`, -1) + `"`
+}
+
+func isAlreadyExists(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "already exists")
+}
+
+// query runs an InfluxQL statement on the database.
+func (self *influxdbStorage) query(command string) error {
+	response, err := self.client.Query(influxdb.Query{Command: command, Database: self.database})
+	if err != nil {
+		return err
+	}
+	if response != nil {
+		return response.Error()
+	}
+	return nil
+}
+
+// ensureRetentionPolicy creates a retention policy, or updates its duration
+// if it already exists.
+func (self *influxdbStorage) ensureRetentionPolicy(name string, duration time.Duration) error {
+	err := self.query(fmt.Sprintf("CREATE RETENTION POLICY %s ON %s DURATION %s REPLICATION 1",
+		quoteIdentifier(name), quoteIdentifier(self.database), influxDuration(duration)))
+	if isAlreadyExists(err) {
+		err = self.query(fmt.Sprintf("ALTER RETENTION POLICY %s ON %s DURATION %s",
+			quoteIdentifier(name), quoteIdentifier(self.database), influxDuration(duration)))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create the InfluxDB retention policy %q - %s", name, err)
+	}
+	return nil
+}
+
+// continuousQuery returns the statement creating the continuous query
+// downsampling series into the downsample retention policy.
+func (self *influxdbStorage) continuousQuery(series string, setup *retentionSetup) string {
+	aggregate := "max"
+	if gaugeSeries[series] {
+		aggregate = "mean"
+	}
+	interval := influxDuration(setup.downsampleInterval)
+	// An empty retention policy selects the default one.
+	source := fmt.Sprintf("%s..%s", quoteIdentifier(self.database), quoteIdentifier(series))
+	if self.retentionPolicy != "" {
+		source = fmt.Sprintf("%s.%s.%s", quoteIdentifier(self.database), quoteIdentifier(self.retentionPolicy), quoteIdentifier(series))
+	}
+	return fmt.Sprintf(`CREATE CONTINUOUS QUERY %s ON %s BEGIN SELECT %s("%s") AS "%s" INTO %s.%s.%s FROM %s GROUP BY time(%s), * END`,
+		quoteIdentifier(fmt.Sprintf("cadvisor_%s_%s", series, interval)),
+		quoteIdentifier(self.database),
+		aggregate, fieldValue, fieldValue,
+		quoteIdentifier(self.database), quoteIdentifier(setup.downsamplePolicy), quoteIdentifier(series),
+		source,
+		interval)
+}
+
+// setUpRetention creates the retention policies and continuous queries. It
+// can be run on every startup: existing retention policies are updated and
+// existing continuous queries are kept.
+func (self *influxdbStorage) setUpRetention(setup *retentionSetup) error {
+	if setup.duration > 0 {
+		if self.retentionPolicy == "" {
+			return fmt.Errorf("a retention policy name is required to create it, see -storage_driver_influxdb_retention_policy")
+		}
+		if err := self.ensureRetentionPolicy(self.retentionPolicy, setup.duration); err != nil {
+			return err
+		}
+	}
+	if setup.downsamplePolicy == "" {
+		return nil
+	}
+	if setup.downsampleDuration <= 0 || setup.downsampleInterval <= 0 {
+		return fmt.Errorf("invalid InfluxDB downsampling duration %v or interval %v", setup.downsampleDuration, setup.downsampleInterval)
+	}
+	if err := self.ensureRetentionPolicy(setup.downsamplePolicy, setup.downsampleDuration); err != nil {
+		return err
+	}
+	for _, series := range allSeries {
+		err := self.query(self.continuousQuery(series, setup))
+		if isAlreadyExists(err) {
+			// Continuous queries cannot be altered, a changed one must be
+			// dropped by hand.
+			glog.Warningf("InfluxDB continuous query downsampling %q already exists with a different definition, keeping it", series)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create the InfluxDB continuous query downsampling %q - %s", series, err)
+		}
+	}
+	return nil
+}
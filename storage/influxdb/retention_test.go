@@ -0,0 +1,163 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeInfluxQL records the statements it receives. Statements starting with
+// one of the prefixes of errors fail with its error.
+type fakeInfluxQL struct {
+	statements []string
+	errors     map[string]string
+}
+
+func (self *fakeInfluxQL) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	statement := r.URL.Query().Get("q")
+	self.statements = append(self.statements, statement)
+	result := map[string]interface{}{}
+	for prefix, message := range self.errors {
+		if strings.HasPrefix(statement, prefix) {
+			result["error"] = message
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"results": []interface{}{result}})
+}
+
+func newRetentionTestStorage(t *testing.T, influx *fakeInfluxQL, retentionPolicy string) (*influxdbStorage, func()) {
+	server := httptest.NewServer(influx)
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver, err := newStorage("machineA", "stats", "cadvisor", retentionPolicy, "root", "root", u.Host, false, nil, time.Minute)
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	return driver, server.Close
+}
+
+var testRetentionSetup = &retentionSetup{
+	duration:           24 * time.Hour,
+	downsamplePolicy:   "rollup",
+	downsampleDuration: 30 * 24 * time.Hour,
+	downsampleInterval: time.Minute,
+}
+
+func TestSetUpRetention(t *testing.T) {
+	influx := &fakeInfluxQL{}
+	driver, closeServer := newRetentionTestStorage(t, influx, "raw")
+	defer closeServer()
+
+	if err := driver.setUpRetention(testRetentionSetup); err != nil {
+		t.Fatal(err)
+	}
+	if len(influx.statements) != 2+len(allSeries) {
+		t.Fatalf("expected 2 retention policies and %d continuous queries, got %q", len(allSeries), influx.statements)
+	}
+	expected := []string{
+		`CREATE RETENTION POLICY "raw" ON "cadvisor" DURATION 1d REPLICATION 1`,
+		`CREATE RETENTION POLICY "rollup" ON "cadvisor" DURATION 30d REPLICATION 1`,
+	}
+	for i, statement := range expected {
+		if influx.statements[i] != statement {
+			t.Errorf("expected %q, got %q", statement, influx.statements[i])
+		}
+	}
+	queries := strings.Join(influx.statements[2:], "\n")
+	for _, query := range []string{
+		`CREATE CONTINUOUS QUERY "cadvisor_memory_usage_1m" ON "cadvisor" BEGIN SELECT mean("value") AS "value" INTO "cadvisor"."rollup"."memory_usage" FROM "cadvisor"."raw"."memory_usage" GROUP BY time(1m), * END`,
+		`CREATE CONTINUOUS QUERY "cadvisor_rx_bytes_1m" ON "cadvisor" BEGIN SELECT max("value") AS "value" INTO "cadvisor"."rollup"."rx_bytes" FROM "cadvisor"."raw"."rx_bytes" GROUP BY time(1m), * END`,
+	} {
+		if !strings.Contains(queries, query) {
+			t.Errorf("expected the continuous query %q, got\n%s", query, queries)
+		}
+	}
+}
+
+func TestSetUpRetentionIsIdempotent(t *testing.T) {
+	influx := &fakeInfluxQL{errors: map[string]string{
+		"CREATE RETENTION POLICY": "retention policy already exists",
+		"CREATE CONTINUOUS QUERY": "continuous query already exists",
+	}}
+	driver, closeServer := newRetentionTestStorage(t, influx, "raw")
+	defer closeServer()
+
+	if err := driver.setUpRetention(testRetentionSetup); err != nil {
+		t.Fatalf("expected existing retention policies and continuous queries to be tolerated, got %v", err)
+	}
+	alters := 0
+	for _, statement := range influx.statements {
+		if strings.HasPrefix(statement, "ALTER RETENTION POLICY") {
+			alters++
+		}
+	}
+	if alters != 2 {
+		t.Errorf("expected the duration of the 2 existing retention policies to be updated, got %q", influx.statements)
+	}
+}
+
+func TestSetUpRetentionErrors(t *testing.T) {
+	influx := &fakeInfluxQL{errors: map[string]string{
+		"CREATE RETENTION POLICY": "database not found: cadvisor",
+	}}
+	driver, closeServer := newRetentionTestStorage(t, influx, "raw")
+	defer closeServer()
+	if err := driver.setUpRetention(testRetentionSetup); err == nil || !strings.Contains(err.Error(), "database not found") {
+		t.Errorf("expected the InfluxDB error, got %v", err)
+	}
+
+	unnamed, closeServer := newRetentionTestStorage(t, &fakeInfluxQL{}, "")
+	defer closeServer()
+	if err := unnamed.setUpRetention(&retentionSetup{duration: time.Hour}); err == nil {
+		t.Error("expected an error when creating a retention policy without name")
+	}
+}
+
+func TestSetUpRetentionDisabled(t *testing.T) {
+	influx := &fakeInfluxQL{}
+	driver, closeServer := newRetentionTestStorage(t, influx, "")
+	defer closeServer()
+	if err := driver.setUpRetention(&retentionSetup{downsampleDuration: time.Hour, downsampleInterval: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if len(influx.statements) != 0 {
+		t.Errorf("expected no statements, got %q", influx.statements)
+	}
+}
+
+func TestInfluxDuration(t *testing.T) {
+	for d, expected := range map[time.Duration]string{
+		14 * 24 * time.Hour:     "2w",
+		30 * 24 * time.Hour:     "30d",
+		36 * time.Hour:          "36h",
+		90 * time.Second:        "90s",
+		time.Minute:             "1m",
+		1500 * time.Millisecond: "1500ms",
+	} {
+		if actual := influxDuration(d); actual != expected {
+			t.Errorf("expected %v to be %q, got %q", d, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Longest time a flush waits for the spill to take a failed batch before
+// giving up on it.
+const spillTimeout = 100 * time.Millisecond
+
+// Number of failed batches waiting to be written to disk.
+const spillQueueSize = 16
+
+// Precision of the timestamps of the batches spilled by the InfluxDB 1.x
+// driver, which writes them in nanoseconds.
+const spillPrecision = "n"
+
+// Suffix of the segment files, each holding a batch in line protocol.
+const segmentSuffix = ".lp"
+
+// spilledBatch is a batch of points in line protocol, with timestamps in
+// the given precision.
+type spilledBatch struct {
+	data      []byte
+	precision string
+}
+
+// spill keeps the batches which could not be written to InfluxDB on disk,
+// one segment file per batch, and writes them oldest first once InfluxDB
+// is back. The oldest segments are deleted to keep the spill under maxSize
+// bytes. Disk accesses happen in the background so that flushes never wait
+// for them more than spillTimeout.
+type spill struct {
+	dir     string
+	maxSize int64
+	// Writes a spilled batch to InfluxDB.
+	send    func(data []byte, precision string) error
+	batches chan spilledBatch
+	drainCh chan struct{}
+	stopCh  chan struct{}
+	wg      sync.WaitGroup
+	// Sequence number of the next segment, after the existing ones.
+	seq uint64
+	// Number of batches lost because the spill was busy, full or failing.
+	dropped uint64
+}
+
+func newSpill(dir string, maxSize int64, send func(data []byte, precision string) error) (*spill, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("invalid InfluxDB spill size %d", maxSize)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create the InfluxDB spill directory %q - %s", dir, err)
+	}
+	ret := &spill{
+		dir:     dir,
+		maxSize: maxSize,
+		send:    send,
+		batches: make(chan spilledBatch, spillQueueSize),
+		drainCh: make(chan struct{}, 1),
+		stopCh:  make(chan struct{}),
+	}
+	segments, err := ret.segments()
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) > 0 {
+		// Segments left by a previous run are written first.
+		var seq uint64
+		fmt.Sscanf(filepath.Base(segments[len(segments)-1]), "%d", &seq)
+		ret.seq = seq + 1
+		glog.Infof("%d InfluxDB batches were spilled to %q, writing them", len(segments), dir)
+		ret.drain()
+	}
+	ret.wg.Add(1)
+	go ret.run()
+	return ret, nil
+}
+
+// add queues a batch to be written to disk, or drops it if the spill does
+// not take it within spillTimeout.
+func (self *spill) add(data []byte, precision string) error {
+	select {
+	case self.batches <- spilledBatch{data, precision}:
+		return nil
+	case <-time.After(spillTimeout):
+		return fmt.Errorf("the InfluxDB spill is busy, dropped the batch (%d dropped in total)", atomic.AddUint64(&self.dropped, 1))
+	}
+}
+
+// drain asks for the spilled batches to be written to InfluxDB.
+func (self *spill) drain() {
+	select {
+	case self.drainCh <- struct{}{}:
+	default:
+	}
+}
+
+// Dropped returns the number of batches lost by the spill.
+func (self *spill) Dropped() uint64 {
+	return atomic.LoadUint64(&self.dropped)
+}
+
+func (self *spill) run() {
+	defer self.wg.Done()
+	for {
+		select {
+		case batch := <-self.batches:
+			self.save(batch)
+		case <-self.drainCh:
+			self.drainSegments()
+		case <-self.stopCh:
+			// Keep the batches still queued for the next run.
+			for {
+				select {
+				case batch := <-self.batches:
+					self.save(batch)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (self *spill) close() {
+	close(self.stopCh)
+	self.wg.Wait()
+}
+
+// segments returns the paths of the segment files, oldest first.
+func (self *spill) segments() ([]string, error) {
+	files, err := ioutil.ReadDir(self.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the InfluxDB spill directory %q - %s", self.dir, err)
+	}
+	var ret []string
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), segmentSuffix) {
+			ret = append(ret, filepath.Join(self.dir, file.Name()))
+		}
+	}
+	// Sequence numbers are zero-padded.
+	sort.Strings(ret)
+	return ret, nil
+}
+
+// segmentPrecision returns the precision of the timestamps of a segment,
+// which is part of its name.
+func segmentPrecision(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), segmentSuffix)
+	if i := strings.LastIndex(name, "-"); i >= 0 {
+		return name[i+1:]
+	}
+	return ""
+}
+
+// save writes a batch to a new segment and deletes the oldest segments
+// beyond maxSize.
+func (self *spill) save(batch spilledBatch) {
+	path := filepath.Join(self.dir, fmt.Sprintf("%020d-%s%s", self.seq, batch.precision, segmentSuffix))
+	self.seq++
+	if err := ioutil.WriteFile(path, batch.data, 0600); err != nil {
+		os.Remove(path)
+		total := atomic.AddUint64(&self.dropped, 1)
+		glog.Errorf("failed to spill an InfluxDB batch to %q (%d dropped in total) - %s", path, total, err)
+		return
+	}
+	self.enforceMaxSize()
+}
+
+func (self *spill) enforceMaxSize() {
+	segments, err := self.segments()
+	if err != nil {
+		glog.Errorf("%s", err)
+		return
+	}
+	sizes := make([]int64, len(segments))
+	var total int64
+	for i, segment := range segments {
+		if fileInfo, err := os.Stat(segment); err == nil {
+			sizes[i] = fileInfo.Size()
+			total += sizes[i]
+		}
+	}
+	for i := 0; i < len(segments) && total > self.maxSize; i++ {
+		if err := os.Remove(segments[i]); err != nil {
+			glog.Errorf("failed to delete the InfluxDB spill segment %q - %s", segments[i], err)
+			continue
+		}
+		total -= sizes[i]
+		dropped := atomic.AddUint64(&self.dropped, 1)
+		glog.Warningf("InfluxDB spill is full, deleted its oldest batch (%d dropped in total)", dropped)
+	}
+}
+
+// drainSegments writes the segments to InfluxDB oldest first, and deletes
+// them once written. It stops at the first failure.
+func (self *spill) drainSegments() {
+	segments, err := self.segments()
+	if err != nil {
+		glog.Errorf("%s", err)
+		return
+	}
+	for _, segment := range segments {
+		data, err := ioutil.ReadFile(segment)
+		if err != nil {
+			glog.Errorf("failed to read the InfluxDB spill segment %q, deleting it - %s", segment, err)
+			os.Remove(segment)
+			continue
+		}
+		if err := self.send(data, segmentPrecision(segment)); err != nil {
+			glog.Warningf("failed to write the spilled InfluxDB batches, will retry - %s", err)
+			return
+		}
+		if err := os.Remove(segment); err != nil {
+			// Better written twice than not at all.
+			glog.Errorf("failed to delete the InfluxDB spill segment %q - %s", segment, err)
+		}
+	}
+}
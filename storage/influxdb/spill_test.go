@@ -0,0 +1,200 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// flakyInfluxDB fails the writes while it is down, and records the points
+// written while it is up.
+type flakyInfluxDB struct {
+	lock       sync.Mutex
+	down       bool
+	lines      []string
+	precisions []string
+}
+
+func (self *flakyInfluxDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error":"service unavailable"}`))
+		return
+	}
+	self.lines = append(self.lines, strings.Split(strings.TrimSuffix(string(body), "\n"), "\n")...)
+	self.precisions = append(self.precisions, r.URL.Query().Get("precision"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (self *flakyInfluxDB) setDown(down bool) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.down = down
+}
+
+func (self *flakyInfluxDB) written() ([]string, []string) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.lines, self.precisions
+}
+
+// waitForSegments waits until the spill holds n segments.
+func waitForSegments(t *testing.T, s *spill, n int) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		segments, err := s.segments()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(segments) == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d spilled segments, got %d", n, len(segments))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newSpillTestStorage(t *testing.T, influx http.Handler, dir string) (*influxdbStorage, func()) {
+	driver, closeServer := newBatchTestStorage(t, influx, 0)
+	driver.OverrideReadyToFlush(func() bool { return true })
+	var err error
+	if driver.spill, err = newSpill(dir, 1<<20, driver.writeLines); err != nil {
+		closeServer()
+		t.Fatal(err)
+	}
+	return driver, closeServer
+}
+
+func addSpillTestStats(t *testing.T, driver *influxdbStorage, memoryUsage uint64) error {
+	stats := &info.ContainerStats{Timestamp: time.Unix(1463486400, 0)}
+	stats.Memory.Usage = memoryUsage
+	return driver.AddStats(info.ContainerReference{Name: "/"}, stats)
+}
+
+func TestSpillDuringOutage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cadvisor-influxdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	influx := &flakyInfluxDB{down: true}
+	driver, closeServer := newSpillTestStorage(t, influx, dir)
+	defer closeServer()
+	defer driver.Close()
+
+	for i := 1; i <= 2; i++ {
+		if err := addSpillTestStats(t, driver, uint64(i)); err == nil || !strings.Contains(err.Error(), "spilled") {
+			t.Errorf("expected the failed write to be spilled, got %v", err)
+		}
+	}
+	waitForSegments(t, driver.spill, 2)
+
+	influx.setDown(false)
+	if err := addSpillTestStats(t, driver, 3); err != nil {
+		t.Fatal(err)
+	}
+	waitForSegments(t, driver.spill, 0)
+
+	lines, precisions := influx.written()
+	if len(lines) != 30 {
+		t.Fatalf("expected the 3 batches of 10 points to be written, got %d points", len(lines))
+	}
+	// The live batch goes first, then the spilled ones, oldest first.
+	var usages []string
+	for _, line := range lines {
+		if strings.HasPrefix(line, serMemoryUsage+",") {
+			usages = append(usages, strings.Fields(line)[1])
+		}
+	}
+	if strings.Join(usages, " ") != "value=3i value=1i value=2i" {
+		t.Errorf("expected the spilled batches to be written oldest first, got %v", usages)
+	}
+	if precisions[1] != "n" || !strings.HasSuffix(lines[10], " 1463486400000000000") {
+		t.Errorf("expected the spilled timestamps in nanoseconds, got %q with precision %q", lines[10], precisions[1])
+	}
+}
+
+func TestSpillSurvivesRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cadvisor-influxdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	influx := &flakyInfluxDB{down: true}
+	driver, closeServer := newSpillTestStorage(t, influx, dir)
+	defer closeServer()
+
+	addSpillTestStats(t, driver, 1)
+	driver.Close()
+	segments, err := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if err != nil || len(segments) != 1 {
+		t.Fatalf("expected the batch to be kept after closing, got %v (%v)", segments, err)
+	}
+
+	influx.setDown(false)
+	restarted, closeRestartedServer := newSpillTestStorage(t, influx, dir)
+	defer closeRestartedServer()
+	defer restarted.Close()
+	waitForSegments(t, restarted.spill, 0)
+	if lines, _ := influx.written(); len(lines) != 10 {
+		t.Errorf("expected the batch spilled before the restart to be written, got %d points", len(lines))
+	}
+}
+
+func TestSpillMaxSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cadvisor-influxdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := newSpill(dir, 100, func(data []byte, precision string) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := s.add([]byte(strings.Repeat("x", 39)+"\n"), "n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.close()
+
+	segments, err := s.segments()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("expected the 2 newest segments to be kept, got %v", segments)
+	}
+	if !strings.HasSuffix(segments[0], "00000000000000000003-n"+segmentSuffix) {
+		t.Errorf("expected the oldest segments to be deleted, got %v", segments)
+	}
+	if s.Dropped() != 3 {
+		t.Errorf("expected 3 dropped batches, got %d", s.Dropped())
+	}
+}
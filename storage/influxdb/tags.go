@@ -0,0 +1,144 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/info/v2"
+	"github.com/google/cadvisor/storage"
+
+	"github.com/golang/glog"
+)
+
+// Prefix of the tags holding the container labels, so that they cannot
+// override the other tags.
+const labelTagPrefix = "label_"
+
+// Images of the containers not seen for this long are forgotten.
+const imageExpiry = 10 * time.Minute
+
+// tagLayout selects the tags identifying the containers of the points.
+type tagLayout struct {
+	// Container labels as tags, with sanitized keys.
+	labels bool
+	// Image of the container as a tag.
+	image bool
+	// Every container label as a tag under its own key, as before the
+	// other options existed.
+	legacy bool
+}
+
+type cachedImage struct {
+	image    string
+	lastSeen time.Time
+}
+
+// imageCache remembers the image of the containers, looked up in their
+// specification.
+type imageCache struct {
+	lock   sync.Mutex
+	source storage.ContainerSpecSource
+	images map[string]cachedImage
+}
+
+// SetContainerSpecSource lets the driver look up the image of the
+// containers.
+func (self *influxdbStorage) SetContainerSpecSource(source storage.ContainerSpecSource) {
+	self.images.lock.Lock()
+	defer self.images.lock.Unlock()
+	self.images.source = source
+}
+
+// image returns the image of a container, or an empty string if it is not
+// known.
+func (self *imageCache) image(containerName string, now time.Time) string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if cached, ok := self.images[containerName]; ok {
+		cached.lastSeen = now
+		self.images[containerName] = cached
+		return cached.image
+	}
+	if self.source == nil {
+		return ""
+	}
+	specs, err := self.source.GetContainerSpec(containerName, v2.RequestOptions{IdType: v2.TypeName, Count: 1})
+	if err != nil {
+		glog.V(4).Infof("failed to get the image of container %q for InfluxDB: %v", containerName, err)
+		return ""
+	}
+	if self.images == nil {
+		self.images = make(map[string]cachedImage)
+	}
+	image := specs[containerName].Image
+	self.images[containerName] = cachedImage{image, now}
+	return image
+}
+
+// expire forgets the images of the containers not seen since imageExpiry.
+func (self *imageCache) expire(now time.Time) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for name, cached := range self.images {
+		if now.Sub(cached.lastSeen) > imageExpiry {
+			delete(self.images, name)
+		}
+	}
+}
+
+// sanitizeTagKey returns key with the characters other than ASCII letters,
+// digits and underscores replaced by underscores, so that it needs no
+// escaping in line protocol nor quoting in InfluxQL.
+func sanitizeTagKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		}
+		return '_'
+	}, key)
+}
+
+// containerTags returns the tags identifying a container on every point.
+func (self *influxdbStorage) containerTags(ref info.ContainerReference, containerName string) map[string]string {
+	tags := map[string]string{
+		tagMachineName:   self.machineName,
+		tagContainerName: containerName,
+	}
+	if self.tagLayout.legacy {
+		for k, v := range ref.Labels {
+			tags[k] = v
+		}
+		return tags
+	}
+	if self.tagLayout.labels {
+		for k, v := range ref.Labels {
+			// Line protocol does not allow empty tag values.
+			if v != "" {
+				tags[labelTagPrefix+sanitizeTagKey(k)] = v
+			}
+		}
+	}
+	if self.tagLayout.image {
+		if image := self.images.image(ref.Name, time.Now()); image != "" {
+			tags[tagImage] = image
+		}
+	}
+	return tags
+}
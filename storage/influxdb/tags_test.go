@@ -0,0 +1,149 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/info/v2"
+)
+
+// fakeContainerSpecSource returns the images of the containers and counts
+// the lookups.
+type fakeContainerSpecSource struct {
+	images  map[string]string
+	lookups int
+}
+
+func (self *fakeContainerSpecSource) GetContainerSpec(containerName string, options v2.RequestOptions) (map[string]v2.ContainerSpec, error) {
+	self.lookups++
+	image, ok := self.images[containerName]
+	if !ok {
+		return nil, fmt.Errorf("unknown container %q", containerName)
+	}
+	return map[string]v2.ContainerSpec{containerName: {Image: image}}, nil
+}
+
+var taggedRef = info.ContainerReference{
+	Name:    "/docker/abcd",
+	Aliases: []string{"web", "abcd"},
+	Labels: map[string]string{
+		"io.kubernetes.pod.name": "web-1",
+		"com.example/team name":  "payments",
+		"empty":                  "",
+	},
+}
+
+func newTagsTestStorage(t *testing.T, layout tagLayout) *influxdbStorage {
+	driver, err := newStorage("machineA", "stats", "cadvisor", "", "root", "root", "localhost:8086", false, nil, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.tagLayout = layout
+	driver.SetContainerSpecSource(&fakeContainerSpecSource{images: map[string]string{"/docker/abcd": "nginx:1.11"}})
+	return driver
+}
+
+// pointTags returns the tags of the memory usage point of the container.
+func pointTags(t *testing.T, driver *influxdbStorage) map[string]string {
+	stats := &info.ContainerStats{Timestamp: time.Now()}
+	for _, point := range driver.containerStatsToPoints(taggedRef, stats) {
+		if point.Measurement == serMemoryUsage {
+			if _, ok := point.Fields[tagContainerName]; ok {
+				t.Errorf("expected the container name not to be a field, got %v", point.Fields)
+			}
+			return point.Tags
+		}
+	}
+	t.Fatal("no memory usage point")
+	return nil
+}
+
+func TestContainerIdentityTags(t *testing.T) {
+	tags := pointTags(t, newTagsTestStorage(t, tagLayout{}))
+	expected := map[string]string{
+		"machine":        "machineA",
+		"container_name": "web",
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected the tags %v, got %v", expected, tags)
+	}
+}
+
+func TestLabelAndImageTags(t *testing.T) {
+	tags := pointTags(t, newTagsTestStorage(t, tagLayout{labels: true, image: true}))
+	expected := map[string]string{
+		"machine":                      "machineA",
+		"container_name":               "web",
+		"image":                        "nginx:1.11",
+		"label_io_kubernetes_pod_name": "web-1",
+		"label_com_example_team_name":  "payments",
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected the tags %v, got %v", expected, tags)
+	}
+}
+
+func TestLegacyTags(t *testing.T) {
+	tags := pointTags(t, newTagsTestStorage(t, tagLayout{legacy: true, image: true}))
+	expected := map[string]string{
+		"machine":                "machineA",
+		"container_name":         "web",
+		"io.kubernetes.pod.name": "web-1",
+		"com.example/team name":  "payments",
+		"empty":                  "",
+	}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("expected the tags %v, got %v", expected, tags)
+	}
+}
+
+func TestImageLookupsAreCached(t *testing.T) {
+	driver := newTagsTestStorage(t, tagLayout{image: true})
+	source := &fakeContainerSpecSource{images: map[string]string{"/docker/abcd": "nginx:1.11"}}
+	driver.SetContainerSpecSource(source)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if image := driver.images.image("/docker/abcd", now); image != "nginx:1.11" {
+			t.Errorf("expected the nginx image, got %q", image)
+		}
+	}
+	if source.lookups != 1 {
+		t.Errorf("expected 1 lookup, got %d", source.lookups)
+	}
+	driver.images.expire(now.Add(imageExpiry + time.Second))
+	driver.images.image("/docker/abcd", now)
+	if source.lookups != 2 {
+		t.Errorf("expected the image to be looked up again once expired, got %d lookups", source.lookups)
+	}
+}
+
+func TestSanitizeTagKey(t *testing.T) {
+	for key, expected := range map[string]string{
+		"app":                    "app",
+		"io.kubernetes.pod.name": "io_kubernetes_pod_name",
+		"com.example/team name":  "com_example_team_name",
+		"a,b=c":                  "a_b_c",
+		"région":                 "r_gion",
+	} {
+		if actual := sanitizeTagKey(key); actual != expected {
+			t.Errorf("expected %q to be sanitized as %q, got %q", key, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+
+	"github.com/golang/glog"
+)
+
+// generateTLSConfig returns the TLS configuration used to connect to
+// InfluxDB, or nil if the default one is fine.
+func generateTLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	if caFile == "" && certFile == "" && keyFile == "" && !insecureSkipVerify {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: insecureSkipVerify,
+	}
+	if caFile != "" {
+		caCert, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificate found in %q", caFile)
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// isDialError returns whether err means that InfluxDB could not be reached
+// at all, as opposed to e.g. a failed TLS handshake.
+func isDialError(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	opErr, ok := err.(*net.OpError)
+	return ok && opErr.Op == "dial"
+}
+
+// checkTLS pings InfluxDB so that TLS handshake failures, e.g. a rejected
+// client certificate, are reported on startup rather than as failed writes.
+// InfluxDB being unreachable is not an error, it may start after cAdvisor.
+func (self *influxdbStorage) checkTLS(influxdbHost string) error {
+	var err error
+	if self.v2 != nil {
+		err = self.v2.ping()
+	} else {
+		_, _, err = self.client.Ping()
+	}
+	if err == nil {
+		return nil
+	}
+	if isDialError(err) {
+		glog.Warningf("could not reach InfluxDB at %s to check the TLS configuration - %s", influxdbHost, err)
+		return nil
+	}
+	return fmt.Errorf("TLS connection to InfluxDB at %s failed, check -storage_driver_influxdb_ssl_ca, -storage_driver_influxdb_ssl_cert and -storage_driver_influxdb_ssl_key - %s", influxdbHost, err)
+}
@@ -0,0 +1,162 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// writePEM writes a PEM block to a new file of dir and returns its path.
+func writePEM(t *testing.T, dir, name, blockType string, bytes []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: bytes}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newClientCert generates a self-signed client certificate, written to
+// cert.pem and key.pem in dir.
+func newClientCert(t *testing.T, dir string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "cadvisor"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, dir, "cert.pem", "CERTIFICATE", der)
+	writePEM(t, dir, "key.pem", "EC PRIVATE KEY", keyDer)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// newMutualTLSServer returns an InfluxDB accepting the writes of clients
+// presenting the certificate in dir, and the path of its CA file.
+func newMutualTLSServer(t *testing.T, influx http.Handler, dir string) (*httptest.Server, string) {
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(newClientCert(t, dir))
+	server := httptest.NewUnstartedServer(influx)
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  clientCAs,
+	}
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	return server, writePEM(t, dir, "ca.pem", "CERTIFICATE", server.TLS.Certificates[0].Certificate[0])
+}
+
+func newTLSTestStorage(t *testing.T, host, caFile, certFile, keyFile string) (*influxdbStorage, error) {
+	tlsConfig, err := generateTLSConfig(caFile, certFile, keyFile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver, err := newStorage("machineA", "stats", "cadvisor", "", "root", "root", host, true, tlsConfig, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return driver, driver.checkTLS(host)
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cadvisor-influxdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	influx := &fakeInfluxDBWrites{}
+	server, caFile := newMutualTLSServer(t, influx, dir)
+	defer server.Close()
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	driver, err := newTLSTestStorage(t, u.Host, caFile, filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"))
+	if err != nil {
+		t.Fatalf("expected the client certificate to be accepted, got %v", err)
+	}
+	driver.OverrideReadyToFlush(func() bool { return true })
+	if err := driver.AddStats(info.ContainerReference{Name: "/"}, &info.ContainerStats{Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	// The ping on startup is recorded as an empty write.
+	if writes := influx.pointsPerWrite(); len(writes) != 2 || writes[1] != 10 {
+		t.Errorf("expected the 10 points to be written, got %v", writes)
+	}
+
+	// The handshake fails on startup without the client certificate.
+	if _, err := newTLSTestStorage(t, u.Host, caFile, "", ""); err == nil || !strings.Contains(err.Error(), "TLS connection to InfluxDB") {
+		t.Errorf("expected the TLS connection to fail without the client certificate, got %v", err)
+	}
+}
+
+func TestCheckTLSIgnoresUnreachableInfluxDB(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	host := server.Listener.Addr().String()
+	server.Close()
+	if _, err := newTLSTestStorage(t, host, "", "", ""); err != nil {
+		t.Errorf("expected an unreachable InfluxDB not to be an error on startup, got %v", err)
+	}
+}
+
+func TestGenerateTLSConfig(t *testing.T) {
+	if tlsConfig, err := generateTLSConfig("", "", "", false); tlsConfig != nil || err != nil {
+		t.Errorf("expected the default TLS configuration, got %v (%v)", tlsConfig, err)
+	}
+	if tlsConfig, err := generateTLSConfig("", "", "", true); err != nil || !tlsConfig.InsecureSkipVerify {
+		t.Errorf("expected the server certificate not to be verified, got %v (%v)", tlsConfig, err)
+	}
+	if _, err := generateTLSConfig("/nonexistent/ca.pem", "", "", false); err == nil {
+		t.Error("expected a missing CA file to be an error")
+	}
+}
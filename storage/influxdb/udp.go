@@ -0,0 +1,128 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"fmt"
+	"net"
+	"sync/atomic"
+	"time"
+
+	influxdb "github.com/influxdb/influxdb/client"
+)
+
+// Scheme of -storage_driver_host selecting the UDP listener of InfluxDB.
+const udpScheme = "udp://"
+
+// Default maximum size of the datagrams, recommended by the InfluxDB
+// documentation.
+const defaultUDPPayloadSize = 512
+
+// udpWriter sends points in line protocol to the UDP listener of InfluxDB.
+// Writes never wait for InfluxDB, and failed ones are not retried.
+type udpWriter struct {
+	conn        net.Conn
+	payloadSize int
+	// Number of datagrams which could not be sent and of points too large
+	// for a datagram.
+	errors uint64
+}
+
+func newUDPWriter(address string, payloadSize int) (*udpWriter, error) {
+	if payloadSize <= 0 {
+		return nil, fmt.Errorf("invalid InfluxDB UDP payload size %d", payloadSize)
+	}
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &udpWriter{
+		conn:        conn,
+		payloadSize: payloadSize,
+	}, nil
+}
+
+// write sends the points in as few datagrams as possible, each one holding
+// whole lines and at most payloadSize bytes.
+func (self *udpWriter) write(points []*influxdb.Point) error {
+	var datagram []byte
+	failed := 0
+	var lastErr error
+	send := func() {
+		if len(datagram) == 0 {
+			return
+		}
+		if _, err := self.conn.Write(datagram); err != nil {
+			atomic.AddUint64(&self.errors, 1)
+			failed++
+			lastErr = err
+		}
+		datagram = datagram[:0]
+	}
+	for _, p := range points {
+		line := p.MarshalString() + "\n"
+		if len(line) > self.payloadSize {
+			atomic.AddUint64(&self.errors, 1)
+			failed++
+			lastErr = fmt.Errorf("point %q is larger than the payload size %d", p.Measurement, self.payloadSize)
+			continue
+		}
+		if len(datagram)+len(line) > self.payloadSize {
+			send()
+		}
+		datagram = append(datagram, line...)
+	}
+	send()
+	if failed > 0 {
+		return fmt.Errorf("%d points or datagrams could not be sent over UDP (%d in total) - %s", failed, atomic.LoadUint64(&self.errors), lastErr)
+	}
+	return nil
+}
+
+// UDPErrors returns the number of datagrams which could not be sent to the
+// UDP listener of InfluxDB and of points too large to be sent.
+func (self *influxdbStorage) UDPErrors() uint64 {
+	if self.udp == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&self.udp.errors)
+}
+
+func (self *udpWriter) close() error {
+	return self.conn.Close()
+}
+
+// newUDPStorage returns a driver sending points to the UDP listener of
+// InfluxDB at address, a host:port.
+func newUDPStorage(
+	machineName,
+	address string,
+	payloadSize int,
+	bufferDuration time.Duration,
+) (*influxdbStorage, error) {
+	writer, err := newUDPWriter(address, payloadSize)
+	if err != nil {
+		return nil, err
+	}
+	ret := &influxdbStorage{
+		udp:            writer,
+		machineName:    machineName,
+		bufferDuration: bufferDuration,
+		lastWrite:      time.Now(),
+		points:         make([]*influxdb.Point, 0),
+	}
+	ret.readyToFlush = ret.defaultReadyToFlush
+	return ret, nil
+}
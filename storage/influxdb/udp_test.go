@@ -0,0 +1,128 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// readDatagrams returns the datagrams received by conn until none arrives
+// for a while.
+func readDatagrams(t *testing.T, conn net.PacketConn) []string {
+	var ret []string
+	buf := make([]byte, 65536)
+	for {
+		conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return ret
+			}
+			t.Fatal(err)
+		}
+		ret = append(ret, string(buf[:n]))
+	}
+}
+
+func newUDPTestStorage(t *testing.T, payloadSize int) (*influxdbStorage, net.PacketConn) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver, err := newUDPStorage("machineA", conn.LocalAddr().String(), payloadSize, time.Minute)
+	if err != nil {
+		conn.Close()
+		t.Fatal(err)
+	}
+	driver.OverrideReadyToFlush(func() bool { return true })
+	return driver, conn
+}
+
+func TestUDPWrite(t *testing.T) {
+	driver, conn := newUDPTestStorage(t, 512)
+	defer conn.Close()
+	defer driver.Close()
+
+	stats := &info.ContainerStats{Timestamp: time.Unix(1463486400, 0)}
+	stats.Cpu.Usage.PerCpu = []uint64{1, 2, 3, 4, 5, 6, 7, 8}
+	stats.Memory.Usage = 1024
+	if err := driver.AddStats(info.ContainerReference{Name: "/docker/abcd", Aliases: []string{"web"}}, stats); err != nil {
+		t.Fatal(err)
+	}
+
+	datagrams := readDatagrams(t, conn)
+	if len(datagrams) < 2 {
+		t.Fatalf("expected the points to be split into several datagrams, got %d", len(datagrams))
+	}
+	var lines []string
+	for _, datagram := range datagrams {
+		if len(datagram) > 512 {
+			t.Errorf("expected datagrams of at most 512 bytes, got %d", len(datagram))
+		}
+		if !strings.HasSuffix(datagram, "\n") {
+			t.Errorf("expected datagrams to hold whole lines, got %q", datagram)
+		}
+		lines = append(lines, strings.Split(strings.TrimSuffix(datagram, "\n"), "\n")...)
+	}
+	// 10 points plus one per CPU.
+	if len(lines) != 18 {
+		t.Errorf("expected 18 points, got %d", len(lines))
+	}
+	expected := "memory_usage,container_name=web,machine=machineA value=1024i 1463486400000000000"
+	if !strings.Contains(strings.Join(lines, "\n"), expected) {
+		t.Errorf("expected the line %q, got %q", expected, lines)
+	}
+	if driver.UDPErrors() != 0 {
+		t.Errorf("expected no errors, got %d", driver.UDPErrors())
+	}
+}
+
+func TestUDPPointLargerThanPayload(t *testing.T) {
+	driver, conn := newUDPTestStorage(t, 64)
+	defer conn.Close()
+	defer driver.Close()
+
+	ref := info.ContainerReference{Name: "/" + strings.Repeat("a", 100)}
+	if err := driver.AddStats(ref, &info.ContainerStats{Timestamp: time.Now()}); err == nil {
+		t.Error("expected an error for points larger than the payload size")
+	}
+	if datagrams := readDatagrams(t, conn); len(datagrams) != 0 {
+		t.Errorf("expected no datagram, got %q", datagrams)
+	}
+	if driver.UDPErrors() != 10 {
+		t.Errorf("expected 10 errors, got %d", driver.UDPErrors())
+	}
+}
+
+func TestUDPErrorsAreNotRetried(t *testing.T) {
+	driver, conn := newUDPTestStorage(t, 512)
+	conn.Close()
+	driver.udp.close()
+
+	if err := driver.AddStats(info.ContainerReference{Name: "/"}, &info.ContainerStats{Timestamp: time.Now()}); err == nil {
+		t.Error("expected an error when the socket is closed")
+	}
+	if errors := driver.UDPErrors(); errors == 0 {
+		t.Error("expected the socket errors to be counted")
+	}
+	if len(driver.points) != 0 {
+		t.Errorf("expected the points not to be kept for a retry, got %d", len(driver.points))
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/cadvisor/version"
+
+	influxdb "github.com/influxdb/influxdb/client"
+)
+
+// Precision of the timestamps written to InfluxDB 2.x.
+const v2Precision = "s"
+
+// v2Writer writes points to the InfluxDB 2.x write API, which authenticates
+// with a token and writes to a bucket of an organization instead of a
+// database.
+type v2Writer struct {
+	url        url.URL
+	token      string
+	org        string
+	bucket     string
+	httpClient *http.Client
+	userAgent  string
+}
+
+func newV2Writer(influxdbHost string, isSecure bool, tlsConfig *tls.Config, token, org, bucket string) (*v2Writer, error) {
+	if token == "" {
+		return nil, fmt.Errorf("an InfluxDB token is required by the InfluxDB 2.x write API")
+	}
+	if org == "" || bucket == "" {
+		return nil, fmt.Errorf("an InfluxDB organization and bucket are required by the InfluxDB 2.x write API")
+	}
+	u := url.URL{
+		Scheme: "http",
+		Host:   influxdbHost,
+		Path:   "/api/v2/write",
+	}
+	if isSecure {
+		u.Scheme = "https"
+	}
+	httpClient := &http.Client{Timeout: influxdb.DefaultTimeout}
+	if tlsConfig != nil {
+		httpClient.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		}
+	}
+	return &v2Writer{
+		url:        u,
+		token:      token,
+		org:        org,
+		bucket:     bucket,
+		httpClient: httpClient,
+		userAgent:  fmt.Sprintf("%v/%v", "cAdvisor", version.Info["version"]),
+	}, nil
+}
+
+// ping checks that InfluxDB can be reached.
+func (self *v2Writer) ping() error {
+	u := self.url
+	u.Path = "/ping"
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", self.userAgent)
+	resp, err := self.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// write sends the points in line protocol, one per line.
+func (self *v2Writer) write(points []*influxdb.Point) error {
+	return self.writeLines(lineProtocol(points, v2Precision), v2Precision)
+}
+
+// writeLines sends points already in line protocol, with timestamps in the
+// given precision.
+func (self *v2Writer) writeLines(data []byte, precision string) error {
+	u := self.url
+	params := url.Values{}
+	params.Set("org", self.org)
+	params.Set("bucket", self.bucket)
+	params.Set("precision", precision)
+	u.RawQuery = params.Encode()
+	req, err := http.NewRequest("POST", u.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Token "+self.token)
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("User-Agent", self.userAgent)
+	resp, err := self.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	message := strings.TrimSpace(string(body))
+
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+		return fmt.Errorf("InfluxDB rejected the token, check -storage_driver_influxdb_token and that it is allowed to write to bucket %q - %s", self.bucket, message)
+	case http.StatusNotFound:
+		return fmt.Errorf("InfluxDB organization %q or bucket %q not found, check -storage_driver_influxdb_org and -storage_driver_influxdb_bucket - %s", self.org, self.bucket, message)
+	}
+	return fmt.Errorf("InfluxDB write failed with status %d - %s", resp.StatusCode, message)
+}
+
+// lineProtocol returns the points in line protocol, one per line, with
+// timestamps in the given precision.
+func lineProtocol(points []*influxdb.Point, precision string) []byte {
+	var b bytes.Buffer
+	for _, p := range points {
+		p.Precision = precision
+		b.WriteString(p.MarshalString())
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// newV2Storage returns a driver writing to the InfluxDB 2.x write API.
+func newV2Storage(
+	machineName,
+	influxdbHost string,
+	isSecure bool,
+	tlsConfig *tls.Config,
+	token,
+	org,
+	bucket string,
+	bufferDuration time.Duration,
+) (*influxdbStorage, error) {
+	writer, err := newV2Writer(influxdbHost, isSecure, tlsConfig, token, org, bucket)
+	if err != nil {
+		return nil, err
+	}
+	ret := &influxdbStorage{
+		v2:             writer,
+		machineName:    machineName,
+		bufferDuration: bufferDuration,
+		lastWrite:      time.Now(),
+		points:         make([]*influxdb.Point, 0),
+	}
+	ret.readyToFlush = ret.defaultReadyToFlush
+	return ret, nil
+}
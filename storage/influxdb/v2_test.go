@@ -0,0 +1,153 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package influxdb
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// fakeInfluxDBv2 records the write requests it receives and answers them with
+// status, 204 if it is 0.
+type fakeInfluxDBv2 struct {
+	lock     sync.Mutex
+	status   int
+	body     string
+	requests []*http.Request
+	bodies   []string
+}
+
+func (self *fakeInfluxDBv2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	self.lock.Lock()
+	self.requests = append(self.requests, r)
+	self.bodies = append(self.bodies, string(body))
+	self.lock.Unlock()
+	if self.status == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(self.status)
+	w.Write([]byte(self.body))
+}
+
+func newV2TestStorage(t *testing.T, influx *fakeInfluxDBv2) (*influxdbStorage, func()) {
+	server := httptest.NewServer(influx)
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver, err := newV2Storage("machineA", u.Host, false, nil, "s3cr3t", "my-org", "cadvisor", time.Minute)
+	if err != nil {
+		server.Close()
+		t.Fatal(err)
+	}
+	driver.OverrideReadyToFlush(func() bool { return true })
+	return driver, server.Close
+}
+
+func TestV2Write(t *testing.T) {
+	influx := &fakeInfluxDBv2{}
+	driver, closeServer := newV2TestStorage(t, influx)
+	defer closeServer()
+
+	ref := info.ContainerReference{Name: "/docker/abcd", Aliases: []string{"web"}}
+	stats := &info.ContainerStats{Timestamp: time.Unix(1463486400, 123456789)}
+	stats.Memory.Usage = 1024
+	if err := driver.AddStats(ref, stats); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(influx.requests) != 1 {
+		t.Fatalf("expected 1 write request, got %d", len(influx.requests))
+	}
+	req := influx.requests[0]
+	if req.Method != "POST" || req.URL.Path != "/api/v2/write" {
+		t.Errorf("expected a POST to /api/v2/write, got %s %s", req.Method, req.URL.Path)
+	}
+	query := req.URL.Query()
+	for param, expected := range map[string]string{"org": "my-org", "bucket": "cadvisor", "precision": "s"} {
+		if query.Get(param) != expected {
+			t.Errorf("expected the %s parameter to be %q, got %q", param, expected, query.Get(param))
+		}
+	}
+	if auth := req.Header.Get("Authorization"); auth != "Token s3cr3t" {
+		t.Errorf("expected token authentication, got %q", auth)
+	}
+	if contentType := req.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain") {
+		t.Errorf("expected a text/plain body, got %q", contentType)
+	}
+
+	body := influx.bodies[0]
+	if !strings.HasSuffix(body, "\n") {
+		t.Errorf("expected every line to be terminated, got %q", body)
+	}
+	lines := strings.Split(strings.TrimSuffix(body, "\n"), "\n")
+	if len(lines) != 10 {
+		t.Errorf("expected 10 points, got %d: %q", len(lines), body)
+	}
+	expected := "memory_usage,container_name=web,machine=machineA value=1024i 1463486400"
+	found := false
+	for _, line := range lines {
+		if line == expected {
+			found = true
+		}
+		if !strings.HasSuffix(line, " 1463486400") {
+			t.Errorf("expected the timestamp in seconds, got %q", line)
+		}
+	}
+	if !found {
+		t.Errorf("expected the line %q, got %q", expected, body)
+	}
+}
+
+func TestV2WriteErrors(t *testing.T) {
+	testCases := []struct {
+		status   int
+		body     string
+		expected string
+	}{
+		{http.StatusUnauthorized, `{"code":"unauthorized","message":"unauthorized access"}`, "-storage_driver_influxdb_token"},
+		{http.StatusNotFound, `{"code":"not found","message":"bucket \"cadvisor\" not found"}`, "-storage_driver_influxdb_bucket"},
+		{http.StatusBadRequest, `{"code":"invalid","message":"unable to parse"}`, "status 400"},
+	}
+	for _, testCase := range testCases {
+		influx := &fakeInfluxDBv2{status: testCase.status, body: testCase.body}
+		driver, closeServer := newV2TestStorage(t, influx)
+		err := driver.AddStats(info.ContainerReference{Name: "/"}, &info.ContainerStats{Timestamp: time.Now()})
+		closeServer()
+		if err == nil || !strings.Contains(err.Error(), testCase.expected) {
+			t.Errorf("expected an error mentioning %q for status %d, got %v", testCase.expected, testCase.status, err)
+		}
+	}
+}
+
+func TestV2StorageRequiresTokenOrgAndBucket(t *testing.T) {
+	if _, err := newV2Storage("machineA", "localhost:8086", false, nil, "", "my-org", "cadvisor", time.Minute); err == nil {
+		t.Error("expected an error without token")
+	}
+	if _, err := newV2Storage("machineA", "localhost:8086", false, nil, "s3cr3t", "", "cadvisor", time.Minute); err == nil {
+		t.Error("expected an error without organization")
+	}
+}
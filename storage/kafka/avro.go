@@ -0,0 +1,247 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// The Avro schema of the messages is derived from detailSpec: structs are
+// records whose fields are named after their JSON names, pointers are
+// unions with null, slices are arrays, maps are maps, integers are longs,
+// floats are doubles and times are timestamp-micros longs.
+
+// Namespace of the Avro records.
+const avroNamespace = "cadvisor"
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// avroField is a field of a struct encoded in its Avro record.
+type avroField struct {
+	name  string
+	index []int
+}
+
+// avroFields returns the fields of a struct encoded in its Avro record, in
+// order. The fields of embedded structs are promoted, as in JSON.
+func avroFields(t reflect.Type) []avroField {
+	var ret []avroField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for _, promoted := range avroFields(f.Type) {
+				promoted.index = append([]int{i}, promoted.index...)
+				ret = append(ret, promoted)
+			}
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		ret = append(ret, avroField{name, []int{i}})
+	}
+	return ret
+}
+
+// avroSchema returns the Avro schema of a type. The records already defined
+// are referred to by name.
+func avroSchema(t reflect.Type, defined map[string]bool) interface{} {
+	if t == timeType {
+		return map[string]interface{}{"type": "long", "logicalType": "timestamp-micros"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "long"
+	case reflect.Float32, reflect.Float64:
+		return "double"
+	case reflect.String:
+		return "string"
+	case reflect.Ptr:
+		return []interface{}{"null", avroSchema(t.Elem(), defined)}
+	case reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": avroSchema(t.Elem(), defined)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "map", "values": avroSchema(t.Elem(), defined)}
+	case reflect.Struct:
+		if defined[t.Name()] {
+			return avroNamespace + "." + t.Name()
+		}
+		defined[t.Name()] = true
+		var fields []interface{}
+		for _, f := range avroFields(t) {
+			fieldSchema := avroSchema(t.FieldByIndex(f.index).Type, defined)
+			field := map[string]interface{}{"name": f.name, "type": fieldSchema}
+			if _, ok := fieldSchema.([]interface{}); ok {
+				field["default"] = nil
+			}
+			fields = append(fields, field)
+		}
+		return map[string]interface{}{
+			"type":      "record",
+			"name":      t.Name(),
+			"namespace": avroNamespace,
+			"fields":    fields,
+		}
+	}
+	panic(fmt.Sprintf("no Avro schema for %s", t))
+}
+
+// detailAvroSchema returns the Avro schema of the messages.
+func detailAvroSchema() (string, error) {
+	b, err := json.Marshal(avroSchema(reflect.TypeOf(detailSpec{}), make(map[string]bool)))
+	return string(b), err
+}
+
+func appendAvroLong(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	// Varints are zig-zag encoded, as in Avro.
+	return append(b, buf[:binary.PutVarint(buf[:], v)]...)
+}
+
+func appendAvroString(b []byte, s string) []byte {
+	return append(appendAvroLong(b, int64(len(s))), s...)
+}
+
+// appendAvro appends the Avro binary encoding of v to b.
+func appendAvro(b []byte, v reflect.Value) []byte {
+	if v.Type() == timeType {
+		return appendAvroLong(b, v.Interface().(time.Time).UnixNano()/int64(time.Microsecond))
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 1)
+		}
+		return append(b, 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendAvroLong(b, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return appendAvroLong(b, int64(v.Uint()))
+	case reflect.Float32, reflect.Float64:
+		var buf [8]byte
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v.Float()))
+		return append(b, buf[:]...)
+	case reflect.String:
+		return appendAvroString(b, v.String())
+	case reflect.Ptr:
+		if v.IsNil() {
+			return appendAvroLong(b, 0)
+		}
+		return appendAvro(appendAvroLong(b, 1), v.Elem())
+	case reflect.Slice:
+		// A single block followed by the empty block ending the array.
+		if v.Len() > 0 {
+			b = appendAvroLong(b, int64(v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				b = appendAvro(b, v.Index(i))
+			}
+		}
+		return appendAvroLong(b, 0)
+	case reflect.Map:
+		if v.Len() > 0 {
+			b = appendAvroLong(b, int64(v.Len()))
+			for _, key := range v.MapKeys() {
+				b = appendAvroString(b, key.String())
+				b = appendAvro(b, v.MapIndex(key))
+			}
+		}
+		return appendAvroLong(b, 0)
+	case reflect.Struct:
+		for _, f := range avroFields(v.Type()) {
+			b = appendAvro(b, v.FieldByIndex(f.index))
+		}
+		return b
+	}
+	panic(fmt.Sprintf("no Avro encoding for %s", v.Type()))
+}
+
+// schemaRegistry is a client of the Confluent Schema Registry.
+type schemaRegistry struct {
+	url        string
+	user       string
+	password   string
+	httpClient *http.Client
+}
+
+// register registers a schema under a subject, or looks it up if it is
+// already registered, and returns its ID.
+func (self *schemaRegistry) register(subject, schema string) (int32, error) {
+	body, err := json.Marshal(map[string]string{"schema": schema})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest("POST", strings.TrimSuffix(self.url, "/")+"/subjects/"+url.PathEscape(subject)+"/versions", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	if self.user != "" {
+		req.SetBasicAuth(self.user, self.password)
+	}
+	resp, err := self.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("status %d - %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	var registered struct {
+		ID int32 `json:"id"`
+	}
+	if err := json.Unmarshal(respBody, &registered); err != nil {
+		return 0, fmt.Errorf("invalid response %q - %s", respBody, err)
+	}
+	return registered.ID, nil
+}
+
+// newAvroEncoder registers the Avro schema of the messages of a topic and
+// returns a function encoding them in the Confluent wire format: a zero
+// magic byte, the schema ID and the Avro binary encoding. The schema is
+// registered once, the registry is not needed afterwards.
+func newAvroEncoder(registry *schemaRegistry, topic string) (messageEncoderFunc, error) {
+	schema, err := detailAvroSchema()
+	if err != nil {
+		return nil, err
+	}
+	subject := topic + "-value"
+	id, err := registry.register(subject, schema)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register the Avro schema of subject %q with the schema registry at %s - %s", subject, registry.url, err)
+	}
+	return func(detail *detailSpec) ([]byte, error) {
+		b := make([]byte, 5, 1024)
+		binary.BigEndian.PutUint32(b[1:], uint32(id))
+		return appendAvro(b, reflect.ValueOf(detail).Elem()), nil
+	}, nil
+}
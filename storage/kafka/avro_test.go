@@ -0,0 +1,274 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// fakeSchemaRegistry registers the schemas with ID 42.
+type fakeSchemaRegistry struct {
+	lock     sync.Mutex
+	status   int
+	subjects []string
+	schema   string
+}
+
+func (self *fakeSchemaRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if user, password, ok := r.BasicAuth(); !ok || user != "cadvisor" || password != "secret" {
+		http.Error(w, `{"error_code":401,"message":"Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	if self.status != 0 {
+		http.Error(w, `{"error_code":50001,"message":"Error in the backend data store"}`, self.status)
+		return
+	}
+	var body struct {
+		Schema string `json:"schema"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+	self.subjects = append(self.subjects, r.URL.Path)
+	self.schema = body.Schema
+	w.Write([]byte(`{"id":42}`))
+}
+
+func newTestRegistry(url string) *schemaRegistry {
+	return &schemaRegistry{url: url, user: "cadvisor", password: "secret", httpClient: http.DefaultClient}
+}
+
+// readAvro decodes a value written with a schema, the way a generic Avro
+// reader does, records as maps.
+func readAvro(schema interface{}, named map[string]interface{}, r *bytes.Reader) (interface{}, error) {
+	readLong := func() (int64, error) { return binary.ReadVarint(r) }
+	readBlocks := func(item func() error) error {
+		for {
+			n, err := readLong()
+			if err != nil || n == 0 {
+				return err
+			}
+			for i := int64(0); i < n; i++ {
+				if err := item(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	switch s := schema.(type) {
+	case string:
+		switch s {
+		case "null":
+			return nil, nil
+		case "boolean":
+			b, err := r.ReadByte()
+			return b == 1, err
+		case "long":
+			return readLong()
+		case "double":
+			var buf [8]byte
+			_, err := io.ReadFull(r, buf[:])
+			return math.Float64frombits(binary.LittleEndian.Uint64(buf[:])), err
+		case "string":
+			n, err := readLong()
+			if err != nil {
+				return nil, err
+			}
+			buf := make([]byte, n)
+			_, err = io.ReadFull(r, buf)
+			return string(buf), err
+		}
+		if record, ok := named[s]; ok {
+			return readAvro(record, named, r)
+		}
+	case []interface{}:
+		branch, err := readLong()
+		if err != nil {
+			return nil, err
+		}
+		return readAvro(s[branch], named, r)
+	case map[string]interface{}:
+		switch s["type"] {
+		case "record":
+			named[s["namespace"].(string)+"."+s["name"].(string)] = s
+			ret := make(map[string]interface{})
+			for _, f := range s["fields"].([]interface{}) {
+				field := f.(map[string]interface{})
+				v, err := readAvro(field["type"], named, r)
+				if err != nil {
+					return nil, err
+				}
+				ret[field["name"].(string)] = v
+			}
+			return ret, nil
+		case "array":
+			var ret []interface{}
+			err := readBlocks(func() error {
+				v, err := readAvro(s["items"], named, r)
+				ret = append(ret, v)
+				return err
+			})
+			return ret, err
+		case "map":
+			ret := make(map[string]interface{})
+			err := readBlocks(func() error {
+				k, err := readAvro("string", named, r)
+				if err != nil {
+					return err
+				}
+				ret[k.(string)], err = readAvro(s["values"], named, r)
+				return err
+			})
+			return ret, err
+		default:
+			return readAvro(s["type"], named, r)
+		}
+	}
+	return nil, fmt.Errorf("unsupported schema %v", schema)
+}
+
+func avroTestDetail() *detailSpec {
+	stats := &info.ContainerStats{Timestamp: time.Unix(1463486400, 123456000)}
+	stats.Memory.Usage = 1 << 30
+	stats.Network.RxBytes = 100
+	stats.Network.Interfaces = []info.InterfaceStats{{Name: "eth0", RxBytes: 60}, {Name: "tun0", RxBytes: 40}}
+	stats.DiskIo.IoServiceBytes = []info.PerDiskStats{{Major: 8, Stats: map[string]uint64{"Read": 4096}}}
+	stats.CustomMetrics = map[string][]info.MetricVal{"requests": {{FloatValue: 0.5}}}
+	return &detailSpec{
+		Timestamp:       stats.Timestamp,
+		MachineName:     "machineA",
+		ContainerName:   "web",
+		ContainerLabels: map[string]string{"app": "web"},
+		ContainerStats:  stats,
+	}
+}
+
+// path returns the value at a path of nested maps and slices.
+func path(v interface{}, keys ...interface{}) interface{} {
+	for _, key := range keys {
+		switch k := key.(type) {
+		case string:
+			v = v.(map[string]interface{})[k]
+		case int:
+			v = v.([]interface{})[k]
+		}
+	}
+	return v
+}
+
+func TestAvroRoundTrip(t *testing.T) {
+	registry := &fakeSchemaRegistry{}
+	server := httptest.NewServer(registry)
+	encode, err := newAvroEncoder(newTestRegistry(server.URL), "stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The registry is not needed once the schema is registered.
+	server.Close()
+	var b []byte
+	for i := 0; i < 3; i++ {
+		if b, err = encode(avroTestDetail()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(registry.subjects, []string{"/subjects/stats-value/versions"}) {
+		t.Errorf("expected the schema to be registered once, got %v", registry.subjects)
+	}
+
+	if !bytes.Equal(b[:5], []byte{0, 0, 0, 0, 42}) {
+		t.Fatalf("expected the magic byte and the schema ID, got %v", b[:5])
+	}
+	var schema interface{}
+	if err := json.Unmarshal([]byte(registry.schema), &schema); err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(b[5:])
+	detail, err := readAvro(schema, make(map[string]interface{}), r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Len() != 0 {
+		t.Errorf("expected the message to be fully read, %d bytes left", r.Len())
+	}
+	for _, tc := range []struct {
+		path     []interface{}
+		expected interface{}
+	}{
+		{[]interface{}{"timestamp"}, int64(1463486400123456)},
+		{[]interface{}{"machine_name"}, "machineA"},
+		{[]interface{}{"container_Name"}, "web"},
+		{[]interface{}{"container_Id"}, ""},
+		{[]interface{}{"container_labels", "app"}, "web"},
+		{[]interface{}{"container_stats", "memory", "usage"}, int64(1 << 30)},
+		{[]interface{}{"container_stats", "network", "rx_bytes"}, int64(100)},
+		{[]interface{}{"container_stats", "network", "interfaces", 1, "name"}, "tun0"},
+		{[]interface{}{"container_stats", "network", "tcp", "Established"}, int64(0)},
+		{[]interface{}{"container_stats", "diskio", "io_service_bytes", 0, "stats", "Read"}, int64(4096)},
+		{[]interface{}{"container_stats", "custom_metrics", "requests", 0, "float_value"}, 0.5},
+	} {
+		if actual := path(detail, tc.path...); actual != tc.expected {
+			t.Errorf("expected %v at %v, got %v", tc.expected, tc.path, actual)
+		}
+	}
+}
+
+func TestAvroWithoutStats(t *testing.T) {
+	registry := &fakeSchemaRegistry{}
+	server := httptest.NewServer(registry)
+	defer server.Close()
+	encode, err := newAvroEncoder(newTestRegistry(server.URL), "stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := encode(&detailSpec{MachineName: "machineA"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema interface{}
+	json.Unmarshal([]byte(registry.schema), &schema)
+	detail, err := readAvro(schema, make(map[string]interface{}), bytes.NewReader(b[5:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := path(detail, "container_stats"); stats != nil {
+		t.Errorf("expected no stats, got %v", stats)
+	}
+}
+
+func TestAvroSchemaRegistrationFailure(t *testing.T) {
+	server := httptest.NewServer(&fakeSchemaRegistry{status: http.StatusInternalServerError})
+	defer server.Close()
+	if _, err := newAvroEncoder(newTestRegistry(server.URL), "stats"); err == nil {
+		t.Error("expected the registration failure to be an error")
+	}
+	registry := newTestRegistry(server.URL)
+	registry.password = "wrong"
+	if _, err := newAvroEncoder(registry, "stats"); err == nil {
+		t.Error("expected the authentication failure to be an error")
+	}
+}
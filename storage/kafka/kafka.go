@@ -15,16 +15,16 @@
 package kafka
 
 import (
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
 	"flag"
-	"io/ioutil"
+	"fmt"
+	"net/http"
 	"os"
 	"strings"
 	"time"
 
 	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/info/v2"
 	"github.com/google/cadvisor/storage"
 	"github.com/google/cadvisor/utils/container"
 
@@ -37,18 +37,79 @@ func init() {
 }
 
 var (
-	brokers   = flag.String("storage_driver_kafka_broker_list", "localhost:9092", "kafka broker(s) csv")
-	topic     = flag.String("storage_driver_kafka_topic", "stats", "kafka topic")
-	certFile  = flag.String("storage_driver_kafka_ssl_cert", "", "optional certificate file for TLS client authentication")
-	keyFile   = flag.String("storage_driver_kafka_ssl_key", "", "optional key file for TLS client authentication")
-	caFile    = flag.String("storage_driver_kafka_ssl_ca", "", "optional certificate authority file for TLS client authentication")
-	verifySSL = flag.Bool("storage_driver_kafka_ssl_verify", true, "verify ssl certificate chain")
+	brokers       = flag.String("storage_driver_kafka_broker_list", "localhost:9092", "kafka broker(s) csv")
+	topic         = flag.String("storage_driver_kafka_topic", "stats", "kafka topic, or a template where {label:<label name>} is replaced with the value of a container label, e.g. cadvisor.{label:team}")
+	fallbackTopic = flag.String("storage_driver_kafka_fallback_topic", "stats", "kafka topic of the containers without one of the labels of the topic template")
+	certFile      = flag.String("storage_driver_kafka_ssl_cert", "", "optional certificate file for TLS client authentication, reloaded when it changes")
+	keyFile       = flag.String("storage_driver_kafka_ssl_key", "", "optional key file for TLS client authentication, reloaded when it changes")
+	caFile        = flag.String("storage_driver_kafka_ssl_ca", "", "optional certificate authority file used to verify the broker certificates")
+	verifySSL     = flag.Bool("storage_driver_kafka_ssl_verify", true, "verify ssl certificate chain")
+	format        = flag.String("storage_driver_kafka_format", formatJSON, "format of the messages: json, proto, or avro registered with the schema registry of -storage_driver_kafka_schema_registry_url")
+	key           = flag.String("storage_driver_kafka_key", keyNone, "key of the messages, so that the messages of a container go to the same partition: container_name, machine_container_name or label:<label name>; empty for no key, spreading the messages across the partitions")
+
+	compression      = flag.String("storage_driver_kafka_compression", compressionNone, "compression codec of the messages: none, gzip or snappy")
+	maxInFlightBytes = flag.Int64("storage_driver_kafka_max_in_flight_bytes", 16*1024*1024, "maximum number of bytes of messages waiting to be delivered to Kafka, beyond which messages are dropped")
+	retryMax         = flag.Int("storage_driver_kafka_retry_max", 3, "number of times a message is retried before it is dropped")
+	retryBackoff     = flag.Duration("storage_driver_kafka_retry_backoff", 100*time.Millisecond, "time to wait between retries, e.g. for a leader election to complete")
+	closeTimeout     = flag.Duration("storage_driver_kafka_close_timeout", 10*time.Second, "time to wait on shutdown for the messages in flight to be delivered")
+
+	saslMechanism = flag.String("storage_driver_kafka_sasl_mechanism", "", "SASL mechanism used to authenticate with the Kafka brokers: PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512; empty to connect without authentication")
+	saslUser      = flag.String("storage_driver_kafka_sasl_user", "", "user name for the Kafka SASL authentication")
+	saslPassword  = flag.String("storage_driver_kafka_sasl_password", "", "password for the Kafka SASL authentication")
+
+	schemaRegistryURL      = flag.String("storage_driver_kafka_schema_registry_url", "", "URL of the Confluent Schema Registry the Avro schema of the messages is registered with on startup")
+	schemaRegistryUser     = flag.String("storage_driver_kafka_schema_registry_user", "", "user name for the schema registry basic authentication")
+	schemaRegistryPassword = flag.String("storage_driver_kafka_schema_registry_password", "", "password for the schema registry basic authentication")
 )
 
+// Message formats.
+const (
+	formatJSON  = "json"
+	formatAvro  = "avro"
+	formatProto = "proto"
+)
+
+// messageEncoderFunc returns the value of the message of a container.
+type messageEncoderFunc func(detail *detailSpec) ([]byte, error)
+
+func encodeJSON(detail *detailSpec) ([]byte, error) {
+	return json.Marshal(detail)
+}
+
+// newMessageEncoder returns the function encoding the messages of a topic
+// in a format.
+func newMessageEncoder(format, topic string) (messageEncoderFunc, error) {
+	switch format {
+	case formatJSON:
+		return encodeJSON, nil
+	case formatAvro:
+		if strings.Contains(topic, "{") {
+			return nil, fmt.Errorf("the Kafka Avro format is registered for a single topic, it does not support topic templates")
+		}
+		if *schemaRegistryURL == "" {
+			return nil, fmt.Errorf("a schema registry URL is required by the Kafka Avro format")
+		}
+		return newAvroEncoder(&schemaRegistry{
+			url:        *schemaRegistryURL,
+			user:       *schemaRegistryUser,
+			password:   *schemaRegistryPassword,
+			httpClient: &http.Client{Timeout: 10 * time.Second},
+		}, topic)
+	case formatProto:
+		return encodeProto, nil
+	}
+	return nil, fmt.Errorf("unknown Kafka message format %q, must be json, proto or avro", format)
+}
+
 type kafkaStorage struct {
-	producer    kafka.AsyncProducer
-	topic       string
+	producer    *producer
+	topic       topicFunc
 	machineName string
+	messageKey  messageKeyFunc
+	encode      messageEncoderFunc
+	// Specification of the containers, only looked up by the formats
+	// writing it.
+	specs *storage.ContainerSpecCache
 }
 
 type detailSpec struct {
@@ -58,6 +119,9 @@ type detailSpec struct {
 	ContainerID     string               `json:"container_Id,omitempty"`
 	ContainerLabels map[string]string    `json:"container_labels,omitempty"`
 	ContainerStats  *info.ContainerStats `json:"container_stats,omitempty"`
+	// Only written in the protobuf format.
+	ref  info.ContainerReference
+	spec *v2.ContainerSpec
 }
 
 func (driver *kafkaStorage) infoToDetailSpec(ref info.ContainerReference, stats *info.ContainerStats) *detailSpec {
@@ -73,24 +137,50 @@ func (driver *kafkaStorage) infoToDetailSpec(ref info.ContainerReference, stats
 		ContainerID:     containerID,
 		ContainerLabels: containerLabels,
 		ContainerStats:  stats,
+		ref:             ref,
+	}
+	if driver.specs != nil {
+		detail.spec = driver.specs.Spec(ref.Name, timestamp)
 	}
 	return detail
 }
 
 func (driver *kafkaStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
 	detail := driver.infoToDetailSpec(ref, stats)
-	b, err := json.Marshal(detail)
-
-	driver.producer.Input() <- &kafka.ProducerMessage{
-		Topic: driver.topic,
-		Value: kafka.StringEncoder(b),
+	b, err := driver.encode(detail)
+	if err != nil {
+		return err
 	}
 
-	return err
+	return driver.producer.send(&kafka.ProducerMessage{
+		Topic: driver.topic(ref),
+		Key:   driver.messageKey(driver.machineName, ref),
+		Value: kafka.ByteEncoder(b),
+	})
+}
+
+// AddStatsBatch queues the messages of the stats of several containers. The
+// asynchronous producer already batches the messages sent to the brokers,
+// so the messages are queued one at a time, all of them even if some fail.
+func (driver *kafkaStorage) AddStatsBatch(batch []storage.ContainerStatsPair) error {
+	var firstErr error
+	failed := 0
+	for _, pair := range batch {
+		if err := driver.AddStats(pair.Ref, pair.Stats); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+		}
+	}
+	if failed > 1 {
+		return fmt.Errorf("%d of %d Kafka messages failed to be queued, first error: %v", failed, len(batch), firstErr)
+	}
+	return firstErr
 }
 
 func (self *kafkaStorage) Close() error {
-	return self.producer.Close()
+	return self.producer.close(*closeTimeout)
 }
 
 func new() (storage.StorageDriver, error) {
@@ -101,34 +191,23 @@ func new() (storage.StorageDriver, error) {
 	return newStorage(machineName)
 }
 
-func generateTLSConfig() (*tls.Config, error) {
-	if *certFile != "" && *keyFile != "" && *caFile != "" {
-		cert, err := tls.LoadX509KeyPair(*certFile, *keyFile)
-		if err != nil {
-			return nil, err
-		}
-
-		caCert, err := ioutil.ReadFile(*caFile)
-		if err != nil {
-			return nil, err
-		}
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(caCert)
-
-		return &tls.Config{
-			Certificates:       []tls.Certificate{cert},
-			RootCAs:            caCertPool,
-			InsecureSkipVerify: *verifySSL,
-		}, nil
-	}
-
-	return nil, nil
-}
-
 func newStorage(machineName string) (storage.StorageDriver, error) {
 	config := kafka.NewConfig()
 
-	tlsConfig, err := generateTLSConfig()
+	messageKey, err := newMessageKeyFunc(*key)
+	if err != nil {
+		return nil, err
+	}
+	topicOf, err := newTopicFunc(*topic, *fallbackTopic)
+	if err != nil {
+		return nil, err
+	}
+	encode, err := newMessageEncoder(*format, *topic)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := generateTLSConfig(*caFile, *certFile, *keyFile, *verifySSL)
 	if err != nil {
 		return nil, err
 	}
@@ -138,19 +217,42 @@ func newStorage(machineName string) (storage.StorageDriver, error) {
 		config.Net.TLS.Config = tlsConfig
 	}
 
+	if err := configureSASL(config, *saslMechanism, *saslUser, *saslPassword); err != nil {
+		return nil, err
+	}
+
 	config.Producer.RequiredAcks = kafka.WaitForAll
+	if err := configureProducer(config, *compression, *retryMax, *retryBackoff); err != nil {
+		return nil, err
+	}
 
 	brokerList := strings.Split(*brokers, ",")
-	glog.V(4).Infof("Kafka brokers:%q", brokers)
+	glog.V(4).Infof("Kafka brokers:%q", *brokers)
 
-	producer, err := kafka.NewAsyncProducer(brokerList, config)
+	if config.Net.SASL.Enable {
+		if err := checkSASL(brokerList, config); err != nil {
+			return nil, err
+		}
+	}
+
+	async, err := kafka.NewAsyncProducer(brokerList, config)
+	if err != nil {
+		return nil, err
+	}
+	producer, err := newProducer(async, *maxInFlightBytes)
 	if err != nil {
+		async.Close()
 		return nil, err
 	}
 	ret := &kafkaStorage{
 		producer:    producer,
-		topic:       *topic,
+		topic:       topicOf,
 		machineName: machineName,
+		messageKey:  messageKey,
+		encode:      encode,
+	}
+	if *format == formatProto {
+		ret.specs = &storage.ContainerSpecCache{}
 	}
 	return ret, nil
 }
@@ -0,0 +1,73 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"fmt"
+	"strings"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/utils/container"
+
+	kafka "github.com/Shopify/sarama"
+)
+
+// Message key strategies. The messages of a container all go to the same
+// partition when they have a key, so that they are consumed in order.
+const (
+	// No key, the messages are spread across the partitions.
+	keyNone = ""
+	// The container name.
+	keyContainerName = "container_name"
+	// The machine name and the container name, separated by a slash.
+	keyMachineContainerName = "machine_container_name"
+	// The value of a container label, e.g. label:io.kubernetes.pod.uid.
+	keyLabelPrefix = "label:"
+)
+
+// messageKeyFunc returns the key of the messages of a container, nil for
+// none.
+type messageKeyFunc func(machineName string, ref info.ContainerReference) kafka.Encoder
+
+func noMessageKey(machineName string, ref info.ContainerReference) kafka.Encoder {
+	return nil
+}
+
+// newMessageKeyFunc returns the function computing the message keys with a
+// strategy.
+func newMessageKeyFunc(strategy string) (messageKeyFunc, error) {
+	switch {
+	case strategy == keyNone:
+		return noMessageKey, nil
+	case strategy == keyContainerName:
+		return func(machineName string, ref info.ContainerReference) kafka.Encoder {
+			return kafka.StringEncoder(container.GetPreferredName(ref))
+		}, nil
+	case strategy == keyMachineContainerName:
+		return func(machineName string, ref info.ContainerReference) kafka.Encoder {
+			return kafka.StringEncoder(machineName + "/" + container.GetPreferredName(ref))
+		}, nil
+	case strings.HasPrefix(strategy, keyLabelPrefix) && len(strategy) > len(keyLabelPrefix):
+		label := strings.TrimPrefix(strategy, keyLabelPrefix)
+		return func(machineName string, ref info.ContainerReference) kafka.Encoder {
+			// Containers without the label have no key.
+			if value, ok := ref.Labels[label]; ok {
+				return kafka.StringEncoder(value)
+			}
+			return nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown Kafka message key %q, must be empty, %s, %s or %s<label name>", strategy, keyContainerName, keyMachineContainerName, keyLabelPrefix)
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+var keyedRef = info.ContainerReference{
+	Name:    "/docker/abcd",
+	Aliases: []string{"web", "abcd"},
+	Labels:  map[string]string{"io.kubernetes.pod.uid": "1234-5678"},
+}
+
+// keyBytes returns the key of the message of keyedRef with a strategy, nil
+// for none.
+func keyBytes(t *testing.T, strategy string) []byte {
+	messageKey, err := newMessageKeyFunc(strategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	producer := newFakeProducer()
+	driver := &kafkaStorage{
+		producer:    newTestProducer(producer),
+		topic:       staticTopic("stats"),
+		machineName: "machineA",
+		messageKey:  messageKey,
+		encode:      encodeJSON,
+	}
+	if err := driver.AddStats(keyedRef, &info.ContainerStats{Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	message := <-producer.input
+	if message.Key == nil {
+		return nil
+	}
+	b, err := message.Key.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestMessageKeys(t *testing.T) {
+	for strategy, expected := range map[string]string{
+		"container_name":              "web",
+		"machine_container_name":      "machineA/web",
+		"label:io.kubernetes.pod.uid": "1234-5678",
+	} {
+		if actual := keyBytes(t, strategy); string(actual) != expected {
+			t.Errorf("expected the key %q with %q, got %q", expected, strategy, actual)
+		}
+	}
+}
+
+func TestNoMessageKey(t *testing.T) {
+	for _, strategy := range []string{"", "label:missing"} {
+		if actual := keyBytes(t, strategy); actual != nil {
+			t.Errorf("expected no key with %q, got %q", strategy, actual)
+		}
+	}
+}
+
+func TestUnknownMessageKey(t *testing.T) {
+	for _, strategy := range []string{"container_id", "label:"} {
+		if _, err := newMessageKeyFunc(strategy); err == nil {
+			t.Errorf("expected %q to be an error", strategy)
+		}
+	}
+}
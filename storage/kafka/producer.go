@@ -0,0 +1,150 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	kafka "github.com/Shopify/sarama"
+	"github.com/golang/glog"
+)
+
+// Compression codecs of the messages.
+const (
+	compressionNone   = "none"
+	compressionGZIP   = "gzip"
+	compressionSnappy = "snappy"
+)
+
+// configureProducer sets the compression codec and the retry policy of the
+// producer, and has it return the outcome of every message so that the
+// bytes in flight and the delivery errors are accounted for.
+func configureProducer(config *kafka.Config, compression string, retries int, backoff time.Duration) error {
+	switch strings.ToLower(compression) {
+	case compressionNone, "":
+		config.Producer.Compression = kafka.CompressionNone
+	case compressionGZIP:
+		config.Producer.Compression = kafka.CompressionGZIP
+	case compressionSnappy:
+		config.Producer.Compression = kafka.CompressionSnappy
+	case "lz4", "zstd":
+		return fmt.Errorf("Kafka compression codec %q is not supported by the Kafka client, use gzip or snappy", compression)
+	default:
+		return fmt.Errorf("unknown Kafka compression codec %q, must be none, gzip or snappy", compression)
+	}
+	if retries < 0 {
+		return fmt.Errorf("invalid number of Kafka retries %d", retries)
+	}
+	config.Producer.Retry.Max = retries
+	config.Producer.Retry.Backoff = backoff
+	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
+	return nil
+}
+
+// producer sends messages through an asynchronous producer, which batches
+// them and retries them in the background so that sending never waits for
+// the brokers. Messages are dropped instead of queued once maxInFlightBytes
+// are waiting to be delivered, e.g. during a leader election.
+type producer struct {
+	async            kafka.AsyncProducer
+	maxInFlightBytes int64
+	inFlightBytes    int64
+	// Number of messages which could not be delivered, and which were
+	// dropped because too many bytes were in flight.
+	failed  uint64
+	dropped uint64
+	// Done once the outcome of every message is known, after the producer
+	// is closed.
+	drained sync.WaitGroup
+}
+
+func newProducer(async kafka.AsyncProducer, maxInFlightBytes int64) (*producer, error) {
+	if maxInFlightBytes <= 0 {
+		return nil, fmt.Errorf("invalid Kafka maximum in flight bytes %d", maxInFlightBytes)
+	}
+	ret := &producer{
+		async:            async,
+		maxInFlightBytes: maxInFlightBytes,
+	}
+	ret.drained.Add(2)
+	go ret.drainSuccesses()
+	go ret.drainErrors()
+	return ret, nil
+}
+
+// send queues a message to be delivered, or drops it if too many bytes are
+// already in flight.
+func (self *producer) send(message *kafka.ProducerMessage) error {
+	size := int64(message.Value.Length())
+	if message.Key != nil {
+		size += int64(message.Key.Length())
+	}
+	if atomic.AddInt64(&self.inFlightBytes, size) > self.maxInFlightBytes {
+		atomic.AddInt64(&self.inFlightBytes, -size)
+		return fmt.Errorf("%d bytes are waiting to be delivered to Kafka, dropped the message (%d dropped in total)", atomic.LoadInt64(&self.inFlightBytes), atomic.AddUint64(&self.dropped, 1))
+	}
+	message.Metadata = size
+	self.async.Input() <- message
+	return nil
+}
+
+func (self *producer) drainSuccesses() {
+	defer self.drained.Done()
+	for message := range self.async.Successes() {
+		atomic.AddInt64(&self.inFlightBytes, -message.Metadata.(int64))
+	}
+}
+
+func (self *producer) drainErrors() {
+	defer self.drained.Done()
+	for err := range self.async.Errors() {
+		atomic.AddInt64(&self.inFlightBytes, -err.Msg.Metadata.(int64))
+		failed := atomic.AddUint64(&self.failed, 1)
+		glog.Errorf("failed to deliver a message to Kafka topic %q (%d failed in total) - %s", err.Msg.Topic, failed, err.Err)
+	}
+}
+
+// Failed returns the number of messages which could not be delivered after
+// their retries.
+func (self *producer) Failed() uint64 {
+	return atomic.LoadUint64(&self.failed)
+}
+
+// Dropped returns the number of messages dropped because too many bytes
+// were in flight.
+func (self *producer) Dropped() uint64 {
+	return atomic.LoadUint64(&self.dropped)
+}
+
+// close waits up to timeout for the messages in flight to be delivered.
+func (self *producer) close(timeout time.Duration) error {
+	self.async.AsyncClose()
+	done := make(chan struct{})
+	go func() {
+		self.drained.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("timed out after %s waiting for the messages to be delivered to Kafka, %d bytes were not", timeout, atomic.LoadInt64(&self.inFlightBytes))
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kafka "github.com/Shopify/sarama"
+)
+
+// fakeProducer buffers the messages produced, whose outcome the tests
+// return on the successes and errors channels. Closing it takes closeDelay
+// to flush the messages.
+type fakeProducer struct {
+	input      chan *kafka.ProducerMessage
+	successes  chan *kafka.ProducerMessage
+	errors     chan *kafka.ProducerError
+	closeDelay time.Duration
+}
+
+func newFakeProducer() *fakeProducer {
+	return &fakeProducer{
+		input:     make(chan *kafka.ProducerMessage, 10),
+		successes: make(chan *kafka.ProducerMessage, 10),
+		errors:    make(chan *kafka.ProducerError, 10),
+	}
+}
+
+func (self *fakeProducer) AsyncClose() {
+	go func() {
+		time.Sleep(self.closeDelay)
+		close(self.successes)
+		close(self.errors)
+	}()
+}
+
+func (self *fakeProducer) Close() error {
+	self.AsyncClose()
+	return nil
+}
+
+func (self *fakeProducer) Input() chan<- *kafka.ProducerMessage     { return self.input }
+func (self *fakeProducer) Successes() <-chan *kafka.ProducerMessage { return self.successes }
+func (self *fakeProducer) Errors() <-chan *kafka.ProducerError      { return self.errors }
+
+func newTestProducer(async *fakeProducer) *producer {
+	ret, err := newProducer(async, 1<<20)
+	if err != nil {
+		panic(err)
+	}
+	return ret
+}
+
+// waitForInFlightBytes waits for the bytes in flight to be expected.
+func waitForInFlightBytes(t *testing.T, p *producer, expected int64) {
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt64(&p.inFlightBytes) != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d bytes in flight, got %d", expected, atomic.LoadInt64(&p.inFlightBytes))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func testMessage(value string) *kafka.ProducerMessage {
+	return &kafka.ProducerMessage{Topic: "stats", Key: kafka.StringEncoder("key"), Value: kafka.StringEncoder(value)}
+}
+
+func TestConfigureProducer(t *testing.T) {
+	for codec, expected := range map[string]kafka.CompressionCodec{
+		"":       kafka.CompressionNone,
+		"none":   kafka.CompressionNone,
+		"gzip":   kafka.CompressionGZIP,
+		"snappy": kafka.CompressionSnappy,
+		"Snappy": kafka.CompressionSnappy,
+	} {
+		config := kafka.NewConfig()
+		if err := configureProducer(config, codec, 5, time.Second); err != nil {
+			t.Errorf("unexpected error for codec %q: %s", codec, err)
+			continue
+		}
+		if config.Producer.Compression != expected {
+			t.Errorf("expected codec %q to be %d, got %d", codec, expected, config.Producer.Compression)
+		}
+		if config.Producer.Retry.Max != 5 || config.Producer.Retry.Backoff != time.Second {
+			t.Errorf("expected 5 retries every second, got %d every %s", config.Producer.Retry.Max, config.Producer.Retry.Backoff)
+		}
+		if !config.Producer.Return.Successes || !config.Producer.Return.Errors {
+			t.Errorf("expected the successes and errors to be returned")
+		}
+		if err := config.Validate(); err != nil {
+			t.Errorf("invalid config for codec %q: %s", codec, err)
+		}
+	}
+	for _, codec := range []string{"lz4", "zstd", "brotli"} {
+		if err := configureProducer(kafka.NewConfig(), codec, 3, time.Second); err == nil {
+			t.Errorf("expected an error for codec %q", codec)
+		}
+	}
+	if err := configureProducer(kafka.NewConfig(), "none", -1, time.Second); err == nil {
+		t.Errorf("expected an error for a negative number of retries")
+	}
+}
+
+func TestProducerSuccess(t *testing.T) {
+	async := newFakeProducer()
+	p := newTestProducer(async)
+	if err := p.send(testMessage("value")); err != nil {
+		t.Fatal(err)
+	}
+	waitForInFlightBytes(t, p, 8)
+	async.successes <- <-async.input
+	waitForInFlightBytes(t, p, 0)
+	if err := p.close(time.Second); err != nil {
+		t.Error(err)
+	}
+	if p.Failed() != 0 || p.Dropped() != 0 {
+		t.Errorf("expected no failed nor dropped messages, got %d and %d", p.Failed(), p.Dropped())
+	}
+}
+
+func TestProducerDeliveryErrors(t *testing.T) {
+	async := newFakeProducer()
+	p := newTestProducer(async)
+	for i := 0; i < 3; i++ {
+		if err := p.send(testMessage("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The producer retried the first two messages in vain, and delivered
+	// the last one.
+	for i := 0; i < 2; i++ {
+		async.errors <- &kafka.ProducerError{Msg: <-async.input, Err: kafka.ErrNotLeaderForPartition}
+	}
+	async.successes <- <-async.input
+	waitForInFlightBytes(t, p, 0)
+	if err := p.close(time.Second); err != nil {
+		t.Error(err)
+	}
+	if p.Failed() != 2 {
+		t.Errorf("expected 2 failed messages, got %d", p.Failed())
+	}
+}
+
+func TestProducerOverflow(t *testing.T) {
+	async := newFakeProducer()
+	p, err := newProducer(async, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.send(testMessage("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.send(testMessage("0123456789")); err == nil {
+		t.Errorf("expected the message beyond the in flight bytes to be dropped")
+	}
+	if p.Dropped() != 1 {
+		t.Errorf("expected 1 dropped message, got %d", p.Dropped())
+	}
+	// Messages are sent again once the first one is delivered.
+	async.successes <- <-async.input
+	waitForInFlightBytes(t, p, 0)
+	if err := p.send(testMessage("0123456789")); err != nil {
+		t.Error(err)
+	}
+	if _, err := newProducer(newFakeProducer(), 0); err == nil {
+		t.Errorf("expected an error for no in flight bytes")
+	}
+}
+
+func TestProducerCloseTimeout(t *testing.T) {
+	async := newFakeProducer()
+	async.closeDelay = time.Second
+	p := newTestProducer(async)
+	if err := p.send(testMessage("value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.close(10 * time.Millisecond); err == nil {
+		t.Errorf("expected closing to time out while messages are in flight")
+	}
+
+	async = newFakeProducer()
+	async.closeDelay = 10 * time.Millisecond
+	p = newTestProducer(async)
+	if err := p.send(testMessage("value")); err != nil {
+		t.Fatal(err)
+	}
+	async.errors <- &kafka.ProducerError{Msg: <-async.input, Err: errors.New("broker down")}
+	if err := p.close(time.Second); err != nil {
+		t.Error(err)
+	}
+	if p.Failed() != 1 {
+		t.Errorf("expected the message flushed on close to be accounted for, got %d failed", p.Failed())
+	}
+}
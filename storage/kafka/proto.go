@@ -0,0 +1,254 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+	"github.com/google/cadvisor/storage/kafka/statspb"
+
+	"github.com/golang/protobuf/proto"
+)
+
+//go:generate protoc --proto_path=statspb --go_out=statspb statspb/stats.proto
+
+// Version of statspb/stats.proto the messages are written with, to be
+// incremented whenever fields are added to it.
+const protoSchemaVersion = 1
+
+// SetContainerSpecSource lets the driver look up the specification of the
+// containers, written along with their stats in the protobuf format.
+func (driver *kafkaStorage) SetContainerSpecSource(source storage.ContainerSpecSource) {
+	if driver.specs == nil {
+		return
+	}
+	driver.specs.SetSource(source)
+}
+
+// encodeProto returns the message of a container in the binary protobuf
+// format of statspb.ContainerStatsMessage.
+func encodeProto(detail *detailSpec) ([]byte, error) {
+	return proto.Marshal(protoMessage(detail))
+}
+
+func protoMessage(detail *detailSpec) *statspb.ContainerStatsMessage {
+	ref := detail.ref
+	ret := &statspb.ContainerStatsMessage{
+		SchemaVersion: protoSchemaVersion,
+		Timestamp:     detail.Timestamp.UnixNano(),
+		MachineName:   detail.MachineName,
+		Container: &statspb.ContainerReference{
+			Name:      ref.Name,
+			Aliases:   ref.Aliases,
+			Namespace: ref.Namespace,
+			Id:        ref.Id,
+			Labels:    ref.Labels,
+		},
+	}
+	if spec := detail.spec; spec != nil {
+		ret.Spec = &statspb.ContainerSpec{
+			CreationTime: unixNano(spec.CreationTime),
+			Image:        spec.Image,
+			Labels:       spec.Labels,
+			Envs:         spec.Envs,
+			HasCpu:       spec.HasCpu,
+			Cpu: &statspb.CpuSpec{
+				Limit:    spec.Cpu.Limit,
+				MaxLimit: spec.Cpu.MaxLimit,
+				Mask:     spec.Cpu.Mask,
+				Quota:    spec.Cpu.Quota,
+				Period:   spec.Cpu.Period,
+			},
+			HasMemory: spec.HasMemory,
+			Memory: &statspb.MemorySpec{
+				Limit:       spec.Memory.Limit,
+				Reservation: spec.Memory.Reservation,
+				SwapLimit:   spec.Memory.SwapLimit,
+			},
+			HasNetwork:    spec.HasNetwork,
+			HasFilesystem: spec.HasFilesystem,
+			HasDiskio:     spec.HasDiskIo,
+		}
+	}
+	if stats := detail.ContainerStats; stats != nil {
+		ret.Stats = protoStats(stats)
+	}
+	return ret
+}
+
+// unixNano returns t in nanoseconds since the epoch, 0 for the zero time.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func protoStats(stats *info.ContainerStats) *statspb.ContainerStats {
+	ret := &statspb.ContainerStats{
+		Timestamp: unixNano(stats.Timestamp),
+		Cpu: &statspb.CpuStats{
+			Usage: &statspb.CpuUsage{
+				Total:       stats.Cpu.Usage.Total,
+				PerCpuUsage: stats.Cpu.Usage.PerCpu,
+				User:        stats.Cpu.Usage.User,
+				System:      stats.Cpu.Usage.System,
+			},
+			Cfs: &statspb.CpuCFS{
+				Periods:          stats.Cpu.CFS.Periods,
+				ThrottledPeriods: stats.Cpu.CFS.ThrottledPeriods,
+				ThrottledTime:    stats.Cpu.CFS.ThrottledTime,
+			},
+			LoadAverage: stats.Cpu.LoadAverage,
+		},
+		Diskio: &statspb.DiskIoStats{
+			IoServiceBytes: protoPerDiskStats(stats.DiskIo.IoServiceBytes),
+			IoServiced:     protoPerDiskStats(stats.DiskIo.IoServiced),
+			IoQueued:       protoPerDiskStats(stats.DiskIo.IoQueued),
+			Sectors:        protoPerDiskStats(stats.DiskIo.Sectors),
+			IoServiceTime:  protoPerDiskStats(stats.DiskIo.IoServiceTime),
+			IoWaitTime:     protoPerDiskStats(stats.DiskIo.IoWaitTime),
+			IoMerged:       protoPerDiskStats(stats.DiskIo.IoMerged),
+			IoTime:         protoPerDiskStats(stats.DiskIo.IoTime),
+		},
+		Memory: &statspb.MemoryStats{
+			Usage:      stats.Memory.Usage,
+			Cache:      stats.Memory.Cache,
+			Rss:        stats.Memory.RSS,
+			Swap:       stats.Memory.Swap,
+			WorkingSet: stats.Memory.WorkingSet,
+			Failcnt:    stats.Memory.Failcnt,
+			ContainerData: &statspb.MemoryData{
+				Pgfault:    stats.Memory.ContainerData.Pgfault,
+				Pgmajfault: stats.Memory.ContainerData.Pgmajfault,
+			},
+			HierarchicalData: &statspb.MemoryData{
+				Pgfault:    stats.Memory.HierarchicalData.Pgfault,
+				Pgmajfault: stats.Memory.HierarchicalData.Pgmajfault,
+			},
+		},
+		Network: &statspb.NetworkStats{
+			DefaultInterface: protoInterfaceStats(stats.Network.InterfaceStats),
+			Tcp:              protoTcpStat(stats.Network.Tcp),
+			Tcp6:             protoTcpStat(stats.Network.Tcp6),
+			Udp:              protoUdpStat(stats.Network.Udp),
+			Udp6:             protoUdpStat(stats.Network.Udp6),
+		},
+		TaskStats: &statspb.LoadStats{
+			NrSleeping:        stats.TaskStats.NrSleeping,
+			NrRunning:         stats.TaskStats.NrRunning,
+			NrStopped:         stats.TaskStats.NrStopped,
+			NrUninterruptible: stats.TaskStats.NrUninterruptible,
+			NrIoWait:          stats.TaskStats.NrIoWait,
+		},
+	}
+	for _, i := range stats.Network.Interfaces {
+		ret.Network.Interfaces = append(ret.Network.Interfaces, protoInterfaceStats(i))
+	}
+	for _, fs := range stats.Filesystem {
+		ret.Filesystem = append(ret.Filesystem, &statspb.FsStats{
+			Device:          fs.Device,
+			Type:            fs.Type,
+			Limit:           fs.Limit,
+			Usage:           fs.Usage,
+			BaseUsage:       fs.BaseUsage,
+			Available:       fs.Available,
+			HasInodes:       fs.HasInodes,
+			Inodes:          fs.Inodes,
+			InodesFree:      fs.InodesFree,
+			ReadsCompleted:  fs.ReadsCompleted,
+			ReadsMerged:     fs.ReadsMerged,
+			SectorsRead:     fs.SectorsRead,
+			ReadTime:        fs.ReadTime,
+			WritesCompleted: fs.WritesCompleted,
+			WritesMerged:    fs.WritesMerged,
+			SectorsWritten:  fs.SectorsWritten,
+			WriteTime:       fs.WriteTime,
+			IoInProgress:    fs.IoInProgress,
+			IoTime:          fs.IoTime,
+			WeightedIoTime:  fs.WeightedIoTime,
+		})
+	}
+	if len(stats.CustomMetrics) > 0 {
+		ret.CustomMetrics = make(map[string]*statspb.MetricValues, len(stats.CustomMetrics))
+		for name, values := range stats.CustomMetrics {
+			metric := &statspb.MetricValues{}
+			for _, v := range values {
+				metric.Values = append(metric.Values, &statspb.MetricVal{
+					Label:      v.Label,
+					Timestamp:  unixNano(v.Timestamp),
+					IntValue:   v.IntValue,
+					FloatValue: v.FloatValue,
+				})
+			}
+			ret.CustomMetrics[name] = metric
+		}
+	}
+	return ret
+}
+
+func protoPerDiskStats(stats []info.PerDiskStats) []*statspb.PerDiskStats {
+	var ret []*statspb.PerDiskStats
+	for _, s := range stats {
+		ret = append(ret, &statspb.PerDiskStats{
+			Device: s.Device,
+			Major:  s.Major,
+			Minor:  s.Minor,
+			Stats:  s.Stats,
+		})
+	}
+	return ret
+}
+
+func protoInterfaceStats(stats info.InterfaceStats) *statspb.InterfaceStats {
+	return &statspb.InterfaceStats{
+		Name:      stats.Name,
+		RxBytes:   stats.RxBytes,
+		RxPackets: stats.RxPackets,
+		RxErrors:  stats.RxErrors,
+		RxDropped: stats.RxDropped,
+		TxBytes:   stats.TxBytes,
+		TxPackets: stats.TxPackets,
+		TxErrors:  stats.TxErrors,
+		TxDropped: stats.TxDropped,
+	}
+}
+
+func protoTcpStat(stat info.TcpStat) *statspb.TcpStat {
+	return &statspb.TcpStat{
+		Established: stat.Established,
+		SynSent:     stat.SynSent,
+		SynRecv:     stat.SynRecv,
+		FinWait1:    stat.FinWait1,
+		FinWait2:    stat.FinWait2,
+		TimeWait:    stat.TimeWait,
+		Close:       stat.Close,
+		CloseWait:   stat.CloseWait,
+		LastAck:     stat.LastAck,
+		Listen:      stat.Listen,
+		Closing:     stat.Closing,
+	}
+}
+
+func protoUdpStat(stat info.UdpStat) *statspb.UdpStat {
+	return &statspb.UdpStat{
+		Listen:   stat.Listen,
+		Dropped:  stat.Dropped,
+		RxQueued: stat.RxQueued,
+		TxQueued: stat.TxQueued,
+	}
+}
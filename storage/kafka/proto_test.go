@@ -0,0 +1,212 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/info/v2"
+	"github.com/google/cadvisor/storage"
+	"github.com/google/cadvisor/storage/kafka/statspb"
+
+	kafka "github.com/Shopify/sarama"
+	"github.com/golang/protobuf/proto"
+)
+
+// fakeContainerSpecSource returns the images of the containers and counts
+// the lookups.
+type fakeContainerSpecSource struct {
+	images  map[string]string
+	lookups int
+}
+
+func (self *fakeContainerSpecSource) GetContainerSpec(containerName string, options v2.RequestOptions) (map[string]v2.ContainerSpec, error) {
+	self.lookups++
+	image, ok := self.images[containerName]
+	if !ok {
+		return nil, fmt.Errorf("unknown container %q", containerName)
+	}
+	return map[string]v2.ContainerSpec{containerName: {Image: image, HasMemory: true, Memory: v2.MemorySpec{Limit: 1 << 30}}}, nil
+}
+
+// benchmarkStats returns the stats of a container with 4 CPUs, 2 network
+// interfaces, 2 filesystems and 2 disks.
+func benchmarkStats() *info.ContainerStats {
+	disks := []info.PerDiskStats{
+		{Device: "/dev/sda", Major: 8, Minor: 0, Stats: map[string]uint64{"Read": 1 << 20, "Write": 2 << 20, "Sync": 3, "Async": 4, "Total": 3 << 20}},
+		{Device: "/dev/sdb", Major: 8, Minor: 16, Stats: map[string]uint64{"Read": 5 << 20, "Write": 6 << 20, "Sync": 7, "Async": 8, "Total": 11 << 20}},
+	}
+	return &info.ContainerStats{
+		Timestamp: time.Unix(1460000000, 123000000),
+		Cpu: info.CpuStats{
+			Usage: info.CpuUsage{Total: 123456789012, PerCpu: []uint64{30864197253, 30864197253, 30864197253, 30864197253}, User: 100000000000, System: 23456789012},
+			CFS:   info.CpuCFS{Periods: 1000, ThrottledPeriods: 10, ThrottledTime: 123456789},
+		},
+		DiskIo: info.DiskIoStats{IoServiceBytes: disks, IoServiced: disks},
+		Memory: info.MemoryStats{
+			Usage:         512 << 20,
+			Cache:         128 << 20,
+			RSS:           384 << 20,
+			WorkingSet:    400 << 20,
+			ContainerData: info.MemoryStatsMemoryData{Pgfault: 123456, Pgmajfault: 12},
+		},
+		Network: info.NetworkStats{
+			InterfaceStats: info.InterfaceStats{Name: "eth0", RxBytes: 1 << 30, RxPackets: 1 << 20, TxBytes: 2 << 30, TxPackets: 2 << 20},
+			Interfaces: []info.InterfaceStats{
+				{Name: "eth0", RxBytes: 1 << 30, RxPackets: 1 << 20, TxBytes: 2 << 30, TxPackets: 2 << 20},
+				{Name: "eth1", RxBytes: 3 << 30, RxPackets: 3 << 20, TxBytes: 4 << 30, TxPackets: 4 << 20, RxErrors: 1},
+			},
+			Tcp: info.TcpStat{Established: 12, Listen: 2, TimeWait: 30},
+		},
+		Filesystem: []info.FsStats{
+			{Device: "/dev/sda1", Type: "vfs", Limit: 100 << 30, Usage: 10 << 30, Available: 90 << 30, ReadsCompleted: 1000, WritesCompleted: 2000},
+			{Device: "/dev/sdb1", Type: "vfs", Limit: 200 << 30, Usage: 20 << 30, Available: 180 << 30, ReadsCompleted: 3000, WritesCompleted: 4000},
+		},
+		TaskStats: info.LoadStats{NrSleeping: 10, NrRunning: 2},
+	}
+}
+
+func newProtoTestStorage(producer *fakeProducer) *kafkaStorage {
+	return &kafkaStorage{
+		producer:    newTestProducer(producer),
+		topic:       staticTopic("stats"),
+		machineName: "machineA",
+		messageKey:  func(string, info.ContainerReference) kafka.Encoder { return nil },
+		encode:      encodeProto,
+		specs:       &storage.ContainerSpecCache{},
+	}
+}
+
+func TestProtoMessage(t *testing.T) {
+	producer := newFakeProducer()
+	driver := newProtoTestStorage(producer)
+	source := &fakeContainerSpecSource{images: map[string]string{"/docker/abcd": "nginx:1.11"}}
+	driver.SetContainerSpecSource(source)
+
+	stats := benchmarkStats()
+	if err := driver.AddStats(keyedRef, stats); err != nil {
+		t.Fatal(err)
+	}
+	b, err := (<-producer.input).Value.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := &statspb.ContainerStatsMessage{}
+	if err := proto.Unmarshal(b, message); err != nil {
+		t.Fatal(err)
+	}
+
+	if message.SchemaVersion != protoSchemaVersion {
+		t.Errorf("expected schema version %d, got %d", protoSchemaVersion, message.SchemaVersion)
+	}
+	if message.MachineName != "machineA" {
+		t.Errorf("expected machine name %q, got %q", "machineA", message.MachineName)
+	}
+	if c := message.Container; c.Name != keyedRef.Name || !reflect.DeepEqual(c.Aliases, keyedRef.Aliases) || !reflect.DeepEqual(c.Labels, keyedRef.Labels) {
+		t.Errorf("expected container %+v, got %+v", keyedRef, c)
+	}
+	if message.Spec.GetImage() != "nginx:1.11" || message.Spec.GetMemory().GetLimit() != 1<<30 {
+		t.Errorf("expected the spec of the container, got %+v", message.Spec)
+	}
+
+	s := message.Stats
+	if s.Timestamp != stats.Timestamp.UnixNano() {
+		t.Errorf("expected timestamp %d, got %d", stats.Timestamp.UnixNano(), s.Timestamp)
+	}
+	if !reflect.DeepEqual(s.Cpu.Usage.PerCpuUsage, stats.Cpu.Usage.PerCpu) {
+		t.Errorf("expected per CPU usage %v, got %v", stats.Cpu.Usage.PerCpu, s.Cpu.Usage.PerCpuUsage)
+	}
+	if s.Memory.WorkingSet != stats.Memory.WorkingSet || s.Memory.ContainerData.Pgfault != stats.Memory.ContainerData.Pgfault {
+		t.Errorf("expected memory %+v, got %+v", stats.Memory, s.Memory)
+	}
+	if len(s.Network.Interfaces) != 2 || s.Network.Interfaces[1].RxErrors != 1 || s.Network.DefaultInterface.Name != "eth0" || s.Network.Tcp.Established != 12 {
+		t.Errorf("expected network %+v, got %+v", stats.Network, s.Network)
+	}
+	if len(s.Filesystem) != 2 || s.Filesystem[1].Device != "/dev/sdb1" || s.Filesystem[1].Usage != 20<<30 {
+		t.Errorf("expected filesystems %+v, got %+v", stats.Filesystem, s.Filesystem)
+	}
+	if d := s.Diskio.IoServiceBytes; len(d) != 2 || d[1].Device != "/dev/sdb" || d[1].Stats["Write"] != 6<<20 {
+		t.Errorf("expected disk I/O %+v, got %+v", stats.DiskIo.IoServiceBytes, d)
+	}
+
+	// The spec is looked up once.
+	if err := driver.AddStats(keyedRef, stats); err != nil {
+		t.Fatal(err)
+	}
+	<-producer.input
+	if source.lookups != 1 {
+		t.Errorf("expected the spec to be looked up once, got %d lookups", source.lookups)
+	}
+}
+
+func TestProtoMessageWithoutSpec(t *testing.T) {
+	producer := newFakeProducer()
+	driver := newProtoTestStorage(producer)
+	driver.SetContainerSpecSource(&fakeContainerSpecSource{})
+
+	if err := driver.AddStats(keyedRef, &info.ContainerStats{Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := (<-producer.input).Value.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := &statspb.ContainerStatsMessage{}
+	if err := proto.Unmarshal(b, message); err != nil {
+		t.Fatal(err)
+	}
+	if message.Spec != nil {
+		t.Errorf("expected no spec for an unknown container, got %+v", message.Spec)
+	}
+	if message.Container.Name != keyedRef.Name {
+		t.Errorf("expected container %q, got %q", keyedRef.Name, message.Container.Name)
+	}
+}
+
+func benchmarkEncode(b *testing.B, encode messageEncoderFunc) {
+	detail := &detailSpec{
+		Timestamp:       time.Now(),
+		MachineName:     "machineA",
+		ContainerName:   "web",
+		ContainerID:     "abcd",
+		ContainerLabels: keyedRef.Labels,
+		ContainerStats:  benchmarkStats(),
+		ref:             keyedRef,
+		spec:            &v2.ContainerSpec{Image: "nginx:1.11", HasCpu: true, HasMemory: true},
+	}
+	var size int
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		msg, err := encode(detail)
+		if err != nil {
+			b.Fatal(err)
+		}
+		size = len(msg)
+	}
+	b.SetBytes(int64(size))
+}
+
+func BenchmarkEncodeJSON(b *testing.B) {
+	benchmarkEncode(b, encodeJSON)
+}
+
+func BenchmarkEncodeProto(b *testing.B) {
+	benchmarkEncode(b, encodeProto)
+}
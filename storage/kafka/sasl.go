@@ -0,0 +1,228 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"net"
+	"strconv"
+	"strings"
+
+	kafka "github.com/Shopify/sarama"
+	"github.com/golang/glog"
+)
+
+// configureSASL enables the SASL authentication of the producer with the
+// given mechanism, unless it is empty.
+func configureSASL(config *kafka.Config, mechanism, user, password string) error {
+	if mechanism == "" {
+		return nil
+	}
+	if user == "" {
+		return fmt.Errorf("a user is required by the Kafka SASL authentication")
+	}
+	config.Net.SASL.Enable = true
+	config.Net.SASL.Mechanism = kafka.SASLMechanism(strings.ToUpper(mechanism))
+	config.Net.SASL.User = user
+	config.Net.SASL.Password = password
+	switch config.Net.SASL.Mechanism {
+	case kafka.SASLTypePlaintext:
+	case kafka.SASLTypeSCRAMSHA256:
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() kafka.SCRAMClient { return newSCRAMClient(sha256.New) }
+	case kafka.SASLTypeSCRAMSHA512:
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() kafka.SCRAMClient { return newSCRAMClient(sha512.New) }
+	default:
+		return fmt.Errorf("unsupported Kafka SASL mechanism %q, must be PLAIN, SCRAM-SHA-256 or SCRAM-SHA-512", mechanism)
+	}
+	return nil
+}
+
+// isDialError returns whether err means that a broker could not be reached
+// at all, as opposed to e.g. a failed authentication.
+func isDialError(err error) bool {
+	opErr, ok := err.(*net.OpError)
+	return ok && opErr.Op == "dial"
+}
+
+// checkSASL authenticates with the first reachable broker, so that wrong
+// credentials are reported on startup rather than by every message being
+// dropped. Unreachable brokers are left to the producer.
+func checkSASL(brokerList []string, config *kafka.Config) error {
+	for _, addr := range brokerList {
+		broker := kafka.NewBroker(addr)
+		if err := broker.Open(config); err != nil {
+			return err
+		}
+		connected, err := broker.Connected()
+		if connected {
+			broker.Close()
+			return nil
+		}
+		if !isDialError(err) {
+			return fmt.Errorf("failed to authenticate with Kafka broker %s - %s", addr, err)
+		}
+		glog.V(4).Infof("could not reach Kafka broker %s to authenticate - %s", addr, err)
+	}
+	return nil
+}
+
+// scramClient is a client of the SASL/SCRAM mechanisms, see RFC 5802.
+// Usernames and passwords are not normalized with SASLprep.
+type scramClient struct {
+	hash     func() hash.Hash
+	user     string
+	password string
+	// Returns the nonce of the client.
+	nonce func() (string, error)
+	// Number of challenges of the server answered.
+	step            int
+	clientNonce     string
+	clientFirstBare string
+	serverSignature []byte
+}
+
+func newSCRAMClient(hash func() hash.Hash) *scramClient {
+	return &scramClient{
+		hash:  hash,
+		nonce: randomNonce,
+	}
+}
+
+func randomNonce() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(b), nil
+}
+
+func (self *scramClient) Begin(userName, password, authzID string) error {
+	self.user = userName
+	self.password = password
+	self.step = 0
+	return nil
+}
+
+func (self *scramClient) Step(challenge string) (string, error) {
+	self.step++
+	switch self.step {
+	case 1:
+		return self.clientFirst()
+	case 2:
+		return self.clientFinal(challenge)
+	case 3:
+		return "", self.verifyServerFinal(challenge)
+	}
+	return "", fmt.Errorf("unexpected SCRAM challenge %q", challenge)
+}
+
+func (self *scramClient) Done() bool {
+	return self.step >= 3
+}
+
+func (self *scramClient) clientFirst() (string, error) {
+	var err error
+	if self.clientNonce, err = self.nonce(); err != nil {
+		return "", err
+	}
+	name := strings.NewReplacer("=", "=3D", ",", "=2C").Replace(self.user)
+	self.clientFirstBare = "n=" + name + ",r=" + self.clientNonce
+	return "n,," + self.clientFirstBare, nil
+}
+
+// scramAttributes returns the attributes of a SCRAM message by name.
+func scramAttributes(message string) map[string]string {
+	ret := make(map[string]string)
+	for _, attribute := range strings.Split(message, ",") {
+		if len(attribute) >= 2 && attribute[1] == '=' {
+			ret[attribute[:1]] = attribute[2:]
+		}
+	}
+	return ret
+}
+
+func (self *scramClient) hmac(key []byte, message string) []byte {
+	mac := hmac.New(self.hash, key)
+	mac.Write([]byte(message))
+	return mac.Sum(nil)
+}
+
+// saltedPassword returns Hi(password, salt, iterations) of RFC 5802, which
+// is PBKDF2 with HMAC as the pseudorandom function.
+func (self *scramClient) saltedPassword(salt []byte, iterations int) []byte {
+	mac := hmac.New(self.hash, []byte(self.password))
+	mac.Write(salt)
+	mac.Write([]byte{0, 0, 0, 1})
+	u := mac.Sum(nil)
+	ret := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		mac.Reset()
+		mac.Write(u)
+		u = mac.Sum(u[:0])
+		for j := range ret {
+			ret[j] ^= u[j]
+		}
+	}
+	return ret
+}
+
+func (self *scramClient) clientFinal(serverFirst string) (string, error) {
+	attributes := scramAttributes(serverFirst)
+	nonce := attributes["r"]
+	if !strings.HasPrefix(nonce, self.clientNonce) || len(nonce) == len(self.clientNonce) {
+		return "", fmt.Errorf("invalid SCRAM nonce in %q", serverFirst)
+	}
+	salt, err := base64.StdEncoding.DecodeString(attributes["s"])
+	if err != nil {
+		return "", fmt.Errorf("invalid SCRAM salt in %q - %s", serverFirst, err)
+	}
+	iterations, err := strconv.Atoi(attributes["i"])
+	if err != nil || iterations < 1 {
+		return "", fmt.Errorf("invalid SCRAM iteration count in %q", serverFirst)
+	}
+
+	// "biws" is the base64 encoding of the GS2 header "n,,".
+	clientFinalWithoutProof := "c=biws,r=" + nonce
+	authMessage := self.clientFirstBare + "," + serverFirst + "," + clientFinalWithoutProof
+	saltedPassword := self.saltedPassword(salt, iterations)
+	clientKey := self.hmac(saltedPassword, "Client Key")
+	h := self.hash()
+	h.Write(clientKey)
+	clientSignature := self.hmac(h.Sum(nil), authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+	self.serverSignature = self.hmac(self.hmac(saltedPassword, "Server Key"), authMessage)
+	return clientFinalWithoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+func (self *scramClient) verifyServerFinal(serverFinal string) error {
+	attributes := scramAttributes(serverFinal)
+	if e, ok := attributes["e"]; ok {
+		return fmt.Errorf("SCRAM authentication rejected - %s", e)
+	}
+	signature, err := base64.StdEncoding.DecodeString(attributes["v"])
+	if err != nil || !hmac.Equal(signature, self.serverSignature) {
+		return fmt.Errorf("invalid SCRAM server signature in %q", serverFinal)
+	}
+	return nil
+}
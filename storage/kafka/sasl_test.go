@@ -0,0 +1,189 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	kafka "github.com/Shopify/sarama"
+)
+
+func TestNoSASLByDefault(t *testing.T) {
+	config := kafka.NewConfig()
+	if err := configureSASL(config, "", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if config.Net.SASL.Enable {
+		t.Error("expected SASL to be disabled")
+	}
+}
+
+func TestConfigureSASL(t *testing.T) {
+	for _, tc := range []struct {
+		mechanism string
+		expected  kafka.SASLMechanism
+		scram     bool
+	}{
+		{"PLAIN", kafka.SASLTypePlaintext, false},
+		{"SCRAM-SHA-256", kafka.SASLTypeSCRAMSHA256, true},
+		{"scram-sha-512", kafka.SASLTypeSCRAMSHA512, true},
+	} {
+		config := kafka.NewConfig()
+		if err := configureSASL(config, tc.mechanism, "cadvisor", "secret"); err != nil {
+			t.Errorf("unexpected error for %s: %v", tc.mechanism, err)
+			continue
+		}
+		sasl := config.Net.SASL
+		if !sasl.Enable || sasl.Mechanism != tc.expected || sasl.User != "cadvisor" || sasl.Password != "secret" {
+			t.Errorf("unexpected SASL configuration for %s: %+v", tc.mechanism, sasl)
+		}
+		if (sasl.SCRAMClientGeneratorFunc != nil) != tc.scram {
+			t.Errorf("expected a SCRAM client generator for %s: %v", tc.mechanism, tc.scram)
+		}
+		if err := config.Validate(); err != nil {
+			t.Errorf("expected a valid configuration for %s, got %v", tc.mechanism, err)
+		}
+	}
+}
+
+func TestConfigureSASLErrors(t *testing.T) {
+	if err := configureSASL(kafka.NewConfig(), "GSSAPI", "cadvisor", "secret"); err == nil {
+		t.Error("expected an unsupported mechanism to be an error")
+	}
+	if err := configureSASL(kafka.NewConfig(), "PLAIN", "", "secret"); err == nil {
+		t.Error("expected a missing user to be an error")
+	}
+}
+
+// The example exchange of RFC 7677.
+func TestSCRAMClient(t *testing.T) {
+	client := newSCRAMClient(sha256.New)
+	client.nonce = func() (string, error) { return "rOprNGfwEbeRWgbNEkqO", nil }
+	client.Begin("user", "pencil", "")
+	for _, step := range []struct {
+		challenge string
+		response  string
+	}{
+		{"", "n,,n=user,r=rOprNGfwEbeRWgbNEkqO"},
+		{
+			"r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096",
+			"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+		},
+		{"v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=", ""},
+	} {
+		if client.Done() {
+			t.Fatal("expected the exchange not to be done")
+		}
+		response, err := client.Step(step.challenge)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response != step.response {
+			t.Errorf("expected the response %q, got %q", step.response, response)
+		}
+	}
+	if !client.Done() {
+		t.Error("expected the exchange to be done")
+	}
+}
+
+func TestSCRAMClientRejectsServerSignature(t *testing.T) {
+	client := newSCRAMClient(sha256.New)
+	client.nonce = func() (string, error) { return "rOprNGfwEbeRWgbNEkqO", nil }
+	client.Begin("user", "pencil", "")
+	client.Step("")
+	client.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	if _, err := client.Step("v=AAAA"); err == nil {
+		t.Error("expected a wrong server signature to be an error")
+	}
+}
+
+// serveSASLPlain accepts one connection and authenticates it with the
+// SASL/PLAIN mechanism, closing it if the credentials are not
+// cadvisor:secret as Kafka does.
+func serveSASLPlain(t *testing.T, listener net.Listener) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	readFrame := func() []byte {
+		length := make([]byte, 4)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return nil
+		}
+		frame := make([]byte, binary.BigEndian.Uint32(length))
+		if _, err := io.ReadFull(conn, frame); err != nil {
+			return nil
+		}
+		return frame
+	}
+	if handshake := readFrame(); !strings.HasSuffix(string(handshake), "PLAIN") {
+		t.Errorf("expected a SASL/PLAIN handshake, got %q", handshake)
+		return
+	}
+	// Correlation ID, no error and the list of enabled mechanisms.
+	conn.Write([]byte{0, 0, 0, 17, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 0, 5, 'P', 'L', 'A', 'I', 'N'})
+	if token := readFrame(); string(token) == "\x00cadvisor\x00secret" {
+		conn.Write([]byte{0, 0, 0, 0})
+	}
+}
+
+func TestCheckSASL(t *testing.T) {
+	for _, tc := range []struct {
+		password string
+		ok       bool
+	}{
+		{"secret", true},
+		{"wrong", false},
+	} {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go serveSASLPlain(t, listener)
+		config := kafka.NewConfig()
+		if err := configureSASL(config, "PLAIN", "cadvisor", tc.password); err != nil {
+			t.Fatal(err)
+		}
+		err = checkSASL([]string{listener.Addr().String()}, config)
+		listener.Close()
+		if tc.ok && err != nil {
+			t.Errorf("expected the authentication to succeed, got %v", err)
+		}
+		if !tc.ok && (err == nil || !strings.Contains(err.Error(), "failed to authenticate")) {
+			t.Errorf("expected the authentication to fail, got %v", err)
+		}
+	}
+}
+
+func TestCheckSASLIgnoresUnreachableBrokers(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	config := kafka.NewConfig()
+	configureSASL(config, "PLAIN", "cadvisor", "secret")
+	if err := checkSASL([]string{addr}, config); err != nil {
+		t.Errorf("expected an unreachable broker not to be an error, got %v", err)
+	}
+}
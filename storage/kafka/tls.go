@@ -0,0 +1,136 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// generateTLSConfig returns the TLS configuration used to connect to the
+// brokers, or nil if TLS is not enabled. The client certificate is reloaded
+// when its files change.
+func generateTLSConfig(caFile, certFile, keyFile string, verify bool) (*tls.Config, error) {
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: !verify,
+	}
+	if caFile != "" {
+		caCert, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificate found in %q", caFile)
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+	if certFile != "" || keyFile != "" {
+		reloader, err := newCertReloader(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = reloader.GetClientCertificate
+	}
+	return tlsConfig, nil
+}
+
+// certReloader provides the client certificate, read again from its files
+// when they are modified, e.g. by a certificate rotation. A certificate which
+// cannot be read or has expired is logged and the last good one kept.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	lock     sync.Mutex
+	cert     *tls.Certificate
+	// Modification times of the files when last read.
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	ret := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+	if err := ret.reload(); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// modTimes returns the modification times of the certificate and key files.
+func (self *certReloader) modTimes() (time.Time, time.Time, error) {
+	certInfo, err := os.Stat(self.certFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	keyInfo, err := os.Stat(self.keyFile)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// reload reads the certificate if its files were modified since last read.
+func (self *certReloader) reload() error {
+	certModTime, keyModTime, err := self.modTimes()
+	if err != nil {
+		return err
+	}
+	if self.cert != nil && certModTime.Equal(self.certModTime) && keyModTime.Equal(self.keyModTime) {
+		return nil
+	}
+	// A failed read is not retried until the files change again.
+	self.certModTime = certModTime
+	self.keyModTime = keyModTime
+
+	cert, err := tls.LoadX509KeyPair(self.certFile, self.keyFile)
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	if time.Now().After(leaf.NotAfter) {
+		return fmt.Errorf("the certificate %q expired on %s", self.certFile, leaf.NotAfter)
+	}
+	cert.Leaf = leaf
+	self.cert = &cert
+	glog.V(2).Infof("loaded the Kafka client certificate %q, valid until %s", self.certFile, leaf.NotAfter)
+	return nil
+}
+
+// GetClientCertificate returns the client certificate presented to the
+// brokers, read again first if its files were modified.
+func (self *certReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if err := self.reload(); err != nil {
+		glog.Errorf("failed to reload the Kafka client certificate %q, keeping the previous one - %s", self.certFile, err)
+	}
+	return self.cert, nil
+}
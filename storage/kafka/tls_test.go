@@ -0,0 +1,151 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCert writes a self-signed certificate for commonName, valid until
+// notAfter, and its key to cert.pem and key.pem in dir, modified at
+// modTime.
+func writeCert(t *testing.T, dir, commonName string, notAfter, modTime time.Time) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    notAfter.Add(-48 * time.Hour),
+		NotAfter:     notAfter,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, block := range map[string]*pem.Block{
+		"cert.pem": {Type: "CERTIFICATE", Bytes: der},
+		"key.pem":  {Type: "EC PRIVATE KEY", Bytes: keyDer},
+	} {
+		writeFile(t, filepath.Join(dir, name), pem.EncodeToMemory(block), modTime)
+	}
+}
+
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func clientCommonName(t *testing.T, reloader *certReloader) string {
+	cert, err := reloader.GetClientCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert.Leaf.Subject.CommonName
+}
+
+func TestCertReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cadvisor-kafka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	validUntil := time.Now().Add(24 * time.Hour)
+	modTime := time.Now().Add(-time.Hour)
+	writeCert(t, dir, "first", validUntil, modTime)
+
+	tlsConfig, err := generateTLSConfig("", certFile, keyFile, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig.InsecureSkipVerify {
+		t.Error("expected the broker certificates to be verified")
+	}
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := clientCommonName(t, reloader); name != "first" {
+		t.Errorf("expected the first certificate, got %q", name)
+	}
+
+	// Rotated.
+	modTime = modTime.Add(time.Minute)
+	writeCert(t, dir, "second", validUntil, modTime)
+	if name := clientCommonName(t, reloader); name != "second" {
+		t.Errorf("expected the rotated certificate, got %q", name)
+	}
+
+	// Unreadable, the last good certificate is kept.
+	modTime = modTime.Add(time.Minute)
+	writeFile(t, certFile, []byte("not a certificate"), modTime)
+	if name := clientCommonName(t, reloader); name != "second" {
+		t.Errorf("expected the last good certificate, got %q", name)
+	}
+
+	// Expired, the last good certificate is kept.
+	modTime = modTime.Add(time.Minute)
+	writeCert(t, dir, "expired", time.Now().Add(-time.Hour), modTime)
+	if name := clientCommonName(t, reloader); name != "second" {
+		t.Errorf("expected the last good certificate, got %q", name)
+	}
+
+	// Rotated again.
+	modTime = modTime.Add(time.Minute)
+	writeCert(t, dir, "third", validUntil, modTime)
+	if name := clientCommonName(t, reloader); name != "third" {
+		t.Errorf("expected the rotated certificate, got %q", name)
+	}
+}
+
+func TestGenerateTLSConfigErrors(t *testing.T) {
+	if tlsConfig, err := generateTLSConfig("", "", "", true); tlsConfig != nil || err != nil {
+		t.Errorf("expected TLS to be disabled, got %v (%v)", tlsConfig, err)
+	}
+	if _, err := generateTLSConfig("", "/nonexistent/cert.pem", "/nonexistent/key.pem", true); err == nil {
+		t.Error("expected a missing certificate to be an error")
+	}
+	dir, err := ioutil.TempDir("", "cadvisor-kafka")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeCert(t, dir, "expired", time.Now().Add(-time.Hour), time.Now())
+	if _, err := generateTLSConfig("", filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), true); err == nil {
+		t.Error("expected an expired certificate to be an error on startup")
+	}
+}
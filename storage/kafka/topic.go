@@ -0,0 +1,109 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"fmt"
+	"strings"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// Maximum length of a Kafka topic name.
+const maxTopicLength = 249
+
+// topicFunc returns the topic of the messages of a container.
+type topicFunc func(ref info.ContainerReference) string
+
+func staticTopic(topic string) topicFunc {
+	return func(ref info.ContainerReference) string {
+		return topic
+	}
+}
+
+// topicSegment is a part of a topic template, either literal text or the
+// value of a container label.
+type topicSegment struct {
+	text  string
+	label string
+}
+
+// newTopicFunc returns the function resolving a topic template, where
+// {label:<label name>} is replaced with the value of a container label,
+// e.g. cadvisor.{label:team}. Messages of the containers without one of the
+// labels go to the fallback topic.
+func newTopicFunc(template, fallback string) (topicFunc, error) {
+	var segments []topicSegment
+	rest := template
+	for rest != "" {
+		start := strings.Index(rest, "{")
+		if start < 0 {
+			segments = append(segments, topicSegment{text: rest})
+			break
+		}
+		end := strings.Index(rest[start:], "}")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated placeholder in Kafka topic %q", template)
+		}
+		placeholder := rest[start+1 : start+end]
+		label := strings.TrimPrefix(placeholder, keyLabelPrefix)
+		if label == placeholder || label == "" {
+			return nil, fmt.Errorf("unknown placeholder {%s} in Kafka topic %q, must be {%s<label name>}", placeholder, template, keyLabelPrefix)
+		}
+		if start > 0 {
+			segments = append(segments, topicSegment{text: rest[:start]})
+		}
+		segments = append(segments, topicSegment{label: label})
+		rest = rest[start+end+1:]
+	}
+	if len(segments) <= 1 && (len(segments) == 0 || segments[0].label == "") {
+		return staticTopic(template), nil
+	}
+	if fallback == "" {
+		return nil, fmt.Errorf("a fallback topic is required by the Kafka topic template %q", template)
+	}
+	return func(ref info.ContainerReference) string {
+		var topic []byte
+		for _, segment := range segments {
+			if segment.label == "" {
+				topic = append(topic, segment.text...)
+				continue
+			}
+			value := ref.Labels[segment.label]
+			if value == "" {
+				return fallback
+			}
+			topic = append(topic, value...)
+		}
+		return sanitizeTopic(string(topic), fallback)
+	}, nil
+}
+
+// sanitizeTopic returns topic with the characters not allowed in Kafka
+// topic names, other than ASCII letters, digits, '.', '_' and '-', replaced
+// by underscores, or fallback if it is still not a legal topic name.
+func sanitizeTopic(topic, fallback string) string {
+	topic = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, topic)
+	if topic == "." || topic == ".." || len(topic) > maxTopicLength {
+		return fallback
+	}
+	return topic
+}
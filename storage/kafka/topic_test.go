@@ -0,0 +1,102 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+func TestTopicTemplates(t *testing.T) {
+	ref := info.ContainerReference{
+		Name: "/docker/abcd",
+		Labels: map[string]string{
+			"team":   "payments",
+			"env":    "prod",
+			"tenant": "Acme Corp/EU",
+			"dots":   "..",
+			"long":   strings.Repeat("a", maxTopicLength),
+			"empty":  "",
+		},
+	}
+	for template, expected := range map[string]string{
+		"stats":                          "stats",
+		"cadvisor.{label:team}":          "cadvisor.payments",
+		"{label:team}":                   "payments",
+		"{label:env}-{label:team}.stats": "prod-payments.stats",
+		"cadvisor.{label:tenant}":        "cadvisor.Acme_Corp_EU",
+		"cadvisor.{label:missing}":       "fallback",
+		"cadvisor.{label:empty}":         "fallback",
+		"{label:dots}":                   "fallback",
+		"cadvisor.{label:long}":          "fallback",
+	} {
+		topicOf, err := newTopicFunc(template, "fallback")
+		if err != nil {
+			t.Errorf("unexpected error for template %q: %s", template, err)
+			continue
+		}
+		if actual := topicOf(ref); actual != expected {
+			t.Errorf("expected template %q to resolve to %q, got %q", template, expected, actual)
+		}
+	}
+}
+
+func TestInvalidTopicTemplates(t *testing.T) {
+	for _, template := range []string{
+		"cadvisor.{label:team",
+		"cadvisor.{team}",
+		"cadvisor.{label:}",
+	} {
+		if _, err := newTopicFunc(template, "fallback"); err == nil {
+			t.Errorf("expected an error for template %q", template)
+		}
+	}
+	if _, err := newTopicFunc("cadvisor.{label:team}", ""); err == nil {
+		t.Errorf("expected an error for a template without fallback topic")
+	}
+	if _, err := newTopicFunc("stats", ""); err != nil {
+		t.Errorf("unexpected error for a static topic without fallback topic: %s", err)
+	}
+}
+
+func TestMessageTopics(t *testing.T) {
+	topicOf, err := newTopicFunc("cadvisor.{label:team}", "stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	producer := newFakeProducer()
+	driver := &kafkaStorage{
+		producer:    newTestProducer(producer),
+		topic:       topicOf,
+		machineName: "machineA",
+		messageKey:  noMessageKey,
+		encode:      encodeJSON,
+	}
+	for _, labels := range []map[string]string{{"team": "payments"}, nil} {
+		ref := info.ContainerReference{Name: "/docker/abcd", Labels: labels}
+		if err := driver.AddStats(ref, &info.ContainerStats{Timestamp: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if topic := (<-producer.input).Topic; topic != "cadvisor.payments" {
+		t.Errorf("expected topic %q, got %q", "cadvisor.payments", topic)
+	}
+	if topic := (<-producer.input).Topic; topic != "stats" {
+		t.Errorf("expected the fallback topic %q, got %q", "stats", topic)
+	}
+}
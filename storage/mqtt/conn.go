@@ -0,0 +1,271 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const dialTimeout = 5 * time.Second
+
+// dialOptions are how to connect and authenticate to the MQTT broker.
+type dialOptions struct {
+	broker    string
+	clientId  string
+	username  string
+	password  string
+	tlsConfig *tls.Config
+	keepAlive time.Duration
+}
+
+// conn is a connection of an MQTT 3.1.1 client to a broker, which only
+// publishes. The session of the client is kept by the broker across
+// connections, so that the messages of QoS 1 it did not acknowledge can be
+// published again after reconnecting.
+type conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	// Whether the broker had a session of the client.
+	sessionPresent bool
+	keepAlive      time.Duration
+
+	writeLock sync.Mutex
+	// Receives the packet IDs of the PUBACKs.
+	acks chan uint16
+
+	lock   sync.Mutex
+	err    error
+	closed chan struct{}
+}
+
+// dial connects to the broker, and authenticates.
+func dial(options dialOptions) (*conn, error) {
+	host, useTLS, err := brokerAddress(options.broker)
+	if err != nil {
+		return nil, err
+	}
+	netConn, err := net.DialTimeout("tcp", host, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if useTLS {
+		tlsConfig := &tls.Config{}
+		if options.tlsConfig != nil {
+			tlsConfig = options.tlsConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName, _, _ = net.SplitHostPort(host)
+		}
+		tlsConn := tls.Client(netConn, tlsConfig)
+		tlsConn.SetDeadline(time.Now().Add(dialTimeout))
+		if err := tlsConn.Handshake(); err != nil {
+			netConn.Close()
+			return nil, fmt.Errorf("TLS handshake with the MQTT broker failed - %v", err)
+		}
+		netConn = tlsConn
+	}
+	c := &conn{
+		conn:      netConn,
+		reader:    bufio.NewReader(netConn),
+		keepAlive: options.keepAlive,
+		acks:      make(chan uint16, 16),
+		closed:    make(chan struct{}),
+	}
+	if err := c.connect(options); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	go c.readLoop()
+	go c.pingLoop()
+	return c, nil
+}
+
+// brokerAddress returns the host and port of the broker, and whether to use
+// TLS, of its URL.
+func brokerAddress(broker string) (string, bool, error) {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return "", false, err
+	}
+	useTLS, port := false, "1883"
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		useTLS, port = true, "8883"
+	default:
+		return "", false, fmt.Errorf("invalid MQTT broker %q, the scheme must be tcp or ssl", broker)
+	}
+	if u.Hostname() == "" {
+		return "", false, fmt.Errorf("invalid MQTT broker %q, no host", broker)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	return net.JoinHostPort(u.Hostname(), port), useTLS, nil
+}
+
+func (self *conn) connect(options dialOptions) error {
+	self.conn.SetDeadline(time.Now().Add(dialTimeout))
+	defer self.conn.SetDeadline(time.Time{})
+	keepAlive := options.keepAlive / time.Second
+	if keepAlive > 65535 {
+		keepAlive = 65535
+	}
+	if err := self.write(connectPacket(options.clientId, options.username, options.password, false, uint16(keepAlive))); err != nil {
+		return err
+	}
+	p, err := readPacket(self.reader)
+	if err != nil {
+		return err
+	}
+	if p.packetType != packetConnAck || len(p.body) != 2 {
+		return fmt.Errorf("unexpected MQTT packet of type %d instead of CONNACK", p.packetType)
+	}
+	if code := p.body[1]; code != 0 {
+		reason, ok := connAckErrors[code]
+		if !ok {
+			reason = fmt.Sprintf("return code %d", code)
+		}
+		return fmt.Errorf("MQTT broker refused the connection: %s", reason)
+	}
+	self.sessionPresent = p.body[0]&0x01 != 0
+	return nil
+}
+
+// readLoop passes on the PUBACKs, until the connection fails or the broker
+// is silent for longer than the keep alive allows.
+func (self *conn) readLoop() {
+	var err error
+	for {
+		if self.keepAlive > 0 {
+			self.conn.SetReadDeadline(time.Now().Add(self.keepAlive * 3 / 2))
+		}
+		var p packet
+		if p, err = readPacket(self.reader); err != nil {
+			break
+		}
+		if p.packetType == packetPubAck {
+			var id uint16
+			if id, err = p.packetId(); err != nil {
+				break
+			}
+			select {
+			case self.acks <- id:
+			default:
+				// Nobody waits for it, the message was given up on.
+			}
+		}
+	}
+	self.fail(err)
+}
+
+// pingLoop sends a PINGREQ every keep alive, so that the broker does not
+// close the connection, and answers so that readLoop notices a dead broker.
+func (self *conn) pingLoop() {
+	if self.keepAlive <= 0 {
+		return
+	}
+	ticker := time.NewTicker(self.keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := self.write(packet{packetType: packetPingReq}); err != nil {
+				self.fail(err)
+				return
+			}
+		case <-self.closed:
+			return
+		}
+	}
+}
+
+func (self *conn) write(p packet) error {
+	b, err := p.encode()
+	if err != nil {
+		return err
+	}
+	self.writeLock.Lock()
+	defer self.writeLock.Unlock()
+	self.conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+	_, err = self.conn.Write(b)
+	return err
+}
+
+// fail closes the connection after an error.
+func (self *conn) fail(err error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.err != nil {
+		return
+	}
+	if err == nil {
+		err = errors.New("connection closed")
+	}
+	self.err = err
+	self.conn.Close()
+	close(self.closed)
+}
+
+func (self *conn) failed() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.err
+}
+
+// publish publishes a message. With a QoS of 1, it waits for the broker to
+// acknowledge it, at most timeout.
+func (self *conn) publish(topic string, payload []byte, qos byte, retain, dup bool, packetId uint16, timeout time.Duration) error {
+	if err := self.failed(); err != nil {
+		return err
+	}
+	if err := self.write(publishPacket(topic, payload, qos, retain, dup, packetId)); err != nil {
+		self.fail(err)
+		return err
+	}
+	if qos == 0 {
+		return nil
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case id := <-self.acks:
+			if id == packetId {
+				return nil
+			}
+		case <-self.closed:
+			return self.failed()
+		case <-timer.C:
+			return fmt.Errorf("no PUBACK after %s", timeout)
+		}
+	}
+}
+
+// disconnect closes the connection cleanly, the broker keeping the
+// session.
+func (self *conn) disconnect() {
+	if self.failed() == nil {
+		self.write(packet{packetType: packetDisconnect})
+	}
+	self.fail(errors.New("disconnected"))
+}
@@ -0,0 +1,374 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// connectInfo is a CONNECT received by the fake broker.
+type connectInfo struct {
+	clientId     string
+	username     string
+	password     string
+	cleanSession bool
+	keepAlive    uint16
+}
+
+// publishedMessage is a PUBLISH received by the fake broker.
+type publishedMessage struct {
+	topic    string
+	payload  []byte
+	qos      byte
+	retain   bool
+	dup      bool
+	packetId uint16
+}
+
+// fakeBroker speaks the part of MQTT 3.1.1 the driver uses, and keeps the
+// sessions of the clients which are not clean.
+type fakeBroker struct {
+	t        *testing.T
+	addr     string
+	listener net.Listener
+	tls      *tls.Config
+	// Return code of the CONNACKs.
+	refuse byte
+	// Number of PUBLISHes after which the connection is closed instead of
+	// acknowledging them, from the first, and whether they are not
+	// acknowledged at all.
+	dropPublishes int
+	noAcks        bool
+
+	lock     sync.Mutex
+	sessions map[string]bool
+	connects []connectInfo
+	messages []publishedMessage
+	pings    int
+	conns    []net.Conn
+}
+
+// newFakeBroker starts a broker, configured before it listens.
+func newFakeBroker(t *testing.T, configure ...func(*fakeBroker)) *fakeBroker {
+	s := &fakeBroker{t: t, addr: "127.0.0.1:0", sessions: make(map[string]bool)}
+	for _, f := range configure {
+		f(s)
+	}
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.listener = l
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.lock.Lock()
+			s.conns = append(s.conns, conn)
+			s.lock.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (self *fakeBroker) url() string {
+	return "tcp://" + self.listener.Addr().String()
+}
+
+func (self *fakeBroker) close() {
+	self.listener.Close()
+	self.dropConnections()
+}
+
+// dropConnections closes the connections of the clients.
+func (self *fakeBroker) dropConnections() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, conn := range self.conns {
+		conn.Close()
+	}
+	self.conns = nil
+}
+
+func (self *fakeBroker) connected() []connectInfo {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return append([]connectInfo(nil), self.connects...)
+}
+
+func (self *fakeBroker) published() []publishedMessage {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return append([]publishedMessage(nil), self.messages...)
+}
+
+func (self *fakeBroker) pinged() int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.pings
+}
+
+func readString(b []byte) (string, []byte) {
+	if len(b) < 2 {
+		return "", nil
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil
+	}
+	return string(b[2 : 2+n]), b[2+n:]
+}
+
+func (self *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	if self.tls != nil {
+		tlsConn := tls.Server(conn, self.tls)
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		conn = tlsConn
+	}
+	reader := bufio.NewReader(conn)
+	write := func(p packet) {
+		b, _ := p.encode()
+		conn.Write(b)
+	}
+	for {
+		p, err := readPacket(reader)
+		if err != nil {
+			return
+		}
+		switch p.packetType {
+		case packetConnect:
+			protocol, rest := readString(p.body)
+			if protocol != "MQTT" || len(rest) < 4 || rest[0] != 4 {
+				self.t.Errorf("unexpected CONNECT %q", p.body)
+				return
+			}
+			flags := rest[1]
+			info := connectInfo{cleanSession: flags&connectCleanSession != 0, keepAlive: binary.BigEndian.Uint16(rest[2:])}
+			info.clientId, rest = readString(rest[4:])
+			if flags&connectUsername != 0 {
+				info.username, rest = readString(rest)
+			}
+			if flags&connectPassword != 0 {
+				info.password, rest = readString(rest)
+			}
+			self.lock.Lock()
+			self.connects = append(self.connects, info)
+			sessionPresent := !info.cleanSession && self.sessions[info.clientId]
+			self.sessions[info.clientId] = !info.cleanSession
+			refuse := self.refuse
+			self.lock.Unlock()
+			ack := packet{packetType: packetConnAck, body: []byte{0, refuse}}
+			if sessionPresent && refuse == 0 {
+				ack.body[0] = 1
+			}
+			write(ack)
+			if refuse != 0 {
+				return
+			}
+		case packetPublish:
+			msg := publishedMessage{qos: p.flags >> 1 & 0x03, retain: p.flags&0x01 != 0, dup: p.flags&0x08 != 0}
+			var rest []byte
+			msg.topic, rest = readString(p.body)
+			if msg.qos > 0 {
+				msg.packetId = binary.BigEndian.Uint16(rest)
+				rest = rest[2:]
+			}
+			msg.payload = rest
+			self.lock.Lock()
+			self.messages = append(self.messages, msg)
+			drop := self.dropPublishes > 0
+			if drop {
+				self.dropPublishes--
+			}
+			noAcks := self.noAcks
+			self.lock.Unlock()
+			if drop {
+				return
+			}
+			if msg.qos > 0 && !noAcks {
+				write(packet{packetType: packetPubAck, body: appendUint16(nil, msg.packetId)})
+			}
+		case packetPingReq:
+			self.lock.Lock()
+			self.pings++
+			self.lock.Unlock()
+			write(packet{packetType: packetPingResp})
+		case packetDisconnect:
+			return
+		}
+	}
+}
+
+func TestPacketEncoding(t *testing.T) {
+	for _, size := range []int{0, 127, 128, 16383, 16384, 2097152} {
+		p := packet{packetType: packetPublish, flags: 0x03, body: bytes.Repeat([]byte{'x'}, size)}
+		b, err := p.encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := readPacket(bufio.NewReader(bytes.NewReader(b)))
+		if err != nil {
+			t.Fatalf("body of %d bytes: %v", size, err)
+		}
+		if got.packetType != p.packetType || got.flags != p.flags || !bytes.Equal(got.body, p.body) {
+			t.Errorf("body of %d bytes: decoded %d %d with %d bytes", size, got.packetType, got.flags, len(got.body))
+		}
+	}
+	b, _ := packet{packetType: packetPubAck, body: []byte{0x12, 0x34}}.encode()
+	if !bytes.Equal(b, []byte{0x40, 2, 0x12, 0x34}) {
+		t.Errorf("unexpected PUBACK % x", b)
+	}
+	if _, err := readPacket(bufio.NewReader(bytes.NewReader([]byte{0x30, 0xff, 0xff, 0xff, 0xff, 0x01}))); err == nil {
+		t.Error("expected an error for a remaining length of 5 bytes")
+	}
+}
+
+func TestDial(t *testing.T) {
+	broker := newFakeBroker(t)
+	defer broker.close()
+
+	c, err := dial(dialOptions{broker: broker.url(), clientId: "cadvisor-host-1", username: "user", password: "secret", keepAlive: 30 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.sessionPresent {
+		t.Error("expected no session on the first connection")
+	}
+	c.disconnect()
+	expected := connectInfo{clientId: "cadvisor-host-1", username: "user", password: "secret", keepAlive: 30}
+	if connect := broker.connected()[0]; connect != expected {
+		t.Errorf("expected CONNECT %+v, got %+v", expected, connect)
+	}
+
+	// The session is kept by the broker.
+	c, err = dial(dialOptions{broker: broker.url(), clientId: "cadvisor-host-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.disconnect()
+	if !c.sessionPresent {
+		t.Error("expected the session to be present on reconnecting")
+	}
+}
+
+func TestDialRefused(t *testing.T) {
+	broker := newFakeBroker(t, func(s *fakeBroker) { s.refuse = 5 })
+	defer broker.close()
+
+	if _, err := dial(dialOptions{broker: broker.url(), clientId: "cadvisor"}); err == nil || !strings.Contains(err.Error(), "not authorized") {
+		t.Errorf("expected the connection to be refused, got %v", err)
+	}
+	if _, err := dial(dialOptions{broker: "http://" + broker.listener.Addr().String()}); err == nil {
+		t.Error("expected an error for an http URL")
+	}
+}
+
+func TestDialTLSClientCertificate(t *testing.T) {
+	// The certificate of an httptest TLS server is valid for 127.0.0.1,
+	// and is used by the client too, though only for server authentication
+	// so the broker does not verify it.
+	https := httptest.NewTLSServer(http.NotFoundHandler())
+	defer https.Close()
+	cert, err := x509.ParseCertificate(https.TLS.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	broker := newFakeBroker(t, func(s *fakeBroker) {
+		s.tls = &tls.Config{Certificates: https.TLS.Certificates, ClientAuth: tls.RequireAnyClientCert}
+	})
+	defer broker.close()
+	url := "ssl://" + broker.listener.Addr().String()
+
+	if _, err := dial(dialOptions{broker: url, tlsConfig: &tls.Config{RootCAs: pool}}); err == nil {
+		t.Error("expected the connection without a client certificate to fail")
+	}
+	c, err := dial(dialOptions{broker: url, clientId: "cadvisor", tlsConfig: &tls.Config{RootCAs: pool, Certificates: https.TLS.Certificates}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.disconnect()
+	if err := c.publish("a/b", []byte("hello"), 1, false, false, 1, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if msg := broker.published()[0]; msg.topic != "a/b" || string(msg.payload) != "hello" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+}
+
+func TestPublishAck(t *testing.T) {
+	broker := newFakeBroker(t)
+	defer broker.close()
+	c, err := dial(dialOptions{broker: broker.url(), clientId: "cadvisor"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.disconnect()
+
+	if err := c.publish("a/b", []byte("hello"), 1, true, true, 7, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	expected := publishedMessage{topic: "a/b", payload: []byte("hello"), qos: 1, retain: true, dup: true, packetId: 7}
+	if msg := broker.published()[0]; msg.topic != expected.topic || !bytes.Equal(msg.payload, expected.payload) ||
+		msg.qos != 1 || !msg.retain || !msg.dup || msg.packetId != 7 {
+		t.Errorf("expected message %+v, got %+v", expected, msg)
+	}
+
+	broker.lock.Lock()
+	broker.noAcks = true
+	broker.lock.Unlock()
+	if err := c.publish("a/b", []byte("hello"), 1, false, false, 8, 10*time.Millisecond); err == nil {
+		t.Error("expected a timeout without acknowledgement")
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	broker := newFakeBroker(t)
+	defer broker.close()
+	c, err := dial(dialOptions{broker: broker.url(), clientId: "cadvisor", keepAlive: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.disconnect()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for broker.pinged() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the pings")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := c.failed(); err != nil {
+		t.Errorf("expected the connection to be alive, got %v", err)
+	}
+}
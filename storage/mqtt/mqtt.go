@@ -0,0 +1,457 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mqtt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+	"github.com/google/cadvisor/utils/container"
+
+	"github.com/golang/glog"
+)
+
+func init() {
+	storage.RegisterStorageDriver("mqtt", new)
+}
+
+var (
+	argBroker             = flag.String("storage_driver_mqtt_broker", "tcp://localhost:1883", "URL of the MQTT broker, tcp://host:port, or ssl://host:port for TLS")
+	argTopic              = flag.String("storage_driver_mqtt_topic", "cadvisor/{machine}/{container}", "topic the stats are published to, where {machine} and {container} are replaced with the machine and the container name")
+	argQoS                = flag.Int("storage_driver_mqtt_qos", 0, "QoS of the messages, 0 for at most once or 1 for at least once delivery")
+	argRetain             = flag.Bool("storage_driver_mqtt_retain", false, "publish retained messages, so that the broker keeps the latest stats of every container for new subscribers")
+	argGzip               = flag.Bool("storage_driver_mqtt_gzip", false, "compress the JSON of the messages with gzip")
+	argClientId           = flag.String("storage_driver_mqtt_client_id", "", "client identifier of cAdvisor, which the broker keeps the session of; default is cadvisor-<hostname>")
+	argUsername           = flag.String("storage_driver_mqtt_username", "", "user name authenticating to the MQTT broker")
+	argPassword           = flag.String("storage_driver_mqtt_password", "", "password authenticating to the MQTT broker")
+	argCaFile             = flag.String("storage_driver_mqtt_ssl_ca", "", "optional certificate authority file used to verify the MQTT broker certificate")
+	argCertFile           = flag.String("storage_driver_mqtt_ssl_cert", "", "optional certificate file for MQTT TLS client authentication")
+	argKeyFile            = flag.String("storage_driver_mqtt_ssl_key", "", "optional key file for MQTT TLS client authentication")
+	argInsecureSkipVerify = flag.Bool("storage_driver_mqtt_ssl_insecure_skip_verify", false, "do not verify the MQTT broker certificate chain and host name")
+	argKeepAlive          = flag.Duration("storage_driver_mqtt_keepalive", 30*time.Second, "interval of the pings keeping the connection to the MQTT broker alive")
+	argAckTimeout         = flag.Duration("storage_driver_mqtt_ack_timeout", 5*time.Second, "time to wait for the broker to acknowledge a message of QoS 1")
+	argMaxPending         = flag.Int("storage_driver_mqtt_max_pending", 100, "maximum number of messages waiting to be published, the oldest being dropped when more are added")
+	argDrainTimeout       = flag.Duration("storage_driver_mqtt_drain_timeout", 5*time.Second, "time to wait on shutdown for the pending messages to be published")
+)
+
+const (
+	// Number of attempts at publishing a message while connected.
+	maxPublishAttempts = 3
+	// Backoff before reconnecting after an error, doubled after every
+	// consecutive error up to maxBackoff.
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 30 * time.Second
+	// Minimum time between the logs of the publish errors.
+	errorLogInterval = time.Minute
+)
+
+// detailSpec is the JSON of a message, the same as of the Kafka driver but
+// for the timestamp, which is the time of the stats.
+type detailSpec struct {
+	Timestamp       time.Time            `json:"timestamp"`
+	MachineName     string               `json:"machine_name,omitempty"`
+	ContainerName   string               `json:"container_Name,omitempty"`
+	ContainerID     string               `json:"container_Id,omitempty"`
+	ContainerLabels map[string]string    `json:"container_labels,omitempty"`
+	ContainerStats  *info.ContainerStats `json:"container_stats,omitempty"`
+}
+
+type message struct {
+	topic   string
+	payload []byte
+	// Packet ID of the message of QoS 1, kept when publishing it again.
+	packetId uint16
+	// Whether the message was sent already, and must be marked as a
+	// duplicate when sent again.
+	sent bool
+}
+
+type mqttStorage struct {
+	machineName string
+	topic       string
+	qos         byte
+	retain      bool
+	gzip        bool
+	ackTimeout  time.Duration
+	options     dialOptions
+
+	queue        chan *message
+	done         chan struct{}
+	stop         chan struct{}
+	drainTimeout time.Duration
+
+	// Used by the publishing goroutine only.
+	conn         *conn
+	lastPacketId uint16
+	failures     int
+	nextDial     time.Time
+	backoff      time.Duration
+
+	// Counts of the messages published, failed to be published, and
+	// dropped because the queue was full.
+	published uint64
+	failed    uint64
+	dropped   uint64
+	// Counts when the errors were last logged, and the last error.
+	logLock      sync.Mutex
+	lastLog      time.Time
+	lastErr      error
+	loggedFailed uint64
+	loggedDrop   uint64
+}
+
+func new() (storage.StorageDriver, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	options := dialOptions{
+		broker:    *argBroker,
+		clientId:  *argClientId,
+		username:  *argUsername,
+		password:  *argPassword,
+		keepAlive: *argKeepAlive,
+	}
+	if options.clientId == "" {
+		options.clientId = "cadvisor-" + hostname
+	}
+	if options.tlsConfig, err = generateTLSConfig(*argCaFile, *argCertFile, *argKeyFile, *argInsecureSkipVerify); err != nil {
+		return nil, err
+	}
+	return newStorage(config{
+		machineName:  hostname,
+		topic:        *argTopic,
+		options:      options,
+		qos:          *argQoS,
+		retain:       *argRetain,
+		gzip:         *argGzip,
+		ackTimeout:   *argAckTimeout,
+		maxPending:   *argMaxPending,
+		drainTimeout: *argDrainTimeout,
+	})
+}
+
+// generateTLSConfig returns the TLS configuration of the connection, or nil
+// if no TLS option is set.
+func generateTLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	if caFile == "" && certFile == "" && keyFile == "" && !insecureSkipVerify {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	if caFile != "" {
+		caCert, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificate found in %q", caFile)
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Replaces the characters which would split a topic level, or are
+// wildcards, so that a name is a single level, e.g. docker_web of
+// /docker/web.
+var levelReplacer = strings.NewReplacer(
+	"/", "_",
+	"+", "_",
+	"#", "_",
+	"\x00", "_",
+)
+
+func topicLevel(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if name == "" {
+		return "root"
+	}
+	return levelReplacer.Replace(name)
+}
+
+// topicOf returns the topic of the messages of a container.
+func (self *mqttStorage) topicOf(containerName string) string {
+	return strings.NewReplacer(
+		"{machine}", topicLevel(self.machineName),
+		"{container}", topicLevel(containerName),
+	).Replace(self.topic)
+}
+
+func (self *mqttStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	if stats == nil {
+		return nil
+	}
+	containerName := container.GetPreferredName(ref)
+	payload, err := json.Marshal(&detailSpec{
+		Timestamp:       stats.Timestamp,
+		MachineName:     self.machineName,
+		ContainerName:   containerName,
+		ContainerID:     ref.Id,
+		ContainerLabels: ref.Labels,
+		ContainerStats:  stats,
+	})
+	if err != nil {
+		return err
+	}
+	if self.gzip {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(payload); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		payload = buf.Bytes()
+	}
+	self.enqueue(&message{topic: self.topicOf(containerName), payload: payload})
+	return nil
+}
+
+// enqueue queues a message, dropping the oldest queued message if the
+// queue is full.
+func (self *mqttStorage) enqueue(msg *message) {
+	for {
+		select {
+		case self.queue <- msg:
+			return
+		default:
+		}
+		select {
+		case <-self.queue:
+			atomic.AddUint64(&self.dropped, 1)
+			self.logErrors(false)
+		default:
+		}
+	}
+}
+
+// run publishes the queued messages, until the queue is closed and empty,
+// or stop is closed.
+func (self *mqttStorage) run() {
+	defer close(self.done)
+	for msg := range self.queue {
+		if err := self.publish(msg); err != nil {
+			atomic.AddUint64(&self.failed, 1)
+			self.logLock.Lock()
+			self.lastErr = err
+			self.logLock.Unlock()
+			self.logErrors(false)
+		} else {
+			atomic.AddUint64(&self.published, 1)
+		}
+		if self.stopped() {
+			return
+		}
+	}
+}
+
+// publish publishes a message, reconnecting as long as needed. While
+// disconnected, the following messages wait in the queue. A message of QoS
+// 1 is published again, as a duplicate with the same packet ID, until the
+// broker acknowledges it.
+func (self *mqttStorage) publish(msg *message) error {
+	if self.qos > 0 && msg.packetId == 0 {
+		self.lastPacketId++
+		if self.lastPacketId == 0 {
+			self.lastPacketId++
+		}
+		msg.packetId = self.lastPacketId
+	}
+	var err error
+	for attempt := 0; attempt < maxPublishAttempts; {
+		if err = self.connect(); err != nil {
+			if self.stopped() {
+				break
+			}
+			continue
+		}
+		err = self.conn.publish(msg.topic, msg.payload, self.qos, self.retain, msg.sent, msg.packetId, self.ackTimeout)
+		if self.qos > 0 {
+			msg.sent = true
+		}
+		if err == nil {
+			self.failures = 0
+			return nil
+		}
+		if self.conn.failed() != nil {
+			self.conn = nil
+		}
+		attempt++
+		if self.stopped() {
+			break
+		}
+	}
+	return fmt.Errorf("failed to publish to %q - %v", msg.topic, err)
+}
+
+func (self *mqttStorage) stopped() bool {
+	select {
+	case <-self.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// connect connects to the MQTT broker if not connected, backing off after
+// errors, waiting for the backoff unless stopped.
+func (self *mqttStorage) connect() error {
+	if self.conn != nil {
+		return nil
+	}
+	if wait := self.nextDial.Sub(time.Now()); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-self.stop:
+			return fmt.Errorf("not connected to the MQTT broker")
+		}
+	}
+	c, err := dial(self.options)
+	if err != nil {
+		backoff := self.backoff << uint(self.failures)
+		if backoff > maxBackoff || backoff <= 0 {
+			backoff = maxBackoff
+		}
+		self.failures++
+		self.nextDial = time.Now().Add(backoff)
+		return fmt.Errorf("failed to connect to the MQTT broker %q - %v", self.options.broker, err)
+	}
+	if self.failures > 0 {
+		glog.Infof("MQTT: reconnected to %q, session present: %t", self.options.broker, c.sessionPresent)
+	}
+	self.conn = c
+	return nil
+}
+
+// logErrors logs the counts of the messages failed and dropped since the
+// last log, at most every errorLogInterval unless forced.
+func (self *mqttStorage) logErrors(force bool) {
+	self.logLock.Lock()
+	defer self.logLock.Unlock()
+	if !force && time.Since(self.lastLog) < errorLogInterval {
+		return
+	}
+	failed, dropped := atomic.LoadUint64(&self.failed), atomic.LoadUint64(&self.dropped)
+	if failed == self.loggedFailed && dropped == self.loggedDrop {
+		return
+	}
+	glog.Errorf("MQTT: %d messages failed to be published and %d were dropped because %d were pending, last error: %v",
+		failed-self.loggedFailed, dropped-self.loggedDrop, cap(self.queue), self.lastErr)
+	self.lastLog = time.Now()
+	self.loggedFailed, self.loggedDrop = failed, dropped
+}
+
+// Close publishes the pending messages, waiting for them at most the drain
+// timeout, and disconnects.
+func (self *mqttStorage) Close() error {
+	close(self.queue)
+	timer := time.NewTimer(self.drainTimeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-self.done:
+	case <-timer.C:
+		close(self.stop)
+		<-self.done
+		err = fmt.Errorf("MQTT: %d messages were not published within %s", len(self.queue), self.drainTimeout)
+	}
+	if self.conn != nil {
+		self.conn.disconnect()
+	}
+	self.logErrors(true)
+	return err
+}
+
+// config is the configuration of the driver, populated from the flags.
+type config struct {
+	// A unique identifier to identify the host that current cAdvisor
+	// instance is running on.
+	machineName string
+	// The template of the topic of the messages.
+	topic string
+	// How to connect and authenticate to the MQTT broker.
+	options dialOptions
+	// The QoS of the messages, 0 or 1.
+	qos int
+	// Whether the messages are retained by the broker.
+	retain bool
+	// Whether to compress the messages with gzip.
+	gzip bool
+	// The time to wait for the broker to acknowledge a message.
+	ackTimeout time.Duration
+	// The maximum number of messages waiting to be published.
+	maxPending int
+	// The time to wait on Close for the pending messages.
+	drainTimeout time.Duration
+}
+
+// Create a new MQTT storage driver.
+func newStorage(cfg config) (*mqttStorage, error) {
+	if cfg.topic == "" || strings.ContainsAny(cfg.topic, "+#\x00") {
+		return nil, fmt.Errorf("invalid MQTT topic %q", cfg.topic)
+	}
+	if cfg.qos != 0 && cfg.qos != 1 {
+		return nil, fmt.Errorf("the MQTT QoS must be 0 or 1, got %d", cfg.qos)
+	}
+	if cfg.maxPending <= 0 {
+		return nil, fmt.Errorf("the maximum number of pending MQTT messages must be positive, got %d", cfg.maxPending)
+	}
+	if _, _, err := brokerAddress(cfg.options.broker); err != nil {
+		return nil, err
+	}
+	ret := &mqttStorage{
+		machineName:  cfg.machineName,
+		topic:        cfg.topic,
+		qos:          byte(cfg.qos),
+		retain:       cfg.retain,
+		gzip:         cfg.gzip,
+		ackTimeout:   cfg.ackTimeout,
+		options:      cfg.options,
+		queue:        make(chan *message, cfg.maxPending),
+		done:         make(chan struct{}),
+		stop:         make(chan struct{}),
+		drainTimeout: cfg.drainTimeout,
+		backoff:      minBackoff,
+	}
+	// The broker may not be reachable yet on an edge device, the messages
+	// are queued until it is.
+	if err := ret.connect(); err != nil {
+		glog.Warningf("MQTT: %v, retrying in the background", err)
+	}
+	go ret.run()
+	return ret, nil
+}
@@ -0,0 +1,280 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mqtt
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+var (
+	testRef = info.ContainerReference{
+		Name:    "/docker/abc",
+		Id:      "abc",
+		Aliases: []string{"web.1", "abc"},
+		Labels:  map[string]string{"app": "shop"},
+	}
+	testStats = &info.ContainerStats{
+		Timestamp: time.Unix(1451606400, 0).UTC(),
+		Memory:    info.MemoryStats{Usage: 4096},
+	}
+)
+
+// testConfig returns the configuration of a driver publishing to broker.
+func testConfig(broker string) config {
+	return config{
+		machineName:  "host-1",
+		topic:        "cadvisor",
+		options:      dialOptions{broker: broker},
+		ackTimeout:   time.Second,
+		maxPending:   10,
+		drainTimeout: time.Second,
+	}
+}
+
+func newTestStorage(t *testing.T, broker string, qos int, retain, gzip bool, maxPending int) *mqttStorage {
+	cfg := testConfig(broker)
+	cfg.topic = "cadvisor/{machine}/{container}"
+	cfg.options.clientId = "cadvisor-host-1"
+	cfg.qos = qos
+	cfg.retain = retain
+	cfg.gzip = gzip
+	cfg.ackTimeout = 50 * time.Millisecond
+	cfg.maxPending = maxPending
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.backoff = time.Millisecond
+	return driver
+}
+
+func TestTopic(t *testing.T) {
+	driver := &mqttStorage{machineName: "host-1", topic: "cadvisor/{machine}/{container}/stats"}
+	for name, expected := range map[string]string{
+		"/":            "cadvisor/host-1/root/stats",
+		"/docker/abc":  "cadvisor/host-1/docker_abc/stats",
+		"web.1":        "cadvisor/host-1/web.1/stats",
+		"a+b#c":        "cadvisor/host-1/a_b_c/stats",
+		"my container": "cadvisor/host-1/my container/stats",
+	} {
+		if got := driver.topicOf(name); got != expected {
+			t.Errorf("topic of %q: expected %q, got %q", name, expected, got)
+		}
+	}
+}
+
+func decodeMessage(t *testing.T, payload []byte) detailSpec {
+	var detail detailSpec
+	if err := json.Unmarshal(payload, &detail); err != nil {
+		t.Fatal(err)
+	}
+	return detail
+}
+
+func TestPublish(t *testing.T) {
+	broker := newFakeBroker(t)
+	defer broker.close()
+	driver := newTestStorage(t, broker.url(), 0, false, false, 10)
+
+	if err := driver.AddStats(testRef, testStats); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return len(broker.published()) == 1 })
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	msg := broker.published()[0]
+	if msg.topic != "cadvisor/host-1/web.1" || msg.qos != 0 || msg.retain || msg.dup {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	detail := decodeMessage(t, msg.payload)
+	if detail.MachineName != "host-1" || detail.ContainerName != "web.1" || detail.ContainerID != "abc" ||
+		detail.ContainerLabels["app"] != "shop" || !detail.Timestamp.Equal(testStats.Timestamp) || detail.ContainerStats.Memory.Usage != 4096 {
+		t.Errorf("unexpected message %s", msg.payload)
+	}
+	if connect := broker.connected()[0]; connect.clientId != "cadvisor-host-1" || connect.cleanSession {
+		t.Errorf("expected a persistent session, got %+v", connect)
+	}
+}
+
+func TestPublishGzipRetained(t *testing.T) {
+	broker := newFakeBroker(t)
+	defer broker.close()
+	driver := newTestStorage(t, broker.url(), 1, true, true, 10)
+
+	driver.AddStats(testRef, testStats)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	msg := broker.published()[0]
+	if msg.qos != 1 || !msg.retain || msg.packetId == 0 {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(msg.payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detail := decodeMessage(t, payload); detail.ContainerName != "web.1" {
+		t.Errorf("unexpected message %s", payload)
+	}
+}
+
+func TestReconnectResumesSession(t *testing.T) {
+	// The connection is closed instead of acknowledging the first message.
+	broker := newFakeBroker(t, func(s *fakeBroker) { s.dropPublishes = 1 })
+	defer broker.close()
+	driver := newTestStorage(t, broker.url(), 1, false, false, 10)
+
+	driver.AddStats(testRef, testStats)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	connects := broker.connected()
+	if len(connects) != 2 {
+		t.Fatalf("expected 2 connections, got %d", len(connects))
+	}
+	// Published again as a duplicate, with the same packet ID, in the
+	// session kept by the broker.
+	messages := broker.published()
+	if len(messages) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(messages))
+	}
+	if messages[0].dup || !messages[1].dup || messages[0].packetId != messages[1].packetId {
+		t.Errorf("expected the message to be published again as a duplicate, got %+v and %+v", messages[0], messages[1])
+	}
+	if published, failed := atomic.LoadUint64(&driver.published), atomic.LoadUint64(&driver.failed); published != 1 || failed != 0 {
+		t.Errorf("expected 1 message published and none failed, got %d and %d", published, failed)
+	}
+}
+
+func TestQueueOverflow(t *testing.T) {
+	// The queue is not consumed.
+	driver := &mqttStorage{queue: make(chan *message, 2), topic: "cadvisor/{container}"}
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		if err := driver.AddStats(info.ContainerReference{Name: name}, testStats); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if dropped := atomic.LoadUint64(&driver.dropped); dropped != 3 {
+		t.Errorf("expected 3 dropped messages, got %d", dropped)
+	}
+	// The oldest messages are dropped.
+	if first, second := <-driver.queue, <-driver.queue; first.topic != "cadvisor/d" || second.topic != "cadvisor/e" {
+		t.Errorf("expected the latest messages to be kept, got %q and %q", first.topic, second.topic)
+	}
+}
+
+func TestQueueWhileDisconnected(t *testing.T) {
+	// Reserves an address the broker listens on later.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	driver := newTestStorage(t, "tcp://"+addr, 1, false, false, 2)
+
+	ref := func(name string) info.ContainerReference { return info.ContainerReference{Name: name} }
+	driver.AddStats(ref("a"), testStats)
+	// Waits for the publisher to hold the first message, until connected.
+	waitFor(t, func() bool { return len(driver.queue) == 0 })
+	for _, name := range []string{"b", "c", "d", "e"} {
+		driver.AddStats(ref(name), testStats)
+	}
+	if dropped := atomic.LoadUint64(&driver.dropped); dropped != 2 {
+		t.Errorf("expected 2 dropped messages, got %d", dropped)
+	}
+
+	broker := newFakeBroker(t, func(s *fakeBroker) { s.addr = addr })
+	defer broker.close()
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var topics []string
+	for _, msg := range broker.published() {
+		topics = append(topics, msg.topic)
+	}
+	if strings.Join(topics, " ") != "cadvisor/host-1/a cadvisor/host-1/d cadvisor/host-1/e" {
+		t.Errorf("expected the first and the latest messages to be published, got %v", topics)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	broker := newFakeBroker(t, func(s *fakeBroker) { s.noAcks = true })
+	defer broker.close()
+	cfg := testConfig(broker.url())
+	cfg.qos = 1
+	cfg.ackTimeout = 20 * time.Millisecond
+	cfg.drainTimeout = 30 * time.Millisecond
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		driver.AddStats(testRef, testStats)
+	}
+	start := time.Now()
+	err = driver.Close()
+	if err == nil || !strings.Contains(err.Error(), "not published") {
+		t.Errorf("expected the pending messages to be reported, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected Close to return after the drain timeout, took %v", elapsed)
+	}
+}
+
+func TestNewStorageValidation(t *testing.T) {
+	broker := newFakeBroker(t)
+	defer broker.close()
+	for _, topic := range []string{"", "cadvisor/+", "cadvisor/#"} {
+		cfg := testConfig(broker.url())
+		cfg.topic = topic
+		if _, err := newStorage(cfg); err == nil {
+			t.Errorf("expected an error for the topic %q", topic)
+		}
+	}
+	cfg := testConfig(broker.url())
+	cfg.qos = 2
+	if _, err := newStorage(cfg); err == nil {
+		t.Error("expected an error for a QoS of 2")
+	}
+	if _, err := newStorage(testConfig("http://" + broker.listener.Addr().String())); err == nil {
+		t.Error("expected an error for an http URL")
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
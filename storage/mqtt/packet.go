@@ -0,0 +1,171 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Types of the MQTT 3.1.1 control packets, in the high nibble of their
+// first byte.
+const (
+	packetConnect    = 1
+	packetConnAck    = 2
+	packetPublish    = 3
+	packetPubAck     = 4
+	packetPingReq    = 12
+	packetPingResp   = 13
+	packetDisconnect = 14
+)
+
+// Flags of the CONNECT packet.
+const (
+	connectCleanSession = 0x02
+	connectPassword     = 0x40
+	connectUsername     = 0x80
+)
+
+// Maximum remaining length of a packet, encoded in 4 bytes.
+const maxRemainingLength = 268435455
+
+// Return codes of the CONNACK packet, but 0 which accepts the connection.
+var connAckErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// packet is a control packet, its type and flags, and the bytes following
+// its fixed header.
+type packet struct {
+	packetType byte
+	flags      byte
+	body       []byte
+}
+
+func (self packet) encode() ([]byte, error) {
+	if len(self.body) > maxRemainingLength {
+		return nil, fmt.Errorf("MQTT packet of %d bytes is too large", len(self.body))
+	}
+	b := []byte{self.packetType<<4 | self.flags}
+	// The remaining length, 7 bits per byte, the high bit set while more
+	// bytes follow.
+	n := len(self.body)
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		b = append(b, digit)
+		if n == 0 {
+			break
+		}
+	}
+	return append(b, self.body...), nil
+}
+
+func readPacket(r *bufio.Reader) (packet, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return packet{}, errors.New("malformed MQTT remaining length")
+		}
+		digit, err := r.ReadByte()
+		if err != nil {
+			return packet{}, err
+		}
+		length += int(digit&0x7f) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+	return packet{packetType: first >> 4, flags: first & 0x0f, body: body}, nil
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func appendUint16(b []byte, n uint16) []byte {
+	return append(b, byte(n>>8), byte(n))
+}
+
+// connectPacket returns the CONNECT of a client. The session of the client
+// is kept by the broker across connections unless cleanSession is set.
+func connectPacket(clientId, username, password string, cleanSession bool, keepAlive uint16) packet {
+	var flags byte
+	if cleanSession {
+		flags |= connectCleanSession
+	}
+	if username != "" {
+		flags |= connectUsername
+		if password != "" {
+			flags |= connectPassword
+		}
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = appendUint16(body, keepAlive)
+	body = appendString(body, clientId)
+	if flags&connectUsername != 0 {
+		body = appendString(body, username)
+	}
+	if flags&connectPassword != 0 {
+		body = appendString(body, password)
+	}
+	return packet{packetType: packetConnect, body: body}
+}
+
+// publishPacket returns the PUBLISH of a message. The packet ID is only
+// written with a QoS of 1.
+func publishPacket(topic string, payload []byte, qos byte, retain, dup bool, packetId uint16) packet {
+	flags := qos << 1
+	if retain {
+		flags |= 0x01
+	}
+	if dup {
+		flags |= 0x08
+	}
+	body := appendString(make([]byte, 0, 2+len(topic)+2+len(payload)), topic)
+	if qos > 0 {
+		body = appendUint16(body, packetId)
+	}
+	return packet{packetType: packetPublish, flags: flags, body: append(body, payload...)}
+}
+
+// packetId returns the packet ID of a PUBACK.
+func (self packet) packetId() (uint16, error) {
+	if len(self.body) < 2 {
+		return 0, errors.New("malformed MQTT packet ID")
+	}
+	return binary.BigEndian.Uint16(self.body), nil
+}
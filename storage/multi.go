@@ -0,0 +1,181 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// namedDriver is a storage driver of a multiDriver, with the count of its
+// errors.
+type namedDriver struct {
+	name   string
+	driver StorageDriver
+	errors uint64
+}
+
+// multiDriver fans out the stats to several storage drivers.
+type multiDriver struct {
+	drivers []*namedDriver
+}
+
+// NewMulti creates the storage drivers of a comma-separated list of names.
+// It returns nil if the list is empty, the driver if there is a single one,
+// and otherwise a driver adding the stats to all of them.
+func NewMulti(names string) (StorageDriver, error) {
+	var drivers []*namedDriver
+	seen := map[string]bool{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			closeDrivers(drivers)
+			return nil, fmt.Errorf("backend storage driver %s is listed twice", name)
+		}
+		seen[name] = true
+		driver, err := New(name)
+		if err != nil {
+			closeDrivers(drivers)
+			return nil, fmt.Errorf("failed to create backend storage driver %s - %v", name, err)
+		}
+		drivers = append(drivers, &namedDriver{name: name, driver: driver})
+	}
+	switch len(drivers) {
+	case 0:
+		return nil, nil
+	case 1:
+		return drivers[0].driver, nil
+	}
+	multi := &multiDriver{drivers: drivers}
+	for _, d := range drivers {
+		if _, ok := d.driver.(BulkStorageDriver); ok {
+			return &bulkMultiDriver{multi}, nil
+		}
+	}
+	return multi, nil
+}
+
+// closeDrivers closes the drivers created before one failed to be.
+func closeDrivers(drivers []*namedDriver) {
+	for _, d := range drivers {
+		d.driver.Close()
+	}
+}
+
+// AddStats adds the stats to every driver, even if some of them fail. The
+// errors are returned along with the names of their drivers and their
+// count of errors.
+func (self *multiDriver) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	return self.fanOut(func(driver StorageDriver) (int, error) {
+		return 1, driver.AddStats(ref, stats)
+	})
+}
+
+// fanOut calls add with every driver at the same time, so that a slow
+// driver does not hold back the others, and waits for all of them. add
+// returns the count of the stats the driver failed to add, which increases
+// its count of errors.
+func (self *multiDriver) fanOut(add func(driver StorageDriver) (int, error)) error {
+	errs := make([]string, len(self.drivers))
+	var wg sync.WaitGroup
+	for i, d := range self.drivers {
+		wg.Add(1)
+		go func(i int, d *namedDriver) {
+			defer wg.Done()
+			if failed, err := add(d.driver); err != nil {
+				errors := atomic.AddUint64(&d.errors, uint64(failed))
+				errs[i] = fmt.Sprintf("backend storage driver %s (%d errors): %v", d.name, errors, err)
+			}
+		}(i, d)
+	}
+	wg.Wait()
+	var failed []string
+	for _, err := range errs {
+		if err != "" {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// bulkMultiDriver is a multiDriver of which some drivers are
+// BulkStorageDriver. The drivers which are not get the stats of the batches
+// one at a time.
+type bulkMultiDriver struct {
+	*multiDriver
+}
+
+// AddStatsBatch adds the batch to every driver, at once to the ones which
+// are BulkStorageDriver, even if some of them fail. The count of the errors
+// of a driver is increased by the count of the stats it failed to add.
+func (self *bulkMultiDriver) AddStatsBatch(batch []ContainerStatsPair) error {
+	return self.fanOut(func(driver StorageDriver) (int, error) {
+		return addStatsBatch(driver, batch)
+	})
+}
+
+// Close closes every driver, even if some of them fail.
+func (self *multiDriver) Close() error {
+	var errs []string
+	for _, d := range self.drivers {
+		if err := d.driver.Close(); err != nil {
+			errs = append(errs, fmt.Sprintf("backend storage driver %s: %v", d.name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// ErrorCounts returns the count of the errors of every driver, by name, to
+// see which one is misbehaving.
+func (self *multiDriver) ErrorCounts() map[string]uint64 {
+	ret := make(map[string]uint64, len(self.drivers))
+	for _, d := range self.drivers {
+		ret[d.name] = atomic.LoadUint64(&d.errors)
+	}
+	return ret
+}
+
+// SetMachineInfoSource sets the source of the drivers consuming the
+// machine information.
+func (self *multiDriver) SetMachineInfoSource(source MachineInfoSource) {
+	for _, d := range self.drivers {
+		if consumer, ok := d.driver.(MachineInfoConsumer); ok {
+			consumer.SetMachineInfoSource(source)
+		}
+	}
+}
+
+// SetContainerSpecSource sets the source of the drivers consuming the
+// container specifications.
+func (self *multiDriver) SetContainerSpecSource(source ContainerSpecSource) {
+	for _, d := range self.drivers {
+		if consumer, ok := d.driver.(ContainerSpecConsumer); ok {
+			consumer.SetContainerSpecSource(source)
+		}
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/info/v2"
+)
+
+// fakeDriver records the stats added, failing if fail is set.
+type fakeDriver struct {
+	lock   sync.Mutex
+	stats  []*info.ContainerStats
+	fail   bool
+	closed bool
+	source MachineInfoSource
+}
+
+func (self *fakeDriver) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.fail {
+		return fmt.Errorf("unavailable")
+	}
+	self.stats = append(self.stats, stats)
+	return nil
+}
+
+func (self *fakeDriver) Close() error {
+	self.closed = true
+	if self.fail {
+		return fmt.Errorf("failed to flush")
+	}
+	return nil
+}
+
+// fakeConsumer is a fakeDriver consuming the machine information.
+type fakeConsumer struct {
+	fakeDriver
+}
+
+func (self *fakeConsumer) SetMachineInfoSource(source MachineInfoSource) {
+	self.source = source
+}
+
+type fakeSource struct{}
+
+func (fakeSource) GetMachineInfo() (*info.MachineInfo, error)  { return nil, nil }
+func (fakeSource) GetVersionInfo() (*info.VersionInfo, error)  { return nil, nil }
+func (fakeSource) GetFsInfo(label string) ([]v2.FsInfo, error) { return nil, nil }
+
+// registerFakeDrivers registers fake drivers named fake1 and fake2, and a
+// driver failing to be created named broken.
+func registerFakeDrivers() (*fakeDriver, *fakeConsumer) {
+	first, second := &fakeDriver{}, &fakeConsumer{}
+	RegisterStorageDriver("fake1", func() (StorageDriver, error) { return first, nil })
+	RegisterStorageDriver("fake2", func() (StorageDriver, error) { return second, nil })
+	RegisterStorageDriver("broken", func() (StorageDriver, error) { return nil, fmt.Errorf("no server") })
+	return first, second
+}
+
+func TestNewMulti(t *testing.T) {
+	first, _ := registerFakeDrivers()
+	if driver, err := NewMulti(" , "); driver != nil || err != nil {
+		t.Errorf("expected no driver, got %v and %v", driver, err)
+	}
+	if driver, err := NewMulti("fake1"); driver != first || err != nil {
+		t.Errorf("expected the single driver, got %v and %v", driver, err)
+	}
+	if _, err := NewMulti("fake1,fake1"); err == nil {
+		t.Error("expected an error for a driver listed twice")
+	}
+	if _, err := NewMulti("fake1,unknown"); err == nil || !first.closed {
+		t.Errorf("expected an error for an unknown driver, and the first driver closed, got %v", err)
+	}
+	if _, err := NewMulti("fake1,broken"); err == nil || !strings.Contains(err.Error(), "broken - no server") {
+		t.Errorf("expected an error for the driver failing to be created, got %v", err)
+	}
+}
+
+func TestMultiAddStats(t *testing.T) {
+	first, second := registerFakeDrivers()
+	driver, err := NewMulti("fake1, fake2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := info.ContainerReference{Name: "/a"}
+	var stats []*info.ContainerStats
+	for i := 0; i < 3; i++ {
+		stats = append(stats, &info.ContainerStats{Timestamp: time.Unix(int64(i), 0)})
+	}
+	if err := driver.AddStats(ref, stats[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first driver fails, the second one still gets the stats.
+	first.fail = true
+	for _, s := range stats[1:] {
+		err := driver.AddStats(ref, s)
+		if err == nil || !strings.Contains(err.Error(), "fake1") || strings.Contains(err.Error(), "fake2") {
+			t.Errorf("expected an error of fake1, got %v", err)
+		}
+	}
+	if err := driver.AddStats(ref, stats[2]); err == nil || !strings.Contains(err.Error(), "(3 errors)") {
+		t.Errorf("expected the count of the errors of fake1, got %v", err)
+	}
+	if len(first.stats) != 1 || len(second.stats) != 4 {
+		t.Errorf("expected 1 and 4 stats added, got %d and %d", len(first.stats), len(second.stats))
+	}
+	if counts := driver.(*multiDriver).ErrorCounts(); counts["fake1"] != 3 || counts["fake2"] != 0 {
+		t.Errorf("unexpected error counts %v", counts)
+	}
+
+	if err := driver.Close(); err == nil || !strings.Contains(err.Error(), "fake1: failed to flush") {
+		t.Errorf("expected the error of fake1, got %v", err)
+	}
+	if !first.closed || !second.closed {
+		t.Error("expected both drivers closed")
+	}
+}
+
+// barrierDriver adds the stats once every driver sharing its barrier is
+// adding them.
+type barrierDriver struct {
+	barrier *sync.WaitGroup
+}
+
+func (self *barrierDriver) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	self.barrier.Done()
+	self.barrier.Wait()
+	return nil
+}
+
+func (self *barrierDriver) Close() error {
+	return nil
+}
+
+func TestMultiAddStatsConcurrently(t *testing.T) {
+	barrier := &sync.WaitGroup{}
+	barrier.Add(2)
+	driver := &multiDriver{drivers: []*namedDriver{
+		{name: "a", driver: &barrierDriver{barrier}},
+		{name: "b", driver: &barrierDriver{barrier}},
+	}}
+	done := make(chan error, 1)
+	go func() {
+		done <- driver.AddStats(info.ContainerReference{Name: "/a"}, &info.ContainerStats{})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the drivers to add the stats at the same time")
+	}
+}
+
+func TestMultiConsumers(t *testing.T) {
+	_, second := registerFakeDrivers()
+	driver, err := NewMulti("fake1,fake2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumer, ok := driver.(MachineInfoConsumer)
+	if !ok {
+		t.Fatal("expected the driver to consume the machine information")
+	}
+	consumer.SetMachineInfoSource(fakeSource{})
+	if second.source == nil {
+		t.Error("expected the source set on the consuming driver")
+	}
+}
+
+// fakeBulkDriver is a fakeDriver adding batches of stats at once.
+type fakeBulkDriver struct {
+	fakeDriver
+	batches int
+}
+
+func (self *fakeBulkDriver) AddStatsBatch(batch []ContainerStatsPair) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.batches++
+	for _, pair := range batch {
+		self.stats = append(self.stats, pair.Stats)
+	}
+	return nil
+}
+
+func TestMultiAddStatsBatch(t *testing.T) {
+	first, second := registerFakeDrivers()
+	bulk := &fakeBulkDriver{}
+	RegisterStorageDriver("bulk", func() (StorageDriver, error) { return bulk, nil })
+	if driver, err := NewMulti("fake1,fake2"); err != nil {
+		t.Fatal(err)
+	} else if _, ok := driver.(BulkStorageDriver); ok {
+		t.Error("expected drivers which are not bulk not to get batches")
+	}
+	multi, err := NewMulti("fake1,bulk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver, ok := multi.(BulkStorageDriver)
+	if !ok {
+		t.Fatal("expected the driver to get batches")
+	}
+	var batch []ContainerStatsPair
+	for i := 0; i < 3; i++ {
+		batch = append(batch, ContainerStatsPair{
+			Ref:   info.ContainerReference{Name: fmt.Sprintf("/%d", i)},
+			Stats: &info.ContainerStats{Timestamp: time.Unix(int64(i), 0)},
+		})
+	}
+	if err := driver.AddStatsBatch(batch); err != nil {
+		t.Fatal(err)
+	}
+	if len(first.stats) != 3 || len(bulk.stats) != 3 || bulk.batches != 1 {
+		t.Errorf("expected 3 stats added to both drivers and a single batch, got %d, %d and %d batches", len(first.stats), len(bulk.stats), bulk.batches)
+	}
+
+	// The stats are added one at a time to the driver which is not bulk.
+	first.fail = true
+	err = driver.AddStatsBatch(batch)
+	if err == nil || !strings.Contains(err.Error(), "fake1 (3 errors)") || !strings.Contains(err.Error(), "3 of 3") {
+		t.Errorf("expected an error of fake1 for each of the stats of the batch, got %v", err)
+	}
+	if len(bulk.stats) != 6 {
+		t.Errorf("expected 6 stats added to the bulk driver, got %d", len(bulk.stats))
+	}
+	// A failed batch counts as many errors as the stats which failed.
+	if counts := multi.(*bulkMultiDriver).ErrorCounts(); counts["fake1"] != 3 || counts["bulk"] != 0 {
+		t.Errorf("unexpected error counts %v", counts)
+	}
+	if len(second.stats) != 0 {
+		t.Errorf("expected no stats added to the driver not listed, got %d", len(second.stats))
+	}
+}
@@ -0,0 +1,427 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/cadvisor/version"
+)
+
+const (
+	dialTimeout = 5 * time.Second
+	// Header of the deduplication ID of a JetStream message.
+	msgIdHeader = "Nats-Msg-Id"
+)
+
+var errNoResponders = errors.New("no JetStream stream for the subject")
+
+// serverInfo is the INFO a NATS server sends first.
+type serverInfo struct {
+	TLSRequired bool   `json:"tls_required"`
+	Headers     bool   `json:"headers"`
+	MaxPayload  int    `json:"max_payload"`
+	Nonce       string `json:"nonce"`
+}
+
+// connectOptions is the CONNECT a client answers the INFO with.
+type connectOptions struct {
+	Verbose      bool   `json:"verbose"`
+	Pedantic     bool   `json:"pedantic"`
+	TLSRequired  bool   `json:"tls_required"`
+	Name         string `json:"name"`
+	Lang         string `json:"lang"`
+	Version      string `json:"version"`
+	Protocol     int    `json:"protocol"`
+	Headers      bool   `json:"headers"`
+	NoResponders bool   `json:"no_responders"`
+	AuthToken    string `json:"auth_token,omitempty"`
+	User         string `json:"user,omitempty"`
+	Pass         string `json:"pass,omitempty"`
+	JWT          string `json:"jwt,omitempty"`
+	Sig          string `json:"sig,omitempty"`
+}
+
+// pubAck is the acknowledgement of a message published to JetStream.
+type pubAck struct {
+	Stream    string `json:"stream"`
+	Seq       uint64 `json:"seq"`
+	Duplicate bool   `json:"duplicate"`
+	Error     *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// dialOptions are how to connect and authenticate to the NATS server.
+type dialOptions struct {
+	url         string
+	tlsConfig   *tls.Config
+	token       string
+	credentials *userCredentials
+}
+
+// conn is a connection to a NATS server, speaking the subset of the client
+// protocol publishing messages, with the replies of JetStream received on
+// an inbox of the connection.
+type conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	info   serverInfo
+
+	writeLock sync.Mutex
+	writer    *bufio.Writer
+
+	// Inbox of the replies, and the replies waited for by subject.
+	inbox     string
+	lock      sync.Mutex
+	nextReply uint64
+	replies   map[string]chan []byte
+	// Receives the PONGs of the PINGs of flush.
+	pongs chan struct{}
+	// Set once the connection failed, and closed.
+	err    error
+	closed chan struct{}
+}
+
+// dial connects to a NATS server, and authenticates.
+func dial(options dialOptions) (*conn, error) {
+	u, err := url.Parse(options.url)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "nats" && u.Scheme != "tls" {
+		return nil, fmt.Errorf("invalid NATS URL %q, the scheme must be nats or tls", options.url)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	netConn, err := net.DialTimeout("tcp", host, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{
+		conn:    netConn,
+		reader:  bufio.NewReader(netConn),
+		replies: make(map[string]chan []byte),
+		pongs:   make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+	}
+	if err := c.handshake(u, options); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+func (self *conn) handshake(u *url.URL, options dialOptions) error {
+	self.conn.SetDeadline(time.Now().Add(dialTimeout))
+	defer self.conn.SetDeadline(time.Time{})
+	line, err := self.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected greeting %q of the NATS server", line)
+	}
+	if err := json.Unmarshal([]byte(line[len("INFO "):]), &self.info); err != nil {
+		return fmt.Errorf("invalid INFO of the NATS server - %v", err)
+	}
+
+	useTLS := options.tlsConfig != nil || u.Scheme == "tls" || self.info.TLSRequired
+	if useTLS {
+		tlsConfig := &tls.Config{}
+		if options.tlsConfig != nil {
+			tlsConfig = options.tlsConfig.Clone()
+		}
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = u.Hostname()
+		}
+		tlsConn := tls.Client(self.conn, tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			return fmt.Errorf("TLS handshake with the NATS server failed - %v", err)
+		}
+		self.conn = tlsConn
+		self.reader = bufio.NewReader(tlsConn)
+	}
+	self.writer = bufio.NewWriter(self.conn)
+
+	connect := connectOptions{
+		TLSRequired:  useTLS,
+		Name:         "cadvisor",
+		Lang:         "go",
+		Version:      version.Info["version"],
+		Protocol:     1,
+		Headers:      true,
+		NoResponders: true,
+		AuthToken:    options.token,
+	}
+	if u.User != nil {
+		connect.User = u.User.Username()
+		connect.Pass, _ = u.User.Password()
+	}
+	if options.credentials != nil {
+		connect.JWT = options.credentials.jwt
+		connect.Sig = options.credentials.sign(self.info.Nonce)
+	}
+	b, err := json.Marshal(connect)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(self.writer, "CONNECT %s\r\nPING\r\n", b)
+	if err := self.writer.Flush(); err != nil {
+		return err
+	}
+	// The PONG confirms the CONNECT was accepted.
+	for {
+		line, err := self.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("NATS server refused the connection: %s", strings.TrimSpace(line[len("-ERR"):]))
+		}
+	}
+}
+
+func (self *conn) readLine() (string, error) {
+	line, err := self.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readLoop answers the PINGs of the server, and dispatches the replies,
+// until the connection fails.
+func (self *conn) readLoop() {
+	var err error
+	for err == nil {
+		var line string
+		if line, err = self.readLine(); err != nil {
+			break
+		}
+		switch {
+		case line == "PING":
+			err = self.write([]byte("PONG\r\n"))
+		case line == "PONG":
+			select {
+			case self.pongs <- struct{}{}:
+			default:
+			}
+		case strings.HasPrefix(line, "MSG "), strings.HasPrefix(line, "HMSG "):
+			err = self.readMessage(line)
+		case strings.HasPrefix(line, "-ERR"):
+			err = fmt.Errorf("NATS server error: %s", strings.TrimSpace(line[len("-ERR"):]))
+		}
+	}
+	self.fail(err)
+}
+
+// readMessage reads the payload of a MSG or an HMSG, and passes it to the
+// publish waiting for it.
+func (self *conn) readMessage(line string) error {
+	args := strings.Fields(line)
+	headers := args[0] == "HMSG"
+	if (headers && len(args) < 5) || (!headers && len(args) < 4) {
+		return fmt.Errorf("invalid NATS message %q", line)
+	}
+	size, err := strconv.Atoi(args[len(args)-1])
+	if err != nil {
+		return fmt.Errorf("invalid NATS message %q", line)
+	}
+	headerSize := 0
+	if headers {
+		if headerSize, err = strconv.Atoi(args[len(args)-2]); err != nil || headerSize > size {
+			return fmt.Errorf("invalid NATS message %q", line)
+		}
+	}
+	payload := make([]byte, size+2)
+	if _, err := io.ReadFull(self.reader, payload); err != nil {
+		return err
+	}
+	payload = payload[:size]
+	if headers {
+		// A status without payload, e.g. 503 when no stream takes the
+		// subject, is passed on as nil.
+		header := payload[:headerSize]
+		payload = payload[headerSize:]
+		if len(payload) == 0 && bytes.HasPrefix(header, []byte("NATS/1.0 ")) {
+			payload = nil
+		}
+	}
+	self.lock.Lock()
+	reply, ok := self.replies[args[1]]
+	delete(self.replies, args[1])
+	self.lock.Unlock()
+	if ok {
+		reply <- payload
+	}
+	return nil
+}
+
+func (self *conn) write(b []byte) error {
+	self.writeLock.Lock()
+	defer self.writeLock.Unlock()
+	if _, err := self.writer.Write(b); err != nil {
+		return err
+	}
+	return self.writer.Flush()
+}
+
+// fail closes the connection after an error.
+func (self *conn) fail(err error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.err != nil {
+		return
+	}
+	if err == nil {
+		err = errors.New("connection closed")
+	}
+	self.err = err
+	self.conn.Close()
+	close(self.closed)
+}
+
+// failed returns the error the connection failed with, if it did.
+func (self *conn) failed() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.err
+}
+
+// flush waits for the server to process the messages published, which it
+// does in order, by waiting for the PONG of a PING.
+func (self *conn) flush(timeout time.Duration) error {
+	if err := self.write([]byte("PING\r\n")); err != nil {
+		self.fail(err)
+		return err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-self.pongs:
+		return nil
+	case <-self.closed:
+		return self.failed()
+	case <-timer.C:
+		return fmt.Errorf("no PONG after %s", timeout)
+	}
+}
+
+func (self *conn) close() {
+	self.fail(errors.New("connection closed"))
+}
+
+// publish publishes a message, with its deduplication ID as a header if not
+// empty, and a reply subject if not empty.
+func (self *conn) publish(subject, reply, msgId string, data []byte) error {
+	if err := self.failed(); err != nil {
+		return err
+	}
+	target := subject
+	if reply != "" {
+		target += " " + reply
+	}
+	var b bytes.Buffer
+	if msgId != "" && self.info.Headers {
+		header := "NATS/1.0\r\n" + msgIdHeader + ": " + msgId + "\r\n\r\n"
+		fmt.Fprintf(&b, "HPUB %s %d %d\r\n%s", target, len(header), len(header)+len(data), header)
+	} else {
+		fmt.Fprintf(&b, "PUB %s %d\r\n", target, len(data))
+	}
+	b.Write(data)
+	b.WriteString("\r\n")
+	if err := self.write(b.Bytes()); err != nil {
+		self.fail(err)
+		return err
+	}
+	return nil
+}
+
+// subscribeInbox subscribes to the inbox the replies of JetStream are
+// received on.
+func (self *conn) subscribeInbox() error {
+	id := make([]byte, 11)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+	self.inbox = "_INBOX." + hex.EncodeToString(id)
+	if err := self.write([]byte("SUB " + self.inbox + ".* 1\r\n")); err != nil {
+		self.fail(err)
+		return err
+	}
+	return nil
+}
+
+// publishJetStream publishes a message to JetStream, and waits for it to
+// be stored in a stream.
+func (self *conn) publishJetStream(subject, msgId string, data []byte, timeout time.Duration) error {
+	self.lock.Lock()
+	self.nextReply++
+	reply := self.inbox + "." + strconv.FormatUint(self.nextReply, 10)
+	ch := make(chan []byte, 1)
+	self.replies[reply] = ch
+	self.lock.Unlock()
+	defer func() {
+		self.lock.Lock()
+		delete(self.replies, reply)
+		self.lock.Unlock()
+	}()
+
+	if err := self.publish(subject, reply, msgId, data); err != nil {
+		return err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case payload := <-ch:
+		if payload == nil {
+			return errNoResponders
+		}
+		var ack pubAck
+		if err := json.Unmarshal(payload, &ack); err != nil {
+			return fmt.Errorf("invalid JetStream acknowledgement %q - %v", payload, err)
+		}
+		if ack.Error != nil {
+			return fmt.Errorf("JetStream error %d: %s", ack.Error.Code, ack.Error.Description)
+		}
+		return nil
+	case <-self.closed:
+		return self.failed()
+	case <-timer.C:
+		return fmt.Errorf("no JetStream acknowledgement after %s", timeout)
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// publishedMessage is a message received by the fake server.
+type publishedMessage struct {
+	subject string
+	reply   string
+	header  string
+	data    string
+}
+
+// fakeServer speaks the part of the NATS protocol the driver uses, and
+// acknowledges the messages with a reply subject like JetStream.
+type fakeServer struct {
+	t        *testing.T
+	listener net.Listener
+	tls      *tls.Config
+	token    string
+	// Public key of the user of the credentials, if required.
+	userKey ed25519.PublicKey
+	// Number of acknowledgements not sent, from the first, and whether
+	// no stream takes the subjects.
+	dropAcks     int
+	noResponders bool
+	// Acknowledgements are not sent at all.
+	noAcks bool
+
+	lock     sync.Mutex
+	connects []connectOptions
+	messages []publishedMessage
+	conns    []net.Conn
+}
+
+// newFakeServer starts a server, configured before it accepts connections.
+func newFakeServer(t *testing.T, configure ...func(*fakeServer)) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{t: t, listener: l}
+	for _, f := range configure {
+		f(s)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.lock.Lock()
+			s.conns = append(s.conns, conn)
+			s.lock.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (self *fakeServer) url() string {
+	return "nats://" + self.listener.Addr().String()
+}
+
+func (self *fakeServer) close() {
+	self.listener.Close()
+	self.dropConnections()
+}
+
+// dropConnections closes the connections of the clients.
+func (self *fakeServer) dropConnections() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, conn := range self.conns {
+		conn.Close()
+	}
+	self.conns = nil
+}
+
+func (self *fakeServer) connected() []connectOptions {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return append([]connectOptions(nil), self.connects...)
+}
+
+func (self *fakeServer) published() []publishedMessage {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return append([]publishedMessage(nil), self.messages...)
+}
+
+func (self *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO {\"headers\":true,\"max_payload\":1048576,\"nonce\":\"nonce-1\",\"tls_required\":%v}\r\n", self.tls != nil)
+	if self.tls != nil {
+		tlsConn := tls.Server(conn, self.tls)
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		conn = tlsConn
+	}
+	reader := bufio.NewReader(conn)
+	var writeLock sync.Mutex
+	write := func(s string) {
+		writeLock.Lock()
+		defer writeLock.Unlock()
+		io.WriteString(conn, s)
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		switch args[0] {
+		case "CONNECT":
+			var options connectOptions
+			json.Unmarshal([]byte(strings.TrimSpace(line[len("CONNECT"):])), &options)
+			self.lock.Lock()
+			self.connects = append(self.connects, options)
+			self.lock.Unlock()
+			if self.token != "" && options.AuthToken != self.token {
+				write("-ERR 'Authorization Violation'\r\n")
+				return
+			}
+			if self.userKey != nil {
+				sig, _ := base64.RawURLEncoding.DecodeString(options.Sig)
+				if options.JWT != "user-jwt" || !ed25519.Verify(self.userKey, []byte("nonce-1"), sig) {
+					write("-ERR 'Authorization Violation'\r\n")
+					return
+				}
+			}
+		case "PING":
+			write("PONG\r\n")
+		case "PUB", "HPUB":
+			msg := publishedMessage{subject: args[1]}
+			headerSize := 0
+			size, _ := strconv.Atoi(args[len(args)-1])
+			if args[0] == "HPUB" {
+				headerSize, _ = strconv.Atoi(args[len(args)-2])
+				if len(args) == 5 {
+					msg.reply = args[2]
+				}
+			} else if len(args) == 4 {
+				msg.reply = args[2]
+			}
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			msg.header = string(payload[:headerSize])
+			msg.data = string(payload[headerSize:size])
+			self.lock.Lock()
+			self.messages = append(self.messages, msg)
+			seq := len(self.messages)
+			ack := !self.noAcks && self.dropAcks == 0
+			noResponders := self.noResponders
+			if self.dropAcks > 0 {
+				self.dropAcks--
+			}
+			self.lock.Unlock()
+			if msg.reply == "" || !ack {
+				continue
+			}
+			if noResponders {
+				write(fmt.Sprintf("HMSG %s 1 16 16\r\nNATS/1.0 503\r\n\r\n\r\n", msg.reply))
+			} else {
+				reply := fmt.Sprintf(`{"stream":"STATS","seq":%d}`, seq)
+				write(fmt.Sprintf("MSG %s 1 %d\r\n%s\r\n", msg.reply, len(reply), reply))
+			}
+		}
+	}
+}
+
+func TestDialToken(t *testing.T) {
+	server := newFakeServer(t, func(s *fakeServer) { s.token = "secret" })
+	defer server.close()
+
+	if _, err := dial(dialOptions{url: server.url(), token: "wrong"}); err == nil || !strings.Contains(err.Error(), "Authorization Violation") {
+		t.Errorf("expected the connection to be refused, got %v", err)
+	}
+	c, err := dial(dialOptions{url: server.url(), token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+	connects := server.connected()
+	connect := connects[len(connects)-1]
+	if connect.Name != "cadvisor" || !connect.Headers || !connect.NoResponders || connect.Verbose {
+		t.Errorf("unexpected CONNECT %+v", connect)
+	}
+}
+
+func TestDialUserPassword(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.close()
+
+	c, err := dial(dialOptions{url: "nats://user:p%40ss@" + server.listener.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+	if connect := server.connected()[0]; connect.User != "user" || connect.Pass != "p@ss" {
+		t.Errorf("expected the user and the password of the URL, got %+v", connect)
+	}
+}
+
+func TestDialTLS(t *testing.T) {
+	// The certificate of an httptest TLS server is valid for 127.0.0.1.
+	https := httptest.NewTLSServer(http.NotFoundHandler())
+	defer https.Close()
+	server := newFakeServer(t, func(s *fakeServer) { s.tls = &tls.Config{Certificates: https.TLS.Certificates} })
+	defer server.close()
+
+	if _, err := dial(dialOptions{url: server.url()}); err == nil {
+		t.Error("expected the certificate of the server not to be trusted")
+	}
+	cert, err := x509.ParseCertificate(https.TLS.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	c, err := dial(dialOptions{url: server.url(), tlsConfig: &tls.Config{RootCAs: pool}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+	if err := c.publish("a.b", "", "", []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if !server.connected()[0].TLSRequired {
+		t.Error("expected the CONNECT to require TLS")
+	}
+}
+
+func TestPublishJetStream(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.close()
+	c, err := dial(dialOptions{url: server.url()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+	if err := c.subscribeInbox(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.publishJetStream("a.b", "id-1", []byte("hello"), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	msg := server.published()[0]
+	if msg.data != "hello" || !strings.HasPrefix(msg.reply, c.inbox+".") || msg.header != "NATS/1.0\r\nNats-Msg-Id: id-1\r\n\r\n" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+
+	server.lock.Lock()
+	server.noResponders = true
+	server.lock.Unlock()
+	if err := c.publishJetStream("a.b", "id-2", []byte("hello"), time.Second); err != errNoResponders {
+		t.Errorf("expected no responders, got %v", err)
+	}
+
+	server.lock.Lock()
+	server.noAcks = true
+	server.lock.Unlock()
+	if err := c.publishJetStream("a.b", "id-3", []byte("hello"), 10*time.Millisecond); err == nil {
+		t.Error("expected a timeout without acknowledgement")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// Prefix of the first byte of an encoded nkey seed.
+const seedPrefixByte = 18 << 3
+
+var (
+	// NKeys are encoded in base32 without padding.
+	nkeyEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+	// A block of a credentials file, between its BEGIN and END lines.
+	credsBlockRE = regexp.MustCompile(`\s*(?:-{3,}[^\n]*-{3,}\r?\n)([\w\-.=]+)(?:\r?\n-{3,}[^\n]*-{3,}\r?\n?)`)
+)
+
+// userCredentials are the JWT and the key of a NATS user, read from a
+// credentials file written by nsc.
+type userCredentials struct {
+	jwt string
+	key ed25519.PrivateKey
+}
+
+func readCredentialsFile(path string) (*userCredentials, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	blocks := credsBlockRE.FindAllSubmatch(b, -1)
+	if len(blocks) < 2 {
+		return nil, fmt.Errorf("no user JWT and seed in %q", path)
+	}
+	key, err := decodeSeed(string(blocks[1][1]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid seed in %q - %v", path, err)
+	}
+	return &userCredentials{jwt: string(blocks[0][1]), key: key}, nil
+}
+
+// decodeSeed returns the private key of an encoded nkey seed, e.g.
+// SUAM....
+func decodeSeed(seed string) (ed25519.PrivateKey, error) {
+	raw, err := nkeyEncoding.DecodeString(seed)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != 2+ed25519.SeedSize+2 {
+		return nil, fmt.Errorf("invalid seed length %d", len(raw))
+	}
+	data, checksum := raw[:len(raw)-2], binary.LittleEndian.Uint16(raw[len(raw)-2:])
+	if crc16(data) != checksum {
+		return nil, fmt.Errorf("invalid seed checksum")
+	}
+	if data[0]&0xf8 != seedPrefixByte {
+		return nil, fmt.Errorf("not a seed")
+	}
+	return ed25519.NewKeyFromSeed(data[2:]), nil
+}
+
+// sign returns the signature of the nonce of the server, proving the
+// possession of the key of the user.
+func (self *userCredentials) sign(nonce string) string {
+	return base64.RawURLEncoding.EncodeToString(ed25519.Sign(self.key, []byte(nonce)))
+}
+
+// crc16 is the CRC-16/XMODEM checksum of the nkeys.
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
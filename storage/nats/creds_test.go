@@ -0,0 +1,102 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"encoding/base32"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// encodeSeed encodes the seed of a user key the way nsc does.
+func encodeSeed(seed []byte) string {
+	// The second byte of the prefix is the type of the key, a user.
+	const userPrefixByte = 20 << 3
+	raw := []byte{seedPrefixByte | userPrefixByte>>5, (userPrefixByte & 31) << 3}
+	raw = append(raw, seed...)
+	checksum := make([]byte, 2)
+	binary.LittleEndian.PutUint16(checksum, crc16(raw))
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(append(raw, checksum...))
+}
+
+func writeCredentials(t *testing.T, seed string) string {
+	dir, err := ioutil.TempDir("", "nats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "user.creds")
+	creds := `-----BEGIN NATS USER JWT-----
+user-jwt
+------END NATS USER JWT------
+
+************************* IMPORTANT *************************
+NKEY Seed printed below can be used to sign and prove identity.
+
+-----BEGIN USER NKEY SEED-----
+` + seed + `
+------END USER NKEY SEED------
+`
+	if err := ioutil.WriteFile(path, []byte(creds), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCredentialsFile(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	for i := range seed {
+		seed[i] = byte(i)
+	}
+	path := writeCredentials(t, encodeSeed(seed))
+	defer os.RemoveAll(filepath.Dir(path))
+
+	creds, err := readCredentialsFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.jwt != "user-jwt" {
+		t.Errorf("expected the JWT user-jwt, got %q", creds.jwt)
+	}
+
+	server := newFakeServer(t, func(s *fakeServer) { s.userKey = ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey) })
+	defer server.close()
+	c, err := dial(dialOptions{url: server.url(), credentials: creds})
+	if err != nil {
+		t.Fatalf("expected the signature of the nonce to be accepted, got %v", err)
+	}
+	c.close()
+}
+
+func TestInvalidSeed(t *testing.T) {
+	valid := encodeSeed(make([]byte, ed25519.SeedSize))
+	// A different last character breaks the checksum.
+	corrupted := valid[:len(valid)-1] + "A"
+	if corrupted == valid {
+		corrupted = valid[:len(valid)-1] + "B"
+	}
+	for _, seed := range []string{"SUA", "not base32!", corrupted} {
+		if _, err := decodeSeed(seed); err == nil {
+			t.Errorf("expected an error for the seed %q", seed)
+		}
+	}
+	if _, err := decodeSeed(valid); err != nil {
+		t.Errorf("expected the seed %q to be valid, got %v", valid, err)
+	}
+}
@@ -0,0 +1,409 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+	"github.com/google/cadvisor/utils/container"
+
+	"github.com/golang/glog"
+)
+
+func init() {
+	storage.RegisterStorageDriver("nats", new)
+}
+
+var (
+	argURL                = flag.String("storage_driver_nats_url", "nats://localhost:4222", "URL of the NATS server, nats://[user:password@]host:port, or tls://host:port to require TLS")
+	argSubject            = flag.String("storage_driver_nats_subject", "cadvisor.{machine}.{container}", "subject the stats are published to, where {machine} and {container} are replaced with the machine and the container name")
+	argJetStream          = flag.Bool("storage_driver_nats_jetstream", false, "publish to JetStream and wait for the messages to be stored, retrying them, for at-least-once delivery; a stream must take the subjects")
+	argAckTimeout         = flag.Duration("storage_driver_nats_ack_timeout", 5*time.Second, "time to wait for JetStream to acknowledge a message")
+	argToken              = flag.String("storage_driver_nats_token", "", "token authenticating to the NATS server")
+	argCredsFile          = flag.String("storage_driver_nats_creds", "", "credentials file of a NATS user, with its JWT and nkey seed, authenticating to the NATS server")
+	argCaFile             = flag.String("storage_driver_nats_ssl_ca", "", "optional certificate authority file used to verify the NATS server certificate")
+	argCertFile           = flag.String("storage_driver_nats_ssl_cert", "", "optional certificate file for NATS TLS client authentication")
+	argKeyFile            = flag.String("storage_driver_nats_ssl_key", "", "optional key file for NATS TLS client authentication")
+	argInsecureSkipVerify = flag.Bool("storage_driver_nats_ssl_insecure_skip_verify", false, "do not verify the NATS server certificate chain and host name")
+	argMaxPending         = flag.Int("storage_driver_nats_max_pending", 1000, "maximum number of messages waiting to be published, further messages are dropped")
+	argDrainTimeout       = flag.Duration("storage_driver_nats_drain_timeout", 10*time.Second, "time to wait on shutdown for the pending messages to be published")
+)
+
+const (
+	// Number of attempts at publishing a message to JetStream.
+	maxPublishAttempts = 3
+	// Backoff before reconnecting after an error, doubled after every
+	// consecutive error up to maxBackoff.
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 30 * time.Second
+	// Minimum time between the logs of the publish errors.
+	errorLogInterval = time.Minute
+)
+
+// detailSpec is the JSON of a message, the same as of the Kafka driver but
+// for the timestamp, which is the time of the stats.
+type detailSpec struct {
+	Timestamp       time.Time            `json:"timestamp"`
+	MachineName     string               `json:"machine_name,omitempty"`
+	ContainerName   string               `json:"container_Name,omitempty"`
+	ContainerID     string               `json:"container_Id,omitempty"`
+	ContainerLabels map[string]string    `json:"container_labels,omitempty"`
+	ContainerStats  *info.ContainerStats `json:"container_stats,omitempty"`
+}
+
+type message struct {
+	subject string
+	// Deduplication ID of the message in JetStream.
+	id   string
+	data []byte
+}
+
+type natsStorage struct {
+	machineName string
+	subject     string
+	jetStream   bool
+	ackTimeout  time.Duration
+	options     dialOptions
+
+	queue        chan message
+	done         chan struct{}
+	stop         chan struct{}
+	drainTimeout time.Duration
+
+	// Used by the publishing goroutine only.
+	conn     *conn
+	failures int
+	nextDial time.Time
+	backoff  time.Duration
+
+	// Counts of the messages published, failed to be published, and
+	// dropped because the queue was full.
+	published uint64
+	failed    uint64
+	dropped   uint64
+	// Counts when the errors were last logged, and the last error.
+	logLock      sync.Mutex
+	lastLog      time.Time
+	lastErr      error
+	loggedFailed uint64
+	loggedDrop   uint64
+}
+
+func new() (storage.StorageDriver, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	options := dialOptions{url: *argURL, token: *argToken}
+	if *argCredsFile != "" {
+		if options.credentials, err = readCredentialsFile(*argCredsFile); err != nil {
+			return nil, err
+		}
+	}
+	if options.tlsConfig, err = generateTLSConfig(*argCaFile, *argCertFile, *argKeyFile, *argInsecureSkipVerify); err != nil {
+		return nil, err
+	}
+	return newStorage(config{
+		machineName:  hostname,
+		subject:      *argSubject,
+		options:      options,
+		jetStream:    *argJetStream,
+		ackTimeout:   *argAckTimeout,
+		maxPending:   *argMaxPending,
+		drainTimeout: *argDrainTimeout,
+	})
+}
+
+// generateTLSConfig returns the TLS configuration of the connection, or nil
+// if no TLS option is set.
+func generateTLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	if caFile == "" && certFile == "" && keyFile == "" && !insecureSkipVerify {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	if caFile != "" {
+		caCert, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificate found in %q", caFile)
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Escapes the characters which would split a subject token, or are
+// wildcards, so that a name is a single token, e.g. web%2E1 of web.1.
+var tokenReplacer = strings.NewReplacer(
+	"%", "%25",
+	".", "%2E",
+	" ", "%20",
+	"\t", "%09",
+	"\r", "%0D",
+	"\n", "%0A",
+	"*", "%2A",
+	">", "%3E",
+)
+
+// subjectOf returns the subject of the messages of a container.
+func (self *natsStorage) subjectOf(containerName string) string {
+	return strings.NewReplacer(
+		"{machine}", tokenReplacer.Replace(self.machineName),
+		"{container}", tokenReplacer.Replace(containerName),
+	).Replace(self.subject)
+}
+
+func (self *natsStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	if stats == nil {
+		return nil
+	}
+	containerName := container.GetPreferredName(ref)
+	data, err := json.Marshal(&detailSpec{
+		Timestamp:       stats.Timestamp,
+		MachineName:     self.machineName,
+		ContainerName:   containerName,
+		ContainerID:     ref.Id,
+		ContainerLabels: ref.Labels,
+		ContainerStats:  stats,
+	})
+	if err != nil {
+		return err
+	}
+	msg := message{
+		subject: self.subjectOf(containerName),
+		id:      fmt.Sprintf("%s:%s:%d", self.machineName, ref.Name, stats.Timestamp.UnixNano()),
+		data:    data,
+	}
+	select {
+	case self.queue <- msg:
+	default:
+		atomic.AddUint64(&self.dropped, 1)
+		self.logErrors(false)
+	}
+	return nil
+}
+
+// run publishes the queued messages, until the queue is closed and empty,
+// or stop is closed.
+func (self *natsStorage) run() {
+	defer close(self.done)
+	for msg := range self.queue {
+		if err := self.publish(msg); err != nil {
+			atomic.AddUint64(&self.failed, 1)
+			self.logLock.Lock()
+			self.lastErr = err
+			self.logLock.Unlock()
+			self.logErrors(false)
+		} else {
+			atomic.AddUint64(&self.published, 1)
+		}
+		if self.stopped() {
+			return
+		}
+	}
+}
+
+// publish publishes a message, reconnecting if needed. The messages
+// published to JetStream are retried until they are acknowledged.
+func (self *natsStorage) publish(msg message) error {
+	attempts := 1
+	if self.jetStream {
+		attempts = maxPublishAttempts
+	}
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 && self.stopped() {
+			break
+		}
+		if err = self.connect(); err != nil {
+			continue
+		}
+		if self.jetStream {
+			err = self.conn.publishJetStream(msg.subject, msg.id, msg.data, self.ackTimeout)
+			if err == errNoResponders {
+				// Retrying does not create the stream.
+				return fmt.Errorf("failed to publish to %q - %v", msg.subject, err)
+			}
+		} else {
+			err = self.conn.publish(msg.subject, "", "", msg.data)
+		}
+		if err == nil {
+			self.failures = 0
+			return nil
+		}
+		if self.conn.failed() != nil {
+			self.conn = nil
+		}
+	}
+	return fmt.Errorf("failed to publish to %q - %v", msg.subject, err)
+}
+
+func (self *natsStorage) stopped() bool {
+	select {
+	case <-self.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// connect connects to the NATS server if not connected, backing off after
+// errors, waiting for the backoff unless stopped.
+func (self *natsStorage) connect() error {
+	if self.conn != nil {
+		return nil
+	}
+	if wait := self.nextDial.Sub(time.Now()); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-self.stop:
+			return fmt.Errorf("not connected to the NATS server")
+		}
+	}
+	c, err := dial(self.options)
+	if err == nil && self.jetStream {
+		if err = c.subscribeInbox(); err != nil {
+			c.close()
+		}
+	}
+	if err != nil {
+		backoff := self.backoff << uint(self.failures)
+		if backoff > maxBackoff || backoff <= 0 {
+			backoff = maxBackoff
+		}
+		self.failures++
+		self.nextDial = time.Now().Add(backoff)
+		return fmt.Errorf("failed to connect to the NATS server %q - %v", self.options.url, err)
+	}
+	self.conn = c
+	return nil
+}
+
+// logErrors logs the counts of the messages failed and dropped since the
+// last log, at most every errorLogInterval unless forced.
+func (self *natsStorage) logErrors(force bool) {
+	self.logLock.Lock()
+	defer self.logLock.Unlock()
+	if !force && time.Since(self.lastLog) < errorLogInterval {
+		return
+	}
+	failed, dropped := atomic.LoadUint64(&self.failed), atomic.LoadUint64(&self.dropped)
+	if failed == self.loggedFailed && dropped == self.loggedDrop {
+		return
+	}
+	glog.Errorf("NATS: %d messages failed to be published and %d were dropped because %d were pending, last error: %v",
+		failed-self.loggedFailed, dropped-self.loggedDrop, cap(self.queue), self.lastErr)
+	self.lastLog = time.Now()
+	self.loggedFailed, self.loggedDrop = failed, dropped
+}
+
+// Close publishes the pending messages, waiting for them at most the drain
+// timeout, and the acknowledgement of the message being published.
+func (self *natsStorage) Close() error {
+	close(self.queue)
+	deadline := time.Now().Add(self.drainTimeout)
+	timer := time.NewTimer(self.drainTimeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-self.done:
+	case <-timer.C:
+		close(self.stop)
+		<-self.done
+		err = fmt.Errorf("NATS: %d messages were not published within %s", len(self.queue), self.drainTimeout)
+	}
+	if self.conn != nil {
+		// The messages published without JetStream are only known to
+		// be received once flushed.
+		if err == nil {
+			if flushErr := self.conn.flush(deadline.Sub(time.Now())); flushErr != nil {
+				err = fmt.Errorf("NATS: failed to flush the published messages - %v", flushErr)
+			}
+		}
+		self.conn.close()
+	}
+	self.logErrors(true)
+	return err
+}
+
+// config is the configuration of the driver, populated from the flags.
+type config struct {
+	// A unique identifier to identify the host that current cAdvisor
+	// instance is running on.
+	machineName string
+	// The template of the subject of the messages.
+	subject string
+	// How to connect and authenticate to the NATS server.
+	options dialOptions
+	// Whether to publish to JetStream.
+	jetStream bool
+	// The time to wait for JetStream to acknowledge a message.
+	ackTimeout time.Duration
+	// The maximum number of messages waiting to be published.
+	maxPending int
+	// The time to wait on Close for the pending messages.
+	drainTimeout time.Duration
+}
+
+// Create a new NATS storage driver.
+func newStorage(cfg config) (*natsStorage, error) {
+	if cfg.subject == "" || strings.ContainsAny(cfg.subject, " \t\r\n") {
+		return nil, fmt.Errorf("invalid NATS subject %q", cfg.subject)
+	}
+	if cfg.maxPending <= 0 {
+		return nil, fmt.Errorf("the maximum number of pending NATS messages must be positive, got %d", cfg.maxPending)
+	}
+	ret := &natsStorage{
+		machineName:  cfg.machineName,
+		subject:      cfg.subject,
+		jetStream:    cfg.jetStream,
+		ackTimeout:   cfg.ackTimeout,
+		options:      cfg.options,
+		queue:        make(chan message, cfg.maxPending),
+		done:         make(chan struct{}),
+		stop:         make(chan struct{}),
+		drainTimeout: cfg.drainTimeout,
+		backoff:      minBackoff,
+	}
+	// Fails early on a wrong address or authentication, the connection
+	// being reopened later on errors.
+	if err := ret.connect(); err != nil {
+		return nil, err
+	}
+	go ret.run()
+	return ret, nil
+}
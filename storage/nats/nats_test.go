@@ -0,0 +1,235 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nats
+
+import (
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+var (
+	testRef = info.ContainerReference{
+		Name:    "/docker/abc",
+		Id:      "abc",
+		Aliases: []string{"web.1", "abc"},
+		Labels:  map[string]string{"app": "shop"},
+	}
+	testStats = &info.ContainerStats{
+		Timestamp: time.Unix(1451606400, 0).UTC(),
+		Memory:    info.MemoryStats{Usage: 4096},
+	}
+)
+
+// testConfig returns the configuration of a driver publishing to the
+// server at url.
+func testConfig(url string) config {
+	return config{
+		machineName:  "host-1",
+		subject:      "cadvisor",
+		options:      dialOptions{url: url},
+		ackTimeout:   time.Second,
+		maxPending:   10,
+		drainTimeout: time.Second,
+	}
+}
+
+func newTestStorage(t *testing.T, server *fakeServer, jetStream bool) *natsStorage {
+	cfg := testConfig(server.url())
+	cfg.machineName = "host-1.example.com"
+	cfg.subject = "cadvisor.{machine}.{container}"
+	cfg.jetStream = jetStream
+	cfg.ackTimeout = 50 * time.Millisecond
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.backoff = time.Millisecond
+	return driver
+}
+
+func TestSubject(t *testing.T) {
+	driver := &natsStorage{machineName: "host-1.example.com", subject: "cadvisor.{machine}.{container}.stats"}
+	for name, expected := range map[string]string{
+		"/docker/abc":  "cadvisor.host-1%2Eexample%2Ecom./docker/abc.stats",
+		"web.1":        "cadvisor.host-1%2Eexample%2Ecom.web%2E1.stats",
+		"my container": "cadvisor.host-1%2Eexample%2Ecom.my%20container.stats",
+		"a*b>c%d":      "cadvisor.host-1%2Eexample%2Ecom.a%2Ab%3Ec%25d.stats",
+	} {
+		if got := driver.subjectOf(name); got != expected {
+			t.Errorf("subject of %q: expected %q, got %q", name, expected, got)
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.close()
+	driver := newTestStorage(t, server, false)
+
+	if err := driver.AddStats(testRef, testStats); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	messages := server.published()
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(messages))
+	}
+	msg := messages[0]
+	if msg.subject != "cadvisor.host-1%2Eexample%2Ecom.web%2E1" || msg.reply != "" || msg.header != "" {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	var detail detailSpec
+	if err := json.Unmarshal([]byte(msg.data), &detail); err != nil {
+		t.Fatal(err)
+	}
+	if detail.MachineName != "host-1.example.com" || detail.ContainerName != "web.1" || detail.ContainerID != "abc" ||
+		detail.ContainerLabels["app"] != "shop" || !detail.Timestamp.Equal(testStats.Timestamp) || detail.ContainerStats.Memory.Usage != 4096 {
+		t.Errorf("unexpected message %s", msg.data)
+	}
+	if published := atomic.LoadUint64(&driver.published); published != 1 {
+		t.Errorf("expected 1 message published, got %d", published)
+	}
+}
+
+func TestPublishJetStreamRetries(t *testing.T) {
+	server := newFakeServer(t, func(s *fakeServer) { s.dropAcks = 2 })
+	defer server.close()
+	driver := newTestStorage(t, server, true)
+
+	if err := driver.AddStats(testRef, testStats); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Published again with the same ID until acknowledged.
+	messages := server.published()
+	if len(messages) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(messages))
+	}
+	for _, msg := range messages {
+		if msg.header != messages[0].header || !strings.Contains(msg.header, "Nats-Msg-Id: host-1.example.com:/docker/abc:1451606400000000000") {
+			t.Errorf("expected the same deduplication ID, got %q", msg.header)
+		}
+	}
+	if published, failed := atomic.LoadUint64(&driver.published), atomic.LoadUint64(&driver.failed); published != 1 || failed != 0 {
+		t.Errorf("expected 1 message published and none failed, got %d and %d", published, failed)
+	}
+}
+
+func TestPublishJetStreamNoStream(t *testing.T) {
+	server := newFakeServer(t, func(s *fakeServer) { s.noResponders = true })
+	defer server.close()
+	driver := newTestStorage(t, server, true)
+
+	driver.AddStats(testRef, testStats)
+	driver.Close()
+	// Not retried, no stream would take it.
+	if n := len(server.published()); n != 1 {
+		t.Errorf("expected 1 attempt, got %d", n)
+	}
+	if failed := atomic.LoadUint64(&driver.failed); failed != 1 {
+		t.Errorf("expected 1 message failed, got %d", failed)
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.close()
+	driver := newTestStorage(t, server, true)
+
+	driver.AddStats(testRef, testStats)
+	waitFor(t, func() bool { return atomic.LoadUint64(&driver.published) == 1 })
+	server.dropConnections()
+	driver.AddStats(testRef, testStats)
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if published := atomic.LoadUint64(&driver.published); published != 2 {
+		t.Errorf("expected the message to be published after reconnecting, got %d published", published)
+	}
+	if n := len(server.connected()); n != 2 {
+		t.Errorf("expected 2 connections, got %d", n)
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	// The queue is not consumed.
+	driver := &natsStorage{queue: make(chan message, 2), subject: "cadvisor"}
+	for i := 0; i < 5; i++ {
+		if err := driver.AddStats(testRef, testStats); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if dropped := atomic.LoadUint64(&driver.dropped); dropped != 3 {
+		t.Errorf("expected 3 dropped messages, got %d", dropped)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	server := newFakeServer(t, func(s *fakeServer) { s.noAcks = true })
+	defer server.close()
+	cfg := testConfig(server.url())
+	cfg.jetStream = true
+	cfg.ackTimeout = 20 * time.Millisecond
+	cfg.drainTimeout = 30 * time.Millisecond
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		driver.AddStats(testRef, testStats)
+	}
+	start := time.Now()
+	err = driver.Close()
+	if err == nil || !strings.Contains(err.Error(), "not published") {
+		t.Errorf("expected the pending messages to be reported, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected Close to return after the drain timeout, took %v", elapsed)
+	}
+}
+
+func TestNewStorageValidation(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.close()
+	for _, subject := range []string{"", "cadvisor stats"} {
+		cfg := testConfig(server.url())
+		cfg.subject = subject
+		if _, err := newStorage(cfg); err == nil {
+			t.Errorf("expected an error for the subject %q", subject)
+		}
+	}
+	if _, err := newStorage(testConfig("http://" + server.listener.Addr().String())); err == nil {
+		t.Error("expected an error for an http URL")
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentsdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Number of the datapoints rejected by OpenTSDB which are logged per
+// request.
+const maxLoggedErrors = 10
+
+// dataPoint is a datapoint of the /api/put endpoint of OpenTSDB.
+type dataPoint struct {
+	Metric string `json:"metric"`
+	// Milliseconds since the epoch.
+	Timestamp int64             `json:"timestamp"`
+	Value     uint64            `json:"value"`
+	Tags      map[string]string `json:"tags"`
+}
+
+// rejectedPoint is a datapoint rejected by OpenTSDB, whose value may not
+// be a number.
+type rejectedPoint struct {
+	Metric string            `json:"metric"`
+	Tags   map[string]string `json:"tags"`
+}
+
+func (self rejectedPoint) String() string {
+	tags := make([]string, 0, len(self.Tags))
+	for k, v := range self.Tags {
+		tags = append(tags, k+"="+v)
+	}
+	sort.Strings(tags)
+	return fmt.Sprintf("%s{%s}", self.Metric, strings.Join(tags, ","))
+}
+
+// putResponse is the summary of a request to /api/put?details.
+type putResponse struct {
+	Success int `json:"success"`
+	Failed  int `json:"failed"`
+	Errors  []struct {
+		DataPoint rejectedPoint `json:"datapoint"`
+		Error     string        `json:"error"`
+	} `json:"errors"`
+}
+
+// client writes datapoints to the HTTP API of OpenTSDB.
+type client struct {
+	url      string
+	username string
+	password string
+	client   *http.Client
+}
+
+func newClient(host string, secure bool, username, password string) *client {
+	scheme := "http"
+	if secure {
+		scheme = "https"
+	}
+	return &client{
+		url:      scheme + "://" + host + "/api/put?details",
+		username: username,
+		password: password,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// put writes datapoints in a single request. The datapoints OpenTSDB
+// rejects are logged with their tags, and counted in the error returned.
+func (self *client) put(points []dataPoint) error {
+	body, err := json.Marshal(points)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", self.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if self.username != "" {
+		req.SetBasicAuth(self.username, self.password)
+	}
+	resp, err := self.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to write %d datapoints to OpenTSDB - %s", len(points), err)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read the response of OpenTSDB - %s", err)
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	var summary putResponse
+	if err := json.Unmarshal(b, &summary); err != nil || (resp.StatusCode != http.StatusOK && summary.Failed == 0) {
+		return fmt.Errorf("failed to write %d datapoints to OpenTSDB, server returned %s: %s", len(points), resp.Status, bytes.TrimSpace(b))
+	}
+	if summary.Failed == 0 {
+		return nil
+	}
+	for i, e := range summary.Errors {
+		if i == maxLoggedErrors {
+			glog.Warningf("OpenTSDB rejected %d more datapoints", len(summary.Errors)-i)
+			break
+		}
+		glog.Warningf("OpenTSDB rejected the datapoint %s - %s", e.DataPoint, e.Error)
+	}
+	return fmt.Errorf("OpenTSDB rejected %d of %d datapoints", summary.Failed, len(points))
+}
@@ -0,0 +1,291 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentsdb
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+)
+
+func init() {
+	storage.RegisterStorageDriver("opentsdb", new)
+}
+
+var (
+	argUsername      = flag.String("storage_driver_opentsdb_username", "", "username of the basic authentication to OpenTSDB, none if empty")
+	argPassword      = flag.String("storage_driver_opentsdb_password", "", "password of the basic authentication to OpenTSDB")
+	argLabels        = flag.String("storage_driver_opentsdb_labels", "", fmt.Sprintf("comma-separated list of the container labels added as tags to the datapoints, at most %d", maxLabelTags))
+	argMaxDatapoints = flag.Int("storage_driver_opentsdb_max_datapoints", 50, "maximum number of datapoints written to OpenTSDB with a single request; datapoints are buffered until there are as many, or until -storage_driver_buffer_duration has elapsed")
+)
+
+// Tags of every datapoint.
+const (
+	tagHost          = "host"
+	tagContainerName = "container_name"
+	tagInterface     = "interface"
+	tagDevice        = "device"
+	// OpenTSDB rejects the datapoints with more than 8 tags by default,
+	// tsd.storage.max_tags, of which host, container_name and interface
+	// or device are taken.
+	maxLabelTags = 5
+)
+
+// Metric names, following the namespace, e.g. cadvisor.cpu.usage.total.
+const (
+	metricCpuUsageTotal    = "cpu.usage.total"
+	metricCpuUsageUser     = "cpu.usage.user"
+	metricCpuUsageSystem   = "cpu.usage.system"
+	metricCpuLoadAverage   = "cpu.load_average"
+	metricMemoryUsage      = "memory.usage"
+	metricMemoryWorkingSet = "memory.working_set"
+	metricMemoryCache      = "memory.cache"
+	metricMemoryRss        = "memory.rss"
+	metricNetworkRxBytes   = "network.rx_bytes"
+	metricNetworkRxPackets = "network.rx_packets"
+	metricNetworkRxErrors  = "network.rx_errors"
+	metricNetworkRxDropped = "network.rx_dropped"
+	metricNetworkTxBytes   = "network.tx_bytes"
+	metricNetworkTxPackets = "network.tx_packets"
+	metricNetworkTxErrors  = "network.tx_errors"
+	metricNetworkTxDropped = "network.tx_dropped"
+	metricFilesystemLimit  = "filesystem.limit"
+	metricFilesystemUsage  = "filesystem.usage"
+	metricTasksRunning     = "tasks.running"
+	metricTasksSleeping    = "tasks.sleeping"
+)
+
+type openTSDBStorage struct {
+	client         *client
+	namespace      string
+	machineName    string
+	labels         []string
+	maxDatapoints  int
+	bufferDuration time.Duration
+
+	lock      sync.Mutex
+	lastWrite time.Time
+	// Datapoints buffered since lastWrite.
+	buffer []dataPoint
+}
+
+func new() (storage.StorageDriver, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	var labels []string
+	if *argLabels != "" {
+		labels = strings.Split(*argLabels, ",")
+	}
+	return newStorage(config{
+		machineName:    hostname,
+		namespace:      *storage.ArgDbName,
+		host:           *storage.ArgDbHost,
+		secure:         *storage.ArgDbIsSecure,
+		username:       *argUsername,
+		password:       *argPassword,
+		labels:         labels,
+		maxDatapoints:  *argMaxDatapoints,
+		bufferDuration: *storage.ArgDbBufferDuration,
+	})
+}
+
+// OpenTSDB only allows these characters in metric names and tags, besides
+// Unicode letters.
+func validTagRune(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+		r == '-' || r == '_' || r == '.' || r == '/' || unicode.IsLetter(r)
+}
+
+// sanitize replaces the characters OpenTSDB does not allow with
+// underscores.
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		if validTagRune(r) {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// containerTags returns the tags of the datapoints of a container: the
+// host, the container name and the allowlisted labels the container has.
+// OpenTSDB does not allow tags with empty values, those are left out.
+func (self *openTSDBStorage) containerTags(ref info.ContainerReference) map[string]string {
+	tags := map[string]string{
+		tagHost:          sanitize(self.machineName),
+		tagContainerName: sanitize(ref.Name),
+	}
+	for _, label := range self.labels {
+		if value := ref.Labels[label]; value != "" {
+			tags[sanitize(label)] = sanitize(value)
+		}
+	}
+	return tags
+}
+
+// dataPoints returns the datapoints of the stats of a container.
+func (self *openTSDBStorage) dataPoints(ref info.ContainerReference, stats *info.ContainerStats) []dataPoint {
+	tags := self.containerTags(ref)
+	timestamp := stats.Timestamp.UnixNano() / int64(time.Millisecond)
+	var points []dataPoint
+	add := func(metric string, value uint64, extra ...string) {
+		pointTags := tags
+		if len(extra) > 0 {
+			pointTags = make(map[string]string, len(tags)+1)
+			for k, v := range tags {
+				pointTags[k] = v
+			}
+			pointTags[extra[0]] = sanitize(extra[1])
+		}
+		points = append(points, dataPoint{
+			Metric:    self.namespace + "." + metric,
+			Timestamp: timestamp,
+			Value:     value,
+			Tags:      pointTags,
+		})
+	}
+
+	add(metricCpuUsageTotal, stats.Cpu.Usage.Total)
+	add(metricCpuUsageUser, stats.Cpu.Usage.User)
+	add(metricCpuUsageSystem, stats.Cpu.Usage.System)
+	add(metricCpuLoadAverage, uint64(stats.Cpu.LoadAverage))
+	add(metricMemoryUsage, stats.Memory.Usage)
+	add(metricMemoryWorkingSet, stats.Memory.WorkingSet)
+	add(metricMemoryCache, stats.Memory.Cache)
+	add(metricMemoryRss, stats.Memory.RSS)
+	add(metricTasksRunning, stats.TaskStats.NrRunning)
+	add(metricTasksSleeping, stats.TaskStats.NrSleeping)
+
+	interfaces := stats.Network.Interfaces
+	if len(interfaces) == 0 && stats.Network.Name != "" {
+		interfaces = []info.InterfaceStats{stats.Network.InterfaceStats}
+	}
+	for _, iface := range interfaces {
+		add(metricNetworkRxBytes, iface.RxBytes, tagInterface, iface.Name)
+		add(metricNetworkRxPackets, iface.RxPackets, tagInterface, iface.Name)
+		add(metricNetworkRxErrors, iface.RxErrors, tagInterface, iface.Name)
+		add(metricNetworkRxDropped, iface.RxDropped, tagInterface, iface.Name)
+		add(metricNetworkTxBytes, iface.TxBytes, tagInterface, iface.Name)
+		add(metricNetworkTxPackets, iface.TxPackets, tagInterface, iface.Name)
+		add(metricNetworkTxErrors, iface.TxErrors, tagInterface, iface.Name)
+		add(metricNetworkTxDropped, iface.TxDropped, tagInterface, iface.Name)
+	}
+
+	for _, fs := range stats.Filesystem {
+		add(metricFilesystemLimit, fs.Limit, tagDevice, fs.Device)
+		add(metricFilesystemUsage, fs.Usage, tagDevice, fs.Device)
+	}
+	return points
+}
+
+func (self *openTSDBStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	if stats == nil {
+		return nil
+	}
+	points := self.dataPoints(ref, stats)
+	var pointsToFlush []dataPoint
+	func() {
+		// AddStats will be invoked simultaneously from multiple threads and only one of them will perform a write.
+		self.lock.Lock()
+		defer self.lock.Unlock()
+		self.buffer = append(self.buffer, points...)
+		if len(self.buffer) >= self.maxDatapoints || time.Since(self.lastWrite) >= self.bufferDuration {
+			pointsToFlush = self.buffer
+			self.buffer = nil
+			self.lastWrite = time.Now()
+		}
+	}()
+	return self.flush(pointsToFlush)
+}
+
+// flush writes datapoints in requests of at most maxDatapoints datapoints.
+func (self *openTSDBStorage) flush(points []dataPoint) error {
+	var lastErr error
+	for start := 0; start < len(points); start += self.maxDatapoints {
+		end := start + self.maxDatapoints
+		if end > len(points) {
+			end = len(points)
+		}
+		if err := self.client.put(points[start:end]); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (self *openTSDBStorage) Close() error {
+	self.lock.Lock()
+	pointsToFlush := self.buffer
+	self.buffer = nil
+	self.lock.Unlock()
+	return self.flush(pointsToFlush)
+}
+
+// config is the configuration of the driver, populated from the flags.
+type config struct {
+	// A unique identifier to identify the host that current cAdvisor
+	// instance is running on, the host tag.
+	machineName string
+	// The prefix of the metric names.
+	namespace string
+	// The host:port of the HTTP API of OpenTSDB.
+	host string
+	// Whether to use https.
+	secure bool
+	// The username of the basic authentication, none if empty.
+	username string
+	// The password of the basic authentication.
+	password string
+	// The container labels added as tags.
+	labels []string
+	// The maximum number of datapoints of a request.
+	maxDatapoints int
+	// The maximum time datapoints are buffered before being written.
+	bufferDuration time.Duration
+}
+
+// Create a new OpenTSDB storage driver.
+func newStorage(cfg config) (*openTSDBStorage, error) {
+	if len(cfg.labels) > maxLabelTags {
+		return nil, fmt.Errorf("at most %d container labels can be OpenTSDB tags, got %d", maxLabelTags, len(cfg.labels))
+	}
+	if cfg.maxDatapoints <= 0 {
+		return nil, fmt.Errorf("the maximum number of datapoints per OpenTSDB request must be positive, got %d", cfg.maxDatapoints)
+	}
+	for _, label := range cfg.labels {
+		switch sanitize(label) {
+		case tagHost, tagContainerName, tagInterface, tagDevice:
+			return nil, fmt.Errorf("container label %q can not be an OpenTSDB tag, the tag is taken", label)
+		}
+	}
+	return &openTSDBStorage{
+		client:         newClient(cfg.host, cfg.secure, cfg.username, cfg.password),
+		namespace:      cfg.namespace,
+		machineName:    cfg.machineName,
+		labels:         cfg.labels,
+		maxDatapoints:  cfg.maxDatapoints,
+		bufferDuration: cfg.bufferDuration,
+		lastWrite:      time.Now(),
+	}, nil
+}
@@ -0,0 +1,286 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opentsdb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// fakeOpenTSDB records the datapoints of the requests it receives, and
+// rejects those whose metric is in reject.
+type fakeOpenTSDB struct {
+	lock     sync.Mutex
+	status   int
+	reject   map[string]bool
+	requests [][]dataPoint
+	auth     []string
+}
+
+func (self *fakeOpenTSDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if r.URL.Path != "/api/put" || r.URL.RawQuery != "details" {
+		http.Error(w, "unexpected "+r.URL.String(), http.StatusNotFound)
+		return
+	}
+	self.auth = append(self.auth, r.Header.Get("Authorization"))
+	if self.status != 0 {
+		http.Error(w, "failed", self.status)
+		return
+	}
+	var points []dataPoint
+	if err := json.NewDecoder(r.Body).Decode(&points); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	self.requests = append(self.requests, points)
+	resp := putResponse{}
+	for _, p := range points {
+		if self.reject[p.Metric] {
+			resp.Failed++
+			resp.Errors = append(resp.Errors, struct {
+				DataPoint rejectedPoint `json:"datapoint"`
+				Error     string        `json:"error"`
+			}{rejectedPoint{p.Metric, p.Tags}, "Unknown metric"})
+		} else {
+			resp.Success++
+		}
+	}
+	if resp.Failed > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (self *fakeOpenTSDB) points() []dataPoint {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var ret []dataPoint
+	for _, r := range self.requests {
+		ret = append(ret, r...)
+	}
+	return ret
+}
+
+// testConfig returns the configuration of a driver writing to host.
+func testConfig(host string) config {
+	return config{
+		machineName:   "host-1",
+		namespace:     "cadvisor",
+		host:          host,
+		maxDatapoints: 50,
+	}
+}
+
+func newTestStorage(t *testing.T, server *httptest.Server, labels []string, maxDatapoints int, bufferDuration time.Duration) *openTSDBStorage {
+	cfg := testConfig(strings.TrimPrefix(server.URL, "http://"))
+	cfg.labels = labels
+	cfg.maxDatapoints = maxDatapoints
+	cfg.bufferDuration = bufferDuration
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return driver
+}
+
+var (
+	testRef = info.ContainerReference{
+		Name:   "/docker/abc",
+		Labels: map[string]string{"app": "shop", "io.k8s/pod name": "web 1", "empty": "", "tier": "front"},
+	}
+	testStats = &info.ContainerStats{
+		Timestamp: time.Unix(1451606400, 5000000),
+		Cpu: info.CpuStats{
+			Usage: info.CpuUsage{Total: 300, User: 200, System: 100},
+		},
+		Memory: info.MemoryStats{Usage: 4096, WorkingSet: 3072, Cache: 1024, RSS: 2048},
+		Network: info.NetworkStats{
+			Interfaces: []info.InterfaceStats{{Name: "eth0", RxBytes: 10, TxBytes: 20}},
+		},
+		Filesystem: []info.FsStats{{Device: "/dev/sda1", Limit: 1000, Usage: 500}},
+		TaskStats:  info.LoadStats{NrRunning: 2, NrSleeping: 3},
+	}
+)
+
+func TestDataPoints(t *testing.T) {
+	server := httptest.NewServer(&fakeOpenTSDB{})
+	defer server.Close()
+	driver := newTestStorage(t, server, []string{"app", "io.k8s/pod name", "empty", "missing"}, 50, time.Hour)
+
+	points := driver.dataPoints(testRef, testStats)
+	containerTags := map[string]string{
+		"host":            "host-1",
+		"container_name":  "/docker/abc",
+		"app":             "shop",
+		"io.k8s/pod_name": "web_1",
+	}
+	got := make(map[string]dataPoint)
+	for _, p := range points {
+		if p.Timestamp != 1451606400005 {
+			t.Errorf("%s: expected the timestamp in milliseconds 1451606400005, got %d", p.Metric, p.Timestamp)
+		}
+		got[rejectedPoint{p.Metric, p.Tags}.String()] = p
+	}
+	for _, test := range []struct {
+		metric   string
+		value    uint64
+		tag      string
+		tagValue string
+	}{
+		{"cadvisor.cpu.usage.total", 300, "", ""},
+		{"cadvisor.cpu.usage.user", 200, "", ""},
+		{"cadvisor.memory.working_set", 3072, "", ""},
+		{"cadvisor.tasks.sleeping", 3, "", ""},
+		{"cadvisor.network.rx_bytes", 10, "interface", "eth0"},
+		{"cadvisor.network.tx_bytes", 20, "interface", "eth0"},
+		{"cadvisor.filesystem.usage", 500, "device", "/dev/sda1"},
+	} {
+		tags := make(map[string]string)
+		for k, v := range containerTags {
+			tags[k] = v
+		}
+		if test.tag != "" {
+			tags[test.tag] = test.tagValue
+		}
+		expected := rejectedPoint{test.metric, tags}
+		p, ok := got[expected.String()]
+		if !ok {
+			t.Errorf("no datapoint %s", expected)
+			continue
+		}
+		if p.Value != test.value {
+			t.Errorf("%s: expected %d, got %d", expected, test.value, p.Value)
+		}
+	}
+	if len(points) != 20 {
+		t.Errorf("expected 20 datapoints, got %d", len(points))
+	}
+}
+
+func TestChunking(t *testing.T) {
+	fake := &fakeOpenTSDB{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	driver := newTestStorage(t, server, nil, 8, time.Hour)
+
+	// The 10 datapoints of the stats without network nor filesystem are
+	// written as soon as they are buffered, in 2 requests.
+	stats := &info.ContainerStats{Timestamp: time.Now()}
+	if err := driver.AddStats(testRef, stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.requests) != 2 {
+		t.Fatalf("expected 2 requests once 8 datapoints are buffered, got %d", len(fake.requests))
+	}
+	if err := driver.AddStats(testRef, testStats); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range fake.requests {
+		if len(r) > 8 {
+			t.Errorf("request %d has %d datapoints, expected at most 8", i, len(r))
+		}
+	}
+	if n := len(fake.points()); n != 30 {
+		t.Errorf("expected the 30 datapoints to be written, got %d", n)
+	}
+}
+
+func TestPartialRejection(t *testing.T) {
+	fake := &fakeOpenTSDB{reject: map[string]bool{"cadvisor.memory.rss": true, "cadvisor.memory.cache": true}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	driver := newTestStorage(t, server, nil, 50, 0)
+
+	err := driver.AddStats(testRef, testStats)
+	if err == nil || !strings.Contains(err.Error(), "rejected 2 of 20 datapoints") {
+		t.Errorf("expected the rejected datapoints to be counted, got %v", err)
+	}
+}
+
+func TestRequestErrors(t *testing.T) {
+	fake := &fakeOpenTSDB{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	driver := newTestStorage(t, server, nil, 50, 0)
+
+	err := driver.AddStats(testRef, testStats)
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("expected the status in the error, got %v", err)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	fake := &fakeOpenTSDB{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	cfg := testConfig(strings.TrimPrefix(server.URL, "http://"))
+	cfg.username = "user"
+	cfg.password = "secret"
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.AddStats(testRef, testStats); err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"Basic dXNlcjpzZWNyZXQ="}; !reflect.DeepEqual(fake.auth, expected) {
+		t.Errorf("expected %v, got %v", expected, fake.auth)
+	}
+}
+
+func TestNewStorageValidation(t *testing.T) {
+	for _, labels := range [][]string{
+		{"a", "b", "c", "d", "e", "f"},
+		{"host"},
+		{"container_name"},
+	} {
+		cfg := testConfig("localhost:4242")
+		cfg.labels = labels
+		if _, err := newStorage(cfg); err == nil {
+			t.Errorf("expected an error for the labels %v", labels)
+		}
+	}
+	cfg := testConfig("localhost:4242")
+	cfg.maxDatapoints = 0
+	if _, err := newStorage(cfg); err == nil {
+		t.Error("expected an error without datapoints per request")
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	for in, expected := range map[string]string{
+		"/docker/abc":  "/docker/abc",
+		"a b:c=d":      "a_b_c_d",
+		"café":         "café",
+		"io.k8s-pod_1": "io.k8s-pod_1",
+	} {
+		if got := sanitize(in); got != expected {
+			t.Errorf("sanitize(%q): expected %q, got %q", in, expected, got)
+		}
+	}
+}
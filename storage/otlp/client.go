@@ -0,0 +1,333 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/cadvisor/storage/otlp/otlppb"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	// Method of the OTLP metrics service.
+	exportMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+	// Backoff before retrying a failed export, doubled after every
+	// attempt up to maxBackoff.
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+	// Minimum time between the logs of the export errors.
+	errorLogInterval = time.Minute
+)
+
+// exporter sends export requests to an OTLP receiver.
+type exporter interface {
+	export(req *otlppb.ExportMetricsServiceRequest) (*otlppb.ExportMetricsServiceResponse, error)
+	close() error
+}
+
+// exportError is the error of a failed export, which may be retried if
+// the receiver was unavailable or throttled the export.
+type exportError struct {
+	err       error
+	retryable bool
+}
+
+func (self *exportError) Error() string {
+	return self.err.Error()
+}
+
+// retryable returns whether an export which failed with an error can be
+// retried, which transport errors can.
+func retryable(err error) bool {
+	exportErr, ok := err.(*exportError)
+	return !ok || exportErr.retryable
+}
+
+// grpcExporter exports with OTLP/gRPC.
+type grpcExporter struct {
+	conn    *grpc.ClientConn
+	headers metadata.MD
+	timeout time.Duration
+}
+
+// newGrpcExporter returns an exporter to the host:port endpoint, using TLS
+// if tlsConfig is not nil.
+func newGrpcExporter(endpoint string, tlsConfig *tls.Config, headers map[string]string, timeout time.Duration) (*grpcExporter, error) {
+	// Without a dial timeout, the connection is retried in background until
+	// it is closed, rather than shut down once the receiver was unreachable
+	// for the timeout; the exports time out meanwhile.
+	option := grpc.WithInsecure()
+	if tlsConfig != nil {
+		option = grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))
+	}
+	conn, err := grpc.Dial(endpoint, option)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to OTLP receiver %q - %v", endpoint, err)
+	}
+	return &grpcExporter{
+		conn:    conn,
+		headers: metadata.New(headers),
+		timeout: timeout,
+	}, nil
+}
+
+func (self *grpcExporter) export(req *otlppb.ExportMetricsServiceRequest) (*otlppb.ExportMetricsServiceResponse, error) {
+	ctx, cancel := context.WithTimeout(metadata.NewContext(context.Background(), self.headers), self.timeout)
+	defer cancel()
+	resp := &otlppb.ExportMetricsServiceResponse{}
+	if err := grpc.Invoke(ctx, exportMethod, req, resp, self.conn); err != nil {
+		// The codes the OTLP specification allows to retry.
+		switch grpc.Code(err) {
+		case codes.Canceled, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.OutOfRange, codes.Unavailable, codes.DataLoss:
+			return nil, &exportError{err, true}
+		case codes.Unknown:
+			// Errors of the transport, e.g. failing to connect.
+			return nil, err
+		}
+		return nil, &exportError{err, false}
+	}
+	return resp, nil
+}
+
+func (self *grpcExporter) close() error {
+	return self.conn.Close()
+}
+
+// httpExporter exports with OTLP/HTTP, in binary protobuf.
+type httpExporter struct {
+	client  *http.Client
+	url     string
+	headers map[string]string
+}
+
+func newHttpExporter(url string, tlsConfig *tls.Config, headers map[string]string, timeout time.Duration) *httpExporter {
+	return &httpExporter{
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: tlsConfig,
+			},
+			Timeout: timeout,
+		},
+		url:     url,
+		headers: headers,
+	}
+}
+
+func (self *httpExporter) export(req *otlppb.ExportMetricsServiceRequest) (*otlppb.ExportMetricsServiceResponse, error) {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return nil, &exportError{err, false}
+	}
+	httpReq, err := http.NewRequest("POST", self.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, &exportError{err, false}
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	for name, value := range self.headers {
+		httpReq.Header.Set(name, value)
+	}
+	httpResp, err := self.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	b, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("OTLP receiver returned %s: %s", httpResp.Status, bytes.TrimSpace(b))
+		switch httpResp.StatusCode {
+		// The statuses the OTLP specification allows to retry.
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return nil, &exportError{err, true}
+		}
+		return nil, &exportError{err, false}
+	}
+	resp := &otlppb.ExportMetricsServiceResponse{}
+	if err := proto.Unmarshal(b, resp); err != nil {
+		return nil, &exportError{fmt.Errorf("failed to decode the response of the OTLP receiver - %v", err), false}
+	}
+	return resp, nil
+}
+
+func (self *httpExporter) close() error {
+	return nil
+}
+
+// batcher exports the metrics of the containers in batches, from a queue
+// which drops the metrics when full, e.g. while the receiver is down.
+type batcher struct {
+	exporter      exporter
+	batchSize     int
+	flushInterval time.Duration
+	retryTimeout  time.Duration
+
+	queue chan *otlppb.ResourceMetrics
+	done  chan struct{}
+
+	// Counts of the metrics of containers exported, failed to be
+	// exported after retries, and dropped because the queue was full.
+	exported uint64
+	failed   uint64
+	dropped  uint64
+	// Counts when the errors were last logged, and the last error.
+	logLock      sync.Mutex
+	lastLog      time.Time
+	lastErr      error
+	loggedFailed uint64
+	loggedDrop   uint64
+}
+
+func newBatcher(exporter exporter, batchSize int, flushInterval, retryTimeout time.Duration, maxQueue int) *batcher {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	if maxQueue < batchSize {
+		maxQueue = batchSize
+	}
+	self := &batcher{
+		exporter:      exporter,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		retryTimeout:  retryTimeout,
+		queue:         make(chan *otlppb.ResourceMetrics, maxQueue),
+		done:          make(chan struct{}),
+	}
+	go self.run()
+	return self
+}
+
+// add queues the metrics of a container, dropping them if the queue is
+// full.
+func (self *batcher) add(metrics *otlppb.ResourceMetrics) {
+	select {
+	case self.queue <- metrics:
+	default:
+		atomic.AddUint64(&self.dropped, 1)
+		self.logErrors(false)
+	}
+}
+
+// run batches the queued metrics, and exports the batches, until the queue
+// is closed and empty.
+func (self *batcher) run() {
+	defer close(self.done)
+	var batch []*otlppb.ResourceMetrics
+	var timer *time.Timer
+	var deadline <-chan time.Time
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, deadline = nil, nil
+		}
+		if len(batch) > 0 {
+			self.send(batch)
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case metrics, ok := <-self.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, metrics)
+			if len(batch) >= self.batchSize {
+				flush()
+			} else if len(batch) == 1 {
+				timer = time.NewTimer(self.flushInterval)
+				deadline = timer.C
+			}
+		case <-deadline:
+			flush()
+		}
+	}
+}
+
+// send exports a batch, retrying it with backoff for at most the retry
+// timeout.
+func (self *batcher) send(batch []*otlppb.ResourceMetrics) {
+	req := &otlppb.ExportMetricsServiceRequest{ResourceMetrics: batch}
+	deadline := time.Now().Add(self.retryTimeout)
+	backoff := minBackoff
+	var resp *otlppb.ExportMetricsServiceResponse
+	var err error
+	for {
+		if resp, err = self.exporter.export(req); err == nil || !retryable(err) || time.Now().Add(backoff).After(deadline) {
+			break
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+	if err == nil {
+		atomic.AddUint64(&self.exported, uint64(len(batch)))
+		if partial := resp.PartialSuccess; partial != nil && (partial.RejectedDataPoints > 0 || partial.ErrorMessage != "") {
+			glog.Warningf("OTLP receiver rejected %d data points: %s", partial.RejectedDataPoints, partial.ErrorMessage)
+		}
+		return
+	}
+	atomic.AddUint64(&self.failed, uint64(len(batch)))
+	self.logLock.Lock()
+	self.lastErr = err
+	self.logLock.Unlock()
+	self.logErrors(false)
+}
+
+// logErrors logs the counts of the metrics failed and dropped since the
+// last log, at most every errorLogInterval unless forced.
+func (self *batcher) logErrors(force bool) {
+	self.logLock.Lock()
+	defer self.logLock.Unlock()
+	if !force && time.Since(self.lastLog) < errorLogInterval {
+		return
+	}
+	failed, dropped := atomic.LoadUint64(&self.failed), atomic.LoadUint64(&self.dropped)
+	if failed == self.loggedFailed && dropped == self.loggedDrop {
+		return
+	}
+	glog.Errorf("OTLP: the metrics of %d containers failed to be exported and of %d were dropped because %d were queued, last error: %v",
+		failed-self.loggedFailed, dropped-self.loggedDrop, cap(self.queue), self.lastErr)
+	self.lastLog = time.Now()
+	self.loggedFailed, self.loggedDrop = failed, dropped
+}
+
+// close exports the queued metrics, waits for them, and closes the
+// exporter.
+func (self *batcher) close() error {
+	close(self.queue)
+	<-self.done
+	self.logErrors(true)
+	return self.exporter.close()
+}
@@ -0,0 +1,218 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/storage/otlp/otlppb"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// fakeGrpcReceiver is an OTLP/gRPC metrics service, which fails the
+// exports with the codes given, then succeeds.
+type fakeGrpcReceiver struct {
+	lock     sync.Mutex
+	codes    []codes.Code
+	requests []*otlppb.ExportMetricsServiceRequest
+	metadata []metadata.MD
+}
+
+type metricsServiceServer interface {
+	export(ctx context.Context, req *otlppb.ExportMetricsServiceRequest) (*otlppb.ExportMetricsServiceResponse, error)
+}
+
+func (self *fakeGrpcReceiver) export(ctx context.Context, req *otlppb.ExportMetricsServiceRequest) (*otlppb.ExportMetricsServiceResponse, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	md, _ := metadata.FromContext(ctx)
+	self.metadata = append(self.metadata, md)
+	if len(self.codes) > 0 {
+		code := self.codes[0]
+		self.codes = self.codes[1:]
+		return nil, grpc.Errorf(code, "failed")
+	}
+	self.requests = append(self.requests, req)
+	return &otlppb.ExportMetricsServiceResponse{}, nil
+}
+
+func (self *fakeGrpcReceiver) received() []*otlppb.ExportMetricsServiceRequest {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.requests
+}
+
+var metricsServiceDesc = grpc.ServiceDesc{
+	ServiceName: "opentelemetry.proto.collector.metrics.v1.MetricsService",
+	HandlerType: (*metricsServiceServer)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "Export",
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error) (interface{}, error) {
+			req := &otlppb.ExportMetricsServiceRequest{}
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			return srv.(metricsServiceServer).export(ctx, req)
+		},
+	}},
+}
+
+// startGrpcReceiver serves a fake receiver, and returns its address.
+func startGrpcReceiver(t *testing.T, receiver *fakeGrpcReceiver) (string, *grpc.Server) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	server.RegisterService(&metricsServiceDesc, receiver)
+	go server.Serve(listener)
+	return listener.Addr().String(), server
+}
+
+func testMetrics(n int) []*otlppb.ResourceMetrics {
+	ret := make([]*otlppb.ResourceMetrics, n)
+	for i := range ret {
+		ret[i] = &otlppb.ResourceMetrics{
+			Resource: &otlppb.Resource{Attributes: []*otlppb.KeyValue{stringAttribute("container.id", strconv.Itoa(i))}},
+		}
+	}
+	return ret
+}
+
+func TestGrpcExporter(t *testing.T) {
+	receiver := &fakeGrpcReceiver{codes: []codes.Code{codes.Unavailable}}
+	address, server := startGrpcReceiver(t, receiver)
+	defer server.Stop()
+
+	exporter, err := newGrpcExporter(address, nil, map[string]string{"X-Scope-OrgID": "tenant"}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := newBatcher(exporter, 3, time.Hour, 10*time.Second, 10)
+	for _, metrics := range testMetrics(3) {
+		b.add(metrics)
+	}
+	if err := b.close(); err != nil {
+		t.Fatal(err)
+	}
+	requests := receiver.received()
+	if len(requests) != 1 || len(requests[0].ResourceMetrics) != 3 {
+		t.Fatalf("expected a request of 3 containers after a retry, got %v", requests)
+	}
+	if b.exported != 3 || b.failed != 0 {
+		t.Errorf("expected 3 containers exported, got %d exported and %d failed", b.exported, b.failed)
+	}
+	if got := receiver.metadata[0]["x-scope-orgid"]; len(got) != 1 || got[0] != "tenant" {
+		t.Errorf("expected the header as metadata, got %v", receiver.metadata[0])
+	}
+}
+
+func TestGrpcExporterPermanentError(t *testing.T) {
+	receiver := &fakeGrpcReceiver{codes: []codes.Code{codes.InvalidArgument}}
+	address, server := startGrpcReceiver(t, receiver)
+	defer server.Stop()
+
+	exporter, err := newGrpcExporter(address, nil, nil, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporter.close()
+	_, err = exporter.export(&otlppb.ExportMetricsServiceRequest{ResourceMetrics: testMetrics(1)})
+	if err == nil || retryable(err) {
+		t.Errorf("expected an error which can not be retried, got %v", err)
+	}
+}
+
+func TestHttpExporterRetries(t *testing.T) {
+	receiver := &fakeReceiver{statuses: []int{http.StatusServiceUnavailable, http.StatusBadRequest}}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	b := newBatcher(newHttpExporter(server.URL, nil, nil, time.Second), 2, time.Hour, 10*time.Second, 10)
+	for _, metrics := range testMetrics(4) {
+		b.add(metrics)
+	}
+	b.close()
+	// The first batch is retried after 503, then fails on 400, the second
+	// one is exported.
+	if requests := receiver.received(); len(requests) != 1 || len(requests[0].ResourceMetrics) != 2 {
+		t.Fatalf("expected a request of 2 containers, got %v", requests)
+	}
+	if b.exported != 2 || b.failed != 2 {
+		t.Errorf("expected 2 containers exported and 2 failed, got %d and %d", b.exported, b.failed)
+	}
+}
+
+func TestBatcherFlushInterval(t *testing.T) {
+	receiver := &fakeReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	b := newBatcher(newHttpExporter(server.URL, nil, nil, time.Second), 10, 10*time.Millisecond, time.Second, 10)
+	defer b.close()
+	b.add(testMetrics(1)[0])
+	for start := time.Now(); len(receiver.received()) == 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the batch was not exported after the flush interval")
+		}
+	}
+}
+
+// blockingExporter blocks the exports until released.
+type blockingExporter struct {
+	release chan struct{}
+}
+
+func (self *blockingExporter) export(*otlppb.ExportMetricsServiceRequest) (*otlppb.ExportMetricsServiceResponse, error) {
+	<-self.release
+	return &otlppb.ExportMetricsServiceResponse{}, nil
+}
+
+func (self *blockingExporter) close() error {
+	return nil
+}
+
+func TestBatcherQueueFull(t *testing.T) {
+	exporter := &blockingExporter{make(chan struct{})}
+	b := newBatcher(exporter, 1, time.Hour, time.Second, 2)
+	done := make(chan struct{})
+	go func() {
+		// A dead receiver must not block the callers.
+		for _, metrics := range testMetrics(10) {
+			b.add(metrics)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("adding metrics blocked while the receiver was down")
+	}
+	close(exporter.release)
+	b.close()
+	if b.dropped < 7 || b.exported+b.dropped != 10 {
+		t.Errorf("expected at least 7 of 10 containers dropped, got %d dropped and %d exported", b.dropped, b.exported)
+	}
+}
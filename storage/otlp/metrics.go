@@ -0,0 +1,246 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/info/v2"
+	"github.com/google/cadvisor/metrics"
+	"github.com/google/cadvisor/storage/otlp/otlppb"
+	"github.com/google/cadvisor/utils/container"
+	"github.com/google/cadvisor/version"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+//go:generate protoc --proto_path=otlppb --go_out=otlppb otlppb/metrics.proto
+
+// Families of the Prometheus collector which are not about a container, and
+// are not exported.
+var skippedFamilies = map[string]bool{
+	"cadvisor_version_info":  true,
+	"container_scrape_error": true,
+	"machine_cpu_cores":      true,
+	"machine_memory_bytes":   true,
+}
+
+// Family of the creation time of the containers, only exported when their
+// specification is known.
+const startTimeFamily = "container_start_time_seconds"
+
+// scope is the instrumentation scope of the metrics.
+var scope = &otlppb.InstrumentationScope{
+	Name:    "github.com/google/cadvisor",
+	Version: version.Info["version"],
+}
+
+// containerProvider gives the Prometheus collector a single container.
+type containerProvider struct {
+	container *info.ContainerInfo
+}
+
+func (self *containerProvider) SubcontainersInfo(string, *info.ContainerInfoRequest) ([]*info.ContainerInfo, error) {
+	return []*info.ContainerInfo{self.container}, nil
+}
+
+func (self *containerProvider) GetVersionInfo() (*info.VersionInfo, error) {
+	return &info.VersionInfo{}, nil
+}
+
+func (self *containerProvider) GetMachineInfo() (*info.MachineInfo, error) {
+	return &info.MachineInfo{}, nil
+}
+
+// converter converts the stats of the containers to OTLP metrics by
+// collecting them with the Prometheus collector of the /metrics endpoint,
+// so that the metrics have the same names and types as when they are
+// scraped. The labels identifying the container are attributes of the
+// resource of its metrics, the others attributes of their points.
+type converter struct {
+	lock        sync.Mutex
+	provider    *containerProvider
+	registry    *prometheus.Registry
+	machineName string
+	starts      *startTracker
+}
+
+func newConverter(machineName string) (*converter, error) {
+	provider := &containerProvider{}
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(metrics.NewPrometheusCollector(provider, nil)); err != nil {
+		return nil, err
+	}
+	return &converter{
+		provider:    provider,
+		registry:    registry,
+		machineName: machineName,
+		starts:      newStartTracker(),
+	}, nil
+}
+
+// resourceMetrics returns the metrics of the stats of a container, with a
+// single point each.
+func (self *converter) resourceMetrics(ref info.ContainerReference, spec *v2.ContainerSpec, stats *info.ContainerStats) (*otlppb.ResourceMetrics, error) {
+	self.lock.Lock()
+	self.provider.container = &info.ContainerInfo{
+		ContainerReference: ref,
+		Spec:               specToV1(ref, spec),
+		Stats:              []*info.ContainerStats{stats},
+	}
+	families, err := self.registry.Gather()
+	self.provider.container = nil
+	self.lock.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect the metrics of container %q - %s", ref.Name, err)
+	}
+
+	var created time.Time
+	if spec != nil {
+		created = spec.CreationTime
+	}
+	timestamp := uint64(stats.Timestamp.UnixNano())
+	containerLabels := make(map[string]string)
+	var ret []*otlppb.Metric
+	for _, family := range families {
+		name := family.GetName()
+		if skippedFamilies[name] || (spec == nil && name == startTimeFamily) {
+			continue
+		}
+		metric := &otlppb.Metric{
+			Name:        name,
+			Description: family.GetHelp(),
+			Unit:        unit(name),
+		}
+		var points []*otlppb.NumberDataPoint
+		for _, m := range family.Metric {
+			point := &otlppb.NumberDataPoint{TimeUnixNano: timestamp}
+			var key []string
+			for _, pair := range m.Label {
+				if isContainerLabel(pair.GetName()) {
+					containerLabels[pair.GetName()] = pair.GetValue()
+					continue
+				}
+				point.Attributes = append(point.Attributes, stringAttribute(pair.GetName(), pair.GetValue()))
+				key = append(key, pair.GetName()+"="+pair.GetValue())
+			}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				value := m.Counter.GetValue()
+				point.Value = &otlppb.NumberDataPoint_AsDouble{AsDouble: value}
+				start := self.starts.start(ref.Name, name+"\x00"+strings.Join(key, "\x00"), created, stats.Timestamp, value)
+				point.StartTimeUnixNano = uint64(start.UnixNano())
+			case dto.MetricType_GAUGE:
+				point.Value = &otlppb.NumberDataPoint_AsDouble{AsDouble: m.Gauge.GetValue()}
+			case dto.MetricType_UNTYPED:
+				point.Value = &otlppb.NumberDataPoint_AsDouble{AsDouble: m.Untyped.GetValue()}
+			default:
+				return nil, fmt.Errorf("failed to convert metric %q - unsupported metric type %s", name, family.GetType())
+			}
+			points = append(points, point)
+		}
+		if family.GetType() == dto.MetricType_COUNTER {
+			metric.Data = &otlppb.Metric_Sum{Sum: &otlppb.Sum{
+				DataPoints:             points,
+				AggregationTemporality: otlppb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				IsMonotonic:            true,
+			}}
+		} else {
+			metric.Data = &otlppb.Metric_Gauge{Gauge: &otlppb.Gauge{DataPoints: points}}
+		}
+		ret = append(ret, metric)
+	}
+	return &otlppb.ResourceMetrics{
+		Resource: &otlppb.Resource{Attributes: self.resourceAttributes(ref, containerLabels)},
+		ScopeMetrics: []*otlppb.ScopeMetrics{{
+			Scope:   scope,
+			Metrics: ret,
+		}},
+	}, nil
+}
+
+// isContainerLabel returns whether a label of the collector identifies the
+// container rather than a point of a metric.
+func isContainerLabel(name string) bool {
+	switch name {
+	case metrics.LabelID, metrics.LabelName, metrics.LabelImage:
+		return true
+	}
+	return strings.HasPrefix(name, metrics.ContainerLabelPrefix) || strings.HasPrefix(name, metrics.ContainerEnvPrefix)
+}
+
+// resourceAttributes returns the attributes of the resource of the metrics
+// of a container, of the OpenTelemetry semantic conventions, sorted by key.
+func (self *converter) resourceAttributes(ref info.ContainerReference, labels map[string]string) []*otlppb.KeyValue {
+	attributes := map[string]string{
+		"service.name":   "cadvisor",
+		"host.name":      self.machineName,
+		"container.name": container.GetPreferredName(ref),
+	}
+	if ref.Id != "" {
+		attributes["container.id"] = ref.Id
+	}
+	if ref.Namespace != "" {
+		attributes["container.runtime"] = ref.Namespace
+	}
+	for name, value := range labels {
+		switch {
+		case name == metrics.LabelImage:
+			attributes["container.image.name"] = value
+		case strings.HasPrefix(name, metrics.ContainerLabelPrefix):
+			attributes["container.label."+strings.TrimPrefix(name, metrics.ContainerLabelPrefix)] = value
+		case strings.HasPrefix(name, metrics.ContainerEnvPrefix):
+			attributes["container.env."+strings.TrimPrefix(name, metrics.ContainerEnvPrefix)] = value
+		}
+	}
+	keys := make([]string, 0, len(attributes))
+	for key, value := range attributes {
+		if value != "" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	ret := make([]*otlppb.KeyValue, 0, len(keys))
+	for _, key := range keys {
+		ret = append(ret, stringAttribute(key, attributes[key]))
+	}
+	return ret
+}
+
+func stringAttribute(key, value string) *otlppb.KeyValue {
+	return &otlppb.KeyValue{
+		Key:   key,
+		Value: &otlppb.AnyValue{Value: &otlppb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+// unit returns the unit of a metric, of the UCUM units of OTLP, from the
+// suffix of its Prometheus name.
+func unit(name string) string {
+	name = strings.TrimSuffix(name, "_total")
+	switch {
+	case strings.HasSuffix(name, "_seconds"):
+		return "s"
+	case strings.HasSuffix(name, "_bytes"):
+		return "By"
+	}
+	return ""
+}
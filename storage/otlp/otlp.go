@@ -0,0 +1,215 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+)
+
+func init() {
+	storage.RegisterStorageDriver("otlp", new)
+}
+
+// Protocols of the OTLP receiver.
+const (
+	protocolGrpc = "grpc"
+	protocolHttp = "http/protobuf"
+)
+
+var (
+	argProtocol           = flag.String("storage_driver_otlp_protocol", protocolGrpc, "protocol of the OTLP receiver, grpc or http/protobuf")
+	argEndpoint           = flag.String("storage_driver_otlp_endpoint", "", "endpoint of the OTLP receiver, host:port for grpc or the URL for http/protobuf; default is localhost:4317 or http://localhost:4318/v1/metrics")
+	argTLS                = flag.Bool("storage_driver_otlp_tls", false, "use TLS to connect to the gRPC receiver, which an https URL does for http/protobuf")
+	argCaFile             = flag.String("storage_driver_otlp_ssl_ca", "", "optional certificate authority file used to verify the OTLP receiver certificate")
+	argCertFile           = flag.String("storage_driver_otlp_ssl_cert", "", "optional certificate file for OTLP TLS client authentication")
+	argKeyFile            = flag.String("storage_driver_otlp_ssl_key", "", "optional key file for OTLP TLS client authentication")
+	argInsecureSkipVerify = flag.Bool("storage_driver_otlp_ssl_insecure_skip_verify", false, "do not verify the OTLP receiver certificate chain and host name")
+	argHeaders            = flag.String("storage_driver_otlp_headers", "", "headers of the export requests, e.g. for authentication, as comma separated name=value pairs")
+	argTimeout            = flag.Duration("storage_driver_otlp_timeout", 10*time.Second, "timeout of an export request")
+	argBatchSize          = flag.Int("storage_driver_otlp_batch_size", 100, "maximum number of containers whose metrics are exported per request")
+	argFlushInterval      = flag.Duration("storage_driver_otlp_flush_interval", 5*time.Second, "maximum time the metrics wait for a batch to fill up before they are exported")
+	argMaxQueue           = flag.Int("storage_driver_otlp_max_queue", 1000, "maximum number of containers whose metrics wait to be exported, further metrics are dropped")
+	argRetryTimeout       = flag.Duration("storage_driver_otlp_retry_timeout", time.Minute, "time a failed export is retried for before its metrics are dropped")
+)
+
+type otlpStorage struct {
+	converter *converter
+	batcher   *batcher
+	specs     storage.ContainerSpecCache
+}
+
+func new() (storage.StorageDriver, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	headers, err := parseHeaders(*argHeaders)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := generateTLSConfig(*argTLS, *argCaFile, *argCertFile, *argKeyFile, *argInsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+	return newStorage(config{
+		machineName:   hostname,
+		protocol:      *argProtocol,
+		endpoint:      *argEndpoint,
+		tlsConfig:     tlsConfig,
+		headers:       headers,
+		timeout:       *argTimeout,
+		batchSize:     *argBatchSize,
+		flushInterval: *argFlushInterval,
+		maxQueue:      *argMaxQueue,
+		retryTimeout:  *argRetryTimeout,
+	})
+}
+
+// parseHeaders parses comma separated name=value pairs.
+func parseHeaders(s string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		i := strings.Index(pair, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("invalid OTLP header %q, must be name=value", pair)
+		}
+		headers[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+	}
+	return headers, nil
+}
+
+// generateTLSConfig returns the TLS configuration of the connection, or nil
+// if TLS is not enabled and no TLS option is set.
+func generateTLSConfig(enabled bool, caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	if !enabled && caFile == "" && certFile == "" && keyFile == "" && !insecureSkipVerify {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: insecureSkipVerify}
+	if caFile != "" {
+		caCert, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificate found in %q", caFile)
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func (self *otlpStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	if stats == nil {
+		return nil
+	}
+	spec := self.specs.Spec(ref.Name, time.Now())
+	metrics, err := self.converter.resourceMetrics(ref, spec, stats)
+	if err != nil {
+		return err
+	}
+	self.batcher.add(metrics)
+	return nil
+}
+
+func (self *otlpStorage) Close() error {
+	// Exports the queued metrics.
+	return self.batcher.close()
+}
+
+// config is the configuration of the driver, populated from the flags.
+type config struct {
+	// A unique identifier to identify the host that current cAdvisor
+	// instance is running on, the host.name attribute of the resources.
+	machineName string
+	// The protocol of the OTLP receiver, grpc or http/protobuf.
+	protocol string
+	// The host:port of the gRPC receiver or the URL of the HTTP one, the
+	// default one of the protocol if empty.
+	endpoint string
+	// The TLS configuration of the connection, TLS is not used with gRPC if nil.
+	tlsConfig *tls.Config
+	// The headers of the export requests.
+	headers map[string]string
+	// The timeout of an export request.
+	timeout time.Duration
+	// The maximum number of containers whose metrics are exported per request.
+	batchSize int
+	// The maximum time the metrics wait for a batch to fill up.
+	flushInterval time.Duration
+	// The maximum number of containers whose metrics wait to be exported.
+	maxQueue int
+	// The time a failed export is retried for.
+	retryTimeout time.Duration
+}
+
+// Create a new OTLP storage driver.
+func newStorage(cfg config) (*otlpStorage, error) {
+	if cfg.batchSize <= 0 || cfg.maxQueue <= 0 || cfg.flushInterval <= 0 || cfg.timeout <= 0 {
+		return nil, fmt.Errorf("the OTLP batch size, queue size, flush interval and timeout must be positive")
+	}
+	var exporter exporter
+	switch cfg.protocol {
+	case protocolGrpc:
+		if cfg.endpoint == "" {
+			cfg.endpoint = "localhost:4317"
+		}
+		grpcExporter, err := newGrpcExporter(cfg.endpoint, cfg.tlsConfig, cfg.headers, cfg.timeout)
+		if err != nil {
+			return nil, err
+		}
+		exporter = grpcExporter
+	case protocolHttp:
+		if cfg.endpoint == "" {
+			cfg.endpoint = "http://localhost:4318/v1/metrics"
+		}
+		if u, err := url.Parse(cfg.endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid OTLP receiver URL %q, must be http or https", cfg.endpoint)
+		}
+		exporter = newHttpExporter(cfg.endpoint, cfg.tlsConfig, cfg.headers, cfg.timeout)
+	default:
+		return nil, fmt.Errorf("unknown OTLP protocol %q, must be %s or %s", cfg.protocol, protocolGrpc, protocolHttp)
+	}
+	converter, err := newConverter(cfg.machineName)
+	if err != nil {
+		exporter.close()
+		return nil, err
+	}
+	return &otlpStorage{
+		converter: converter,
+		batcher:   newBatcher(exporter, cfg.batchSize, cfg.flushInterval, cfg.retryTimeout, cfg.maxQueue),
+	}, nil
+}
@@ -0,0 +1,402 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/info/v2"
+	"github.com/google/cadvisor/metrics"
+	"github.com/google/cadvisor/storage/otlp/otlppb"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// fakeReceiver decodes the OTLP/HTTP export requests it receives, and
+// answers them with the statuses given, then with 200.
+type fakeReceiver struct {
+	lock     sync.Mutex
+	statuses []int
+	requests []*otlppb.ExportMetricsServiceRequest
+	headers  []http.Header
+}
+
+func (self *fakeReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.headers = append(self.headers, r.Header)
+	if len(self.statuses) > 0 {
+		status := self.statuses[0]
+		self.statuses = self.statuses[1:]
+		if status != http.StatusOK {
+			http.Error(w, "failed", status)
+			return
+		}
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &otlppb.ExportMetricsServiceRequest{}
+	if err := proto.Unmarshal(b, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	self.requests = append(self.requests, req)
+	resp, _ := proto.Marshal(&otlppb.ExportMetricsServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Write(resp)
+}
+
+func (self *fakeReceiver) received() []*otlppb.ExportMetricsServiceRequest {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.requests
+}
+
+type fakeContainerSpecSource struct {
+	specs map[string]v2.ContainerSpec
+}
+
+func (self *fakeContainerSpecSource) GetContainerSpec(containerName string, options v2.RequestOptions) (map[string]v2.ContainerSpec, error) {
+	spec, ok := self.specs[containerName]
+	if !ok {
+		return nil, fmt.Errorf("unknown container %q", containerName)
+	}
+	return map[string]v2.ContainerSpec{containerName: spec}, nil
+}
+
+var (
+	fixtureTime = time.Unix(1451606400, 123456789)
+	fixtureRef  = info.ContainerReference{
+		Id:        "abc",
+		Name:      "/docker/abc",
+		Aliases:   []string{"web", "abc"},
+		Namespace: "docker",
+		Labels:    map[string]string{"app": "shop"},
+	}
+	fixtureSpec = info.ContainerSpec{
+		CreationTime: time.Unix(1451600000, 0),
+		Labels:       map[string]string{"app": "shop"},
+		Envs:         map[string]string{"TIER": "front"},
+		HasCpu:       true,
+		Cpu:          info.CpuSpec{Limit: 1024, Period: 100000, Quota: 50000},
+		HasMemory:    true,
+		Memory:       info.MemorySpec{Limit: 1 << 30},
+		HasNetwork:   true,
+		Image:        "shop/web:1.0",
+	}
+	fixtureStats = &info.ContainerStats{
+		Timestamp: fixtureTime,
+		Cpu: info.CpuStats{
+			Usage: info.CpuUsage{
+				Total:  3000000000,
+				PerCpu: []uint64{1000000000, 2000000000},
+				User:   2000000000,
+				System: 1000000000,
+			},
+		},
+		Memory: info.MemoryStats{
+			Usage:      4096,
+			WorkingSet: 3072,
+		},
+		Network: info.NetworkStats{
+			Interfaces: []info.InterfaceStats{{
+				Name:    "eth0",
+				RxBytes: 100,
+				TxBytes: 200,
+			}},
+		},
+		Filesystem: []info.FsStats{{
+			Device: "/dev/sda1",
+			Limit:  1 << 20,
+			Usage:  1 << 10,
+		}},
+	}
+)
+
+// fixtureProvider gives a container to the Prometheus collector, the way
+// the container manager does for the /metrics endpoint.
+type fixtureProvider struct {
+	container *info.ContainerInfo
+}
+
+func (self fixtureProvider) SubcontainersInfo(string, *info.ContainerInfoRequest) ([]*info.ContainerInfo, error) {
+	return []*info.ContainerInfo{self.container}, nil
+}
+
+func (self fixtureProvider) GetVersionInfo() (*info.VersionInfo, error) {
+	return &info.VersionInfo{}, nil
+}
+
+func (self fixtureProvider) GetMachineInfo() (*info.MachineInfo, error) {
+	return &info.MachineInfo{}, nil
+}
+
+func fixtureSpecSource() *fakeContainerSpecSource {
+	return &fakeContainerSpecSource{map[string]v2.ContainerSpec{
+		fixtureRef.Name: v2.ContainerSpecFromV1(&fixtureSpec, fixtureRef.Aliases, fixtureRef.Namespace),
+	}}
+}
+
+// pointKey identifies a point by the name of its metric and its sorted
+// attributes or labels.
+func pointKey(name string, labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for l, v := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", l, v))
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// scraped returns the values and the types of the points the collector of
+// the /metrics endpoint exports for the fixture container, without the
+// labels identifying the container.
+func scraped(t *testing.T) (map[string]float64, map[string]dto.MetricType) {
+	registry := prometheus.NewRegistry()
+	container := &info.ContainerInfo{
+		ContainerReference: fixtureRef,
+		Spec:               fixtureSpec,
+		Stats:              []*info.ContainerStats{fixtureStats},
+	}
+	registry.MustRegister(metrics.NewPrometheusCollector(fixtureProvider{container}, nil))
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]float64)
+	types := make(map[string]dto.MetricType)
+	for _, family := range families {
+		if skippedFamilies[family.GetName()] {
+			continue
+		}
+		for _, m := range family.Metric {
+			labels := make(map[string]string)
+			for _, pair := range m.Label {
+				if !isContainerLabel(pair.GetName()) {
+					labels[pair.GetName()] = pair.GetValue()
+				}
+			}
+			key := pointKey(family.GetName(), labels)
+			types[key] = family.GetType()
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				values[key] = m.Counter.GetValue()
+			case dto.MetricType_GAUGE:
+				values[key] = m.Gauge.GetValue()
+			}
+		}
+	}
+	return values, types
+}
+
+// exportedPoint is a point of the export requests, with its metric.
+type exportedPoint struct {
+	resource *otlppb.Resource
+	metric   *otlppb.Metric
+	point    *otlppb.NumberDataPoint
+}
+
+func exported(requests []*otlppb.ExportMetricsServiceRequest) map[string]exportedPoint {
+	points := make(map[string]exportedPoint)
+	for _, req := range requests {
+		for _, rm := range req.ResourceMetrics {
+			for _, sm := range rm.ScopeMetrics {
+				for _, metric := range sm.Metrics {
+					var dataPoints []*otlppb.NumberDataPoint
+					if sum := metric.GetSum(); sum != nil {
+						dataPoints = sum.DataPoints
+					} else {
+						dataPoints = metric.GetGauge().GetDataPoints()
+					}
+					for _, point := range dataPoints {
+						points[pointKey(metric.Name, attributes(point.Attributes))] = exportedPoint{rm.Resource, metric, point}
+					}
+				}
+			}
+		}
+	}
+	return points
+}
+
+func attributes(kvs []*otlppb.KeyValue) map[string]string {
+	ret := make(map[string]string)
+	for _, kv := range kvs {
+		ret[kv.Key] = kv.Value.GetStringValue()
+	}
+	return ret
+}
+
+// testConfig returns the configuration of a driver exporting to endpoint
+// with protocol.
+func testConfig(protocol, endpoint string) config {
+	return config{
+		machineName:   "host",
+		protocol:      protocol,
+		endpoint:      endpoint,
+		timeout:       time.Second,
+		batchSize:     10,
+		flushInterval: time.Second,
+		maxQueue:      10,
+		retryTimeout:  time.Second,
+	}
+}
+
+func TestMetricsMatchCollector(t *testing.T) {
+	receiver := &fakeReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	cfg := testConfig(protocolHttp, server.URL+"/v1/metrics")
+	cfg.headers = map[string]string{"Authorization": "Bearer token"}
+	cfg.flushInterval = time.Hour
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.SetContainerSpecSource(fixtureSpecSource())
+	if err := driver.AddStats(fixtureRef, fixtureStats); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := receiver.received()
+	if len(requests) != 1 || len(requests[0].ResourceMetrics) != 1 {
+		t.Fatalf("expected a request with the metrics of a container, got %v", requests)
+	}
+	if got := receiver.headers[0].Get("Authorization"); got != "Bearer token" {
+		t.Errorf("expected the Authorization header, got %q", got)
+	}
+	resource := attributes(requests[0].ResourceMetrics[0].Resource.Attributes)
+	for name, value := range map[string]string{
+		"service.name":         "cadvisor",
+		"host.name":            "host",
+		"container.id":         "abc",
+		"container.name":       "web",
+		"container.runtime":    "docker",
+		"container.image.name": "shop/web:1.0",
+		"container.label.app":  "shop",
+		"container.env.TIER":   "front",
+	} {
+		if resource[name] != value {
+			t.Errorf("expected the resource attribute %s=%q, got %q", name, value, resource[name])
+		}
+	}
+
+	got := exported(requests)
+	expected, types := scraped(t)
+	for key, value := range expected {
+		p, ok := got[key]
+		if !ok {
+			t.Errorf("point %s was not exported", key)
+			continue
+		}
+		if p.point.GetAsDouble() != value {
+			t.Errorf("point %s: expected %v, got %v", key, value, p.point.GetAsDouble())
+		}
+		if p.point.TimeUnixNano != uint64(fixtureTime.UnixNano()) {
+			t.Errorf("point %s: expected the time %d, got %d", key, fixtureTime.UnixNano(), p.point.TimeUnixNano)
+		}
+		if types[key] == dto.MetricType_COUNTER {
+			sum := p.metric.GetSum()
+			if sum == nil || !sum.IsMonotonic || sum.AggregationTemporality != otlppb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE {
+				t.Errorf("point %s: expected a cumulative monotonic sum, got %v", key, p.metric)
+			}
+			if p.point.StartTimeUnixNano != uint64(fixtureSpec.CreationTime.UnixNano()) {
+				t.Errorf("point %s: expected the creation of the container as start time, got %d", key, p.point.StartTimeUnixNano)
+			}
+		} else if p.metric.GetGauge() == nil {
+			t.Errorf("point %s: expected a gauge, got %v", key, p.metric)
+		}
+	}
+	for key := range got {
+		if _, ok := expected[key]; !ok {
+			t.Errorf("unexpected point %s", key)
+		}
+	}
+	if p := got[pointKey("container_cpu_usage_seconds_total", map[string]string{"cpu": "cpu01"})]; p.metric.GetUnit() != "s" {
+		t.Errorf("expected the unit s of container_cpu_usage_seconds_total, got %q", p.metric.GetUnit())
+	}
+	if p := got[pointKey("container_memory_usage_bytes", nil)]; p.metric.GetUnit() != "By" {
+		t.Errorf("expected the unit By of container_memory_usage_bytes, got %q", p.metric.GetUnit())
+	}
+}
+
+func TestMetricsWithoutSpec(t *testing.T) {
+	converter, err := newConverter("host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics, err := converter.resourceMetrics(fixtureRef, nil, fixtureStats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := exported([]*otlppb.ExportMetricsServiceRequest{{ResourceMetrics: []*otlppb.ResourceMetrics{metrics}}})
+	for key := range got {
+		if strings.HasPrefix(key, startTimeFamily) || strings.HasPrefix(key, "container_spec_") {
+			t.Errorf("unexpected point %s without the specification", key)
+		}
+	}
+	// Without the creation time, the sums start at their first point.
+	p, ok := got[pointKey("container_network_receive_bytes_total", map[string]string{"interface": "eth0"})]
+	if !ok || p.point.StartTimeUnixNano != uint64(fixtureTime.UnixNano()) {
+		t.Errorf("expected container_network_receive_bytes_total to start at its first point, got %v", p.point)
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	headers, err := parseHeaders("Authorization=Bearer a=b, X-Scope-OrgID = tenant ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 2 || headers["Authorization"] != "Bearer a=b" || headers["X-Scope-OrgID"] != "tenant" {
+		t.Errorf("unexpected headers %v", headers)
+	}
+	if _, err := parseHeaders("Authorization"); err == nil {
+		t.Error("expected an error for a header without a value")
+	}
+}
+
+func TestNewStorageValidation(t *testing.T) {
+	for _, test := range []struct {
+		protocol, endpoint string
+		batchSize          int
+	}{
+		{"http/json", "", 10},
+		{protocolHttp, "collector:4318/v1/metrics", 10},
+		{protocolGrpc, "", 0},
+	} {
+		cfg := testConfig(test.protocol, test.endpoint)
+		cfg.batchSize = test.batchSize
+		if _, err := newStorage(cfg); err == nil {
+			t.Errorf("expected an error for %+v", test)
+		}
+	}
+}
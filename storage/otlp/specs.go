@@ -0,0 +1,64 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/info/v2"
+	"github.com/google/cadvisor/storage"
+)
+
+// SetContainerSpecSource lets the driver look up the specification of the
+// containers, which gives the image, labels and environment labels of their
+// resource, the series of their limits, and the start time of their
+// cumulative sums.
+func (self *otlpStorage) SetContainerSpecSource(source storage.ContainerSpecSource) {
+	self.specs.SetSource(source)
+}
+
+// specToV1 returns the specification of a container the way the Prometheus
+// collector is given it by the container manager. Without the
+// specification, the labels of the container reference stand in for those
+// of the specification, so that its series keep the same labels.
+func specToV1(ref info.ContainerReference, spec *v2.ContainerSpec) info.ContainerSpec {
+	if spec == nil {
+		return info.ContainerSpec{Labels: ref.Labels}
+	}
+	return info.ContainerSpec{
+		CreationTime: spec.CreationTime,
+		Labels:       spec.Labels,
+		Envs:         spec.Envs,
+		HasCpu:       spec.HasCpu,
+		Cpu: info.CpuSpec{
+			Limit:    spec.Cpu.Limit,
+			MaxLimit: spec.Cpu.MaxLimit,
+			Mask:     spec.Cpu.Mask,
+			Quota:    spec.Cpu.Quota,
+			Period:   spec.Cpu.Period,
+		},
+		HasMemory: spec.HasMemory,
+		Memory: info.MemorySpec{
+			Limit:       spec.Memory.Limit,
+			Reservation: spec.Memory.Reservation,
+			SwapLimit:   spec.Memory.SwapLimit,
+		},
+		HasCustomMetrics: spec.HasCustomMetrics,
+		CustomMetrics:    spec.CustomMetrics,
+		HasNetwork:       spec.HasNetwork,
+		HasFilesystem:    spec.HasFilesystem,
+		HasDiskIo:        spec.HasDiskIo,
+		Image:            spec.Image,
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"sync"
+	"time"
+)
+
+// The start times of the series of a container are forgotten once it has
+// not been seen for startExpiry, e.g. after it was removed.
+const startExpiry = 10 * time.Minute
+
+// sumPoint is the previous point of a cumulative sum.
+type sumPoint struct {
+	start     time.Time
+	timestamp time.Time
+	value     float64
+}
+
+type containerSums struct {
+	points map[string]sumPoint
+	seen   time.Time
+}
+
+// startTracker gives the cumulative sums of the containers their start
+// time: the creation of the container if it is known, or else the first
+// time the sum was seen, and the time of the previous point once the sum
+// was reset, e.g. by a restart of the container.
+type startTracker struct {
+	lock       sync.Mutex
+	containers map[string]*containerSums
+	lastSweep  time.Time
+	now        func() time.Time
+}
+
+func newStartTracker() *startTracker {
+	return &startTracker{
+		containers: make(map[string]*containerSums),
+		now:        time.Now,
+	}
+}
+
+// start returns the start time of a point of a sum of a container,
+// identified by its key, at a timestamp.
+func (self *startTracker) start(containerName, key string, created, timestamp time.Time, value float64) time.Time {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	now := self.now()
+	self.sweep(now)
+	sums, ok := self.containers[containerName]
+	if !ok {
+		sums = &containerSums{points: make(map[string]sumPoint)}
+		self.containers[containerName] = sums
+	}
+	sums.seen = now
+	previous, ok := sums.points[key]
+	switch {
+	case !ok:
+		previous.start = timestamp
+		if !created.IsZero() && created.Before(timestamp) {
+			previous.start = created
+		}
+	case !timestamp.After(previous.timestamp):
+		// Out of order, the sum keeps its start time.
+		return previous.start
+	case value < previous.value:
+		previous.start = previous.timestamp
+	}
+	sums.points[key] = sumPoint{previous.start, timestamp, value}
+	return previous.start
+}
+
+// sweep forgets the containers not seen for startExpiry, at most once every
+// startExpiry. Lock must be held.
+func (self *startTracker) sweep(now time.Time) {
+	if now.Sub(self.lastSweep) < startExpiry {
+		return
+	}
+	self.lastSweep = now
+	for name, sums := range self.containers {
+		if now.Sub(sums.seen) >= startExpiry {
+			delete(self.containers, name)
+		}
+	}
+}
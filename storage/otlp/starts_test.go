@@ -0,0 +1,62 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package otlp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStartTracker(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tracker := newStartTracker()
+	tracker.now = func() time.Time { return now }
+	created := time.Unix(900, 0)
+	at := func(s int64) time.Time { return time.Unix(s, 0) }
+
+	for _, test := range []struct {
+		timestamp time.Time
+		value     float64
+		expected  time.Time
+	}{
+		// The sum starts at the creation of the container.
+		{at(1000), 10, created},
+		{at(1010), 20, created},
+		// Out of order points keep the start time.
+		{at(1005), 15, created},
+		// Reset, e.g. by a restart, the sum starts after its last point.
+		{at(1020), 5, at(1010)},
+		{at(1030), 8, at(1010)},
+	} {
+		if got := tracker.start("/a", "cpu", created, test.timestamp, test.value); !got.Equal(test.expected) {
+			t.Errorf("point at %v of %v: expected the start %v, got %v", test.timestamp, test.value, test.expected, got)
+		}
+	}
+
+	// Without the creation time, the sum starts at its first point.
+	if got := tracker.start("/b", "cpu", time.Time{}, at(1000), 1); !got.Equal(at(1000)) {
+		t.Errorf("expected the first point as start, got %v", got)
+	}
+
+	// The containers not seen for startExpiry are forgotten.
+	now = now.Add(startExpiry)
+	tracker.start("/b", "cpu", time.Time{}, at(1700), 2)
+	if _, ok := tracker.containers["/a"]; ok {
+		t.Error("expected /a to be forgotten")
+	}
+	if _, ok := tracker.containers["/b"]; !ok {
+		t.Error("expected /b to be kept")
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const scramMechanism = "SCRAM-SHA-256"
+
+// md5Password returns the answer to an MD5 authentication request,
+// md5 followed by the hex MD5 of the hex MD5 of the password and the user,
+// and the salt.
+func md5Password(user, password string, salt []byte) string {
+	inner := md5.Sum([]byte(password + user))
+	outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), salt...))
+	return "md5" + hex.EncodeToString(outer[:])
+}
+
+// scramClient is the client side of a SCRAM-SHA-256 exchange, of RFC 5802
+// and RFC 7677, without channel binding. The password is used as is,
+// without SASLprep, which only changes non-ASCII passwords.
+type scramClient struct {
+	password        string
+	clientNonce     string
+	clientFirstBare string
+	// Signature the server must prove, and whether it did.
+	serverSignature []byte
+	verified        bool
+}
+
+func newScramClient(password string) (*scramClient, error) {
+	nonce := make([]byte, 18)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return &scramClient{password: password, clientNonce: base64.StdEncoding.EncodeToString(nonce)}, nil
+}
+
+// clientFirst returns the first message of the client. The user name is
+// the one of the startup message, so is left empty.
+func (self *scramClient) clientFirst() string {
+	self.clientFirstBare = "n=,r=" + self.clientNonce
+	return "n,," + self.clientFirstBare
+}
+
+// clientFinal returns the final message of the client, with its proof, of
+// the first message of the server.
+func (self *scramClient) clientFinal(serverFirst string) (string, error) {
+	attributes := scramAttributes(serverFirst)
+	nonce, encodedSalt, iterations := attributes["r"], attributes["s"], attributes["i"]
+	if !strings.HasPrefix(nonce, self.clientNonce) || len(nonce) == len(self.clientNonce) {
+		return "", errors.New("invalid SCRAM nonce of the PostgreSQL server")
+	}
+	salt, err := base64.StdEncoding.DecodeString(encodedSalt)
+	if err != nil {
+		return "", fmt.Errorf("invalid SCRAM salt of the PostgreSQL server - %v", err)
+	}
+	n, err := strconv.Atoi(iterations)
+	if err != nil || n <= 0 {
+		return "", fmt.Errorf("invalid SCRAM iteration count %q of the PostgreSQL server", iterations)
+	}
+	saltedPassword := scramHi(self.password, salt, n)
+	clientKey := scramHMAC(saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	withoutProof := "c=biws,r=" + nonce
+	authMessage := self.clientFirstBare + "," + serverFirst + "," + withoutProof
+	proof := scramHMAC(storedKey[:], authMessage)
+	for i := range proof {
+		proof[i] ^= clientKey[i]
+	}
+	self.serverSignature = scramHMAC(scramHMAC(saltedPassword, "Server Key"), authMessage)
+	return withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+// verifyServerFinal verifies the signature of the final message of the
+// server.
+func (self *scramClient) verifyServerFinal(serverFinal string) error {
+	attributes := scramAttributes(serverFinal)
+	if e, ok := attributes["e"]; ok {
+		return fmt.Errorf("SCRAM authentication failed: %s", e)
+	}
+	signature, err := base64.StdEncoding.DecodeString(attributes["v"])
+	if err != nil || self.serverSignature == nil || !hmac.Equal(signature, self.serverSignature) {
+		return errors.New("invalid SCRAM signature of the PostgreSQL server")
+	}
+	self.verified = true
+	return nil
+}
+
+func scramAttributes(message string) map[string]string {
+	attributes := make(map[string]string)
+	for _, attribute := range strings.Split(message, ",") {
+		if len(attribute) >= 2 && attribute[1] == '=' {
+			attributes[attribute[:1]] = attribute[2:]
+		}
+	}
+	return attributes
+}
+
+// scramHi is the Hi function of RFC 5802, PBKDF2 of RFC 2898 with
+// HMAC-SHA-256 and a single block of output.
+func scramHi(password string, salt []byte, iterations int) []byte {
+	h := hmac.New(sha256.New, []byte(password))
+	h.Write(salt)
+	h.Write([]byte{0, 0, 0, 1})
+	u := h.Sum(nil)
+	ret := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		h.Reset()
+		h.Write(u)
+		u = h.Sum(u[:0])
+		for j := range ret {
+			ret[j] ^= u[j]
+		}
+	}
+	return ret
+}
+
+func scramHMAC(key []byte, message string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(message))
+	return h.Sum(nil)
+}
@@ -0,0 +1,349 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+const (
+	protocolVersion = 196608
+	sslRequestCode  = 80877103
+	// Maximum size of a message of the server.
+	maxMessageSize = 64 << 20
+)
+
+// pgError is an ErrorResponse of the server. The connection is still
+// usable after it.
+type pgError struct {
+	severity string
+	code     string
+	message  string
+}
+
+func (self *pgError) Error() string {
+	return fmt.Sprintf("%s %s: %s", self.severity, self.code, self.message)
+}
+
+// conn is a connection to a PostgreSQL server, speaking the simple query
+// protocol of the version 3 of the frontend/backend protocol.
+type conn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	// Run-time parameters reported by the server, e.g. server_version.
+	parameters map[string]string
+}
+
+// dial connects to the server, negotiating TLS as of the SSL mode, and
+// authenticates.
+func dial(config connConfig) (*conn, error) {
+	netConn, err := net.DialTimeout("tcp", config.address, config.connectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	netConn.SetDeadline(time.Now().Add(config.connectTimeout))
+	c := &conn{conn: netConn, parameters: make(map[string]string)}
+	if config.tlsConfig != nil {
+		if err := c.negotiateTLS(config); err != nil {
+			netConn.Close()
+			return nil, err
+		}
+	}
+	c.reader = bufio.NewReader(c.conn)
+	if err := c.startup(config); err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+	c.conn.SetDeadline(time.Time{})
+	return c, nil
+}
+
+func (self *conn) negotiateTLS(config connConfig) error {
+	request := binary.BigEndian.AppendUint32(nil, 8)
+	request = binary.BigEndian.AppendUint32(request, sslRequestCode)
+	if _, err := self.conn.Write(request); err != nil {
+		return err
+	}
+	var answer [1]byte
+	if _, err := io.ReadFull(self.conn, answer[:]); err != nil {
+		return err
+	}
+	switch answer[0] {
+	case 'S':
+		tlsConn := tls.Client(self.conn, config.tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			return fmt.Errorf("TLS handshake with the PostgreSQL server failed - %v", err)
+		}
+		self.conn = tlsConn
+		return nil
+	case 'N':
+		if config.sslMode == "allow" || config.sslMode == "prefer" {
+			return nil
+		}
+		return fmt.Errorf("the PostgreSQL server does not support SSL, required by sslmode %s", config.sslMode)
+	}
+	return fmt.Errorf("unexpected answer %q of the PostgreSQL server to the SSL request", answer[0])
+}
+
+func (self *conn) startup(config connConfig) error {
+	body := binary.BigEndian.AppendUint32(nil, protocolVersion)
+	for _, param := range [][2]string{{"user", config.user}, {"database", config.database}, {"application_name", "cadvisor"}, {"client_encoding", "UTF8"}} {
+		body = append(body, param[0]...)
+		body = append(body, 0)
+		body = append(body, param[1]...)
+		body = append(body, 0)
+	}
+	if err := self.writeMessage(0, append(body, 0)); err != nil {
+		return err
+	}
+	var scram *scramClient
+	for {
+		messageType, body, err := self.readMessage()
+		if err != nil {
+			return err
+		}
+		switch messageType {
+		case 'R':
+			if len(body) < 4 {
+				return errors.New("malformed PostgreSQL authentication request")
+			}
+			if scram, err = self.authenticate(config, binary.BigEndian.Uint32(body), body[4:], scram); err != nil {
+				return err
+			}
+		case 'E':
+			return parseError(body)
+		case 'S':
+			if name, value, ok := parseParameter(body); ok {
+				self.parameters[name] = value
+			}
+		case 'Z':
+			return nil
+		}
+	}
+}
+
+// authenticate answers an authentication request, and returns the SCRAM
+// exchange going on, if any.
+func (self *conn) authenticate(config connConfig, code uint32, data []byte, scram *scramClient) (*scramClient, error) {
+	switch code {
+	case 0:
+		// Authenticated.
+		if scram != nil && !scram.verified {
+			return nil, errors.New("the PostgreSQL server did not prove it knows the password")
+		}
+		return nil, nil
+	case 3:
+		return nil, self.writeMessage('p', append([]byte(config.password), 0))
+	case 5:
+		if len(data) != 4 {
+			return nil, errors.New("malformed PostgreSQL MD5 authentication request")
+		}
+		return nil, self.writeMessage('p', append([]byte(md5Password(config.user, config.password, data)), 0))
+	case 10:
+		if !hasMechanism(data, scramMechanism) {
+			return nil, fmt.Errorf("the PostgreSQL server does not support %s", scramMechanism)
+		}
+		scram, err := newScramClient(config.password)
+		if err != nil {
+			return nil, err
+		}
+		first := scram.clientFirst()
+		body := append([]byte(scramMechanism), 0)
+		body = binary.BigEndian.AppendUint32(body, uint32(len(first)))
+		return scram, self.writeMessage('p', append(body, first...))
+	case 11:
+		if scram == nil {
+			return nil, errors.New("unexpected PostgreSQL SASL continuation")
+		}
+		final, err := scram.clientFinal(string(data))
+		if err != nil {
+			return nil, err
+		}
+		return scram, self.writeMessage('p', []byte(final))
+	case 12:
+		if scram == nil {
+			return nil, errors.New("unexpected PostgreSQL SASL completion")
+		}
+		return scram, scram.verifyServerFinal(string(data))
+	}
+	return nil, fmt.Errorf("unsupported PostgreSQL authentication method %d", code)
+}
+
+// hasMechanism returns whether a list of null-terminated SASL mechanisms
+// holds one.
+func hasMechanism(data []byte, mechanism string) bool {
+	for _, m := range splitCStrings(data) {
+		if m == mechanism {
+			return true
+		}
+	}
+	return false
+}
+
+func parseParameter(body []byte) (string, string, bool) {
+	fields := splitCStrings(body)
+	if len(fields) < 2 {
+		return "", "", false
+	}
+	return fields[0], fields[1], true
+}
+
+func splitCStrings(body []byte) []string {
+	var fields []string
+	for len(body) > 0 {
+		end := 0
+		for end < len(body) && body[end] != 0 {
+			end++
+		}
+		if end == len(body) {
+			break
+		}
+		fields = append(fields, string(body[:end]))
+		body = body[end+1:]
+	}
+	return fields
+}
+
+// parseError parses an ErrorResponse, of fields each a type byte and a
+// null-terminated string.
+func parseError(body []byte) error {
+	err := &pgError{}
+	for len(body) > 1 {
+		fieldType := body[0]
+		end := 1
+		for end < len(body) && body[end] != 0 {
+			end++
+		}
+		value := string(body[1:end])
+		switch fieldType {
+		case 'S':
+			err.severity = value
+		case 'C':
+			err.code = value
+		case 'M':
+			err.message = value
+		}
+		if end >= len(body) {
+			break
+		}
+		body = body[end+1:]
+	}
+	return err
+}
+
+func (self *conn) readMessage() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(self.reader, header[:]); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if size < 4 || size > maxMessageSize {
+		return 0, nil, fmt.Errorf("invalid size %d of a PostgreSQL message", size)
+	}
+	body := make([]byte, size-4)
+	if _, err := io.ReadFull(self.reader, body); err != nil {
+		return 0, nil, err
+	}
+	return header[0], body, nil
+}
+
+// writeMessage writes a message, without type for the startup message of
+// type 0.
+func (self *conn) writeMessage(messageType byte, body []byte) error {
+	var b []byte
+	if messageType != 0 {
+		b = append(b, messageType)
+	}
+	b = binary.BigEndian.AppendUint32(b, uint32(len(body)+4))
+	_, err := self.conn.Write(append(b, body...))
+	return err
+}
+
+// query runs statements with the simple query protocol, within timeout,
+// and returns the rows of their results, the columns in text, a NULL
+// being empty. The statements of a query run in a single transaction,
+// unless they begin or commit their own.
+func (self *conn) query(sql string, timeout time.Duration) ([][]string, error) {
+	self.conn.SetDeadline(time.Now().Add(timeout))
+	defer self.conn.SetDeadline(time.Time{})
+	if err := self.writeMessage('Q', append([]byte(sql), 0)); err != nil {
+		return nil, err
+	}
+	var rows [][]string
+	var queryErr error
+	for {
+		messageType, body, err := self.readMessage()
+		if err != nil {
+			return nil, err
+		}
+		switch messageType {
+		case 'D':
+			row, err := parseDataRow(body)
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row)
+		case 'E':
+			if queryErr == nil {
+				queryErr = parseError(body)
+			}
+		case 'S':
+			if name, value, ok := parseParameter(body); ok {
+				self.parameters[name] = value
+			}
+		case 'Z':
+			return rows, queryErr
+		}
+	}
+}
+
+func parseDataRow(body []byte) ([]string, error) {
+	if len(body) < 2 {
+		return nil, errors.New("malformed PostgreSQL data row")
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	body = body[2:]
+	row := make([]string, n)
+	for i := range row {
+		if len(body) < 4 {
+			return nil, errors.New("malformed PostgreSQL data row")
+		}
+		size := int32(binary.BigEndian.Uint32(body))
+		body = body[4:]
+		if size < 0 {
+			continue
+		}
+		if int(size) > len(body) {
+			return nil, errors.New("malformed PostgreSQL data row")
+		}
+		row[i] = string(body[:size])
+		body = body[size:]
+	}
+	return row, nil
+}
+
+// close terminates the session.
+func (self *conn) close() {
+	self.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	self.writeMessage('X', nil)
+	self.conn.Close()
+}
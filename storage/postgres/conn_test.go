@@ -0,0 +1,453 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer speaks the part of the PostgreSQL protocol the driver uses,
+// recording the queries, and answering the ones of TimescaleDB.
+type fakeServer struct {
+	t        *testing.T
+	listener net.Listener
+	tls      *tls.Config
+	// Authentication method, one of trust, password, md5 and scram, and
+	// the password of every user.
+	auth     string
+	password string
+	// Whether the database has the TimescaleDB extension, and the error
+	// of create_hypertable.
+	timescale       bool
+	hypertableError string
+	// Number of INSERTs after which the connection is closed instead of
+	// answering, from the first, and the error of the INSERTs.
+	dropInserts int
+	insertError string
+
+	lock     sync.Mutex
+	startups []map[string]string
+	queries  []string
+	conns    []net.Conn
+}
+
+// newFakeServer starts a server, configured before it accepts connections.
+func newFakeServer(t *testing.T, configure ...func(*fakeServer)) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{t: t, listener: l, auth: "trust"}
+	for _, f := range configure {
+		f(s)
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.lock.Lock()
+			s.conns = append(s.conns, conn)
+			s.lock.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// config returns the configuration of a connection to the server, without
+// TLS.
+func (self *fakeServer) config() connConfig {
+	return connConfig{
+		address:        self.listener.Addr().String(),
+		user:           "cadvisor",
+		password:       "secret",
+		database:       "metrics",
+		sslMode:        "disable",
+		connectTimeout: 5 * time.Second,
+	}
+}
+
+func (self *fakeServer) close() {
+	self.listener.Close()
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, conn := range self.conns {
+		conn.Close()
+	}
+}
+
+func (self *fakeServer) queried() []string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return append([]string(nil), self.queries...)
+}
+
+func (self *fakeServer) started() []map[string]string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return append([]map[string]string(nil), self.startups...)
+}
+
+// inserts returns the INSERT queries.
+func (self *fakeServer) inserts() []string {
+	var inserts []string
+	for _, query := range self.queried() {
+		if strings.HasPrefix(query, "INSERT") {
+			inserts = append(inserts, query)
+		}
+	}
+	return inserts
+}
+
+func writeMessage(w io.Writer, messageType byte, body []byte) {
+	b := binary.BigEndian.AppendUint32([]byte{messageType}, uint32(len(body)+4))
+	w.Write(append(b, body...))
+}
+
+func authentication(code uint32, data string) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, code), data...)
+}
+
+func errorResponse(code, message string) []byte {
+	return []byte("SERROR\x00C" + code + "\x00M" + message + "\x00\x00")
+}
+
+func dataRow(values ...string) []byte {
+	b := binary.BigEndian.AppendUint16(nil, uint16(len(values)))
+	for _, value := range values {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(value)))
+		b = append(b, value...)
+	}
+	return b
+}
+
+// readStartup reads a message without type, of the startup.
+func readStartup(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	body := make([]byte, binary.BigEndian.Uint32(size[:])-4)
+	_, err := io.ReadFull(r, body)
+	return body, err
+}
+
+func (self *fakeServer) serve(netConn net.Conn) {
+	defer netConn.Close()
+	body, err := readStartup(netConn)
+	if err != nil {
+		return
+	}
+	if binary.BigEndian.Uint32(body) == sslRequestCode {
+		if self.tls == nil {
+			netConn.Write([]byte("N"))
+		} else {
+			netConn.Write([]byte("S"))
+			tlsConn := tls.Server(netConn, self.tls)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			netConn = tlsConn
+		}
+		if body, err = readStartup(netConn); err != nil {
+			return
+		}
+	}
+	params := make(map[string]string)
+	fields := splitCStrings(body[4:])
+	for i := 0; i+1 < len(fields); i += 2 {
+		params[fields[i]] = fields[i+1]
+	}
+	self.lock.Lock()
+	self.startups = append(self.startups, params)
+	self.lock.Unlock()
+
+	c := &conn{conn: netConn, reader: bufio.NewReader(netConn)}
+	if !self.authenticate(c, params["user"]) {
+		writeMessage(netConn, 'E', errorResponse("28P01", "password authentication failed for user \""+params["user"]+"\""))
+		return
+	}
+	writeMessage(netConn, 'R', authentication(0, ""))
+	writeMessage(netConn, 'S', []byte("server_version\x0016.2\x00"))
+	writeMessage(netConn, 'K', make([]byte, 8))
+	writeMessage(netConn, 'Z', []byte("I"))
+
+	for {
+		messageType, body, err := c.readMessage()
+		if err != nil || messageType == 'X' {
+			return
+		}
+		if messageType != 'Q' {
+			continue
+		}
+		query := strings.TrimSuffix(string(body), "\x00")
+		self.lock.Lock()
+		self.queries = append(self.queries, query)
+		drop := strings.HasPrefix(query, "INSERT") && self.dropInserts > 0
+		if drop {
+			self.dropInserts--
+		}
+		self.lock.Unlock()
+		switch {
+		case drop:
+			return
+		case strings.Contains(query, "pg_extension"):
+			if self.timescale {
+				writeMessage(netConn, 'D', dataRow("2.14.2"))
+			}
+			writeMessage(netConn, 'C', []byte("SELECT\x00"))
+		case strings.Contains(query, "create_hypertable"):
+			if self.hypertableError != "" {
+				writeMessage(netConn, 'E', errorResponse("TS110", self.hypertableError))
+			} else {
+				writeMessage(netConn, 'D', dataRow("(1,public,container_stats,t)"))
+				writeMessage(netConn, 'C', []byte("SELECT 1\x00"))
+			}
+		case strings.HasPrefix(query, "INSERT") && self.insertError != "":
+			writeMessage(netConn, 'E', errorResponse("22003", self.insertError))
+		default:
+			writeMessage(netConn, 'C', []byte("OK\x00"))
+		}
+		writeMessage(netConn, 'Z', []byte("I"))
+	}
+}
+
+// authenticate authenticates the user as of the authentication method, and
+// returns whether the password is right.
+func (self *fakeServer) authenticate(c *conn, user string) bool {
+	switch self.auth {
+	case "password":
+		writeMessage(c.conn, 'R', authentication(3, ""))
+		_, body, err := c.readMessage()
+		return err == nil && string(body) == self.password+"\x00"
+	case "md5":
+		salt := "salt"
+		writeMessage(c.conn, 'R', authentication(5, salt))
+		_, body, err := c.readMessage()
+		return err == nil && string(body) == md5Password(user, self.password, []byte(salt))+"\x00"
+	case "scram":
+		writeMessage(c.conn, 'R', authentication(10, scramMechanism+"\x00\x00"))
+		_, body, err := c.readMessage()
+		if err != nil || !strings.HasPrefix(string(body), scramMechanism+"\x00") {
+			return false
+		}
+		clientFirst := string(body[len(scramMechanism)+5:])
+		clientFirstBare := strings.TrimPrefix(clientFirst, "n,,")
+		salt := []byte("0123456789abcdef")
+		serverFirst := "r=" + scramAttributes(clientFirstBare)["r"] + "server-nonce,s=" + base64.StdEncoding.EncodeToString(salt) + ",i=4096"
+		writeMessage(c.conn, 'R', authentication(11, serverFirst))
+		_, body, err = c.readMessage()
+		if err != nil {
+			return false
+		}
+		clientFinal := string(body)
+		withoutProof := clientFinal[:strings.Index(clientFinal, ",p=")]
+		authMessage := clientFirstBare + "," + serverFirst + "," + withoutProof
+		saltedPassword := scramHi(self.password, salt, 4096)
+		storedKey := sha256.Sum256(scramHMAC(saltedPassword, "Client Key"))
+		proof, _ := base64.StdEncoding.DecodeString(scramAttributes(clientFinal)["p"])
+		clientKey := scramHMAC(storedKey[:], authMessage)
+		for i := range proof {
+			clientKey[i] ^= proof[i]
+		}
+		if computed := sha256.Sum256(clientKey); !hmac.Equal(computed[:], storedKey[:]) {
+			return false
+		}
+		serverSignature := scramHMAC(scramHMAC(saltedPassword, "Server Key"), authMessage)
+		writeMessage(c.conn, 'R', authentication(12, "v="+base64.StdEncoding.EncodeToString(serverSignature)))
+	}
+	return true
+}
+
+func TestScramHi(t *testing.T) {
+	// The PBKDF2-HMAC-SHA256 test vectors of RFC 7914.
+	for _, test := range []struct {
+		password, salt string
+		iterations     int
+		expected       string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56"},
+	} {
+		if got := hex.EncodeToString(scramHi(test.password, []byte(test.salt), test.iterations)); got != test.expected {
+			t.Errorf("Hi(%q, %q, %d): expected %s, got %s", test.password, test.salt, test.iterations, test.expected, got)
+		}
+	}
+}
+
+func TestParseDSN(t *testing.T) {
+	for dsn, expected := range map[string]connConfig{
+		"postgres://cadvisor:p%40ss@db:5433/metrics?sslmode=disable&connect_timeout=3": {
+			address: "db:5433", user: "cadvisor", password: "p@ss", database: "metrics", sslMode: "disable", connectTimeout: 3 * time.Second,
+		},
+		"postgresql://db?sslmode=disable": {
+			address: "db:5432", user: "postgres", database: "postgres", sslMode: "disable", connectTimeout: 10 * time.Second,
+		},
+		"host=db port=5433 user=cadvisor password='it\\'s \\\\ quoted' dbname=metrics sslmode=disable": {
+			address: "db:5433", user: "cadvisor", password: `it's \ quoted`, database: "metrics", sslMode: "disable", connectTimeout: 10 * time.Second,
+		},
+		"user=cadvisor  password='with spaces'   sslmode=disable": {
+			address: "localhost:5432", user: "cadvisor", password: "with spaces", database: "cadvisor", sslMode: "disable", connectTimeout: 10 * time.Second,
+		},
+	} {
+		config, err := parseDSN(dsn)
+		if err != nil {
+			t.Errorf("%s: %v", dsn, err)
+			continue
+		}
+		if config != expected {
+			t.Errorf("%s: expected %+v, got %+v", dsn, expected, config)
+		}
+	}
+	config, err := parseDSN("host=db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.sslMode != "prefer" || config.tlsConfig == nil || !config.tlsConfig.InsecureSkipVerify {
+		t.Errorf("expected TLS to be preferred without verification, got %+v", config)
+	}
+	for _, dsn := range []string{"host=db unknown=1", "host=db sslmode=sometimes", "password='unterminated", "host", "host=db connect_timeout=soon"} {
+		if _, err := parseDSN(dsn); err == nil {
+			t.Errorf("expected an error for %q", dsn)
+		}
+	}
+}
+
+func TestDialAuthentication(t *testing.T) {
+	for _, auth := range []string{"trust", "password", "md5", "scram"} {
+		server := newFakeServer(t, func(s *fakeServer) { s.auth = auth; s.password = "secret" })
+		c, err := dial(server.config())
+		if err != nil {
+			t.Errorf("%s: %v", auth, err)
+			server.close()
+			continue
+		}
+		if c.parameters["server_version"] != "16.2" {
+			t.Errorf("%s: expected the parameters of the server, got %v", auth, c.parameters)
+		}
+		c.close()
+		startup := server.started()[0]
+		if startup["user"] != "cadvisor" || startup["database"] != "metrics" || startup["application_name"] != "cadvisor" {
+			t.Errorf("%s: unexpected startup parameters %v", auth, startup)
+		}
+
+		config := server.config()
+		config.password = "wrong"
+		if _, err := dial(config); auth != "trust" && (err == nil || !strings.Contains(err.Error(), "28P01")) {
+			t.Errorf("%s: expected the authentication to fail, got %v", auth, err)
+		}
+		server.close()
+	}
+}
+
+// writeCertificate writes the certificate of an httptest TLS server, valid
+// for 127.0.0.1, and returns its path.
+func writeCertificate(t *testing.T, dir string, https *httptest.Server) string {
+	path := filepath.Join(dir, "root.pem")
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: https.TLS.Certificates[0].Certificate[0]}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDialSSL(t *testing.T) {
+	https := httptest.NewTLSServer(http.NotFoundHandler())
+	defer https.Close()
+	dir, err := ioutil.TempDir("", "postgres")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rootCert := writeCertificate(t, dir, https)
+	server := newFakeServer(t, func(s *fakeServer) { s.tls = &tls.Config{Certificates: https.TLS.Certificates} })
+	defer server.close()
+	plainServer := newFakeServer(t)
+	defer plainServer.close()
+
+	for _, test := range []struct {
+		server  *fakeServer
+		host    string
+		sslMode string
+		root    string
+		ok      bool
+	}{
+		{server, "127.0.0.1", "require", "", true},
+		{server, "127.0.0.1", "verify-full", "", false},
+		{server, "127.0.0.1", "verify-full", rootCert, true},
+		// The certificate is not valid for localhost, which verify-ca
+		// does not check.
+		{server, "localhost", "verify-full", rootCert, false},
+		{server, "localhost", "verify-ca", rootCert, true},
+		{plainServer, "127.0.0.1", "prefer", "", true},
+		{plainServer, "127.0.0.1", "require", "", false},
+	} {
+		config := test.server.config()
+		config.sslMode = test.sslMode
+		if config.tlsConfig, err = generateTLSConfig(test.sslMode, test.host, test.root, "", ""); err != nil {
+			t.Fatal(err)
+		}
+		c, err := dial(config)
+		if test.ok && err != nil {
+			t.Errorf("%s with %s and root %q: %v", test.host, test.sslMode, test.root, err)
+		} else if !test.ok && err == nil {
+			t.Errorf("%s with %s and root %q: expected an error", test.host, test.sslMode, test.root)
+		}
+		if err == nil {
+			if _, isTLS := c.conn.(*tls.Conn); isTLS != (test.server == server) {
+				t.Errorf("%s with %s: expected TLS to be used only if supported", test.host, test.sslMode)
+			}
+			c.close()
+		}
+	}
+}
+
+func TestQueryError(t *testing.T) {
+	server := newFakeServer(t, func(s *fakeServer) { s.insertError = "bigint out of range" })
+	defer server.close()
+	c, err := dial(server.config())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+
+	_, err = c.query("INSERT INTO t VALUES (1)", time.Second)
+	if pgErr, ok := err.(*pgError); !ok || pgErr.code != "22003" || pgErr.message != "bigint out of range" {
+		t.Errorf("expected the error of the server, got %v", err)
+	}
+	// Still usable.
+	if _, err := c.query("SELECT 1", time.Second); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,426 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+	"github.com/google/cadvisor/utils/container"
+
+	"github.com/golang/glog"
+)
+
+func init() {
+	storage.RegisterStorageDriver("postgres", new)
+}
+
+var (
+	argDSN           = flag.String("storage_driver_postgres_dsn", "postgres://postgres@localhost:5432/cadvisor?sslmode=prefer", "PostgreSQL connection string, a postgres:// URL or keyword=value pairs, with the keywords host, port, user, password, dbname, sslmode, sslrootcert, sslcert, sslkey and connect_timeout")
+	argTable         = flag.String("storage_driver_postgres_table", "container_stats", "table the stats are inserted into, optionally qualified with its schema, created if missing, as a hypertable with TimescaleDB")
+	argFlushInterval = flag.Duration("storage_driver_postgres_flush_interval", 10*time.Second, "interval of the inserts of the buffered stats")
+	argBatchSize     = flag.Int("storage_driver_postgres_batch_size", 1000, "number of buffered rows inserted as soon as they are buffered, before the flush interval")
+	argMaxPending    = flag.Int("storage_driver_postgres_max_pending", 100000, "maximum number of rows buffered while the inserts fail, the oldest being dropped beyond it")
+	argTimeout       = flag.Duration("storage_driver_postgres_timeout", 30*time.Second, "timeout of the statements")
+)
+
+// Maximum number of rows of an INSERT statement.
+const maxInsertRows = 1000
+
+// column is a column of the stats table, past the key, ID and labels.
+type column struct {
+	name  string
+	value func(stats *info.ContainerStats) uint64
+}
+
+// Columns of the major stat groups, all BIGINT.
+var columns = []column{
+	{"cpu_usage_total", func(s *info.ContainerStats) uint64 { return s.Cpu.Usage.Total }},
+	{"cpu_usage_user", func(s *info.ContainerStats) uint64 { return s.Cpu.Usage.User }},
+	{"cpu_usage_system", func(s *info.ContainerStats) uint64 { return s.Cpu.Usage.System }},
+	{"cpu_load_average", func(s *info.ContainerStats) uint64 { return uint64(s.Cpu.LoadAverage) }},
+	{"memory_usage", func(s *info.ContainerStats) uint64 { return s.Memory.Usage }},
+	{"memory_working_set", func(s *info.ContainerStats) uint64 { return s.Memory.WorkingSet }},
+	{"memory_rss", func(s *info.ContainerStats) uint64 { return s.Memory.RSS }},
+	{"memory_cache", func(s *info.ContainerStats) uint64 { return s.Memory.Cache }},
+	{"memory_failcnt", func(s *info.ContainerStats) uint64 { return s.Memory.Failcnt }},
+	{"network_rx_bytes", func(s *info.ContainerStats) uint64 { return s.Network.RxBytes }},
+	{"network_rx_packets", func(s *info.ContainerStats) uint64 { return s.Network.RxPackets }},
+	{"network_rx_errors", func(s *info.ContainerStats) uint64 { return s.Network.RxErrors }},
+	{"network_rx_dropped", func(s *info.ContainerStats) uint64 { return s.Network.RxDropped }},
+	{"network_tx_bytes", func(s *info.ContainerStats) uint64 { return s.Network.TxBytes }},
+	{"network_tx_packets", func(s *info.ContainerStats) uint64 { return s.Network.TxPackets }},
+	{"network_tx_errors", func(s *info.ContainerStats) uint64 { return s.Network.TxErrors }},
+	{"network_tx_dropped", func(s *info.ContainerStats) uint64 { return s.Network.TxDropped }},
+	{"fs_usage", func(s *info.ContainerStats) uint64 {
+		var usage uint64
+		for _, fs := range s.Filesystem {
+			usage += fs.Usage
+		}
+		return usage
+	}},
+	{"fs_limit", func(s *info.ContainerStats) uint64 {
+		var limit uint64
+		for _, fs := range s.Filesystem {
+			limit += fs.Limit
+		}
+		return limit
+	}},
+	{"diskio_read_bytes", func(s *info.ContainerStats) uint64 { return sumDiskIo(s.DiskIo.IoServiceBytes, "Read") }},
+	{"diskio_write_bytes", func(s *info.ContainerStats) uint64 { return sumDiskIo(s.DiskIo.IoServiceBytes, "Write") }},
+}
+
+func sumDiskIo(stats []info.PerDiskStats, op string) uint64 {
+	var sum uint64
+	for _, disk := range stats {
+		sum += disk.Stats[op]
+	}
+	return sum
+}
+
+// Natural key of the rows, on which conflicting rows are not inserted.
+const naturalKey = "time, machine, container_name"
+
+type postgresStorage struct {
+	machineName string
+	// Quoted name of the table.
+	table     string
+	config    connConfig
+	timeout   time.Duration
+	batchSize int
+	// Whether the table is a TimescaleDB hypertable.
+	hypertable bool
+
+	lock sync.Mutex
+	// VALUES of the rows to insert.
+	rows       []string
+	maxPending int
+	dropped    uint64
+
+	flush chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+
+	// Used by the flushing goroutine only, after newStorage.
+	conn *conn
+}
+
+func new() (storage.StorageDriver, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := parseDSN(*argDSN)
+	if err != nil {
+		return nil, err
+	}
+	return newStorage(config{
+		machineName:   hostname,
+		table:         *argTable,
+		conn:          conn,
+		flushInterval: *argFlushInterval,
+		batchSize:     *argBatchSize,
+		maxPending:    *argMaxPending,
+		timeout:       *argTimeout,
+	})
+}
+
+var identifierRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*$`)
+
+// quoteTable quotes a table name, optionally qualified with its schema.
+func quoteTable(name string) (string, error) {
+	parts := strings.Split(name, ".")
+	if len(parts) > 2 {
+		return "", fmt.Errorf("invalid PostgreSQL table %q", name)
+	}
+	for i, part := range parts {
+		if !identifierRegexp.MatchString(part) {
+			return "", fmt.Errorf("invalid PostgreSQL table %q", name)
+		}
+		parts[i] = `"` + part + `"`
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// quoteLiteral quotes a string literal, escaping the backslashes too so that
+// it does not depend on standard_conforming_strings. NUL, which text cannot
+// hold, is dropped.
+func quoteLiteral(s string) string {
+	s = strings.Replace(s, "\x00", "", -1)
+	return "E'" + strings.NewReplacer(`\`, `\\`, `'`, `''`).Replace(s) + "'"
+}
+
+// formatInt formats a counter as a BIGINT, capped at its maximum.
+func formatInt(v uint64) string {
+	if v > math.MaxInt64 {
+		v = math.MaxInt64
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+// schema returns the statements creating the table and its columns, if
+// missing.
+func (self *postgresStorage) schema() string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "CREATE TABLE IF NOT EXISTS %s (\n"+
+		"\ttime TIMESTAMPTZ NOT NULL,\n"+
+		"\tmachine TEXT NOT NULL,\n"+
+		"\tcontainer_name TEXT NOT NULL,\n"+
+		"\tcontainer_id TEXT,\n"+
+		"\tlabels JSONB,\n", self.table)
+	for _, c := range columns {
+		fmt.Fprintf(&b, "\t%s BIGINT,\n", c.name)
+	}
+	fmt.Fprintf(&b, "\tPRIMARY KEY (%s)\n);\n", naturalKey)
+	// The columns added since the table was created.
+	for _, c := range columns {
+		fmt.Fprintf(&b, "ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s BIGINT;\n", self.table, c.name)
+	}
+	return b.String()
+}
+
+// createSchema creates the table if missing, and makes it a hypertable if
+// the database has the TimescaleDB extension, leaving it a plain table if
+// it cannot be, e.g. if it already has rows.
+func (self *postgresStorage) createSchema() error {
+	if _, err := self.conn.query(self.schema(), self.timeout); err != nil {
+		return fmt.Errorf("failed to create the PostgreSQL table %s - %v", self.table, err)
+	}
+	rows, err := self.conn.query("SELECT extversion FROM pg_extension WHERE extname = 'timescaledb'", self.timeout)
+	if err != nil {
+		return fmt.Errorf("failed to look for TimescaleDB - %v", err)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	if _, err := self.conn.query(fmt.Sprintf("SELECT create_hypertable(%s, 'time', if_not_exists => TRUE)", quoteLiteral(self.table)), self.timeout); err != nil {
+		if _, ok := err.(*pgError); !ok {
+			return err
+		}
+		glog.Warningf("PostgreSQL: failed to make %s a TimescaleDB hypertable, keeping a plain table - %v", self.table, err)
+		return nil
+	}
+	self.hypertable = true
+	return nil
+}
+
+// row returns the VALUES of the row of stats.
+func (self *postgresStorage) row(ref info.ContainerReference, stats *info.ContainerStats) (string, error) {
+	labels := "NULL"
+	if len(ref.Labels) > 0 {
+		b, err := json.Marshal(ref.Labels)
+		if err != nil {
+			return "", err
+		}
+		labels = quoteLiteral(string(b))
+	}
+	values := []string{
+		quoteLiteral(stats.Timestamp.UTC().Format("2006-01-02 15:04:05.999999Z07:00")),
+		quoteLiteral(self.machineName),
+		quoteLiteral(container.GetPreferredName(ref)),
+		quoteLiteral(ref.Id),
+		labels,
+	}
+	for _, c := range columns {
+		values = append(values, formatInt(c.value(stats)))
+	}
+	return "(" + strings.Join(values, ", ") + ")", nil
+}
+
+func (self *postgresStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	if stats == nil {
+		return nil
+	}
+	row, err := self.row(ref, stats)
+	if err != nil {
+		return err
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.rows = append(self.rows, row)
+	self.trim()
+	if len(self.rows) >= self.batchSize {
+		select {
+		case self.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// trim drops the oldest rows beyond the maximum pending. It must be called
+// with the lock held.
+func (self *postgresStorage) trim() {
+	if extra := len(self.rows) - self.maxPending; extra > 0 {
+		self.rows = append(self.rows[:0:0], self.rows[extra:]...)
+		atomic.AddUint64(&self.dropped, uint64(extra))
+	}
+}
+
+// run inserts the buffered rows every flush interval, or as soon as a batch
+// is buffered, until stopped.
+func (self *postgresStorage) run(flushInterval time.Duration) {
+	defer close(self.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-self.flush:
+		case <-self.stop:
+			if err := self.insertRows(); err != nil {
+				glog.Errorf("PostgreSQL: %v", err)
+			}
+			return
+		}
+		if err := self.insertRows(); err != nil {
+			glog.Errorf("PostgreSQL: %v", err)
+		}
+	}
+}
+
+// insertRows inserts the buffered rows, in a single transaction. The rows
+// are buffered again if the connection fails, the rows already inserted by
+// a transaction which committed unbeknownst to the driver being skipped on
+// their natural key. The rows the server rejects are dropped.
+func (self *postgresStorage) insertRows() error {
+	self.lock.Lock()
+	rows := self.rows
+	self.rows = nil
+	self.lock.Unlock()
+	if len(rows) == 0 {
+		return nil
+	}
+	err := self.insert(rows)
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*pgError); ok {
+		return fmt.Errorf("%d rows rejected - %v", len(rows), err)
+	}
+	if self.conn != nil {
+		self.conn.close()
+		self.conn = nil
+	}
+	self.lock.Lock()
+	self.rows = append(rows, self.rows...)
+	self.trim()
+	self.lock.Unlock()
+	return fmt.Errorf("failed to insert %d rows, retrying - %v", len(rows), err)
+}
+
+func (self *postgresStorage) insert(rows []string) error {
+	if self.conn == nil {
+		c, err := dial(self.config)
+		if err != nil {
+			return err
+		}
+		self.conn = c
+	}
+	names := []string{naturalKey, "container_id", "labels"}
+	for _, c := range columns {
+		names = append(names, c.name)
+	}
+	var b bytes.Buffer
+	for len(rows) > 0 {
+		n := len(rows)
+		if n > maxInsertRows {
+			n = maxInsertRows
+		}
+		fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES\n%s\nON CONFLICT (%s) DO NOTHING;\n",
+			self.table, strings.Join(names, ", "), strings.Join(rows[:n], ",\n"), naturalKey)
+		rows = rows[n:]
+	}
+	_, err := self.conn.query(b.String(), self.timeout)
+	return err
+}
+
+// Close inserts the buffered rows, and closes the connection.
+func (self *postgresStorage) Close() error {
+	close(self.stop)
+	<-self.done
+	if self.conn != nil {
+		self.conn.close()
+		self.conn = nil
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if n := len(self.rows); n > 0 {
+		return fmt.Errorf("PostgreSQL: %d rows were not inserted", n)
+	}
+	return nil
+}
+
+// config is the configuration of the driver, populated from the flags.
+type config struct {
+	// A unique identifier to identify the host that current cAdvisor
+	// instance is running on.
+	machineName string
+	// The table the stats are inserted into, created if missing.
+	table string
+	// How to connect to the PostgreSQL server.
+	conn connConfig
+	// The interval of the inserts of the buffered rows.
+	flushInterval time.Duration
+	// The number of buffered rows inserted before the flush interval.
+	batchSize int
+	// The maximum number of rows buffered while the inserts fail.
+	maxPending int
+	// The timeout of the statements.
+	timeout time.Duration
+}
+
+// Create a new PostgreSQL storage driver.
+func newStorage(cfg config) (*postgresStorage, error) {
+	quoted, err := quoteTable(cfg.table)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.flushInterval <= 0 || cfg.batchSize <= 0 || cfg.maxPending <= 0 {
+		return nil, fmt.Errorf("the PostgreSQL flush interval, batch size and maximum pending rows must be positive")
+	}
+	ret := &postgresStorage{
+		machineName: cfg.machineName,
+		table:       quoted,
+		config:      cfg.conn,
+		timeout:     cfg.timeout,
+		batchSize:   cfg.batchSize,
+		maxPending:  cfg.maxPending,
+		flush:       make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	if ret.conn, err = dial(cfg.conn); err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL - %v", err)
+	}
+	if err := ret.createSchema(); err != nil {
+		ret.conn.close()
+		return nil, err
+	}
+	go ret.run(cfg.flushInterval)
+	return ret, nil
+}
@@ -0,0 +1,278 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package postgres
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+var (
+	testRef = info.ContainerReference{
+		Name:    "/docker/abc",
+		Id:      "abc",
+		Aliases: []string{"web.1", "abc"},
+		Labels:  map[string]string{"app": "it's"},
+	}
+	testStats = &info.ContainerStats{
+		Timestamp: time.Date(2016, 1, 1, 0, 0, 0, 123456000, time.UTC),
+		Cpu:       info.CpuStats{Usage: info.CpuUsage{Total: 100, User: 60, System: 40}},
+		Memory:    info.MemoryStats{Usage: 4096, WorkingSet: 2048},
+		Network:   info.NetworkStats{InterfaceStats: info.InterfaceStats{RxBytes: 10, TxBytes: 20}},
+		Filesystem: []info.FsStats{
+			{Device: "/dev/sda1", Usage: 1, Limit: 10},
+			{Device: "/dev/sdb1", Usage: 2, Limit: 20},
+		},
+		DiskIo: info.DiskIoStats{IoServiceBytes: []info.PerDiskStats{
+			{Major: 8, Stats: map[string]uint64{"Read": 5, "Write": 7}},
+			{Major: 8, Minor: 16, Stats: map[string]uint64{"Read": 1}},
+		}},
+	}
+)
+
+// testConfig returns the configuration of a driver inserting into the
+// container_stats table of server.
+func testConfig(server *fakeServer) config {
+	return config{
+		machineName:   "host-1",
+		table:         "container_stats",
+		conn:          server.config(),
+		flushInterval: time.Hour,
+		batchSize:     100,
+		maxPending:    100,
+		timeout:       5 * time.Second,
+	}
+}
+
+func newTestStorage(t *testing.T, server *fakeServer, batchSize int) *postgresStorage {
+	cfg := testConfig(server)
+	cfg.batchSize = batchSize
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return driver
+}
+
+func TestQuoting(t *testing.T) {
+	for name, expected := range map[string]string{
+		"container_stats":         `"container_stats"`,
+		"metrics.Container_Stats": `"metrics"."Container_Stats"`,
+	} {
+		if got, err := quoteTable(name); err != nil || got != expected {
+			t.Errorf("table %q: expected %s, got %s, %v", name, expected, got, err)
+		}
+	}
+	for _, name := range []string{"", "a.b.c", "stats; DROP TABLE x", `"quoted"`, "1stats"} {
+		if _, err := quoteTable(name); err == nil {
+			t.Errorf("expected an error for the table %q", name)
+		}
+	}
+	if got := quoteLiteral("it's a \\ back\x00slash"); got != `E'it''s a \\ backslash'` {
+		t.Errorf("unexpected literal %s", got)
+	}
+}
+
+func TestCreateSchema(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.close()
+	driver := newTestStorage(t, server, 100)
+	defer driver.Close()
+
+	queries := server.queried()
+	if len(queries) != 2 {
+		t.Fatalf("expected the table to be created and TimescaleDB looked for, got %q", queries)
+	}
+	for _, expected := range []string{
+		`CREATE TABLE IF NOT EXISTS "container_stats" (`,
+		"\ttime TIMESTAMPTZ NOT NULL,\n",
+		"\tlabels JSONB,\n",
+		"\tcpu_usage_total BIGINT,\n",
+		"PRIMARY KEY (time, machine, container_name)",
+		`ALTER TABLE "container_stats" ADD COLUMN IF NOT EXISTS diskio_write_bytes BIGINT;`,
+	} {
+		if !strings.Contains(queries[0], expected) {
+			t.Errorf("expected the schema to contain %q, got:\n%s", expected, queries[0])
+		}
+	}
+	if driver.hypertable {
+		t.Error("expected a plain table without TimescaleDB")
+	}
+}
+
+func TestCreateHypertable(t *testing.T) {
+	server := newFakeServer(t, func(s *fakeServer) { s.timescale = true })
+	defer server.close()
+	driver := newTestStorage(t, server, 100)
+	defer driver.Close()
+
+	queries := server.queried()
+	if len(queries) != 3 || queries[2] != `SELECT create_hypertable(E'"container_stats"', 'time', if_not_exists => TRUE)` {
+		t.Errorf("expected a hypertable to be created, got %q", queries)
+	}
+	if !driver.hypertable {
+		t.Error("expected a hypertable")
+	}
+}
+
+func TestCreateHypertableFallback(t *testing.T) {
+	server := newFakeServer(t, func(s *fakeServer) {
+		s.timescale = true
+		s.hypertableError = `table "container_stats" is not empty`
+	})
+	defer server.close()
+	driver := newTestStorage(t, server, 100)
+	defer driver.Close()
+
+	if driver.hypertable {
+		t.Error("expected a plain table when the hypertable cannot be created")
+	}
+}
+
+func TestInsert(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.close()
+	driver := newTestStorage(t, server, 100)
+
+	if err := driver.AddStats(testRef, testStats); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	inserts := server.inserts()
+	if len(inserts) != 1 {
+		t.Fatalf("expected 1 INSERT, got %d", len(inserts))
+	}
+	expected := `INSERT INTO "container_stats" (time, machine, container_name, container_id, labels, ` +
+		`cpu_usage_total, cpu_usage_user, cpu_usage_system, cpu_load_average, ` +
+		`memory_usage, memory_working_set, memory_rss, memory_cache, memory_failcnt, ` +
+		`network_rx_bytes, network_rx_packets, network_rx_errors, network_rx_dropped, ` +
+		`network_tx_bytes, network_tx_packets, network_tx_errors, network_tx_dropped, ` +
+		`fs_usage, fs_limit, diskio_read_bytes, diskio_write_bytes) VALUES
+(E'2016-01-01 00:00:00.123456Z', E'host-1', E'web.1', E'abc', E'{"app":"it''s"}', 100, 60, 40, 0, 4096, 2048, 0, 0, 0, 10, 0, 0, 0, 20, 0, 0, 0, 3, 30, 6, 7)
+ON CONFLICT (time, machine, container_name) DO NOTHING;
+`
+	if inserts[0] != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, inserts[0])
+	}
+}
+
+func TestInsertBatch(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.close()
+	// Inserted as soon as 2 rows are buffered, long before the interval.
+	driver := newTestStorage(t, server, 2)
+	defer driver.Close()
+
+	driver.AddStats(testRef, testStats)
+	driver.AddStats(testRef, testStats)
+	waitFor(t, func() bool { return len(server.inserts()) == 1 })
+	if n := strings.Count(server.inserts()[0], "E'host-1'"); n != 2 {
+		t.Errorf("expected 2 rows, got %d", n)
+	}
+}
+
+func TestRetryAfterConnectionFailure(t *testing.T) {
+	// The connection is closed on the first INSERT, which may have been
+	// committed.
+	server := newFakeServer(t, func(s *fakeServer) { s.dropInserts = 1 })
+	defer server.close()
+	driver := newTestStorage(t, server, 100)
+
+	driver.AddStats(testRef, testStats)
+	if err := driver.insertRows(); err == nil {
+		t.Fatal("expected the insert to fail")
+	}
+	if n := len(driver.rows); n != 1 {
+		t.Fatalf("expected the row to be buffered again, got %d rows", n)
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Inserted again on a new connection, not duplicated thanks to the
+	// natural key.
+	inserts := server.inserts()
+	if len(inserts) != 2 || inserts[0] != inserts[1] || !strings.Contains(inserts[1], "ON CONFLICT (time, machine, container_name) DO NOTHING") {
+		t.Errorf("expected the same INSERT on conflict doing nothing, got %q", inserts)
+	}
+	if n := len(server.started()); n != 2 {
+		t.Errorf("expected 2 connections, got %d", n)
+	}
+}
+
+func TestRejectedRowsDropped(t *testing.T) {
+	server := newFakeServer(t, func(s *fakeServer) { s.insertError = "bigint out of range" })
+	defer server.close()
+	driver := newTestStorage(t, server, 100)
+
+	driver.AddStats(testRef, testStats)
+	if err := driver.insertRows(); err == nil || !strings.Contains(err.Error(), "1 rows rejected") {
+		t.Errorf("expected the rows to be rejected, got %v", err)
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(server.inserts()); n != 1 {
+		t.Errorf("expected the rejected rows not to be inserted again, got %d INSERTs", n)
+	}
+}
+
+func TestMaxPending(t *testing.T) {
+	driver := &postgresStorage{machineName: "host-1", table: `"t"`, batchSize: 100, maxPending: 2, flush: make(chan struct{}, 1)}
+	for _, name := range []string{"a", "b", "c"} {
+		driver.AddStats(info.ContainerReference{Name: name}, testStats)
+	}
+	if dropped := atomic.LoadUint64(&driver.dropped); dropped != 1 {
+		t.Errorf("expected 1 dropped row, got %d", dropped)
+	}
+	if len(driver.rows) != 2 || !strings.Contains(driver.rows[0], "E'b'") || !strings.Contains(driver.rows[1], "E'c'") {
+		t.Errorf("expected the oldest row to be dropped, got %q", driver.rows)
+	}
+}
+
+func TestNewStorageValidation(t *testing.T) {
+	server := newFakeServer(t)
+	defer server.close()
+	cfg := testConfig(server)
+	cfg.table = "stats; DROP TABLE x"
+	if _, err := newStorage(cfg); err == nil {
+		t.Error("expected an error for an invalid table")
+	}
+	cfg = testConfig(server)
+	cfg.batchSize = 0
+	if _, err := newStorage(cfg); err == nil {
+		t.Error("expected an error for no batch size")
+	}
+	cfg = testConfig(server)
+	cfg.conn.address = "127.0.0.1:1"
+	if _, err := newStorage(cfg); err == nil {
+		t.Error("expected an error when the server cannot be reached")
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,281 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// Limits of a publish request of the Pub/Sub API.
+	maxBatchCount = 1000
+	maxBatchBytes = 9 << 20
+	// Backoff before retrying a failed request, doubled after every
+	// attempt up to maxBackoff.
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 10 * time.Second
+	// Minimum time between the logs of the publish errors.
+	errorLogInterval = time.Minute
+)
+
+// publishSettings are how messages are batched and retried, as the
+// PublishSettings of the Pub/Sub client library.
+type publishSettings struct {
+	// A batch is published once it has CountThreshold messages, or
+	// ByteThreshold bytes, or DelayThreshold after its first message.
+	CountThreshold int
+	ByteThreshold  int
+	DelayThreshold time.Duration
+	// Time a batch is retried for.
+	Timeout time.Duration
+	// Maximum number of messages waiting to be published, further
+	// messages being dropped.
+	MaxOutstandingMessages int
+}
+
+// Defaults of the Pub/Sub client library.
+var defaultPublishSettings = publishSettings{
+	CountThreshold:         100,
+	ByteThreshold:          1e6,
+	DelayThreshold:         10 * time.Millisecond,
+	Timeout:                60 * time.Second,
+	MaxOutstandingMessages: 1000,
+}
+
+// message is a Pub/Sub message, as of the publish request.
+type message struct {
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	OrderingKey string            `json:"orderingKey,omitempty"`
+}
+
+func (self *message) size() int {
+	size := len(self.Data) + len(self.OrderingKey)
+	for name, value := range self.Attributes {
+		size += len(name) + len(value)
+	}
+	return size
+}
+
+// publisher publishes messages to a topic in batches, in order, so that
+// the messages of an ordering key are published in order.
+type publisher struct {
+	client *http.Client
+	// URL of the publish method of the topic.
+	url      string
+	settings publishSettings
+
+	queue chan *message
+	done  chan struct{}
+
+	// Counts of the messages published, failed to be published after
+	// retries, and dropped because too many were outstanding.
+	published uint64
+	failed    uint64
+	dropped   uint64
+	// Counts when the errors were last logged, and the last error.
+	logLock      sync.Mutex
+	lastLog      time.Time
+	lastErr      error
+	loggedFailed uint64
+	loggedDrop   uint64
+}
+
+func newPublisher(client *http.Client, url string, settings publishSettings) *publisher {
+	if settings.CountThreshold <= 0 || settings.CountThreshold > maxBatchCount {
+		settings.CountThreshold = maxBatchCount
+	}
+	if settings.ByteThreshold <= 0 || settings.ByteThreshold > maxBatchBytes {
+		settings.ByteThreshold = maxBatchBytes
+	}
+	if settings.MaxOutstandingMessages <= 0 {
+		settings.MaxOutstandingMessages = defaultPublishSettings.MaxOutstandingMessages
+	}
+	self := &publisher{
+		client:   client,
+		url:      url,
+		settings: settings,
+		queue:    make(chan *message, settings.MaxOutstandingMessages),
+		done:     make(chan struct{}),
+	}
+	go self.run()
+	return self
+}
+
+// publish queues a message, dropping it if too many are outstanding.
+func (self *publisher) publish(msg *message) {
+	select {
+	case self.queue <- msg:
+	default:
+		atomic.AddUint64(&self.dropped, 1)
+		self.logErrors(false)
+	}
+}
+
+// run batches the queued messages, and publishes the batches, until the
+// queue is closed and empty.
+func (self *publisher) run() {
+	defer close(self.done)
+	var batch []*message
+	size := 0
+	var timer *time.Timer
+	var deadline <-chan time.Time
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, deadline = nil, nil
+		}
+		if len(batch) > 0 {
+			self.send(batch)
+		}
+		batch, size = nil, 0
+	}
+	for {
+		select {
+		case msg, ok := <-self.queue:
+			if !ok {
+				flush()
+				return
+			}
+			if len(batch) > 0 && size+msg.size() > self.settings.ByteThreshold {
+				flush()
+			}
+			batch = append(batch, msg)
+			size += msg.size()
+			if len(batch) >= self.settings.CountThreshold || size >= self.settings.ByteThreshold {
+				flush()
+			} else if len(batch) == 1 {
+				timer = time.NewTimer(self.settings.DelayThreshold)
+				deadline = timer.C
+			}
+		case <-deadline:
+			flush()
+		}
+	}
+}
+
+// apiError is the error of a failed request.
+type apiError struct {
+	statusCode int
+	status     string
+	message    string
+}
+
+func (self *apiError) Error() string {
+	return fmt.Sprintf("Pub/Sub returned %d %s: %s", self.statusCode, self.status, self.message)
+}
+
+// retryable returns whether a request which failed with an error can be
+// retried, as by the client library: on UNAVAILABLE, RESOURCE_EXHAUSTED,
+// INTERNAL, DEADLINE_EXCEEDED and network errors.
+func retryable(err error) bool {
+	apiErr, ok := err.(*apiError)
+	if !ok {
+		return true
+	}
+	switch apiErr.statusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// send publishes a batch, retrying it with backoff for at most the timeout
+// of the settings.
+func (self *publisher) send(batch []*message) {
+	body, err := json.Marshal(map[string][]*message{"messages": batch})
+	if err == nil {
+		deadline := time.Now().Add(self.settings.Timeout)
+		backoff := minBackoff
+		for {
+			if err = self.post(body); err == nil || !retryable(err) || time.Now().Add(backoff).After(deadline) {
+				break
+			}
+			time.Sleep(backoff)
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+	}
+	if err == nil {
+		atomic.AddUint64(&self.published, uint64(len(batch)))
+		return
+	}
+	atomic.AddUint64(&self.failed, uint64(len(batch)))
+	self.logLock.Lock()
+	self.lastErr = err
+	self.logLock.Unlock()
+	self.logErrors(false)
+}
+
+func (self *publisher) post(body []byte) error {
+	resp, err := self.client.Post(self.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	apiErr := &apiError{statusCode: resp.StatusCode, message: string(b)}
+	var res struct {
+		Error struct {
+			Message string `json:"message"`
+			Status  string `json:"status"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(b, &res) == nil && res.Error.Message != "" {
+		apiErr.status, apiErr.message = res.Error.Status, res.Error.Message
+	}
+	return apiErr
+}
+
+// logErrors logs the counts of the messages failed and dropped since the
+// last log, at most every errorLogInterval unless forced.
+func (self *publisher) logErrors(force bool) {
+	self.logLock.Lock()
+	defer self.logLock.Unlock()
+	if !force && time.Since(self.lastLog) < errorLogInterval {
+		return
+	}
+	failed, dropped := atomic.LoadUint64(&self.failed), atomic.LoadUint64(&self.dropped)
+	if failed == self.loggedFailed && dropped == self.loggedDrop {
+		return
+	}
+	glog.Errorf("Pub/Sub: %d messages failed to be published and %d were dropped because %d were outstanding, last error: %v",
+		failed-self.loggedFailed, dropped-self.loggedDrop, cap(self.queue), self.lastErr)
+	self.lastLog = time.Now()
+	self.loggedFailed, self.loggedDrop = failed, dropped
+}
+
+// close publishes the outstanding messages, and waits for them.
+func (self *publisher) close() {
+	close(self.queue)
+	<-self.done
+	self.logErrors(true)
+}
@@ -0,0 +1,209 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakePubSub records the publish requests, failing the first ones with a
+// status if set.
+type fakePubSub struct {
+	*httptest.Server
+	lock     sync.Mutex
+	requests [][]message
+	// Status of the first failures, and their number.
+	failStatus int
+	failures   int
+}
+
+func newFakePubSub(configure ...func(*fakePubSub)) *fakePubSub {
+	s := &fakePubSub{}
+	for _, f := range configure {
+		f(s)
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/v1/projects/p/topics/t:publish" {
+			http.NotFound(w, r)
+			return
+		}
+		var req struct {
+			Messages []message `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.lock.Lock()
+		s.requests = append(s.requests, req.Messages)
+		fail := s.failures > 0
+		if fail {
+			s.failures--
+		}
+		s.lock.Unlock()
+		if fail {
+			w.WriteHeader(s.failStatus)
+			w.Write([]byte(`{"error": {"code": 0, "message": "try again", "status": "UNAVAILABLE"}}`))
+			return
+		}
+		ids := make([]string, len(req.Messages))
+		for i := range ids {
+			ids[i] = "id"
+		}
+		json.NewEncoder(w).Encode(map[string][]string{"messageIds": ids})
+	}))
+	return s
+}
+
+func (self *fakePubSub) received() [][]message {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return append([][]message(nil), self.requests...)
+}
+
+func (self *fakePubSub) publisher(settings publishSettings) *publisher {
+	return newPublisher(http.DefaultClient, self.URL+"/v1/projects/p/topics/t:publish", settings)
+}
+
+func testMessage(data string) *message {
+	return &message{Data: []byte(data), Attributes: map[string]string{"a": "b"}}
+}
+
+func TestPublishBatches(t *testing.T) {
+	server := newFakePubSub()
+	defer server.Close()
+	p := server.publisher(publishSettings{CountThreshold: 2, ByteThreshold: 1000, DelayThreshold: time.Hour, Timeout: time.Second})
+
+	for _, data := range []string{"1", "2", "3", "4", "5"} {
+		p.publish(testMessage(data))
+	}
+	p.close()
+	// Batches of 2, the last one published on close.
+	var batches []string
+	for _, request := range server.received() {
+		var data []string
+		for _, msg := range request {
+			data = append(data, string(msg.Data))
+		}
+		batches = append(batches, strings.Join(data, ""))
+	}
+	if strings.Join(batches, " ") != "12 34 5" {
+		t.Errorf("expected the batches 12 34 5, got %v", batches)
+	}
+	if msg := server.received()[0][0]; msg.Attributes["a"] != "b" {
+		t.Errorf("expected the attributes, got %+v", msg)
+	}
+	if published := atomic.LoadUint64(&p.published); published != 5 {
+		t.Errorf("expected 5 messages published, got %d", published)
+	}
+}
+
+func TestPublishByteThreshold(t *testing.T) {
+	server := newFakePubSub()
+	defer server.Close()
+	// Messages of 3 bytes, with their attribute.
+	p := server.publisher(publishSettings{CountThreshold: 100, ByteThreshold: 7, DelayThreshold: time.Hour, Timeout: time.Second})
+
+	for _, data := range []string{"1", "2", "3"} {
+		p.publish(testMessage(data))
+	}
+	p.close()
+	if requests := server.received(); len(requests) != 2 || len(requests[0]) != 2 || len(requests[1]) != 1 {
+		t.Errorf("expected batches of 2 and 1 messages, got %v", requests)
+	}
+}
+
+func TestPublishDelayThreshold(t *testing.T) {
+	server := newFakePubSub()
+	defer server.Close()
+	p := server.publisher(publishSettings{CountThreshold: 100, ByteThreshold: 1000, DelayThreshold: 10 * time.Millisecond, Timeout: time.Second})
+	defer p.close()
+
+	p.publish(testMessage("1"))
+	deadline := time.Now().Add(5 * time.Second)
+	for len(server.received()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the batch to be published after its delay")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPublishRetries(t *testing.T) {
+	server := newFakePubSub(func(s *fakePubSub) { s.failStatus, s.failures = http.StatusServiceUnavailable, 2 })
+	defer server.Close()
+	p := server.publisher(publishSettings{CountThreshold: 1, Timeout: 10 * time.Second})
+
+	p.publish(testMessage("1"))
+	p.close()
+	if n := len(server.received()); n != 3 {
+		t.Errorf("expected 3 attempts, got %d", n)
+	}
+	if published, failed := atomic.LoadUint64(&p.published), atomic.LoadUint64(&p.failed); published != 1 || failed != 0 {
+		t.Errorf("expected 1 message published and none failed, got %d and %d", published, failed)
+	}
+}
+
+func TestPublishPermanentError(t *testing.T) {
+	server := newFakePubSub(func(s *fakePubSub) { s.failStatus, s.failures = http.StatusForbidden, 1 })
+	defer server.Close()
+	p := server.publisher(publishSettings{CountThreshold: 1, Timeout: 10 * time.Second})
+
+	p.publish(testMessage("1"))
+	p.close()
+	if n := len(server.received()); n != 1 {
+		t.Errorf("expected the request not to be retried, got %d attempts", n)
+	}
+	if failed := atomic.LoadUint64(&p.failed); failed != 1 {
+		t.Errorf("expected 1 message failed, got %d", failed)
+	}
+	if err, ok := p.lastErr.(*apiError); !ok || err.statusCode != http.StatusForbidden || err.message != "try again" {
+		t.Errorf("expected the error of the API, got %v", p.lastErr)
+	}
+}
+
+func TestPublishTimeout(t *testing.T) {
+	server := newFakePubSub(func(s *fakePubSub) { s.failStatus, s.failures = http.StatusServiceUnavailable, 100 })
+	defer server.Close()
+	p := server.publisher(publishSettings{CountThreshold: 1, Timeout: 250 * time.Millisecond})
+
+	p.publish(testMessage("1"))
+	p.close()
+	// Retried after 100ms, then not after 200ms more.
+	if n := len(server.received()); n != 2 {
+		t.Errorf("expected 2 attempts within the timeout, got %d", n)
+	}
+	if failed := atomic.LoadUint64(&p.failed); failed != 1 {
+		t.Errorf("expected 1 message failed, got %d", failed)
+	}
+}
+
+func TestMaxOutstandingMessages(t *testing.T) {
+	// The queue is not consumed.
+	p := &publisher{queue: make(chan *message, 2)}
+	for i := 0; i < 5; i++ {
+		p.publish(testMessage("1"))
+	}
+	if dropped := atomic.LoadUint64(&p.dropped); dropped != 3 {
+		t.Errorf("expected 3 dropped messages, got %d", dropped)
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+	"github.com/google/cadvisor/storage/bigquery/client"
+	"github.com/google/cadvisor/utils/container"
+
+	"golang.org/x/oauth2"
+)
+
+func init() {
+	storage.RegisterStorageDriver("pubsub", new)
+}
+
+var (
+	argProject        = flag.String("storage_driver_pubsub_project", "", "Google Cloud project of the Pub/Sub topic, defaults to the project of the Application Default Credentials")
+	argTopic          = flag.String("storage_driver_pubsub_topic", "cadvisor", "Pub/Sub topic the stats are published to, its ID or projects/<project>/topics/<topic>")
+	argEndpoint       = flag.String("storage_driver_pubsub_endpoint", "https://pubsub.googleapis.com/", "Pub/Sub API endpoint, e.g. a regional endpoint https://us-east1-pubsub.googleapis.com/ for ordered messages")
+	argOrdering       = flag.Bool("storage_driver_pubsub_ordering", false, "publish the messages of every container with an ordering key, <machine>/<container>, so that subscriptions with message ordering receive them in order")
+	argLabels         = flag.String("storage_driver_pubsub_labels", "", "comma-separated container labels added as attributes of the messages, label_<name>, besides the machine and the container name")
+	argCountThreshold = flag.Int("storage_driver_pubsub_count_threshold", defaultPublishSettings.CountThreshold, "number of messages of a batch publishing them, at most 1000")
+	argByteThreshold  = flag.Int("storage_driver_pubsub_byte_threshold", defaultPublishSettings.ByteThreshold, "size in bytes of the messages of a batch publishing them")
+	argDelayThreshold = flag.Duration("storage_driver_pubsub_delay_threshold", defaultPublishSettings.DelayThreshold, "time after which a batch is published even if smaller")
+	argTimeout        = flag.Duration("storage_driver_pubsub_timeout", defaultPublishSettings.Timeout, "time a failed batch is retried for")
+	argMaxOutstanding = flag.Int("storage_driver_pubsub_max_outstanding_messages", defaultPublishSettings.MaxOutstandingMessages, "maximum number of messages waiting to be published, further messages are dropped")
+)
+
+const (
+	pubsubScope = "https://www.googleapis.com/auth/pubsub"
+	// Timeout of a publish request.
+	requestTimeout = 30 * time.Second
+)
+
+// detailSpec is the JSON of a message, the same as of the Kafka driver but
+// for the timestamp, which is the time of the stats.
+type detailSpec struct {
+	Timestamp       time.Time            `json:"timestamp"`
+	MachineName     string               `json:"machine_name,omitempty"`
+	ContainerName   string               `json:"container_Name,omitempty"`
+	ContainerID     string               `json:"container_Id,omitempty"`
+	ContainerLabels map[string]string    `json:"container_labels,omitempty"`
+	ContainerStats  *info.ContainerStats `json:"container_stats,omitempty"`
+}
+
+type pubsubStorage struct {
+	machineName string
+	ordering    bool
+	// Labels added as attributes.
+	labels    []string
+	publisher *publisher
+}
+
+func new() (storage.StorageDriver, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	tokenSource, project, err := client.DefaultCredentials(pubsubScope)
+	if err != nil {
+		return nil, err
+	}
+	if *argProject != "" {
+		project = *argProject
+	}
+	topic, err := topicPath(project, *argTopic)
+	if err != nil {
+		return nil, err
+	}
+	// Fails early with invalid credentials. The token is refreshed by the
+	// client once expired.
+	token, err := tokenSource.Token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get a Pub/Sub token - %v", err)
+	}
+	httpClient := oauth2.NewClient(oauth2.NoContext, oauth2.ReuseTokenSource(token, tokenSource))
+	httpClient.Timeout = requestTimeout
+	var labels []string
+	for _, label := range strings.Split(*argLabels, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	settings := publishSettings{
+		CountThreshold:         *argCountThreshold,
+		ByteThreshold:          *argByteThreshold,
+		DelayThreshold:         *argDelayThreshold,
+		Timeout:                *argTimeout,
+		MaxOutstandingMessages: *argMaxOutstanding,
+	}
+	return newStorage(config{
+		machineName: hostname,
+		httpClient:  httpClient,
+		endpoint:    *argEndpoint,
+		topic:       topic,
+		ordering:    *argOrdering,
+		labels:      labels,
+		settings:    settings,
+	})
+}
+
+// topicPath returns the full name of a topic, projects/<project>/topics/<topic>.
+func topicPath(project, topic string) (string, error) {
+	if strings.HasPrefix(topic, "projects/") {
+		if parts := strings.Split(topic, "/"); len(parts) != 4 || parts[1] == "" || parts[2] != "topics" || parts[3] == "" {
+			return "", fmt.Errorf("invalid Pub/Sub topic %q", topic)
+		}
+		return topic, nil
+	}
+	if project == "" {
+		return "", fmt.Errorf("no Google Cloud project for the Pub/Sub topic %q", topic)
+	}
+	if topic == "" || strings.Contains(topic, "/") {
+		return "", fmt.Errorf("invalid Pub/Sub topic %q", topic)
+	}
+	return "projects/" + project + "/topics/" + topic, nil
+}
+
+// message returns the message of the stats of a container.
+func (self *pubsubStorage) message(ref info.ContainerReference, stats *info.ContainerStats) (*message, error) {
+	containerName := container.GetPreferredName(ref)
+	data, err := json.Marshal(&detailSpec{
+		Timestamp:       stats.Timestamp,
+		MachineName:     self.machineName,
+		ContainerName:   containerName,
+		ContainerID:     ref.Id,
+		ContainerLabels: ref.Labels,
+		ContainerStats:  stats,
+	})
+	if err != nil {
+		return nil, err
+	}
+	msg := &message{
+		Data: data,
+		Attributes: map[string]string{
+			"machine":        self.machineName,
+			"container_name": containerName,
+		},
+	}
+	for _, label := range self.labels {
+		if value, ok := ref.Labels[label]; ok {
+			msg.Attributes["label_"+label] = value
+		}
+	}
+	if self.ordering {
+		msg.OrderingKey = self.machineName + "/" + ref.Name
+	}
+	return msg, nil
+}
+
+func (self *pubsubStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	if stats == nil {
+		return nil
+	}
+	msg, err := self.message(ref, stats)
+	if err != nil {
+		return err
+	}
+	self.publisher.publish(msg)
+	return nil
+}
+
+// Close publishes the outstanding messages, and waits for them, the
+// messages failing being logged.
+func (self *pubsubStorage) Close() error {
+	self.publisher.close()
+	return nil
+}
+
+// config is the configuration of the driver, populated from the flags.
+type config struct {
+	// A unique identifier to identify the host that current cAdvisor
+	// instance is running on.
+	machineName string
+	// The HTTP client authenticating the requests.
+	httpClient *http.Client
+	// The Pub/Sub API endpoint.
+	endpoint string
+	// The full name of the topic, projects/<project>/topics/<topic>.
+	topic string
+	// Whether to publish the messages with ordering keys.
+	ordering bool
+	// The container labels added as attributes.
+	labels []string
+	// How the messages are batched and retried.
+	settings publishSettings
+}
+
+// Create a new Pub/Sub storage driver.
+func newStorage(cfg config) (*pubsubStorage, error) {
+	if !strings.HasSuffix(cfg.endpoint, "/") {
+		cfg.endpoint += "/"
+	}
+	return &pubsubStorage{
+		machineName: cfg.machineName,
+		ordering:    cfg.ordering,
+		labels:      cfg.labels,
+		publisher:   newPublisher(cfg.httpClient, cfg.endpoint+"v1/"+cfg.topic+":publish", cfg.settings),
+	}, nil
+}
@@ -0,0 +1,123 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+var (
+	testRef = info.ContainerReference{
+		Name:    "/docker/abc",
+		Id:      "abc",
+		Aliases: []string{"web.1", "abc"},
+		Labels:  map[string]string{"app": "shop", "team": "payments", "secret": "x"},
+	}
+	testStats = &info.ContainerStats{
+		Timestamp: time.Unix(1451606400, 0).UTC(),
+		Memory:    info.MemoryStats{Usage: 4096},
+	}
+)
+
+func TestTopicPath(t *testing.T) {
+	for _, test := range []struct {
+		project, topic, expected string
+	}{
+		{"p", "cadvisor", "projects/p/topics/cadvisor"},
+		{"", "projects/other/topics/stats", "projects/other/topics/stats"},
+		{"p", "projects/other/topics/stats", "projects/other/topics/stats"},
+	} {
+		if got, err := topicPath(test.project, test.topic); err != nil || got != test.expected {
+			t.Errorf("%q in %q: expected %q, got %q, %v", test.topic, test.project, test.expected, got, err)
+		}
+	}
+	for _, test := range [][2]string{{"", "cadvisor"}, {"p", ""}, {"p", "a/b"}, {"p", "projects/p/subscriptions/s"}, {"p", "projects//topics/t"}} {
+		if _, err := topicPath(test[0], test[1]); err == nil {
+			t.Errorf("expected an error for %q in %q", test[1], test[0])
+		}
+	}
+}
+
+func TestMessage(t *testing.T) {
+	driver := &pubsubStorage{machineName: "host-1", labels: []string{"app", "team", "missing"}}
+	msg, err := driver.message(testRef, testStats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"machine": "host-1", "container_name": "web.1", "label_app": "shop", "label_team": "payments"}
+	if !reflect.DeepEqual(msg.Attributes, expected) {
+		t.Errorf("expected the attributes %v, got %v", expected, msg.Attributes)
+	}
+	if msg.OrderingKey != "" {
+		t.Errorf("expected no ordering key, got %q", msg.OrderingKey)
+	}
+	var detail detailSpec
+	if err := json.Unmarshal(msg.Data, &detail); err != nil {
+		t.Fatal(err)
+	}
+	if detail.MachineName != "host-1" || detail.ContainerName != "web.1" || detail.ContainerID != "abc" ||
+		!detail.Timestamp.Equal(testStats.Timestamp) || detail.ContainerStats.Memory.Usage != 4096 {
+		t.Errorf("unexpected message %s", msg.Data)
+	}
+
+	driver.ordering = true
+	if msg, _ = driver.message(testRef, testStats); msg.OrderingKey != "host-1//docker/abc" {
+		t.Errorf("expected the ordering key of the container, got %q", msg.OrderingKey)
+	}
+}
+
+func TestAddStats(t *testing.T) {
+	server := newFakePubSub()
+	defer server.Close()
+	driver, err := newStorage(config{
+		machineName: "host-1",
+		httpClient:  http.DefaultClient,
+		endpoint:    server.URL,
+		topic:       "projects/p/topics/t",
+		ordering:    true,
+		settings:    defaultPublishSettings,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := driver.AddStats(testRef, testStats); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Flushes the outstanding messages.
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for _, request := range server.received() {
+		for _, msg := range request {
+			n++
+			if msg.OrderingKey != "host-1//docker/abc" || msg.Attributes["container_name"] != "web.1" {
+				t.Errorf("unexpected message %+v", msg)
+			}
+		}
+	}
+	if n != 3 {
+		t.Errorf("expected 3 messages, got %d", n)
+	}
+}
@@ -0,0 +1,360 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	redis "github.com/garyburd/redigo/redis"
+	"github.com/golang/glog"
+)
+
+// Topologies of the Redis deployment.
+const (
+	// A single Redis instance, or several tried in order.
+	topologyStandalone = "standalone"
+	// A master monitored by Sentinel, looked up from the sentinels.
+	topologySentinel = "sentinel"
+	// A Redis Cluster, whose nodes redirect the commands to the node
+	// serving their key.
+	topologyCluster = "cluster"
+)
+
+// Default ports of Redis and Sentinel.
+const (
+	defaultPort         = "6379"
+	defaultSentinelPort = "26379"
+)
+
+// Maximum number of times a command is redirected or retried.
+const maxAttempts = 3
+
+// Connections are attempted again after a backoff, doubled after every
+// failure.
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// parseAddresses returns the host:port addresses of a comma-separated
+// list, with defaultPort for the addresses without one.
+func parseAddresses(addresses, defaultPort string) ([]string, error) {
+	var ret []string
+	for _, address := range strings.Split(addresses, ",") {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			// No port.
+			host, port = address, defaultPort
+			if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+				host = host[1 : len(host)-1]
+			}
+		}
+		if host == "" || port == "" || strings.ContainsAny(host, "[]") {
+			return nil, fmt.Errorf("invalid Redis address %q", address)
+		}
+		ret = append(ret, net.JoinHostPort(host, port))
+	}
+	if len(ret) == 0 {
+		return nil, fmt.Errorf("no Redis address in %q", addresses)
+	}
+	return ret, nil
+}
+
+// failoverConn is a connection to a Redis deployment which follows its
+// failovers: it reconnects after errors, to the master currently known to
+// the sentinels with Sentinel, and to the node a command is redirected to
+// with Redis Cluster. Commands never wait for more than a few timeouts,
+// and fail right away while reconnecting is backing off.
+type failoverConn struct {
+	lock       sync.Mutex
+	topology   string
+	addresses  []string
+	masterName string
+	dial       func(address string) (redis.Conn, error)
+
+	conn    redis.Conn
+	address string
+	backoff time.Duration
+	// No connection is attempted before.
+	nextDial time.Time
+}
+
+func newFailoverConn(topology, addresses, masterName string, timeout time.Duration) (*failoverConn, error) {
+	port := defaultPort
+	switch topology {
+	case topologyStandalone, topologyCluster:
+	case topologySentinel:
+		if masterName == "" {
+			return nil, fmt.Errorf("the name of the Redis master is required with Sentinel")
+		}
+		port = defaultSentinelPort
+	default:
+		return nil, fmt.Errorf("unknown Redis topology %q, must be %s, %s or %s", topology, topologyStandalone, topologySentinel, topologyCluster)
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("invalid Redis timeout %s", timeout)
+	}
+	parsed, err := parseAddresses(addresses, port)
+	if err != nil {
+		return nil, err
+	}
+	return &failoverConn{
+		topology:   topology,
+		addresses:  parsed,
+		masterName: masterName,
+		dial: func(address string) (redis.Conn, error) {
+			return redis.DialTimeout("tcp", address, timeout, timeout, timeout)
+		},
+	}, nil
+}
+
+// resolveMaster returns the address of the master known to the first
+// sentinel answering.
+func (self *failoverConn) resolveMaster() (string, error) {
+	var lastErr error
+	for _, sentinel := range self.addresses {
+		conn, err := self.dial(sentinel)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		reply, err := redis.Strings(conn.Do("SENTINEL", "get-master-addr-by-name", self.masterName))
+		conn.Close()
+		if err == nil && len(reply) != 2 {
+			err = fmt.Errorf("master %q is unknown", self.masterName)
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("sentinel %s - %s", sentinel, err)
+			continue
+		}
+		return net.JoinHostPort(reply[0], reply[1]), nil
+	}
+	return "", fmt.Errorf("failed to look up the Redis master %q - %s", self.masterName, lastErr)
+}
+
+// candidates returns the addresses to connect to, in order.
+func (self *failoverConn) candidates() ([]string, error) {
+	switch self.topology {
+	case topologySentinel:
+		master, err := self.resolveMaster()
+		if err != nil {
+			return nil, err
+		}
+		return []string{master}, nil
+	case topologyCluster:
+		// The node the last command was redirected to, if any, serves the
+		// key.
+		if self.address != "" {
+			return append([]string{self.address}, self.addresses...), nil
+		}
+	}
+	return self.addresses, nil
+}
+
+// connect connects to the deployment, or to address if not empty. Lock
+// must be held.
+func (self *failoverConn) connect(address string) error {
+	if now := time.Now(); now.Before(self.nextDial) {
+		return fmt.Errorf("Redis is unreachable, reconnecting in %s", self.nextDial.Sub(now))
+	}
+	candidates := []string{address}
+	if address == "" {
+		var err error
+		if candidates, err = self.candidates(); err != nil {
+			return self.failed(err)
+		}
+	}
+	var lastErr error
+	for _, candidate := range candidates {
+		conn, err := self.dial(candidate)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if self.address != candidate {
+			glog.Infof("connected to Redis at %s", candidate)
+		}
+		self.conn = conn
+		self.address = candidate
+		self.backoff = 0
+		return nil
+	}
+	return self.failed(fmt.Errorf("failed to connect to Redis - %s", lastErr))
+}
+
+// failed backs off reconnecting after err.
+func (self *failoverConn) failed(err error) error {
+	self.backoff *= 2
+	if self.backoff < minBackoff {
+		self.backoff = minBackoff
+	}
+	if self.backoff > maxBackoff {
+		self.backoff = maxBackoff
+	}
+	self.nextDial = time.Now().Add(self.backoff)
+	return err
+}
+
+// disconnect closes the connection, after an error. Lock must be held.
+func (self *failoverConn) disconnect() {
+	if self.conn != nil {
+		self.conn.Close()
+		self.conn = nil
+	}
+}
+
+// redirection returns the kind of a cluster redirection, MOVED or ASK, and
+// the address of the node redirected to, or empty strings if err is not a
+// redirection.
+func redirection(err error) (string, string) {
+	redisErr, ok := err.(redis.Error)
+	if !ok {
+		return "", ""
+	}
+	// e.g. MOVED 3999 127.0.0.1:6381
+	fields := strings.Fields(string(redisErr))
+	if len(fields) != 3 || (fields[0] != "MOVED" && fields[0] != "ASK") {
+		return "", ""
+	}
+	return fields[0], fields[2]
+}
+
+// Do sends a command and returns its reply, following the redirections and
+// reconnecting after connection errors, at most maxAttempts times.
+func (self *failoverConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var lastErr error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if self.conn == nil {
+			if err := self.connect(""); err != nil {
+				return nil, err
+			}
+		}
+		reply, err := self.conn.Do(commandName, args...)
+		if err == nil {
+			return reply, nil
+		}
+		lastErr = err
+		if _, ok := err.(redis.Error); !ok {
+			// The connection is broken.
+			glog.Warningf("lost the connection to Redis at %s - %s", self.address, err)
+			self.disconnect()
+			continue
+		}
+		switch kind, address := redirection(err); {
+		case self.topology == topologyCluster && kind == "MOVED":
+			// The slot of the key is now served by another node.
+			self.disconnect()
+			if err := self.connect(address); err != nil {
+				return nil, err
+			}
+		case self.topology == topologyCluster && kind == "ASK":
+			// The slot is being migrated, the command is sent to the
+			// target node once.
+			return self.ask(address, commandName, args...)
+		case strings.HasPrefix(err.Error(), "READONLY"):
+			// The master was demoted to a replica by a failover.
+			glog.Warningf("Redis at %s is a replica, reconnecting to the master", self.address)
+			self.disconnect()
+		default:
+			return nil, err
+		}
+	}
+	return nil, lastErr
+}
+
+// Pipeline sends commands in a single round trip. After a connection
+// error, a redirection or a write to a replica, the connection is
+// reconnected and the commands fail, to be retried one by one with Do.
+func (self *failoverConn) Pipeline(commands []command) []error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	errs := make([]error, len(commands))
+	fail := func(from int, err error) []error {
+		for i := from; i < len(errs); i++ {
+			errs[i] = err
+		}
+		return errs
+	}
+	if self.conn == nil {
+		if err := self.connect(""); err != nil {
+			return fail(0, err)
+		}
+	}
+	for _, c := range commands {
+		self.conn.Send(c.name, c.args...)
+	}
+	if err := self.conn.Flush(); err != nil {
+		glog.Warningf("lost the connection to Redis at %s - %s", self.address, err)
+		self.disconnect()
+		return fail(0, err)
+	}
+	reconnect := false
+	for i := range commands {
+		_, err := self.conn.Receive()
+		if err == nil {
+			continue
+		}
+		errs[i] = err
+		if _, ok := err.(redis.Error); !ok {
+			glog.Warningf("lost the connection to Redis at %s - %s", self.address, err)
+			self.disconnect()
+			return fail(i, err)
+		}
+		if kind, address := redirection(err); self.topology == topologyCluster && kind == "MOVED" {
+			// Reconnect to the node serving the key.
+			self.address = address
+			reconnect = true
+		} else if strings.HasPrefix(err.Error(), "READONLY") {
+			reconnect = true
+		}
+	}
+	if reconnect {
+		self.disconnect()
+	}
+	return errs
+}
+
+func (self *failoverConn) ask(address string, commandName string, args ...interface{}) (interface{}, error) {
+	conn, err := self.dial(address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.Do("ASKING"); err != nil {
+		return nil, err
+	}
+	return conn.Do(commandName, args...)
+}
+
+func (self *failoverConn) Close() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.conn == nil {
+		return nil
+	}
+	err := self.conn.Close()
+	self.conn = nil
+	return err
+}
@@ -0,0 +1,244 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	redis "github.com/garyburd/redigo/redis"
+)
+
+func TestParseAddresses(t *testing.T) {
+	for addresses, expected := range map[string][]string{
+		"localhost:6379":                {"localhost:6379"},
+		"localhost":                     {"localhost:1234"},
+		"10.0.0.1:7000, 10.0.0.2,":      {"10.0.0.1:7000", "10.0.0.2:1234"},
+		"[::1]:7000,::1,[fe80::1]":      {"[::1]:7000", "[::1]:1234", "[fe80::1]:1234"},
+		"redis-0.redis:6379,redis-1:80": {"redis-0.redis:6379", "redis-1:80"},
+	} {
+		actual, err := parseAddresses(addresses, "1234")
+		if err != nil {
+			t.Errorf("unexpected error for %q: %s", addresses, err)
+			continue
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("expected %q to be parsed as %v, got %v", addresses, expected, actual)
+		}
+	}
+	for _, addresses := range []string{"", " , ", ":6379", "[::1"} {
+		if _, err := parseAddresses(addresses, "1234"); err == nil {
+			t.Errorf("expected an error for %q", addresses)
+		}
+	}
+}
+
+// fakeNode is a Redis instance, or a sentinel.
+type fakeNode struct {
+	// Replies to the commands, nil for a node which is down.
+	handler  func(commandName string, args []interface{}) (interface{}, error)
+	commands []string
+}
+
+// fakeNodeConn is a connection to a fakeNode.
+type fakeNodeConn struct {
+	fakeConn
+	node    *fakeNode
+	pending []command
+}
+
+func (self *fakeNodeConn) Send(commandName string, args ...interface{}) error {
+	self.pending = append(self.pending, command{commandName, args})
+	return nil
+}
+
+func (self *fakeNodeConn) Flush() error {
+	if self.node.handler == nil {
+		return errors.New("broken pipe")
+	}
+	return nil
+}
+
+func (self *fakeNodeConn) Receive() (interface{}, error) {
+	c := self.pending[0]
+	self.pending = self.pending[1:]
+	return self.Do(c.name, c.args...)
+}
+
+func (self *fakeNodeConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	self.node.commands = append(self.node.commands, commandName)
+	if self.node.handler == nil {
+		return nil, errors.New("connection reset by peer")
+	}
+	return self.node.handler(commandName, args)
+}
+
+func newTestFailoverConn(t *testing.T, topology, addresses string, nodes map[string]*fakeNode) *failoverConn {
+	conn, err := newFailoverConn(topology, addresses, "mymaster", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.dial = func(address string) (redis.Conn, error) {
+		node, ok := nodes[address]
+		if !ok || node.handler == nil {
+			return nil, errors.New("connection refused")
+		}
+		return &fakeNodeConn{node: node}, nil
+	}
+	return conn
+}
+
+func okHandler(commandName string, args []interface{}) (interface{}, error) {
+	return "OK", nil
+}
+
+func TestSentinelFailover(t *testing.T) {
+	master := "10.0.0.1:6379"
+	sentinel := &fakeNode{handler: func(commandName string, args []interface{}) (interface{}, error) {
+		if commandName != "SENTINEL" || args[0] != "get-master-addr-by-name" || args[1] != "mymaster" {
+			return nil, redis.Error("ERR unknown command")
+		}
+		host, port := strings.Split(master, ":")[0], strings.Split(master, ":")[1]
+		return []interface{}{[]byte(host), []byte(port)}, nil
+	}}
+	oldMaster := &fakeNode{handler: okHandler}
+	newMaster := &fakeNode{handler: okHandler}
+	nodes := map[string]*fakeNode{
+		// The first sentinel is down.
+		"10.0.0.10:26379": {},
+		"10.0.0.11:26379": sentinel,
+		"10.0.0.1:6379":   oldMaster,
+		"10.0.0.2:6379":   newMaster,
+	}
+	conn := newTestFailoverConn(t, topologySentinel, "10.0.0.10,10.0.0.11", nodes)
+	if _, err := conn.Do("LPUSH", "cadvisor", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if conn.address != "10.0.0.1:6379" {
+		t.Errorf("expected to be connected to the master, got %s", conn.address)
+	}
+
+	// The old master is demoted to a replica, and another one promoted.
+	master = "10.0.0.2:6379"
+	oldMaster.handler = func(commandName string, args []interface{}) (interface{}, error) {
+		return nil, redis.Error("READONLY You can't write against a read only replica.")
+	}
+	if _, err := conn.Do("LPUSH", "cadvisor", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if conn.address != "10.0.0.2:6379" || len(newMaster.commands) != 1 {
+		t.Errorf("expected the command to be sent to the new master, got %s and %v", conn.address, newMaster.commands)
+	}
+
+	// The new master goes down, and the old one is promoted again.
+	master = "10.0.0.1:6379"
+	oldMaster.handler = okHandler
+	newMaster.handler = nil
+	if _, err := conn.Do("LPUSH", "cadvisor", "c"); err != nil {
+		t.Fatal(err)
+	}
+	if conn.address != "10.0.0.1:6379" {
+		t.Errorf("expected to be connected to the old master again, got %s", conn.address)
+	}
+}
+
+func TestReconnectBackoff(t *testing.T) {
+	node := &fakeNode{}
+	conn := newTestFailoverConn(t, topologyStandalone, "10.0.0.1", map[string]*fakeNode{"10.0.0.1:6379": node})
+	if _, err := conn.Do("PING"); err == nil {
+		t.Fatalf("expected an error while Redis is down")
+	}
+	// Redis is back, but reconnecting is backing off.
+	node.handler = okHandler
+	if _, err := conn.Do("PING"); err == nil || !strings.Contains(err.Error(), "reconnecting in") {
+		t.Errorf("expected the command to fail right away while backing off, got %v", err)
+	}
+	conn.nextDial = time.Now()
+	if _, err := conn.Do("PING"); err != nil {
+		t.Errorf("expected to reconnect after the backoff, got %s", err)
+	}
+	if conn.backoff != 0 {
+		t.Errorf("expected the backoff to be reset, got %s", conn.backoff)
+	}
+}
+
+func TestClusterRedirections(t *testing.T) {
+	moved := &fakeNode{handler: func(commandName string, args []interface{}) (interface{}, error) {
+		return nil, redis.Error("MOVED 3999 10.0.0.2:7000")
+	}}
+	owner := &fakeNode{handler: okHandler}
+	var importing bool
+	migrating := &fakeNode{handler: func(commandName string, args []interface{}) (interface{}, error) {
+		if commandName == "ASKING" {
+			importing = true
+			return "OK", nil
+		}
+		if !importing {
+			return nil, redis.Error("MOVED 3999 10.0.0.2:7000")
+		}
+		return int64(1), nil
+	}}
+	nodes := map[string]*fakeNode{
+		"10.0.0.1:7000": moved,
+		"10.0.0.2:7000": owner,
+		"10.0.0.3:7000": migrating,
+	}
+	conn := newTestFailoverConn(t, topologyCluster, "10.0.0.1:7000", nodes)
+	if _, err := conn.Do("LPUSH", "cadvisor", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if conn.address != "10.0.0.2:7000" || len(owner.commands) != 1 {
+		t.Errorf("expected the command to follow the MOVED redirection, got %s and %v", conn.address, owner.commands)
+	}
+
+	// The slot is being migrated to another node.
+	owner.handler = func(commandName string, args []interface{}) (interface{}, error) {
+		return nil, redis.Error("ASK 3999 10.0.0.3:7000")
+	}
+	reply, err := conn.Do("LPUSH", "cadvisor", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply != int64(1) || !reflect.DeepEqual(migrating.commands, []string{"ASKING", "LPUSH"}) {
+		t.Errorf("expected the command to be sent to the target node after ASKING, got %v and %v", reply, migrating.commands)
+	}
+	if conn.address != "10.0.0.2:7000" {
+		t.Errorf("expected an ASK redirection not to change the node, got %s", conn.address)
+	}
+
+	// Application errors are not retried.
+	owner.handler = func(commandName string, args []interface{}) (interface{}, error) {
+		return nil, redis.Error("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	owner.commands = nil
+	if _, err := conn.Do("LPUSH", "cadvisor", "c"); err == nil || len(owner.commands) != 1 {
+		t.Errorf("expected the error to be returned right away, got %v after %v", err, owner.commands)
+	}
+}
+
+func TestInvalidTopologies(t *testing.T) {
+	if _, err := newFailoverConn("replicated", "localhost", "", time.Second); err == nil {
+		t.Errorf("expected an error for an unknown topology")
+	}
+	if _, err := newFailoverConn(topologySentinel, "localhost", "", time.Second); err == nil {
+		t.Errorf("expected an error for Sentinel without master name")
+	}
+	if _, err := newFailoverConn(topologyStandalone, "localhost", "", 0); err == nil {
+		t.Errorf("expected an error for no timeout")
+	}
+}
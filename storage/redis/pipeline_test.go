@@ -0,0 +1,159 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+
+	redis "github.com/garyburd/redigo/redis"
+)
+
+func TestBatching(t *testing.T) {
+	conn := &fakeConn{}
+	driver := newTestStorage(conn, modeList, 0)
+	driver.batchSize = 3
+	driver.readyToFlush = func() bool { return false }
+	driver.retention = retention{maxListLen: 10}
+	for i := 0; i < 2; i++ {
+		if err := driver.AddStats(testRef, &info.ContainerStats{Timestamp: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(conn.commands) != 0 {
+		t.Fatalf("expected the stats to be buffered, got %v", conn.commands)
+	}
+	if err := driver.AddStats(testRef, &info.ContainerStats{Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	// The list is trimmed once per batch.
+	expected := [][]interface{}{{"LPUSH", "cadvisor"}, {"LPUSH", "cadvisor"}, {"LPUSH", "cadvisor"}, {"LTRIM", "cadvisor"}}
+	if !reflect.DeepEqual(commandNames(conn), expected) || conn.roundTrips != 1 {
+		t.Errorf("expected %v in a single round trip, got %v in %d", expected, commandNames(conn), conn.roundTrips)
+	}
+}
+
+func TestFlushOnClose(t *testing.T) {
+	conn := &fakeConn{}
+	driver := newTestStorage(conn, modeList, 0)
+	driver.batchSize = 100
+	driver.readyToFlush = func() bool { return false }
+	if err := driver.AddStats(testRef, &info.ContainerStats{Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if expected := [][]interface{}{{"LPUSH", "cadvisor"}}; !reflect.DeepEqual(commandNames(conn), expected) {
+		t.Errorf("expected the buffered stats to be written on close, got %v", conn.commands)
+	}
+}
+
+func TestPipelineRetry(t *testing.T) {
+	conn := &fakeConn{}
+	driver := newTestStorage(conn, modeList, 0)
+	// The first two commands of the pipeline fail, and succeed when
+	// retried.
+	conn.failNext = 2
+	if err := driver.flush([]command{{"LPUSH", []interface{}{"cadvisor", "a"}}, {"LPUSH", []interface{}{"cadvisor", "b"}}, {"LPUSH", []interface{}{"cadvisor", "c"}}}); err != nil {
+		t.Errorf("expected the failed commands to be retried, got %s", err)
+	}
+	if conn.roundTrips != 3 || driver.Dropped() != 0 {
+		t.Errorf("expected the pipeline and 2 retries, got %d round trips and %d dropped", conn.roundTrips, driver.Dropped())
+	}
+
+	// Then Redis goes down.
+	conn.failNext = 5
+	if err := driver.flush([]command{{"LPUSH", []interface{}{"cadvisor", "a"}}, {"LPUSH", []interface{}{"cadvisor", "b"}}, {"LPUSH", []interface{}{"cadvisor", "c"}}}); err == nil {
+		t.Errorf("expected an error for the dropped commands")
+	}
+	if driver.Dropped() != 2 {
+		t.Errorf("expected 2 dropped commands, got %d", driver.Dropped())
+	}
+}
+
+func TestClusterPipelineRedirection(t *testing.T) {
+	moved := &fakeNode{handler: func(commandName string, args []interface{}) (interface{}, error) {
+		return nil, redis.Error("MOVED 3999 10.0.0.2:7000")
+	}}
+	owner := &fakeNode{handler: okHandler}
+	conn := newTestFailoverConn(t, topologyCluster, "10.0.0.1:7000", map[string]*fakeNode{
+		"10.0.0.1:7000": moved,
+		"10.0.0.2:7000": owner,
+	})
+	commands := []command{{"LPUSH", []interface{}{"cadvisor", "a"}}, {"LTRIM", []interface{}{"cadvisor", 0, 9}}}
+	for _, err := range conn.Pipeline(commands) {
+		if err == nil {
+			t.Errorf("expected the redirected commands to fail")
+		}
+	}
+	// The next pipeline goes to the node serving the key.
+	for _, err := range conn.Pipeline(commands) {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if !reflect.DeepEqual(owner.commands, []string{"LPUSH", "LTRIM"}) {
+		t.Errorf("expected the commands to be sent to the node serving the key, got %v", owner.commands)
+	}
+
+	// The connection breaks.
+	owner.handler = nil
+	for _, err := range conn.Pipeline(commands) {
+		if err == nil {
+			t.Errorf("expected the commands to fail when the connection breaks")
+		}
+	}
+	if conn.conn != nil {
+		t.Errorf("expected the broken connection to be closed")
+	}
+}
+
+// benchmarkRoundTrips reports the round trips to Redis needed to write the
+// stats of 100 containers.
+func benchmarkRoundTrips(b *testing.B, batchSize int) {
+	conn := &fakeConn{}
+	driver := newTestStorage(conn, modeList, 0)
+	driver.batchSize = batchSize
+	driver.readyToFlush = func() bool { return false }
+	driver.retention = retention{maxListLen: 100000, ttl: time.Hour}
+	refs := make([]info.ContainerReference, 100)
+	for i := range refs {
+		refs[i] = info.ContainerReference{Name: fmt.Sprintf("/docker/%d", i)}
+	}
+	stats := &info.ContainerStats{Timestamp: time.Now()}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, ref := range refs {
+			if err := driver.AddStats(ref, stats); err != nil {
+				b.Fatal(err)
+			}
+		}
+		conn.commands = nil
+	}
+	b.Logf("%d round trips/op", conn.roundTrips/b.N)
+}
+
+func BenchmarkRoundTripsUnbatched(b *testing.B) {
+	benchmarkRoundTrips(b, 1)
+}
+
+func BenchmarkRoundTripsPipelined(b *testing.B) {
+	benchmarkRoundTrips(b, 100)
+}
@@ -16,28 +16,64 @@ package redis
 
 import (
 	"encoding/json"
+	"flag"
+	"fmt"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	info "github.com/google/cadvisor/info/v1"
 	storage "github.com/google/cadvisor/storage"
-
-	redis "github.com/garyburd/redigo/redis"
 )
 
 func init() {
 	storage.RegisterStorageDriver("redis", new)
 }
 
+var (
+	argMode         = flag.String("storage_driver_redis_mode", modeList, "how the stats are written to Redis: 'list' pushes them to the list of -storage_driver_db, 'stream' adds them to the stream of -storage_driver_db")
+	argStreamMaxLen = flag.Int("storage_driver_redis_stream_max_len", 0, "approximate maximum number of entries of the Redis stream, trimmed as entries are added; 0 for no limit")
+	argTopology     = flag.String("storage_driver_redis_topology", topologyStandalone, "Redis deployment of -storage_driver_host, a comma-separated list of addresses: 'standalone' instances tried in order, the 'sentinel' instances monitoring the master of -storage_driver_redis_master_name, or seed nodes of a 'cluster'")
+	argMasterName   = flag.String("storage_driver_redis_master_name", "", "name of the master monitored by Sentinel")
+	argTimeout      = flag.Duration("storage_driver_redis_timeout", time.Second, "timeout of the connections to Redis and of the commands")
+	argMaxListLen   = flag.Int("storage_driver_redis_max_list_len", 0, "maximum number of stats kept in the Redis list, the oldest ones being trimmed after every push; 0 for no limit")
+	argTTL          = flag.Duration("storage_driver_redis_ttl", 0, "time to live of the Redis key, refreshed after every write, e.g. 168h; 0 to keep it forever")
+	argBatchSize    = flag.Int("storage_driver_redis_batch_size", 100, "number of stats buffered before they are written to Redis in a single pipeline, even if -storage_driver_buffer_duration has not elapsed")
+	argKeyPerDay    = flag.Bool("storage_driver_redis_key_per_day", false, "shard the Redis key by day, e.g. cadvisor:2016-05-17, so that old days expire wholesale with -storage_driver_redis_ttl")
+)
+
+// command is a Redis command and its arguments.
+type command struct {
+	name string
+	args []interface{}
+}
+
+// conn sends commands to Redis.
+type conn interface {
+	Do(commandName string, args ...interface{}) (interface{}, error)
+	// Pipeline sends commands in a single round trip, and returns their
+	// errors.
+	Pipeline(commands []command) []error
+	Close() error
+}
+
 type redisStorage struct {
-	conn           redis.Conn
+	conn           conn
 	machineName    string
 	redisKey       string
+	mode           string
+	streamMaxLen   int
+	retention      retention
+	batchSize      int
 	bufferDuration time.Duration
 	lastWrite      time.Time
-	lock           sync.Mutex
-	readyToFlush   func() bool
+	// Commands writing the stats buffered since lastWrite.
+	buffer       []command
+	lock         sync.Mutex
+	readyToFlush func() bool
+	// Number of commands dropped because they could not be written.
+	dropped uint64
 }
 
 type detailSpec struct {
@@ -56,6 +92,17 @@ func new() (storage.StorageDriver, error) {
 		hostname,
 		*storage.ArgDbName,
 		*storage.ArgDbHost,
+		*argTopology,
+		*argMasterName,
+		*argTimeout,
+		*argMode,
+		*argStreamMaxLen,
+		retention{
+			maxListLen: *argMaxListLen,
+			ttl:        *argTTL,
+			keyPerDay:  *argKeyPerDay,
+		},
+		*argBatchSize,
 		*storage.ArgDbBufferDuration,
 	)
 }
@@ -87,50 +134,155 @@ func (self *redisStorage) AddStats(ref info.ContainerReference, stats *info.Cont
 	if stats == nil {
 		return nil
 	}
-	var seriesToFlush []byte
+	// Add some default params based on containerStats
+	detail := self.containerStatsAndDefaultValues(ref, stats)
+	write, err := self.writeCommand(detail)
+	if err != nil {
+		return err
+	}
+	var commandsToFlush []command
 	func() {
 		// AddStats will be invoked simultaneously from multiple threads and only one of them will perform a write.
 		self.lock.Lock()
 		defer self.lock.Unlock()
-		// Add some default params based on containerStats
-		detail := self.containerStatsAndDefaultValues(ref, stats)
-		// To json
-		b, _ := json.Marshal(detail)
-		if self.readyToFlush() {
-			seriesToFlush = b
+		self.buffer = append(self.buffer, write)
+		if len(self.buffer) >= self.batchSize || self.readyToFlush() {
+			commandsToFlush = self.buffer
+			self.buffer = nil
 			self.lastWrite = time.Now()
 		}
 	}()
-	if len(seriesToFlush) > 0 {
-		// We use redis's "LPUSH" to push the data to the redis
-		self.conn.Send("LPUSH", self.redisKey, seriesToFlush)
+	if len(commandsToFlush) == 0 {
+		return nil
+	}
+	return self.flush(commandsToFlush)
+}
+
+// writeCommand returns the command writing the stats of a container.
+func (self *redisStorage) writeCommand(detail *detailSpec) (command, error) {
+	key := self.retention.key(self.redisKey, time.Unix(0, detail.Timestamp*int64(time.Microsecond)))
+	if self.mode == modeStream {
+		args, err := xaddArgs(key, self.streamMaxLen, detail)
+		if err != nil {
+			return command{}, err
+		}
+		return command{"XADD", args}, nil
+	}
+	// To json
+	b, err := json.Marshal(detail)
+	if err != nil {
+		return command{}, err
+	}
+	// We use redis's "LPUSH" to push the data to the redis
+	return command{"LPUSH", []interface{}{key, b}}, nil
+}
+
+// flush writes buffered stats in a single pipeline, followed by the
+// retention commands of their keys. The commands which fail are retried
+// once, and dropped if they fail again.
+func (self *redisStorage) flush(commands []command) error {
+	seen := make(map[string]bool)
+	for _, c := range commands {
+		key := c.args[0].(string)
+		if !seen[key] {
+			seen[key] = true
+			commands = append(commands, self.retention.commands(key, self.mode == modeList)...)
+		}
+	}
+	var failed []command
+	for i, err := range self.conn.Pipeline(commands) {
+		if err != nil {
+			failed = append(failed, commands[i])
+		}
+	}
+	var lastErr error
+	dropped := 0
+	for _, c := range failed {
+		if _, err := self.conn.Do(c.name, c.args...); err != nil {
+			lastErr = err
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		total := atomic.AddUint64(&self.dropped, uint64(dropped))
+		return fmt.Errorf("failed to write %d of %d commands to Redis, dropped them (%d dropped in total) - %s", dropped, len(commands), total, lastErr)
 	}
 	return nil
 }
 
+// Dropped returns the number of commands dropped because they could not be
+// written to Redis.
+func (self *redisStorage) Dropped() uint64 {
+	return atomic.LoadUint64(&self.dropped)
+}
+
 func (self *redisStorage) Close() error {
-	return self.conn.Close()
+	self.lock.Lock()
+	commandsToFlush := self.buffer
+	self.buffer = nil
+	self.lock.Unlock()
+	var err error
+	if len(commandsToFlush) > 0 {
+		err = self.flush(commandsToFlush)
+	}
+	if closeErr := self.conn.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
 
 // Create a new redis storage driver.
 // machineName: A unique identifier to identify the host that runs the current cAdvisor
 // instance is running on.
-// redisHost: The host which runs redis.
 // redisKey: The key for the Data that stored in the redis
+// redisHosts: The comma-separated addresses of the redis deployment.
+// topology: Whether the addresses are standalone instances, sentinels or cluster nodes
+// masterName: The name of the master monitored by the sentinels
+// timeout: The timeout of the connections and commands
+// mode: Whether the data is pushed to a list or added to a stream
+// streamMaxLen: The approximate maximum length of the stream, 0 for no limit
+// retention: The bounds of the data kept in redis
+// batchSize: The number of stats buffered before being written, even if bufferDuration has not elapsed
 func newStorage(
 	machineName,
 	redisKey,
-	redisHost string,
+	redisHosts,
+	topology,
+	masterName string,
+	timeout time.Duration,
+	mode string,
+	streamMaxLen int,
+	retention retention,
+	batchSize int,
 	bufferDuration time.Duration,
 ) (storage.StorageDriver, error) {
-	conn, err := redis.Dial("tcp", redisHost)
+	if mode != modeList && mode != modeStream {
+		return nil, fmt.Errorf("unknown Redis mode %q, must be %s or %s", mode, modeList, modeStream)
+	}
+	if streamMaxLen < 0 {
+		return nil, fmt.Errorf("invalid Redis stream maximum length %d", streamMaxLen)
+	}
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("invalid Redis batch size %d", batchSize)
+	}
+	if err := retention.validate(); err != nil {
+		return nil, err
+	}
+	conn, err := newFailoverConn(topology, redisHosts, masterName, timeout)
 	if err != nil {
 		return nil, err
 	}
+	if _, err := conn.Do("PING"); err != nil {
+		return nil, err
+	}
 	ret := &redisStorage{
 		conn:           conn,
 		machineName:    machineName,
 		redisKey:       redisKey,
+		mode:           mode,
+		streamMaxLen:   streamMaxLen,
+		retention:      retention,
+		batchSize:      batchSize,
 		bufferDuration: bufferDuration,
 		lastWrite:      time.Now(),
 	}
@@ -0,0 +1,68 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"fmt"
+	"time"
+)
+
+// Format of the day suffix of the keys sharded by day.
+const dayFormat = "2006-01-02"
+
+// retention bounds the data kept in Redis. The zero value keeps everything
+// forever, in a single key.
+type retention struct {
+	// Maximum length of the lists, 0 for no limit. The oldest stats are
+	// trimmed after every push.
+	maxListLen int
+	// Time to live of the keys, refreshed after every write, 0 for none.
+	ttl time.Duration
+	// Shard the key by day, e.g. cadvisor:2016-05-17, so that old days
+	// expire wholesale.
+	keyPerDay bool
+}
+
+func (self retention) validate() error {
+	if self.maxListLen < 0 {
+		return fmt.Errorf("invalid Redis maximum list length %d", self.maxListLen)
+	}
+	if self.ttl != 0 && self.ttl < time.Second {
+		return fmt.Errorf("invalid Redis key TTL %s, must be at least 1s", self.ttl)
+	}
+	return nil
+}
+
+// key returns the key of the stats collected at timestamp.
+func (self retention) key(redisKey string, timestamp time.Time) string {
+	if !self.keyPerDay {
+		return redisKey
+	}
+	return redisKey + ":" + timestamp.UTC().Format(dayFormat)
+}
+
+// commands returns the commands trimming the list of key and refreshing its
+// TTL after a write.
+func (self retention) commands(key string, isList bool) []command {
+	var ret []command
+	if isList && self.maxListLen > 0 {
+		// The newest stats are at the head of the list.
+		ret = append(ret, command{"LTRIM", []interface{}{key, 0, self.maxListLen - 1}})
+	}
+	if self.ttl > 0 {
+		ret = append(ret, command{"EXPIRE", []interface{}{key, int64(self.ttl / time.Second)}})
+	}
+	return ret
+}
@@ -0,0 +1,95 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// commandNames returns the commands sent, with their key.
+func commandNames(conn *fakeConn) [][]interface{} {
+	var ret [][]interface{}
+	for _, command := range conn.commands {
+		ret = append(ret, command[:2])
+	}
+	return ret
+}
+
+func TestUnboundedByDefault(t *testing.T) {
+	conn := &fakeConn{}
+	driver := newTestStorage(conn, modeList, 0)
+	if err := driver.AddStats(testRef, &info.ContainerStats{Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if expected := [][]interface{}{{"LPUSH", "cadvisor"}}; !reflect.DeepEqual(commandNames(conn), expected) {
+		t.Errorf("expected %v, got %v", expected, conn.commands)
+	}
+}
+
+func TestListRetention(t *testing.T) {
+	conn := &fakeConn{}
+	driver := newTestStorage(conn, modeList, 0)
+	driver.retention = retention{maxListLen: 1000, ttl: 48 * time.Hour, keyPerDay: true}
+	timestamp := time.Date(2016, 5, 17, 23, 59, 59, 0, time.UTC)
+	if err := driver.AddStats(testRef, &info.ContainerStats{Timestamp: timestamp}); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.commands) != 3 {
+		t.Fatalf("expected 3 commands, got %v", conn.commands)
+	}
+	if command := conn.commands[0]; command[0] != "LPUSH" || command[1] != "cadvisor:2016-05-17" {
+		t.Errorf("expected the stats to be pushed to the key of the day, got %v", command)
+	}
+	if expected := []interface{}{"LTRIM", "cadvisor:2016-05-17", 0, 999}; !reflect.DeepEqual(conn.commands[1], expected) {
+		t.Errorf("expected %v, got %v", expected, conn.commands[1])
+	}
+	if expected := []interface{}{"EXPIRE", "cadvisor:2016-05-17", int64(172800)}; !reflect.DeepEqual(conn.commands[2], expected) {
+		t.Errorf("expected %v, got %v", expected, conn.commands[2])
+	}
+
+	// The next day goes to another key.
+	conn.commands = nil
+	if err := driver.AddStats(testRef, &info.ContainerStats{Timestamp: timestamp.Add(time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+	if key := conn.commands[0][1]; key != "cadvisor:2016-05-18" {
+		t.Errorf("expected the key of the next day, got %v", key)
+	}
+}
+
+func TestStreamRetention(t *testing.T) {
+	conn := &fakeConn{}
+	driver := newTestStorage(conn, modeStream, 100)
+	driver.retention = retention{maxListLen: 1000, ttl: time.Hour}
+	if err := driver.AddStats(testRef, &info.ContainerStats{Timestamp: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	// Streams are trimmed by XADD itself.
+	if expected := [][]interface{}{{"XADD", "cadvisor"}, {"EXPIRE", "cadvisor"}}; !reflect.DeepEqual(commandNames(conn), expected) {
+		t.Errorf("expected %v, got %v", expected, conn.commands)
+	}
+}
+
+func TestInvalidRetention(t *testing.T) {
+	for _, r := range []retention{{maxListLen: -1}, {ttl: time.Millisecond}, {ttl: -time.Hour}} {
+		if err := r.validate(); err == nil {
+			t.Errorf("expected an error for %+v", r)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	redis "github.com/garyburd/redigo/redis"
+)
+
+// Modes of the driver.
+const (
+	// The stats are pushed to a list, in JSON.
+	modeList = "list"
+	// The stats are added to a stream, so that they can be read by consumer
+	// groups.
+	modeStream = "stream"
+)
+
+// Fields of the stream entries. The machine and container names are fields
+// of their own so that consumers can filter the entries without decoding
+// the stats.
+const (
+	fieldMachineName    = "machine_name"
+	fieldContainerName  = "container_name"
+	fieldTimestamp      = "timestamp"
+	fieldContainerStats = "container_stats"
+)
+
+// xaddArgs returns the arguments of the XADD command adding the stats of a
+// container to a stream. The stream is trimmed to about maxLen entries,
+// which is cheaper than trimming it exactly, or not at all if maxLen is 0.
+func xaddArgs(key string, maxLen int, detail *detailSpec) (redis.Args, error) {
+	b, err := json.Marshal(detail.ContainerStats)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the stats of container %q - %s", detail.ContainerName, err)
+	}
+	args := redis.Args{key}
+	if maxLen > 0 {
+		args = args.Add("MAXLEN", "~", maxLen)
+	}
+	return args.Add("*",
+		fieldMachineName, detail.MachineName,
+		fieldContainerName, detail.ContainerName,
+		fieldTimestamp, strconv.FormatInt(detail.Timestamp, 10),
+		fieldContainerStats, b,
+	), nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2015 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// fakeConn records the commands sent to Redis, replying to them with err,
+// or with an error to the next failNext ones.
+type fakeConn struct {
+	commands   [][]interface{}
+	err        error
+	failNext   int
+	roundTrips int
+}
+
+func (self *fakeConn) record(commandName string, args []interface{}) error {
+	self.commands = append(self.commands, append([]interface{}{commandName}, args...))
+	if self.failNext > 0 {
+		self.failNext--
+		return errors.New("connection reset by peer")
+	}
+	return self.err
+}
+
+func (self *fakeConn) Close() error { return nil }
+func (self *fakeConn) Err() error   { return nil }
+
+func (self *fakeConn) Do(commandName string, args ...interface{}) (interface{}, error) {
+	self.roundTrips++
+	return "OK", self.record(commandName, args)
+}
+
+func (self *fakeConn) Send(commandName string, args ...interface{}) error {
+	return self.record(commandName, args)
+}
+
+func (self *fakeConn) Pipeline(commands []command) []error {
+	self.roundTrips++
+	errs := make([]error, len(commands))
+	for i, c := range commands {
+		errs[i] = self.record(c.name, c.args)
+	}
+	return errs
+}
+
+func (self *fakeConn) Flush() error                  { return self.err }
+func (self *fakeConn) Receive() (interface{}, error) { return "OK", self.err }
+
+func newTestStorage(conn *fakeConn, mode string, streamMaxLen int) *redisStorage {
+	ret := &redisStorage{
+		conn:         conn,
+		machineName:  "machineA",
+		redisKey:     "cadvisor",
+		mode:         mode,
+		streamMaxLen: streamMaxLen,
+		batchSize:    1,
+	}
+	ret.readyToFlush = func() bool { return true }
+	return ret
+}
+
+var testRef = info.ContainerReference{Name: "/docker/abcd", Aliases: []string{"web", "abcd"}}
+
+func TestStreamMode(t *testing.T) {
+	conn := &fakeConn{}
+	driver := newTestStorage(conn, modeStream, 1000)
+	stats := &info.ContainerStats{Timestamp: time.Unix(1460000000, 0), Memory: info.MemoryStats{Usage: 1024}}
+	if err := driver.AddStats(testRef, stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.commands) != 1 {
+		t.Fatalf("expected 1 command, got %v", conn.commands)
+	}
+	command := conn.commands[0]
+	expected := []interface{}{
+		"XADD", "cadvisor", "MAXLEN", "~", 1000, "*",
+		"machine_name", "machineA",
+		"container_name", "web",
+		"timestamp", "1460000000000000",
+	}
+	if len(command) != len(expected)+2 || !reflect.DeepEqual(command[:len(expected)], expected) || command[len(expected)] != "container_stats" {
+		t.Fatalf("expected command %v followed by the stats, got %v", expected, command)
+	}
+	var actual info.ContainerStats
+	if err := json.Unmarshal(command[len(expected)+1].([]byte), &actual); err != nil {
+		t.Fatal(err)
+	}
+	if actual.Memory.Usage != 1024 {
+		t.Errorf("expected the stats of the container, got %+v", actual)
+	}
+}
+
+func TestStreamModeWithoutTrimming(t *testing.T) {
+	conn := &fakeConn{}
+	driver := newTestStorage(conn, modeStream, 0)
+	if err := driver.AddStats(testRef, &info.ContainerStats{}); err != nil {
+		t.Fatal(err)
+	}
+	if command := conn.commands[0]; command[0] != "XADD" || command[1] != "cadvisor" || command[2] != "*" {
+		t.Errorf("expected the stream not to be trimmed, got %v", command)
+	}
+
+	conn.err = fmt.Errorf("ERR unknown command 'XADD'")
+	if err := driver.AddStats(testRef, &info.ContainerStats{}); err == nil {
+		t.Errorf("expected the XADD error to be returned")
+	}
+}
+
+func TestListMode(t *testing.T) {
+	conn := &fakeConn{}
+	driver := newTestStorage(conn, modeList, 0)
+	if err := driver.AddStats(testRef, &info.ContainerStats{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.commands) != 1 || conn.commands[0][0] != "LPUSH" || conn.commands[0][1] != "cadvisor" {
+		t.Fatalf("expected the stats to be pushed to the list, got %v", conn.commands)
+	}
+	var detail detailSpec
+	if err := json.Unmarshal(conn.commands[0][2].([]byte), &detail); err != nil {
+		t.Fatal(err)
+	}
+	if detail.MachineName != "machineA" || detail.ContainerName != "web" {
+		t.Errorf("unexpected detail %+v", detail)
+	}
+}
+
+func TestInvalidMode(t *testing.T) {
+	if _, err := newStorage("machineA", "cadvisor", "localhost:6379", topologyStandalone, "", time.Second, "pubsub", 0, retention{}, 1, time.Minute); err == nil {
+		t.Errorf("expected an error for an unknown mode")
+	}
+	if _, err := newStorage("machineA", "cadvisor", "localhost:6379", topologyStandalone, "", time.Second, modeStream, -1, retention{}, 1, time.Minute); err == nil {
+		t.Errorf("expected an error for a negative stream length")
+	}
+}
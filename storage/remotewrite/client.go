@@ -0,0 +1,226 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remotewrite
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/cadvisor/storage/remotewrite/prompb"
+
+	"github.com/golang/glog"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+)
+
+const (
+	// Version of the remote write protocol, sent in a header of the
+	// requests.
+	remoteWriteVersion = "0.1.0"
+	// Number of attempts at sending a batch the endpoint failed to write.
+	maxSendAttempts = 3
+)
+
+// sender queues the time series and sends them in batches to the remote
+// write endpoint, from a goroutine of its own so that the housekeeping of
+// the containers never waits on the endpoint.
+type sender struct {
+	url           string
+	client        *http.Client
+	username      string
+	password      string
+	bearerToken   string
+	batchSize     int
+	flushInterval time.Duration
+	// Backoff before the first retry of a batch, doubled for each retry.
+	retryBackoff time.Duration
+
+	queue chan *prompb.TimeSeries
+	// Number of series dropped because the queue was full, since the
+	// last batch.
+	dropped uint64
+
+	// Metadata of the metric families, by name, sent along with their
+	// series.
+	metadataLock sync.Mutex
+	metadata     map[string]*prompb.MetricMetadata
+
+	done chan struct{}
+}
+
+func newSender(url, username, password, bearerToken string, batchSize, queueDepth int, flushInterval time.Duration) *sender {
+	ret := &sender{
+		url:           url,
+		client:        &http.Client{Timeout: 30 * time.Second},
+		username:      username,
+		password:      password,
+		bearerToken:   bearerToken,
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		retryBackoff:  time.Second,
+		queue:         make(chan *prompb.TimeSeries, queueDepth),
+		metadata:      make(map[string]*prompb.MetricMetadata),
+		done:          make(chan struct{}),
+	}
+	go ret.run()
+	return ret
+}
+
+// enqueue queues time series to be sent, and drops them if the queue is
+// full.
+func (self *sender) enqueue(series []*prompb.TimeSeries, metadata []*prompb.MetricMetadata) {
+	self.metadataLock.Lock()
+	for _, m := range metadata {
+		self.metadata[m.MetricFamilyName] = m
+	}
+	self.metadataLock.Unlock()
+	for i, ts := range series {
+		select {
+		case self.queue <- ts:
+		default:
+			atomic.AddUint64(&self.dropped, uint64(len(series)-i))
+			return
+		}
+	}
+}
+
+func (self *sender) run() {
+	defer close(self.done)
+	ticker := time.NewTicker(self.flushInterval)
+	defer ticker.Stop()
+	batch := make([]*prompb.TimeSeries, 0, self.batchSize)
+	flush := func() {
+		if dropped := atomic.SwapUint64(&self.dropped, 0); dropped > 0 {
+			glog.Warningf("remote write queue full, dropped %d series", dropped)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if err := self.send(batch); err != nil {
+			glog.Errorf("failed to write %d series to %s - %s", len(batch), self.url, err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case ts, ok := <-self.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, ts)
+			if len(batch) >= self.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// close sends the queued series, and waits for them to be sent.
+func (self *sender) close() {
+	close(self.queue)
+	<-self.done
+}
+
+// writeRequest returns the write request of a batch of series, with the
+// metadata of their families.
+func (self *sender) writeRequest(batch []*prompb.TimeSeries) *prompb.WriteRequest {
+	req := &prompb.WriteRequest{Timeseries: batch}
+	seen := make(map[string]bool)
+	self.metadataLock.Lock()
+	defer self.metadataLock.Unlock()
+	for _, ts := range batch {
+		name := seriesName(ts)
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		if m, ok := self.metadata[name]; ok {
+			req.Metadata = append(req.Metadata, m)
+		}
+	}
+	return req
+}
+
+func seriesName(ts *prompb.TimeSeries) string {
+	for _, l := range ts.Labels {
+		if l.Name == "__name__" {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+// send writes a batch of series, retrying when the endpoint fails to, but
+// not when it rejects them.
+func (self *sender) send(batch []*prompb.TimeSeries) error {
+	b, err := proto.Marshal(self.writeRequest(batch))
+	if err != nil {
+		return err
+	}
+	body := snappy.Encode(nil, b)
+	backoff := self.retryBackoff
+	for attempt := 1; ; attempt++ {
+		retryable, err := self.post(body)
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt == maxSendAttempts {
+			return err
+		}
+		glog.V(2).Infof("retrying the write of %d series to %s in %v - %s", len(batch), self.url, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// post sends a write request, and returns whether it is worth sending it
+// again if it failed: the endpoint could not be reached, was throttling,
+// or failed on its side.
+func (self *sender) post(body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", self.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "cAdvisor")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", remoteWriteVersion)
+	if self.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+self.bearerToken)
+	} else if self.username != "" {
+		req.SetBasicAuth(self.username, self.password)
+	}
+	resp, err := self.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return false, nil
+	}
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("server returned %s: %s", resp.Status, bytes.TrimSpace(msg))
+	return resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests, err
+}
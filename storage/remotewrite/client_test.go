@@ -0,0 +1,159 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remotewrite
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/storage/remotewrite/prompb"
+)
+
+func testSeries(n int) []*prompb.TimeSeries {
+	series := make([]*prompb.TimeSeries, n)
+	for i := range series {
+		series[i] = &prompb.TimeSeries{
+			Labels:  []*prompb.Label{{Name: "__name__", Value: "container_tasks"}, {Name: "id", Value: fmt.Sprintf("/c%d", i)}},
+			Samples: []*prompb.Sample{{Value: float64(i), Timestamp: 1000}},
+		}
+	}
+	return series
+}
+
+func testMetadata() []*prompb.MetricMetadata {
+	return []*prompb.MetricMetadata{{Type: prompb.MetricType_GAUGE, MetricFamilyName: "container_tasks"}}
+}
+
+func TestSenderHeaders(t *testing.T) {
+	for _, test := range []struct {
+		username, password, bearerToken string
+		authorization                   string
+	}{
+		{"", "", "", ""},
+		{"user", "secret", "", "Basic dXNlcjpzZWNyZXQ="},
+		{"", "", "token", "Bearer token"},
+	} {
+		endpoint := &fakeEndpoint{}
+		server := httptest.NewServer(endpoint)
+		s := newSender(server.URL, test.username, test.password, test.bearerToken, 10, 10, time.Hour)
+		s.enqueue(testSeries(1), testMetadata())
+		s.close()
+		server.Close()
+
+		if len(endpoint.headers) != 1 {
+			t.Fatalf("expected 1 request, got %d", len(endpoint.headers))
+		}
+		header := endpoint.headers[0]
+		for name, value := range map[string]string{
+			"Content-Encoding":                  "snappy",
+			"Content-Type":                      "application/x-protobuf",
+			"X-Prometheus-Remote-Write-Version": "0.1.0",
+			"Authorization":                     test.authorization,
+		} {
+			if got := header.Get(name); got != value {
+				t.Errorf("%s: expected %q, got %q", name, value, got)
+			}
+		}
+		requests := endpoint.received()
+		if len(requests) != 1 || len(requests[0].Metadata) != 1 || requests[0].Metadata[0].Type != prompb.MetricType_GAUGE {
+			t.Errorf("expected the series with their metadata, got %v", requests)
+		}
+	}
+}
+
+func TestSenderBatches(t *testing.T) {
+	endpoint := &fakeEndpoint{}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	s := newSender(server.URL, "", "", "", 4, 100, time.Hour)
+	s.enqueue(testSeries(10), testMetadata())
+	s.close()
+
+	requests := endpoint.received()
+	if len(requests) != 3 {
+		t.Fatalf("expected 10 series in 3 batches of at most 4, got %d requests", len(requests))
+	}
+	for i, expected := range []int{4, 4, 2} {
+		if got := len(requests[i].Timeseries); got != expected {
+			t.Errorf("request %d: expected %d series, got %d", i, expected, got)
+		}
+	}
+}
+
+func TestSenderFlushInterval(t *testing.T) {
+	endpoint := &fakeEndpoint{}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	s := newSender(server.URL, "", "", "", 100, 100, 10*time.Millisecond)
+	defer s.close()
+	s.enqueue(testSeries(3), testMetadata())
+	deadline := time.Now().Add(5 * time.Second)
+	for len(endpoint.received()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the series were not sent after the flush interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSenderRetries(t *testing.T) {
+	for _, test := range []struct {
+		statuses []int
+		requests int
+		written  bool
+	}{
+		// Failures of the endpoint are retried.
+		{[]int{http.StatusInternalServerError, http.StatusTooManyRequests}, 3, true},
+		// Until the attempts run out.
+		{[]int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable}, 3, false},
+		// Rejected series are not.
+		{[]int{http.StatusBadRequest}, 1, false},
+	} {
+		endpoint := &fakeEndpoint{statuses: test.statuses}
+		server := httptest.NewServer(endpoint)
+		s := newSender(server.URL, "", "", "", 10, 10, time.Hour)
+		s.retryBackoff = time.Millisecond
+		s.enqueue(testSeries(2), testMetadata())
+		s.close()
+		server.Close()
+
+		if len(endpoint.headers) != test.requests {
+			t.Errorf("statuses %v: expected %d requests, got %d", test.statuses, test.requests, len(endpoint.headers))
+		}
+		if written := len(endpoint.received()) == 1; written != test.written {
+			t.Errorf("statuses %v: expected written %v, got %v", test.statuses, test.written, written)
+		}
+	}
+}
+
+func TestSenderQueueFull(t *testing.T) {
+	// The sender is not started, so that the queue fills up.
+	s := &sender{
+		queue:    make(chan *prompb.TimeSeries, 3),
+		metadata: make(map[string]*prompb.MetricMetadata),
+	}
+	s.enqueue(testSeries(5), testMetadata())
+	if len(s.queue) != 3 {
+		t.Errorf("expected 3 queued series, got %d", len(s.queue))
+	}
+	if s.dropped != 2 {
+		t.Errorf("expected 2 dropped series, got %d", s.dropped)
+	}
+}
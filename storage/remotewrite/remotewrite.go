@@ -0,0 +1,141 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remotewrite
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+)
+
+func init() {
+	storage.RegisterStorageDriver("prometheus_remote_write", new)
+}
+
+var (
+	argURL           = flag.String("storage_driver_remote_write_url", "", "URL of the Prometheus remote write endpoint, e.g. http://mimir:8080/api/v1/push")
+	argUsername      = flag.String("storage_driver_remote_write_username", "", "username of the basic authentication to the remote write endpoint")
+	argPassword      = flag.String("storage_driver_remote_write_password", "", "password of the basic authentication to the remote write endpoint")
+	argBearerToken   = flag.String("storage_driver_remote_write_bearer_token", "", "bearer token authenticating to the remote write endpoint, instead of a username and a password")
+	argJob           = flag.String("storage_driver_remote_write_job", "cadvisor", "value of the job label of the series, the instance label being the hostname")
+	argBatchSize     = flag.Int("storage_driver_remote_write_batch_size", 1000, "maximum number of series per write request")
+	argQueueDepth    = flag.Int("storage_driver_remote_write_queue_depth", 10000, "maximum number of series waiting to be sent, further series are dropped")
+	argFlushInterval = flag.Duration("storage_driver_remote_write_flush_interval", 5*time.Second, "maximum time the series wait for a batch to fill up before they are sent")
+)
+
+// Labels of every series, which a Prometheus server scraping cAdvisor would
+// add as target labels.
+const (
+	labelInstance = "instance"
+	labelJob      = "job"
+)
+
+type remoteWriteStorage struct {
+	converter *converter
+	sender    *sender
+	specs     storage.ContainerSpecCache
+}
+
+func new() (storage.StorageDriver, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	return newStorage(config{
+		machineName:   hostname,
+		job:           *argJob,
+		endpoint:      *argURL,
+		username:      *argUsername,
+		password:      *argPassword,
+		bearerToken:   *argBearerToken,
+		batchSize:     *argBatchSize,
+		queueDepth:    *argQueueDepth,
+		flushInterval: *argFlushInterval,
+	})
+}
+
+func (self *remoteWriteStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	if stats == nil {
+		return nil
+	}
+	spec := self.specs.Spec(ref.Name, time.Now())
+	series, metadata, err := self.converter.series(ref, spec, stats)
+	if err != nil {
+		return err
+	}
+	self.sender.enqueue(series, metadata)
+	return nil
+}
+
+func (self *remoteWriteStorage) Close() error {
+	// Sends the queued series.
+	self.sender.close()
+	return nil
+}
+
+// config is the configuration of the driver, populated from the flags.
+type config struct {
+	// A unique identifier to identify the host that current cAdvisor
+	// instance is running on, the instance label of the series.
+	machineName string
+	// The job label of the series.
+	job string
+	// The URL of the remote write endpoint.
+	endpoint string
+	// The username of the basic authentication, none if empty.
+	username string
+	// The password of the basic authentication.
+	password string
+	// The bearer token authenticating instead, none if empty.
+	bearerToken string
+	// The maximum number of series per write request.
+	batchSize int
+	// The maximum number of series waiting to be sent.
+	queueDepth int
+	// The maximum time the series wait for a batch to fill up.
+	flushInterval time.Duration
+}
+
+// Create a new Prometheus remote write storage driver.
+func newStorage(cfg config) (*remoteWriteStorage, error) {
+	if cfg.endpoint == "" {
+		return nil, fmt.Errorf("the URL of the remote write endpoint is required, set -storage_driver_remote_write_url")
+	}
+	if u, err := url.Parse(cfg.endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid remote write URL %q, must be http or https", cfg.endpoint)
+	}
+	if cfg.username != "" && cfg.bearerToken != "" {
+		return nil, fmt.Errorf("the remote write endpoint can not be authenticated to with both a username and a bearer token")
+	}
+	if cfg.batchSize <= 0 || cfg.queueDepth <= 0 || cfg.flushInterval <= 0 {
+		return nil, fmt.Errorf("the remote write batch size, queue depth and flush interval must be positive")
+	}
+	converter, err := newConverter(map[string]string{
+		labelInstance: cfg.machineName,
+		labelJob:      cfg.job,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &remoteWriteStorage{
+		converter: converter,
+		sender:    newSender(cfg.endpoint, cfg.username, cfg.password, cfg.bearerToken, cfg.batchSize, cfg.queueDepth, cfg.flushInterval),
+	}, nil
+}
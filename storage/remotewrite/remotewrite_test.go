@@ -0,0 +1,377 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remotewrite
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/info/v2"
+	"github.com/google/cadvisor/metrics"
+	"github.com/google/cadvisor/storage/remotewrite/prompb"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// fakeEndpoint decodes the write requests it receives, and answers them
+// with the statuses given, then with 200.
+type fakeEndpoint struct {
+	lock     sync.Mutex
+	statuses []int
+	requests []*prompb.WriteRequest
+	headers  []http.Header
+}
+
+func (self *fakeEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.headers = append(self.headers, r.Header)
+	if len(self.statuses) > 0 {
+		status := self.statuses[0]
+		self.statuses = self.statuses[1:]
+		if status != http.StatusOK {
+			http.Error(w, "failed", status)
+			return
+		}
+	}
+	compressed, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	b, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &prompb.WriteRequest{}
+	if err := proto.Unmarshal(b, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	self.requests = append(self.requests, req)
+}
+
+func (self *fakeEndpoint) received() []*prompb.WriteRequest {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.requests
+}
+
+type fakeContainerSpecSource struct {
+	specs map[string]v2.ContainerSpec
+}
+
+func (self *fakeContainerSpecSource) GetContainerSpec(containerName string, options v2.RequestOptions) (map[string]v2.ContainerSpec, error) {
+	spec, ok := self.specs[containerName]
+	if !ok {
+		return nil, fmt.Errorf("unknown container %q", containerName)
+	}
+	return map[string]v2.ContainerSpec{containerName: spec}, nil
+}
+
+// fixtureProvider gives a container to the Prometheus collector, the way
+// the container manager does for the /metrics endpoint.
+type fixtureProvider struct {
+	container *info.ContainerInfo
+}
+
+func (self fixtureProvider) SubcontainersInfo(string, *info.ContainerInfoRequest) ([]*info.ContainerInfo, error) {
+	return []*info.ContainerInfo{self.container}, nil
+}
+
+func (self fixtureProvider) GetVersionInfo() (*info.VersionInfo, error) {
+	return &info.VersionInfo{KernelVersion: "4.4.0"}, nil
+}
+
+func (self fixtureProvider) GetMachineInfo() (*info.MachineInfo, error) {
+	return &info.MachineInfo{NumCores: 4, MemoryCapacity: 1024}, nil
+}
+
+var (
+	fixtureTime = time.Unix(1451606400, 123456789)
+	fixtureRef  = info.ContainerReference{
+		Name:    "/docker/abc",
+		Aliases: []string{"web", "abc"},
+		Labels:  map[string]string{"app": "shop"},
+	}
+	fixtureSpec = info.ContainerSpec{
+		CreationTime: time.Unix(1451600000, 0),
+		Labels:       map[string]string{"app": "shop", "io.k8s.pod": "web-1"},
+		Envs:         map[string]string{"TIER": "front"},
+		HasCpu:       true,
+		Cpu:          info.CpuSpec{Limit: 1024, Period: 100000, Quota: 50000},
+		HasMemory:    true,
+		Memory:       info.MemorySpec{Limit: 1 << 30, SwapLimit: 1 << 63},
+		HasNetwork:   true,
+		Image:        "shop/web:1.0",
+	}
+	fixtureStats = &info.ContainerStats{
+		Timestamp: fixtureTime,
+		Cpu: info.CpuStats{
+			Usage: info.CpuUsage{
+				Total:  3000000000,
+				PerCpu: []uint64{1000000000, 2000000000},
+				User:   2000000000,
+				System: 1000000000,
+			},
+			CFS:         info.CpuCFS{Periods: 10, ThrottledPeriods: 2, ThrottledTime: 500000000},
+			LoadAverage: 2,
+		},
+		Memory: info.MemoryStats{
+			Usage:      4096,
+			Cache:      1024,
+			RSS:        2048,
+			Swap:       512,
+			WorkingSet: 3072,
+			Failcnt:    1,
+			ContainerData: info.MemoryStatsMemoryData{
+				Pgfault:    10,
+				Pgmajfault: 2,
+			},
+		},
+		Network: info.NetworkStats{
+			Interfaces: []info.InterfaceStats{{
+				Name:     "eth0",
+				RxBytes:  100,
+				RxErrors: 1,
+				TxBytes:  200,
+			}},
+			Tcp: info.TcpStat{Established: 3},
+		},
+		Filesystem: []info.FsStats{{
+			Device:         "/dev/sda1",
+			Limit:          1 << 20,
+			Usage:          1 << 10,
+			ReadsCompleted: 5,
+		}},
+		DiskIo: info.DiskIoStats{
+			IoServiceBytes: []info.PerDiskStats{{
+				Major: 8,
+				Stats: map[string]uint64{"Read": 100, "Write": 200},
+			}},
+		},
+		TaskStats: info.LoadStats{NrRunning: 2},
+	}
+)
+
+type sample struct {
+	value     float64
+	timestamp int64
+}
+
+// seriesKey identifies a series by its name and its sorted labels.
+func seriesKey(name string, labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for l, v := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", l, v))
+	}
+	sort.Strings(pairs)
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// scraped returns the series and the types of the metric families the
+// collector of the /metrics endpoint exports for the fixture container,
+// with the target labels a Prometheus server would add.
+func scraped(t *testing.T) (map[string]float64, map[string]dto.MetricType) {
+	registry := prometheus.NewRegistry()
+	container := &info.ContainerInfo{
+		ContainerReference: fixtureRef,
+		Spec:               fixtureSpec,
+		Stats:              []*info.ContainerStats{fixtureStats},
+	}
+	registry.MustRegister(metrics.NewPrometheusCollector(fixtureProvider{container}, nil))
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := make(map[string]float64)
+	types := make(map[string]dto.MetricType)
+	for _, family := range families {
+		if skippedFamilies[family.GetName()] {
+			continue
+		}
+		types[family.GetName()] = family.GetType()
+		for _, m := range family.Metric {
+			labels := map[string]string{labelInstance: "host", labelJob: "cadvisor"}
+			for _, pair := range m.Label {
+				labels[pair.GetName()] = pair.GetValue()
+			}
+			series[seriesKey(family.GetName(), labels)] = metricValue(m)
+		}
+	}
+	return series, types
+}
+
+// written returns the series and the types of the metric families of the
+// write requests.
+func written(t *testing.T, requests []*prompb.WriteRequest) (map[string]sample, map[string]prompb.MetricType) {
+	series := make(map[string]sample)
+	types := make(map[string]prompb.MetricType)
+	for _, req := range requests {
+		for _, ts := range req.Timeseries {
+			labels := make(map[string]string)
+			for i, l := range ts.Labels {
+				if i > 0 && ts.Labels[i-1].Name >= l.Name {
+					t.Errorf("labels of series %v are not sorted by name", ts.Labels)
+				}
+				labels[l.Name] = l.Value
+			}
+			name := labels["__name__"]
+			delete(labels, "__name__")
+			if len(ts.Samples) != 1 {
+				t.Fatalf("series %s has %d samples, expected 1", name, len(ts.Samples))
+			}
+			series[seriesKey(name, labels)] = sample{ts.Samples[0].Value, ts.Samples[0].Timestamp}
+		}
+		for _, m := range req.Metadata {
+			types[m.MetricFamilyName] = m.Type
+		}
+	}
+	return series, types
+}
+
+func fixtureSpecSource() *fakeContainerSpecSource {
+	return &fakeContainerSpecSource{map[string]v2.ContainerSpec{
+		fixtureRef.Name: v2.ContainerSpecFromV1(&fixtureSpec, fixtureRef.Aliases, fixtureRef.Namespace),
+	}}
+}
+
+func TestSeriesMatchCollector(t *testing.T) {
+	endpoint := &fakeEndpoint{}
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	driver, err := newStorage(config{
+		machineName:   "host",
+		job:           "cadvisor",
+		endpoint:      server.URL,
+		batchSize:     20,
+		queueDepth:    1000,
+		flushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.SetContainerSpecSource(fixtureSpecSource())
+	if err := driver.AddStats(fixtureRef, fixtureStats); err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := endpoint.received()
+	got, gotTypes := written(t, requests)
+	expected, expectedTypes := scraped(t)
+	if len(requests) < 2 {
+		t.Errorf("expected the %d series in batches of 20, got %d requests", len(expected), len(requests))
+	}
+	for key, value := range expected {
+		s, ok := got[key]
+		if !ok {
+			t.Errorf("series %s was not written", key)
+			continue
+		}
+		if s.value != value {
+			t.Errorf("series %s: expected %v, got %v", key, value, s.value)
+		}
+		if s.timestamp != fixtureTime.UnixNano()/1e6 {
+			t.Errorf("series %s: expected the timestamp %d, got %d", key, fixtureTime.UnixNano()/1e6, s.timestamp)
+		}
+	}
+	for key := range got {
+		if _, ok := expected[key]; !ok {
+			t.Errorf("unexpected series %s", key)
+		}
+	}
+	for name, expectedType := range expectedTypes {
+		gotType, ok := gotTypes[name]
+		if !ok {
+			t.Errorf("no metadata for %s", name)
+			continue
+		}
+		if gotType.String() != expectedType.String() {
+			t.Errorf("%s: expected the type %s, got %s", name, expectedType, gotType)
+		}
+	}
+	if len(got) < 40 {
+		t.Errorf("expected the fixture to cover most metrics, got %d series", len(got))
+	}
+}
+
+func TestSeriesWithoutSpec(t *testing.T) {
+	converter, err := newConverter(map[string]string{labelInstance: "host", labelJob: "cadvisor"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	series, _, err := converter.series(fixtureRef, nil, fixtureStats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := written(t, []*prompb.WriteRequest{{Timeseries: series}})
+	for key := range got {
+		if strings.HasPrefix(key, startTimeFamily) || strings.HasPrefix(key, "container_spec_") {
+			t.Errorf("unexpected series %s without the specification", key)
+		}
+	}
+	key := seriesKey("container_memory_usage_bytes", map[string]string{
+		labelInstance:                        "host",
+		labelJob:                             "cadvisor",
+		metrics.LabelID:                      "/docker/abc",
+		metrics.LabelName:                    "web",
+		metrics.ContainerLabelPrefix + "app": "shop",
+	})
+	if s, ok := got[key]; !ok || s.value != 4096 {
+		t.Errorf("expected %s 4096, got %v", key, got)
+	}
+}
+
+func TestNewStorageValidation(t *testing.T) {
+	for _, test := range []struct {
+		url, username, bearerToken string
+		batchSize                  int
+	}{
+		{"", "", "", 10},
+		{"mimir:8080/api/v1/push", "", "", 10},
+		{"http://mimir:8080/api/v1/push", "user", "token", 10},
+		{"http://mimir:8080/api/v1/push", "", "", 0},
+	} {
+		_, err := newStorage(config{
+			machineName:   "host",
+			job:           "cadvisor",
+			endpoint:      test.url,
+			username:      test.username,
+			bearerToken:   test.bearerToken,
+			batchSize:     test.batchSize,
+			queueDepth:    10,
+			flushInterval: time.Second,
+		})
+		if err == nil {
+			t.Errorf("expected an error for %+v", test)
+		}
+	}
+}
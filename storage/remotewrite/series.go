@@ -0,0 +1,181 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remotewrite
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/info/v2"
+	"github.com/google/cadvisor/metrics"
+	"github.com/google/cadvisor/storage/remotewrite/prompb"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+//go:generate protoc --proto_path=prompb --go_out=prompb prompb/remote.proto
+
+// Families of the Prometheus collector which are not about a container, and
+// are not written.
+var skippedFamilies = map[string]bool{
+	"cadvisor_version_info":  true,
+	"container_scrape_error": true,
+	"machine_cpu_cores":      true,
+	"machine_memory_bytes":   true,
+}
+
+// Family of the creation time of the containers, only written when their
+// specification is known.
+const startTimeFamily = "container_start_time_seconds"
+
+// containerProvider gives the Prometheus collector a single container.
+type containerProvider struct {
+	container *info.ContainerInfo
+}
+
+func (self *containerProvider) SubcontainersInfo(string, *info.ContainerInfoRequest) ([]*info.ContainerInfo, error) {
+	return []*info.ContainerInfo{self.container}, nil
+}
+
+func (self *containerProvider) GetVersionInfo() (*info.VersionInfo, error) {
+	return &info.VersionInfo{}, nil
+}
+
+func (self *containerProvider) GetMachineInfo() (*info.MachineInfo, error) {
+	return &info.MachineInfo{}, nil
+}
+
+// converter converts the stats of the containers to time series by
+// collecting them with the Prometheus collector of the /metrics endpoint,
+// so that the series have the same names, labels and types as when they
+// are scraped.
+type converter struct {
+	lock     sync.Mutex
+	provider *containerProvider
+	registry *prometheus.Registry
+	// Labels added to every series, sorted by name.
+	externalLabels []*prompb.Label
+}
+
+func newConverter(externalLabels map[string]string) (*converter, error) {
+	provider := &containerProvider{}
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(metrics.NewPrometheusCollector(provider, nil)); err != nil {
+		return nil, err
+	}
+	ret := &converter{
+		provider: provider,
+		registry: registry,
+	}
+	for name, value := range externalLabels {
+		ret.externalLabels = append(ret.externalLabels, &prompb.Label{Name: name, Value: value})
+	}
+	sort.Sort(byName(ret.externalLabels))
+	return ret, nil
+}
+
+// series returns the time series of the stats of a container, with a
+// single sample each, and the metadata of their metric families.
+func (self *converter) series(ref info.ContainerReference, spec *v2.ContainerSpec, stats *info.ContainerStats) ([]*prompb.TimeSeries, []*prompb.MetricMetadata, error) {
+	self.lock.Lock()
+	self.provider.container = &info.ContainerInfo{
+		ContainerReference: ref,
+		Spec:               specToV1(ref, spec),
+		Stats:              []*info.ContainerStats{stats},
+	}
+	families, err := self.registry.Gather()
+	self.provider.container = nil
+	self.lock.Unlock()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to collect the metrics of container %q - %s", ref.Name, err)
+	}
+
+	timestamp := stats.Timestamp.UnixNano() / 1e6
+	var series []*prompb.TimeSeries
+	var metadata []*prompb.MetricMetadata
+	for _, family := range families {
+		name := family.GetName()
+		if skippedFamilies[name] || (spec == nil && name == startTimeFamily) {
+			continue
+		}
+		metricType, err := familyType(family.GetType())
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to convert metric %q - %s", name, err)
+		}
+		metadata = append(metadata, &prompb.MetricMetadata{
+			Type:             metricType,
+			MetricFamilyName: name,
+			Help:             family.GetHelp(),
+		})
+		for _, m := range family.Metric {
+			series = append(series, &prompb.TimeSeries{
+				Labels:  self.labels(name, m.Label),
+				Samples: []*prompb.Sample{{Value: metricValue(m), Timestamp: timestamp}},
+			})
+		}
+	}
+	return series, metadata, nil
+}
+
+// labels returns the labels of a series, sorted by name as remote write
+// requires. The labels of the collector are kept over the external labels
+// of the same name.
+func (self *converter) labels(name string, pairs []*dto.LabelPair) []*prompb.Label {
+	labels := make([]*prompb.Label, 0, len(pairs)+len(self.externalLabels)+1)
+	labels = append(labels, &prompb.Label{Name: "__name__", Value: name})
+	seen := make(map[string]bool, len(pairs))
+	for _, pair := range pairs {
+		labels = append(labels, &prompb.Label{Name: pair.GetName(), Value: pair.GetValue()})
+		seen[pair.GetName()] = true
+	}
+	for _, l := range self.externalLabels {
+		if !seen[l.Name] {
+			labels = append(labels, l)
+		}
+	}
+	sort.Sort(byName(labels))
+	return labels
+}
+
+func familyType(t dto.MetricType) (prompb.MetricType, error) {
+	switch t {
+	case dto.MetricType_COUNTER:
+		return prompb.MetricType_COUNTER, nil
+	case dto.MetricType_GAUGE:
+		return prompb.MetricType_GAUGE, nil
+	case dto.MetricType_UNTYPED:
+		return prompb.MetricType_UNKNOWN, nil
+	}
+	return prompb.MetricType_UNKNOWN, fmt.Errorf("unsupported metric type %s", t)
+}
+
+func metricValue(m *dto.Metric) float64 {
+	switch {
+	case m.Counter != nil:
+		return m.Counter.GetValue()
+	case m.Gauge != nil:
+		return m.Gauge.GetValue()
+	}
+	return m.Untyped.GetValue()
+}
+
+type byName []*prompb.Label
+
+func (s byName) Len() int           { return len(s) }
+func (s byName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s byName) Less(i, j int) bool { return s[i].Name < s[j].Name }
@@ -0,0 +1,88 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/cadvisor/info/v2"
+
+	"github.com/golang/glog"
+)
+
+// The specification of a container is looked up again after specRefresh,
+// and forgotten once the container is not seen for specExpiry.
+const (
+	specRefresh = time.Minute
+	specExpiry  = 10 * time.Minute
+)
+
+type cachedSpec struct {
+	spec     *v2.ContainerSpec
+	fetched  time.Time
+	lastSeen time.Time
+}
+
+// ContainerSpecCache remembers the specifications looked up from a
+// ContainerSpecSource, for the ContainerSpecConsumer drivers which need the
+// specification of a container with each of its stats. The zero value is
+// ready to use, and knows no specification until its source is set.
+type ContainerSpecCache struct {
+	lock   sync.Mutex
+	source ContainerSpecSource
+	specs  map[string]cachedSpec
+}
+
+// SetSource sets the source the specifications are looked up from.
+func (self *ContainerSpecCache) SetSource(source ContainerSpecSource) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.source = source
+}
+
+// Spec returns the specification of a container, or nil if it is not known.
+func (self *ContainerSpecCache) Spec(containerName string, now time.Time) *v2.ContainerSpec {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	cached, ok := self.specs[containerName]
+	if ok && now.Sub(cached.fetched) < specRefresh {
+		cached.lastSeen = now
+		self.specs[containerName] = cached
+		return cached.spec
+	}
+	if self.source == nil {
+		return nil
+	}
+	specs, err := self.source.GetContainerSpec(containerName, v2.RequestOptions{IdType: v2.TypeName, Count: 1})
+	if err != nil {
+		glog.V(4).Infof("failed to get the specification of container %q: %v", containerName, err)
+		return cached.spec
+	}
+	if self.specs == nil {
+		self.specs = make(map[string]cachedSpec)
+	}
+	for name, c := range self.specs {
+		if now.Sub(c.lastSeen) > specExpiry {
+			delete(self.specs, name)
+		}
+	}
+	var spec *v2.ContainerSpec
+	if s, ok := specs[containerName]; ok {
+		spec = &s
+	}
+	self.specs[containerName] = cachedSpec{spec, now, now}
+	return spec
+}
@@ -0,0 +1,74 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/info/v2"
+)
+
+// fakeContainerSpecSource returns the images of the containers and counts
+// the lookups.
+type fakeContainerSpecSource struct {
+	images  map[string]string
+	lookups int
+}
+
+func (self *fakeContainerSpecSource) GetContainerSpec(containerName string, options v2.RequestOptions) (map[string]v2.ContainerSpec, error) {
+	self.lookups++
+	image, ok := self.images[containerName]
+	if !ok {
+		return nil, fmt.Errorf("unknown container %q", containerName)
+	}
+	return map[string]v2.ContainerSpec{containerName: {Image: image}}, nil
+}
+
+func TestContainerSpecCache(t *testing.T) {
+	var cache ContainerSpecCache
+	now := time.Now()
+	if spec := cache.Spec("/a", now); spec != nil {
+		t.Errorf("expected no spec without a source, got %+v", spec)
+	}
+	source := &fakeContainerSpecSource{images: map[string]string{"/a": "a"}}
+	cache.SetSource(source)
+	if spec := cache.Spec("/a", now); spec == nil || spec.Image != "a" {
+		t.Errorf("expected the spec of /a, got %+v", spec)
+	}
+	if spec := cache.Spec("/unknown", now); spec != nil {
+		t.Errorf("expected no spec for an unknown container, got %+v", spec)
+	}
+}
+
+func TestContainerSpecCacheExpiry(t *testing.T) {
+	source := &fakeContainerSpecSource{images: map[string]string{"/a": "a", "/b": "b"}}
+	cache := &ContainerSpecCache{source: source}
+	now := time.Now()
+	cache.Spec("/a", now)
+	cache.Spec("/a", now.Add(specRefresh/2))
+	if source.lookups != 1 {
+		t.Errorf("expected 1 lookup before the refresh, got %d", source.lookups)
+	}
+	cache.Spec("/a", now.Add(specRefresh))
+	if source.lookups != 2 {
+		t.Errorf("expected 2 lookups after the refresh, got %d", source.lookups)
+	}
+	cache.Spec("/b", now.Add(specRefresh+specExpiry+time.Second))
+	if _, ok := cache.specs["/a"]; ok {
+		t.Errorf("expected the spec of a container not seen for %s to be forgotten", specExpiry)
+	}
+}
@@ -0,0 +1,499 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package splunk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+
+	"github.com/golang/glog"
+)
+
+func init() {
+	storage.RegisterStorageDriver("splunk", new)
+}
+
+var (
+	argURL                = flag.String("storage_driver_splunk_url", "https://localhost:8088", "URL of the Splunk HTTP Event Collector")
+	argToken              = flag.String("storage_driver_splunk_token", "", "token of the HTTP Event Collector")
+	argIndex              = flag.String("storage_driver_splunk_index", "", "index of the events, the default index of the token if empty")
+	argSourcetype         = flag.String("storage_driver_splunk_sourcetype", "cadvisor", "sourcetype of the events")
+	argSource             = flag.String("storage_driver_splunk_source", "cadvisor", "source of the events")
+	argGzip               = flag.Bool("storage_driver_splunk_gzip", false, "gzip-compress the requests")
+	argMaxRequestSize     = flag.Int("storage_driver_splunk_max_request_size", 1000000, "maximum size in bytes of the uncompressed body of a request, the batches being split to fit; the max_content_length of the HTTP Event Collector")
+	argFlushInterval      = flag.Duration("storage_driver_splunk_flush_interval", 10*time.Second, "interval of the sends of the buffered events")
+	argBatchSize          = flag.Int("storage_driver_splunk_batch_size", 1000, "maximum number of events sent in a request, sent as soon as they are buffered")
+	argMaxPending         = flag.Int("storage_driver_splunk_max_pending", 100000, "maximum number of events buffered while the sends fail, the oldest being dropped beyond it")
+	argMaxRetries         = flag.Int("storage_driver_splunk_max_retries", 3, "number of times a failed request is retried before its events are dropped")
+	argTimeout            = flag.Duration("storage_driver_splunk_timeout", 30*time.Second, "timeout of the requests")
+	argInsecureSkipVerify = flag.Bool("storage_driver_splunk_insecure_skip_verify", false, "do not verify the certificate of the HTTP Event Collector, e.g. the self-signed one it has by default")
+)
+
+const (
+	// Path of the JSON event endpoint of the HTTP Event Collector.
+	eventPath = "/services/collector/event"
+	// Backoff before retrying a failed request, doubled after every retry
+	// up to maxBackoff.
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 10 * time.Second
+	// Minimum time between the logs of the send errors.
+	errorLogInterval = time.Minute
+)
+
+// Code of the response of the HTTP Event Collector to a request without
+// events, sent on startup to check the token.
+const codeNoData = 5
+
+// detailSpec is the body of an event, the same JSON as the documents of the
+// ElasticSearch driver.
+type detailSpec struct {
+	// Microseconds since the epoch.
+	Timestamp      int64                `json:"timestamp"`
+	MachineName    string               `json:"machine_name,omitempty"`
+	ContainerName  string               `json:"container_Name,omitempty"`
+	ContainerStats *info.ContainerStats `json:"container_stats,omitempty"`
+}
+
+// event is an event of the HTTP Event Collector, with its metadata.
+type event struct {
+	// Seconds since the epoch.
+	Time       float64     `json:"time"`
+	Host       string      `json:"host,omitempty"`
+	Index      string      `json:"index,omitempty"`
+	Sourcetype string      `json:"sourcetype,omitempty"`
+	Source     string      `json:"source,omitempty"`
+	Event      *detailSpec `json:"event"`
+}
+
+// hecError is an error response of the HTTP Event Collector.
+type hecError struct {
+	status string
+	// HTTP status code.
+	statusCode int
+	Text       string `json:"text"`
+	Code       int    `json:"code"`
+	// Index in the request of the first event rejected, the ones before it
+	// were accepted.
+	InvalidEvent *int `json:"invalid-event-number"`
+}
+
+func (self *hecError) Error() string {
+	msg := fmt.Sprintf("Splunk HEC returned %s: %s (code %d)", self.status, self.Text, self.Code)
+	if self.authFailed() {
+		msg += ", check -storage_driver_splunk_token"
+	}
+	return msg
+}
+
+// authFailed returns whether the token is missing, invalid or disabled.
+func (self *hecError) authFailed() bool {
+	return self.statusCode == http.StatusUnauthorized || self.statusCode == http.StatusForbidden
+}
+
+// temporary returns whether the request may succeed if sent again.
+func (self *hecError) temporary() bool {
+	return self.statusCode >= 500 || self.statusCode == http.StatusTooManyRequests
+}
+
+type splunkStorage struct {
+	machineName string
+	client      *http.Client
+	// URL of the event endpoint.
+	url        string
+	token      string
+	index      string
+	sourcetype string
+	source     string
+	gzip       bool
+
+	maxRequestSize int
+	batchSize      int
+	maxRetries     int
+
+	lock sync.Mutex
+	// JSON of the events to send.
+	events     [][]byte
+	maxPending int
+
+	// Counts of the events sent, failed to be sent after the retries,
+	// rejected by the HTTP Event Collector, and dropped because too many
+	// were buffered.
+	sent     uint64
+	failed   uint64
+	rejected uint64
+	dropped  uint64
+	// Counts when the errors were last logged, and the last error.
+	logLock        sync.Mutex
+	lastLog        time.Time
+	lastErr        error
+	loggedFailed   uint64
+	loggedRejected uint64
+	loggedDrop     uint64
+
+	flush chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func new() (storage.StorageDriver, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	return newStorage(config{
+		machineName:        hostname,
+		endpoint:           *argURL,
+		token:              *argToken,
+		index:              *argIndex,
+		sourcetype:         *argSourcetype,
+		source:             *argSource,
+		compress:           *argGzip,
+		maxRequestSize:     *argMaxRequestSize,
+		flushInterval:      *argFlushInterval,
+		batchSize:          *argBatchSize,
+		maxPending:         *argMaxPending,
+		maxRetries:         *argMaxRetries,
+		timeout:            *argTimeout,
+		insecureSkipVerify: *argInsecureSkipVerify,
+	})
+}
+
+// displayName returns the name of the container in the events, the same
+// as in the documents of the ElasticSearch driver.
+func displayName(ref info.ContainerReference) string {
+	if len(ref.Aliases) > 0 {
+		return ref.Aliases[0]
+	}
+	return ref.Name
+}
+
+// event returns the JSON of the event of the stats of a container.
+func (self *splunkStorage) event(ref info.ContainerReference, stats *info.ContainerStats) ([]byte, error) {
+	return json.Marshal(&event{
+		Time:       float64(stats.Timestamp.UnixNano()/1E3) / 1E6,
+		Host:       self.machineName,
+		Index:      self.index,
+		Sourcetype: self.sourcetype,
+		Source:     self.source,
+		Event: &detailSpec{
+			Timestamp:      stats.Timestamp.UnixNano() / 1E3,
+			MachineName:    self.machineName,
+			ContainerName:  displayName(ref),
+			ContainerStats: stats,
+		},
+	})
+}
+
+func (self *splunkStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	if stats == nil {
+		return nil
+	}
+	e, err := self.event(ref, stats)
+	if err != nil {
+		return err
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.events = append(self.events, e)
+	if extra := len(self.events) - self.maxPending; extra > 0 {
+		self.events = append(self.events[:0:0], self.events[extra:]...)
+		atomic.AddUint64(&self.dropped, uint64(extra))
+		self.logErrors(false)
+	}
+	if len(self.events) >= self.batchSize {
+		select {
+		case self.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// run sends the buffered events every flush interval, or as soon as a batch
+// is buffered, until stopped.
+func (self *splunkStorage) run(flushInterval time.Duration) {
+	defer close(self.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-self.flush:
+		case <-self.stop:
+			self.sendEvents()
+			return
+		}
+		self.sendEvents()
+	}
+}
+
+// batchLength returns the number of the first events sent in a request, at
+// most the batch size and fitting the maximum request size. It is 0 if the
+// first event alone is too large.
+func (self *splunkStorage) batchLength(events [][]byte) int {
+	size := 0
+	for i, e := range events {
+		if i == self.batchSize || size+len(e) > self.maxRequestSize {
+			return i
+		}
+		size += len(e)
+	}
+	return len(events)
+}
+
+// sendEvents sends the buffered events in batches, retrying every batch
+// with backoff up to the maximum retries before dropping it. The events
+// rejected by the HTTP Event Collector are dropped without retrying, the
+// ones after them being sent again.
+func (self *splunkStorage) sendEvents() {
+	self.lock.Lock()
+	events := self.events
+	self.events = nil
+	self.lock.Unlock()
+	for len(events) > 0 {
+		n := self.batchLength(events)
+		if n == 0 {
+			atomic.AddUint64(&self.rejected, 1)
+			self.setLastErr(fmt.Errorf("an event of %d bytes is larger than the maximum request size of %d bytes", len(events[0]), self.maxRequestSize))
+			events = events[1:]
+			continue
+		}
+		err := self.sendWithRetries(bytes.Join(events[:n], nil))
+		if err == nil {
+			atomic.AddUint64(&self.sent, uint64(n))
+			events = events[n:]
+			continue
+		}
+		if herr, ok := err.(*hecError); ok && herr.statusCode == http.StatusBadRequest && herr.InvalidEvent != nil && *herr.InvalidEvent >= 0 && *herr.InvalidEvent < n {
+			// The events before the invalid one were accepted.
+			i := *herr.InvalidEvent
+			atomic.AddUint64(&self.sent, uint64(i))
+			atomic.AddUint64(&self.rejected, 1)
+			self.setLastErr(fmt.Errorf("event rejected - %v", err))
+			events = events[i+1:]
+			continue
+		}
+		if herr, ok := err.(*hecError); ok && !herr.temporary() && !herr.authFailed() {
+			atomic.AddUint64(&self.rejected, uint64(n))
+		} else {
+			atomic.AddUint64(&self.failed, uint64(n))
+		}
+		self.setLastErr(err)
+		events = events[n:]
+	}
+}
+
+// sendWithRetries sends a request, retrying it with backoff after network
+// errors and temporary errors of the HTTP Event Collector.
+func (self *splunkStorage) sendWithRetries(body []byte) error {
+	backoff := minBackoff
+	for retry := 0; ; retry++ {
+		err := self.post(body)
+		if herr, ok := err.(*hecError); err == nil || (ok && !herr.temporary()) || retry >= self.maxRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// post sends events to the HTTP Event Collector, compressed if enabled.
+func (self *splunkStorage) post(body []byte) error {
+	encoding := ""
+	if self.gzip && len(body) > 0 {
+		var b bytes.Buffer
+		w := gzip.NewWriter(&b)
+		if _, err := w.Write(body); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		body = b.Bytes()
+		encoding = "gzip"
+	}
+	req, err := http.NewRequest("POST", self.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Splunk "+self.token)
+	req.Header.Set("Content-Type", "application/json")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	resp, err := self.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	herr := &hecError{status: resp.Status, statusCode: resp.StatusCode}
+	if json.Unmarshal(b, herr) != nil || herr.Text == "" {
+		herr.Text = string(bytes.TrimSpace(b))
+	}
+	return herr
+}
+
+// checkToken sends a request without events, which the HTTP Event
+// Collector answers with "No data" if the token is valid. An invalid token
+// is an error, the other failures are only logged so that cAdvisor starts
+// while Splunk can not be reached.
+func (self *splunkStorage) checkToken() error {
+	err := self.post(nil)
+	herr, ok := err.(*hecError)
+	switch {
+	case err == nil, ok && herr.Code == codeNoData:
+		return nil
+	case ok && herr.authFailed():
+		return fmt.Errorf("the Splunk HEC token was rejected - %v", err)
+	}
+	glog.Warningf("Failed to check the Splunk HEC token - %v", err)
+	return nil
+}
+
+func (self *splunkStorage) setLastErr(err error) {
+	self.logLock.Lock()
+	self.lastErr = err
+	self.logLock.Unlock()
+	self.logErrors(false)
+}
+
+// logErrors logs the counts of the events failed, rejected and dropped
+// since the last log, at most every errorLogInterval unless forced.
+func (self *splunkStorage) logErrors(force bool) {
+	self.logLock.Lock()
+	defer self.logLock.Unlock()
+	if !force && time.Since(self.lastLog) < errorLogInterval {
+		return
+	}
+	failed, rejected, dropped := atomic.LoadUint64(&self.failed), atomic.LoadUint64(&self.rejected), atomic.LoadUint64(&self.dropped)
+	if failed == self.loggedFailed && rejected == self.loggedRejected && dropped == self.loggedDrop {
+		return
+	}
+	glog.Errorf("Splunk: %d events failed to be sent after %d retries, %d were rejected and %d were dropped because %d were buffered, last error: %v",
+		failed-self.loggedFailed, self.maxRetries, rejected-self.loggedRejected, dropped-self.loggedDrop, self.maxPending, self.lastErr)
+	self.lastLog = time.Now()
+	self.loggedFailed, self.loggedRejected, self.loggedDrop = failed, rejected, dropped
+}
+
+// Close sends the buffered events.
+func (self *splunkStorage) Close() error {
+	close(self.stop)
+	<-self.done
+	self.logErrors(true)
+	return nil
+}
+
+// config is the configuration of the driver, populated from the flags.
+type config struct {
+	// A unique identifier to identify the host that current cAdvisor
+	// instance is running on.
+	machineName string
+	// The URL and the token of the HTTP Event Collector.
+	endpoint string
+	token    string
+	// The index of the events, the default one of the token if empty.
+	index      string
+	sourcetype string
+	source     string
+	// Whether the requests are gzip-compressed.
+	compress bool
+	// The maximum size of the uncompressed body of a request.
+	maxRequestSize int
+	// The interval of the sends of the buffered events.
+	flushInterval time.Duration
+	// The maximum number of events sent in a request.
+	batchSize int
+	// The maximum number of events buffered while the sends fail.
+	maxPending int
+	// The number of times a failed request is retried.
+	maxRetries int
+	// The timeout of the requests.
+	timeout time.Duration
+	// Whether the certificate of the collector is not verified.
+	insecureSkipVerify bool
+}
+
+// Create a new Splunk storage driver.
+func newStorage(cfg config) (*splunkStorage, error) {
+	if u, err := url.Parse(cfg.endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid Splunk HEC URL %q, must be http or https", cfg.endpoint)
+	}
+	if cfg.token == "" {
+		return nil, fmt.Errorf("the Splunk HEC token is required, set -storage_driver_splunk_token")
+	}
+	if cfg.flushInterval <= 0 || cfg.batchSize <= 0 || cfg.maxPending <= 0 || cfg.maxRequestSize <= 0 {
+		return nil, fmt.Errorf("the Splunk flush interval, batch size, maximum pending events and maximum request size must be positive")
+	}
+	if cfg.maxRetries < 0 {
+		return nil, fmt.Errorf("the Splunk maximum retries can not be negative")
+	}
+	client := &http.Client{Timeout: cfg.timeout}
+	if cfg.insecureSkipVerify {
+		client.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	endpoint := strings.TrimSuffix(cfg.endpoint, "/")
+	if !strings.HasSuffix(endpoint, eventPath) {
+		endpoint += eventPath
+	}
+	ret := &splunkStorage{
+		machineName:    cfg.machineName,
+		client:         client,
+		url:            endpoint,
+		token:          cfg.token,
+		index:          cfg.index,
+		sourcetype:     cfg.sourcetype,
+		source:         cfg.source,
+		gzip:           cfg.compress,
+		maxRequestSize: cfg.maxRequestSize,
+		batchSize:      cfg.batchSize,
+		maxRetries:     cfg.maxRetries,
+		maxPending:     cfg.maxPending,
+		flush:          make(chan struct{}, 1),
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	if err := ret.checkToken(); err != nil {
+		return nil, err
+	}
+	go ret.run(cfg.flushInterval)
+	return ret, nil
+}
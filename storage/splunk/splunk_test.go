@@ -0,0 +1,309 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package splunk
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+var (
+	testRef = info.ContainerReference{
+		Name:    "/docker/abc",
+		Id:      "abc",
+		Aliases: []string{"web.1", "abc"},
+	}
+	testStats = &info.ContainerStats{
+		Timestamp: time.Date(2016, 1, 1, 0, 0, 0, 123456789, time.UTC),
+		Cpu:       info.CpuStats{Usage: info.CpuUsage{Total: 100, User: 60, System: 40}},
+		Memory:    info.MemoryStats{Usage: 4096, WorkingSet: 2048},
+	}
+)
+
+// response is a response of the fake collector.
+type response struct {
+	status int
+	body   string
+}
+
+// fakeCollector is an HTTP Event Collector accepting the token "token",
+// which answers the requests with the responses given, then accepts them.
+type fakeCollector struct {
+	lock      sync.Mutex
+	responses []response
+	// Events of the requests, uncompressed.
+	requests [][]event
+	headers  []http.Header
+}
+
+func (self *fakeCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if r.URL.Path != eventPath || r.Header.Get("Authorization") != "Splunk token" {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, `{"text":"Invalid token","code":4}`)
+		return
+	}
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		reader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = reader
+	}
+	data, _ := ioutil.ReadAll(body)
+	if len(data) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"text":"No data","code":5}`)
+		return
+	}
+	if len(self.responses) > 0 {
+		resp := self.responses[0]
+		self.responses = self.responses[1:]
+		if resp.status != http.StatusOK {
+			w.WriteHeader(resp.status)
+			io.WriteString(w, resp.body)
+			return
+		}
+	}
+	var events []event
+	for decoder := json.NewDecoder(bytes.NewReader(data)); decoder.More(); {
+		var e event
+		if err := decoder.Decode(&e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		events = append(events, e)
+	}
+	self.requests = append(self.requests, events)
+	self.headers = append(self.headers, r.Header)
+	io.WriteString(w, `{"text":"Success","code":0}`)
+}
+
+// containers returns the container names of the events received, by
+// request.
+func (self *fakeCollector) containers() [][]string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var ret [][]string
+	for _, events := range self.requests {
+		var names []string
+		for _, e := range events {
+			names = append(names, e.Event.ContainerName)
+		}
+		ret = append(ret, names)
+	}
+	return ret
+}
+
+// testConfig returns the configuration of a driver sending to url with
+// token.
+func testConfig(url, token string) config {
+	return config{
+		machineName:    "host-1",
+		endpoint:       url,
+		token:          token,
+		sourcetype:     "cadvisor",
+		source:         "cadvisor",
+		maxRequestSize: 1000000,
+		flushInterval:  time.Hour,
+		batchSize:      100,
+		maxPending:     100,
+		maxRetries:     1,
+		timeout:        time.Second,
+	}
+}
+
+func newTestStorage(t *testing.T, url, token string, compress bool, maxRequestSize, batchSize int) *splunkStorage {
+	cfg := testConfig(url, token)
+	cfg.index = "metrics"
+	cfg.sourcetype = "cadvisor:stats"
+	cfg.compress = compress
+	cfg.maxRequestSize = maxRequestSize
+	cfg.batchSize = batchSize
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return driver
+}
+
+func refNamed(name string) info.ContainerReference {
+	return info.ContainerReference{Name: name}
+}
+
+func TestEvent(t *testing.T) {
+	driver := &splunkStorage{machineName: "host-1", index: "metrics", sourcetype: "cadvisor:stats", source: "cadvisor"}
+	b, err := driver.event(testRef, testStats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e map[string]interface{}
+	if err := json.Unmarshal(b, &e); err != nil {
+		t.Fatal(err)
+	}
+	if e["time"] != 1451606400.123456 || e["host"] != "host-1" || e["index"] != "metrics" || e["sourcetype"] != "cadvisor:stats" || e["source"] != "cadvisor" {
+		t.Errorf("unexpected metadata in %s", b)
+	}
+	detail := e["event"].(map[string]interface{})
+	if detail["timestamp"] != float64(1451606400123456) || detail["machine_name"] != "host-1" || detail["container_Name"] != "web.1" {
+		t.Errorf("unexpected event in %s", b)
+	}
+	memory := detail["container_stats"].(map[string]interface{})["memory"].(map[string]interface{})
+	if memory["usage"] != float64(4096) {
+		t.Errorf("unexpected stats in %s", b)
+	}
+}
+
+func TestSend(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		collector := &fakeCollector{}
+		server := httptest.NewServer(collector)
+		driver := newTestStorage(t, server.URL+"/", "token", compress, 1000000, 2)
+		for _, name := range []string{"/a", "/b", "/c"} {
+			driver.AddStats(refNamed(name), testStats)
+		}
+		if err := driver.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if containers := collector.containers(); len(containers) != 2 || strings.Join(containers[0], ",") != "/a,/b" || strings.Join(containers[1], ",") != "/c" {
+			t.Errorf("expected batches of 2 events, got %v", containers)
+		}
+		if encoding := collector.headers[0].Get("Content-Encoding"); (encoding == "gzip") != compress {
+			t.Errorf("unexpected Content-Encoding %q with compression %t", encoding, compress)
+		}
+		if driver.sent != 3 {
+			t.Errorf("expected 3 events sent, got %d", driver.sent)
+		}
+		server.Close()
+	}
+}
+
+func TestMaxRequestSize(t *testing.T) {
+	collector := &fakeCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+	driver := newTestStorage(t, server.URL, "token", false, 1000000, 100)
+	event, _ := driver.event(refNamed("/a"), testStats)
+	driver.maxRequestSize = 2*len(event) + 1
+	for _, name := range []string{"/a", "/b", "/c", "/d", "/e"} {
+		driver.AddStats(refNamed(name), testStats)
+	}
+	// An event too large to be sent alone.
+	driver.AddStats(refNamed(strings.Repeat("x", 2*len(event))), testStats)
+	driver.Close()
+	if containers := collector.containers(); len(containers) != 3 || strings.Join(containers[0], ",") != "/a,/b" || strings.Join(containers[2], ",") != "/e" {
+		t.Errorf("expected the batch split in requests of 2 events, got %v", containers)
+	}
+	if driver.sent != 5 || driver.rejected != 1 {
+		t.Errorf("expected 5 events sent and 1 too large, got %d and %d", driver.sent, driver.rejected)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	collector := &fakeCollector{responses: []response{
+		{http.StatusServiceUnavailable, `{"text":"Server is busy","code":9}`},
+		{http.StatusServiceUnavailable, `{"text":"Server is busy","code":9}`},
+		{http.StatusTooManyRequests, `{"text":"Server is busy","code":9}`},
+	}}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+	driver := newTestStorage(t, server.URL, "token", false, 1000000, 1)
+	driver.AddStats(refNamed("/a"), testStats)
+	driver.AddStats(refNamed("/b"), testStats)
+	driver.Close()
+	// The first event fails after its retry, the second one is retried.
+	if containers := collector.containers(); len(containers) != 1 || containers[0][0] != "/b" {
+		t.Errorf("unexpected requests %v", containers)
+	}
+	if driver.sent != 1 || driver.failed != 1 {
+		t.Errorf("expected 1 event sent and 1 failed, got %d and %d", driver.sent, driver.failed)
+	}
+}
+
+func TestInvalidEvent(t *testing.T) {
+	collector := &fakeCollector{responses: []response{
+		{http.StatusBadRequest, `{"text":"Invalid data format","code":6,"invalid-event-number":1}`},
+	}}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+	driver := newTestStorage(t, server.URL, "token", false, 1000000, 100)
+	for _, name := range []string{"/a", "/b", "/c"} {
+		driver.AddStats(refNamed(name), testStats)
+	}
+	driver.Close()
+	// The first event was accepted, the invalid one is dropped, and the
+	// last one sent again.
+	if containers := collector.containers(); len(containers) != 1 || strings.Join(containers[0], ",") != "/c" {
+		t.Errorf("unexpected requests %v", containers)
+	}
+	if driver.sent != 2 || driver.rejected != 1 || driver.failed != 0 {
+		t.Errorf("expected 2 events sent and 1 rejected, got %d sent, %d rejected and %d failed", driver.sent, driver.rejected, driver.failed)
+	}
+	if driver.lastErr == nil || !strings.Contains(driver.lastErr.Error(), "Invalid data format (code 6)") {
+		t.Errorf("unexpected last error %v", driver.lastErr)
+	}
+}
+
+func TestBadToken(t *testing.T) {
+	server := httptest.NewServer(&fakeCollector{})
+	defer server.Close()
+	_, err := newStorage(testConfig(server.URL, "bad"))
+	if err == nil || !strings.Contains(err.Error(), "token was rejected") || !strings.Contains(err.Error(), "Invalid token (code 4)") {
+		t.Errorf("expected the token to be rejected, got %v", err)
+	}
+
+	// The collector can not be reached, the driver starts anyway.
+	server.Close()
+	cfg := testConfig(server.URL, "token")
+	cfg.maxRetries = 0
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.Close()
+}
+
+func TestNewStorageValidation(t *testing.T) {
+	for _, c := range []struct {
+		url, token               string
+		maxRequestSize, maxRetry int
+	}{
+		{"localhost:8088", "token", 1000, 0},
+		{"https://localhost:8088", "", 1000, 0},
+		{"https://localhost:8088", "token", 0, 0},
+		{"https://localhost:8088", "token", 1000, -1},
+	} {
+		cfg := testConfig(c.url, c.token)
+		cfg.maxRequestSize = c.maxRequestSize
+		cfg.maxRetries = c.maxRetry
+		if _, err := newStorage(cfg); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+}
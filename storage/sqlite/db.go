@@ -0,0 +1,194 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build cgo
+
+package sqlite
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+
+	"github.com/golang/glog"
+)
+
+// The statements creating the schema.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS stats (
+		time INTEGER NOT NULL,
+		machine TEXT NOT NULL,
+		container TEXT NOT NULL,
+		stats TEXT NOT NULL
+	)`,
+	"CREATE INDEX IF NOT EXISTS stats_container_time ON stats (container, time)",
+	"CREATE INDEX IF NOT EXISTS stats_time ON stats (time)",
+}
+
+// Time a connection waits for the lock of the database held by another
+// one, e.g. while a transaction is committed.
+const busyTimeout = 5 * time.Second
+
+// setBusyTimeout makes a connection wait for the lock of the database
+// held by another one, rather than fail.
+func setBusyTimeout(c *conn) error {
+	return c.exec(fmt.Sprintf("PRAGMA busy_timeout = %d", busyTimeout/time.Millisecond))
+}
+
+// openWriter opens the database at path for writing, creating it if
+// needed. A database which is corrupted, or a file which is not a
+// database, is moved aside and replaced with a new database.
+func openWriter(path string) (*conn, error) {
+	c, err := openConn(path, openReadWrite|openCreate)
+	if err == nil {
+		if err = initialize(c); err != nil {
+			c.close()
+		}
+	}
+	if err == nil || !isCorrupt(err) {
+		return c, err
+	}
+	corruptPath := fmt.Sprintf("%s.corrupt-%d", path, time.Now().Unix())
+	glog.Errorf("SQLite database %q is corrupted, moving it to %q and creating a new one: %v", path, corruptPath, err)
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Rename(path+suffix, corruptPath+suffix); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to move corrupted database %q aside - %v", path+suffix, err)
+		}
+	}
+	if c, err = openConn(path, openReadWrite|openCreate); err != nil {
+		return nil, err
+	}
+	if err = initialize(c); err != nil {
+		c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// initialize checks the integrity of a database, enables WAL, and creates
+// the schema.
+func initialize(c *conn) error {
+	if err := setBusyTimeout(c); err != nil {
+		return err
+	}
+	var problems []string
+	if err := c.query("PRAGMA quick_check", nil, func(s *stmt) error {
+		if problem := s.text(0); problem != "ok" {
+			problems = append(problems, problem)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return &sqliteError{resultCorrupt, fmt.Sprintf("integrity check failed: %v", problems)}
+	}
+	// auto_vacuum must be set before the database is written to, so that
+	// the pages freed by pruning can be given back to the file system. In
+	// WAL mode, the writes do not block the reads, and a transaction is
+	// only synced to disk at checkpoints, which synchronous = NORMAL keeps
+	// durable across crashes of cAdvisor.
+	for _, pragma := range []string{"PRAGMA auto_vacuum = INCREMENTAL", "PRAGMA journal_mode = WAL", "PRAGMA synchronous = NORMAL"} {
+		if err := c.exec(pragma); err != nil {
+			return err
+		}
+	}
+	for _, statement := range schema {
+		if err := c.exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sample is the stats of a container at a time, as stored by the driver.
+type Sample struct {
+	Time      time.Time
+	Machine   string
+	Container string
+	Stats     *info.ContainerStats
+}
+
+// Database reads the stats stored by the sqlite storage driver, e.g. to
+// drain them to another storage once the machine is online.
+type Database struct {
+	conn *conn
+}
+
+// Open opens a database written by the sqlite storage driver, read only.
+func Open(path string) (*Database, error) {
+	c, err := openConn(path, openReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	if err := setBusyTimeout(c); err != nil {
+		c.close()
+		return nil, err
+	}
+	return &Database{c}, nil
+}
+
+// Containers returns the names of the containers which have stats stored,
+// sorted.
+func (self *Database) Containers() ([]string, error) {
+	var ret []string
+	err := self.conn.query("SELECT DISTINCT container FROM stats ORDER BY container", nil, func(s *stmt) error {
+		ret = append(ret, s.text(0))
+		return nil
+	})
+	return ret, err
+}
+
+// Samples returns the stats of a container from start, inclusive, to end,
+// exclusive, oldest first. A zero end is no end. At most limit samples
+// are returned if it is positive.
+func (self *Database) Samples(containerName string, start, end time.Time, limit int) ([]Sample, error) {
+	var startNanos int64
+	if !start.IsZero() {
+		startNanos = start.UnixNano()
+	}
+	var endNanos int64 = 1<<63 - 1
+	if !end.IsZero() {
+		endNanos = end.UnixNano()
+	}
+	if limit <= 0 {
+		// No limit.
+		limit = -1
+	}
+	var ret []Sample
+	err := self.conn.query(
+		"SELECT time, machine, container, stats FROM stats WHERE container = ? AND time >= ? AND time < ? ORDER BY time LIMIT ?",
+		[]interface{}{containerName, startNanos, endNanos, limit},
+		func(s *stmt) error {
+			sample := Sample{
+				Time:      time.Unix(0, s.int64(0)),
+				Machine:   s.text(1),
+				Container: s.text(2),
+				Stats:     &info.ContainerStats{},
+			}
+			if err := json.Unmarshal([]byte(s.text(3)), sample.Stats); err != nil {
+				return fmt.Errorf("failed to decode the stats of container %q at %v - %v", sample.Container, sample.Time, err)
+			}
+			ret = append(ret, sample)
+			return nil
+		})
+	return ret, err
+}
+
+func (self *Database) Close() error {
+	return self.conn.close()
+}
@@ -0,0 +1,395 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build cgo
+
+package sqlite
+
+// #include <stdlib.h>
+//
+// int
+// my_sqlite3_open_v2(void *f, const char *filename, void **db, int flags)
+// {
+//   int (*sqlite3_open_v2)(const char *, void **, int, const char *);
+//
+//   sqlite3_open_v2 = (int (*)(const char *, void **, int, const char *))f;
+//   return sqlite3_open_v2(filename, db, flags, NULL);
+// }
+//
+// int
+// my_sqlite3_close_v2(void *f, void *db)
+// {
+//   int (*sqlite3_close_v2)(void *);
+//
+//   sqlite3_close_v2 = (int (*)(void *))f;
+//   return sqlite3_close_v2(db);
+// }
+//
+// const char *
+// my_sqlite3_errmsg(void *f, void *db)
+// {
+//   const char *(*sqlite3_errmsg)(void *);
+//
+//   sqlite3_errmsg = (const char *(*)(void *))f;
+//   return sqlite3_errmsg(db);
+// }
+//
+// int
+// my_sqlite3_prepare_v2(void *f, void *db, const char *sql, void **stmt)
+// {
+//   int (*sqlite3_prepare_v2)(void *, const char *, int, void **, const char **);
+//
+//   sqlite3_prepare_v2 = (int (*)(void *, const char *, int, void **, const char **))f;
+//   return sqlite3_prepare_v2(db, sql, -1, stmt, NULL);
+// }
+//
+// int
+// my_sqlite3_bind_null(void *f, void *stmt, int i)
+// {
+//   int (*sqlite3_bind_null)(void *, int);
+//
+//   sqlite3_bind_null = (int (*)(void *, int))f;
+//   return sqlite3_bind_null(stmt, i);
+// }
+//
+// int
+// my_sqlite3_bind_int64(void *f, void *stmt, int i, long long value)
+// {
+//   int (*sqlite3_bind_int64)(void *, int, long long);
+//
+//   sqlite3_bind_int64 = (int (*)(void *, int, long long))f;
+//   return sqlite3_bind_int64(stmt, i, value);
+// }
+//
+// int
+// my_sqlite3_bind_double(void *f, void *stmt, int i, double value)
+// {
+//   int (*sqlite3_bind_double)(void *, int, double);
+//
+//   sqlite3_bind_double = (int (*)(void *, int, double))f;
+//   return sqlite3_bind_double(stmt, i, value);
+// }
+//
+// int
+// my_sqlite3_bind_text(void *f, void *stmt, int i, const char *value, int n)
+// {
+//   int (*sqlite3_bind_text)(void *, int, const char *, int, void (*)(void *));
+//
+//   sqlite3_bind_text = (int (*)(void *, int, const char *, int, void (*)(void *)))f;
+//   // SQLITE_TRANSIENT, SQLite copies the value.
+//   return sqlite3_bind_text(stmt, i, value, n, (void (*)(void *))-1);
+// }
+//
+// int
+// my_sqlite3_stmt(void *f, void *stmt)
+// {
+//   int (*sqlite3_stmt_func)(void *);
+//
+//   sqlite3_stmt_func = (int (*)(void *))f;
+//   return sqlite3_stmt_func(stmt);
+// }
+//
+// long long
+// my_sqlite3_column_int64(void *f, void *stmt, int i)
+// {
+//   long long (*sqlite3_column_int64)(void *, int);
+//
+//   sqlite3_column_int64 = (long long (*)(void *, int))f;
+//   return sqlite3_column_int64(stmt, i);
+// }
+//
+// const char *
+// my_sqlite3_column_text(void *f, void *stmt, int i)
+// {
+//   const char *(*sqlite3_column_text)(void *, int);
+//
+//   sqlite3_column_text = (const char *(*)(void *, int))f;
+//   return sqlite3_column_text(stmt, i);
+// }
+//
+// int
+// my_sqlite3_column_bytes(void *f, void *stmt, int i)
+// {
+//   int (*sqlite3_column_bytes)(void *, int);
+//
+//   sqlite3_column_bytes = (int (*)(void *, int))f;
+//   return sqlite3_column_bytes(stmt, i);
+// }
+import "C"
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+
+	"github.com/coreos/pkg/dlopen"
+)
+
+// libsqlite3 is loaded at runtime rather than linked against, so that
+// cAdvisor does not require it unless the driver is used.
+var libsqlite3Names = []string{
+	"libsqlite3.so.0",
+	"libsqlite3.so",
+}
+
+// Flags of sqlite3_open_v2.
+const (
+	openReadOnly  = 0x00000001
+	openReadWrite = 0x00000002
+	openCreate    = 0x00000004
+	openFullMutex = 0x00010000
+)
+
+// Result codes.
+const (
+	resultCorrupt = 11
+	resultNotADB  = 26
+	resultRow     = 100
+	resultDone    = 101
+)
+
+// The functions of libsqlite3 which are used.
+var lib struct {
+	once sync.Once
+	err  error
+
+	open        unsafe.Pointer
+	close       unsafe.Pointer
+	errmsg      unsafe.Pointer
+	prepare     unsafe.Pointer
+	bindNull    unsafe.Pointer
+	bindInt64   unsafe.Pointer
+	bindDouble  unsafe.Pointer
+	bindText    unsafe.Pointer
+	step        unsafe.Pointer
+	reset       unsafe.Pointer
+	finalize    unsafe.Pointer
+	columnInt64 unsafe.Pointer
+	columnText  unsafe.Pointer
+	columnBytes unsafe.Pointer
+}
+
+func loadLibrary() error {
+	lib.once.Do(func() {
+		handle, err := dlopen.GetHandle(libsqlite3Names)
+		if err != nil {
+			lib.err = fmt.Errorf("failed to load libsqlite3 - %v", err)
+			return
+		}
+		for symbol, f := range map[string]*unsafe.Pointer{
+			"sqlite3_open_v2":      &lib.open,
+			"sqlite3_close_v2":     &lib.close,
+			"sqlite3_errmsg":       &lib.errmsg,
+			"sqlite3_prepare_v2":   &lib.prepare,
+			"sqlite3_bind_null":    &lib.bindNull,
+			"sqlite3_bind_int64":   &lib.bindInt64,
+			"sqlite3_bind_double":  &lib.bindDouble,
+			"sqlite3_bind_text":    &lib.bindText,
+			"sqlite3_step":         &lib.step,
+			"sqlite3_reset":        &lib.reset,
+			"sqlite3_finalize":     &lib.finalize,
+			"sqlite3_column_int64": &lib.columnInt64,
+			"sqlite3_column_text":  &lib.columnText,
+			"sqlite3_column_bytes": &lib.columnBytes,
+		} {
+			if *f, err = handle.GetSymbolPointer(symbol); err != nil {
+				handle.Close()
+				lib.err = fmt.Errorf("failed to load libsqlite3 - %v", err)
+				return
+			}
+		}
+	})
+	return lib.err
+}
+
+// sqliteError is an error of SQLite, with its result code.
+type sqliteError struct {
+	code    int
+	message string
+}
+
+func (self *sqliteError) Error() string {
+	return fmt.Sprintf("sqlite: %s (%d)", self.message, self.code)
+}
+
+// isCorrupt returns whether an error is that the database file is corrupted
+// or is not a database.
+func isCorrupt(err error) bool {
+	sqliteErr, ok := err.(*sqliteError)
+	if !ok {
+		return false
+	}
+	code := sqliteErr.code & 0xff
+	return code == resultCorrupt || code == resultNotADB
+}
+
+// conn is a connection to a database.
+type conn struct {
+	db unsafe.Pointer
+}
+
+func openConn(path string, flags int) (*conn, error) {
+	if err := loadLibrary(); err != nil {
+		return nil, err
+	}
+	cpath := C.CString(path)
+	defer C.free(unsafe.Pointer(cpath))
+	var db unsafe.Pointer
+	rc := C.my_sqlite3_open_v2(lib.open, cpath, &db, C.int(flags|openFullMutex))
+	if rc != 0 {
+		if db == nil {
+			return nil, &sqliteError{int(rc), "out of memory"}
+		}
+		err := (&conn{db}).error(rc)
+		C.my_sqlite3_close_v2(lib.close, db)
+		return nil, err
+	}
+	return &conn{db}, nil
+}
+
+// error returns the error of a result code, with the message of the last
+// error of the connection.
+func (self *conn) error(rc C.int) error {
+	return &sqliteError{int(rc), C.GoString(C.my_sqlite3_errmsg(lib.errmsg, self.db))}
+}
+
+// prepare compiles a single statement.
+func (self *conn) prepare(query string) (*stmt, error) {
+	cquery := C.CString(query)
+	defer C.free(unsafe.Pointer(cquery))
+	var ptr unsafe.Pointer
+	if rc := C.my_sqlite3_prepare_v2(lib.prepare, self.db, cquery, &ptr); rc != 0 {
+		return nil, self.error(rc)
+	}
+	return &stmt{self, ptr}, nil
+}
+
+// exec executes a single statement, ignoring the rows it returns.
+func (self *conn) exec(query string, args ...interface{}) error {
+	return self.query(query, args, func(*stmt) error { return nil })
+}
+
+// query executes a single statement, and scans every row it returns.
+func (self *conn) query(query string, args []interface{}, scan func(*stmt) error) error {
+	s, err := self.prepare(query)
+	if err != nil {
+		return err
+	}
+	defer s.finalize()
+	if err := s.bind(args...); err != nil {
+		return err
+	}
+	for {
+		row, err := s.step()
+		if err != nil || !row {
+			return err
+		}
+		if err := scan(s); err != nil {
+			return err
+		}
+	}
+}
+
+func (self *conn) close() error {
+	if rc := C.my_sqlite3_close_v2(lib.close, self.db); rc != 0 {
+		return self.error(rc)
+	}
+	return nil
+}
+
+// emptyText is bound for empty strings, as a NULL pointer binds NULL.
+var emptyText = C.CString("")
+
+// stmt is a prepared statement.
+type stmt struct {
+	conn *conn
+	ptr  unsafe.Pointer
+}
+
+// bind binds the parameters of the statement, in order.
+func (self *stmt) bind(args ...interface{}) error {
+	for i, arg := range args {
+		n := C.int(i + 1)
+		var rc C.int
+		switch v := arg.(type) {
+		case nil:
+			rc = C.my_sqlite3_bind_null(lib.bindNull, self.ptr, n)
+		case int:
+			rc = C.my_sqlite3_bind_int64(lib.bindInt64, self.ptr, n, C.longlong(v))
+		case int64:
+			rc = C.my_sqlite3_bind_int64(lib.bindInt64, self.ptr, n, C.longlong(v))
+		case float64:
+			rc = C.my_sqlite3_bind_double(lib.bindDouble, self.ptr, n, C.double(v))
+		case string:
+			rc = self.bindText(n, []byte(v))
+		case []byte:
+			rc = self.bindText(n, v)
+		default:
+			return fmt.Errorf("sqlite: unsupported parameter type %T", arg)
+		}
+		if rc != 0 {
+			return self.conn.error(rc)
+		}
+	}
+	return nil
+}
+
+func (self *stmt) bindText(n C.int, value []byte) C.int {
+	if len(value) == 0 {
+		return C.my_sqlite3_bind_text(lib.bindText, self.ptr, n, emptyText, 0)
+	}
+	// SQLite copies the value before returning, so the Go memory can be
+	// passed.
+	return C.my_sqlite3_bind_text(lib.bindText, self.ptr, n, (*C.char)(unsafe.Pointer(&value[0])), C.int(len(value)))
+}
+
+// step executes the statement up to its next row, returning whether there
+// is one.
+func (self *stmt) step() (bool, error) {
+	switch rc := C.my_sqlite3_stmt(lib.step, self.ptr); rc {
+	case resultRow:
+		return true, nil
+	case resultDone:
+		return false, nil
+	default:
+		return false, self.conn.error(rc)
+	}
+}
+
+// reset resets the statement, so that it can be executed again.
+func (self *stmt) reset() error {
+	if rc := C.my_sqlite3_stmt(lib.reset, self.ptr); rc != 0 {
+		return self.conn.error(rc)
+	}
+	return nil
+}
+
+func (self *stmt) int64(i int) int64 {
+	return int64(C.my_sqlite3_column_int64(lib.columnInt64, self.ptr, C.int(i)))
+}
+
+func (self *stmt) text(i int) string {
+	p := C.my_sqlite3_column_text(lib.columnText, self.ptr, C.int(i))
+	if p == nil {
+		return ""
+	}
+	return C.GoStringN(p, C.my_sqlite3_column_bytes(lib.columnBytes, self.ptr, C.int(i)))
+}
+
+func (self *stmt) finalize() error {
+	if rc := C.my_sqlite3_stmt(lib.finalize, self.ptr); rc != 0 {
+		return self.conn.error(rc)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build cgo
+
+package sqlite
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConn(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	c, err := openConn(filepath.Join(dir, "test.db"), openReadWrite|openCreate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.close()
+	if err := c.exec("CREATE TABLE t (i INTEGER, f REAL, s TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]interface{}{
+		{int64(1) << 40, 1.5, "text"},
+		{2, 2.5, ""},
+		{3, nil, []byte("bytes")},
+	} {
+		if err := c.exec("INSERT INTO t VALUES (?, ?, ?)", args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	var ints []int64
+	err = c.query("SELECT i, s, s IS NULL FROM t WHERE i > ? ORDER BY i", []interface{}{0}, func(s *stmt) error {
+		ints = append(ints, s.int64(0))
+		got = append(got, s.text(1))
+		if s.int64(2) != 0 {
+			t.Errorf("expected a text, not NULL, for row %d", s.int64(0))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || ints[2] != 1<<40 || got[0] != "" || got[1] != "bytes" || got[2] != "text" {
+		t.Errorf("unexpected rows %v %v", ints, got)
+	}
+	if err := c.exec("INSERT INTO t VALUES (?)", struct{}{}); err == nil {
+		t.Error("expected an error for an unsupported parameter")
+	}
+	if err := c.exec("SELECT * FROM missing"); err == nil || isCorrupt(err) {
+		t.Errorf("expected an error of a missing table, got %v", err)
+	}
+}
@@ -0,0 +1,374 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build cgo
+
+package sqlite
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+
+	"github.com/golang/glog"
+)
+
+func init() {
+	storage.RegisterStorageDriver("sqlite", new)
+}
+
+var (
+	argPath          = flag.String("storage_driver_sqlite_path", "/var/lib/cadvisor/stats.db", "path of the SQLite database file the stats are stored in")
+	argMaxSize       = flag.Int64("storage_driver_sqlite_max_size", 1<<30, "maximum size in bytes of the stored stats, the oldest being pruned beyond it; 0 for no maximum")
+	argMaxAge        = flag.Duration("storage_driver_sqlite_max_age", 7*24*time.Hour, "maximum age of the stored stats, older ones being pruned; 0 for no maximum")
+	argBatchSize     = flag.Int("storage_driver_sqlite_batch_size", 100, "maximum number of stats written per transaction")
+	argFlushInterval = flag.Duration("storage_driver_sqlite_flush_interval", 5*time.Second, "maximum time the stats wait for a transaction to fill up before they are written")
+	argPruneInterval = flag.Duration("storage_driver_sqlite_prune_interval", time.Minute, "interval of the pruning of the stats beyond the maximum size or age")
+	argMaxPending    = flag.Int("storage_driver_sqlite_max_pending", 10000, "maximum number of stats waiting to be written, further stats are dropped")
+)
+
+const (
+	// Fraction of the rows deleted at once while the database is larger
+	// than its maximum size.
+	pruneFraction = 10
+	// Minimum time between the logs of the write errors.
+	errorLogInterval = time.Minute
+)
+
+// row is the stats of a container waiting to be written.
+type row struct {
+	time      int64
+	container string
+	stats     []byte
+}
+
+type sqliteStorage struct {
+	// Reads the stored stats, with a connection of its own so that they
+	// can be read while stats are written.
+	*Database
+
+	machineName   string
+	writer        *conn
+	maxSize       int64
+	maxAge        time.Duration
+	batchSize     int
+	flushInterval time.Duration
+	pruneInterval time.Duration
+
+	queue chan *row
+	done  chan struct{}
+
+	// Counts of the stats failed to be written, and dropped because too
+	// many were pending.
+	failed  uint64
+	dropped uint64
+	// Counts when the errors were last logged, and the last error.
+	logLock      sync.Mutex
+	lastLog      time.Time
+	lastErr      error
+	loggedFailed uint64
+	loggedDrop   uint64
+}
+
+func new() (storage.StorageDriver, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	return newStorage(config{
+		machineName:   hostname,
+		path:          *argPath,
+		maxSize:       *argMaxSize,
+		maxAge:        *argMaxAge,
+		batchSize:     *argBatchSize,
+		flushInterval: *argFlushInterval,
+		pruneInterval: *argPruneInterval,
+		maxPending:    *argMaxPending,
+	})
+}
+
+func (self *sqliteStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	if stats == nil {
+		return nil
+	}
+	b, err := json.Marshal(stats)
+	if err != nil {
+		return fmt.Errorf("failed to encode the stats of container %q - %v", ref.Name, err)
+	}
+	select {
+	case self.queue <- &row{stats.Timestamp.UnixNano(), ref.Name, b}:
+	default:
+		atomic.AddUint64(&self.dropped, 1)
+		self.logErrors(false)
+	}
+	return nil
+}
+
+// run writes the queued stats in batches, and prunes the database, until
+// the queue is closed and empty.
+func (self *sqliteStorage) run() {
+	defer close(self.done)
+	pruneTicker := time.NewTicker(self.pruneInterval)
+	defer pruneTicker.Stop()
+	var batch []*row
+	var timer *time.Timer
+	var deadline <-chan time.Time
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, deadline = nil, nil
+		}
+		if len(batch) > 0 {
+			self.write(batch)
+		}
+		batch = nil
+	}
+	for {
+		select {
+		case r, ok := <-self.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, r)
+			if len(batch) >= self.batchSize {
+				flush()
+			} else if len(batch) == 1 {
+				timer = time.NewTimer(self.flushInterval)
+				deadline = timer.C
+			}
+		case <-deadline:
+			flush()
+		case <-pruneTicker.C:
+			self.prune()
+		}
+	}
+}
+
+// write inserts a batch in a single transaction.
+func (self *sqliteStorage) write(batch []*row) {
+	err := self.transaction(func() error {
+		insert, err := self.writer.prepare("INSERT INTO stats (time, machine, container, stats) VALUES (?, ?, ?, ?)")
+		if err != nil {
+			return err
+		}
+		defer insert.finalize()
+		for _, r := range batch {
+			if err := insert.bind(r.time, self.machineName, r.container, r.stats); err != nil {
+				return err
+			}
+			if _, err := insert.step(); err != nil {
+				return err
+			}
+			if err := insert.reset(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		atomic.AddUint64(&self.failed, uint64(len(batch)))
+		self.logLock.Lock()
+		self.lastErr = err
+		self.logLock.Unlock()
+		self.logErrors(false)
+	}
+}
+
+// transaction runs f in a transaction, which is rolled back if f fails.
+func (self *sqliteStorage) transaction(f func() error) error {
+	if err := self.writer.exec("BEGIN IMMEDIATE"); err != nil {
+		return err
+	}
+	if err := f(); err != nil {
+		self.writer.exec("ROLLBACK")
+		return err
+	}
+	return self.writer.exec("COMMIT")
+}
+
+// prune deletes the stats older than the maximum age, then the oldest
+// stats while the database is larger than its maximum size.
+func (self *sqliteStorage) prune() {
+	if err := self.pruneRows(); err != nil {
+		glog.Errorf("failed to prune SQLite database - %v", err)
+	}
+}
+
+func (self *sqliteStorage) pruneRows() error {
+	pruned := false
+	if self.maxAge > 0 {
+		if err := self.writer.exec("DELETE FROM stats WHERE time < ?", time.Now().Add(-self.maxAge).UnixNano()); err != nil {
+			return err
+		}
+		pruned = true
+	}
+	for self.maxSize > 0 {
+		size, err := self.size()
+		if err != nil {
+			return err
+		}
+		if size <= self.maxSize {
+			break
+		}
+		count, err := self.int64("SELECT count(*) FROM stats")
+		if err != nil {
+			return err
+		}
+		if count == 0 {
+			break
+		}
+		limit := count / pruneFraction
+		if limit == 0 {
+			limit = 1
+		}
+		if err := self.writer.exec("DELETE FROM stats WHERE rowid IN (SELECT rowid FROM stats ORDER BY time LIMIT ?)", limit); err != nil {
+			return err
+		}
+		pruned = true
+	}
+	if !pruned {
+		return nil
+	}
+	// Gives the freed pages back to the file system, and truncates the
+	// WAL.
+	if err := self.writer.exec("PRAGMA incremental_vacuum"); err != nil {
+		return err
+	}
+	return self.writer.exec("PRAGMA wal_checkpoint(TRUNCATE)")
+}
+
+// size returns the size of the pages of the database which are in use.
+func (self *sqliteStorage) size() (int64, error) {
+	var values []int64
+	for _, pragma := range []string{"PRAGMA page_count", "PRAGMA freelist_count", "PRAGMA page_size"} {
+		value, err := self.int64(pragma)
+		if err != nil {
+			return 0, err
+		}
+		values = append(values, value)
+	}
+	return (values[0] - values[1]) * values[2], nil
+}
+
+// int64 returns the integer a query of the writer returns.
+func (self *sqliteStorage) int64(query string) (int64, error) {
+	var ret int64
+	err := self.writer.query(query, nil, func(s *stmt) error {
+		ret = s.int64(0)
+		return nil
+	})
+	return ret, err
+}
+
+// logErrors logs the counts of the stats failed and dropped since the last
+// log, at most every errorLogInterval unless forced.
+func (self *sqliteStorage) logErrors(force bool) {
+	self.logLock.Lock()
+	defer self.logLock.Unlock()
+	if !force && time.Since(self.lastLog) < errorLogInterval {
+		return
+	}
+	failed, dropped := atomic.LoadUint64(&self.failed), atomic.LoadUint64(&self.dropped)
+	if failed == self.loggedFailed && dropped == self.loggedDrop {
+		return
+	}
+	glog.Errorf("SQLite: %d stats failed to be written and %d were dropped because %d were pending, last error: %v",
+		failed-self.loggedFailed, dropped-self.loggedDrop, cap(self.queue), self.lastErr)
+	self.lastLog = time.Now()
+	self.loggedFailed, self.loggedDrop = failed, dropped
+}
+
+func (self *sqliteStorage) Close() error {
+	// Writes the pending stats.
+	close(self.queue)
+	<-self.done
+	self.logErrors(true)
+	err := self.Database.Close()
+	if writerErr := self.writer.close(); err == nil {
+		err = writerErr
+	}
+	return err
+}
+
+// config is the configuration of the driver, populated from the flags.
+type config struct {
+	// A unique identifier to identify the host that current cAdvisor
+	// instance is running on, stored with the stats.
+	machineName string
+	// The path of the database file.
+	path string
+	// The maximum size of the stored stats in bytes, no maximum if 0.
+	maxSize int64
+	// The maximum age of the stored stats, no maximum if 0.
+	maxAge time.Duration
+	// The maximum number of stats written per transaction.
+	batchSize int
+	// The maximum time the stats wait for a transaction to fill up.
+	flushInterval time.Duration
+	// The interval of the pruning of the stats.
+	pruneInterval time.Duration
+	// The maximum number of stats waiting to be written.
+	maxPending int
+}
+
+// Create a new SQLite storage driver.
+func newStorage(cfg config) (*sqliteStorage, error) {
+	if cfg.batchSize <= 0 || cfg.flushInterval <= 0 || cfg.pruneInterval <= 0 || cfg.maxPending <= 0 {
+		return nil, fmt.Errorf("the SQLite batch size, flush interval, prune interval and maximum pending stats must be positive")
+	}
+	if cfg.maxSize < 0 || cfg.maxAge < 0 {
+		return nil, fmt.Errorf("the SQLite maximum size and age can not be negative")
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.path), 0755); err != nil {
+		return nil, err
+	}
+	writer, err := openWriter(cfg.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database %q - %v", cfg.path, err)
+	}
+	reader, err := openConn(cfg.path, openReadWrite)
+	if err != nil {
+		writer.close()
+		return nil, fmt.Errorf("failed to open SQLite database %q - %v", cfg.path, err)
+	}
+	if err := setBusyTimeout(reader); err != nil {
+		reader.close()
+		writer.close()
+		return nil, err
+	}
+	self := &sqliteStorage{
+		Database:      &Database{reader},
+		machineName:   cfg.machineName,
+		writer:        writer,
+		maxSize:       cfg.maxSize,
+		maxAge:        cfg.maxAge,
+		batchSize:     cfg.batchSize,
+		flushInterval: cfg.flushInterval,
+		pruneInterval: cfg.pruneInterval,
+		queue:         make(chan *row, cfg.maxPending),
+		done:          make(chan struct{}),
+	}
+	self.prune()
+	go self.run()
+	return self, nil
+}
@@ -0,0 +1,276 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build cgo
+
+package sqlite
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// testConfig returns the configuration of a driver writing to the database
+// at path.
+func testConfig(path string) config {
+	return config{
+		machineName:   "host",
+		path:          path,
+		batchSize:     10,
+		flushInterval: time.Hour,
+		pruneInterval: time.Hour,
+		maxPending:    10,
+	}
+}
+
+func testStats(timestamp time.Time, usage uint64) *info.ContainerStats {
+	return &info.ContainerStats{
+		Timestamp: timestamp,
+		Cpu:       info.CpuStats{Usage: info.CpuUsage{Total: usage}},
+		Memory:    info.MemoryStats{Usage: usage},
+	}
+}
+
+func TestAddStatsAndRead(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "stats.db")
+
+	cfg := testConfig(path)
+	cfg.batchSize = 2
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1451606400, 123456789)
+	for i := 0; i < 5; i++ {
+		for _, name := range []string{"/docker/a", "/docker/b"} {
+			if err := driver.AddStats(info.ContainerReference{Name: name}, testStats(start.Add(time.Duration(i)*time.Second), uint64(i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The stats survive the driver, e.g. a restart of cAdvisor.
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	containers, err := db.Containers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 2 || containers[0] != "/docker/a" || containers[1] != "/docker/b" {
+		t.Errorf("unexpected containers %v", containers)
+	}
+	samples, err := db.Samples("/docker/a", start.Add(time.Second), start.Add(4*time.Second), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 3 {
+		t.Fatalf("expected 3 samples from 1s to 4s, got %d", len(samples))
+	}
+	for i, sample := range samples {
+		timestamp := start.Add(time.Duration(i+1) * time.Second)
+		if !sample.Time.Equal(timestamp) || sample.Machine != "host" || sample.Container != "/docker/a" {
+			t.Errorf("unexpected sample %+v", sample)
+		}
+		if !sample.Stats.Timestamp.Equal(timestamp) || sample.Stats.Memory.Usage != uint64(i+1) {
+			t.Errorf("unexpected stats %+v", sample.Stats)
+		}
+	}
+	if samples, err := db.Samples("/docker/b", time.Time{}, time.Time{}, 2); err != nil || len(samples) != 2 || !samples[0].Time.Equal(start) {
+		t.Errorf("expected the first 2 samples, got %v, %v", samples, err)
+	}
+}
+
+func TestReadWhileWriting(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	cfg := testConfig(filepath.Join(dir, "stats.db"))
+	cfg.batchSize = 1
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+	driver.AddStats(info.ContainerReference{Name: "/"}, testStats(time.Now(), 1))
+	for start := time.Now(); ; time.Sleep(time.Millisecond) {
+		samples, err := driver.Samples("/", time.Time{}, time.Time{}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(samples) == 1 {
+			break
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("the stats were not written")
+		}
+	}
+}
+
+func TestPruneMaxAge(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	cfg := testConfig(filepath.Join(dir, "stats.db"))
+	cfg.maxAge = time.Hour
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+	now := time.Now()
+	driver.write([]*row{
+		{now.Add(-2 * time.Hour).UnixNano(), "/", []byte("{}")},
+		{now.Add(-time.Minute).UnixNano(), "/", []byte("{}")},
+	})
+	driver.prune()
+	samples, err := driver.Samples("/", time.Time{}, time.Time{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 1 || !samples[0].Time.Equal(time.Unix(0, now.Add(-time.Minute).UnixNano())) {
+		t.Errorf("expected the sample older than an hour to be pruned, got %v", samples)
+	}
+}
+
+func TestPruneMaxSize(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "stats.db")
+
+	const maxSize = 256 << 10
+	cfg := testConfig(path)
+	cfg.maxSize = maxSize
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Close()
+	stats := []byte(`{"padding":"` + strings.Repeat("x", 1000) + `"}`)
+	for i := 0; i < 10; i++ {
+		var batch []*row
+		for j := 0; j < 100; j++ {
+			batch = append(batch, &row{int64(i*100 + j), "/", stats})
+		}
+		driver.write(batch)
+	}
+	if size, err := driver.size(); err != nil || size <= maxSize {
+		t.Fatalf("expected the database to be larger than %d, got %d, %v", maxSize, size, err)
+	}
+	driver.prune()
+	if size, err := driver.size(); err != nil || size > maxSize {
+		t.Errorf("expected the database to be pruned to %d, got %d, %v", maxSize, size, err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() > 2*maxSize {
+		t.Errorf("expected the file to shrink, got %d bytes", fi.Size())
+	}
+	// The oldest rows were pruned.
+	count, err := driver.int64("SELECT count(*) FROM stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldest, err := driver.int64("SELECT min(time) FROM stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count == 0 || oldest != 1000-count {
+		t.Errorf("expected the newest rows to be kept, got %d rows from %d", count, oldest)
+	}
+}
+
+func TestCorruptedDatabase(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "stats.db")
+	if err := ioutil.WriteFile(path, []byte(strings.Repeat("not a database", 1000)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testConfig(path)
+	cfg.batchSize = 1
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	moved, err := filepath.Glob(path + ".corrupt-*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 1 {
+		t.Fatalf("expected the corrupted file to be moved aside, got %v", moved)
+	}
+	if b, err := ioutil.ReadFile(moved[0]); err != nil || !strings.HasPrefix(string(b), "not a database") {
+		t.Errorf("expected the content of the corrupted file, got %v", err)
+	}
+	db, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Containers(); err != nil {
+		t.Errorf("expected a new database, got %v", err)
+	}
+}
+
+func TestMaxPending(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	cfg := testConfig(filepath.Join(dir, "stats.db"))
+	cfg.batchSize = 100
+	cfg.maxPending = 1
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The writes must not block housekeeping, the stats beyond the
+	// pending ones are dropped.
+	for i := 0; i < 1000; i++ {
+		driver.AddStats(info.ContainerReference{Name: "/"}, testStats(time.Now(), 1))
+	}
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if driver.dropped == 0 {
+		t.Error("expected stats to be dropped")
+	}
+}
@@ -17,20 +17,38 @@ package client
 import (
 	"fmt"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/golang/glog"
 )
 
+// DefaultMaxPayload is the largest payload of a UDP datagram which is not
+// fragmented on an Ethernet network, with room for the IP options.
+const DefaultMaxPayload = 1432
+
+// Client sends metric lines to a statsd daemon over UDP or TCP. The lines
+// are separated by newlines and batched in payloads of at most MaxPayload
+// bytes, sent once full or FlushInterval after their first line was
+// written. Over TCP, every payload ends with a newline, and the connection
+// is reopened after an error.
 type Client struct {
-	HostPort  string
-	Namespace string
-	conn      net.Conn
+	HostPort      string
+	Namespace     string
+	Network       string
+	MaxPayload    int
+	FlushInterval time.Duration
+
+	lock   sync.Mutex
+	conn   net.Conn
+	buffer []byte
+	timer  *time.Timer
 }
 
 func (self *Client) Open() error {
-	conn, err := net.Dial("udp", self.HostPort)
+	conn, err := net.Dial(self.Network, self.HostPort)
 	if err != nil {
-		glog.Errorf("failed to open udp connection to %q: %v", self.HostPort, err)
+		glog.Errorf("failed to open %s connection to %q: %v", self.Network, self.HostPort, err)
 		return err
 	}
 	self.conn = conn
@@ -38,26 +56,116 @@ func (self *Client) Open() error {
 }
 
 func (self *Client) Close() error {
-	self.conn.Close()
-	self.conn = nil
-	return nil
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.timer != nil {
+		self.timer.Stop()
+		self.timer = nil
+	}
+	err := self.flush()
+	if self.conn != nil {
+		self.conn.Close()
+		self.conn = nil
+	}
+	return err
 }
 
 // Simple send to statsd daemon without sampling.
 func (self *Client) Send(namespace, containerName, key string, value uint64) error {
 	// only send counter value
-	formatted := fmt.Sprintf("%s.%s.%s:%d|g", namespace, containerName, key, value)
-	_, err := fmt.Fprintf(self.conn, formatted)
-	if err != nil {
-		return fmt.Errorf("failed to send data %q: %v", formatted, err)
+	return self.Write(fmt.Sprintf("%s.%s.%s:%d|g", namespace, containerName, key, value))
+}
+
+// Write buffers a formatted line, and sends the buffered lines if they
+// fill a payload.
+func (self *Client) Write(line string) error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	var err error
+	if len(self.buffer) > 0 && len(self.buffer)+1+len(line) > self.MaxPayload {
+		err = self.flush()
 	}
-	return nil
+	if len(self.buffer) > 0 {
+		self.buffer = append(self.buffer, '\n')
+	}
+	self.buffer = append(self.buffer, line...)
+	if len(self.buffer) >= self.MaxPayload {
+		if flushErr := self.flush(); err == nil {
+			err = flushErr
+		}
+	} else if self.timer == nil {
+		self.timer = time.AfterFunc(self.FlushInterval, self.flushAfterInterval)
+	}
+	return err
+}
+
+// Flush sends the buffered lines.
+func (self *Client) Flush() error {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.flush()
 }
 
-func New(hostPort string) (*Client, error) {
-	Client := Client{HostPort: hostPort}
+func (self *Client) flushAfterInterval() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.timer = nil
+	if err := self.flush(); err != nil {
+		glog.Errorf("%v", err)
+	}
+}
+
+// flush sends the buffered lines, reconnecting once if the connection is
+// broken. The lines are dropped if they can not be sent. Lock must be held.
+func (self *Client) flush() error {
+	if self.timer != nil {
+		self.timer.Stop()
+		self.timer = nil
+	}
+	if len(self.buffer) == 0 {
+		return nil
+	}
+	payload := self.buffer
+	if self.Network == "tcp" {
+		payload = append(payload, '\n')
+	}
+	self.buffer = nil
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if self.conn == nil {
+			if err = self.Open(); err != nil {
+				continue
+			}
+		}
+		if _, err = self.conn.Write(payload); err == nil {
+			return nil
+		}
+		self.conn.Close()
+		self.conn = nil
+	}
+	return fmt.Errorf("failed to send data %q: %v", payload, err)
+}
+
+// New returns a client of the statsd daemon at hostPort, over the network,
+// "udp" or "tcp". A maxPayload of 0 sends every line on its own.
+func New(network, hostPort string, maxPayload int, flushInterval time.Duration) (*Client, error) {
+	if network != "udp" && network != "tcp" {
+		return nil, fmt.Errorf("unknown statsd network %q, must be udp or tcp", network)
+	}
+	if maxPayload < 0 {
+		return nil, fmt.Errorf("invalid statsd payload size %d", maxPayload)
+	}
+	if flushInterval <= 0 {
+		return nil, fmt.Errorf("invalid statsd flush interval %s", flushInterval)
+	}
+	Client := &Client{
+		HostPort:      hostPort,
+		Network:       network,
+		MaxPayload:    maxPayload,
+		FlushInterval: flushInterval,
+	}
 	if err := Client.Open(); err != nil {
 		return nil, err
 	}
-	return &Client, nil
+	return Client, nil
 }
@@ -0,0 +1,181 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readDatagram returns the next datagram received by conn.
+func readDatagram(t *testing.T, conn net.PacketConn) string {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 65536)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("failed to read a datagram: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func newUDPClient(t *testing.T, maxPayload int, flushInterval time.Duration) (*Client, net.PacketConn) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := New("udp", listener.LocalAddr().String(), maxPayload, flushInterval)
+	if err != nil {
+		listener.Close()
+		t.Fatal(err)
+	}
+	return client, listener
+}
+
+func TestUDPBatching(t *testing.T) {
+	// Room for two lines of 10 bytes and their separator.
+	client, listener := newUDPClient(t, 21, time.Hour)
+	defer listener.Close()
+	defer client.Close()
+
+	lines := []string{"a.b.c:10|g", "a.b.d:20|g", "a.b.e:30|g", "a.b.f:40|g", "a.b.g:50|g"}
+	for _, line := range lines {
+		if err := client.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, expected := range []string{"a.b.c:10|g\na.b.d:20|g", "a.b.e:30|g\na.b.f:40|g"} {
+		if actual := readDatagram(t, listener); actual != expected {
+			t.Errorf("expected datagram %q, got %q", expected, actual)
+		}
+	}
+	if err := client.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if actual := readDatagram(t, listener); actual != "a.b.g:50|g" {
+		t.Errorf("expected the last line on its own, got %q", actual)
+	}
+}
+
+func TestUDPLongLine(t *testing.T) {
+	client, listener := newUDPClient(t, 8, time.Hour)
+	defer listener.Close()
+	defer client.Close()
+
+	for _, line := range []string{"a:1|g", "a.b.c.d:1|g"} {
+		if err := client.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The long line does not fit with the first one, and is sent on its own
+	// rather than truncated.
+	for _, expected := range []string{"a:1|g", "a.b.c.d:1|g"} {
+		if actual := readDatagram(t, listener); actual != expected {
+			t.Errorf("expected datagram %q, got %q", expected, actual)
+		}
+	}
+}
+
+func TestFlushInterval(t *testing.T) {
+	client, listener := newUDPClient(t, DefaultMaxPayload, 50*time.Millisecond)
+	defer listener.Close()
+	defer client.Close()
+
+	start := time.Now()
+	if err := client.Write("a.b.c:1|g"); err != nil {
+		t.Fatal(err)
+	}
+	if actual := readDatagram(t, listener); actual != "a.b.c:1|g" {
+		t.Errorf("expected %q, got %q", "a.b.c:1|g", actual)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("the line was held for %s", elapsed)
+	}
+}
+
+func TestTCPReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	conns := make(chan net.Conn, 2)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+	client, err := New("tcp", listener.Addr().String(), DefaultMaxPayload, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	first := <-conns
+	reader := bufio.NewReader(first)
+	client.Write("a.b.c:1|g")
+	client.Write("a.b.d:2|g")
+	if err := client.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// Every line, the last one included, ends with a newline.
+	for _, expected := range []string{"a.b.c:1|g\n", "a.b.d:2|g\n"} {
+		first.SetReadDeadline(time.Now().Add(5 * time.Second))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != expected {
+			t.Errorf("expected line %q, got %q", expected, line)
+		}
+	}
+
+	// The aggregator restarts, the client reconnects.
+	first.Close()
+	var second net.Conn
+	deadline := time.Now().Add(5 * time.Second)
+	for second == nil && time.Now().Before(deadline) {
+		client.Write("a.b.e:3|g")
+		client.Flush()
+		select {
+		case second = <-conns:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if second == nil {
+		t.Fatal("the client did not reconnect")
+	}
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(second).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(line, "a.b.e:3|g") {
+		t.Errorf("expected a line after reconnecting, got %q", line)
+	}
+}
+
+func TestInvalidNetwork(t *testing.T) {
+	if _, err := New("unix", "/tmp/statsd.sock", DefaultMaxPayload, time.Second); err == nil {
+		t.Errorf("expected an error for the unix network")
+	}
+}
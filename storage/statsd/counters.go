@@ -0,0 +1,47 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"time"
+
+	"github.com/google/cadvisor/storage"
+)
+
+// counterDeltas returns the series of a container with the values of its
+// counters replaced by their increase since the previous stats of the
+// container, which statsd adds up. The counters without a delta, see
+// storage.CounterTracker, are left out.
+func counterDeltas(tracker *storage.CounterTracker, containerName string, timestamp time.Time, series []metric) []metric {
+	counters := make(map[string]uint64)
+	for _, m := range series {
+		if m.metricType == typeCounter {
+			counters[m.seriesKey()] = m.value
+		}
+	}
+	deltas, _ := tracker.Deltas(containerName, timestamp, counters)
+	ret := make([]metric, 0, len(series))
+	for _, m := range series {
+		if m.metricType == typeCounter {
+			delta, ok := deltas[m.seriesKey()]
+			if !ok {
+				continue
+			}
+			m.value = delta
+		}
+		ret = append(ret, m)
+	}
+	return ret
+}
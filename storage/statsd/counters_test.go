@@ -0,0 +1,75 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/storage"
+)
+
+func cpuSample(total, usage uint64) []metric {
+	return []metric{
+		counter(colCpuCumulativeUsage, total),
+		gauge(colMemoryUsage, usage),
+		{key: colRxBytes, value: total * 2, metricType: typeCounter, scope: tag{scopeInterface, "eth0"}},
+	}
+}
+
+func TestCounterDeltas(t *testing.T) {
+	tracker := storage.NewCounterTracker()
+	start := time.Unix(1464000000, 0)
+	for i, tc := range []struct {
+		total    uint64
+		usage    uint64
+		expected []metric
+	}{
+		// The first sample has no delta.
+		{100, 10, []metric{gauge(colMemoryUsage, 10)}},
+		{150, 20, []metric{
+			counter(colCpuCumulativeUsage, 50),
+			gauge(colMemoryUsage, 20),
+			{key: colRxBytes, value: 100, metricType: typeCounter, scope: tag{scopeInterface, "eth0"}},
+		}},
+		// The container restarted, its counters were reset.
+		{30, 5, []metric{gauge(colMemoryUsage, 5)}},
+		// The deltas are computed from the counters after the restart.
+		{45, 6, []metric{
+			counter(colCpuCumulativeUsage, 15),
+			gauge(colMemoryUsage, 6),
+			{key: colRxBytes, value: 30, metricType: typeCounter, scope: tag{scopeInterface, "eth0"}},
+		}},
+	} {
+		actual := counterDeltas(tracker, "/docker/abc", start.Add(time.Duration(i)*time.Second), cpuSample(tc.total, tc.usage))
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("sample %d: expected %+v, got %+v", i, tc.expected, actual)
+		}
+	}
+}
+
+func TestCounterDeltasOutOfOrder(t *testing.T) {
+	tracker := storage.NewCounterTracker()
+	now := time.Unix(1464000000, 0)
+	counterDeltas(tracker, "/a", now, cpuSample(100, 1))
+	// Stats older than the previous ones are sent without their counters.
+	if actual := counterDeltas(tracker, "/a", now.Add(-time.Second), cpuSample(90, 1)); !reflect.DeepEqual(actual, []metric{gauge(colMemoryUsage, 1)}) {
+		t.Errorf("expected the gauges only, got %+v", actual)
+	}
+	if actual := counterDeltas(tracker, "/a", now.Add(time.Second), cpuSample(120, 1)); actual[0].value != 20 {
+		t.Errorf("expected a delta of 20 since the last ordered stats, got %+v", actual)
+	}
+}
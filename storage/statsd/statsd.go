@@ -15,6 +15,10 @@
 package statsd
 
 import (
+	"flag"
+	"os"
+	"time"
+
 	info "github.com/google/cadvisor/info/v1"
 	"github.com/google/cadvisor/storage"
 	client "github.com/google/cadvisor/storage/statsd/client"
@@ -24,16 +28,27 @@ func init() {
 	storage.RegisterStorageDriver("statsd", new)
 }
 
+var (
+	argDialect       = flag.String("storage_driver_statsd_dialect", dialectStatsd, "syntax of the metrics sent to statsd: 'statsd' names the container in the bucket, 'dogstatsd' and 'influxdb' (Telegraf) tag the metrics with the machine, the container name and the container labels instead")
+	argNetwork       = flag.String("storage_driver_statsd_network", "udp", "network of the statsd daemon, 'udp' or 'tcp'")
+	argMaxPayload    = flag.Int("storage_driver_statsd_max_payload", client.DefaultMaxPayload, "maximum size in bytes of the UDP datagrams or TCP writes batching the metrics, 0 to send every metric on its own")
+	argFlushInterval = flag.Duration("storage_driver_statsd_flush_interval", time.Second, "maximum time the metrics are batched before they are sent")
+)
+
 type statsdStorage struct {
-	client    *client.Client
-	Namespace string
+	client      *client.Client
+	Namespace   string
+	machineName string
+	dialect     string
+	counters    *storage.CounterTracker
 }
 
 const (
+	// Cumulative CPU usage, counter.
 	colCpuCumulativeUsage string = "cpu_cumulative_usage"
-	// CPU system
+	// CPU system, counter
 	colCpuUsageSystem string = "cpu_usage_system"
-	// CPU user
+	// CPU user, counter
 	colCpuUsageUser string = "cpu_usage_user"
 	// CPU average load
 	colCpuLoadAverage string = "cpu_load_average"
@@ -41,14 +56,22 @@ const (
 	colMemoryUsage string = "memory_usage"
 	// Working set size
 	colMemoryWorkingSet string = "memory_working_set"
-	// Cumulative count of bytes received.
+	// Count of bytes received, counter.
 	colRxBytes string = "rx_bytes"
-	// Cumulative count of receive errors encountered.
+	// Count of packets received, counter.
+	colRxPackets string = "rx_packets"
+	// Count of receive errors encountered, counter.
 	colRxErrors string = "rx_errors"
-	// Cumulative count of bytes transmitted.
+	// Count of packets dropped on receive, counter.
+	colRxDropped string = "rx_dropped"
+	// Count of bytes transmitted, counter.
 	colTxBytes string = "tx_bytes"
-	// Cumulative count of transmit errors encountered.
+	// Count of packets transmitted, counter.
+	colTxPackets string = "tx_packets"
+	// Count of transmit errors encountered, counter.
 	colTxErrors string = "tx_errors"
+	// Count of packets dropped on transmit, counter.
+	colTxDropped string = "tx_dropped"
 	// Filesystem summary
 	colFsSummary = "fs_summary"
 	// Filesystem limit.
@@ -57,71 +80,160 @@ const (
 	colFsUsage = "fs_usage"
 )
 
+// Scopes of the series of a network interface or of a filesystem.
+const (
+	scopeInterface = "interface"
+	scopeDevice    = "device"
+)
+
+// metric is a value of a series of a container.
+type metric struct {
+	key        string
+	value      uint64
+	metricType string
+	// The interface or the device of the series, if any. Its value is
+	// part of the bucket in plain statsd, and a tag otherwise.
+	scope tag
+}
+
+// seriesKey returns the key identifying the series of the metric among
+// those of its container.
+func (self metric) seriesKey() string {
+	if self.scope.key == "" {
+		return self.key
+	}
+	return self.scope.key + "." + self.scope.value + "." + self.key
+}
+
 func new() (storage.StorageDriver, error) {
-	return newStorage(*storage.ArgDbName, *storage.ArgDbHost)
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	return newStorage(config{
+		machineName:   hostname,
+		namespace:     *storage.ArgDbName,
+		hostPort:      *storage.ArgDbHost,
+		dialect:       *argDialect,
+		network:       *argNetwork,
+		maxPayload:    *argMaxPayload,
+		flushInterval: *argFlushInterval,
+	})
+}
+
+func gauge(key string, value uint64) metric {
+	return metric{key: key, value: value, metricType: typeGauge}
+}
+
+func counter(key string, value uint64) metric {
+	return metric{key: key, value: value, metricType: typeCounter}
 }
 
 func (self *statsdStorage) containerStatsToValues(
 	stats *info.ContainerStats,
-) (series map[string]uint64) {
-	series = make(map[string]uint64)
+) (series []metric) {
+	series = append(series,
+		// Cumulative Cpu Usage
+		counter(colCpuCumulativeUsage, stats.Cpu.Usage.Total),
 
-	// Cumulative Cpu Usage
-	series[colCpuCumulativeUsage] = stats.Cpu.Usage.Total
+		// Cpu usage
+		counter(colCpuUsageSystem, stats.Cpu.Usage.System),
+		counter(colCpuUsageUser, stats.Cpu.Usage.User),
+		gauge(colCpuLoadAverage, uint64(stats.Cpu.LoadAverage)),
 
-	// Cpu usage
-	series[colCpuUsageSystem] = stats.Cpu.Usage.System
-	series[colCpuUsageUser] = stats.Cpu.Usage.User
-	series[colCpuLoadAverage] = uint64(stats.Cpu.LoadAverage)
+		// Memory Usage
+		gauge(colMemoryUsage, stats.Memory.Usage),
 
-	// Memory Usage
-	series[colMemoryUsage] = stats.Memory.Usage
+		// Working set size
+		gauge(colMemoryWorkingSet, stats.Memory.WorkingSet),
+	)
 
-	// Working set size
-	series[colMemoryWorkingSet] = stats.Memory.WorkingSet
+	// Network stats, of the default interface.
+	series = append(series, interfaceStatsToValues(stats.Network.InterfaceStats, tag{})...)
+
+	// Per interface stats.
+	for _, iface := range stats.Network.Interfaces {
+		series = append(series, interfaceStatsToValues(iface, tag{scopeInterface, iface.Name})...)
+	}
 
-	// Network stats.
-	series[colRxBytes] = stats.Network.RxBytes
-	series[colRxErrors] = stats.Network.RxErrors
-	series[colTxBytes] = stats.Network.TxBytes
-	series[colTxErrors] = stats.Network.TxErrors
+	return series
+}
 
+func interfaceStatsToValues(stats info.InterfaceStats, scope tag) []metric {
+	series := []metric{
+		counter(colRxBytes, stats.RxBytes),
+		counter(colRxPackets, stats.RxPackets),
+		counter(colRxErrors, stats.RxErrors),
+		counter(colRxDropped, stats.RxDropped),
+		counter(colTxBytes, stats.TxBytes),
+		counter(colTxPackets, stats.TxPackets),
+		counter(colTxErrors, stats.TxErrors),
+		counter(colTxDropped, stats.TxDropped),
+	}
+	for i := range series {
+		series[i].scope = scope
+	}
 	return series
 }
 
 func (self *statsdStorage) containerFsStatsToValues(
-	series *map[string]uint64,
+	series *[]metric,
 	stats *info.ContainerStats,
 ) {
+	if len(stats.Filesystem) == 0 {
+		return
+	}
+	// Summary stats.
+	limit := gauge(colFsSummary+"."+colFsLimit, 0)
+	usage := gauge(colFsSummary+"."+colFsUsage, 0)
 	for _, fsStat := range stats.Filesystem {
-		// Summary stats.
-		(*series)[colFsSummary+"."+colFsLimit] += fsStat.Limit
-		(*series)[colFsSummary+"."+colFsUsage] += fsStat.Usage
-
-		// Per device stats.
-		(*series)[fsStat.Device+"."+colFsLimit] = fsStat.Limit
-		(*series)[fsStat.Device+"."+colFsUsage] = fsStat.Usage
+		limit.value += fsStat.Limit
+		usage.value += fsStat.Usage
 	}
-}
+	*series = append(*series, limit, usage)
 
-// Push the data into redis
-func (self *statsdStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
-	if stats == nil {
-		return nil
+	// Per device stats.
+	for _, fsStat := range stats.Filesystem {
+		scope := tag{scopeDevice, fsStat.Device}
+		*series = append(*series,
+			metric{key: colFsLimit, value: fsStat.Limit, metricType: typeGauge, scope: scope},
+			metric{key: colFsUsage, value: fsStat.Usage, metricType: typeGauge, scope: scope},
+		)
 	}
+}
 
+// lines returns the lines sending the stats of a container.
+func (self *statsdStorage) lines(ref info.ContainerReference, stats *info.ContainerStats) []string {
 	var containerName string
 	if len(ref.Aliases) > 0 {
 		containerName = ref.Aliases[0]
 	} else {
 		containerName = ref.Name
 	}
+	var tags []tag
+	if self.dialect != dialectStatsd {
+		tags = self.containerTags(ref)
+	}
 
 	series := self.containerStatsToValues(stats)
 	self.containerFsStatsToValues(&series, stats)
-	for key, value := range series {
-		err := self.client.Send(self.Namespace, containerName, key, value)
-		if err != nil {
+	// The counters are sent as the deltas since the previous stats.
+	series = counterDeltas(self.counters, ref.Name, stats.Timestamp, series)
+	lines := make([]string, 0, len(series))
+	for _, m := range series {
+		lines = append(lines, formatLine(self.dialect, self.Namespace, containerName, m, tags))
+	}
+	return lines
+}
+
+// Push the data into statsd
+func (self *statsdStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	if stats == nil {
+		return nil
+	}
+
+	for _, line := range self.lines(ref, stats) {
+		if err := self.client.Write(line); err != nil {
 			return err
 		}
 	}
@@ -129,19 +241,46 @@ func (self *statsdStorage) AddStats(ref info.ContainerReference, stats *info.Con
 }
 
 func (self *statsdStorage) Close() error {
-	self.client.Close()
+	// Sends the metrics still batched.
+	err := self.client.Close()
 	self.client = nil
-	return nil
+	return err
+}
+
+// config is the configuration of the driver, populated from the flags.
+type config struct {
+	// A unique identifier to identify the host that current cAdvisor
+	// instance is running on.
+	machineName string
+	// The prefix of the metric names.
+	namespace string
+	// The address of the statsd daemon.
+	hostPort string
+	// The syntax of the metrics, plain statsd or with tags.
+	dialect string
+	// The network of the statsd daemon, udp or tcp.
+	network string
+	// The maximum size of the batches of metrics.
+	maxPayload int
+	// The maximum time the metrics are batched.
+	flushInterval time.Duration
 }
 
-func newStorage(namespace, hostPort string) (*statsdStorage, error) {
-	statsdClient, err := client.New(hostPort)
+// Create a new statsd storage driver.
+func newStorage(cfg config) (*statsdStorage, error) {
+	if err := validDialect(cfg.dialect); err != nil {
+		return nil, err
+	}
+	statsdClient, err := client.New(cfg.network, cfg.hostPort, cfg.maxPayload, cfg.flushInterval)
 	if err != nil {
 		return nil, err
 	}
 	statsdStorage := &statsdStorage{
-		client:    statsdClient,
-		Namespace: namespace,
+		client:      statsdClient,
+		Namespace:   cfg.namespace,
+		machineName: cfg.machineName,
+		dialect:     cfg.dialect,
+		counters:    storage.NewCounterTracker(),
 	}
 	return statsdStorage, nil
 }
@@ -0,0 +1,128 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// Dialects of the statsd protocol.
+const (
+	// Plain statsd, without tags: the container name is part of the
+	// bucket, e.g. cadvisor.docker-abc.memory_usage:42|g
+	dialectStatsd = "statsd"
+	// DogStatsD, with the tags after the type,
+	// e.g. cadvisor.memory_usage:42|g|#machine:host,container_name:/docker/abc
+	dialectDogStatsD = "dogstatsd"
+	// InfluxDB-statsd, as parsed by Telegraf, with the tags after the bucket,
+	// e.g. cadvisor.memory_usage,machine=host,container_name=/docker/abc:42|g
+	dialectInfluxDB = "influxdb"
+)
+
+// Names of the tags of every metric, the container labels being tags too.
+const (
+	tagMachine       = "machine"
+	tagContainerName = "container_name"
+)
+
+// Types of the statsd metrics.
+const (
+	typeGauge   = "g"
+	typeCounter = "c"
+)
+
+type tag struct {
+	key   string
+	value string
+}
+
+func validDialect(dialect string) error {
+	switch dialect {
+	case dialectStatsd, dialectDogStatsD, dialectInfluxDB:
+		return nil
+	}
+	return fmt.Errorf("unknown statsd dialect %q, must be %s, %s or %s", dialect, dialectStatsd, dialectDogStatsD, dialectInfluxDB)
+}
+
+// containerTags returns the tags of the metrics of a container: the
+// machine, the container name and the container labels, sorted by name.
+// Labels with an empty value are left out, they are not valid tags in
+// InfluxDB.
+func (self *statsdStorage) containerTags(ref info.ContainerReference) []tag {
+	tags := []tag{
+		{tagMachine, self.machineName},
+		{tagContainerName, ref.Name},
+	}
+	labels := make([]string, 0, len(ref.Labels))
+	for label, value := range ref.Labels {
+		if value != "" && label != tagMachine && label != tagContainerName {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+	for _, label := range labels {
+		tags = append(tags, tag{label, ref.Labels[label]})
+	}
+	return tags
+}
+
+// Replacers of the characters delimiting the tags and the fields of a
+// line with underscores, by dialect. Neither DogStatsD nor Telegraf
+// unescape tags, so the characters can not be quoted. DogStatsD splits a
+// tag at its first colon, values may contain more.
+var (
+	dogStatsDKeyReplacer   = strings.NewReplacer(",", "_", "|", "_", "#", "_", ":", "_", "\n", "_")
+	dogStatsDValueReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+	influxDBReplacer       = strings.NewReplacer(",", "_", "=", "_", " ", "_", ":", "_", "|", "_", "\n", "_")
+)
+
+// formatLine returns the line sending a metric of a container in the
+// dialect.
+func formatLine(dialect, namespace, containerName string, m metric, tags []tag) string {
+	key := m.key
+	if m.scope.key != "" {
+		if dialect == dialectStatsd {
+			// e.g. eth0.rx_bytes
+			key = m.scope.value + "." + key
+		} else {
+			// e.g. interface.rx_bytes, tagged with interface:eth0
+			key = m.scope.key + "." + key
+			tags = append(tags[:len(tags):len(tags)], m.scope)
+		}
+	}
+	switch dialect {
+	case dialectDogStatsD:
+		line := fmt.Sprintf("%s.%s:%d|%s", namespace, key, m.value, m.metricType)
+		for i, t := range tags {
+			sep := ","
+			if i == 0 {
+				sep = "|#"
+			}
+			line += sep + dogStatsDKeyReplacer.Replace(t.key) + ":" + dogStatsDValueReplacer.Replace(t.value)
+		}
+		return line
+	case dialectInfluxDB:
+		line := namespace + "." + key
+		for _, t := range tags {
+			line += "," + influxDBReplacer.Replace(t.key) + "=" + influxDBReplacer.Replace(t.value)
+		}
+		return fmt.Sprintf("%s:%d|%s", line, m.value, m.metricType)
+	}
+	return fmt.Sprintf("%s.%s.%s:%d|%s", namespace, containerName, key, m.value, m.metricType)
+}
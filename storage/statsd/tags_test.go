@@ -0,0 +1,203 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package statsd
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+	client "github.com/google/cadvisor/storage/statsd/client"
+)
+
+func fixtureRef() info.ContainerReference {
+	return info.ContainerReference{
+		Name:    "/docker/abc",
+		Aliases: []string{"web"},
+		Labels: map[string]string{
+			"team":  "db,infra",
+			"empty": "",
+		},
+	}
+}
+
+func fixtureStats() *info.ContainerStats {
+	stats := &info.ContainerStats{
+		Timestamp: time.Unix(1464000000, 0),
+	}
+	stats.Cpu.Usage.Total = 9
+	stats.Cpu.Usage.System = 3
+	stats.Cpu.Usage.User = 6
+	stats.Cpu.LoadAverage = 2
+	stats.Memory.Usage = 100
+	stats.Memory.WorkingSet = 80
+	stats.Network.InterfaceStats = info.InterfaceStats{
+		Name:      "eth0",
+		RxBytes:   10,
+		RxPackets: 4,
+		RxErrors:  1,
+		RxDropped: 5,
+		TxBytes:   20,
+		TxPackets: 7,
+		TxErrors:  2,
+		TxDropped: 8,
+	}
+	stats.Network.Interfaces = []info.InterfaceStats{stats.Network.InterfaceStats}
+	stats.Filesystem = []info.FsStats{
+		{Device: "sda1", Limit: 1000, Usage: 500},
+	}
+	return stats
+}
+
+// sortedLines returns the sorted lines of the fixture stats, after stats
+// with counters at 0, so that the deltas are the values of the counters.
+func sortedLines(s *statsdStorage, ref info.ContainerReference, stats *info.ContainerStats) []string {
+	previous := &info.ContainerStats{Timestamp: stats.Timestamp.Add(-time.Second)}
+	for _, iface := range stats.Network.Interfaces {
+		previous.Network.Interfaces = append(previous.Network.Interfaces, info.InterfaceStats{Name: iface.Name})
+	}
+	s.lines(ref, previous)
+	lines := s.lines(ref, stats)
+	sort.Strings(lines)
+	return lines
+}
+
+type fixtureValue struct {
+	key        string
+	scope      string
+	value      string
+	metricType string
+}
+
+var fixtureSeries = []fixtureValue{
+	{"cpu_cumulative_usage", "", "9", "c"},
+	{"cpu_load_average", "", "2", "g"},
+	{"cpu_usage_system", "", "3", "c"},
+	{"cpu_usage_user", "", "6", "c"},
+	{"fs_summary.fs_limit", "", "1000", "g"},
+	{"fs_summary.fs_usage", "", "500", "g"},
+	{"memory_usage", "", "100", "g"},
+	{"memory_working_set", "", "80", "g"},
+	{"fs_limit", "device:sda1", "1000", "g"},
+	{"fs_usage", "device:sda1", "500", "g"},
+}
+
+func init() {
+	for _, col := range []struct {
+		key   string
+		value string
+	}{
+		{"rx_bytes", "10"},
+		{"rx_packets", "4"},
+		{"rx_errors", "1"},
+		{"rx_dropped", "5"},
+		{"tx_bytes", "20"},
+		{"tx_packets", "7"},
+		{"tx_errors", "2"},
+		{"tx_dropped", "8"},
+	} {
+		fixtureSeries = append(fixtureSeries,
+			fixtureValue{col.key, "", col.value, "c"},
+			fixtureValue{col.key, "interface:eth0", col.value, "c"},
+		)
+	}
+}
+
+func TestDialects(t *testing.T) {
+	for _, tc := range []struct {
+		dialect string
+		// scope is empty or e.g. device:sda1
+		format func(key, scope, value, metricType string) string
+	}{
+		{
+			dialect: dialectStatsd,
+			format: func(key, scope, value, metricType string) string {
+				if scope != "" {
+					key = strings.SplitN(scope, ":", 2)[1] + "." + key
+				}
+				return "cadvisor.web." + key + ":" + value + "|" + metricType
+			},
+		},
+		{
+			dialect: dialectDogStatsD,
+			format: func(key, scope, value, metricType string) string {
+				tags := "machine:host,container_name:/docker/abc,team:db_infra"
+				if scope != "" {
+					key = strings.SplitN(scope, ":", 2)[0] + "." + key
+					tags += "," + scope
+				}
+				return "cadvisor." + key + ":" + value + "|" + metricType + "|#" + tags
+			},
+		},
+		{
+			dialect: dialectInfluxDB,
+			format: func(key, scope, value, metricType string) string {
+				tags := ",machine=host,container_name=/docker/abc,team=db_infra"
+				if scope != "" {
+					key = strings.SplitN(scope, ":", 2)[0] + "." + key
+					tags += "," + strings.Replace(scope, ":", "=", 1)
+				}
+				return "cadvisor." + key + tags + ":" + value + "|" + metricType
+			},
+		},
+	} {
+		s := &statsdStorage{Namespace: "cadvisor", machineName: "host", dialect: tc.dialect, counters: storage.NewCounterTracker()}
+		var expected []string
+		for _, series := range fixtureSeries {
+			expected = append(expected, tc.format(series.key, series.scope, series.value, series.metricType))
+		}
+		sort.Strings(expected)
+		if actual := sortedLines(s, fixtureRef(), fixtureStats()); !reflect.DeepEqual(actual, expected) {
+			t.Errorf("%s: expected lines\n%s\ngot\n%s", tc.dialect, strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+		}
+	}
+}
+
+func TestEscapeTags(t *testing.T) {
+	tags := []tag{
+		{"machine", "host"},
+		{"a:b", "c:d e=f|g#h"},
+	}
+	for _, tc := range []struct {
+		dialect  string
+		expected string
+	}{
+		{dialectDogStatsD, "ns.m:1|g|#machine:host,a_b:c:d e=f_g_h"},
+		{dialectInfluxDB, "ns.m,machine=host,a_b=c_d_e_f_g#h:1|g"},
+	} {
+		if actual := formatLine(tc.dialect, "ns", "c", gauge("m", 1), tags); actual != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.dialect, tc.expected, actual)
+		}
+	}
+}
+
+func TestUnknownDialect(t *testing.T) {
+	_, err := newStorage(config{
+		machineName:   "host",
+		namespace:     "cadvisor",
+		hostPort:      "localhost:8125",
+		dialect:       "graphite",
+		network:       "udp",
+		maxPayload:    client.DefaultMaxPayload,
+		flushInterval: time.Second,
+	})
+	if err == nil {
+		t.Errorf("expected an error for an unknown dialect")
+	}
+}
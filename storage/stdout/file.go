@@ -0,0 +1,112 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stdout
+
+import (
+	"fmt"
+	"os"
+)
+
+// rotatingFile is a file which is rotated once it would grow beyond
+// maxSize: it is renamed to path.1, path.1 to path.2, and so on, keeping
+// maxFiles rotated files. Named pipes and files with a maxSize of 0 are
+// never rotated.
+type rotatingFile struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+	rotate   bool
+}
+
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	if maxSize < 0 {
+		return nil, fmt.Errorf("invalid maximum file size %d", maxSize)
+	}
+	if maxFiles < 0 {
+		return nil, fmt.Errorf("invalid number of kept files %d", maxFiles)
+	}
+	self := &rotatingFile{
+		path:     path,
+		maxSize:  maxSize,
+		maxFiles: maxFiles,
+	}
+	if err := self.open(); err != nil {
+		return nil, err
+	}
+	return self, nil
+}
+
+func (self *rotatingFile) open() error {
+	// Opening a named pipe for writing blocks until it is opened for
+	// reading.
+	file, err := os.OpenFile(self.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %q - %s", self.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat %q - %s", self.path, err)
+	}
+	self.file = file
+	self.size = info.Size()
+	self.rotate = self.maxSize > 0 && info.Mode().IsRegular()
+	return nil
+}
+
+// Write writes p, after rotating the file if p would not fit in it. The
+// writes are not split across files.
+func (self *rotatingFile) Write(p []byte) (int, error) {
+	if self.rotate && self.size > 0 && self.size+int64(len(p)) > self.maxSize {
+		if err := self.rotateFiles(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := self.file.Write(p)
+	self.size += int64(n)
+	return n, err
+}
+
+func (self *rotatingFile) rotateFiles() error {
+	if err := self.file.Close(); err != nil {
+		return err
+	}
+	if self.maxFiles == 0 {
+		if err := os.Remove(self.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return self.open()
+	}
+	for i := self.maxFiles - 1; i >= 1; i-- {
+		err := os.Rename(self.rotatedPath(i), self.rotatedPath(i+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(self.path, self.rotatedPath(1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return self.open()
+}
+
+func (self *rotatingFile) rotatedPath(i int) string {
+	return fmt.Sprintf("%s.%d", self.path, i)
+}
+
+func (self *rotatingFile) Close() error {
+	return self.file.Close()
+}
@@ -16,7 +16,13 @@ package stdout
 
 import (
 	"bytes"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"os"
+	"sync"
+	"text/template"
 
 	info "github.com/google/cadvisor/info/v1"
 	"github.com/google/cadvisor/storage"
@@ -26,8 +32,39 @@ func init() {
 	storage.RegisterStorageDriver("stdout", new)
 }
 
+var (
+	argFormat      = flag.String("storage_driver_stdout_format", formatText, "format of the stats written by the stdout driver: 'text' writes space-separated key=value pairs, 'json' one JSON object per line")
+	argFile        = flag.String("storage_driver_stdout_file", "", "file or named pipe the stdout driver writes to instead of stdout")
+	argMaxFileSize = flag.Int64("storage_driver_stdout_max_file_size", 0, "size in bytes beyond which -storage_driver_stdout_file is rotated; 0 to never rotate it")
+	argMaxFiles    = flag.Int("storage_driver_stdout_max_files", 5, "number of rotated files kept besides -storage_driver_stdout_file")
+	argTemplate    = flag.String("storage_driver_stdout_template", "", "Go template of the text lines over .Container, .Stats and .Host, e.g. '{{.Container.Name}} {{.Stats.Timestamp.Unix}} cpu={{.Stats.Cpu.Usage.Total}} ws={{.Stats.Memory.WorkingSet}}'")
+	argFields      = flag.String("storage_driver_stdout_fields", "", "comma-separated fields of the text lines, by JSON name, e.g. 'cpu.usage.total,memory.working_set,network.rx_bytes,container.labels'")
+)
+
+// Formats of the lines.
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
 type stdoutStorage struct {
 	Namespace string
+	format    string
+	// The template or the fields of the text lines, if any.
+	template *template.Template
+	fields   []field
+	// Lines are written whole, with a single write under the lock, so that
+	// they do not interleave.
+	lock   sync.Mutex
+	out    io.Writer
+	closer io.Closer
+}
+
+// jsonSample is a line of the json format.
+type jsonSample struct {
+	Container info.ContainerReference `json:"container"`
+	// The timestamp and the stat groups.
+	*info.ContainerStats
 }
 
 const (
@@ -53,7 +90,19 @@ const (
 )
 
 func new() (storage.StorageDriver, error) {
-	return newStorage(*storage.ArgDbHost)
+	if *argFile == "" {
+		return newStorage(*storage.ArgDbHost, *argFormat, *argTemplate, *argFields, os.Stdout, nil)
+	}
+	file, err := openRotatingFile(*argFile, *argMaxFileSize, *argMaxFiles)
+	if err != nil {
+		return nil, err
+	}
+	driver, err := newStorage(*storage.ArgDbHost, *argFormat, *argTemplate, *argFields, file, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return driver, nil
 }
 
 func (driver *stdoutStorage) containerStatsToValues(stats *info.ContainerStats) (series map[string]uint64) {
@@ -94,32 +143,98 @@ func (driver *stdoutStorage) AddStats(ref info.ContainerReference, stats *info.C
 		return nil
 	}
 
+	var buffer bytes.Buffer
+	if driver.format == formatJSON {
+		if err := json.NewEncoder(&buffer).Encode(jsonSample{ref, stats}); err != nil {
+			return err
+		}
+	} else if err := driver.writeText(&buffer, ref, stats); err != nil {
+		return err
+	}
+
+	driver.lock.Lock()
+	defer driver.lock.Unlock()
+	_, err := driver.out.Write(buffer.Bytes())
+	return err
+}
+
+func (driver *stdoutStorage) writeText(buffer *bytes.Buffer, ref info.ContainerReference, stats *info.ContainerStats) error {
+	if driver.template != nil {
+		if err := driver.template.Execute(buffer, templateData{ref, stats, driver.Namespace}); err != nil {
+			return err
+		}
+		if !bytes.HasSuffix(buffer.Bytes(), []byte("\n")) {
+			buffer.WriteString("\n")
+		}
+		return nil
+	}
+
 	containerName := ref.Name
 	if len(ref.Aliases) > 0 {
 		containerName = ref.Aliases[0]
 	}
 
-	var buffer bytes.Buffer
 	buffer.WriteString(fmt.Sprintf("cName=%s host=%s", containerName, driver.Namespace))
 
+	if driver.fields != nil {
+		for _, f := range driver.fields {
+			buffer.WriteString(fmt.Sprintf(" %s=%v", f.path, f.value(ref, stats)))
+		}
+		buffer.WriteString("\n")
+		return nil
+	}
+
 	series := driver.containerStatsToValues(stats)
 	driver.containerFsStatsToValues(&series, stats)
 	for key, value := range series {
 		buffer.WriteString(fmt.Sprintf(" %s=%v", key, value))
 	}
-
-	_, err := fmt.Println(buffer.String())
-
-	return err
+	buffer.WriteString("\n")
+	return nil
 }
 
 func (driver *stdoutStorage) Close() error {
-	return nil
+	driver.lock.Lock()
+	defer driver.lock.Unlock()
+	if driver.closer == nil {
+		return nil
+	}
+	return driver.closer.Close()
 }
 
-func newStorage(namespace string) (*stdoutStorage, error) {
+// Create a new stdout storage driver.
+// namespace: The host written in the lines of the text format
+// format: The format of the lines, text or json
+// tmpl: The template of the text lines, if not empty
+// fields: The fields of the text lines, if not empty
+// out: Where the lines are written
+// closer: Closes out on close, if not nil
+func newStorage(namespace, format, tmpl, fields string, out io.Writer, closer io.Closer) (*stdoutStorage, error) {
+	if format != formatText && format != formatJSON {
+		return nil, fmt.Errorf("unknown stdout format %q, must be %s or %s", format, formatText, formatJSON)
+	}
+	if (tmpl != "" || fields != "") && format != formatText {
+		return nil, fmt.Errorf("a stdout template or fields require the %s format", formatText)
+	}
+	if tmpl != "" && fields != "" {
+		return nil, fmt.Errorf("a stdout template and fields are mutually exclusive")
+	}
 	stdoutStorage := &stdoutStorage{
 		Namespace: namespace,
+		format:    format,
+		out:       out,
+		closer:    closer,
+	}
+	var err error
+	if tmpl != "" {
+		if stdoutStorage.template, err = parseTemplate(tmpl); err != nil {
+			return nil, err
+		}
+	}
+	if fields != "" {
+		if stdoutStorage.fields, err = parseFields(fields); err != nil {
+			return nil, err
+		}
 	}
 	return stdoutStorage, nil
 }
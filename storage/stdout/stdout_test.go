@@ -0,0 +1,138 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stdout
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+var testRef = info.ContainerReference{
+	Name:    "/docker/abc",
+	Aliases: []string{"web", "abc"},
+	Labels:  map[string]string{"team": "infra"},
+}
+
+func testStats(timestamp time.Time) *info.ContainerStats {
+	stats := &info.ContainerStats{Timestamp: timestamp}
+	stats.Cpu.Usage.Total = 42
+	stats.Memory.WorkingSet = 1024
+	stats.Network.RxBytes = 7
+	stats.Filesystem = []info.FsStats{{Device: "sda1", Limit: 1000, Usage: 500}}
+	return stats
+}
+
+// parsedSample is a line of the json format, parsed back.
+type parsedSample struct {
+	Container info.ContainerReference `json:"container"`
+	info.ContainerStats
+}
+
+func parseLines(t *testing.T, out []byte) []parsedSample {
+	var samples []parsedSample
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		var sample parsedSample
+		if err := json.Unmarshal(scanner.Bytes(), &sample); err != nil {
+			t.Fatalf("failed to parse line %q: %v", scanner.Text(), err)
+		}
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+func TestJSONLines(t *testing.T) {
+	var out bytes.Buffer
+	driver, err := newStorage("localhost", formatJSON, "", "", &out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2016, 5, 23, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 2; i++ {
+		if err := driver.AddStats(testRef, testStats(start.Add(time.Duration(i)*time.Second))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	samples := parseLines(t, out.Bytes())
+	if len(samples) != 2 {
+		t.Fatalf("expected 2 lines, got %q", out.String())
+	}
+	for i, sample := range samples {
+		if !reflect.DeepEqual(sample.Container, testRef) {
+			t.Errorf("expected container %+v, got %+v", testRef, sample.Container)
+		}
+		expected := testStats(start.Add(time.Duration(i) * time.Second))
+		if !sample.ContainerStats.Timestamp.Equal(expected.Timestamp) {
+			t.Errorf("expected timestamp %s, got %s", expected.Timestamp, sample.ContainerStats.Timestamp)
+		}
+		sample.ContainerStats.Timestamp = expected.Timestamp
+		if !reflect.DeepEqual(&sample.ContainerStats, expected) {
+			t.Errorf("expected stats %+v, got %+v", expected, sample.ContainerStats)
+		}
+	}
+}
+
+func TestTextLine(t *testing.T) {
+	var out bytes.Buffer
+	driver, err := newStorage("localhost", formatText, "", "", &out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.AddStats(testRef, testStats(time.Unix(1464000000, 0)))
+	line := out.String()
+	if !strings.HasPrefix(line, "cName=web host=localhost ") || !strings.HasSuffix(line, "\n") || !strings.Contains(line, " cpu_cumulative_usage=42") {
+		t.Errorf("unexpected line %q", line)
+	}
+}
+
+func TestConcurrentLines(t *testing.T) {
+	var out bytes.Buffer
+	driver, err := newStorage("localhost", formatJSON, "", "", &out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ref := info.ContainerReference{Name: fmt.Sprintf("/docker/%d", i)}
+			for j := 0; j < 20; j++ {
+				driver.AddStats(ref, testStats(time.Unix(int64(j), 0)))
+			}
+		}(i)
+	}
+	wg.Wait()
+	// Every line parses, none interleaved.
+	if samples := parseLines(t, out.Bytes()); len(samples) != 200 {
+		t.Errorf("expected 200 lines, got %d", len(samples))
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := newStorage("localhost", "csv", "", "", &bytes.Buffer{}, nil); err == nil {
+		t.Errorf("expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stdout
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+// templateData is the data of the line templates.
+type templateData struct {
+	// The container, e.g. {{.Container.Name}}.
+	Container info.ContainerReference
+	// The stats, e.g. {{.Stats.Memory.WorkingSet}}.
+	Stats *info.ContainerStats
+	// The host of the text lines.
+	Host string
+}
+
+// parseTemplate parses a line template, and renders empty stats with it:
+// a template referring to a field which does not exist fails now rather
+// than for every sample. Other errors, e.g. indexing empty aliases, depend
+// on the stats.
+func parseTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("line").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stdout template - %s", err)
+	}
+	err = tmpl.Execute(&bytes.Buffer{}, templateData{Stats: &info.ContainerStats{}})
+	if err != nil && strings.Contains(err.Error(), "can't evaluate field") {
+		return nil, fmt.Errorf("invalid stdout template - %s", err)
+	}
+	return tmpl, nil
+}
+
+// Prefix of the fields of the container reference, the others being
+// fields of the stats.
+const containerFieldPrefix = "container."
+
+// field is a value selected by a dotted path of JSON names, e.g.
+// cpu.usage.total or container.name.
+type field struct {
+	path      string
+	container bool
+	// Indexes of the struct fields along the path.
+	indexes [][]int
+}
+
+var (
+	containerType = reflect.TypeOf(info.ContainerReference{})
+	statsType     = reflect.TypeOf(info.ContainerStats{})
+)
+
+// parseFields parses a comma-separated list of fields.
+func parseFields(list string) ([]field, error) {
+	var fields []field
+	for _, path := range strings.Split(list, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		f := field{path: path}
+		t := statsType
+		rest := path
+		if strings.HasPrefix(path, containerFieldPrefix) {
+			f.container = true
+			t = containerType
+			rest = strings.TrimPrefix(path, containerFieldPrefix)
+		}
+		for _, name := range strings.Split(rest, ".") {
+			if t.Kind() != reflect.Struct {
+				return nil, fmt.Errorf("invalid stdout field %q: %q is not an object", path, name)
+			}
+			index := fieldIndex(t, name)
+			if index == nil {
+				return nil, fmt.Errorf("invalid stdout field %q: no field %q", path, name)
+			}
+			f.indexes = append(f.indexes, index)
+			t = t.FieldByIndex(index).Type
+		}
+		fields = append(fields, f)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no stdout field in %q", list)
+	}
+	return fields, nil
+}
+
+// fieldIndex returns the index of the field of t whose JSON name is name,
+// looking into the embedded structs, or nil if there is none.
+func fieldIndex(t reflect.Type, name string) []int {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		jsonName := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if sf.Anonymous && jsonName == "" && sf.Type.Kind() == reflect.Struct {
+			if index := fieldIndex(sf.Type, name); index != nil {
+				return append([]int{i}, index...)
+			}
+			continue
+		}
+		if jsonName == "" {
+			jsonName = sf.Name
+		}
+		if jsonName == name {
+			return []int{i}
+		}
+	}
+	return nil
+}
+
+func (self field) value(ref info.ContainerReference, stats *info.ContainerStats) interface{} {
+	v := reflect.ValueOf(stats).Elem()
+	if self.container {
+		v = reflect.ValueOf(ref)
+	}
+	for _, index := range self.indexes {
+		v = v.FieldByIndex(index)
+	}
+	return v.Interface()
+}
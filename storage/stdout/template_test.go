@@ -0,0 +1,84 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stdout
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func renderLine(t *testing.T, tmpl, fields string) string {
+	var out bytes.Buffer
+	driver, err := newStorage("localhost", formatText, tmpl, fields, &out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.AddStats(testRef, testStats(time.Unix(1464000000, 0))); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestTemplateLine(t *testing.T) {
+	for _, tc := range []struct {
+		template string
+		expected string
+	}{
+		{
+			template: "{{.Container.Name}} {{.Stats.Timestamp.Unix}} cpu={{.Stats.Cpu.Usage.Total}} ws={{.Stats.Memory.WorkingSet}}",
+			expected: "/docker/abc 1464000000 cpu=42 ws=1024\n",
+		},
+		{
+			template: "{{.Host}} {{index .Container.Aliases 0}} team={{.Container.Labels.team}}{{range .Stats.Filesystem}} {{.Device}}={{.Usage}}{{end}}\n",
+			expected: "localhost web team=infra sda1=500\n",
+		},
+	} {
+		if actual := renderLine(t, tc.template, ""); actual != tc.expected {
+			t.Errorf("template %q: expected %q, got %q", tc.template, tc.expected, actual)
+		}
+	}
+}
+
+func TestFieldsLine(t *testing.T) {
+	actual := renderLine(t, "", "cpu.usage.total, memory.working_set,network.rx_bytes,container.name,container.labels")
+	expected := "cName=web host=localhost cpu.usage.total=42 memory.working_set=1024 network.rx_bytes=7 container.name=/docker/abc container.labels=map[team:infra]\n"
+	if actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestInvalidTemplateOrFields(t *testing.T) {
+	for _, tc := range []struct {
+		format   string
+		template string
+		fields   string
+	}{
+		// Parse errors.
+		{formatText, "{{.Container.Name", ""},
+		// Fields which do not exist fail at startup too.
+		{formatText, "{{.Stats.Cpu.Usage.Totl}}", ""},
+		{formatText, "", "cpu.usage.totl"},
+		{formatText, "", "cpu.usage.total.x"},
+		{formatText, "", "filesystem.usage"},
+		{formatText, "", " , "},
+		{formatText, "{{.Host}}", "cpu.usage.total"},
+		{formatJSON, "", "cpu.usage.total"},
+	} {
+		if _, err := newStorage("localhost", tc.format, tc.template, tc.fields, &bytes.Buffer{}, nil); err == nil {
+			t.Errorf("expected an error for format %q, template %q and fields %q", tc.format, tc.template, tc.fields)
+		}
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"sort"
 
 	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/info/v2"
 )
 
 type StorageDriver interface {
@@ -30,6 +31,88 @@ type StorageDriver interface {
 	Close() error
 }
 
+// MachineInfoSource provides the information about the machine cAdvisor runs
+// on, e.g. the container manager.
+type MachineInfoSource interface {
+	GetMachineInfo() (*info.MachineInfo, error)
+	GetVersionInfo() (*info.VersionInfo, error)
+	// GetFsInfo returns the filesystems with the given label, all of them
+	// if the label is empty.
+	GetFsInfo(label string) ([]v2.FsInfo, error)
+}
+
+// MachineInfoConsumer is implemented by the storage drivers which store
+// information about the machine along with the stats of its containers.
+type MachineInfoConsumer interface {
+	// SetMachineInfoSource is called once the source is available, after
+	// the driver is created.
+	SetMachineInfoSource(source MachineInfoSource)
+}
+
+// ContainerSpecSource provides the specification of the containers, e.g.
+// the container manager.
+type ContainerSpecSource interface {
+	GetContainerSpec(containerName string, options v2.RequestOptions) (map[string]v2.ContainerSpec, error)
+}
+
+// ContainerSpecConsumer is implemented by the storage drivers which store
+// parts of the container specifications, e.g. their image, along with their
+// stats.
+type ContainerSpecConsumer interface {
+	// SetContainerSpecSource is called once the source is available,
+	// after the driver is created.
+	SetContainerSpecSource(source ContainerSpecSource)
+}
+
+// ContainerStatsPair is the stats of a container.
+type ContainerStatsPair struct {
+	Ref   info.ContainerReference
+	Stats *info.ContainerStats
+}
+
+// BulkStorageDriver is a StorageDriver which adds the stats of several
+// containers at once, e.g. in a single request, instead of one at a time.
+// The stats of a housekeeping cycle are then collected, and added in a
+// batch.
+type BulkStorageDriver interface {
+	StorageDriver
+	AddStatsBatch(batch []ContainerStatsPair) error
+}
+
+// AddStatsBatch adds a batch of stats to a driver, at once if it is a
+// BulkStorageDriver, and one at a time otherwise. It adds all the stats
+// even if some of them fail, and returns the first error with the count
+// of the failures.
+func AddStatsBatch(driver StorageDriver, batch []ContainerStatsPair) error {
+	_, err := addStatsBatch(driver, batch)
+	return err
+}
+
+// addStatsBatch is AddStatsBatch, also returning the count of the stats which
+// failed to be added: the whole batch if a BulkStorageDriver fails.
+func addStatsBatch(driver StorageDriver, batch []ContainerStatsPair) (int, error) {
+	if bulk, ok := driver.(BulkStorageDriver); ok {
+		if err := bulk.AddStatsBatch(batch); err != nil {
+			return len(batch), err
+		}
+		return 0, nil
+	}
+	var firstErr error
+	failed := 0
+	for _, pair := range batch {
+		if err := driver.AddStats(pair.Ref, pair.Stats); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed++
+		}
+	}
+	if failed > 1 {
+		return failed, fmt.Errorf("%d of %d stats failed to be added, first error: %v", failed, len(batch), firstErr)
+	}
+	return failed, firstErr
+}
+
 type StorageDriverFunc func() (StorageDriver, error)
 
 var registeredPlugins = map[string](StorageDriverFunc){}
@@ -0,0 +1,48 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wavefront
+
+import (
+	"time"
+
+	"github.com/google/cadvisor/storage"
+)
+
+// counterDeltas returns the points of a container with the values of its
+// counters replaced by their increase since the previous stats of the
+// container. The counters without a delta, see storage.CounterTracker, are
+// left out, as well as the ones which did not increase: Wavefront adds up
+// the deltas, which must be positive.
+func counterDeltas(tracker *storage.CounterTracker, containerName string, timestamp time.Time, points []point) []point {
+	counters := make(map[string]uint64)
+	for _, p := range points {
+		if p.counter {
+			counters[p.seriesKey()] = p.value
+		}
+	}
+	deltas, _ := tracker.Deltas(containerName, timestamp, counters)
+	ret := make([]point, 0, len(points))
+	for _, p := range points {
+		if p.counter {
+			delta := deltas[p.seriesKey()]
+			if delta == 0 {
+				continue
+			}
+			p.value = delta
+		}
+		ret = append(ret, p)
+	}
+	return ret
+}
@@ -0,0 +1,74 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wavefront
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/storage"
+)
+
+func samplePoints(total, usage uint64) []point {
+	return []point{
+		{name: "cpu.usage.total", value: total, counter: true},
+		{name: "memory.usage", value: usage},
+		{name: "network.rx_bytes", value: total * 2, counter: true, tags: []tag{{"interface", "eth0"}}},
+	}
+}
+
+func TestCounterDeltas(t *testing.T) {
+	tracker := storage.NewCounterTracker()
+	start := time.Unix(1464000000, 0)
+	for i, tc := range []struct {
+		total    uint64
+		usage    uint64
+		expected []point
+	}{
+		// The first sample has no delta.
+		{100, 10, []point{{name: "memory.usage", value: 10}}},
+		{150, 20, []point{
+			{name: "cpu.usage.total", value: 50, counter: true},
+			{name: "memory.usage", value: 20},
+			{name: "network.rx_bytes", value: 100, counter: true, tags: []tag{{"interface", "eth0"}}},
+		}},
+		// The container restarted, its counters were reset.
+		{30, 5, []point{{name: "memory.usage", value: 5}}},
+		// The deltas are computed from the counters after the restart.
+		{45, 6, []point{
+			{name: "cpu.usage.total", value: 15, counter: true},
+			{name: "memory.usage", value: 6},
+			{name: "network.rx_bytes", value: 30, counter: true, tags: []tag{{"interface", "eth0"}}},
+		}},
+	} {
+		actual := counterDeltas(tracker, "/docker/abc", start.Add(time.Duration(i)*time.Second), samplePoints(tc.total, tc.usage))
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("sample %d: expected %+v, got %+v", i, tc.expected, actual)
+		}
+	}
+}
+
+func TestCounterDeltasOutOfOrder(t *testing.T) {
+	tracker := storage.NewCounterTracker()
+	now := time.Unix(1464000000, 0)
+	counterDeltas(tracker, "/a", now, samplePoints(100, 1))
+	if actual := counterDeltas(tracker, "/a", now.Add(-time.Second), samplePoints(90, 1)); len(actual) != 1 {
+		t.Errorf("expected only the gauge of stats older than the previous ones, got %+v", actual)
+	}
+	if actual := counterDeltas(tracker, "/a", now.Add(time.Second), samplePoints(110, 1)); len(actual) != 3 || actual[0].value != 10 {
+		t.Errorf("expected a delta of 10 from the newest stats, got %+v", actual)
+	}
+}
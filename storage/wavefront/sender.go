@@ -0,0 +1,294 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wavefront
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// Backoff before sending again after an error, doubled after every
+	// consecutive error up to maxBackoff.
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 30 * time.Second
+	// Minimum time between the logs of the send errors.
+	errorLogInterval = time.Minute
+
+	dialTimeout  = 5 * time.Second
+	writeTimeout = 10 * time.Second
+)
+
+// transport sends payloads of lines to Wavefront.
+type transport interface {
+	send(payload []byte) error
+	close() error
+}
+
+// proxyTransport sends the lines to a Wavefront proxy over TCP, opening
+// the connection with the first payload, and again after an error.
+type proxyTransport struct {
+	hostPort string
+	conn     net.Conn
+}
+
+func (self *proxyTransport) send(payload []byte) error {
+	if self.conn == nil {
+		conn, err := net.DialTimeout("tcp", self.hostPort, dialTimeout)
+		if err != nil {
+			return err
+		}
+		self.conn = conn
+	}
+	self.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if _, err := self.conn.Write(payload); err != nil {
+		self.close()
+		return err
+	}
+	return nil
+}
+
+func (self *proxyTransport) close() error {
+	if self.conn == nil {
+		return nil
+	}
+	err := self.conn.Close()
+	self.conn = nil
+	return err
+}
+
+func (self *proxyTransport) String() string {
+	return "proxy " + self.hostPort
+}
+
+// directTransport sends the lines to the direct ingestion API of a
+// Wavefront cluster, authenticating with an API token.
+type directTransport struct {
+	client *http.Client
+	// URL of the cluster, e.g. https://example.wavefront.com.
+	url   string
+	token string
+}
+
+func (self *directTransport) send(payload []byte) error {
+	req, err := http.NewRequest("POST", self.url+"/report?f=wavefront", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Authorization", "Bearer "+self.token)
+	resp, err := self.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Wavefront returned %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	return nil
+}
+
+func (self *directTransport) close() error {
+	return nil
+}
+
+func (self *directTransport) String() string {
+	return self.url
+}
+
+// sender buffers lines, and sends them in batches every flush interval, or
+// as soon as a batch is buffered. After an error, the lines are sent again
+// with an exponential backoff, and are kept meanwhile up to maxPending of
+// them, the oldest being dropped beyond.
+type sender struct {
+	transport  transport
+	batchSize  int
+	maxPending int
+
+	lock    sync.Mutex
+	pending []string
+
+	// Used by the sending goroutine only: consecutive errors, and time
+	// before which no line is sent.
+	failures  int
+	nextRetry time.Time
+
+	// Counts of the lines sent, and dropped because too many were kept.
+	sent    uint64
+	dropped uint64
+	// Counts when the errors were last logged, and the last error.
+	logLock    sync.Mutex
+	lastLog    time.Time
+	lastErr    error
+	loggedDrop uint64
+
+	flush chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func newSender(transport transport, batchSize, maxPending int, flushInterval time.Duration) *sender {
+	self := &sender{
+		transport:  transport,
+		batchSize:  batchSize,
+		maxPending: maxPending,
+		flush:      make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go self.run(flushInterval)
+	return self
+}
+
+// write buffers lines, each ending with a newline.
+func (self *sender) write(lines []string) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.pending = append(self.pending, lines...)
+	self.trim()
+	if len(self.pending) >= self.batchSize {
+		select {
+		case self.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// trim drops the oldest lines beyond maxPending. Lock must be held.
+func (self *sender) trim() {
+	if extra := len(self.pending) - self.maxPending; extra > 0 {
+		self.pending = append(self.pending[:0:0], self.pending[extra:]...)
+		atomic.AddUint64(&self.dropped, uint64(extra))
+	}
+}
+
+// run sends the buffered lines every flush interval, or as soon as a batch
+// is buffered, until stopped. After an error, they are sent again once the
+// backoff elapsed.
+func (self *sender) run(flushInterval time.Duration) {
+	defer close(self.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	retry := time.NewTimer(flushInterval)
+	retry.Stop()
+	defer retry.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-self.flush:
+		case <-retry.C:
+		case <-self.stop:
+			// Sends once more even if the backoff has not elapsed.
+			self.nextRetry = time.Time{}
+			self.send()
+			return
+		}
+		if self.send() {
+			retry.Stop()
+			retry = time.NewTimer(time.Until(self.nextRetry))
+		}
+	}
+}
+
+// send sends the buffered lines in batches, unless backing off after an
+// error. The lines which could not be sent are buffered again, and true is
+// returned if the send failed.
+func (self *sender) send() bool {
+	if time.Now().Before(self.nextRetry) {
+		return false
+	}
+	self.lock.Lock()
+	lines := self.pending
+	self.pending = nil
+	self.lock.Unlock()
+	for len(lines) > 0 {
+		n := len(lines)
+		if n > self.batchSize {
+			n = self.batchSize
+		}
+		if err := self.transport.send([]byte(strings.Join(lines[:n], ""))); err != nil {
+			self.lock.Lock()
+			self.pending = append(lines, self.pending...)
+			self.trim()
+			self.lock.Unlock()
+			self.failed(err)
+			return true
+		}
+		atomic.AddUint64(&self.sent, uint64(n))
+		lines = lines[n:]
+		self.failures = 0
+	}
+	self.logErrors(false)
+	return false
+}
+
+// failed backs off after an error.
+func (self *sender) failed(err error) {
+	backoff := minBackoff << uint(self.failures)
+	if backoff > maxBackoff || backoff <= 0 {
+		backoff = maxBackoff
+	}
+	self.failures++
+	self.nextRetry = time.Now().Add(backoff)
+	self.logLock.Lock()
+	self.lastErr = fmt.Errorf("failed to send to Wavefront %v, retrying in %s - %v", self.transport, backoff, err)
+	self.logLock.Unlock()
+	self.logErrors(false)
+}
+
+// logErrors logs the last send error and the count of the lines dropped
+// since the last log, at most every errorLogInterval unless forced.
+func (self *sender) logErrors(force bool) {
+	self.logLock.Lock()
+	defer self.logLock.Unlock()
+	if !force && time.Since(self.lastLog) < errorLogInterval {
+		return
+	}
+	dropped := atomic.LoadUint64(&self.dropped)
+	if self.lastErr == nil && dropped == self.loggedDrop {
+		return
+	}
+	glog.Errorf("Wavefront: %d lines were dropped because %d were kept, last error: %v", dropped-self.loggedDrop, self.maxPending, self.lastErr)
+	self.lastLog = time.Now()
+	self.lastErr = nil
+	self.loggedDrop = dropped
+}
+
+// close sends the buffered lines, and closes the transport.
+func (self *sender) close() error {
+	close(self.stop)
+	<-self.done
+	self.logErrors(true)
+	self.transport.close()
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if n := len(self.pending); n > 0 {
+		return fmt.Errorf("Wavefront: %d lines were not sent", n)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wavefront
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeProxy accepts connections, and reads the lines sent on them.
+type fakeProxy struct {
+	listener net.Listener
+	lock     sync.Mutex
+	lines    []string
+	conns    []net.Conn
+}
+
+func newFakeProxy(t *testing.T, address string) *fakeProxy {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := &fakeProxy{listener: listener}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			self.lock.Lock()
+			self.conns = append(self.conns, conn)
+			self.lock.Unlock()
+			go func() {
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					self.lock.Lock()
+					self.lines = append(self.lines, scanner.Text())
+					self.lock.Unlock()
+				}
+			}()
+		}
+	}()
+	return self
+}
+
+func (self *fakeProxy) received() []string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return append([]string(nil), self.lines...)
+}
+
+// close stops listening, and closes the connections.
+func (self *fakeProxy) close() {
+	self.listener.Close()
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, conn := range self.conns {
+		conn.Close()
+	}
+}
+
+// stopWithoutSending stops the sending goroutine, dropping the buffered
+// lines.
+func (self *sender) stopWithoutSending() {
+	self.lock.Lock()
+	self.pending = nil
+	self.lock.Unlock()
+	self.close()
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	for start := time.Now(); !condition(); time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("timed out")
+		}
+	}
+}
+
+func TestProxyReconnects(t *testing.T) {
+	proxy := newFakeProxy(t, "127.0.0.1:0")
+	address := proxy.listener.Addr().String()
+	s := newSender(&proxyTransport{hostPort: address}, 1, 100, time.Hour)
+	s.write([]string{"a 1 source=h\n"})
+	waitFor(t, func() bool { return len(proxy.received()) == 1 })
+
+	// The proxy restarts, the lines are kept until it is back.
+	proxy.close()
+	for i := 0; i < 10; i++ {
+		s.write([]string{"b 2 source=h\n"})
+		time.Sleep(10 * time.Millisecond)
+	}
+	proxy = newFakeProxy(t, address)
+	defer proxy.close()
+	s.write([]string{"c 3 source=h\n"})
+	waitFor(t, func() bool {
+		lines := proxy.received()
+		return len(lines) > 0 && lines[len(lines)-1] == "c 3 source=h"
+	})
+	if err := s.close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDirectIngestion(t *testing.T) {
+	var lock sync.Mutex
+	var bodies []string
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if r.URL.Path != "/report" || r.URL.Query().Get("f") != "wavefront" || r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		if failures > 0 {
+			failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	cfg := testConfig("")
+	cfg.endpoint = server.URL + "/"
+	cfg.token = "token"
+	cfg.batchSize = 1000
+	cfg.maxPending = 10000
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	driver.AddStats(testRef, testStats(testTime, 100))
+	// The first send fails, the lines are sent again on close.
+	driver.sender.flush <- struct{}{}
+	waitFor(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return failures == 0
+	})
+	if err := driver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 1 || !strings.HasPrefix(bodies[0], `"cadvisor.cpu.usage.total" 100 1451606400 source="host-1"`) {
+		t.Errorf("unexpected bodies %q", bodies)
+	}
+}
+
+// failingTransport fails every send.
+type failingTransport struct{}
+
+func (failingTransport) send([]byte) error { return net.UnknownNetworkError("down") }
+func (failingTransport) close() error      { return nil }
+
+func TestMaxPending(t *testing.T) {
+	s := newSender(failingTransport{}, 2, 3, time.Hour)
+	s.write([]string{"a\n", "b\n"})
+	waitFor(t, func() bool {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		return len(s.pending) == 2 && len(s.flush) == 0
+	})
+	s.write([]string{"c\n", "d\n"})
+	s.lock.Lock()
+	pending := strings.Join(s.pending, "")
+	s.lock.Unlock()
+	if dropped := atomic.LoadUint64(&s.dropped); pending != "b\nc\nd\n" || dropped != 1 {
+		t.Errorf("expected the oldest line dropped, got %q and %d dropped", pending, dropped)
+	}
+	if err := s.close(); err == nil {
+		t.Error("expected an error for the lines not sent")
+	}
+}
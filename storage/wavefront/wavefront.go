@@ -0,0 +1,344 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wavefront
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+	"github.com/google/cadvisor/storage"
+	"github.com/google/cadvisor/utils/container"
+)
+
+func init() {
+	storage.RegisterStorageDriver("wavefront", new)
+}
+
+var (
+	argProxy         = flag.String("storage_driver_wavefront_proxy", "", "host:port of the Wavefront proxy the points are sent to, e.g. localhost:2878")
+	argURL           = flag.String("storage_driver_wavefront_url", "", "URL of the Wavefront cluster the points are sent to directly instead of a proxy, e.g. https://example.wavefront.com")
+	argToken         = flag.String("storage_driver_wavefront_token", "", "API token of the direct ingestion")
+	argPrefix        = flag.String("storage_driver_wavefront_prefix", "cadvisor", "prefix of the metric names")
+	argSource        = flag.String("storage_driver_wavefront_source", "", "source of the points; default is the hostname")
+	argLabels        = flag.String("storage_driver_wavefront_labels", "", "comma separated container labels added as label.<name> point tags")
+	argDeltaCounters = flag.Bool("storage_driver_wavefront_delta_counters", false, "send the cumulative counters as delta counters, their increase since the previous stats with a ∆ prefix, instead of their cumulative values")
+	argBatchSize     = flag.Int("storage_driver_wavefront_batch_size", 10000, "maximum number of lines sent at once, sent as soon as they are buffered")
+	argMaxPending    = flag.Int("storage_driver_wavefront_max_pending", 100000, "maximum number of lines kept while Wavefront can not be reached, the oldest being dropped beyond")
+	argFlushInterval = flag.Duration("storage_driver_wavefront_flush_interval", 5*time.Second, "interval of the sends of the buffered lines")
+	argTimeout       = flag.Duration("storage_driver_wavefront_timeout", 30*time.Second, "timeout of the requests of the direct ingestion")
+)
+
+// deltaPrefix marks the names of delta counters.
+const deltaPrefix = "∆"
+
+// Maximum length of a point tag, its key and its value.
+const maxTagLength = 254
+
+type tag struct {
+	key   string
+	value string
+}
+
+// point is a point of a metric of a container.
+type point struct {
+	name  string
+	value uint64
+	// Whether the value is a cumulative counter.
+	counter bool
+	tags    []tag
+}
+
+// seriesKey identifies the series of a point of a container.
+func (self *point) seriesKey() string {
+	key := self.name
+	for _, t := range self.tags {
+		key += "\x00" + t.key + "=" + t.value
+	}
+	return key
+}
+
+type wavefrontStorage struct {
+	sender *sender
+	prefix string
+	source string
+	// Container labels added as point tags.
+	labels []string
+	// Tracks the counters if they are sent as delta counters.
+	counters *storage.CounterTracker
+}
+
+func new() (storage.StorageDriver, error) {
+	source := *argSource
+	if source == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		source = hostname
+	}
+	var labels []string
+	for _, label := range strings.Split(*argLabels, ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	return newStorage(config{
+		source:        source,
+		proxy:         *argProxy,
+		endpoint:      *argURL,
+		token:         *argToken,
+		prefix:        *argPrefix,
+		labels:        labels,
+		deltaCounters: *argDeltaCounters,
+		batchSize:     *argBatchSize,
+		maxPending:    *argMaxPending,
+		flushInterval: *argFlushInterval,
+		timeout:       *argTimeout,
+	})
+}
+
+// points returns the points of the stats of a container, without their
+// container tags.
+func points(stats *info.ContainerStats) []point {
+	var ret []point
+	add := func(name string, value uint64, counter bool, tags ...tag) {
+		ret = append(ret, point{name: name, value: value, counter: counter, tags: tags})
+	}
+
+	add("cpu.usage.total", stats.Cpu.Usage.Total, true)
+	add("cpu.usage.user", stats.Cpu.Usage.User, true)
+	add("cpu.usage.system", stats.Cpu.Usage.System, true)
+	add("cpu.load_average", uint64(stats.Cpu.LoadAverage), false)
+
+	add("memory.usage", stats.Memory.Usage, false)
+	add("memory.working_set", stats.Memory.WorkingSet, false)
+	add("memory.cache", stats.Memory.Cache, false)
+	add("memory.rss", stats.Memory.RSS, false)
+	add("memory.swap", stats.Memory.Swap, false)
+	add("memory.failcnt", stats.Memory.Failcnt, true)
+
+	interfaces := stats.Network.Interfaces
+	if len(interfaces) == 0 && stats.Network.Name != "" {
+		interfaces = []info.InterfaceStats{stats.Network.InterfaceStats}
+	}
+	for _, iface := range interfaces {
+		t := tag{"interface", iface.Name}
+		add("network.rx_bytes", iface.RxBytes, true, t)
+		add("network.rx_packets", iface.RxPackets, true, t)
+		add("network.rx_errors", iface.RxErrors, true, t)
+		add("network.rx_dropped", iface.RxDropped, true, t)
+		add("network.tx_bytes", iface.TxBytes, true, t)
+		add("network.tx_packets", iface.TxPackets, true, t)
+		add("network.tx_errors", iface.TxErrors, true, t)
+		add("network.tx_dropped", iface.TxDropped, true, t)
+	}
+
+	for _, fs := range stats.Filesystem {
+		t := tag{"device", fs.Device}
+		add("fs.usage", fs.Usage, false, t)
+		add("fs.limit", fs.Limit, false, t)
+		add("fs.reads_completed", fs.ReadsCompleted, true, t)
+		add("fs.writes_completed", fs.WritesCompleted, true, t)
+	}
+
+	for _, disk := range stats.DiskIo.IoServiceBytes {
+		t := tag{"device", fmt.Sprintf("%d:%d", disk.Major, disk.Minor)}
+		if disk.Device != "" {
+			t.value = disk.Device
+		}
+		add("diskio.read_bytes", disk.Stats["Read"], true, t)
+		add("diskio.write_bytes", disk.Stats["Write"], true, t)
+	}
+	return ret
+}
+
+// containerTags returns the tags identifying a container.
+func (self *wavefrontStorage) containerTags(ref info.ContainerReference) []tag {
+	tags := []tag{{"container_name", container.GetPreferredName(ref)}}
+	if ref.Id != "" {
+		tags = append(tags, tag{"container_id", ref.Id})
+	}
+	if ref.Namespace != "" {
+		tags = append(tags, tag{"namespace", ref.Namespace})
+	}
+	for _, label := range self.labels {
+		if value, ok := ref.Labels[label]; ok {
+			tags = append(tags, tag{"label." + label, value})
+		}
+	}
+	return tags
+}
+
+// lines returns the lines of the points of the stats of a container, e.g.
+// "cadvisor.memory.usage" 4096 1451606400 source="host" "container_name"="web".
+// Delta counters have no timestamp, Wavefront aggregates them by minute.
+func (self *wavefrontStorage) lines(ref info.ContainerReference, stats *info.ContainerStats) []string {
+	ps := points(stats)
+	if self.counters != nil {
+		ps = counterDeltas(self.counters, ref.Name, stats.Timestamp, ps)
+	}
+	var b bytes.Buffer
+	for _, t := range self.containerTags(ref) {
+		writeTag(&b, t)
+	}
+	containerTags := b.String()
+	source := " source=" + quote(self.source)
+	timestamp := " " + strconv.FormatInt(stats.Timestamp.Unix(), 10)
+
+	ret := make([]string, 0, len(ps))
+	for _, p := range ps {
+		b.Reset()
+		name := sanitize(self.prefix + "." + p.name)
+		if p.counter && self.counters != nil {
+			name = deltaPrefix + name
+		}
+		b.WriteString(quote(name))
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatUint(p.value, 10))
+		if !p.counter || self.counters == nil {
+			b.WriteString(timestamp)
+		}
+		b.WriteString(source)
+		b.WriteString(containerTags)
+		for _, t := range p.tags {
+			writeTag(&b, t)
+		}
+		b.WriteByte('\n')
+		ret = append(ret, b.String())
+	}
+	return ret
+}
+
+// sanitize replaces the characters not allowed in metric names and tag
+// keys with hyphens, as the Wavefront SDKs do.
+func sanitize(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return '-'
+	}, name)
+}
+
+// Escapes the double quotes and the newlines of quoted strings.
+var quoteReplacer = strings.NewReplacer(`"`, `\"`, "\n", `\n`)
+
+func quote(s string) string {
+	return `"` + quoteReplacer.Replace(s) + `"`
+}
+
+// writeTag writes a point tag, its value truncated so that the tag is at
+// most maxTagLength long. Tags with an empty value, which Wavefront
+// rejects, are left out.
+func writeTag(b *bytes.Buffer, t tag) {
+	if t.value == "" {
+		return
+	}
+	key := sanitize(t.key)
+	value := t.value
+	if max := maxTagLength - len(key); len(value) > max && max > 0 {
+		value = value[:max]
+	}
+	b.WriteByte(' ')
+	b.WriteString(quote(key))
+	b.WriteByte('=')
+	b.WriteString(quote(value))
+}
+
+func (self *wavefrontStorage) AddStats(ref info.ContainerReference, stats *info.ContainerStats) error {
+	if stats == nil {
+		return nil
+	}
+	self.sender.write(self.lines(ref, stats))
+	return nil
+}
+
+func (self *wavefrontStorage) Close() error {
+	// Sends the buffered lines.
+	return self.sender.close()
+}
+
+// config is the configuration of the driver, populated from the flags.
+type config struct {
+	// The source of the points, the host that runs the current cAdvisor.
+	source string
+	// The host:port of the Wavefront proxy, if the points are sent to one.
+	proxy string
+	// The URL of the Wavefront cluster and the API token, if the points are
+	// sent to it directly.
+	endpoint string
+	token    string
+	// The prefix of the metric names.
+	prefix string
+	// The container labels added as point tags.
+	labels []string
+	// Whether the counters are sent as delta counters.
+	deltaCounters bool
+	// The maximum number of lines sent at once.
+	batchSize int
+	// The maximum number of lines kept while Wavefront can not be reached.
+	maxPending int
+	// The interval of the sends of the buffered lines.
+	flushInterval time.Duration
+	// The timeout of the requests of the direct ingestion.
+	timeout time.Duration
+}
+
+// Create a new Wavefront storage driver.
+func newStorage(cfg config) (*wavefrontStorage, error) {
+	if cfg.batchSize <= 0 || cfg.maxPending < cfg.batchSize || cfg.flushInterval <= 0 {
+		return nil, fmt.Errorf("the Wavefront batch size and flush interval must be positive, and the maximum pending lines at least the batch size")
+	}
+	var t transport
+	switch {
+	case cfg.proxy != "" && cfg.endpoint != "":
+		return nil, fmt.Errorf("either a Wavefront proxy or a Wavefront URL must be set, not both")
+	case cfg.proxy != "":
+		t = &proxyTransport{hostPort: cfg.proxy}
+	case cfg.endpoint != "":
+		if u, err := url.Parse(cfg.endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("invalid Wavefront URL %q, must be http or https", cfg.endpoint)
+		}
+		if cfg.token == "" {
+			return nil, fmt.Errorf("the API token of the Wavefront direct ingestion is required, set -storage_driver_wavefront_token")
+		}
+		t = &directTransport{
+			client: &http.Client{Timeout: cfg.timeout},
+			url:    strings.TrimSuffix(cfg.endpoint, "/"),
+			token:  cfg.token,
+		}
+	default:
+		return nil, fmt.Errorf("a Wavefront proxy or URL is required, set -storage_driver_wavefront_proxy or -storage_driver_wavefront_url")
+	}
+	ret := &wavefrontStorage{
+		sender: newSender(t, cfg.batchSize, cfg.maxPending, cfg.flushInterval),
+		prefix: cfg.prefix,
+		source: cfg.source,
+		labels: cfg.labels,
+	}
+	if cfg.deltaCounters {
+		ret.counters = storage.NewCounterTracker()
+	}
+	return ret, nil
+}
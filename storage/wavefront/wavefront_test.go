@@ -0,0 +1,167 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wavefront
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	info "github.com/google/cadvisor/info/v1"
+)
+
+var (
+	testRef = info.ContainerReference{
+		Name:      "/docker/abc",
+		Id:        "abc",
+		Aliases:   []string{"web", "abc"},
+		Namespace: "docker",
+		Labels:    map[string]string{"app": `say "hi"`, "tier": "front"},
+	}
+	testTime = time.Unix(1451606400, 0)
+)
+
+func testStats(timestamp time.Time, total uint64) *info.ContainerStats {
+	return &info.ContainerStats{
+		Timestamp: timestamp,
+		Cpu:       info.CpuStats{Usage: info.CpuUsage{Total: total, User: total / 2, System: total / 2}},
+		Memory:    info.MemoryStats{Usage: 4096, WorkingSet: 2048},
+		Network: info.NetworkStats{Interfaces: []info.InterfaceStats{
+			{Name: "eth0", RxBytes: total * 10, TxBytes: 20},
+		}},
+		Filesystem: []info.FsStats{{Device: "/dev/sda1", Usage: 1, Limit: 10}},
+		DiskIo: info.DiskIoStats{IoServiceBytes: []info.PerDiskStats{
+			{Major: 8, Stats: map[string]uint64{"Read": 5, "Write": 7}},
+		}},
+	}
+}
+
+// testConfig returns the configuration of a driver sending to proxy.
+func testConfig(proxy string) config {
+	return config{
+		source:        "host-1",
+		proxy:         proxy,
+		prefix:        "cadvisor",
+		labels:        []string{"app", "missing"},
+		batchSize:     100,
+		maxPending:    1000,
+		flushInterval: time.Hour,
+		timeout:       time.Second,
+	}
+}
+
+func newTestStorage(t *testing.T, proxy string, deltaCounters bool) *wavefrontStorage {
+	cfg := testConfig(proxy)
+	cfg.deltaCounters = deltaCounters
+	driver, err := newStorage(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return driver
+}
+
+func TestLines(t *testing.T) {
+	driver := newTestStorage(t, "localhost:2878", false)
+	defer driver.sender.stopWithoutSending()
+	lines := driver.lines(testRef, testStats(testTime, 100))
+	tags := ` source="host-1" "container_name"="web" "container_id"="abc" "namespace"="docker" "label.app"="say \"hi\""`
+	for _, expected := range []string{
+		`"cadvisor.cpu.usage.total" 100 1451606400` + tags + "\n",
+		`"cadvisor.memory.usage" 4096 1451606400` + tags + "\n",
+		`"cadvisor.network.rx_bytes" 1000 1451606400` + tags + ` "interface"="eth0"` + "\n",
+		`"cadvisor.fs.usage" 1 1451606400` + tags + ` "device"="/dev/sda1"` + "\n",
+		`"cadvisor.diskio.read_bytes" 5 1451606400` + tags + ` "device"="8:0"` + "\n",
+	} {
+		found := false
+		for _, line := range lines {
+			found = found || line == expected
+		}
+		if !found {
+			t.Errorf("expected the line %q in:\n%s", expected, strings.Join(lines, ""))
+		}
+	}
+}
+
+func TestDeltaCounters(t *testing.T) {
+	driver := newTestStorage(t, "localhost:2878", true)
+	defer driver.sender.stopWithoutSending()
+	// The counters are left out of the first stats.
+	for _, line := range driver.lines(testRef, testStats(testTime, 100)) {
+		if strings.Contains(line, "cpu.usage") || strings.HasPrefix(line, `"`+deltaPrefix) {
+			t.Errorf("unexpected counter %q in the first stats", line)
+		}
+	}
+	lines := driver.lines(testRef, testStats(testTime.Add(time.Second), 150))
+	tags := ` source="host-1" "container_name"="web" "container_id"="abc" "namespace"="docker" "label.app"="say \"hi\""`
+	for _, expected := range []string{
+		// Delta counters have no timestamp.
+		`"∆cadvisor.cpu.usage.total" 50` + tags + "\n",
+		`"∆cadvisor.network.rx_bytes" 500` + tags + ` "interface"="eth0"` + "\n",
+		`"cadvisor.memory.usage" 4096 1451606401` + tags + "\n",
+	} {
+		found := false
+		for _, line := range lines {
+			found = found || line == expected
+		}
+		if !found {
+			t.Errorf("expected the line %q in:\n%s", expected, strings.Join(lines, ""))
+		}
+	}
+	// Counters which did not increase are left out.
+	for _, line := range lines {
+		if strings.Contains(line, "tx_bytes") || strings.Contains(line, "diskio") {
+			t.Errorf("unexpected counter which did not increase %q", line)
+		}
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	if got := sanitize("cadvisor.memory usage/bytes,∆"); got != "cadvisor.memory-usage-bytes--" {
+		t.Errorf("unexpected sanitized name %q", got)
+	}
+	if got := quote("a \"b\"\nc"); got != `"a \"b\"\nc"` {
+		t.Errorf("unexpected quoted string %s", got)
+	}
+	var b bytes.Buffer
+	writeTag(&b, tag{"label.io.k8s/pod name", strings.Repeat("x", 300)})
+	writeTag(&b, tag{"empty", ""})
+	got := b.String()
+	key := "label.io.k8s-pod-name"
+	if expected := ` "` + key + `"="` + strings.Repeat("x", maxTagLength-len(key)) + `"`; got != expected {
+		t.Errorf("expected the tag %s, got %s", expected, got)
+	}
+}
+
+func TestNewStorageValidation(t *testing.T) {
+	for _, test := range []struct {
+		proxy, url, token string
+		batchSize         int
+	}{
+		{"", "", "", 10},
+		{"localhost:2878", "https://example.wavefront.com", "token", 10},
+		{"", "example.wavefront.com", "token", 10},
+		{"", "https://example.wavefront.com", "", 10},
+		{"localhost:2878", "", "", 0},
+	} {
+		cfg := testConfig(test.proxy)
+		cfg.endpoint = test.url
+		cfg.token = test.token
+		cfg.batchSize = test.batchSize
+		if _, err := newStorage(cfg); err == nil {
+			t.Errorf("expected an error for %+v", test)
+		}
+	}
+}
@@ -21,32 +21,53 @@ import (
 	"time"
 
 	"github.com/google/cadvisor/cache/memory"
+	"github.com/google/cadvisor/manager"
 	"github.com/google/cadvisor/storage"
+	_ "github.com/google/cadvisor/storage/amqp"
+	_ "github.com/google/cadvisor/storage/azuremonitor"
 	_ "github.com/google/cadvisor/storage/bigquery"
+	_ "github.com/google/cadvisor/storage/clickhouse"
+	_ "github.com/google/cadvisor/storage/cloudwatch"
 	_ "github.com/google/cadvisor/storage/elasticsearch"
+	_ "github.com/google/cadvisor/storage/fluentd"
+	_ "github.com/google/cadvisor/storage/graphite"
 	_ "github.com/google/cadvisor/storage/influxdb"
 	_ "github.com/google/cadvisor/storage/kafka"
+	_ "github.com/google/cadvisor/storage/mqtt"
+	_ "github.com/google/cadvisor/storage/nats"
+	_ "github.com/google/cadvisor/storage/opentsdb"
+	_ "github.com/google/cadvisor/storage/otlp"
+	_ "github.com/google/cadvisor/storage/postgres"
+	_ "github.com/google/cadvisor/storage/pubsub"
 	_ "github.com/google/cadvisor/storage/redis"
+	_ "github.com/google/cadvisor/storage/remotewrite"
+	_ "github.com/google/cadvisor/storage/splunk"
+	_ "github.com/google/cadvisor/storage/sqlite"
 	_ "github.com/google/cadvisor/storage/statsd"
 	_ "github.com/google/cadvisor/storage/stdout"
+	_ "github.com/google/cadvisor/storage/wavefront"
 
 	"github.com/golang/glog"
 )
 
 var (
-	storageDriver   = flag.String("storage_driver", "", fmt.Sprintf("Storage `driver` to use. Data is always cached shortly in memory, this controls where data is pushed besides the local cache. Empty means none. Options are: <empty>, %s", strings.Join(storage.ListDrivers(), ", ")))
+	storageDriver   = flag.String("storage_driver", "", fmt.Sprintf("Storage `driver` to use, or a comma-separated list of them to push data to all of them. Data is always cached shortly in memory, this controls where data is pushed besides the local cache. Empty means none. Options are: <empty>, %s", strings.Join(storage.ListDrivers(), ", ")))
 	storageDuration = flag.Duration("storage_duration", 2*time.Minute, "How long to keep data stored (Default: 2min).")
 )
 
-// NewMemoryStorage creates a memory storage with an optional backend storage option.
-func NewMemoryStorage() (*memory.InMemoryCache, error) {
-	backendStorage, err := storage.New(*storageDriver)
+// NewMemoryStorage creates a memory storage with optional backend storages.
+// The backend storage is returned too, it is nil if there is none, and
+// fans out the stats if there are several.
+func NewMemoryStorage() (*memory.InMemoryCache, storage.StorageDriver, error) {
+	backendStorage, err := storage.NewMulti(*storageDriver)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	if *storageDriver != "" {
+	if backendStorage != nil {
 		glog.Infof("Using backend storage type %q", *storageDriver)
 	}
 	glog.Infof("Caching stats in memory for %v", *storageDuration)
-	return memory.New(*storageDuration, backendStorage), nil
+	// The backends adding batches of stats get the stats of a housekeeping
+	// cycle at once.
+	return memory.NewWithBatchInterval(*storageDuration, backendStorage, *manager.HousekeepingInterval), backendStorage, nil
 }